@@ -0,0 +1,8 @@
+package api
+
+// 供api_test包测试未导出的解析函数
+var (
+	ParseMode  = parseMode
+	ParseRange = parseRange
+	ParseSize  = parseSize
+)
@@ -54,6 +54,10 @@ func (i *IApi) GetInt(name string) int {
 	return utils.ToInt(i.R.URL.Query().Get(name))
 }
 
+func (i *IApi) GetInt64(name string) int64 {
+	return utils.ToInt64(i.R.URL.Query().Get(name))
+}
+
 func (i *IApi) PostString(name string) string {
 	return utils.ToString(i.R.FormValue(name))
 }
@@ -62,6 +66,10 @@ func (i *IApi) PostInt(name string) int {
 	return utils.ToInt(i.R.FormValue(name))
 }
 
+func (i *IApi) PostInt64(name string) int64 {
+	return utils.ToInt64(i.R.FormValue(name))
+}
+
 func (i *IApi) Register(action string, f func()) *IApi {
 	if i.Actions == nil {
 		i.Actions = map[string]func(){}
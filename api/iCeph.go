@@ -0,0 +1,60 @@
+package api
+
+import (
+	"ceph-panel-go/ceph"
+	"ceph-panel-go/config"
+	"net/http"
+	"time"
+)
+
+// ceph资源模块的基础结构
+type ICeph struct {
+	IApi
+	Cluster string        // 请求的cluster参数，为空时使用默认集群
+	Rados   ceph.LibRados // 为空时在connected中按Cluster从连接管理器获取
+}
+
+func NewICeph(config config.IConfig, w http.ResponseWriter, r *http.Request) *ICeph {
+	return &ICeph{
+		IApi:    *NewIApi(config, w, r),
+		Cluster: r.FormValue("cluster"),
+	}
+}
+
+// 检查集群是否已连接
+func (this *ICeph) connected() bool {
+	if this.Rados != nil {
+		return true
+	}
+	if ceph.Clusters == nil {
+		this.ResponseWithHeader(102, "", "集群未连接")
+		return false
+	}
+	rados, err := ceph.Clusters.Get(this.Cluster)
+	if err != nil {
+		this.ResponseWithHeader(102, "", "集群未连接 "+err.Error())
+		return false
+	}
+	this.Rados = rados
+	return true
+}
+
+// 打开存储池，返回的句柄使用完毕需调用Rados_ioctx_destroy
+func (this *ICeph) openPool(pool string) (ceph.LibRados, bool) {
+	if !this.connected() {
+		return nil, false
+	}
+	rados := this.Rados.Rados_clone()
+	if err := rados.Rados_ioctx_create(pool); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return nil, false
+	}
+	return rados, true
+}
+
+// 流式传输的时长取决于数据大小，取消服务器的读写超时
+func (this *ICeph) streaming() {
+	rc := http.NewResponseController(this.W)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+}
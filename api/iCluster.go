@@ -0,0 +1,42 @@
+package api
+
+import (
+	"ceph-panel-go/ceph"
+	"ceph-panel-go/config"
+	"net/http"
+)
+
+// 集群概况
+type ICluster struct {
+	ICeph
+}
+
+func NewICluster(config config.IConfig, w http.ResponseWriter, r *http.Request) *ICluster {
+	cluster := &ICluster{
+		ICeph: *NewICeph(config, w, r),
+	}
+	cluster.Module = "cluster"
+	return cluster
+}
+
+// 健康状态、容量、对象数、pg状态、mon仲裁及osd状态
+func (this *ICluster) Status() {
+	if !this.connected() {
+		return
+	}
+	summary, err := ceph.NewCommander(this.Rados).Summary()
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, summary, "集群状态")
+}
+
+// 已配置的集群及连接状态，用于选择集群
+func (this *ICluster) List() {
+	if ceph.Clusters == nil {
+		this.ResponseWithHeader(102, "", "集群未连接")
+		return
+	}
+	this.ResponseWithHeader(100, ceph.Clusters.Status(), "集群列表")
+}
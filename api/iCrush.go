@@ -0,0 +1,180 @@
+package api
+
+import (
+	"ceph-panel-go/ceph"
+	"ceph-panel-go/config"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// crush map查看及规则、bucket修改，move和reweight支持dry_run预测数据迁移
+type ICrush struct {
+	ICeph
+	commander *ceph.Commander
+}
+
+func NewICrush(config config.IConfig, w http.ResponseWriter, r *http.Request) *ICrush {
+	crush := &ICrush{
+		ICeph: *NewICeph(config, w, r),
+	}
+	crush.Module = "crush"
+	return crush
+}
+
+func (this *ICrush) command() bool {
+	if !this.connected() {
+		return false
+	}
+	this.commander = ceph.NewCommander(this.Rados)
+	return true
+}
+
+func (this *ICrush) dump() (*ceph.CrushMap, bool) {
+	if !this.command() {
+		return nil, false
+	}
+	m, err := this.commander.CrushDump()
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return nil, false
+	}
+	return m, true
+}
+
+// 完整的crush map，包括影子bucket
+func (this *ICrush) Map() {
+	if m, ok := this.dump(); ok {
+		this.ResponseWithHeader(100, m, "crush map")
+	}
+}
+
+func (this *ICrush) Tree() {
+	if m, ok := this.dump(); ok {
+		this.ResponseWithHeader(100, m.Tree(), "crush树")
+	}
+}
+
+func (this *ICrush) Rules() {
+	if m, ok := this.dump(); ok {
+		this.ResponseWithHeader(100, m.Rules, "crush规则")
+	}
+}
+
+func (this *ICrush) Classes() {
+	if m, ok := this.dump(); ok {
+		this.ResponseWithHeader(100, m.Classes(), "设备类型")
+	}
+}
+
+// type为故障域，默认host，class为空时使用所有设备
+func (this *ICrush) RuleCreate() {
+	name := this.PostString("name")
+	root := this.PostString("root")
+	if name == "" || root == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	if !this.command() {
+		return
+	}
+	outs, err := this.commander.CrushRuleCreate(name, root, this.PostString("type"), this.PostString("class"))
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, outs, "创建成功")
+}
+
+// 需要提交confirm为规则名称
+func (this *ICrush) RuleRemove() {
+	name := this.PostString("name")
+	if name == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	if this.PostString("confirm") != name {
+		this.ResponseWithHeader(101, "", "请输入规则名称确认删除")
+		return
+	}
+	if !this.command() {
+		return
+	}
+	outs, err := this.commander.CrushRuleRemove(name)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, outs, "删除成功")
+}
+
+func (this *ICrush) dryRun() bool {
+	return this.PostString("dry_run") == "1"
+}
+
+func (this *ICrush) movement(f func() (*ceph.CrushMovement, error)) {
+	movement, err := f()
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, movement, "预计数据迁移")
+}
+
+// location为逗号分隔的 类型=名称，如root=default,rack=rack1
+func (this *ICrush) Move() {
+	name := this.PostString("name")
+	location := map[string]string{}
+	for _, s := range splitList(this.PostString("location")) {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+			this.ResponseWithHeader(101, "", "无效的位置 "+s)
+			return
+		}
+		location[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	if name == "" || len(location) == 0 {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	if !this.command() {
+		return
+	}
+	if this.dryRun() {
+		this.movement(func() (*ceph.CrushMovement, error) { return this.commander.CrushMoveDryRun(name, location) })
+		return
+	}
+	outs, err := this.commander.CrushMove(name, location)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, outs, "移动成功")
+}
+
+// 修改osd的crush权重，单位TiB
+func (this *ICrush) Reweight() {
+	name := this.PostString("name")
+	if name == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	weight, err := strconv.ParseFloat(this.PostString("weight"), 64)
+	if err != nil || weight < 0 {
+		this.ResponseWithHeader(101, "", "无效的权重")
+		return
+	}
+	if !this.command() {
+		return
+	}
+	if this.dryRun() {
+		this.movement(func() (*ceph.CrushMovement, error) { return this.commander.CrushReweightDryRun(name, weight) })
+		return
+	}
+	outs, err := this.commander.CrushReweight(name, weight)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, outs, "调整成功")
+}
@@ -0,0 +1,79 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestICrush(t *testing.T) {
+	newFakeCluster(t)
+
+	res := callApi(t, "crush/tree", url.Values{})
+	tree, _ := res.Result.([]interface{})
+	if res.Code != 100 || len(tree) != 1 {
+		t.Fatalf("tree %+v", res)
+	}
+	res = callApi(t, "crush/classes", url.Values{})
+	if classes, _ := res.Result.([]interface{}); res.Code != 100 || len(classes) != 1 || classes[0] != "hdd" {
+		t.Fatalf("classes %+v", res)
+	}
+
+	if res := callApi(t, "crush/rule-create", url.Values{"name": {"by-osd"}}); res.Code != 101 {
+		t.Fatalf("create without root %+v", res)
+	}
+	if res := callApi(t, "crush/rule-create", url.Values{"name": {"by-osd"}, "root": {"default"}, "type": {"osd"}, "class": {"hdd"}}); res.Code != 100 {
+		t.Fatalf("create %+v", res)
+	}
+	res = callApi(t, "crush/rules", url.Values{})
+	if rules, _ := res.Result.([]interface{}); res.Code != 100 || len(rules) != 2 {
+		t.Fatalf("rules %+v", res)
+	}
+	if res := callApi(t, "crush/rule-remove", url.Values{"name": {"by-osd"}}); res.Code != 101 {
+		t.Fatalf("remove without confirm %+v", res)
+	}
+	if res := callApi(t, "crush/rule-remove", url.Values{"name": {"by-osd"}, "confirm": {"by-osd"}}); res.Code != 100 {
+		t.Fatalf("remove %+v", res)
+	}
+
+	if res := callApi(t, "crush/move", url.Values{"name": {"node1"}, "location": {"rack"}}); res.Code != 101 {
+		t.Fatalf("move invalid location %+v", res)
+	}
+	res = callApi(t, "crush/move", url.Values{"name": {"node1"}, "location": {"root=default,rack=rack1"}, "dry_run": {"1"}})
+	movement, _ := res.Result.(map[string]interface{})
+	if res.Code != 100 || movement["moved_pgs"] != float64(0) {
+		t.Fatalf("move dry run %+v", res)
+	}
+	res = callApi(t, "crush/map", url.Values{})
+	if m, _ := res.Result.(map[string]interface{}); res.Code != 100 || strings.Contains(crushJson(m["buckets"]), "rack1") {
+		t.Fatalf("dry run changed map %+v", res)
+	}
+	if res := callApi(t, "crush/move", url.Values{"name": {"node1"}, "location": {"root=default,rack=rack1"}}); res.Code != 100 {
+		t.Fatalf("move %+v", res)
+	}
+	res = callApi(t, "crush/map", url.Values{})
+	if m, _ := res.Result.(map[string]interface{}); !strings.Contains(crushJson(m["buckets"]), "rack1") {
+		t.Fatalf("map after move %+v", res)
+	}
+
+	if res := callApi(t, "crush/reweight", url.Values{"name": {"osd.0"}, "weight": {"-1"}}); res.Code != 101 {
+		t.Fatalf("reweight invalid weight %+v", res)
+	}
+	res = callApi(t, "crush/reweight", url.Values{"name": {"osd.0"}, "weight": {"0"}, "dry_run": {"1"}})
+	movement, _ = res.Result.(map[string]interface{})
+	if osds, _ := movement["osds"].([]interface{}); res.Code != 100 || len(osds) != 1 {
+		t.Fatalf("reweight dry run %+v", res)
+	}
+	if res := callApi(t, "crush/reweight", url.Values{"name": {"node1"}, "weight": {"1"}}); res.Code != 102 {
+		t.Fatalf("reweight bucket %+v", res)
+	}
+	if res := callApi(t, "crush/reweight", url.Values{"name": {"osd.0"}, "weight": {"0.5"}}); res.Code != 100 {
+		t.Fatalf("reweight %+v", res)
+	}
+}
+
+func crushJson(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"ceph-panel-go/ceph"
+	"ceph-panel-go/config"
+	"net/http"
+)
+
+// mon及mgr守护进程状态
+type IDaemon struct {
+	ICeph
+	commander *ceph.Commander
+}
+
+func NewIDaemon(config config.IConfig, w http.ResponseWriter, r *http.Request) *IDaemon {
+	daemon := &IDaemon{
+		ICeph: *NewICeph(config, w, r),
+	}
+	daemon.Module = "daemon"
+	return daemon
+}
+
+func (this *IDaemon) command() bool {
+	if !this.connected() {
+		return false
+	}
+	this.commander = ceph.NewCommander(this.Rados)
+	return true
+}
+
+// mon和mgr状态
+func (this *IDaemon) Status() {
+	if !this.command() {
+		return
+	}
+	mon, err := this.commander.MonStatus()
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	mgr, err := this.commander.MgrStatus()
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, map[string]interface{}{"mon": mon, "mgr": mgr}, "守护进程状态")
+}
+
+// quorum成员、leader及时钟偏差
+func (this *IDaemon) Mons() {
+	if !this.command() {
+		return
+	}
+	status, err := this.commander.MonStatus()
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, status, "mon状态")
+}
+
+// active/standby mgr及模块
+func (this *IDaemon) Mgrs() {
+	if !this.command() {
+		return
+	}
+	status, err := this.commander.MgrStatus()
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, status, "mgr状态")
+}
+
+// force为1时即使模块报告不能运行也启用
+func (this *IDaemon) ModuleEnable() {
+	module := this.PostString("module")
+	if module == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	if !this.command() {
+		return
+	}
+	outs, err := this.commander.MgrModuleEnable(module, this.PostString("force") == "1")
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, outs, "已启用")
+}
+
+func (this *IDaemon) ModuleDisable() {
+	module := this.PostString("module")
+	if module == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	if !this.command() {
+		return
+	}
+	outs, err := this.commander.MgrModuleDisable(module)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, outs, "已禁用")
+}
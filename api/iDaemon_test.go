@@ -0,0 +1,44 @@
+package api_test
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestIDaemon(t *testing.T) {
+	newFakeCluster(t)
+
+	res := callApi(t, "daemon/status", url.Values{})
+	status, _ := res.Result.(map[string]interface{})
+	if res.Code != 100 || status["mon"] == nil || status["mgr"] == nil {
+		t.Fatalf("status %+v", res)
+	}
+	res = callApi(t, "daemon/mons", url.Values{})
+	mon, _ := res.Result.(map[string]interface{})
+	if mons, _ := mon["mons"].([]interface{}); res.Code != 100 || mon["leader"] != "node1" || len(mons) != 3 {
+		t.Fatalf("mons %+v", res)
+	}
+	res = callApi(t, "daemon/mgrs", url.Values{})
+	if mgr, _ := res.Result.(map[string]interface{}); res.Code != 100 || mgr["active"] != "node1" {
+		t.Fatalf("mgrs %+v", res)
+	}
+
+	if res := callApi(t, "daemon/module-enable", url.Values{}); res.Code != 101 {
+		t.Fatalf("enable without module %+v", res)
+	}
+	if res := callApi(t, "daemon/module-enable", url.Values{"module": {"prometheus"}}); res.Code != 100 {
+		t.Fatalf("enable %+v", res)
+	}
+	if res := callApi(t, "daemon/module-enable", url.Values{"module": {"influx"}}); res.Code != 102 {
+		t.Fatalf("enable module that cannot run %+v", res)
+	}
+	if res := callApi(t, "daemon/module-enable", url.Values{"module": {"influx"}, "force": {"1"}}); res.Code != 100 {
+		t.Fatalf("force enable %+v", res)
+	}
+	if res := callApi(t, "daemon/module-disable", url.Values{"module": {"prometheus"}}); res.Code != 100 {
+		t.Fatalf("disable %+v", res)
+	}
+	if res := callApi(t, "daemon/module-disable", url.Values{"module": {"balancer"}}); res.Code != 102 {
+		t.Fatalf("disable always-on %+v", res)
+	}
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"ceph-panel-go/ceph"
+	"ceph-panel-go/config"
+	"net/http"
+	"strings"
+)
+
+// 集群标志及osd/crush节点标志
+type IFlag struct {
+	ICeph
+}
+
+func NewIFlag(config config.IConfig, w http.ResponseWriter, r *http.Request) *IFlag {
+	flag := &IFlag{
+		ICeph: *NewICeph(config, w, r),
+	}
+	flag.Module = "flag"
+	return flag
+}
+
+// 逗号分隔的列表，忽略空项
+func splitList(value string) []string {
+	list := []string{}
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+func validFlag(flag string) bool {
+	for _, f := range ceph.OSD_FLAGS {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *IFlag) List() {
+	if !this.connected() {
+		return
+	}
+	flags, err := ceph.NewCommander(this.Rados).OsdFlags()
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	result := map[string]interface{}{
+		"flags":       flags,
+		"valid":       ceph.OSD_FLAGS,
+		"valid_group": ceph.OSD_GROUP_FLAGS,
+	}
+	this.ResponseWithHeader(100, result, "标志列表")
+}
+
+// flags为逗号分隔的标志，who为空时设置集群标志，否则为逗号分隔的osd或crush节点名称
+func (this *IFlag) change(set bool) {
+	flags := splitList(this.PostString("flags"))
+	if len(flags) == 0 {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	if !this.connected() {
+		return
+	}
+	commander := ceph.NewCommander(this.Rados)
+	who := splitList(this.PostString("who"))
+	var err error
+	if len(who) > 0 && set {
+		_, err = commander.OsdSetGroupFlags(flags, who)
+	} else if len(who) > 0 {
+		_, err = commander.OsdUnsetGroupFlags(flags, who)
+	} else {
+		// 先检查所有标志，避免只设置了一部分
+		for _, flag := range flags {
+			if !validFlag(flag) {
+				this.ResponseWithHeader(101, "", "无效的标志 "+flag)
+				return
+			}
+		}
+		for _, flag := range flags {
+			if set {
+				_, err = commander.OsdSetFlag(flag)
+			} else {
+				_, err = commander.OsdUnsetFlag(flag)
+			}
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	result, err := commander.OsdFlags()
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, result, "设置成功")
+}
+
+func (this *IFlag) Set() {
+	this.change(true)
+}
+
+func (this *IFlag) Unset() {
+	this.change(false)
+}
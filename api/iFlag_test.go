@@ -0,0 +1,41 @@
+package api_test
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestIFlag(t *testing.T) {
+	newFakeCluster(t)
+
+	if res := callApi(t, "flag/set", url.Values{}); res.Code != 101 {
+		t.Fatalf("set without flags %+v", res)
+	}
+	if res := callApi(t, "flag/set", url.Values{"flags": {"noout,bogus"}}); res.Code != 101 {
+		t.Fatalf("set invalid flag %+v", res)
+	}
+	res := callApi(t, "flag/set", url.Values{"flags": {"noout,noscrub"}})
+	flags, _ := res.Result.(map[string]interface{})
+	if res.Code != 100 || len(flags["cluster"].([]interface{})) != 2 {
+		t.Fatalf("set %+v", res)
+	}
+	res = callApi(t, "flag/set", url.Values{"flags": {"noout"}, "who": {"osd.0,node2"}})
+	flags, _ = res.Result.(map[string]interface{})
+	if res.Code != 100 || len(flags["osds"].(map[string]interface{})) != 1 || len(flags["nodes"].(map[string]interface{})) != 1 {
+		t.Fatalf("set group %+v", res)
+	}
+	if res := callApi(t, "flag/set", url.Values{"flags": {"noscrub"}, "who": {"osd.0"}}); res.Code != 102 {
+		t.Fatalf("set non-group flag on osd %+v", res)
+	}
+	if res := callApi(t, "flag/unset", url.Values{"flags": {"noout"}, "who": {"osd.0,node2"}}); res.Code != 100 {
+		t.Fatalf("unset group %+v", res)
+	}
+	res = callApi(t, "flag/unset", url.Values{"flags": {"noout,noscrub"}})
+	flags, _ = res.Result.(map[string]interface{})
+	if res.Code != 100 || len(flags["cluster"].([]interface{})) != 0 || len(flags["osds"].(map[string]interface{})) != 0 {
+		t.Fatalf("unset %+v", res)
+	}
+	if res := callApi(t, "flag/list", url.Values{}); res.Code != 100 {
+		t.Fatalf("list %+v", res)
+	}
+}
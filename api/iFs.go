@@ -0,0 +1,583 @@
+package api
+
+import (
+	"ceph-panel-go/ceph"
+	"ceph-panel-go/config"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// 解析八进制的权限，为空时使用默认值
+func parseMode(mode string, def uint32) (uint32, error) {
+	if mode == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || n > 07777 {
+		return 0, errors.New("invalid mode " + mode)
+	}
+	return uint32(n), nil
+}
+
+// cephfs文件浏览，fs参数选择文件系统，为空时使用默认文件系统
+type IFs struct {
+	ICeph
+}
+
+func NewIFs(config config.IConfig, w http.ResponseWriter, r *http.Request) *IFs {
+	fs := &IFs{
+		ICeph: *NewICeph(config, w, r),
+	}
+	fs.Module = "fs"
+	return fs
+}
+
+// 文件系统的挂载由连接管理器缓存，多个请求共用，不能卸载
+func (this *IFs) mount(fsName string) (ceph.Libcephfs, bool) {
+	if ceph.Clusters == nil {
+		this.ResponseWithHeader(102, "", "集群未连接")
+		return nil, false
+	}
+	fs, err := ceph.Clusters.Mount(this.Cluster, fsName)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return nil, false
+	}
+	return fs, true
+}
+
+// 检查路径参数
+func (this *IFs) path(p string) (string, bool) {
+	if p == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return "", false
+	}
+	clean, err := ceph.CleanCephfsPath(p)
+	if err != nil {
+		this.ResponseWithHeader(101, "", err.Error())
+		return "", false
+	}
+	return clean, true
+}
+
+// 文件系统列表
+func (this *IFs) List() {
+	if !this.connected() {
+		return
+	}
+	list, err := ceph.NewCommander(this.Rados).FsList()
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, list, "文件系统列表")
+}
+
+// 目录内容，path为空时为根目录
+func (this *IFs) Ls() {
+	p := this.GetString("path")
+	if p == "" {
+		p = "/"
+	}
+	p, ok := this.path(p)
+	if !ok {
+		return
+	}
+	fs, ok := this.mount(this.GetString("fs"))
+	if !ok {
+		return
+	}
+
+	entries, err := fs.Ceph_listdir(p)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, entries, "目录内容")
+}
+
+func (this *IFs) Stat() {
+	p, ok := this.path(this.GetString("path"))
+	if !ok {
+		return
+	}
+	fs, ok := this.mount(this.GetString("fs"))
+	if !ok {
+		return
+	}
+
+	stat, err := fs.Ceph_stat(p)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, stat, "文件信息")
+}
+
+// mode为八进制权限，parents=1时创建不存在的上级目录
+func (this *IFs) Mkdir() {
+	p, ok := this.path(this.PostString("path"))
+	if !ok {
+		return
+	}
+	mode, err := parseMode(this.PostString("mode"), ceph.CEPHFS_DEFAULT_DIR_MODE)
+	if err != nil {
+		this.ResponseWithHeader(101, "", err.Error())
+		return
+	}
+	fs, ok := this.mount(this.PostString("fs"))
+	if !ok {
+		return
+	}
+
+	if this.PostInt("parents") == 1 {
+		err = fs.Ceph_mkdirs(p, mode)
+	} else {
+		err = fs.Ceph_mkdir(p, mode)
+	}
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, p, "创建成功")
+}
+
+// 删除空目录
+func (this *IFs) Rmdir() {
+	this.remove(ceph.Libcephfs.Ceph_rmdir)
+}
+
+// 删除文件
+func (this *IFs) Unlink() {
+	this.remove(ceph.Libcephfs.Ceph_unlink)
+}
+
+func (this *IFs) remove(op func(fs ceph.Libcephfs, path string) error) {
+	p, ok := this.path(this.PostString("path"))
+	if !ok {
+		return
+	}
+	if p == "/" {
+		this.ResponseWithHeader(101, "", "不能删除根目录")
+		return
+	}
+	fs, ok := this.mount(this.PostString("fs"))
+	if !ok {
+		return
+	}
+
+	if err := op(fs, p); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, p, "删除成功")
+}
+
+// 重命名或移动，dest已存在时替换
+func (this *IFs) Rename() {
+	p, ok := this.path(this.PostString("path"))
+	if !ok {
+		return
+	}
+	dest, ok := this.path(this.PostString("dest"))
+	if !ok {
+		return
+	}
+	fs, ok := this.mount(this.PostString("fs"))
+	if !ok {
+		return
+	}
+
+	if err := fs.Ceph_rename(p, dest); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, dest, "重命名成功")
+}
+
+func (this *IFs) Chmod() {
+	p, ok := this.path(this.PostString("path"))
+	if !ok {
+		return
+	}
+	if this.PostString("mode") == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	mode, err := parseMode(this.PostString("mode"), 0)
+	if err != nil {
+		this.ResponseWithHeader(101, "", err.Error())
+		return
+	}
+	fs, ok := this.mount(this.PostString("fs"))
+	if !ok {
+		return
+	}
+
+	if err := fs.Ceph_chmod(p, mode); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, p, "修改成功")
+}
+
+// 下载文件，支持单个Range
+func (this *IFs) Download() {
+	this.streaming()
+	p, ok := this.path(this.GetString("path"))
+	if !ok {
+		return
+	}
+	fs, ok := this.mount(this.GetString("fs"))
+	if !ok {
+		return
+	}
+
+	stat, err := fs.Ceph_stat(p)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	if stat.IsDir() {
+		this.ResponseWithHeader(102, "", "不能下载目录")
+		return
+	}
+	file, err := fs.Ceph_open(p, ceph.CEPHFS_O_RDONLY, 0)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	defer file.Close()
+
+	start, length, partial, err := parseRange(this.R.Header.Get("Range"), stat.Size)
+	header := this.W.Header()
+	header.Set("Accept-Ranges", "bytes")
+	if err != nil {
+		header.Set("Content-Range", "bytes */"+strconv.FormatUint(stat.Size, 10))
+		this.W.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	header.Set("Content-Type", "application/octet-stream")
+	header.Set("Content-Disposition", "attachment; filename=\""+strings.ReplaceAll(path.Base(p), "\"", "")+"\"")
+	header.Set("Content-Length", strconv.FormatUint(length, 10))
+	header.Set("Last-Modified", stat.Mtime.UTC().Format(http.TimeFormat))
+	if partial {
+		header.Set("Content-Range", "bytes "+strconv.FormatUint(start, 10)+"-"+strconv.FormatUint(start+length-1, 10)+"/"+strconv.FormatUint(stat.Size, 10))
+		this.W.WriteHeader(http.StatusPartialContent)
+	} else {
+		this.W.WriteHeader(http.StatusOK)
+	}
+	if this.R.Method == http.MethodHead {
+		return
+	}
+	// 响应头已发送，出错时只能中断连接
+	reader := io.NewSectionReader(file, int64(start), int64(length))
+	if _, err := io.CopyBuffer(this.W, reader, make([]byte, ceph.OBJECT_STREAM_CHUNK)); err != nil {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// 以请求体上传文件，overwrite=1时覆盖已存在的文件，上传完成后才替换原有文件
+func (this *IFs) Upload() {
+	this.streaming()
+	p, ok := this.path(this.GetString("path"))
+	if !ok {
+		return
+	}
+	mode, err := parseMode(this.GetString("mode"), ceph.CEPHFS_DEFAULT_FILE_MODE)
+	if err != nil {
+		this.ResponseWithHeader(101, "", err.Error())
+		return
+	}
+	id := this.GetString("upload_id")
+	fs, ok := this.mount(this.GetString("fs"))
+	if !ok {
+		return
+	}
+
+	fail := func(err error) {
+		setUploadProgress(id, func(p *UploadProgress) {
+			p.Done = true
+			p.Error = err.Error()
+		})
+		this.ResponseWithHeader(102, "", err.Error())
+	}
+	setUploadProgress(id, func(progress *UploadProgress) {
+		*progress = UploadProgress{Object: p, Total: this.R.ContentLength}
+	})
+	overwrite := this.GetInt("overwrite") == 1
+	exists := func() bool {
+		if _, err := fs.Ceph_stat(p); err == nil && !overwrite {
+			fail(errors.New("cannot upload file[" + p + "], file exists"))
+			return true
+		}
+		return false
+	}
+	if exists() {
+		return
+	}
+	// 先写入同目录下的临时文件，完成后重命名为目标文件，上传中断时不影响原有文件
+	tmp, err := uploadTempName(path.Join(path.Dir(p), "."+path.Base(p)))
+	if err != nil {
+		fail(err)
+		return
+	}
+	file, err := fs.Ceph_open(tmp, ceph.CEPHFS_O_WRONLY|ceph.CEPHFS_O_CREAT|ceph.CEPHFS_O_EXCL, mode)
+	if err != nil {
+		fail(err)
+		return
+	}
+	renamed := false
+	defer func() {
+		if !renamed {
+			fs.Ceph_unlink(tmp)
+		}
+	}()
+
+	buf := make([]byte, ceph.OBJECT_STREAM_CHUNK)
+	var written uint64
+	for {
+		n, err := io.ReadFull(this.R.Body, buf)
+		if n > 0 {
+			if _, err := file.WriteAt(buf[:n], int64(written)); err != nil {
+				file.Close()
+				fail(err)
+				return
+			}
+			written += uint64(n)
+			setUploadProgress(id, func(p *UploadProgress) {
+				p.Written = written
+			})
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			file.Close()
+			fail(err)
+			return
+		}
+	}
+	if err := file.Close(); err != nil {
+		fail(err)
+		return
+	}
+	// 上传期间可能已创建同名文件
+	if exists() {
+		return
+	}
+	if err := fs.Ceph_rename(tmp, p); err != nil {
+		fail(err)
+		return
+	}
+	renamed = true
+	setUploadProgress(id, func(p *UploadProgress) {
+		p.Done = true
+	})
+	result := map[string]interface{}{
+		"path": p,
+		"size": written,
+	}
+	this.ResponseWithHeader(100, result, "上传成功")
+}
+
+// 目录配额及已使用量
+func (this *IFs) Quota() {
+	p, ok := this.path(this.GetString("path"))
+	if !ok {
+		return
+	}
+	fs, ok := this.mount(this.GetString("fs"))
+	if !ok {
+		return
+	}
+
+	quota, err := ceph.GetCephfsQuota(fs, p)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, quota, "目录配额")
+}
+
+// max_bytes支持K/M/G等后缀，0为取消限制，未提交的项保持不变
+func (this *IFs) SetQuota() {
+	p, ok := this.path(this.PostString("path"))
+	if !ok {
+		return
+	}
+	maxBytes, maxFiles := this.PostString("max_bytes"), this.PostString("max_files")
+	if maxBytes == "" && maxFiles == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	fs, ok := this.mount(this.PostString("fs"))
+	if !ok {
+		return
+	}
+
+	quota, err := ceph.GetCephfsQuota(fs, p)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	if maxBytes == "0" {
+		quota.MaxBytes = 0
+	} else if maxBytes != "" {
+		if quota.MaxBytes, err = parseSize(maxBytes); err != nil {
+			this.ResponseWithHeader(101, "", err.Error())
+			return
+		}
+	}
+	if maxFiles != "" {
+		if quota.MaxFiles, err = strconv.ParseUint(maxFiles, 10, 64); err != nil {
+			this.ResponseWithHeader(101, "", "invalid max_files "+maxFiles)
+			return
+		}
+	}
+	if err := ceph.SetCephfsQuota(fs, p, quota.MaxBytes, quota.MaxFiles); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, quota, "设置成功")
+}
+
+// 文件或目录的布局，目录未设置时inherited为布局所在的上级目录
+func (this *IFs) Layout() {
+	p, ok := this.path(this.GetString("path"))
+	if !ok {
+		return
+	}
+	fs, ok := this.mount(this.GetString("fs"))
+	if !ok {
+		return
+	}
+
+	layout, err := ceph.GetCephfsLayout(fs, p)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, layout, "文件布局")
+}
+
+// 未提交的项保持不变，stripe_unit和object_size支持K/M后缀
+func (this *IFs) SetLayout() {
+	p, ok := this.path(this.PostString("path"))
+	if !ok {
+		return
+	}
+	layout := ceph.CephfsLayout{
+		Pool:          this.PostString("pool"),
+		PoolNamespace: this.PostString("pool_namespace"),
+	}
+	sizes := []struct {
+		name  string
+		value *uint64
+	}{
+		{"stripe_unit", &layout.StripeUnit},
+		{"stripe_count", &layout.StripeCount},
+		{"object_size", &layout.ObjectSize},
+	}
+	for _, size := range sizes {
+		if this.PostString(size.name) == "" {
+			continue
+		}
+		n, err := parseSize(this.PostString(size.name))
+		if err != nil {
+			this.ResponseWithHeader(101, "", size.name+": "+err.Error())
+			return
+		}
+		*size.value = n
+	}
+	if layout == (ceph.CephfsLayout{}) {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	fs, ok := this.mount(this.PostString("fs"))
+	if !ok {
+		return
+	}
+
+	if err := ceph.SetCephfsLayout(fs, p, layout); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	layout, err := ceph.GetCephfsLayout(fs, p)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, layout, "设置成功")
+}
+
+// 删除目录的布局，之后继承上级目录
+func (this *IFs) RmLayout() {
+	p, ok := this.path(this.PostString("path"))
+	if !ok {
+		return
+	}
+	fs, ok := this.mount(this.PostString("fs"))
+	if !ok {
+		return
+	}
+
+	if err := ceph.RemoveCephfsLayout(fs, p); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, p, "删除成功")
+}
+
+// 目录的快照，包括上级目录的快照
+func (this *IFs) Snaps() {
+	p, ok := this.path(this.GetString("path"))
+	if !ok {
+		return
+	}
+	fs, ok := this.mount(this.GetString("fs"))
+	if !ok {
+		return
+	}
+
+	snaps, err := ceph.CephfsSnapList(fs, p)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, snaps, "快照列表")
+}
+
+func (this *IFs) SnapCreate() {
+	this.snapOp(ceph.CephfsSnapCreate, "创建成功")
+}
+
+func (this *IFs) SnapRemove() {
+	this.snapOp(ceph.CephfsSnapRemove, "删除成功")
+}
+
+func (this *IFs) snapOp(op func(fs ceph.Libcephfs, dir string, snap_name string) error, msg string) {
+	p, ok := this.path(this.PostString("path"))
+	if !ok {
+		return
+	}
+	name := this.PostString("name")
+	if name == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	fs, ok := this.mount(this.PostString("fs"))
+	if !ok {
+		return
+	}
+
+	if err := op(fs, p, name); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, name, msg)
+}
@@ -0,0 +1,184 @@
+package api_test
+
+import (
+	"ceph-panel-go/api"
+	"ceph-panel-go/template"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseMode(t *testing.T) {
+	if mode, err := api.ParseMode("", 0755); err != nil || mode != 0755 {
+		t.Fatalf("default mode %o %v", mode, err)
+	}
+	if mode, err := api.ParseMode("0700", 0); err != nil || mode != 0700 {
+		t.Fatalf("mode %o %v", mode, err)
+	}
+	for _, in := range []string{"8", "rwx", "17777"} {
+		if _, err := api.ParseMode(in, 0); err == nil {
+			t.Fatalf("expected %q to be invalid", in)
+		}
+	}
+}
+
+func TestIFs(t *testing.T) {
+	newFakeCluster(t)
+
+	res := callApi(t, "fs/list", url.Values{})
+	if res.Code != 100 || res.Result.([]interface{})[0].(map[string]interface{})["name"] != "cephfs" {
+		t.Fatalf("list %+v", res)
+	}
+	if res := callApi(t, "fs/mkdir", url.Values{"path": {"/tenants/a"}}); res.Code != 102 {
+		t.Fatalf("mkdir without parents %+v", res)
+	}
+	if res := callApi(t, "fs/mkdir", url.Values{"path": {"/tenants/a"}, "parents": {"1"}, "mode": {"750"}}); res.Code != 100 {
+		t.Fatalf("mkdir %+v", res)
+	}
+	if res := callApi(t, "fs/mkdir", url.Values{"path": {"tenants"}}); res.Code != 101 {
+		t.Fatalf("mkdir with relative path %+v", res)
+	}
+
+	r := httptest.NewRequest("PUT", "/api/fs/upload?path=/tenants/a/f.txt&upload_id=f1", strings.NewReader("hello cephfs"))
+	w := serveApi(r)
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.Code != 100 {
+		t.Fatalf("upload %v %s", err, w.Body.String())
+	}
+	r = httptest.NewRequest("PUT", "/api/fs/upload?path=/tenants/a/f.txt", strings.NewReader("again"))
+	w = serveApi(r)
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.Code != 102 {
+		t.Fatalf("upload without overwrite %v %s", err, w.Body.String())
+	}
+
+	res = callApi(t, "fs/ls", url.Values{"path": {"/tenants/a"}})
+	entries, _ := res.Result.([]interface{})
+	if res.Code != 100 || len(entries) != 1 || entries[0].(map[string]interface{})["size"].(float64) != 12 {
+		t.Fatalf("ls %+v", res)
+	}
+	res = callApi(t, "fs/stat", url.Values{"path": {"/tenants/a"}})
+	if res.Code != 100 || res.Result.(map[string]interface{})["mode"].(float64) != 0750 {
+		t.Fatalf("stat %+v", res)
+	}
+
+	r = httptest.NewRequest("GET", "/api/fs/download?path=/tenants/a/f.txt", nil)
+	r.Header.Set("Range", "bytes=6-")
+	w = serveApi(r)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "cephfs" {
+		t.Fatalf("download %d %q", w.Code, w.Body.String())
+	}
+
+	if res := callApi(t, "fs/rename", url.Values{"path": {"/tenants/a/f.txt"}, "dest": {"/tenants/g.txt"}}); res.Code != 100 {
+		t.Fatalf("rename %+v", res)
+	}
+	if res := callApi(t, "fs/rmdir", url.Values{"path": {"/tenants"}}); res.Code != 102 {
+		t.Fatalf("rmdir not empty %+v", res)
+	}
+	if res := callApi(t, "fs/unlink", url.Values{"path": {"/tenants/g.txt"}}); res.Code != 100 {
+		t.Fatalf("unlink %+v", res)
+	}
+	if res := callApi(t, "fs/rmdir", url.Values{"path": {"/"}}); res.Code != 101 {
+		t.Fatalf("rmdir root %+v", res)
+	}
+	if res := callApi(t, "fs/ls", url.Values{"fs": {"nofs"}}); res.Code != 102 {
+		t.Fatalf("ls unknown filesystem %+v", res)
+	}
+}
+
+func TestIFs_quotaLayoutSnap(t *testing.T) {
+	newFakeCluster(t)
+	callApi(t, "fs/mkdir", url.Values{"path": {"/tenants/a"}, "parents": {"1"}})
+
+	if res := callApi(t, "fs/set-quota", url.Values{"path": {"/tenants/a"}}); res.Code != 101 {
+		t.Fatalf("set-quota without limits %+v", res)
+	}
+	if res := callApi(t, "fs/set-quota", url.Values{"path": {"/tenants/a"}, "max_bytes": {"1G"}}); res.Code != 100 {
+		t.Fatalf("set-quota %+v", res)
+	}
+	callApi(t, "fs/set-quota", url.Values{"path": {"/tenants/a"}, "max_files": {"100"}})
+	res := callApi(t, "fs/quota", url.Values{"path": {"/tenants/a"}})
+	quota, _ := res.Result.(map[string]interface{})
+	if res.Code != 100 || quota["max_bytes"].(float64) != 1<<30 || quota["max_files"].(float64) != 100 {
+		t.Fatalf("quota %+v", res)
+	}
+
+	if res := callApi(t, "fs/set-layout", url.Values{"path": {"/tenants/a"}, "stripe_unit": {"abc"}}); res.Code != 101 {
+		t.Fatalf("set-layout with invalid stripe_unit %+v", res)
+	}
+	if res := callApi(t, "fs/set-layout", url.Values{"path": {"/tenants/a"}, "pool": {"nopool"}}); res.Code != 102 {
+		t.Fatalf("set-layout with unknown pool %+v", res)
+	}
+	res = callApi(t, "fs/set-layout", url.Values{"path": {"/tenants/a"}, "stripe_unit": {"1M"}, "stripe_count": {"2"}})
+	if res.Code != 100 || res.Result.(map[string]interface{})["stripe_count"].(float64) != 2 {
+		t.Fatalf("set-layout %+v", res)
+	}
+	if res := callApi(t, "fs/rm-layout", url.Values{"path": {"/tenants/a"}}); res.Code != 100 {
+		t.Fatalf("rm-layout %+v", res)
+	}
+	res = callApi(t, "fs/layout", url.Values{"path": {"/tenants/a"}})
+	if res.Code != 100 || res.Result.(map[string]interface{})["inherited"] != "/" {
+		t.Fatalf("layout %+v", res)
+	}
+
+	if res := callApi(t, "fs/snap-create", url.Values{"path": {"/tenants/a"}}); res.Code != 101 {
+		t.Fatalf("snap-create without name %+v", res)
+	}
+	if res := callApi(t, "fs/snap-create", url.Values{"path": {"/tenants"}, "name": {"daily"}}); res.Code != 100 {
+		t.Fatalf("snap-create %+v", res)
+	}
+	res = callApi(t, "fs/snaps", url.Values{"path": {"/tenants/a"}})
+	snaps, _ := res.Result.([]interface{})
+	if res.Code != 100 || len(snaps) != 1 || snaps[0].(map[string]interface{})["inherited"] != true {
+		t.Fatalf("snaps %+v", res)
+	}
+	if res := callApi(t, "fs/snap-remove", url.Values{"path": {"/tenants"}, "name": {"daily"}}); res.Code != 100 {
+		t.Fatalf("snap-remove %+v", res)
+	}
+}
+
+// 读到一半出错的请求体
+type brokenBody struct{ data io.Reader }
+
+func (b *brokenBody) Read(p []byte) (int, error) {
+	if n, _ := b.data.Read(p); n > 0 {
+		return n, nil
+	}
+	return 0, errors.New("connection reset")
+}
+
+func TestIFs_uploadOverwrite(t *testing.T) {
+	newFakeCluster(t)
+	callApi(t, "fs/mkdir", url.Values{"path": {"/a"}})
+	upload := func(body io.Reader) template.ResponseData {
+		return decodeApi(t, streamApi("PUT", "fs/upload", url.Values{"path": {"/a/f.txt"}, "overwrite": {"1"}}, body))
+	}
+	content := func() string {
+		w := serveApi(httptest.NewRequest("GET", "/api/fs/download?path=/a/f.txt", nil))
+		return w.Body.String()
+	}
+
+	if res := upload(strings.NewReader("original content")); res.Code != 100 {
+		t.Fatalf("upload %+v", res)
+	}
+	if res := upload(&brokenBody{strings.NewReader("new")}); res.Code != 102 {
+		t.Fatalf("interrupted overwrite %+v", res)
+	}
+	if got := content(); got != "original content" {
+		t.Fatalf("interrupted overwrite changed file %q", got)
+	}
+	if res := upload(strings.NewReader("new")); res.Code != 100 {
+		t.Fatalf("overwrite %+v", res)
+	}
+	if got := content(); got != "new" {
+		t.Fatalf("overwrite %q", got)
+	}
+	res := callApi(t, "fs/ls", url.Values{"path": {"/a"}})
+	entries, _ := res.Result.([]interface{})
+	if res.Code != 100 || len(entries) != 1 || entries[0].(map[string]interface{})["name"] != "f.txt" {
+		t.Fatalf("temporary file left %+v", res)
+	}
+}
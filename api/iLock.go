@@ -0,0 +1,208 @@
+package api
+
+import (
+	"ceph-panel-go/ceph"
+	"ceph-panel-go/config"
+	"ceph-panel-go/middleware"
+	"ceph-panel-go/utils"
+	"net/http"
+	"time"
+)
+
+// 对象的建议锁
+type ILock struct {
+	ICeph
+}
+
+func NewILock(config config.IConfig, w http.ResponseWriter, r *http.Request) *ILock {
+	lock := &ILock{
+		ICeph: *NewICeph(config, w, r),
+	}
+	lock.Module = "lock"
+	return lock
+}
+
+func (this *ILock) openObject(pool string, nspace string) (ceph.LibRados, bool) {
+	rados, ok := this.openPool(pool)
+	if !ok {
+		return nil, false
+	}
+	rados.Rados_ioctx_set_namespace(nspace)
+	return rados, true
+}
+
+// 对象上的所有锁及其持有者
+func (this *ILock) List() {
+	pool := this.GetString("pool")
+	object := this.GetString("object")
+	if pool == "" || object == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rados, ok := this.openObject(pool, this.GetString("namespace"))
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	names, err := rados.Rados_list_locks(object)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	locks := []ceph.LockInfo{}
+	for _, name := range names {
+		info, err := rados.Rados_list_lockers(object, name)
+		if err != nil {
+			this.ResponseWithHeader(102, "", err.Error())
+			return
+		}
+		locks = append(locks, info)
+	}
+	this.ResponseWithHeader(100, locks, "锁列表")
+}
+
+// 加锁，type为exclusive或shared，duration单位为秒，renew=1时续期已持有的锁
+func (this *ILock) Lock() {
+	pool := this.PostString("pool")
+	object := this.PostString("object")
+	name := this.PostString("lock")
+	if pool == "" || object == "" || name == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	lockType := this.PostString("type")
+	if lockType == "" {
+		lockType = ceph.LOCK_EXCLUSIVE
+	}
+	if lockType != ceph.LOCK_EXCLUSIVE && lockType != ceph.LOCK_SHARED {
+		this.ResponseWithHeader(101, "", "type只能为exclusive或shared")
+		return
+	}
+	duration := this.PostInt64("duration")
+	if duration < 0 {
+		this.ResponseWithHeader(101, "", "duration不能为负数")
+		return
+	}
+	opts := ceph.LockOptions{
+		Cookie:      this.PostString("cookie"),
+		Tag:         this.PostString("tag"),
+		Description: this.PostString("description"),
+		Duration:    time.Duration(duration) * time.Second,
+		Renew:       this.PostInt("renew") == 1,
+	}
+	rados, ok := this.openObject(pool, this.PostString("namespace"))
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	var err error
+	if lockType == ceph.LOCK_SHARED {
+		err = rados.Rados_lock_shared(object, name, opts)
+	} else {
+		err = rados.Rados_lock_exclusive(object, name, opts)
+	}
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, name, "加锁成功")
+}
+
+// 释放本客户端持有的锁
+func (this *ILock) Unlock() {
+	pool := this.PostString("pool")
+	object := this.PostString("object")
+	name := this.PostString("lock")
+	if pool == "" || object == "" || name == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rados, ok := this.openObject(pool, this.PostString("namespace"))
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	if err := rados.Rados_unlock(object, name, this.PostString("cookie")); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, name, "解锁成功")
+}
+
+// 强制解除其它客户端持有的锁，必须填写原因，无论成功与否都记录审计
+// 操作人为鉴权用户，未开启鉴权时为客户端地址
+func (this *ILock) Break() {
+	pool := this.PostString("pool")
+	object := this.PostString("object")
+	name := this.PostString("lock")
+	client := this.PostString("client")
+	reason := this.PostString("reason")
+	if pool == "" || object == "" || name == "" || client == "" || reason == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rados, ok := this.openObject(pool, this.PostString("namespace"))
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	audit := ceph.LockAudit{
+		Time:      time.Now(),
+		Cluster:   this.Cluster,
+		Pool:      pool,
+		Namespace: this.PostString("namespace"),
+		Object:    object,
+		Lock:      name,
+		Client:    client,
+		Cookie:    this.PostString("cookie"),
+		Reason:    reason,
+		Operator:  middleware.User(this.R),
+		IP:        utils.GetIPAdress(this.R),
+	}
+	if audit.Operator == "" {
+		audit.Operator = audit.IP
+	}
+	err := rados.Rados_break_lock(object, name, client, audit.Cookie)
+	if err != nil {
+		audit.Error = err.Error()
+	}
+	if middleware.Logger != nil {
+		middleware.Logger.Logger.Warningf("break lock %s on %s/%s by %s(%s) reason: %s error: %s",
+			name, pool, object, audit.Operator, audit.IP, reason, audit.Error)
+	}
+	if auditErr := ceph.NewCommander(this.Rados).AddLockAudit(audit); auditErr != nil {
+		this.ResponseWithHeader(102, audit, "审计记录保存失败 "+auditErr.Error())
+		return
+	}
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, audit, "强制解锁成功")
+}
+
+// 强制解锁的审计记录，按时间倒序，可按pool和object过滤
+func (this *ILock) Audit() {
+	pool := this.GetString("pool")
+	object := this.GetString("object")
+	if !this.connected() {
+		return
+	}
+	audits, err := ceph.NewCommander(this.Rados).LockAudits()
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	result := []ceph.LockAudit{}
+	for _, audit := range audits {
+		if (pool != "" && audit.Pool != pool) || (object != "" && audit.Object != object) {
+			continue
+		}
+		result = append(result, audit)
+	}
+	this.ResponseWithHeader(100, result, "强制解锁记录")
+}
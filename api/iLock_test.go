@@ -0,0 +1,78 @@
+package api_test
+
+import (
+	"ceph-panel-go/ceph"
+	"ceph-panel-go/middleware"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestILock(t *testing.T) {
+	rados := newFakeCluster(t)
+	obj := url.Values{"pool": {"rbd"}, "object": {"img"}, "lock": {"l1"}}
+	with := func(extra url.Values) url.Values {
+		form := url.Values{}
+		for k, v := range obj {
+			form[k] = v
+		}
+		for k, v := range extra {
+			form[k] = v
+		}
+		return form
+	}
+
+	res := callApi(t, "lock/lock", with(url.Values{"type": {"bad"}}))
+	if res.Code != 101 {
+		t.Fatalf("lock with bad type %+v", res)
+	}
+	res = callApi(t, "lock/lock", with(url.Values{"cookie": {"c1"}, "description": {"mapped"}}))
+	if res.Code != 100 {
+		t.Fatalf("lock %+v", res)
+	}
+	res = callApi(t, "lock/lock", with(url.Values{"cookie": {"c1"}}))
+	if res.Code != 102 {
+		t.Fatalf("lock twice %+v", res)
+	}
+	res = callApi(t, "lock/list", obj)
+	locks, _ := res.Result.([]interface{})
+	if res.Code != 100 || len(locks) != 1 {
+		t.Fatalf("list %+v", res)
+	}
+	lockers := locks[0].(map[string]interface{})["lockers"].([]interface{})
+	client := lockers[0].(map[string]interface{})["client"].(string)
+
+	res = callApi(t, "lock/break", with(url.Values{"client": {client}, "cookie": {"c1"}}))
+	if res.Code != 101 {
+		t.Fatalf("break without reason %+v", res)
+	}
+	// 操作人取自鉴权用户，忽略表单中的operator
+	form := with(url.Values{"client": {client}, "cookie": {"c1"}, "reason": {"stale"}, "operator": {"forged"}})
+	r := httptest.NewRequest("POST", "/api/lock/break", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res = decodeApi(t, serveApi(middleware.WithUser(r, "admin")))
+	if res.Code != 100 {
+		t.Fatalf("break %+v", res)
+	}
+	res = callApi(t, "lock/break", with(url.Values{"client": {client}, "cookie": {"c1"}, "reason": {"again"}}))
+	if res.Code != 102 {
+		t.Fatalf("break a missing locker %+v", res)
+	}
+	res = callApi(t, "lock/audit", url.Values{"object": {"img"}})
+	audits, _ := res.Result.([]interface{})
+	if res.Code != 100 || len(audits) != 2 {
+		t.Fatalf("audit %+v", res)
+	}
+	latest := audits[0].(map[string]interface{})
+	if latest["reason"] != "again" || latest["error"] == "" || latest["operator"] != latest["ip"] {
+		t.Fatalf("latest audit %+v", latest)
+	}
+	if audits[1].(map[string]interface{})["operator"] != "admin" {
+		t.Fatalf("audit %+v", audits[1])
+	}
+	// 记录保存在集群中
+	if saved, err := ceph.NewCommander(rados).LockAudits(); err != nil || len(saved) != 2 {
+		t.Fatalf("saved audits %v %v", saved, err)
+	}
+}
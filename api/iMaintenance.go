@@ -0,0 +1,115 @@
+package api
+
+import (
+	"ceph-panel-go/ceph"
+	"ceph-panel-go/config"
+	"ceph-panel-go/utils"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 维护窗口，开始时设置一组标志，结束或到期后清除
+type IMaintenance struct {
+	ICeph
+}
+
+func NewIMaintenance(config config.IConfig, w http.ResponseWriter, r *http.Request) *IMaintenance {
+	maintenance := &IMaintenance{
+		ICeph: *NewICeph(config, w, r),
+	}
+	maintenance.Module = "maintenance"
+	return maintenance
+}
+
+// 维护窗口及是否已到期，remaining为剩余秒数
+func maintenanceResult(m *ceph.Maintenance) map[string]interface{} {
+	if m == nil {
+		return map[string]interface{}{"active": false}
+	}
+	now := time.Now()
+	remaining := int64(0)
+	if !m.Overdue(now) {
+		remaining = int64(m.Expire.Sub(now) / time.Second)
+	}
+	return map[string]interface{}{
+		"active":    true,
+		"window":    m,
+		"overdue":   m.Overdue(now),
+		"remaining": remaining,
+	}
+}
+
+// duration为秒数，为0时使用默认时长
+func (this *IMaintenance) duration() (time.Duration, bool) {
+	seconds := this.PostInt64("duration")
+	duration := time.Duration(seconds) * time.Second
+	if seconds < 0 || duration > ceph.MAINTENANCE_MAX_DURATION {
+		this.ResponseWithHeader(101, "", "duration不能超过"+strconv.Itoa(int(ceph.MAINTENANCE_MAX_DURATION/time.Second))+"秒")
+		return 0, false
+	}
+	return duration, true
+}
+
+func (this *IMaintenance) Status() {
+	if !this.connected() {
+		return
+	}
+	m, err := ceph.NewCommander(this.Rados).Maintenance()
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, maintenanceResult(m), "维护窗口")
+}
+
+// flags为空时使用默认的noout,norebalance，who不为空时设置在osd或crush节点上
+// user为空时记录客户端地址
+func (this *IMaintenance) Start() {
+	duration, ok := this.duration()
+	if !ok || !this.connected() {
+		return
+	}
+	m := ceph.Maintenance{
+		Reason:   this.PostString("reason"),
+		User:     this.PostString("user"),
+		Flags:    splitList(this.PostString("flags")),
+		Targets:  splitList(this.PostString("who")),
+		OnExpire: this.PostString("on_expire"),
+	}
+	if m.User == "" {
+		m.User = utils.GetIPAdress(this.R)
+	}
+	window, err := ceph.NewCommander(this.Rados).MaintenanceStart(m, duration)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, maintenanceResult(window), "维护开始")
+}
+
+// 结束维护并清除设置的标志，开始前已设置的标志保留
+func (this *IMaintenance) End() {
+	if !this.connected() {
+		return
+	}
+	window, err := ceph.NewCommander(this.Rados).MaintenanceEnd()
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, window, "维护结束")
+}
+
+func (this *IMaintenance) Extend() {
+	duration, ok := this.duration()
+	if !ok || !this.connected() {
+		return
+	}
+	window, err := ceph.NewCommander(this.Rados).MaintenanceExtend(duration)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, maintenanceResult(window), "延长成功")
+}
@@ -0,0 +1,49 @@
+package api_test
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestIMaintenance(t *testing.T) {
+	newFakeCluster(t)
+
+	res := callApi(t, "maintenance/status", url.Values{})
+	if status, _ := res.Result.(map[string]interface{}); res.Code != 100 || status["active"] != false {
+		t.Fatalf("status %+v", res)
+	}
+	if res := callApi(t, "maintenance/start", url.Values{"duration": {"99999999"}}); res.Code != 101 {
+		t.Fatalf("start too long %+v", res)
+	}
+	res = callApi(t, "maintenance/start", url.Values{"user": {"admin"}, "reason": {"upgrade"}, "duration": {"3600"}, "flags": {"noout,nobackfill"}})
+	status, _ := res.Result.(map[string]interface{})
+	if res.Code != 100 || status["active"] != true || status["overdue"] != false || status["remaining"].(float64) > 3600 {
+		t.Fatalf("start %+v", res)
+	}
+	if window := status["window"].(map[string]interface{}); window["user"] != "admin" || window["on_expire"] != "remind" {
+		t.Fatalf("window %+v", window)
+	}
+	if res := callApi(t, "maintenance/start", url.Values{"user": {"other"}}); res.Code != 102 {
+		t.Fatalf("start twice %+v", res)
+	}
+	res = callApi(t, "flag/list", url.Values{})
+	flags := res.Result.(map[string]interface{})["flags"].(map[string]interface{})
+	if len(flags["cluster"].([]interface{})) != 2 {
+		t.Fatalf("flags during maintenance %+v", flags)
+	}
+	res = callApi(t, "maintenance/extend", url.Values{"duration": {"1800"}})
+	if status, _ := res.Result.(map[string]interface{}); res.Code != 100 || status["remaining"].(float64) <= 3600 {
+		t.Fatalf("extend %+v", res)
+	}
+	if res := callApi(t, "maintenance/end", url.Values{}); res.Code != 100 {
+		t.Fatalf("end %+v", res)
+	}
+	res = callApi(t, "flag/list", url.Values{})
+	flags = res.Result.(map[string]interface{})["flags"].(map[string]interface{})
+	if len(flags["cluster"].([]interface{})) != 0 {
+		t.Fatalf("flags after maintenance %+v", flags)
+	}
+	if res := callApi(t, "maintenance/end", url.Values{}); res.Code != 102 {
+		t.Fatalf("end twice %+v", res)
+	}
+}
@@ -0,0 +1,728 @@
+package api
+
+import (
+	"ceph-panel-go/ceph"
+	"ceph-panel-go/config"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	OBJECT_READ_MAX    = 4 << 20          // 单次读取上限
+	OBJECT_UPLOAD_KEEP = 10 * time.Minute // 已结束的上传进度保留时间
+)
+
+// 属性值的显示编码
+const (
+	ENCODING_UTF8   = "utf-8"
+	ENCODING_HEX    = "hex"
+	ENCODING_BASE64 = "base64"
+)
+
+// 按编码显示的值，utf-8编码的值不是合法的utf-8时以hex显示
+type EncodedValue struct {
+	Value    string `json:"value"`
+	Encoding string `json:"encoding"`
+}
+
+type EncodedXattr struct {
+	Name string `json:"name"`
+	EncodedValue
+}
+
+// omap的key与value使用相同的编码，utf-8编码的key不是合法的utf-8时以hex显示
+type EncodedOmap struct {
+	Key         string `json:"key"`
+	KeyEncoding string `json:"key_encoding"`
+	EncodedValue
+}
+
+func checkEncoding(encoding string) (string, error) {
+	switch encoding {
+	case "", "utf8", ENCODING_UTF8:
+		return ENCODING_UTF8, nil
+	case ENCODING_HEX, ENCODING_BASE64:
+		return encoding, nil
+	}
+	return "", errors.New("unknown encoding " + encoding + ", use utf-8, hex or base64")
+}
+
+func encodeValue(data []byte, encoding string) EncodedValue {
+	switch encoding {
+	case ENCODING_BASE64:
+		return EncodedValue{Value: base64.StdEncoding.EncodeToString(data), Encoding: ENCODING_BASE64}
+	case ENCODING_UTF8:
+		if utf8.Valid(data) {
+			return EncodedValue{Value: string(data), Encoding: ENCODING_UTF8}
+		}
+	}
+	return EncodedValue{Value: hex.EncodeToString(data), Encoding: ENCODING_HEX}
+}
+
+func decodeValue(value string, encoding string) ([]byte, error) {
+	switch encoding {
+	case ENCODING_HEX:
+		return hex.DecodeString(value)
+	case ENCODING_BASE64:
+		return base64.StdEncoding.DecodeString(value)
+	}
+	return []byte(value), nil
+}
+
+// 按编码解析多个key
+func decodeKeys(keys []string, encoding string) ([]string, error) {
+	decoded := []string{}
+	for _, key := range keys {
+		value, err := decodeValue(key, encoding)
+		if err != nil {
+			return nil, errors.New("key不是合法的" + encoding + "编码")
+		}
+		decoded = append(decoded, string(value))
+	}
+	return decoded, nil
+}
+
+// 上传进度，以客户端提供的upload_id查询
+type UploadProgress struct {
+	Object  string    `json:"object"`
+	Total   int64     `json:"total"` // 请求的Content-Length，未知时为-1
+	Written uint64    `json:"written"`
+	Done    bool      `json:"done"`
+	Error   string    `json:"error"`
+	Updated time.Time `json:"updated"`
+}
+
+var (
+	uploads     = map[string]*UploadProgress{}
+	uploadsLock sync.Mutex
+)
+
+func setUploadProgress(id string, update func(p *UploadProgress)) {
+	if id == "" {
+		return
+	}
+	uploadsLock.Lock()
+	defer uploadsLock.Unlock()
+	p, ok := uploads[id]
+	if !ok {
+		p = &UploadProgress{}
+		uploads[id] = p
+	}
+	update(p)
+	p.Updated = time.Now()
+	// 清理过期的进度
+	for k, v := range uploads {
+		if v.Done && time.Since(v.Updated) > OBJECT_UPLOAD_KEEP {
+			delete(uploads, k)
+		}
+	}
+}
+
+// 解析单个Range，不支持多段范围，此时返回整个对象
+func parseRange(header string, size uint64) (start uint64, length uint64, partial bool, err error) {
+	if header == "" || !strings.HasPrefix(header, "bytes=") || strings.Contains(header, ",") {
+		return 0, size, false, nil
+	}
+	spec := strings.TrimSpace(strings.TrimPrefix(header, "bytes="))
+	i := strings.Index(spec, "-")
+	if i < 0 {
+		return 0, 0, false, errors.New("invalid range " + header)
+	}
+	first, last := spec[:i], spec[i+1:]
+	// bytes=-n 表示最后n字节
+	if first == "" {
+		n, err := strconv.ParseUint(last, 10, 64)
+		if err != nil || n == 0 || size == 0 {
+			return 0, 0, false, errors.New("invalid range " + header)
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true, nil
+	}
+	start, err = strconv.ParseUint(first, 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, false, errors.New("invalid range " + header)
+	}
+	end := size - 1
+	if last != "" {
+		e, err := strconv.ParseUint(last, 10, 64)
+		if err != nil || e < start {
+			return 0, 0, false, errors.New("invalid range " + header)
+		}
+		if e < end {
+			end = e
+		}
+	}
+	return start, end - start + 1, true, nil
+}
+
+// 存储池中的对象
+type IObject struct {
+	ICeph
+}
+
+func NewIObject(config config.IConfig, w http.ResponseWriter, r *http.Request) *IObject {
+	object := &IObject{
+		ICeph: *NewICeph(config, w, r),
+	}
+	object.Module = "object"
+	return object
+}
+
+// 打开存储池并切换到对象所在的命名空间
+func (this *IObject) openNamespace(pool string, nspace string) (ceph.LibRados, bool) {
+	rados, ok := this.openPool(pool)
+	if !ok {
+		return nil, false
+	}
+	rados.Rados_ioctx_set_namespace(nspace)
+	return rados, true
+}
+
+// 分页列出对象，all=1时列出所有命名空间
+func (this *IObject) List() {
+	pool := this.GetString("pool")
+	if pool == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	nspace := this.GetString("namespace")
+	if this.GetInt("all") == 1 {
+		nspace = ceph.ALL_NAMESPACES
+	}
+	rados, ok := this.openNamespace(pool, nspace)
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	page, err := rados.Rados_nobjects_list(this.GetString("cursor"), this.GetInt("max"))
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, page, "对象列表")
+}
+
+func (this *IObject) Stat() {
+	pool := this.GetString("pool")
+	object := this.GetString("object")
+	if pool == "" || object == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rados, ok := this.openNamespace(pool, this.GetString("namespace"))
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	stat, err := rados.Rados_stat(object)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, stat, "对象信息")
+}
+
+// 读取对象的一段数据，length为0时读取到上限
+func (this *IObject) Read() {
+	pool := this.GetString("pool")
+	object := this.GetString("object")
+	if pool == "" || object == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	offset := this.GetInt64("offset")
+	length := this.GetInt("length")
+	if offset < 0 || length < 0 {
+		this.ResponseWithHeader(101, "", "offset或length不能为负数")
+		return
+	}
+	if length == 0 || length > OBJECT_READ_MAX {
+		length = OBJECT_READ_MAX
+	}
+	rados, ok := this.openNamespace(pool, this.GetString("namespace"))
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	out, err := rados.Rados_Read(object, uint(length), uint64(offset))
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	result := map[string]interface{}{
+		"object": object,
+		"offset": offset,
+		"data":   out.Bytes(),
+	}
+	this.ResponseWithHeader(100, result, "对象数据")
+}
+
+// 覆盖写入整个对象
+func (this *IObject) Write() {
+	pool := this.PostString("pool")
+	object := this.PostString("object")
+	if pool == "" || object == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rados, ok := this.openNamespace(pool, this.PostString("namespace"))
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	if err := rados.Rados_write_full(object, []byte(this.PostString("data"))); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, object, "写入成功")
+}
+
+func (this *IObject) Append() {
+	pool := this.PostString("pool")
+	object := this.PostString("object")
+	data := this.PostString("data")
+	if pool == "" || object == "" || data == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rados, ok := this.openNamespace(pool, this.PostString("namespace"))
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	if err := rados.Rados_append(object, []byte(data)); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, object, "追加成功")
+}
+
+func (this *IObject) Remove() {
+	pool := this.PostString("pool")
+	object := this.PostString("object")
+	if pool == "" || object == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rados, ok := this.openNamespace(pool, this.PostString("namespace"))
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	if err := rados.Rados_remove(object); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, object, "删除成功")
+}
+
+// 流式下载对象，支持Range请求
+func (this *IObject) Download() {
+	this.streaming()
+	pool := this.GetString("pool")
+	object := this.GetString("object")
+	if pool == "" || object == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rados, ok := this.openNamespace(pool, this.GetString("namespace"))
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	stat, err := rados.Rados_stat(object)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	start, length, partial, err := parseRange(this.R.Header.Get("Range"), stat.Size)
+	header := this.W.Header()
+	header.Set("Accept-Ranges", "bytes")
+	if err != nil {
+		header.Set("Content-Range", "bytes */"+strconv.FormatUint(stat.Size, 10))
+		this.W.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	header.Set("Content-Type", "application/octet-stream")
+	header.Set("Content-Disposition", "attachment; filename=\""+strings.ReplaceAll(object, "\"", "")+"\"")
+	header.Set("Content-Length", strconv.FormatUint(length, 10))
+	header.Set("Last-Modified", stat.Mtime.UTC().Format(http.TimeFormat))
+	if partial {
+		header.Set("Content-Range", "bytes "+strconv.FormatUint(start, 10)+"-"+strconv.FormatUint(start+length-1, 10)+"/"+strconv.FormatUint(stat.Size, 10))
+		this.W.WriteHeader(http.StatusPartialContent)
+	} else {
+		this.W.WriteHeader(http.StatusOK)
+	}
+	if this.R.Method == http.MethodHead {
+		return
+	}
+	// 响应头已发送，出错时只能中断连接
+	if _, err := io.CopyBuffer(this.W, ceph.NewObjectReader(rados, object, start, length), make([]byte, ceph.OBJECT_STREAM_CHUNK)); err != nil {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// 以请求体流式上传对象，按固定大小的块写入，sha256参数存在时校验
+func (this *IObject) Upload() {
+	this.streaming()
+	pool := this.GetString("pool")
+	object := this.GetString("object")
+	if pool == "" || object == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	expected := strings.ToLower(this.GetString("sha256"))
+	id := this.GetString("upload_id")
+	rados, ok := this.openNamespace(pool, this.GetString("namespace"))
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	fail := func(err error) {
+		setUploadProgress(id, func(p *UploadProgress) {
+			p.Done = true
+			p.Error = err.Error()
+		})
+		this.ResponseWithHeader(102, "", err.Error())
+	}
+	setUploadProgress(id, func(p *UploadProgress) {
+		*p = UploadProgress{Object: object, Total: this.R.ContentLength}
+	})
+	// 先写入临时对象，校验通过后再替换目标对象，上传中断时不影响原有数据
+	tmp, err := uploadTempName(object)
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer rados.Rados_remove(tmp)
+	writer := ceph.NewObjectWriter(rados, tmp, ceph.OBJECT_STREAM_CHUNK)
+	writer.Progress = func(written uint64) {
+		setUploadProgress(id, func(p *UploadProgress) {
+			p.Written = written
+		})
+	}
+	if _, err := io.Copy(writer, this.R.Body); err != nil {
+		fail(err)
+		return
+	}
+	if err := writer.Close(); err != nil {
+		fail(err)
+		return
+	}
+	// 读回对象校验写入的数据
+	stored, err := ceph.ObjectChecksum(rados, tmp, writer.Written())
+	if err != nil {
+		fail(err)
+		return
+	}
+	if stored != writer.Sum() {
+		fail(errors.New("checksum of object[" + object + "] mismatch, stored " + stored + " uploaded " + writer.Sum()))
+		return
+	}
+	if expected != "" && expected != stored {
+		fail(errors.New("checksum of object[" + object + "] mismatch, stored " + stored + " expected " + expected))
+		return
+	}
+	if err := ceph.ObjectCopy(rados, tmp, object, writer.Written()); err != nil {
+		fail(err)
+		return
+	}
+	setUploadProgress(id, func(p *UploadProgress) {
+		p.Done = true
+	})
+	result := map[string]interface{}{
+		"object": object,
+		"size":   writer.Written(),
+		"sha256": stored,
+	}
+	this.ResponseWithHeader(100, result, "上传成功")
+}
+
+// 上传使用的临时对象名或文件名
+func uploadTempName(name string) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return name + ".upload." + hex.EncodeToString(b), nil
+}
+
+func (this *IObject) Progress() {
+	id := this.GetString("upload_id")
+	if id == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	uploadsLock.Lock()
+	p, ok := uploads[id]
+	var progress UploadProgress
+	if ok {
+		progress = *p
+	}
+	uploadsLock.Unlock()
+	if !ok {
+		this.ResponseWithHeader(102, "", "上传任务不存在")
+		return
+	}
+	this.ResponseWithHeader(100, progress, "上传进度")
+}
+
+// 打开对象所在存储池并检查encoding参数
+func (this *IObject) openObject(pool string, nspace string, object string, encoding string) (ceph.LibRados, string, bool) {
+	if pool == "" || object == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return nil, "", false
+	}
+	encoding, err := checkEncoding(encoding)
+	if err != nil {
+		this.ResponseWithHeader(101, "", err.Error())
+		return nil, "", false
+	}
+	rados, ok := this.openNamespace(pool, nspace)
+	if !ok {
+		return nil, "", false
+	}
+	return rados, encoding, true
+}
+
+// 列出对象的所有扩展属性
+func (this *IObject) Xattrs() {
+	rados, encoding, ok := this.openObject(this.GetString("pool"), this.GetString("namespace"), this.GetString("object"), this.GetString("encoding"))
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	attrs, err := rados.Rados_getxattrs(this.GetString("object"))
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	result := []EncodedXattr{}
+	for _, attr := range attrs {
+		result = append(result, EncodedXattr{Name: attr.Name, EncodedValue: encodeValue(attr.Value, encoding)})
+	}
+	this.ResponseWithHeader(100, result, "扩展属性")
+}
+
+func (this *IObject) GetXattr() {
+	name := this.GetString("name")
+	if name == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rados, encoding, ok := this.openObject(this.GetString("pool"), this.GetString("namespace"), this.GetString("object"), this.GetString("encoding"))
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	value, err := rados.Rados_getxattr(this.GetString("object"), name)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, EncodedXattr{Name: name, EncodedValue: encodeValue(value, encoding)}, "扩展属性")
+}
+
+// value按encoding解码后写入
+func (this *IObject) SetXattr() {
+	name := this.PostString("name")
+	if name == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rados, encoding, ok := this.openObject(this.PostString("pool"), this.PostString("namespace"), this.PostString("object"), this.PostString("encoding"))
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	value, err := decodeValue(this.PostString("value"), encoding)
+	if err != nil {
+		this.ResponseWithHeader(101, "", "value不是合法的"+encoding+"编码")
+		return
+	}
+	if err := rados.Rados_setxattr(this.PostString("object"), name, value); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, name, "设置成功")
+}
+
+func (this *IObject) RmXattr() {
+	name := this.PostString("name")
+	if name == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rados, _, ok := this.openObject(this.PostString("pool"), this.PostString("namespace"), this.PostString("object"), "")
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	if err := rados.Rados_rmxattr(this.PostString("object"), name); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, name, "删除成功")
+}
+
+// 分页读取omap，start_after为上一页最后一个key，prefix过滤key前缀
+func (this *IObject) Omap() {
+	rados, encoding, ok := this.openObject(this.GetString("pool"), this.GetString("namespace"), this.GetString("object"), this.GetString("encoding"))
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	// start_after和prefix与key使用相同的编码
+	params, err := decodeKeys([]string{this.GetString("start_after"), this.GetString("prefix")}, encoding)
+	if err != nil {
+		this.ResponseWithHeader(101, "", err.Error())
+		return
+	}
+	page, err := rados.Rados_omap_get_vals(this.GetString("object"), params[0], params[1], this.GetInt("max"))
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	vals := []EncodedOmap{}
+	for _, val := range page.Vals {
+		key := encodeValue([]byte(val.Key), encoding)
+		vals = append(vals, EncodedOmap{Key: key.Value, KeyEncoding: key.Encoding, EncodedValue: encodeValue(val.Value, encoding)})
+	}
+	result := map[string]interface{}{
+		"vals": vals,
+		"more": page.More,
+	}
+	this.ResponseWithHeader(100, result, "omap")
+}
+
+// key和value可以重复多次，按顺序一一对应，均按encoding解析
+func (this *IObject) SetOmap() {
+	rados, encoding, ok := this.openObject(this.PostString("pool"), this.PostString("namespace"), this.PostString("object"), this.PostString("encoding"))
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	keys := this.R.Form["key"]
+	values := this.R.Form["value"]
+	if len(keys) == 0 || len(keys) != len(values) {
+		this.ResponseWithHeader(101, "", "key与value数量不一致")
+		return
+	}
+	decoded, err := decodeKeys(keys, encoding)
+	if err != nil {
+		this.ResponseWithHeader(101, "", err.Error())
+		return
+	}
+	vals := []ceph.OmapEntry{}
+	for i, key := range decoded {
+		value, err := decodeValue(values[i], encoding)
+		if err != nil {
+			this.ResponseWithHeader(101, "", "value不是合法的"+encoding+"编码")
+			return
+		}
+		vals = append(vals, ceph.OmapEntry{Key: key, Value: value})
+	}
+	if err := rados.Rados_omap_set(this.PostString("object"), vals); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, keys, "设置成功")
+}
+
+// key可以重复多次，按encoding解析
+func (this *IObject) RmOmap() {
+	rados, encoding, ok := this.openObject(this.PostString("pool"), this.PostString("namespace"), this.PostString("object"), this.PostString("encoding"))
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	keys := this.R.Form["key"]
+	if len(keys) == 0 {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	decoded, err := decodeKeys(keys, encoding)
+	if err != nil {
+		this.ResponseWithHeader(101, "", err.Error())
+		return
+	}
+	if err := rados.Rados_omap_rm_keys(this.PostString("object"), decoded); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, keys, "删除成功")
+}
+
+func (this *IObject) ClearOmap() {
+	rados, _, ok := this.openObject(this.PostString("pool"), this.PostString("namespace"), this.PostString("object"), "")
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	if err := rados.Rados_omap_clear(this.PostString("object")); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, this.PostString("object"), "清空成功")
+}
+
+func (this *IObject) OmapHeader() {
+	rados, encoding, ok := this.openObject(this.GetString("pool"), this.GetString("namespace"), this.GetString("object"), this.GetString("encoding"))
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	header, err := rados.Rados_omap_get_header(this.GetString("object"))
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, encodeValue(header, encoding), "omap header")
+}
+
+func (this *IObject) SetOmapHeader() {
+	rados, encoding, ok := this.openObject(this.PostString("pool"), this.PostString("namespace"), this.PostString("object"), this.PostString("encoding"))
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	header, err := decodeValue(this.PostString("value"), encoding)
+	if err != nil {
+		this.ResponseWithHeader(101, "", "value不是合法的"+encoding+"编码")
+		return
+	}
+	if err := rados.Rados_omap_set_header(this.PostString("object"), header); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, this.PostString("object"), "设置成功")
+}
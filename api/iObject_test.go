@@ -0,0 +1,198 @@
+package api_test
+
+import (
+	"ceph-panel-go/api"
+	"ceph-panel-go/template"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNewIObject(t *testing.T) {
+	newFakeCluster(t)
+
+	res := callApi(t, "object/write", url.Values{"pool": {"data"}, "namespace": {"ns"}, "object": {"obj"}, "data": {"hello"}})
+	if res.Code != 100 {
+		t.Fatalf("write %+v", res)
+	}
+	res = callApi(t, "object/append", url.Values{"pool": {"data"}, "namespace": {"ns"}, "object": {"obj"}, "data": {" world"}})
+	if res.Code != 100 {
+		t.Fatalf("append %+v", res)
+	}
+	res = callApi(t, "object/stat", url.Values{"pool": {"data"}, "namespace": {"ns"}, "object": {"obj"}})
+	if res.Code != 100 || res.Result.(map[string]interface{})["size"].(float64) != 11 {
+		t.Fatalf("stat %+v", res)
+	}
+	res = callApi(t, "object/read", url.Values{"pool": {"data"}, "namespace": {"ns"}, "object": {"obj"}, "offset": {"6"}})
+	if res.Code != 100 || res.Result.(map[string]interface{})["data"].(string) != "d29ybGQ=" {
+		t.Fatalf("read %+v", res)
+	}
+
+	res = callApi(t, "object/list", url.Values{"pool": {"data"}})
+	if res.Code != 100 || len(res.Result.(map[string]interface{})["objects"].([]interface{})) != 0 {
+		t.Fatalf("list default namespace %+v", res)
+	}
+	res = callApi(t, "object/list", url.Values{"pool": {"data"}, "all": {"1"}})
+	if res.Code != 100 || len(res.Result.(map[string]interface{})["objects"].([]interface{})) != 1 {
+		t.Fatalf("list all namespaces %+v", res)
+	}
+
+	res = callApi(t, "object/remove", url.Values{"pool": {"data"}, "object": {"obj"}})
+	if res.Code != 102 {
+		t.Fatalf("remove from default namespace %+v", res)
+	}
+	res = callApi(t, "object/remove", url.Values{"pool": {"data"}, "namespace": {"ns"}, "object": {"obj"}})
+	if res.Code != 100 {
+		t.Fatalf("remove %+v", res)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	cases := []struct {
+		header  string
+		start   uint64
+		length  uint64
+		partial bool
+	}{
+		{"", 0, 100, false},
+		{"bytes=0-9", 0, 10, true},
+		{"bytes=90-", 90, 10, true},
+		{"bytes=-5", 95, 5, true},
+		{"bytes=50-500", 50, 50, true},
+		{"bytes=0-1,5-6", 0, 100, false},
+	}
+	for _, c := range cases {
+		start, length, partial, err := api.ParseRange(c.header, 100)
+		if err != nil || start != c.start || length != c.length || partial != c.partial {
+			t.Fatalf("%s: %d %d %v %v", c.header, start, length, partial, err)
+		}
+	}
+	for _, header := range []string{"bytes=100-", "bytes=9-1", "bytes=-0", "bytes=x"} {
+		if _, _, _, err := api.ParseRange(header, 100); err == nil {
+			t.Fatalf("expected %s to be unsatisfiable", header)
+		}
+	}
+}
+
+func TestIObject_stream(t *testing.T) {
+	newFakeCluster(t)
+	data := strings.Repeat("ceph", 1000)
+	sum := sha256.Sum256([]byte(data))
+
+	r := httptest.NewRequest("PUT", "/api/object/upload?pool=data&object=big&upload_id=u1&sha256="+hex.EncodeToString(sum[:]), strings.NewReader(data))
+	w := serveApi(r)
+	res := template.ResponseData{}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.Code != 100 {
+		t.Fatalf("upload %v %s", err, w.Body.String())
+	}
+	res = callApi(t, "object/progress", url.Values{"upload_id": {"u1"}})
+	progress := res.Result.(map[string]interface{})
+	if res.Code != 100 || !progress["done"].(bool) || progress["written"].(float64) != 4000 {
+		t.Fatalf("progress %+v", res)
+	}
+
+	r = httptest.NewRequest("GET", "/api/object/download?pool=data&object=big", nil)
+	r.Header.Set("Range", "bytes=4-7")
+	w = serveApi(r)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "ceph" || w.Header().Get("Content-Range") != "bytes 4-7/4000" {
+		t.Fatalf("download %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+
+	// 校验失败时原有对象不变，临时对象被删除
+	r = httptest.NewRequest("PUT", "/api/object/upload?pool=data&object=big&sha256=00", strings.NewReader("short"))
+	w = serveApi(r)
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.Code != 102 {
+		t.Fatalf("upload with wrong checksum %v %s", err, w.Body.String())
+	}
+	res = callApi(t, "object/list", url.Values{"pool": {"data"}})
+	objects, _ := res.Result.(map[string]interface{})["objects"].([]interface{})
+	if res.Code != 100 || len(objects) != 1 {
+		t.Fatalf("list after failed upload %+v", res)
+	}
+	res = callApi(t, "object/stat", url.Values{"pool": {"data"}, "object": {"big"}})
+	if res.Code != 100 || res.Result.(map[string]interface{})["size"].(float64) != 4000 {
+		t.Fatalf("stat after failed upload %+v", res)
+	}
+
+	r = httptest.NewRequest("PUT", "/api/object/upload?pool=data&object=big", strings.NewReader("short"))
+	if res := decodeApi(t, serveApi(r)); res.Code != 100 {
+		t.Fatalf("overwrite %+v", res)
+	}
+	res = callApi(t, "object/read", url.Values{"pool": {"data"}, "object": {"big"}})
+	if res.Code != 100 || res.Result.(map[string]interface{})["data"] != "c2hvcnQ=" {
+		t.Fatalf("read after overwrite %+v", res)
+	}
+}
+
+func TestIObject_meta(t *testing.T) {
+	newFakeCluster(t)
+
+	res := callApi(t, "object/set-xattr", url.Values{"pool": {"data"}, "object": {"obj"}, "name": {"user.bin"}, "value": {"00ff"}, "encoding": {"hex"}})
+	if res.Code != 100 {
+		t.Fatalf("set-xattr %+v", res)
+	}
+	res = callApi(t, "object/set-xattr", url.Values{"pool": {"data"}, "object": {"obj"}, "name": {"user.bin"}, "value": {"zz"}, "encoding": {"hex"}})
+	if res.Code != 101 {
+		t.Fatalf("set-xattr with bad hex %+v", res)
+	}
+	// 不是合法utf-8的值以hex显示
+	res = callApi(t, "object/xattrs", url.Values{"pool": {"data"}, "object": {"obj"}})
+	attr := res.Result.([]interface{})[0].(map[string]interface{})
+	if res.Code != 100 || attr["value"] != "00ff" || attr["encoding"] != "hex" {
+		t.Fatalf("xattrs %+v", res)
+	}
+	res = callApi(t, "object/xattrs", url.Values{"pool": {"data"}, "object": {"obj"}, "encoding": {"base64"}})
+	if res.Result.([]interface{})[0].(map[string]interface{})["value"] != "AP8=" {
+		t.Fatalf("xattrs base64 %+v", res)
+	}
+
+	res = callApi(t, "object/set-omap", url.Values{"pool": {"data"}, "object": {"obj"}, "key": {"a", "b"}, "value": {"1", "2"}})
+	if res.Code != 100 {
+		t.Fatalf("set-omap %+v", res)
+	}
+	res = callApi(t, "object/set-omap", url.Values{"pool": {"data"}, "object": {"obj"}, "key": {"a", "b"}, "value": {"1"}})
+	if res.Code != 101 {
+		t.Fatalf("set-omap with missing value %+v", res)
+	}
+	res = callApi(t, "object/rm-omap", url.Values{"pool": {"data"}, "object": {"obj"}, "key": {"a"}})
+	if res.Code != 100 {
+		t.Fatalf("rm-omap %+v", res)
+	}
+	res = callApi(t, "object/omap", url.Values{"pool": {"data"}, "object": {"obj"}})
+	vals := res.Result.(map[string]interface{})["vals"].([]interface{})
+	if res.Code != 100 || len(vals) != 1 || vals[0].(map[string]interface{})["value"] != "2" {
+		t.Fatalf("omap %+v", res)
+	}
+
+	// 二进制key按encoding解析和显示
+	hexObj := url.Values{"pool": {"data"}, "object": {"obj"}, "encoding": {"hex"}}
+	if res := callApi(t, "object/set-omap", with(hexObj, url.Values{"key": {"00ff", "zz"}, "value": {"01", "02"}})); res.Code != 101 {
+		t.Fatalf("set-omap with bad hex key %+v", res)
+	}
+	if res := callApi(t, "object/set-omap", with(hexObj, url.Values{"key": {"00ff", "00fe"}, "value": {"01", "02"}})); res.Code != 100 {
+		t.Fatalf("set-omap with hex key %+v", res)
+	}
+	res = callApi(t, "object/omap", url.Values{"pool": {"data"}, "object": {"obj"}})
+	vals = res.Result.(map[string]interface{})["vals"].([]interface{})
+	if key := vals[0].(map[string]interface{}); res.Code != 100 || len(vals) != 3 || key["key"] != "00fe" || key["key_encoding"] != "hex" {
+		t.Fatalf("omap with binary keys %+v", res)
+	}
+	res = callApi(t, "object/omap", with(hexObj, url.Values{"start_after": {"00fe"}, "prefix": {"00"}}))
+	vals = res.Result.(map[string]interface{})["vals"].([]interface{})
+	if res.Code != 100 || len(vals) != 1 || vals[0].(map[string]interface{})["key"] != "00ff" {
+		t.Fatalf("omap after hex key %+v", res)
+	}
+	if res := callApi(t, "object/rm-omap", with(hexObj, url.Values{"key": {"00ff", "62"}})); res.Code != 100 {
+		t.Fatalf("rm-omap with hex key %+v", res)
+	}
+	res = callApi(t, "object/omap", with(hexObj, url.Values{}))
+	vals = res.Result.(map[string]interface{})["vals"].([]interface{})
+	if res.Code != 100 || len(vals) != 1 || vals[0].(map[string]interface{})["key"] != "00fe" {
+		t.Fatalf("omap after rm-omap %+v", res)
+	}
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"ceph-panel-go/ceph"
+	"ceph-panel-go/config"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// osd列表及状态操作
+type IOsd struct {
+	ICeph
+	commander *ceph.Commander
+}
+
+func NewIOsd(config config.IConfig, w http.ResponseWriter, r *http.Request) *IOsd {
+	osd := &IOsd{
+		ICeph: *NewICeph(config, w, r),
+	}
+	osd.Module = "osd"
+	return osd
+}
+
+func (this *IOsd) command() bool {
+	if !this.connected() {
+		return false
+	}
+	this.commander = ceph.NewCommander(this.Rados)
+	return true
+}
+
+// osd id，支持0和osd.0两种格式
+func parseOsdId(id string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(id), "osd."))
+	if err != nil || n < 0 {
+		return 0, errors.New("invalid osd id " + id)
+	}
+	return n, nil
+}
+
+// 逗号分隔的osd id列表
+func (this *IOsd) ids() ([]int, bool) {
+	value := this.PostString("ids")
+	if value == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return nil, false
+	}
+	ids := []int{}
+	for _, s := range strings.Split(value, ",") {
+		id, err := parseOsdId(s)
+		if err != nil {
+			this.ResponseWithHeader(101, "", err.Error())
+			return nil, false
+		}
+		ids = append(ids, id)
+	}
+	return ids, true
+}
+
+func (this *IOsd) id() (int, bool) {
+	value := this.PostString("id")
+	if value == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return 0, false
+	}
+	id, err := parseOsdId(value)
+	if err != nil {
+		this.ResponseWithHeader(101, "", err.Error())
+		return 0, false
+	}
+	return id, true
+}
+
+// 包括所在host、设备类型、权重、up/in状态、使用率及pg数
+func (this *IOsd) List() {
+	if !this.command() {
+		return
+	}
+	list, err := this.commander.OsdList()
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, list, "osd列表")
+}
+
+func (this *IOsd) Tree() {
+	if !this.command() {
+		return
+	}
+	tree, err := this.commander.OsdTree()
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, tree, "osd树")
+}
+
+func (this *IOsd) state(f func(ids []int) (string, error), message string) {
+	ids, ok := this.ids()
+	if !ok || !this.command() {
+		return
+	}
+	outs, err := f(ids)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, outs, message)
+}
+
+func (this *IOsd) Out() {
+	this.state(func(ids []int) (string, error) { return this.commander.OsdOut(ids) }, "已标记为out")
+}
+
+func (this *IOsd) In() {
+	this.state(func(ids []int) (string, error) { return this.commander.OsdIn(ids) }, "已标记为in")
+}
+
+func (this *IOsd) Down() {
+	this.state(func(ids []int) (string, error) { return this.commander.OsdDown(ids) }, "已标记为down")
+}
+
+// weight范围为0~1
+func (this *IOsd) Reweight() {
+	id, ok := this.id()
+	if !ok {
+		return
+	}
+	weight, err := strconv.ParseFloat(this.PostString("weight"), 64)
+	if err != nil || weight < 0 || weight > 1 {
+		this.ResponseWithHeader(101, "", "weight范围为0~1")
+		return
+	}
+	if !this.command() {
+		return
+	}
+	outs, err := this.commander.OsdReweight(id, weight)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, outs, "调整成功")
+}
+
+// 设置设备类型，会替换原有类型
+func (this *IOsd) SetClass() {
+	class := this.PostString("class")
+	if class == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	this.state(func(ids []int) (string, error) { return this.commander.OsdSetDeviceClass(class, ids) }, "设置成功")
+}
+
+// 需要提交confirm为osd名称，如osd.0
+func (this *IOsd) Lost() {
+	id, ok := this.id()
+	if !ok {
+		return
+	}
+	if this.PostString("confirm") != "osd."+strconv.Itoa(id) {
+		this.ResponseWithHeader(101, "", "请输入osd名称确认标记丢失")
+		return
+	}
+	if !this.command() {
+		return
+	}
+	outs, err := this.commander.OsdLost(id)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, outs, "已标记为lost")
+}
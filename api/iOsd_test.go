@@ -0,0 +1,72 @@
+package api_test
+
+import (
+	"ceph-panel-go/ceph"
+	"net/url"
+	"testing"
+)
+
+func osdStatus(t *testing.T, rados ceph.LibRados, id int) map[string]interface{} {
+	res := callApi(t, "osd/list", url.Values{})
+	list, _ := res.Result.([]interface{})
+	if res.Code != 100 || len(list) != 3 {
+		t.Fatalf("list %+v", res)
+	}
+	return list[id].(map[string]interface{})
+}
+
+func TestIOsd(t *testing.T) {
+	rados := newFakeCluster(t)
+
+	osd := osdStatus(t, rados, 0)
+	if osd["host"] != "node1" || osd["device_class"] != "hdd" || osd["up"] != true || osd["in"] != true || osd["pgs"].(float64) == 0 {
+		t.Fatalf("osd.0 %+v", osd)
+	}
+	if res := callApi(t, "osd/tree", url.Values{}); res.Code != 100 {
+		t.Fatalf("tree %+v", res)
+	}
+
+	if res := callApi(t, "osd/out", url.Values{}); res.Code != 101 {
+		t.Fatalf("out without ids %+v", res)
+	}
+	if res := callApi(t, "osd/out", url.Values{"ids": {"osd.1,x"}}); res.Code != 101 {
+		t.Fatalf("out invalid id %+v", res)
+	}
+	if res := callApi(t, "osd/out", url.Values{"ids": {"osd.1,2"}}); res.Code != 100 {
+		t.Fatalf("out %+v", res)
+	}
+	if osd := osdStatus(t, rados, 2); osd["in"] != false || osd["reweight"].(float64) != 0 {
+		t.Fatalf("osd.2 after out %+v", osd)
+	}
+	if res := callApi(t, "osd/in", url.Values{"ids": {"1,2"}}); res.Code != 100 {
+		t.Fatalf("in %+v", res)
+	}
+	if res := callApi(t, "osd/reweight", url.Values{"id": {"2"}, "weight": {"2"}}); res.Code != 101 {
+		t.Fatalf("reweight out of range %+v", res)
+	}
+	if res := callApi(t, "osd/reweight", url.Values{"id": {"2"}, "weight": {"0.8"}}); res.Code != 100 {
+		t.Fatalf("reweight %+v", res)
+	}
+	if osd := osdStatus(t, rados, 2); osd["reweight"].(float64) != 0.8 {
+		t.Fatalf("osd.2 after reweight %+v", osd)
+	}
+	if res := callApi(t, "osd/set-class", url.Values{"ids": {"0"}, "class": {"ssd"}}); res.Code != 100 {
+		t.Fatalf("set-class %+v", res)
+	}
+	if osd := osdStatus(t, rados, 0); osd["device_class"] != "ssd" {
+		t.Fatalf("osd.0 after set-class %+v", osd)
+	}
+
+	if res := callApi(t, "osd/down", url.Values{"ids": {"0"}}); res.Code != 100 {
+		t.Fatalf("down %+v", res)
+	}
+	if res := callApi(t, "osd/lost", url.Values{"id": {"0"}, "confirm": {"0"}}); res.Code != 101 {
+		t.Fatalf("lost without confirm %+v", res)
+	}
+	if res := callApi(t, "osd/lost", url.Values{"id": {"1"}, "confirm": {"osd.1"}}); res.Code != 102 {
+		t.Fatalf("lost up osd %+v", res)
+	}
+	if res := callApi(t, "osd/lost", url.Values{"id": {"osd.0"}, "confirm": {"osd.0"}}); res.Code != 100 {
+		t.Fatalf("lost %+v", res)
+	}
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"ceph-panel-go/ceph"
+	"ceph-panel-go/config"
+	"net/http"
+)
+
+// pg列表、查询及scrub/repair操作
+type IPg struct {
+	ICeph
+	commander *ceph.Commander
+}
+
+func NewIPg(config config.IConfig, w http.ResponseWriter, r *http.Request) *IPg {
+	pg := &IPg{
+		ICeph: *NewICeph(config, w, r),
+	}
+	pg.Module = "pg"
+	return pg
+}
+
+func (this *IPg) command() bool {
+	if !this.connected() {
+		return false
+	}
+	this.commander = ceph.NewCommander(this.Rados)
+	return true
+}
+
+// 按pool、osd、state(逗号分隔，如inconsistent)过滤，stuck为inactive、unclean、stale、undersized或degraded
+func (this *IPg) List() {
+	filter := ceph.PgFilter{
+		Pool:   this.GetString("pool"),
+		Osd:    -1,
+		States: splitList(this.GetString("state")),
+		Stuck:  this.GetString("stuck"),
+	}
+	if osd := this.GetString("osd"); osd != "" {
+		id, err := parseOsdId(osd)
+		if err != nil {
+			this.ResponseWithHeader(101, "", err.Error())
+			return
+		}
+		filter.Osd = id
+	}
+	if !this.command() {
+		return
+	}
+	list, err := this.commander.PgList(filter)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, list, "pg列表")
+}
+
+func (this *IPg) Query() {
+	pgid := this.GetString("pgid")
+	if pgid == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	if !this.command() {
+		return
+	}
+	result, err := this.commander.PgQuery(pgid)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, result, "pg详情")
+}
+
+// pgids为逗号分隔的pg id
+func (this *IPg) scrub(f func(pgids []string) ([]string, error), message string) {
+	pgids := splitList(this.PostString("pgids"))
+	if len(pgids) == 0 {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	if !this.command() {
+		return
+	}
+	outs, err := f(pgids)
+	if err != nil {
+		this.ResponseWithHeader(102, outs, err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, outs, message)
+}
+
+func (this *IPg) Scrub() {
+	this.scrub(func(pgids []string) ([]string, error) { return this.commander.PgScrub(pgids) }, "已开始scrub")
+}
+
+func (this *IPg) DeepScrub() {
+	this.scrub(func(pgids []string) ([]string, error) { return this.commander.PgDeepScrub(pgids) }, "已开始deep-scrub")
+}
+
+func (this *IPg) Repair() {
+	this.scrub(func(pgids []string) ([]string, error) { return this.commander.PgRepair(pgids) }, "已开始修复")
+}
+
+// 最近一次deep-scrub发现的不一致对象
+func (this *IPg) Inconsistent() {
+	pgid := this.GetString("pgid")
+	if pgid == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	if !this.command() {
+		return
+	}
+	objects, err := this.commander.PgInconsistentObjects(pgid)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, objects, "不一致对象")
+}
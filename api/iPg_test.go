@@ -0,0 +1,52 @@
+package api_test
+
+import (
+	"ceph-panel-go/ceph"
+	"net/url"
+	"testing"
+)
+
+func TestIPg(t *testing.T) {
+	newFakeCluster(t)
+
+	res := callApi(t, "pg/list", url.Values{"pool": {"rbd"}, "osd": {"osd.0"}})
+	if list, _ := res.Result.([]interface{}); res.Code != 100 || len(list) != ceph.POOL_DEFAULT_PG_NUM {
+		t.Fatalf("list %+v", res)
+	}
+	res = callApi(t, "pg/list", url.Values{"state": {"inconsistent"}})
+	if list, _ := res.Result.([]interface{}); res.Code != 100 || len(list) != 0 {
+		t.Fatalf("list inconsistent %+v", res)
+	}
+	if res := callApi(t, "pg/list", url.Values{"osd": {"osd.x"}}); res.Code != 101 {
+		t.Fatalf("list invalid osd %+v", res)
+	}
+	if res := callApi(t, "pg/list", url.Values{"stuck": {"bogus"}}); res.Code != 102 {
+		t.Fatalf("list invalid stuck %+v", res)
+	}
+
+	if res := callApi(t, "pg/query", url.Values{}); res.Code != 101 {
+		t.Fatalf("query without pgid %+v", res)
+	}
+	res = callApi(t, "pg/query", url.Values{"pgid": {"1.0"}})
+	if result, _ := res.Result.(map[string]interface{}); res.Code != 100 || result["state"] != "active+clean" {
+		t.Fatalf("query %+v", res)
+	}
+
+	if res := callApi(t, "pg/scrub", url.Values{}); res.Code != 101 {
+		t.Fatalf("scrub without pgids %+v", res)
+	}
+	for _, action := range []string{"scrub", "deep-scrub", "repair"} {
+		res = callApi(t, "pg/"+action, url.Values{"pgids": {"1.0,1.1"}})
+		if outs, _ := res.Result.([]interface{}); res.Code != 100 || len(outs) != 2 {
+			t.Fatalf("%s %+v", action, res)
+		}
+	}
+	if res := callApi(t, "pg/repair", url.Values{"pgids": {"9.0"}}); res.Code != 102 {
+		t.Fatalf("repair missing pg %+v", res)
+	}
+
+	res = callApi(t, "pg/inconsistent", url.Values{"pgid": {"1.0"}})
+	if objects, _ := res.Result.([]interface{}); res.Code != 100 || len(objects) != 0 {
+		t.Fatalf("inconsistent %+v", res)
+	}
+}
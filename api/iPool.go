@@ -0,0 +1,164 @@
+package api
+
+import (
+	"ceph-panel-go/ceph"
+	"ceph-panel-go/config"
+	"net/http"
+	"strconv"
+)
+
+// 存储池
+type IPool struct {
+	ICeph
+}
+
+func NewIPool(config config.IConfig, w http.ResponseWriter, r *http.Request) *IPool {
+	pool := &IPool{
+		ICeph: *NewICeph(config, w, r),
+	}
+	pool.Module = "pool"
+	return pool
+}
+
+func (this *IPool) List() {
+	if !this.connected() {
+		return
+	}
+	pools, err := this.Rados.Rados_pool_list()
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, pools, "存储池列表")
+}
+
+func (this *IPool) Detail() {
+	name := this.GetString("pool")
+	if name == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	if !this.connected() {
+		return
+	}
+	pools, err := this.Rados.Rados_pool_list()
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	for _, pool := range pools {
+		if pool.Name != name {
+			continue
+		}
+		stat, err := this.Rados.Rados_pool_stat(name)
+		if err != nil {
+			this.ResponseWithHeader(102, "", err.Error())
+			return
+		}
+		result := map[string]interface{}{
+			"pool": pool,
+			"quota": ceph.PoolQuota{
+				MaxObjects: pool.QuotaMaxObjects,
+				MaxBytes:   pool.QuotaMaxBytes,
+			},
+			"stat": stat,
+		}
+		this.ResponseWithHeader(100, result, "存储池详情")
+		return
+	}
+	this.ResponseWithHeader(102, "", "存储池不存在")
+}
+
+func (this *IPool) Create() {
+	name := this.PostString("pool")
+	if name == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	if !this.connected() {
+		return
+	}
+	opts := ceph.PoolCreateOptions{
+		PgNum:     this.PostInt("pg_num"),
+		Size:      this.PostInt("size"),
+		CrushRule: this.PostString("crush_rule"),
+	}
+	if err := this.Rados.Rados_pool_create(name, opts); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, name, "创建成功")
+}
+
+// 需要提交confirm为存储池名称
+func (this *IPool) Delete() {
+	name := this.PostString("pool")
+	if name == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	if !this.connected() {
+		return
+	}
+	if err := this.Rados.Rados_pool_delete(name, this.PostString("confirm")); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, name, "删除成功")
+}
+
+// 只修改提交的字段，未提交的字段保留原配额，0表示不限制
+func (this *IPool) SetQuota() {
+	name := this.PostString("pool")
+	if name == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	maxObjects, maxBytes := this.PostString("max_objects"), this.PostString("max_bytes")
+	if maxObjects == "" && maxBytes == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	if !this.connected() {
+		return
+	}
+	quota, err := this.Rados.Rados_pool_get_quota(name)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	if maxObjects != "" {
+		if quota.MaxObjects, err = strconv.ParseUint(maxObjects, 10, 64); err != nil {
+			this.ResponseWithHeader(101, "", "无效的配额 "+maxObjects)
+			return
+		}
+	}
+	if maxBytes != "" {
+		if quota.MaxBytes, err = strconv.ParseUint(maxBytes, 10, 64); err != nil {
+			this.ResponseWithHeader(101, "", "无效的配额 "+maxBytes)
+			return
+		}
+	}
+	if err := this.Rados.Rados_pool_set_quota(name, quota); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, quota, "设置成功")
+}
+
+func (this *IPool) Stats() {
+	name := this.GetString("pool")
+	if name == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	if !this.connected() {
+		return
+	}
+	stat, err := this.Rados.Rados_pool_stat(name)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, stat, "存储池统计")
+}
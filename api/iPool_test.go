@@ -0,0 +1,56 @@
+package api_test
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestNewIPool(t *testing.T) {
+	newFakeCluster(t)
+
+	res := callApi(t, "pool/create", url.Values{"pool": {"images"}, "pg_num": {"16"}, "size": {"2"}})
+	if res.Code != 100 {
+		t.Fatalf("create %+v", res)
+	}
+	res = callApi(t, "pool/set-quota", url.Values{"pool": {"images"}, "max_objects": {"10"}})
+	if res.Code != 100 {
+		t.Fatalf("set-quota %+v", res)
+	}
+	res = callApi(t, "pool/detail", url.Values{"pool": {"images"}})
+	if res.Code != 100 {
+		t.Fatalf("detail %+v", res)
+	}
+	detail := res.Result.(map[string]interface{})
+	if detail["quota"].(map[string]interface{})["max_objects"].(float64) != 10 {
+		t.Fatalf("detail %+v", detail)
+	}
+	// 只提交max_bytes时保留max_objects
+	res = callApi(t, "pool/set-quota", url.Values{"pool": {"images"}, "max_bytes": {"4096"}})
+	quota, _ := res.Result.(map[string]interface{})
+	if res.Code != 100 || quota["max_objects"] != float64(10) || quota["max_bytes"] != float64(4096) {
+		t.Fatalf("set-quota max_bytes %+v", res)
+	}
+	if res := callApi(t, "pool/set-quota", url.Values{"pool": {"images"}, "max_objects": {"-1"}}); res.Code != 101 {
+		t.Fatalf("set-quota negative %+v", res)
+	}
+	if res := callApi(t, "pool/set-quota", url.Values{"pool": {"images"}}); res.Code != 101 {
+		t.Fatalf("set-quota without fields %+v", res)
+	}
+	res = callApi(t, "pool/list", url.Values{})
+	if res.Code != 100 || len(res.Result.([]interface{})) != 4 {
+		t.Fatalf("list %+v", res)
+	}
+
+	res = callApi(t, "pool/delete", url.Values{"pool": {"images"}})
+	if res.Code != 102 {
+		t.Fatalf("delete without confirm %+v", res)
+	}
+	res = callApi(t, "pool/delete", url.Values{"pool": {"images"}, "confirm": {"images"}})
+	if res.Code != 100 {
+		t.Fatalf("delete %+v", res)
+	}
+	res = callApi(t, "pool/stats", url.Values{"pool": {"images"}})
+	if res.Code != 102 {
+		t.Fatalf("stats of deleted pool %+v", res)
+	}
+}
@@ -0,0 +1,581 @@
+package api
+
+import (
+	"ceph-panel-go/ceph"
+	"ceph-panel-go/config"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// 解析容量，支持K/M/G/T/P后缀(1024进制)，不带后缀为字节
+func parseSize(size string) (uint64, error) {
+	size = strings.ToUpper(strings.TrimSpace(size))
+	size = strings.TrimSuffix(strings.TrimSuffix(size, "B"), "I")
+	shift := uint(0)
+	if size != "" {
+		if i := strings.IndexByte("KMGTP", size[len(size)-1]); i >= 0 {
+			shift = uint(i+1) * 10
+			size = size[:len(size)-1]
+		}
+	}
+	n, err := strconv.ParseUint(size, 10, 64)
+	if err != nil || n == 0 || n > (1<<63)>>shift {
+		return 0, errors.New("invalid size " + size)
+	}
+	return n << shift, nil
+}
+
+const RBD_TREE_DEPTH = 16 // 父子关系树的最大层数
+
+// 镜像的快照及每个快照的克隆
+type RbdTreeNode struct {
+	ceph.RbdImageSpec
+	Snaps []RbdTreeSnap `json:"snaps"`
+}
+
+type RbdTreeSnap struct {
+	ceph.RbdSnap
+	Children []*RbdTreeNode `json:"children"`
+}
+
+// rbd块设备镜像
+type IRbd struct {
+	ICeph
+}
+
+func NewIRbd(config config.IConfig, w http.ResponseWriter, r *http.Request) *IRbd {
+	rbd := &IRbd{
+		ICeph: *NewICeph(config, w, r),
+	}
+	rbd.Module = "rbd"
+	return rbd
+}
+
+// 打开存储池并切换命名空间，返回的句柄使用完毕需调用Rados_ioctx_destroy
+func (this *IRbd) rbdHandle(pool string, nspace string) (ceph.LibRBD, error) {
+	return newRbdHandle(this.Rados, pool, nspace)
+}
+
+// 在指定集群的连接上打开存储池
+func newRbdHandle(conn ceph.LibRados, pool string, nspace string) (ceph.LibRBD, error) {
+	rados := conn.Rados_clone()
+	if err := rados.Rados_ioctx_create(pool); err != nil {
+		return nil, err
+	}
+	rbd, err := ceph.NewLibRBD(rados)
+	if err != nil {
+		rados.Rados_ioctx_destroy()
+		return nil, err
+	}
+	rbd.Rados_ioctx_set_namespace(nspace)
+	return rbd, nil
+}
+
+func (this *IRbd) openRbd(pool string, nspace string) (ceph.LibRBD, bool) {
+	if !this.connected() {
+		return nil, false
+	}
+	rbd, err := this.rbdHandle(pool, nspace)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return nil, false
+	}
+	return rbd, true
+}
+
+// 镜像列表，detail=1时返回每个镜像的信息
+func (this *IRbd) List() {
+	pool := this.GetString("pool")
+	if pool == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rbd, ok := this.openRbd(pool, this.GetString("namespace"))
+	if !ok {
+		return
+	}
+	defer rbd.Rados_ioctx_destroy()
+
+	names, err := rbd.Rbd_list()
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	if this.GetInt("detail") != 1 {
+		this.ResponseWithHeader(100, names, "镜像列表")
+		return
+	}
+	images := []ceph.RbdImageInfo{}
+	for _, name := range names {
+		info, err := rbd.Rbd_stat(name)
+		if err != nil {
+			this.ResponseWithHeader(102, "", err.Error())
+			return
+		}
+		images = append(images, info)
+	}
+	this.ResponseWithHeader(100, images, "镜像列表")
+}
+
+func (this *IRbd) Info() {
+	pool := this.GetString("pool")
+	image := this.GetString("image")
+	if pool == "" || image == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rbd, ok := this.openRbd(pool, this.GetString("namespace"))
+	if !ok {
+		return
+	}
+	defer rbd.Rados_ioctx_destroy()
+
+	info, err := rbd.Rbd_stat(image)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, info, "镜像信息")
+}
+
+// features为逗号分隔的特性名称，为空时使用默认特性
+func (this *IRbd) Create() {
+	pool := this.PostString("pool")
+	image := this.PostString("image")
+	if pool == "" || image == "" || this.PostString("size") == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	size, err := parseSize(this.PostString("size"))
+	if err != nil {
+		this.ResponseWithHeader(101, "", err.Error())
+		return
+	}
+	features, err := ceph.ParseRbdFeatures(this.PostString("features"))
+	if err != nil {
+		this.ResponseWithHeader(101, "", err.Error())
+		return
+	}
+	stripeUnit := this.PostInt64("stripe_unit")
+	stripeCount := this.PostInt64("stripe_count")
+	if stripeUnit < 0 || stripeCount < 0 {
+		this.ResponseWithHeader(101, "", "条带参数不能为负数")
+		return
+	}
+	opts := ceph.RbdCreateOptions{
+		Order:       this.PostInt("order"),
+		Features:    features,
+		StripeUnit:  uint64(stripeUnit),
+		StripeCount: uint64(stripeCount),
+		DataPool:    this.PostString("data_pool"),
+	}
+	rbd, ok := this.openRbd(pool, this.PostString("namespace"))
+	if !ok {
+		return
+	}
+	defer rbd.Rados_ioctx_destroy()
+
+	if err := rbd.Rbd_create(image, size, opts); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, image, "创建成功")
+}
+
+// 缩小容量需要allow_shrink=1
+func (this *IRbd) Resize() {
+	pool := this.PostString("pool")
+	image := this.PostString("image")
+	if pool == "" || image == "" || this.PostString("size") == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	size, err := parseSize(this.PostString("size"))
+	if err != nil {
+		this.ResponseWithHeader(101, "", err.Error())
+		return
+	}
+	rbd, ok := this.openRbd(pool, this.PostString("namespace"))
+	if !ok {
+		return
+	}
+	defer rbd.Rados_ioctx_destroy()
+
+	if err := rbd.Rbd_resize(image, size, this.PostInt("allow_shrink") == 1); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, size, "调整成功")
+}
+
+// 需要提交confirm为镜像名称
+func (this *IRbd) Remove() {
+	pool := this.PostString("pool")
+	image := this.PostString("image")
+	if pool == "" || image == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	if this.PostString("confirm") != image {
+		this.ResponseWithHeader(101, "", "请输入镜像名称确认删除")
+		return
+	}
+	rbd, ok := this.openRbd(pool, this.PostString("namespace"))
+	if !ok {
+		return
+	}
+	defer rbd.Rados_ioctx_destroy()
+
+	if err := rbd.Rbd_remove(image); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, image, "删除成功")
+}
+
+func (this *IRbd) Rename() {
+	pool := this.PostString("pool")
+	image := this.PostString("image")
+	dest := this.PostString("dest")
+	if pool == "" || image == "" || dest == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rbd, ok := this.openRbd(pool, this.PostString("namespace"))
+	if !ok {
+		return
+	}
+	defer rbd.Rados_ioctx_destroy()
+
+	if err := rbd.Rbd_rename(image, dest); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, dest, "重命名成功")
+}
+
+// 镜像元数据，指定key时只返回该项
+func (this *IRbd) Metadata() {
+	pool := this.GetString("pool")
+	image := this.GetString("image")
+	if pool == "" || image == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rbd, ok := this.openRbd(pool, this.GetString("namespace"))
+	if !ok {
+		return
+	}
+	defer rbd.Rados_ioctx_destroy()
+
+	if key := this.GetString("key"); key != "" {
+		value, err := rbd.Rbd_metadata_get(image, key)
+		if err != nil {
+			this.ResponseWithHeader(102, "", err.Error())
+			return
+		}
+		this.ResponseWithHeader(100, ceph.RbdMetadata{Key: key, Value: value}, "镜像元数据")
+		return
+	}
+	metadata, err := rbd.Rbd_metadata_list(image)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, metadata, "镜像元数据")
+}
+
+func (this *IRbd) SetMetadata() {
+	pool := this.PostString("pool")
+	image := this.PostString("image")
+	key := this.PostString("key")
+	if pool == "" || image == "" || key == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rbd, ok := this.openRbd(pool, this.PostString("namespace"))
+	if !ok {
+		return
+	}
+	defer rbd.Rados_ioctx_destroy()
+
+	if err := rbd.Rbd_metadata_set(image, key, this.PostString("value")); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, key, "设置成功")
+}
+
+func (this *IRbd) RmMetadata() {
+	pool := this.PostString("pool")
+	image := this.PostString("image")
+	key := this.PostString("key")
+	if pool == "" || image == "" || key == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rbd, ok := this.openRbd(pool, this.PostString("namespace"))
+	if !ok {
+		return
+	}
+	defer rbd.Rados_ioctx_destroy()
+
+	if err := rbd.Rbd_metadata_remove(image, key); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, key, "删除成功")
+}
+
+func (this *IRbd) Snaps() {
+	pool := this.GetString("pool")
+	image := this.GetString("image")
+	if pool == "" || image == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rbd, ok := this.openRbd(pool, this.GetString("namespace"))
+	if !ok {
+		return
+	}
+	defer rbd.Rados_ioctx_destroy()
+
+	snaps, err := rbd.Rbd_snap_list(image)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, snaps, "快照列表")
+}
+
+// 提交pool、image、snap执行快照操作
+func (this *IRbd) snapAction(op func(rbd ceph.LibRBD, image string, snap string) error, message string) {
+	pool := this.PostString("pool")
+	image := this.PostString("image")
+	snap := this.PostString("snap")
+	if pool == "" || image == "" || snap == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rbd, ok := this.openRbd(pool, this.PostString("namespace"))
+	if !ok {
+		return
+	}
+	defer rbd.Rados_ioctx_destroy()
+
+	if err := op(rbd, image, snap); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, snap, message)
+}
+
+func (this *IRbd) SnapCreate() {
+	this.snapAction(ceph.LibRBD.Rbd_snap_create, "创建成功")
+}
+
+func (this *IRbd) SnapRemove() {
+	this.snapAction(ceph.LibRBD.Rbd_snap_remove, "删除成功")
+}
+
+func (this *IRbd) SnapRollback() {
+	this.snapAction(ceph.LibRBD.Rbd_snap_rollback, "回滚成功")
+}
+
+func (this *IRbd) Protect() {
+	this.snapAction(ceph.LibRBD.Rbd_snap_protect, "保护成功")
+}
+
+// 快照还有子镜像时拒绝取消保护，返回子镜像列表
+func (this *IRbd) Unprotect() {
+	pool := this.PostString("pool")
+	image := this.PostString("image")
+	snap := this.PostString("snap")
+	if pool == "" || image == "" || snap == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rbd, ok := this.openRbd(pool, this.PostString("namespace"))
+	if !ok {
+		return
+	}
+	defer rbd.Rados_ioctx_destroy()
+
+	children, err := rbd.Rbd_list_children(image, snap)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	if len(children) > 0 {
+		this.ResponseWithHeader(102, children, "快照存在子镜像，请先合并(flatten)或删除子镜像")
+		return
+	}
+	if err := rbd.Rbd_snap_unprotect(image, snap); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, snap, "取消保护成功")
+}
+
+// 从受保护的快照克隆，dest_pool为空时克隆到同一存储池
+func (this *IRbd) Clone() {
+	pool := this.PostString("pool")
+	image := this.PostString("image")
+	snap := this.PostString("snap")
+	dest := ceph.RbdImageSpec{
+		Pool:      this.PostString("dest_pool"),
+		Namespace: this.PostString("dest_namespace"),
+		Image:     this.PostString("dest_image"),
+	}
+	if pool == "" || image == "" || snap == "" || dest.Image == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	if dest.Pool == "" {
+		dest.Pool = pool
+	}
+	features, err := ceph.ParseRbdFeatures(this.PostString("features"))
+	if err != nil {
+		this.ResponseWithHeader(101, "", err.Error())
+		return
+	}
+	rbd, ok := this.openRbd(pool, this.PostString("namespace"))
+	if !ok {
+		return
+	}
+	defer rbd.Rados_ioctx_destroy()
+
+	opts := ceph.RbdCreateOptions{
+		Order:    this.PostInt("order"),
+		Features: features,
+	}
+	if err := rbd.Rbd_clone(image, snap, dest, opts); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, dest, "克隆成功")
+}
+
+func (this *IRbd) Children() {
+	pool := this.GetString("pool")
+	image := this.GetString("image")
+	snap := this.GetString("snap")
+	if pool == "" || image == "" || snap == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rbd, ok := this.openRbd(pool, this.GetString("namespace"))
+	if !ok {
+		return
+	}
+	defer rbd.Rados_ioctx_destroy()
+
+	children, err := rbd.Rbd_list_children(image, snap)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, children, "子镜像列表")
+}
+
+func (this *IRbd) Flatten() {
+	pool := this.PostString("pool")
+	image := this.PostString("image")
+	if pool == "" || image == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rbd, ok := this.openRbd(pool, this.PostString("namespace"))
+	if !ok {
+		return
+	}
+	defer rbd.Rados_ioctx_destroy()
+
+	if err := rbd.Rbd_flatten(image); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, image, "合并成功")
+}
+
+// 镜像的快照及克隆，递归到子镜像
+func (this *IRbd) imageTree(spec ceph.RbdImageSpec, depth int) (*RbdTreeNode, error) {
+	rbd, err := this.rbdHandle(spec.Pool, spec.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer rbd.Rados_ioctx_destroy()
+
+	node := &RbdTreeNode{RbdImageSpec: spec, Snaps: []RbdTreeSnap{}}
+	snaps, err := rbd.Rbd_snap_list(spec.Image)
+	if err != nil {
+		return nil, err
+	}
+	for _, snap := range snaps {
+		treeSnap := RbdTreeSnap{RbdSnap: snap, Children: []*RbdTreeNode{}}
+		children, err := rbd.Rbd_list_children(spec.Image, snap.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			// 回收站中的镜像不能按名称打开
+			if child.Trash || depth >= RBD_TREE_DEPTH {
+				treeSnap.Children = append(treeSnap.Children, &RbdTreeNode{RbdImageSpec: child, Snaps: []RbdTreeSnap{}})
+				continue
+			}
+			childNode, err := this.imageTree(child, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			treeSnap.Children = append(treeSnap.Children, childNode)
+		}
+		node.Snaps = append(node.Snaps, treeSnap)
+	}
+	return node, nil
+}
+
+// 镜像的父子关系，parents从直接父镜像到最上层的父镜像
+func (this *IRbd) Tree() {
+	pool := this.GetString("pool")
+	image := this.GetString("image")
+	if pool == "" || image == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	if !this.connected() {
+		return
+	}
+	spec := ceph.RbdImageSpec{Pool: pool, Namespace: this.GetString("namespace"), Image: image}
+	parents := []ceph.RbdParent{}
+	current := spec
+	for len(parents) < RBD_TREE_DEPTH {
+		rbd, err := this.rbdHandle(current.Pool, current.Namespace)
+		if err != nil {
+			this.ResponseWithHeader(102, "", err.Error())
+			return
+		}
+		info, err := rbd.Rbd_stat(current.Image)
+		rbd.Rados_ioctx_destroy()
+		if err != nil {
+			this.ResponseWithHeader(102, "", err.Error())
+			return
+		}
+		if info.Parent == nil || info.Parent.Image == "" {
+			break
+		}
+		parents = append(parents, *info.Parent)
+		current = ceph.RbdImageSpec{Pool: info.Parent.Pool, Namespace: info.Parent.Namespace, Image: info.Parent.Image}
+	}
+	tree, err := this.imageTree(spec, 0)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	result := map[string]interface{}{
+		"parents": parents,
+		"tree":    tree,
+	}
+	this.ResponseWithHeader(100, result, "镜像关系")
+}
@@ -0,0 +1,289 @@
+package api
+
+import (
+	"ceph-panel-go/ceph"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// 导出镜像，format为raw或diff，diff格式与rbd export-diff一致，version为1或2
+// from_snap不为空时导出snap相对from_snap的差异，snap为空时导出最新数据
+func (this *IRbd) Export() {
+	this.streaming()
+	pool := this.GetString("pool")
+	image := this.GetString("image")
+	snap := this.GetString("snap")
+	fromSnap := this.GetString("from_snap")
+	if pool == "" || image == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	format := this.GetString("format")
+	if format == "" {
+		format = "raw"
+		if fromSnap != "" {
+			format = "diff"
+		}
+	}
+	if format != "raw" && format != "diff" {
+		this.ResponseWithHeader(101, "", "format只能为raw或diff")
+		return
+	}
+	if format == "raw" && fromSnap != "" {
+		this.ResponseWithHeader(101, "", "raw格式不支持from_snap")
+		return
+	}
+	version := this.GetInt("version")
+	if version == 0 {
+		version = ceph.RBD_DIFF_V1
+	}
+	if version != ceph.RBD_DIFF_V1 && version != ceph.RBD_DIFF_V2 {
+		this.ResponseWithHeader(101, "", "version只能为1或2")
+		return
+	}
+	rbd, ok := this.openRbd(pool, this.GetString("namespace"))
+	if !ok {
+		return
+	}
+	defer rbd.Rados_ioctx_destroy()
+
+	// 发送响应头前检查镜像和快照
+	img, err := rbd.Rbd_open(image, snap, true)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	size, err := img.Size()
+	img.Close()
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	filename := image
+	if snap != "" {
+		filename += "@" + snap
+	}
+	header := this.W.Header()
+	header.Set("Content-Type", "application/octet-stream")
+	header.Set("Content-Disposition", "attachment; filename=\""+strings.ReplaceAll(filename, "\"", "")+"."+format+"\"")
+	if format == "raw" {
+		header.Set("Content-Length", strconv.FormatUint(size, 10))
+	}
+	this.W.WriteHeader(http.StatusOK)
+	if this.R.Method == http.MethodHead {
+		return
+	}
+	if format == "raw" {
+		_, err = ceph.ExportRbdRaw(rbd, image, snap, this.W, nil)
+	} else {
+		_, err = ceph.ExportRbdDiff(rbd, image, fromSnap, snap, version, this.W, nil)
+	}
+	// 响应头已发送，出错时只能中断连接
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// 导入时的进度回调，以upload_id查询
+func (this *IRbd) importProgress(id string, image string) (fail func(err error), progress func(read uint64)) {
+	setUploadProgress(id, func(p *UploadProgress) {
+		*p = UploadProgress{Object: image, Total: this.R.ContentLength}
+	})
+	fail = func(err error) {
+		setUploadProgress(id, func(p *UploadProgress) {
+			p.Done = true
+			p.Error = err.Error()
+		})
+		this.ResponseWithHeader(102, "", err.Error())
+	}
+	progress = func(read uint64) {
+		setUploadProgress(id, func(p *UploadProgress) {
+			p.Written = read
+		})
+	}
+	return fail, progress
+}
+
+// 以请求体的原始数据创建镜像，size为空时使用请求的Content-Length
+func (this *IRbd) Import() {
+	this.streaming()
+	pool := this.GetString("pool")
+	image := this.GetString("image")
+	if pool == "" || image == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	var size uint64
+	if this.GetString("size") != "" {
+		var err error
+		if size, err = parseSize(this.GetString("size")); err != nil {
+			this.ResponseWithHeader(101, "", err.Error())
+			return
+		}
+	} else if this.R.ContentLength > 0 {
+		size = uint64(this.R.ContentLength)
+	} else {
+		this.ResponseWithHeader(101, "", "缺少镜像容量")
+		return
+	}
+	features, err := ceph.ParseRbdFeatures(this.GetString("features"))
+	if err != nil {
+		this.ResponseWithHeader(101, "", err.Error())
+		return
+	}
+	opts := ceph.RbdCreateOptions{
+		Order:    this.GetInt("order"),
+		Features: features,
+	}
+	id := this.GetString("upload_id")
+	rbd, ok := this.openRbd(pool, this.GetString("namespace"))
+	if !ok {
+		return
+	}
+	defer rbd.Rados_ioctx_destroy()
+
+	fail, progress := this.importProgress(id, image)
+	written, err := ceph.ImportRbdRaw(rbd, image, size, opts, this.R.Body, progress)
+	if err != nil {
+		fail(err)
+		return
+	}
+	setUploadProgress(id, func(p *UploadProgress) {
+		p.Done = true
+	})
+	result := map[string]interface{}{
+		"image": image,
+		"size":  written,
+	}
+	this.ResponseWithHeader(100, result, "导入成功")
+}
+
+// 将请求体的差异应用到镜像，create=1时先创建空镜像，差异中的结束快照在导入后创建
+func (this *IRbd) ImportDiff() {
+	this.streaming()
+	pool := this.GetString("pool")
+	image := this.GetString("image")
+	if pool == "" || image == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	id := this.GetString("upload_id")
+	rbd, ok := this.openRbd(pool, this.GetString("namespace"))
+	if !ok {
+		return
+	}
+	defer rbd.Rados_ioctx_destroy()
+
+	fail, progress := this.importProgress(id, image)
+	create := this.GetInt("create") == 1
+	if create {
+		opts := ceph.RbdCreateOptions{Order: this.GetInt("order")}
+		if err := rbd.Rbd_create(image, 0, opts); err != nil {
+			fail(err)
+			return
+		}
+	}
+	stat, err := ceph.ImportRbdDiff(rbd, image, this.R.Body, progress)
+	if err != nil {
+		// 删除新建的不完整镜像
+		if create {
+			rbd.Rbd_remove(image)
+		}
+		fail(err)
+		return
+	}
+	setUploadProgress(id, func(p *UploadProgress) {
+		p.Done = true
+	})
+	this.ResponseWithHeader(100, stat, "导入成功")
+}
+
+// 以差异格式复制镜像到其它存储池或集群
+// from_snap为空时创建目标镜像并复制到snap为止的全部数据，否则目标镜像需已有from_snap
+func (this *IRbd) Transfer() {
+	this.streaming()
+	pool := this.PostString("pool")
+	image := this.PostString("image")
+	snap := this.PostString("snap")
+	fromSnap := this.PostString("from_snap")
+	dest := ceph.RbdImageSpec{
+		Pool:      this.PostString("dest_pool"),
+		Namespace: this.PostString("dest_namespace"),
+		Image:     this.PostString("dest_image"),
+	}
+	destCluster := this.PostString("dest_cluster")
+	if pool == "" || image == "" || snap == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	if dest.Pool == "" {
+		dest.Pool = pool
+	}
+	if dest.Image == "" {
+		dest.Image = image
+	}
+	if destCluster == "" && dest.Pool == pool && dest.Namespace == this.PostString("namespace") && dest.Image == image {
+		this.ResponseWithHeader(101, "", "目标镜像不能与源镜像相同")
+		return
+	}
+	rbd, ok := this.openRbd(pool, this.PostString("namespace"))
+	if !ok {
+		return
+	}
+	defer rbd.Rados_ioctx_destroy()
+
+	conn := this.Rados
+	if destCluster != "" && destCluster != this.Cluster {
+		if ceph.Clusters == nil {
+			this.ResponseWithHeader(102, "", "集群未连接")
+			return
+		}
+		var err error
+		if conn, err = ceph.Clusters.Get(destCluster); err != nil {
+			this.ResponseWithHeader(102, "", "集群未连接 "+err.Error())
+			return
+		}
+	}
+	target, err := newRbdHandle(conn, dest.Pool, dest.Namespace)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	defer target.Rados_ioctx_destroy()
+
+	if fromSnap == "" {
+		if err := target.Rbd_create(dest.Image, 0, ceph.RbdCreateOptions{}); err != nil {
+			this.ResponseWithHeader(102, "", err.Error())
+			return
+		}
+	}
+	pr, pw := io.Pipe()
+	exported := make(chan error, 1)
+	go func() {
+		_, err := ceph.ExportRbdDiff(rbd, image, fromSnap, snap, ceph.RBD_DIFF_V2, pw, nil)
+		pw.CloseWithError(err)
+		exported <- err
+	}()
+	stat, err := ceph.ImportRbdDiff(target, dest.Image, pr, nil)
+	// 导入失败时中断导出
+	pr.CloseWithError(err)
+	if exportErr := <-exported; err == nil {
+		err = exportErr
+	}
+	if err != nil {
+		// 删除新建的不完整镜像
+		if fromSnap == "" {
+			target.Rbd_remove(dest.Image)
+		}
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	result := map[string]interface{}{
+		"cluster": destCluster,
+		"dest":    dest,
+		"stat":    stat,
+	}
+	this.ResponseWithHeader(100, result, "复制成功")
+}
@@ -0,0 +1,216 @@
+package api_test
+
+import (
+	"ceph-panel-go/api"
+	"ceph-panel-go/template"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// 合并表单参数
+func with(form url.Values, extra url.Values) url.Values {
+	out := url.Values{}
+	for k, v := range form {
+		out[k] = v
+	}
+	for k, v := range extra {
+		out[k] = v
+	}
+	return out
+}
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]uint64{"4096": 4096, "10G": 10 << 30, "512m": 512 << 20, "1TiB": 1 << 40, "2KB": 2 << 10}
+	for in, want := range cases {
+		if got, err := api.ParseSize(in); err != nil || got != want {
+			t.Fatalf("%s: %d %v", in, got, err)
+		}
+	}
+	for _, in := range []string{"", "0", "-1G", "G", "1X", "16777216P"} {
+		if _, err := api.ParseSize(in); err == nil {
+			t.Fatalf("expected %q to be invalid", in)
+		}
+	}
+}
+
+func TestIRbd(t *testing.T) {
+	newFakeCluster(t)
+
+	res := callApi(t, "rbd/create", url.Values{"pool": {"rbd"}, "image": {"vm1"}, "size": {"10G"}, "features": {"layering,striping"}})
+	if res.Code != 100 {
+		t.Fatalf("create %+v", res)
+	}
+	res = callApi(t, "rbd/create", url.Values{"pool": {"rbd"}, "image": {"vm2"}, "size": {"1G"}, "features": {"bogus"}})
+	if res.Code != 101 {
+		t.Fatalf("create with unknown feature %+v", res)
+	}
+	res = callApi(t, "rbd/info", url.Values{"pool": {"rbd"}, "image": {"vm1"}})
+	info, _ := res.Result.(map[string]interface{})
+	if res.Code != 100 || info["size"].(float64) != 10<<30 || len(info["feature_names"].([]interface{})) != 2 {
+		t.Fatalf("info %+v", res)
+	}
+
+	res = callApi(t, "rbd/resize", url.Values{"pool": {"rbd"}, "image": {"vm1"}, "size": {"5G"}})
+	if res.Code != 102 {
+		t.Fatalf("shrink without allow_shrink %+v", res)
+	}
+	res = callApi(t, "rbd/resize", url.Values{"pool": {"rbd"}, "image": {"vm1"}, "size": {"5G"}, "allow_shrink": {"1"}})
+	if res.Code != 100 {
+		t.Fatalf("resize %+v", res)
+	}
+	res = callApi(t, "rbd/rename", url.Values{"pool": {"rbd"}, "image": {"vm1"}, "dest": {"web"}})
+	if res.Code != 100 {
+		t.Fatalf("rename %+v", res)
+	}
+	res = callApi(t, "rbd/set-metadata", url.Values{"pool": {"rbd"}, "image": {"web"}, "key": {"owner"}, "value": {"ops"}})
+	if res.Code != 100 {
+		t.Fatalf("set-metadata %+v", res)
+	}
+	res = callApi(t, "rbd/metadata", url.Values{"pool": {"rbd"}, "image": {"web"}, "key": {"owner"}})
+	if res.Code != 100 || res.Result.(map[string]interface{})["value"] != "ops" {
+		t.Fatalf("metadata %+v", res)
+	}
+	res = callApi(t, "rbd/list", url.Values{"pool": {"rbd"}, "detail": {"1"}})
+	images, _ := res.Result.([]interface{})
+	if res.Code != 100 || len(images) != 1 || images[0].(map[string]interface{})["size"].(float64) != 5<<30 {
+		t.Fatalf("list %+v", res)
+	}
+
+	res = callApi(t, "rbd/remove", url.Values{"pool": {"rbd"}, "image": {"web"}})
+	if res.Code != 101 {
+		t.Fatalf("remove without confirm %+v", res)
+	}
+	res = callApi(t, "rbd/remove", url.Values{"pool": {"rbd"}, "image": {"web"}, "confirm": {"web"}})
+	if res.Code != 100 {
+		t.Fatalf("remove %+v", res)
+	}
+	res = callApi(t, "rbd/list", url.Values{"pool": {"rbd"}})
+	if res.Code != 100 || len(res.Result.([]interface{})) != 0 {
+		t.Fatalf("list after remove %+v", res)
+	}
+}
+
+func TestIRbd_clone(t *testing.T) {
+	newFakeCluster(t)
+	base := url.Values{"pool": {"rbd"}, "image": {"base"}}
+
+	if res := callApi(t, "rbd/create", with(base, url.Values{"size": {"1G"}})); res.Code != 100 {
+		t.Fatalf("create %+v", res)
+	}
+	gold := with(base, url.Values{"snap": {"gold"}})
+	for _, action := range []string{"snap-create", "protect"} {
+		if res := callApi(t, "rbd/"+action, gold); res.Code != 100 {
+			t.Fatalf("%s %+v", action, res)
+		}
+	}
+	res := callApi(t, "rbd/clone", with(gold, url.Values{"dest_pool": {"data"}, "dest_image": {"vm1"}}))
+	if res.Code != 100 {
+		t.Fatalf("clone %+v", res)
+	}
+	// 二级克隆
+	vm1 := url.Values{"pool": {"data"}, "image": {"vm1"}, "snap": {"s1"}}
+	for _, action := range []string{"snap-create", "protect"} {
+		if res := callApi(t, "rbd/"+action, vm1); res.Code != 100 {
+			t.Fatalf("%s %+v", action, res)
+		}
+	}
+	if res := callApi(t, "rbd/clone", with(vm1, url.Values{"dest_image": {"vm2"}})); res.Code != 100 {
+		t.Fatalf("clone vm1 %+v", res)
+	}
+
+	res = callApi(t, "rbd/unprotect", gold)
+	if res.Code != 102 || len(res.Result.([]interface{})) != 1 {
+		t.Fatalf("unprotect with children %+v", res)
+	}
+
+	res = callApi(t, "rbd/tree", url.Values{"pool": {"data"}, "image": {"vm2"}})
+	parents, _ := res.Result.(map[string]interface{})["parents"].([]interface{})
+	if res.Code != 100 || len(parents) != 2 || parents[1].(map[string]interface{})["image"] != "base" {
+		t.Fatalf("tree of vm2 %+v", res)
+	}
+	res = callApi(t, "rbd/tree", base)
+	tree := res.Result.(map[string]interface{})["tree"].(map[string]interface{})
+	snaps := tree["snaps"].([]interface{})
+	child := snaps[0].(map[string]interface{})["children"].([]interface{})[0].(map[string]interface{})
+	grandchild := child["snaps"].([]interface{})[0].(map[string]interface{})["children"].([]interface{})[0].(map[string]interface{})
+	if res.Code != 100 || child["image"] != "vm1" || grandchild["image"] != "vm2" || grandchild["pool"] != "data" {
+		t.Fatalf("tree of base %+v", res)
+	}
+
+	if res := callApi(t, "rbd/flatten", url.Values{"pool": {"data"}, "image": {"vm1"}}); res.Code != 100 {
+		t.Fatalf("flatten %+v", res)
+	}
+	if res := callApi(t, "rbd/unprotect", gold); res.Code != 100 {
+		t.Fatalf("unprotect %+v", res)
+	}
+	res = callApi(t, "rbd/snaps", base)
+	if res.Code != 100 || res.Result.([]interface{})[0].(map[string]interface{})["protected"] != false {
+		t.Fatalf("snaps %+v", res)
+	}
+}
+
+func TestIRbd_export(t *testing.T) {
+	newFakeCluster(t)
+	data := strings.Repeat("\x00", 8192) + strings.Repeat("rbd!", 1024)
+
+	w := streamApi("PUT", "rbd/import", url.Values{"pool": {"rbd"}, "image": {"vm1"}, "order": {"12"}, "upload_id": {"r1"}}, strings.NewReader(data))
+	res := template.ResponseData{}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.Code != 100 {
+		t.Fatalf("import %v %s", err, w.Body.String())
+	}
+	if res := callApi(t, "object/progress", url.Values{"upload_id": {"r1"}}); res.Code != 100 || !res.Result.(map[string]interface{})["done"].(bool) {
+		t.Fatalf("progress %+v", res)
+	}
+	w = streamApi("GET", "rbd/export", url.Values{"pool": {"rbd"}, "image": {"vm1"}}, nil)
+	if w.Code != 200 || w.Body.String() != data || w.Header().Get("Content-Length") != "12288" {
+		t.Fatalf("export raw %d %d", w.Code, w.Body.Len())
+	}
+	w = streamApi("GET", "rbd/export", url.Values{"pool": {"rbd"}, "image": {"vm1"}, "snap": {"none"}}, nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.Code != 102 {
+		t.Fatalf("export missing snapshot %v %s", err, w.Body.String())
+	}
+	w = streamApi("GET", "rbd/export", url.Values{"pool": {"rbd"}, "image": {"vm1"}, "from_snap": {"s1"}, "format": {"raw"}}, nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.Code != 101 {
+		t.Fatalf("export raw with from_snap %v %s", err, w.Body.String())
+	}
+
+	// 全量差异导入新镜像，再导入增量差异
+	vm1 := url.Values{"pool": {"rbd"}, "image": {"vm1"}}
+	callApi(t, "rbd/snap-create", url.Values{"pool": {"rbd"}, "image": {"vm1"}, "snap": {"s1"}})
+	w = streamApi("GET", "rbd/export", url.Values{"pool": {"rbd"}, "image": {"vm1"}, "snap": {"s1"}, "format": {"diff"}, "version": {"2"}}, nil)
+	if w.Code != 200 || !strings.HasPrefix(w.Body.String(), "rbd diff v2\n") {
+		t.Fatalf("export diff %d %q", w.Code, w.Body.String()[:12])
+	}
+	w = streamApi("PUT", "rbd/import-diff", url.Values{"pool": {"data"}, "image": {"copy"}, "create": {"1"}}, w.Body)
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.Code != 100 || res.Result.(map[string]interface{})["to_snap"] != "s1" {
+		t.Fatalf("import diff %v %s", err, w.Body.String())
+	}
+	// 导入失败时删除新建的镜像
+	w = streamApi("PUT", "rbd/import-diff", url.Values{"pool": {"data"}, "image": {"broken"}, "create": {"1"}}, strings.NewReader("rbd diff v2\nbad"))
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.Code != 102 {
+		t.Fatalf("import broken diff %v %s", err, w.Body.String())
+	}
+	if res := callApi(t, "rbd/info", url.Values{"pool": {"data"}, "image": {"broken"}}); res.Code != 102 {
+		t.Fatalf("info of broken image %+v", res)
+	}
+	if res := callApi(t, "rbd/transfer", with(vm1, url.Values{"snap": {"s1"}, "dest_pool": {"data"}, "dest_image": {"copy"}})); res.Code != 102 {
+		t.Fatalf("transfer to existing image %+v", res)
+	}
+	if res := callApi(t, "rbd/transfer", with(vm1, url.Values{"snap": {"s1"}})); res.Code != 101 {
+		t.Fatalf("transfer to itself %+v", res)
+	}
+	if res := callApi(t, "rbd/resize", with(vm1, url.Values{"size": {"16K"}})); res.Code != 100 {
+		t.Fatalf("resize %+v", res)
+	}
+	callApi(t, "rbd/snap-create", url.Values{"pool": {"rbd"}, "image": {"vm1"}, "snap": {"s2"}})
+	res = callApi(t, "rbd/transfer", with(vm1, url.Values{"snap": {"s2"}, "from_snap": {"s1"}, "dest_pool": {"data"}, "dest_image": {"copy"}}))
+	if res.Code != 100 || res.Result.(map[string]interface{})["stat"].(map[string]interface{})["size"].(float64) != 16384 {
+		t.Fatalf("incremental transfer %+v", res)
+	}
+	res = callApi(t, "rbd/snaps", url.Values{"pool": {"data"}, "image": {"copy"}})
+	if res.Code != 100 || len(res.Result.([]interface{})) != 2 {
+		t.Fatalf("snaps of copy %+v", res)
+	}
+}
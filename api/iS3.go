@@ -0,0 +1,272 @@
+package api
+
+import (
+	"ceph-panel-go/ceph"
+	"ceph-panel-go/config"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const S3_PRESIGN_DEFAULT = time.Hour // 预签名URL默认有效期
+
+// 对象存储网关的存储桶和对象浏览，使用集群配置中的rgw
+type IS3 struct {
+	ICeph
+	Rgw ceph.RadosGW // 为空时在gateway中按Cluster从连接管理器获取
+}
+
+func NewIS3(config config.IConfig, w http.ResponseWriter, r *http.Request) *IS3 {
+	s3 := &IS3{
+		ICeph: *NewICeph(config, w, r),
+	}
+	s3.Module = "s3"
+	return s3
+}
+
+// 检查集群是否配置了对象存储网关
+func (this *IS3) gateway() bool {
+	if this.Rgw != nil {
+		return true
+	}
+	if ceph.Clusters == nil {
+		this.ResponseWithHeader(102, "", "集群未连接")
+		return false
+	}
+	gw, err := ceph.Clusters.RadosGW(this.Cluster)
+	if err != nil {
+		this.ResponseWithHeader(102, "", "对象存储网关不可用 "+err.Error())
+		return false
+	}
+	this.Rgw = gw
+	return true
+}
+
+// 读取bucket和key参数，上传时请求体为对象数据，只从查询参数读取
+func (this *IS3) object() (string, string, bool) {
+	bucket := this.GetString("bucket")
+	key := this.GetString("key")
+	if bucket == "" || key == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return "", "", false
+	}
+	return bucket, key, this.gateway()
+}
+
+func (this *IS3) Buckets() {
+	if !this.gateway() {
+		return
+	}
+	buckets, err := this.Rgw.ListBuckets()
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, buckets, "存储桶列表")
+}
+
+// 按目录浏览对象，recursive=1时不按/分组，token为上一页的next_continuation_token
+func (this *IS3) List() {
+	bucket := this.GetString("bucket")
+	if bucket == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	if !this.gateway() {
+		return
+	}
+	opts := ceph.S3ListOptions{
+		Prefix:            this.GetString("prefix"),
+		Delimiter:         "/",
+		ContinuationToken: this.GetString("token"),
+		MaxKeys:           this.GetInt("max"),
+	}
+	if this.GetInt("recursive") == 1 {
+		opts.Delimiter = ""
+	}
+	list, err := this.Rgw.ListObjects(bucket, opts)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, list, "对象列表")
+}
+
+func (this *IS3) Head() {
+	bucket, key, ok := this.object()
+	if !ok {
+		return
+	}
+	info, err := this.Rgw.HeadObject(bucket, key)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, info, "对象信息")
+}
+
+// 下载对象，支持Range
+func (this *IS3) Download() {
+	this.streaming()
+	bucket, key, ok := this.object()
+	if !ok {
+		return
+	}
+	info, err := this.Rgw.HeadObject(bucket, key)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	size := uint64(info.Size)
+	start, length, partial, err := parseRange(this.R.Header.Get("Range"), size)
+	header := this.W.Header()
+	header.Set("Accept-Ranges", "bytes")
+	if err != nil {
+		header.Set("Content-Range", "bytes */"+strconv.FormatUint(size, 10))
+		this.W.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	var body io.ReadCloser
+	if this.R.Method != http.MethodHead && length > 0 {
+		// 空对象不能按范围读取
+		body, _, err = this.Rgw.GetObject(bucket, key, int64(start), int64(length))
+		if err != nil {
+			this.ResponseWithHeader(102, "", err.Error())
+			return
+		}
+		defer body.Close()
+	}
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Disposition", "attachment; filename=\""+strings.ReplaceAll(path.Base(key), "\"", "")+"\"")
+	header.Set("Content-Length", strconv.FormatUint(length, 10))
+	header.Set("ETag", "\""+info.ETag+"\"")
+	header.Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+	if partial {
+		header.Set("Content-Range", "bytes "+strconv.FormatUint(start, 10)+"-"+strconv.FormatUint(start+length-1, 10)+"/"+strconv.FormatUint(size, 10))
+		this.W.WriteHeader(http.StatusPartialContent)
+	} else {
+		this.W.WriteHeader(http.StatusOK)
+	}
+	if body == nil {
+		return
+	}
+	// 响应头已发送，出错时只能中断连接
+	if _, err := io.Copy(this.W, body); err != nil {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// 以请求体上传对象，需要Content-Length，超过part_size时使用分块上传
+func (this *IS3) Upload() {
+	this.streaming()
+	bucket, key, ok := this.object()
+	if !ok {
+		return
+	}
+	if this.R.ContentLength < 0 {
+		this.ResponseWithHeader(101, "", "缺少Content-Length")
+		return
+	}
+	contentType := this.GetString("content_type")
+	if contentType == "" {
+		contentType = this.R.Header.Get("Content-Type")
+	}
+	etag, err := this.Rgw.UploadObject(bucket, key, this.R.Body, this.R.ContentLength, contentType, this.GetInt64("part_size"))
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	result := map[string]interface{}{
+		"bucket": bucket,
+		"key":    key,
+		"size":   this.R.ContentLength,
+		"etag":   etag,
+	}
+	this.ResponseWithHeader(100, result, "上传成功")
+}
+
+func (this *IS3) Delete() {
+	bucket, key, ok := this.object()
+	if !ok {
+		return
+	}
+	if err := this.Rgw.DeleteObject(bucket, key); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, "", "删除成功")
+}
+
+// 预签名URL，method默认GET，expires为有效秒数，默认1小时
+func (this *IS3) Presign() {
+	bucket, key, ok := this.object()
+	if !ok {
+		return
+	}
+	method := strings.ToUpper(this.GetString("method"))
+	if method == "" {
+		method = http.MethodGet
+	}
+	expires := S3_PRESIGN_DEFAULT
+	if seconds := this.GetInt64("expires"); seconds > 0 {
+		expires = time.Duration(seconds) * time.Second
+	}
+	if expires > ceph.S3_PRESIGN_EXPIRE {
+		this.ResponseWithHeader(101, "", "expires不能超过"+strconv.Itoa(int(ceph.S3_PRESIGN_EXPIRE/time.Second))+"秒")
+		return
+	}
+	u, err := this.Rgw.PresignObject(method, bucket, key, expires)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	result := map[string]interface{}{
+		"url":     u,
+		"method":  method,
+		"expires": time.Now().Add(expires).Unix(),
+	}
+	this.ResponseWithHeader(100, result, "预签名URL")
+}
+
+// 未完成的分块上传
+func (this *IS3) Uploads() {
+	bucket := this.GetString("bucket")
+	if bucket == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	if !this.gateway() {
+		return
+	}
+	uploads, err := this.Rgw.ListMultipartUploads(bucket)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, uploads, "分块上传列表")
+}
+
+// 取消分块上传，释放已上传的分块
+func (this *IS3) UploadAbort() {
+	bucket, key, ok := this.object()
+	if !ok {
+		return
+	}
+	id := this.GetString("upload_id")
+	if id == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	if err := this.Rgw.AbortMultipartUpload(bucket, key, id); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, "", "取消成功")
+}
@@ -0,0 +1,143 @@
+package api_test
+
+import (
+	"ceph-panel-go/ceph"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestIS3(t *testing.T) {
+	gw := newFakeRgw(t)
+
+	res := callApi(t, "s3/buckets", url.Values{})
+	if buckets, _ := res.Result.([]interface{}); res.Code != 100 || len(buckets) != 1 {
+		t.Fatalf("buckets %+v", res)
+	}
+	if res := decodeApi(t, streamApi("POST", "s3/upload", url.Values{"bucket": {"panel"}}, strings.NewReader("x"))); res.Code != 101 {
+		t.Fatalf("upload without key %+v", res)
+	}
+	for _, key := range []string{"docs/a.txt", "docs/b.txt", "readme.md"} {
+		res := decodeApi(t, streamApi("POST", "s3/upload", url.Values{"bucket": {"panel"}, "key": {key}, "content_type": {"text/plain"}}, strings.NewReader("hello "+key)))
+		if res.Code != 100 {
+			t.Fatalf("upload %s %+v", key, res)
+		}
+	}
+
+	res = callApi(t, "s3/list", url.Values{"bucket": {"panel"}})
+	list, _ := res.Result.(map[string]interface{})
+	if res.Code != 100 || len(list["common_prefixes"].([]interface{})) != 1 || len(list["contents"].([]interface{})) != 1 {
+		t.Fatalf("list %+v", res)
+	}
+	res = callApi(t, "s3/list", url.Values{"bucket": {"panel"}, "recursive": {"1"}, "max": {"2"}})
+	list, _ = res.Result.(map[string]interface{})
+	if res.Code != 100 || len(list["contents"].([]interface{})) != 2 || list["is_truncated"] != true {
+		t.Fatalf("list recursive %+v", res)
+	}
+	res = callApi(t, "s3/list", url.Values{"bucket": {"panel"}, "recursive": {"1"}, "token": {list["next_continuation_token"].(string)}})
+	list, _ = res.Result.(map[string]interface{})
+	if res.Code != 100 || len(list["contents"].([]interface{})) != 1 || list["is_truncated"] != false {
+		t.Fatalf("list next page %+v", res)
+	}
+	if res := callApi(t, "s3/list", url.Values{"bucket": {"missing"}}); res.Code != 102 {
+		t.Fatalf("list missing bucket %+v", res)
+	}
+
+	res = callApi(t, "s3/head", url.Values{"bucket": {"panel"}, "key": {"readme.md"}})
+	info, _ := res.Result.(map[string]interface{})
+	if res.Code != 100 || info["size"].(float64) != 15 || info["content_type"] != "text/plain" {
+		t.Fatalf("head %+v", res)
+	}
+
+	r := httptest.NewRequest("GET", "/api/s3/download?bucket=panel&key=docs/a.txt", nil)
+	r.Header.Set("Range", "bytes=6-")
+	w := serveApi(r)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "docs/a.txt" || w.Header().Get("Content-Range") != "bytes 6-15/16" ||
+		!strings.Contains(w.Header().Get("Content-Disposition"), "a.txt") {
+		t.Fatalf("download range %d %v %s", w.Code, w.Header(), w.Body.String())
+	}
+	r = httptest.NewRequest("GET", "/api/s3/download?bucket=panel&key=docs/a.txt", nil)
+	r.Header.Set("Range", "bytes=100-")
+	if w := serveApi(r); w.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("download invalid range %d", w.Code)
+	}
+
+	res = callApi(t, "s3/presign", url.Values{"bucket": {"panel"}, "key": {"readme.md"}, "expires": {"600"}})
+	presign, _ := res.Result.(map[string]interface{})
+	if res.Code != 100 || presign["method"] != "GET" {
+		t.Fatalf("presign %+v", res)
+	}
+	resp, err := http.Get(presign["url"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(data) != "hello readme.md" {
+		t.Fatalf("presigned url %d %s", resp.StatusCode, data)
+	}
+	if res := callApi(t, "s3/presign", url.Values{"bucket": {"panel"}, "key": {"readme.md"}, "expires": {"9999999"}}); res.Code != 101 {
+		t.Fatalf("presign too long %+v", res)
+	}
+	if res := callApi(t, "s3/presign", url.Values{"bucket": {"panel"}, "key": {"readme.md"}, "method": {"post"}}); res.Code != 102 {
+		t.Fatalf("presign post %+v", res)
+	}
+
+	if res := callApi(t, "s3/uploads", url.Values{"bucket": {"panel"}}); res.Code != 100 {
+		t.Fatalf("uploads %+v", res)
+	}
+	upload_id, _ := gw.CreateMultipartUpload("panel", "big.bin", "")
+	res = callApi(t, "s3/uploads", url.Values{"bucket": {"panel"}})
+	if uploads, _ := res.Result.([]interface{}); res.Code != 100 || len(uploads) != 1 {
+		t.Fatalf("uploads %+v", res)
+	}
+	if res := callApi(t, "s3/upload-abort", url.Values{"bucket": {"panel"}, "key": {"big.bin"}, "upload_id": {upload_id}}); res.Code != 100 {
+		t.Fatalf("upload-abort %+v", res)
+	}
+
+	if res := callApi(t, "s3/delete", url.Values{"bucket": {"panel"}, "key": {"readme.md"}}); res.Code != 100 {
+		t.Fatalf("delete %+v", res)
+	}
+	if res := callApi(t, "s3/head", url.Values{"bucket": {"panel"}, "key": {"readme.md"}}); res.Code != 102 {
+		t.Fatalf("head after delete %+v", res)
+	}
+}
+
+// 网关中途断开时下载连接被中断，客户端不能收到完整的响应
+func TestIS3_downloadAbort(t *testing.T) {
+	fake := ceph.NewFakeRadosGW("PANELKEY", "panelsecret")
+	fake.CreateBucket("admin", "panel")
+	gw := useRgw(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !strings.HasSuffix(r.URL.Path, "/big.bin") {
+			fake.ServeHTTP(w, r)
+			return
+		}
+		rec := httptest.NewRecorder()
+		fake.ServeHTTP(rec, r)
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes()[:rec.Body.Len()/2])
+		panic(http.ErrAbortHandler)
+	}))
+	data := strings.Repeat("ceph", 4096)
+	if _, err := gw.UploadObject("panel", "big.bin", strings.NewReader(data), int64(len(data)), "", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(apiRouter())
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/api/s3/download?bucket=panel&key=big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || err == nil || len(body) >= len(data) {
+		t.Fatalf("download completed %d %v %d", resp.StatusCode, err, len(body))
+	}
+}
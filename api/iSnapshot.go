@@ -0,0 +1,153 @@
+package api
+
+import (
+	"ceph-panel-go/ceph"
+	"ceph-panel-go/config"
+	"net/http"
+)
+
+const SNAPSHOT_READ_MAX = 4 << 20 // 单次读取上限
+
+// 存储池快照
+type ISnapshot struct {
+	ICeph
+}
+
+func NewISnapshot(config config.IConfig, w http.ResponseWriter, r *http.Request) *ISnapshot {
+	snapshot := &ISnapshot{
+		ICeph: *NewICeph(config, w, r),
+	}
+	snapshot.Module = "snapshot"
+	return snapshot
+}
+
+func (this *ISnapshot) List() {
+	pool := this.GetString("pool")
+	if pool == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rados, ok := this.openPool(pool)
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	snaps, err := rados.Rados_ioctx_snap_list()
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, snaps, "快照列表")
+}
+
+func (this *ISnapshot) Create() {
+	pool := this.PostString("pool")
+	snap := this.PostString("snap")
+	if pool == "" || snap == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rados, ok := this.openPool(pool)
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	if err := rados.Rados_ioctx_snap_create(snap); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, snap, "创建成功")
+}
+
+func (this *ISnapshot) Remove() {
+	pool := this.PostString("pool")
+	snap := this.PostString("snap")
+	if pool == "" || snap == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rados, ok := this.openPool(pool)
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	if err := rados.Rados_ioctx_snap_remove(snap); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, snap, "删除成功")
+}
+
+// 将对象回滚到快照
+func (this *ISnapshot) Rollback() {
+	pool := this.PostString("pool")
+	snap := this.PostString("snap")
+	object := this.PostString("object")
+	if pool == "" || snap == "" || object == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	rados, ok := this.openPool(pool)
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	if err := rados.Rados_ioctx_snap_rollback(snap, object); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, object, "回滚成功")
+}
+
+// 读取对象在快照中的数据
+func (this *ISnapshot) Read() {
+	pool := this.GetString("pool")
+	snap := this.GetString("snap")
+	object := this.GetString("object")
+	if pool == "" || snap == "" || object == "" {
+		this.ResponseWithHeader(101, "", "缺少数据")
+		return
+	}
+	offset := this.GetInt64("offset")
+	length := this.GetInt("length")
+	if offset < 0 || length < 0 {
+		this.ResponseWithHeader(101, "", "offset或length不能为负数")
+		return
+	}
+	if length == 0 || length > SNAPSHOT_READ_MAX {
+		length = SNAPSHOT_READ_MAX
+	}
+	rados, ok := this.openPool(pool)
+	if !ok {
+		return
+	}
+	defer rados.Rados_ioctx_destroy()
+
+	id, err := rados.Rados_ioctx_snap_lookup(snap)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	if err := rados.Rados_ioctx_snap_set_read(id); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	defer rados.Rados_ioctx_snap_set_read(ceph.SNAP_HEAD)
+
+	out, err := rados.Rados_Read(object, uint(length), uint64(offset))
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	result := map[string]interface{}{
+		"object": object,
+		"snap":   snap,
+		"offset": offset,
+		"data":   out.Bytes(),
+	}
+	this.ResponseWithHeader(100, result, "快照数据")
+}
@@ -0,0 +1,69 @@
+package api_test
+
+import (
+	"encoding/base64"
+	"net/url"
+	"testing"
+)
+
+func TestISnapshot(t *testing.T) {
+	newFakeCluster(t)
+	obj := url.Values{"pool": {"data"}, "object": {"obj"}}
+	s1 := url.Values{"pool": {"data"}, "snap": {"s1"}}
+
+	callApi(t, "object/write", with(obj, url.Values{"data": {"v1"}}))
+	if res := callApi(t, "snapshot/create", url.Values{"pool": {"data"}}); res.Code != 101 {
+		t.Fatalf("create without snap %+v", res)
+	}
+	if res := callApi(t, "snapshot/create", s1); res.Code != 100 {
+		t.Fatalf("create %+v", res)
+	}
+	if res := callApi(t, "snapshot/create", s1); res.Code != 102 {
+		t.Fatalf("create existing snap %+v", res)
+	}
+	if res := callApi(t, "snapshot/create", url.Values{"pool": {"nopool"}, "snap": {"s1"}}); res.Code != 102 {
+		t.Fatalf("create in unknown pool %+v", res)
+	}
+	callApi(t, "object/write", with(obj, url.Values{"data": {"v2"}}))
+
+	if res := callApi(t, "snapshot/list", url.Values{}); res.Code != 101 {
+		t.Fatalf("list without pool %+v", res)
+	}
+	res := callApi(t, "snapshot/list", url.Values{"pool": {"data"}})
+	snaps, _ := res.Result.([]interface{})
+	if res.Code != 100 || len(snaps) != 1 || snaps[0].(map[string]interface{})["name"] != "s1" {
+		t.Fatalf("list %+v", res)
+	}
+	res = callApi(t, "snapshot/read", with(obj, url.Values{"snap": {"s1"}}))
+	if res.Code != 100 || res.Result.(map[string]interface{})["data"] != base64.StdEncoding.EncodeToString([]byte("v1")) {
+		t.Fatalf("read %+v", res)
+	}
+
+	if res := callApi(t, "snapshot/rollback", s1); res.Code != 101 {
+		t.Fatalf("rollback without object %+v", res)
+	}
+	if res := callApi(t, "snapshot/rollback", with(obj, url.Values{"snap": {"s2"}})); res.Code != 102 {
+		t.Fatalf("rollback to unknown snap %+v", res)
+	}
+	if res := callApi(t, "snapshot/rollback", with(obj, url.Values{"snap": {"s1"}})); res.Code != 100 {
+		t.Fatalf("rollback %+v", res)
+	}
+	res = callApi(t, "object/read", obj)
+	if res.Code != 100 || res.Result.(map[string]interface{})["data"] != base64.StdEncoding.EncodeToString([]byte("v1")) {
+		t.Fatalf("read after rollback %+v", res)
+	}
+
+	if res := callApi(t, "snapshot/remove", url.Values{"pool": {"data"}}); res.Code != 101 {
+		t.Fatalf("remove without snap %+v", res)
+	}
+	if res := callApi(t, "snapshot/remove", s1); res.Code != 100 {
+		t.Fatalf("remove %+v", res)
+	}
+	if res := callApi(t, "snapshot/remove", s1); res.Code != 102 {
+		t.Fatalf("remove again %+v", res)
+	}
+	res = callApi(t, "snapshot/list", url.Values{"pool": {"data"}})
+	if snaps, _ := res.Result.([]interface{}); res.Code != 100 || len(snaps) != 0 {
+		t.Fatalf("list after remove %+v", res)
+	}
+}
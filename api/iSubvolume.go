@@ -0,0 +1,433 @@
+package api
+
+import (
+	"ceph-panel-go/ceph"
+	"ceph-panel-go/config"
+	"net/http"
+)
+
+// cephfs子卷及子卷组，fs参数选择文件系统，group为空时为默认组
+type ISubvolume struct {
+	ICeph
+	commander *ceph.Commander
+}
+
+func NewISubvolume(config config.IConfig, w http.ResponseWriter, r *http.Request) *ISubvolume {
+	subvolume := &ISubvolume{
+		ICeph: *NewICeph(config, w, r),
+	}
+	subvolume.Module = "subvolume"
+	return subvolume
+}
+
+// 文件系统名称，fs为空时使用第一个文件系统
+func (this *ISubvolume) volume() (string, bool) {
+	if !this.connected() {
+		return "", false
+	}
+	this.commander = ceph.NewCommander(this.Rados)
+	if fs := this.R.FormValue("fs"); fs != "" {
+		return fs, true
+	}
+	list, err := this.commander.FsList()
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return "", false
+	}
+	if len(list) == 0 {
+		this.ResponseWithHeader(102, "", "没有文件系统")
+		return "", false
+	}
+	return list[0].Name, true
+}
+
+// 配额大小，0或infinite为不限制
+func (this *ISubvolume) size(size string) (uint64, bool) {
+	if size == "" || size == "0" || size == "infinite" {
+		return 0, true
+	}
+	n, err := parseSize(size)
+	if err != nil {
+		this.ResponseWithHeader(101, "", err.Error())
+		return 0, false
+	}
+	return n, true
+}
+
+// 创建选项，mode为八进制
+func (this *ISubvolume) options() (ceph.FsSubvolumeOptions, bool) {
+	opts := ceph.FsSubvolumeOptions{
+		PoolLayout:        this.PostString("pool_layout"),
+		Mode:              this.PostString("mode"),
+		NamespaceIsolated: this.PostInt("namespace_isolated") == 1,
+	}
+	if _, err := parseMode(opts.Mode, 0); err != nil {
+		this.ResponseWithHeader(101, "", err.Error())
+		return opts, false
+	}
+	size, ok := this.size(this.PostString("size"))
+	opts.Size = size
+	return opts, ok
+}
+
+// 检查必填参数
+func (this *ISubvolume) required(values ...string) bool {
+	for _, value := range values {
+		if value == "" {
+			this.ResponseWithHeader(101, "", "缺少数据")
+			return false
+		}
+	}
+	return true
+}
+
+// 子卷组列表及详情
+func (this *ISubvolume) Groups() {
+	vol, ok := this.volume()
+	if !ok {
+		return
+	}
+	names, err := this.commander.FsSubvolumeGroupList(vol)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	groups := []ceph.FsSubvolumeGroupInfo{}
+	for _, name := range names {
+		info, err := this.commander.FsSubvolumeGroupInfo(vol, name)
+		if err != nil {
+			this.ResponseWithHeader(102, "", err.Error())
+			return
+		}
+		groups = append(groups, info)
+	}
+	this.ResponseWithHeader(100, groups, "子卷组列表")
+}
+
+func (this *ISubvolume) GroupInfo() {
+	group := this.GetString("group")
+	if !this.required(group) {
+		return
+	}
+	vol, ok := this.volume()
+	if !ok {
+		return
+	}
+	info, err := this.commander.FsSubvolumeGroupInfo(vol, group)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, info, "子卷组信息")
+}
+
+// size为配额，支持K/M/G等后缀
+func (this *ISubvolume) GroupCreate() {
+	group := this.PostString("group")
+	if !this.required(group) {
+		return
+	}
+	opts, ok := this.options()
+	if !ok {
+		return
+	}
+	vol, ok := this.volume()
+	if !ok {
+		return
+	}
+	// ceph中创建已存在的子卷组不报错
+	if _, err := this.commander.FsSubvolumeGroupInfo(vol, group); err == nil {
+		this.ResponseWithHeader(102, "", "子卷组已存在")
+		return
+	}
+	if err := this.commander.FsSubvolumeGroupCreate(vol, group, opts); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, group, "创建成功")
+}
+
+// 只能删除空的子卷组
+func (this *ISubvolume) GroupRemove() {
+	group := this.PostString("group")
+	if !this.required(group) {
+		return
+	}
+	vol, ok := this.volume()
+	if !ok {
+		return
+	}
+	if err := this.commander.FsSubvolumeGroupRemove(vol, group, this.PostInt("force") == 1); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, group, "删除成功")
+}
+
+// size为0或infinite时取消限制，no_shrink=1时不允许小于已使用量
+func (this *ISubvolume) GroupResize() {
+	group := this.PostString("group")
+	if !this.required(group, this.PostString("size")) {
+		return
+	}
+	size, ok := this.size(this.PostString("size"))
+	if !ok {
+		return
+	}
+	vol, ok := this.volume()
+	if !ok {
+		return
+	}
+	usage, err := this.commander.FsSubvolumeGroupResize(vol, group, size, this.PostInt("no_shrink") == 1)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, usage, "修改成功")
+}
+
+// 子卷的详情，克隆未完成时info失败，使用克隆状态
+func (this *ISubvolume) subvolumeInfo(vol string, name string, group string) (ceph.FsSubvolumeInfo, error) {
+	info, err := this.commander.FsSubvolumeInfo(vol, name, group)
+	if err == nil {
+		return info, nil
+	}
+	status, statusErr := this.commander.FsCloneStatus(vol, name, group)
+	if statusErr != nil {
+		return info, err
+	}
+	return ceph.FsSubvolumeInfo{Name: name, Group: group, Type: "clone", State: status.State}, nil
+}
+
+// 子卷列表及详情
+func (this *ISubvolume) List() {
+	group := this.GetString("group")
+	vol, ok := this.volume()
+	if !ok {
+		return
+	}
+	names, err := this.commander.FsSubvolumeList(vol, group)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	list := []ceph.FsSubvolumeInfo{}
+	for _, name := range names {
+		info, err := this.subvolumeInfo(vol, name, group)
+		if err != nil {
+			this.ResponseWithHeader(102, "", err.Error())
+			return
+		}
+		list = append(list, info)
+	}
+	this.ResponseWithHeader(100, list, "子卷列表")
+}
+
+func (this *ISubvolume) Info() {
+	name := this.GetString("name")
+	if !this.required(name) {
+		return
+	}
+	vol, ok := this.volume()
+	if !ok {
+		return
+	}
+	info, err := this.subvolumeInfo(vol, name, this.GetString("group"))
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, info, "子卷信息")
+}
+
+// 子卷在文件系统中的路径
+func (this *ISubvolume) Path() {
+	name := this.GetString("name")
+	if !this.required(name) {
+		return
+	}
+	vol, ok := this.volume()
+	if !ok {
+		return
+	}
+	path, err := this.commander.FsSubvolumeGetpath(vol, name, this.GetString("group"))
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, path, "子卷路径")
+}
+
+// namespace_isolated=1时使用独立的rados命名空间
+func (this *ISubvolume) Create() {
+	name, group := this.PostString("name"), this.PostString("group")
+	if !this.required(name) {
+		return
+	}
+	opts, ok := this.options()
+	if !ok {
+		return
+	}
+	vol, ok := this.volume()
+	if !ok {
+		return
+	}
+	// ceph中创建已存在的子卷不报错
+	if _, err := this.commander.FsSubvolumeGetpath(vol, name, group); err == nil {
+		this.ResponseWithHeader(102, "", "子卷已存在")
+		return
+	}
+	if err := this.commander.FsSubvolumeCreate(vol, name, group, opts); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, name, "创建成功")
+}
+
+// 有快照的子卷需先删除快照
+func (this *ISubvolume) Remove() {
+	name := this.PostString("name")
+	if !this.required(name) {
+		return
+	}
+	vol, ok := this.volume()
+	if !ok {
+		return
+	}
+	if err := this.commander.FsSubvolumeRemove(vol, name, this.PostString("group"), this.PostInt("force") == 1); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, name, "删除成功")
+}
+
+func (this *ISubvolume) Resize() {
+	name := this.PostString("name")
+	if !this.required(name, this.PostString("size")) {
+		return
+	}
+	size, ok := this.size(this.PostString("size"))
+	if !ok {
+		return
+	}
+	vol, ok := this.volume()
+	if !ok {
+		return
+	}
+	usage, err := this.commander.FsSubvolumeResize(vol, name, this.PostString("group"), size, this.PostInt("no_shrink") == 1)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, usage, "修改成功")
+}
+
+// 子卷的快照及详情
+func (this *ISubvolume) Snaps() {
+	name, group := this.GetString("name"), this.GetString("group")
+	if !this.required(name) {
+		return
+	}
+	vol, ok := this.volume()
+	if !ok {
+		return
+	}
+	names, err := this.commander.FsSubvolumeSnapshotList(vol, name, group)
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	snaps := []ceph.FsSubvolumeSnapshotInfo{}
+	for _, snap := range names {
+		info, err := this.commander.FsSubvolumeSnapshotInfo(vol, name, snap, group)
+		if err != nil {
+			this.ResponseWithHeader(102, "", err.Error())
+			return
+		}
+		snaps = append(snaps, info)
+	}
+	this.ResponseWithHeader(100, snaps, "快照列表")
+}
+
+func (this *ISubvolume) SnapCreate() {
+	name, snap := this.PostString("name"), this.PostString("snap")
+	if !this.required(name, snap) {
+		return
+	}
+	vol, ok := this.volume()
+	if !ok {
+		return
+	}
+	if err := this.commander.FsSubvolumeSnapshotCreate(vol, name, snap, this.PostString("group")); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, snap, "创建成功")
+}
+
+// 有未完成的克隆时不能删除
+func (this *ISubvolume) SnapRemove() {
+	name, snap := this.PostString("name"), this.PostString("snap")
+	if !this.required(name, snap) {
+		return
+	}
+	vol, ok := this.volume()
+	if !ok {
+		return
+	}
+	if err := this.commander.FsSubvolumeSnapshotRemove(vol, name, snap, this.PostString("group"), this.PostInt("force") == 1); err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, snap, "删除成功")
+}
+
+// 从快照克隆为新的子卷target，target_group为空时为默认组
+func (this *ISubvolume) Clone() {
+	name, snap, target := this.PostString("name"), this.PostString("snap"), this.PostString("target")
+	if !this.required(name, snap, target) {
+		return
+	}
+	vol, ok := this.volume()
+	if !ok {
+		return
+	}
+	err := this.commander.FsSubvolumeSnapshotClone(vol, name, snap, this.PostString("group"),
+		target, this.PostString("target_group"), this.PostString("pool_layout"))
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, target, "克隆已开始")
+}
+
+// 子卷组中由克隆创建的子卷
+func (this *ISubvolume) Clones() {
+	vol, ok := this.volume()
+	if !ok {
+		return
+	}
+	clones, err := this.commander.FsCloneList(vol, this.GetString("group"))
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, clones, "克隆列表")
+}
+
+func (this *ISubvolume) CloneStatus() {
+	name := this.GetString("name")
+	if !this.required(name) {
+		return
+	}
+	vol, ok := this.volume()
+	if !ok {
+		return
+	}
+	status, err := this.commander.FsCloneStatus(vol, name, this.GetString("group"))
+	if err != nil {
+		this.ResponseWithHeader(102, "", err.Error())
+		return
+	}
+	this.ResponseWithHeader(100, status, "克隆状态")
+}
@@ -0,0 +1,93 @@
+package api_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestISubvolume(t *testing.T) {
+	newFakeCluster(t)
+
+	if res := callApi(t, "subvolume/group-create", url.Values{}); res.Code != 101 {
+		t.Fatalf("group-create without group %+v", res)
+	}
+	if res := callApi(t, "subvolume/group-create", url.Values{"group": {"csi"}, "size": {"1G"}}); res.Code != 100 {
+		t.Fatalf("group-create %+v", res)
+	}
+	if res := callApi(t, "subvolume/group-create", url.Values{"group": {"csi"}}); res.Code != 102 {
+		t.Fatalf("group-create existing %+v", res)
+	}
+	res := callApi(t, "subvolume/groups", url.Values{})
+	groups, _ := res.Result.([]interface{})
+	if res.Code != 100 || len(groups) != 1 || groups[0].(map[string]interface{})["bytes_quota"].(float64) != 1<<30 {
+		t.Fatalf("groups %+v", res)
+	}
+	if res := callApi(t, "subvolume/group-resize", url.Values{"group": {"csi"}, "size": {"infinite"}}); res.Code != 100 {
+		t.Fatalf("group-resize %+v", res)
+	}
+
+	if res := callApi(t, "subvolume/create", url.Values{"name": {"pvc-1"}, "group": {"csi"}, "size": {"bad"}}); res.Code != 101 {
+		t.Fatalf("create with invalid size %+v", res)
+	}
+	if res := callApi(t, "subvolume/create", url.Values{"name": {"pvc-1"}, "group": {"csi"}, "size": {"10M"}, "mode": {"770"}}); res.Code != 100 {
+		t.Fatalf("create %+v", res)
+	}
+	if res := callApi(t, "subvolume/create", url.Values{"name": {"pvc-1"}, "group": {"csi"}}); res.Code != 102 {
+		t.Fatalf("create existing %+v", res)
+	}
+	res = callApi(t, "subvolume/list", url.Values{"group": {"csi"}})
+	list, _ := res.Result.([]interface{})
+	if res.Code != 100 || len(list) != 1 {
+		t.Fatalf("list %+v", res)
+	}
+	info := list[0].(map[string]interface{})
+	if info["name"] != "pvc-1" || info["bytes_quota"].(float64) != 10<<20 || info["mode"].(float64) != 0770 {
+		t.Fatalf("subvolume info %+v", info)
+	}
+	res = callApi(t, "subvolume/path", url.Values{"name": {"pvc-1"}, "group": {"csi"}})
+	if res.Code != 100 || !strings.HasPrefix(res.Result.(string), "/volumes/csi/pvc-1/") {
+		t.Fatalf("path %+v", res)
+	}
+	if res := callApi(t, "subvolume/resize", url.Values{"name": {"pvc-1"}, "group": {"csi"}, "size": {"20M"}}); res.Code != 100 {
+		t.Fatalf("resize %+v", res)
+	}
+
+	if res := callApi(t, "subvolume/snap-create", url.Values{"name": {"pvc-1"}, "group": {"csi"}, "snap": {"s1"}}); res.Code != 100 {
+		t.Fatalf("snap-create %+v", res)
+	}
+	res = callApi(t, "subvolume/snaps", url.Values{"name": {"pvc-1"}, "group": {"csi"}})
+	if snaps, _ := res.Result.([]interface{}); res.Code != 100 || len(snaps) != 1 {
+		t.Fatalf("snaps %+v", res)
+	}
+	if res := callApi(t, "subvolume/clone", url.Values{"name": {"pvc-1"}, "group": {"csi"}, "snap": {"s1"}}); res.Code != 101 {
+		t.Fatalf("clone without target %+v", res)
+	}
+	if res := callApi(t, "subvolume/clone", url.Values{"name": {"pvc-1"}, "group": {"csi"}, "snap": {"s1"}, "target": {"pvc-2"}, "target_group": {"csi"}}); res.Code != 100 {
+		t.Fatalf("clone %+v", res)
+	}
+	res = callApi(t, "subvolume/clone-status", url.Values{"name": {"pvc-2"}, "group": {"csi"}})
+	if res.Code != 100 || res.Result.(map[string]interface{})["state"] != "complete" {
+		t.Fatalf("clone-status %+v", res)
+	}
+	res = callApi(t, "subvolume/clones", url.Values{"group": {"csi"}})
+	if clones, _ := res.Result.([]interface{}); res.Code != 100 || len(clones) != 1 {
+		t.Fatalf("clones %+v", res)
+	}
+
+	if res := callApi(t, "subvolume/remove", url.Values{"name": {"pvc-1"}, "group": {"csi"}}); res.Code != 102 {
+		t.Fatalf("remove with snapshots %+v", res)
+	}
+	callApi(t, "subvolume/snap-remove", url.Values{"name": {"pvc-1"}, "group": {"csi"}, "snap": {"s1"}})
+	for _, name := range []string{"pvc-1", "pvc-2"} {
+		if res := callApi(t, "subvolume/remove", url.Values{"name": {name}, "group": {"csi"}}); res.Code != 100 {
+			t.Fatalf("remove %s %+v", name, res)
+		}
+	}
+	if res := callApi(t, "subvolume/group-remove", url.Values{"group": {"csi"}}); res.Code != 100 {
+		t.Fatalf("group-remove %+v", res)
+	}
+	if res := callApi(t, "subvolume/groups", url.Values{"fs": {"nofs"}}); res.Code != 102 {
+		t.Fatalf("groups of unknown filesystem %+v", res)
+	}
+}
@@ -0,0 +1,103 @@
+package api_test
+
+import (
+	"ceph-panel-go/ceph"
+	"ceph-panel-go/config"
+	"ceph-panel-go/middleware"
+	"ceph-panel-go/router"
+	"ceph-panel-go/template"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// api测试经由真实路由分发请求，与线上注册的action保持一致
+var apiRouter = sync.OnceValue(func() http.Handler {
+	if middleware.Logger == nil {
+		middleware.Logger = middleware.NewLogger()
+	}
+	r := router.NewRouter(config.NewConfigYaml(), middleware.Logger)
+	router.RegisterApi(r)
+	r.Router.Use(middleware.SafeHandler)
+	return r.Router
+})
+
+// 替换全局连接管理器，测试结束后恢复
+func useCluster(t *testing.T, cluster ceph.ClusterConfig) ceph.LibRados {
+	manager, err := ceph.NewClusterManager([]ceph.ClusterConfig{cluster}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clusters := ceph.Clusters
+	ceph.Clusters = manager
+	t.Cleanup(func() {
+		ceph.Clusters = clusters
+		manager.Close()
+	})
+	rados, err := manager.Get("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rados
+}
+
+// 每个测试使用独立的fake集群，返回的句柄与路由中的请求共用
+func newFakeCluster(t *testing.T) ceph.LibRados {
+	return useCluster(t, ceph.ClusterConfig{Name: "fake", Backend: ceph.BACKEND_FAKE, ClusterName: "ceph", UserName: "client.admin"})
+}
+
+// fake集群并配置fake对象存储网关
+func newFakeRgw(t *testing.T) ceph.RadosGW {
+	fake := ceph.NewFakeRadosGW("PANELKEY", "panelsecret")
+	fake.CreateBucket("admin", "panel")
+	return useRgw(t, fake)
+}
+
+// 以handler作为集群的对象存储网关
+func useRgw(t *testing.T, handler http.Handler) ceph.RadosGW {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	useCluster(t, ceph.ClusterConfig{
+		Name:    "fake",
+		Backend: ceph.BACKEND_FAKE,
+		Rgw:     ceph.RgwConfig{Endpoint: server.URL, AccessKey: "PANELKEY", SecretKey: "panelsecret"},
+	})
+	gw, err := ceph.Clusters.RadosGW("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gw
+}
+
+func serveApi(r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	apiRouter().ServeHTTP(w, r)
+	return w
+}
+
+// 以原始请求体调用，path为"模块/action"
+func streamApi(method string, path string, query url.Values, body io.Reader) *httptest.ResponseRecorder {
+	return serveApi(httptest.NewRequest(method, "/api/"+path+"?"+query.Encode(), body))
+}
+
+func decodeApi(t *testing.T, w *httptest.ResponseRecorder) template.ResponseData {
+	t.Helper()
+	data := template.ResponseData{}
+	if err := json.Unmarshal(w.Body.Bytes(), &data); err != nil {
+		t.Fatalf("%v %d %s", err, w.Code, w.Body.String())
+	}
+	return data
+}
+
+// 以表单提交调用action并解析返回结果，path为"模块/action"
+func callApi(t *testing.T, path string, form url.Values) template.ResponseData {
+	t.Helper()
+	r := httptest.NewRequest("POST", "/api/"+path+"?"+form.Encode(), strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return decodeApi(t, serveApi(r))
+}
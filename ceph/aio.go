@@ -0,0 +1,124 @@
+package ceph
+
+// 异步IO
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// 一个异步IO操作，由Rados_aio_*返回，使用完毕需调用Release
+type AioFuture struct {
+	op     string
+	object string
+
+	complete chan struct{} // 读取完成或数据已写入所有副本的内存
+	safe     chan struct{} // 数据已落盘
+
+	lock     sync.Mutex
+	ret      int
+	data     []byte
+	finished bool
+	released bool
+	once     sync.Once
+	release  func() // 释放后端资源，操作结束且调用方Release后执行
+}
+
+func newAioFuture(op string, object_name string, release func()) *AioFuture {
+	return &AioFuture{
+		op:       op,
+		object:   object_name,
+		complete: make(chan struct{}),
+		safe:     make(chan struct{}),
+		release:  release,
+	}
+}
+
+// 由后端在操作完成时调用，ret为librados的返回值
+func (f *AioFuture) setComplete(ret int, data []byte) {
+	f.lock.Lock()
+	f.ret = ret
+	f.data = data
+	f.lock.Unlock()
+	close(f.complete)
+}
+
+// 由后端在数据落盘时调用，之后不再有回调
+func (f *AioFuture) setSafe() {
+	close(f.safe)
+	f.lock.Lock()
+	f.finished = true
+	released := f.released
+	f.lock.Unlock()
+	if released {
+		f.free()
+	}
+}
+
+func (f *AioFuture) free() {
+	f.once.Do(func() {
+		if f.release != nil {
+			f.release()
+		}
+	})
+}
+
+func (f *AioFuture) Complete() <-chan struct{} {
+	return f.complete
+}
+
+func (f *AioFuture) Safe() <-chan struct{} {
+	return f.safe
+}
+
+// 等待操作落盘，ctx结束时返回ctx的错误，操作本身不会被取消
+func (f *AioFuture) Wait(ctx context.Context) error {
+	select {
+	case <-f.safe:
+		return f.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 操作的错误，未完成时返回nil
+func (f *AioFuture) Err() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.ret < 0 {
+		return errors.New("aio " + f.op + " object[" + f.object + "] fail " + fmt.Sprintf("%v", f.ret))
+	}
+	return nil
+}
+
+// 读取到的数据，需在Complete之后调用
+func (f *AioFuture) Data() []byte {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.data
+}
+
+// 释放操作占用的资源，可以在操作完成前调用
+func (f *AioFuture) Release() {
+	f.lock.Lock()
+	f.released = true
+	finished := f.finished
+	f.lock.Unlock()
+	if finished {
+		f.free()
+	}
+}
+
+// 等待所有操作落盘并释放，返回第一个错误
+func AioWaitAll(ctx context.Context, futures ...*AioFuture) error {
+	var first error
+	for _, f := range futures {
+		if err := f.Wait(ctx); err != nil && first == nil {
+			first = err
+		}
+		f.Release()
+	}
+	return first
+}
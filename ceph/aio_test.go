@@ -0,0 +1,89 @@
+package ceph
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAioFuture_release(t *testing.T) {
+	released := 0
+	future := newAioFuture("write", "obj", func() { released++ })
+	// 操作完成前Release，资源在落盘后释放
+	future.Release()
+	if released != 0 {
+		t.Fatal("released before the operation finished")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := future.Wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("wait %v", err)
+	}
+	future.setComplete(-5, nil)
+	select {
+	case <-future.Complete():
+	default:
+		t.Fatal("expected complete")
+	}
+	future.setSafe()
+	if released != 1 {
+		t.Fatalf("released %d times", released)
+	}
+	future.Release()
+	if released != 1 {
+		t.Fatalf("released %d times", released)
+	}
+	if err := future.Wait(context.Background()); err == nil {
+		t.Fatal("expected the operation error")
+	}
+}
+
+func TestFakeRados_aio(t *testing.T) {
+	rados := newConnectedFake(t)
+	if _, err := rados.Rados_aio_write("obj", []byte("x"), 0); err == nil {
+		t.Fatal("expected aio without io context to fail")
+	}
+	if err := rados.Rados_ioctx_create("data"); err != nil {
+		t.Fatal(err)
+	}
+	futures := []*AioFuture{}
+	for i := 0; i < 8; i++ {
+		future, err := rados.Rados_aio_write_full(fmt.Sprintf("obj%d", i), []byte("data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		futures = append(futures, future)
+	}
+	append1, err := rados.Rados_aio_append("obj0", []byte("+"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	futures = append(futures, append1)
+	if err := AioWaitAll(context.Background(), futures...); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := rados.Rados_aio_read("obj0", 16, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer read.Release()
+	if err := read.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if string(read.Data()) != "data+" {
+		t.Fatalf("read %q", read.Data())
+	}
+
+	remove, err := rados.Rados_aio_remove("missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := AioWaitAll(context.Background(), remove); err == nil {
+		t.Fatal("expected removing a missing object to fail")
+	}
+	if err := rados.Rados_aio_flush(); err != nil {
+		t.Fatal(err)
+	}
+}
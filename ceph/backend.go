@@ -0,0 +1,247 @@
+package ceph
+
+// 集群后端
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ceph-panel-go/config"
+	"ceph-panel-go/exception"
+	"ceph-panel-go/middleware"
+)
+
+const (
+	BACKEND_RADOS = "rados" // librados，需要以 -tags rados 编译
+	BACKEND_FAKE  = "fake"  // 内存模拟集群，无需安装ceph
+)
+
+// 快照读取时表示读取最新数据，与LIBRADOS_SNAP_HEAD一致
+const SNAP_HEAD uint64 = 0xfffffffffffffffe
+
+// 集群后端需要实现的接口，不包含任何cgo类型
+type LibRados interface {
+	// setup and teardown
+	Rados_create2(flags uint64) error
+	Rados_create() error
+	//Rados_ping_monitor(monId string, out *bytes.Buffer) error
+	Rados_connect() error
+	Rados_shutdown()
+	Rados_clone() LibRados // 共享集群连接，拥有独立的io上下文
+
+	// configure
+	Rados_conf_read_file(path string) error
+	Rados_conf_set(option string, value string) error
+
+	// Objects，命名空间对之后的对象操作生效
+	Rados_ioctx_set_namespace(nspace string)
+	Rados_nobjects_list(cursor string, max int) (page ObjectListPage, err error)
+	Rados_write_full(object_name string, value []byte) error
+	Rados_write(key string, value []byte, offset uint) error
+	Rados_append(object_name string, value []byte) error
+	Rados_Read(key string, size uint, offset uint64) (out bytes.Buffer, err error)
+	Rados_stat(object_name string) (stat ObjectStat, err error)
+	Rados_remove(object_name string) error
+
+	// 扩展属性
+	Rados_setxattr(object_name string, attr_name string, value []byte) error
+	Rados_getxattr(object_name string, attr_name string) (value []byte, err error)
+	Rados_getxattrs(object_name string) (attrs []XattrEntry, err error)
+	Rados_rmxattr(object_name string, attr_name string) error
+
+	// Omap，librados的C接口不支持omap header，rados后端的header操作返回错误
+	Rados_omap_get_vals(object_name string, start_after string, prefix string, max int) (page OmapPage, err error)
+	Rados_omap_set(object_name string, vals []OmapEntry) error
+	Rados_omap_rm_keys(object_name string, keys []string) error
+	Rados_omap_clear(object_name string) error
+	Rados_omap_get_header(object_name string) (header []byte, err error)
+	Rados_omap_set_header(object_name string, header []byte) error
+
+	// 异步IO，每个操作返回独立的AioFuture，可以同时提交多个操作
+	Rados_aio_write(object_name string, value []byte, offset uint64) (*AioFuture, error)
+	Rados_aio_write_full(object_name string, value []byte) (*AioFuture, error)
+	Rados_aio_append(object_name string, value []byte) (*AioFuture, error)
+	Rados_aio_read(object_name string, size uint, offset uint64) (*AioFuture, error)
+	Rados_aio_remove(object_name string) (*AioFuture, error)
+	Rados_aio_flush() error // 等待已提交的异步写入全部落盘
+
+	// Mon/OSD/PG commands，cmd为json格式，见NewCommand，outs为状态信息
+	Rados_mon_command(cmd string, params []byte) (out []byte, outs string, err error)
+	Rados_mgr_command(cmd string, params []byte) (out []byte, outs string, err error)
+	Rados_osd_command(osdId int, cmd string, params []byte) (out []byte, outs string, err error)
+	Rados_pg_command(pgstr string, cmd string, params []byte) (out []byte, outs string, err error)
+	Rados_pg_inconsistent_objects(pgstr string) (objects []InconsistentObject, err error) // 最近一次deep-scrub的结果，rados后端通过C++接口获取
+	Rados_monitor_log() error
+	Rados_monitor_log2() error
+
+	// Pools
+	Rados_pool_list() (pools []Pool, err error)
+	Rados_pool_create(pool_name string, opts PoolCreateOptions) error
+	Rados_pool_delete(pool_name string, confirm string) error
+	Rados_pool_get_quota(pool_name string) (quota PoolQuota, err error)
+	Rados_pool_set_quota(pool_name string, quota PoolQuota) error
+	Rados_pool_stat(pool_name string) (stat PoolStat, err error)
+	Rados_ioctx_create(pool_name string) error
+	Rados_ioctx_destroy()
+
+	// Snapshots
+	Rados_ioctx_snap_create(snapname string) error
+	Rados_ioctx_snap_remove(snapname string) error
+	Rados_ioctx_snap_rollback(snapname string, key string) error
+	Rados_rollback(snapname string, key string) error
+	Rados_ioctx_snap_set_read(snap uint64) error
+	Rados_ioctx_snap_lookup(snapname string) (uint64, error)
+	Rados_ioctx_snap_list() (snaps []PoolSnap, err error)
+
+	// Functions
+	Rados_cluster_stat() (stat ClusterStat, err error)
+	Rados_version() (major int, minor int, extra int)
+
+	// 建议锁，对象不存在时加锁会创建对象
+	Rados_lock_exclusive(object_name string, lock_name string, opts LockOptions) error
+	Rados_lock_shared(object_name string, lock_name string, opts LockOptions) error
+	Rados_unlock(object_name string, lock_name string, cookie string) error
+	Rados_list_locks(object_name string) (names []string, err error)
+	Rados_list_lockers(object_name string, lock_name string) (info LockInfo, err error)
+	Rados_break_lock(object_name string, lock_name string, client string, cookie string) error
+}
+
+// 后端构造函数
+type BackendFunc func(cluster_name string, user_name string) LibRados
+
+var (
+	backends    = map[string]BackendFunc{}
+	backendLock sync.RWMutex
+)
+
+// 注册后端，同名后端会被覆盖
+func RegisterBackend(name string, f BackendFunc) {
+	backendLock.Lock()
+	defer backendLock.Unlock()
+	backends[name] = f
+}
+
+// 已注册的后端名称
+func Backends() []string {
+	backendLock.RLock()
+	defer backendLock.RUnlock()
+	names := []string{}
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func backend(name string) (BackendFunc, error) {
+	backendLock.RLock()
+	f, ok := backends[name]
+	backendLock.RUnlock()
+	if !ok {
+		if name == BACKEND_RADOS {
+			return nil, errors.New("backend[" + name + "] is not compiled in, build with -tags rados or set ceph.backend to fake")
+		}
+		return nil, errors.New("backend[" + name + "] is not registered")
+	}
+	return f, nil
+}
+
+func NewBackend(name string, cluster_name string, user_name string) (LibRados, error) {
+	f, err := backend(name)
+	if err != nil {
+		return nil, err
+	}
+	return f(cluster_name, user_name), nil
+}
+
+type RadosDriver struct {
+	Clusters    []ClusterConfig
+	Default     string
+	HealthCheck time.Duration
+}
+
+// 未配置clusters时，以单集群配置作为唯一的集群，名称为集群名
+func NewRados(config config.IConfig) *RadosDriver {
+	ceph := config.GetConfigData().Ceph
+	driver := &RadosDriver{
+		Default:     ceph.Default,
+		HealthCheck: time.Duration(ceph.HealthCheck) * time.Second,
+	}
+	for _, c := range ceph.Clusters {
+		driver.Clusters = append(driver.Clusters, clusterDefaults(ClusterConfig{
+			Name:        c.Name,
+			Backend:     c.Backend,
+			ClusterName: c.ClusterName,
+			UserName:    c.UserName,
+			ConfPath:    c.ConfPath,
+			Keyring:     c.Keyring,
+			MonHost:     c.MonHost,
+			Rgw:         rgwConfig(c.Rgw),
+		}))
+	}
+	if len(driver.Clusters) == 0 {
+		single := clusterDefaults(ClusterConfig{
+			Backend:     ceph.Backend,
+			ClusterName: ceph.ClusterName,
+			UserName:    ceph.UserName,
+			ConfPath:    ceph.ConfPath,
+			Keyring:     ceph.Keyring,
+			MonHost:     ceph.MonHost,
+			Rgw:         rgwConfig(ceph.Rgw),
+		})
+		single.Name = single.ClusterName
+		driver.Clusters = append(driver.Clusters, single)
+	}
+	return driver
+}
+
+func rgwConfig(c config.CephRgw) RgwConfig {
+	return RgwConfig{
+		Endpoint:  c.Endpoint,
+		AccessKey: c.AccessKey,
+		SecretKey: c.SecretKey,
+		Signature: c.Signature,
+		Region:    c.Region,
+	}
+}
+
+func clusterDefaults(c ClusterConfig) ClusterConfig {
+	if c.Backend == "" {
+		c.Backend = BACKEND_RADOS
+	}
+	if c.ClusterName == "" {
+		c.ClusterName = "ceph"
+	}
+	if c.UserName == "" {
+		c.UserName = "client.admin"
+	}
+	return c
+}
+
+// error code 5000 ~ 5100
+// 集群在第一次使用时连接，默认集群在启动时尝试连接以便尽早发现配置错误
+// 配置的后端未编译时退出
+func (d *RadosDriver) Init() {
+	for _, c := range d.Clusters {
+		if _, err := backend(c.Backend); err != nil {
+			exception.CheckError(errors.New("ceph cluster["+c.Name+"] "+err.Error()), -1)
+			return
+		}
+	}
+	manager, err := NewClusterManager(d.Clusters, d.Default)
+	if err != nil {
+		exception.CheckError(err, 5000)
+		return
+	}
+	Clusters = manager
+	go manager.HealthCheck(d.HealthCheck)
+
+	if _, err := manager.Get(""); err != nil {
+		exception.CheckError(err, 5001)
+	}
+	middleware.Logger.Logger.Info("init ceph clusters " + strings.Join(manager.Names(), ",") + "...")
+}
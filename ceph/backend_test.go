@@ -0,0 +1,25 @@
+package ceph
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewBackend(t *testing.T) {
+	rados, err := NewBackend(BACKEND_FAKE, "ceph", "client.admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rados.(*fakeRados); !ok {
+		t.Fatalf("unexpected backend %T", rados)
+	}
+	if _, err := NewBackend("unknown", "ceph", "client.admin"); err == nil {
+		t.Fatal("expected error for unregistered backend")
+	}
+	// 未以-tags rados编译时提示缺少的编译标签
+	if _, ok := backends[BACKEND_RADOS]; !ok {
+		if _, err := NewBackend(BACKEND_RADOS, "ceph", "client.admin"); err == nil || !strings.Contains(err.Error(), "-tags rados") {
+			t.Fatalf("rados backend without tag %v", err)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package ceph
+
+// 文件系统的配额、布局和快照，通过虚拟扩展属性和.snap目录管理
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CEPHFS_SNAP_DIR = ".snap" // 目录快照的虚拟目录
+
+	CEPHFS_LAYOUT_UNIT = 64 << 10 // stripe_unit需为64KiB的整数倍
+
+	errENODATA = -61
+)
+
+// 从错误信息末尾取出errno，没有时返回0
+func errnoOf(err error) int {
+	if err == nil {
+		return 0
+	}
+	msg := err.Error()
+	errno, e := strconv.Atoi(msg[strings.LastIndex(msg, " ")+1:])
+	if e != nil || errno >= 0 {
+		return 0
+	}
+	return errno
+}
+
+// 读取数值属性，属性不存在时ok为false
+func getxattrUint(fs Libcephfs, p string, name string) (value uint64, ok bool, err error) {
+	data, err := fs.Ceph_getxattr(p, name)
+	if errnoOf(err) == errENODATA {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	value, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, false, errors.New("invalid value of " + name + " on [" + p + "] " + string(data))
+	}
+	return value, true, nil
+}
+
+// 目录配额及已使用量，0表示不限制
+type CephfsQuota struct {
+	MaxBytes  uint64 `json:"max_bytes"`
+	MaxFiles  uint64 `json:"max_files"`
+	UsedBytes uint64 `json:"used_bytes"` // ceph.dir.rbytes
+	UsedFiles uint64 `json:"used_files"` // ceph.dir.rentries，包括子目录
+}
+
+func GetCephfsQuota(fs Libcephfs, dir string) (quota CephfsQuota, err error) {
+	fields := []struct {
+		name  string
+		value *uint64
+	}{
+		{"ceph.quota.max_bytes", &quota.MaxBytes},
+		{"ceph.quota.max_files", &quota.MaxFiles},
+		{"ceph.dir.rbytes", &quota.UsedBytes},
+		{"ceph.dir.rentries", &quota.UsedFiles},
+	}
+	for _, field := range fields {
+		if *field.value, _, err = getxattrUint(fs, dir, field.name); err != nil {
+			return quota, err
+		}
+	}
+	return quota, nil
+}
+
+// 设置目录配额，0表示取消限制
+func SetCephfsQuota(fs Libcephfs, dir string, max_bytes uint64, max_files uint64) error {
+	if err := fs.Ceph_setxattr(dir, "ceph.quota.max_bytes", []byte(strconv.FormatUint(max_bytes, 10))); err != nil {
+		return err
+	}
+	return fs.Ceph_setxattr(dir, "ceph.quota.max_files", []byte(strconv.FormatUint(max_files, 10)))
+}
+
+// 文件布局，决定文件数据在rados对象中的分布
+type CephfsLayout struct {
+	Pool          string `json:"pool"`
+	PoolNamespace string `json:"pool_namespace"`
+	StripeUnit    uint64 `json:"stripe_unit"`
+	StripeCount   uint64 `json:"stripe_count"`
+	ObjectSize    uint64 `json:"object_size"`
+	Inherited     string `json:"inherited"` // 目录未设置布局时为布局所在的上级目录
+}
+
+func (l CephfsLayout) check() error {
+	if l.StripeUnit == 0 || l.StripeUnit%CEPHFS_LAYOUT_UNIT != 0 {
+		return errors.New("stripe_unit must be a multiple of 65536")
+	}
+	if l.StripeCount == 0 {
+		return errors.New("stripe_count must be positive")
+	}
+	if l.ObjectSize == 0 || l.ObjectSize%l.StripeUnit != 0 {
+		return errors.New("object_size must be a multiple of stripe_unit")
+	}
+	if l.Pool == "" {
+		return errors.New("pool is empty")
+	}
+	return nil
+}
+
+// ceph.dir.layout的格式
+func (l CephfsLayout) xattr() string {
+	value := fmt.Sprintf("stripe_unit=%d stripe_count=%d object_size=%d pool=%s", l.StripeUnit, l.StripeCount, l.ObjectSize, l.Pool)
+	if l.PoolNamespace != "" {
+		value += " pool_namespace=" + l.PoolNamespace
+	}
+	return value
+}
+
+// 解析key=value格式的布局，未出现的字段保留base的值
+func parseCephfsLayout(value string, base CephfsLayout) (CephfsLayout, error) {
+	for _, field := range strings.Fields(value) {
+		i := strings.Index(field, "=")
+		if i < 0 {
+			return base, errors.New("invalid layout field " + field)
+		}
+		if err := base.set(field[:i], field[i+1:]); err != nil {
+			return base, err
+		}
+	}
+	return base, nil
+}
+
+func (l *CephfsLayout) set(key string, value string) error {
+	switch key {
+	case "pool":
+		l.Pool = value
+		return nil
+	case "pool_namespace":
+		l.PoolNamespace = value
+		return nil
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return errors.New("invalid layout " + key + "=" + value)
+	}
+	switch key {
+	case "stripe_unit":
+		l.StripeUnit = n
+	case "stripe_count":
+		l.StripeCount = n
+	case "object_size":
+		l.ObjectSize = n
+	default:
+		return errors.New("unknown layout field " + key)
+	}
+	return nil
+}
+
+func layoutPrefix(stat CephfsStat) string {
+	if stat.IsDir() {
+		return "ceph.dir.layout"
+	}
+	return "ceph.file.layout"
+}
+
+// 文件或目录的布局，目录未设置时返回继承的布局
+func GetCephfsLayout(fs Libcephfs, p string) (CephfsLayout, error) {
+	stat, err := fs.Ceph_stat(p)
+	if err != nil {
+		return CephfsLayout{}, err
+	}
+	prefix := layoutPrefix(stat)
+	for cur := p; ; cur = path.Dir(cur) {
+		value, err := fs.Ceph_getxattr(cur, prefix)
+		if err == nil {
+			layout, err := parseCephfsLayout(string(value), CephfsLayout{})
+			if cur != p {
+				layout.Inherited = cur
+			}
+			return layout, err
+		}
+		if errnoOf(err) != errENODATA || !stat.IsDir() || cur == "/" {
+			return CephfsLayout{}, err
+		}
+	}
+}
+
+// 修改布局，layout中为空的字段保持不变，文件只能在为空时修改
+func SetCephfsLayout(fs Libcephfs, p string, layout CephfsLayout) error {
+	stat, err := fs.Ceph_stat(p)
+	if err != nil {
+		return err
+	}
+	cur, err := GetCephfsLayout(fs, p)
+	if err != nil {
+		return err
+	}
+	if layout.Pool != "" {
+		cur.Pool = layout.Pool
+	}
+	if layout.PoolNamespace != "" {
+		cur.PoolNamespace = layout.PoolNamespace
+	}
+	if layout.StripeUnit > 0 {
+		cur.StripeUnit = layout.StripeUnit
+	}
+	if layout.StripeCount > 0 {
+		cur.StripeCount = layout.StripeCount
+	}
+	if layout.ObjectSize > 0 {
+		cur.ObjectSize = layout.ObjectSize
+	}
+	if err := cur.check(); err != nil {
+		return errors.New("cannot set layout of [" + p + "] " + err.Error())
+	}
+	return fs.Ceph_setxattr(p, layoutPrefix(stat), []byte(cur.xattr()))
+}
+
+// 删除目录的布局，之后继承上级目录的布局
+func RemoveCephfsLayout(fs Libcephfs, dir string) error {
+	return fs.Ceph_removexattr(dir, "ceph.dir.layout")
+}
+
+type CephfsSnap struct {
+	Name      string    `json:"name"`
+	Ctime     time.Time `json:"ctime"`
+	Inherited bool      `json:"inherited"` // 上级目录的快照，名称为_快照名_上级目录inode
+}
+
+func checkCephfsSnapName(snap_name string) error {
+	if err := checkSnapName(snap_name); err != nil {
+		return err
+	}
+	if strings.HasPrefix(snap_name, "_") || snap_name == "." || snap_name == ".." {
+		return errors.New("snapshot name[" + snap_name + "] cannot start with _ or be . or ..")
+	}
+	return nil
+}
+
+// 目录的快照，包括上级目录的快照
+func CephfsSnapList(fs Libcephfs, dir string) ([]CephfsSnap, error) {
+	entries, err := fs.Ceph_listdir(path.Join(dir, CEPHFS_SNAP_DIR))
+	if err != nil {
+		return nil, err
+	}
+	snaps := make([]CephfsSnap, 0, len(entries))
+	for _, entry := range entries {
+		snaps = append(snaps, CephfsSnap{
+			Name:      entry.Name,
+			Ctime:     entry.Ctime,
+			Inherited: strings.HasPrefix(entry.Name, "_"),
+		})
+	}
+	return snaps, nil
+}
+
+// 在.snap下创建目录即创建快照
+func CephfsSnapCreate(fs Libcephfs, dir string, snap_name string) error {
+	if err := checkCephfsSnapName(snap_name); err != nil {
+		return errors.New("cannot create snapshot of [" + dir + "] " + err.Error())
+	}
+	return fs.Ceph_mkdir(path.Join(dir, CEPHFS_SNAP_DIR, snap_name), CEPHFS_DEFAULT_DIR_MODE)
+}
+
+func CephfsSnapRemove(fs Libcephfs, dir string, snap_name string) error {
+	if err := checkCephfsSnapName(snap_name); err != nil {
+		return errors.New("cannot remove snapshot of [" + dir + "] " + err.Error())
+	}
+	return fs.Ceph_rmdir(path.Join(dir, CEPHFS_SNAP_DIR, snap_name))
+}
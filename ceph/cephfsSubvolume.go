@@ -0,0 +1,372 @@
+package ceph
+
+// 文件系统的子卷及子卷组，通过mgr的volumes模块(fs subvolume命令)管理
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const FS_SUBVOLUME_NOGROUP = "_nogroup" // 未指定子卷组时子卷所在的默认组
+
+// 配额字节数，ceph中未设置时为"infinite"，转换为0
+type FsQuotaBytes uint64
+
+func (q *FsQuotaBytes) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case float64:
+		*q = FsQuotaBytes(v)
+	case string:
+		if v != "infinite" {
+			return errors.New("invalid bytes_quota " + v)
+		}
+		*q = 0
+	default:
+		*q = 0
+	}
+	return nil
+}
+
+// resize的输出，ceph中为[{"bytes_used": ...}, {"bytes_quota": ...}, {"bytes_pcent": ...}]
+type FsQuotaUsage struct {
+	BytesUsed  uint64       `json:"bytes_used"`
+	BytesQuota FsQuotaBytes `json:"bytes_quota"`
+	BytesPcent string       `json:"bytes_pcent"` // 未设置配额时为undefined
+}
+
+func (u *FsQuotaUsage) UnmarshalJSON(data []byte) error {
+	type usage FsQuotaUsage
+	items := []json.RawMessage{}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return json.Unmarshal(data, (*usage)(u))
+	}
+	for _, item := range items {
+		if err := json.Unmarshal(item, (*usage)(u)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type FsSubvolumeGroupInfo struct {
+	Name       string       `json:"name"`
+	Path       string       `json:"path"`
+	DataPool   string       `json:"data_pool"`
+	BytesUsed  uint64       `json:"bytes_used"`
+	BytesQuota FsQuotaBytes `json:"bytes_quota"`
+	BytesPcent string       `json:"bytes_pcent"`
+	Uid        uint32       `json:"uid"`
+	Gid        uint32       `json:"gid"`
+	Mode       uint32       `json:"mode"`
+	CreatedAt  string       `json:"created_at"`
+}
+
+type FsSubvolumeInfo struct {
+	Name          string       `json:"name"`
+	Group         string       `json:"group"`
+	Type          string       `json:"type"`  // subvolume或clone
+	State         string       `json:"state"` // complete、pending、in-progress、snapshot-retained等
+	Path          string       `json:"path"`
+	DataPool      string       `json:"data_pool"`
+	PoolNamespace string       `json:"pool_namespace"`
+	BytesUsed     uint64       `json:"bytes_used"`
+	BytesQuota    FsQuotaBytes `json:"bytes_quota"`
+	BytesPcent    string       `json:"bytes_pcent"`
+	Uid           uint32       `json:"uid"`
+	Gid           uint32       `json:"gid"`
+	Mode          uint32       `json:"mode"`
+	Features      []string     `json:"features"`
+	CreatedAt     string       `json:"created_at"`
+}
+
+type FsPendingClone struct {
+	Name        string `json:"name"`
+	TargetGroup string `json:"target_group,omitempty"`
+}
+
+type FsSubvolumeSnapshotInfo struct {
+	Name             string           `json:"name"`
+	CreatedAt        string           `json:"created_at"`
+	DataPool         string           `json:"data_pool"`
+	Size             uint64           `json:"size"`
+	HasPendingClones string           `json:"has_pending_clones"` // yes或no
+	PendingClones    []FsPendingClone `json:"pending_clones"`
+}
+
+type FsCloneSource struct {
+	Volume    string `json:"volume"`
+	Subvolume string `json:"subvolume"`
+	Snapshot  string `json:"snapshot"`
+	Group     string `json:"group,omitempty"`
+}
+
+type FsCloneStatus struct {
+	Name    string        `json:"name"`
+	State   string        `json:"state"` // pending、in-progress、complete、failed、canceled
+	Source  FsCloneSource `json:"source"`
+	Failure struct {
+		Errno    string `json:"errno"`
+		ErrorMsg string `json:"error_msg"`
+	} `json:"failure"`
+}
+
+// 创建子卷或子卷组的选项，为空时使用默认值
+type FsSubvolumeOptions struct {
+	Size              uint64 // 配额字节数，0为不限制
+	PoolLayout        string // 数据存储池
+	Mode              string // 八进制权限
+	NamespaceIsolated bool   // 子卷使用独立的rados命名空间
+}
+
+func (o FsSubvolumeOptions) apply(cmd Command) Command {
+	if o.Size > 0 {
+		cmd.Set("size", o.Size)
+	}
+	if o.PoolLayout != "" {
+		cmd.Set("pool_layout", o.PoolLayout)
+	}
+	if o.Mode != "" {
+		cmd.Set("mode", o.Mode)
+	}
+	if o.NamespaceIsolated {
+		cmd.Set("namespace_isolated", true)
+	}
+	return cmd
+}
+
+// 子卷命令，group为空时使用默认组
+func subvolumeCommand(prefix string, vol_name string, sub_name string, group_name string) Command {
+	cmd := NewCommand(prefix).Set("vol_name", vol_name).Set("sub_name", sub_name)
+	if group_name != "" {
+		cmd.Set("group_name", group_name)
+	}
+	return cmd
+}
+
+// resize的目标大小，0为取消限制
+func quotaSize(size uint64) string {
+	if size == 0 {
+		return "infinite"
+	}
+	return fmt.Sprintf("%d", size)
+}
+
+// 名称列表，ceph中为[{"name": ...}]
+func (c *Commander) fsNames(cmd Command) ([]string, error) {
+	list := []struct {
+		Name string `json:"name"`
+	}{}
+	if _, err := c.Mgr(cmd, &list); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(list))
+	for _, item := range list {
+		names = append(names, item.Name)
+	}
+	return names, nil
+}
+
+// getpath的输出为路径文本
+func (c *Commander) fsGetpath(cmd Command) (string, error) {
+	out, _, err := c.rados.Rados_mgr_command(cmd.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (c *Commander) FsSubvolumeGroupList(vol_name string) ([]string, error) {
+	return c.fsNames(NewCommand("fs subvolumegroup ls").Set("vol_name", vol_name))
+}
+
+func (c *Commander) FsSubvolumeGroupCreate(vol_name string, group_name string, opts FsSubvolumeOptions) error {
+	cmd := NewCommand("fs subvolumegroup create").Set("vol_name", vol_name).Set("group_name", group_name)
+	_, err := c.Mgr(opts.apply(cmd), nil)
+	return err
+}
+
+// force为true时子卷组不存在不报错
+func (c *Commander) FsSubvolumeGroupRemove(vol_name string, group_name string, force bool) error {
+	cmd := NewCommand("fs subvolumegroup rm").Set("vol_name", vol_name).Set("group_name", group_name)
+	if force {
+		cmd.Set("force", true)
+	}
+	_, err := c.Mgr(cmd, nil)
+	return err
+}
+
+// no_shrink为true时不允许小于已使用量
+func (c *Commander) FsSubvolumeGroupResize(vol_name string, group_name string, size uint64, no_shrink bool) (FsQuotaUsage, error) {
+	usage := FsQuotaUsage{}
+	cmd := NewCommand("fs subvolumegroup resize").
+		Set("vol_name", vol_name).
+		Set("group_name", group_name).
+		Set("new_size", quotaSize(size))
+	if no_shrink {
+		cmd.Set("no_shrink", true)
+	}
+	_, err := c.Mgr(cmd, &usage)
+	return usage, err
+}
+
+func (c *Commander) FsSubvolumeGroupGetpath(vol_name string, group_name string) (string, error) {
+	return c.fsGetpath(NewCommand("fs subvolumegroup getpath").Set("vol_name", vol_name).Set("group_name", group_name))
+}
+
+func (c *Commander) FsSubvolumeGroupInfo(vol_name string, group_name string) (FsSubvolumeGroupInfo, error) {
+	info := FsSubvolumeGroupInfo{}
+	cmd := NewCommand("fs subvolumegroup info").Set("vol_name", vol_name).Set("group_name", group_name)
+	if _, err := c.Mgr(cmd, &info); err != nil {
+		return info, err
+	}
+	info.Name = group_name
+	info.Mode &^= CEPHFS_S_IFMT
+	path, err := c.FsSubvolumeGroupGetpath(vol_name, group_name)
+	info.Path = path
+	return info, err
+}
+
+func (c *Commander) FsSubvolumeList(vol_name string, group_name string) ([]string, error) {
+	cmd := NewCommand("fs subvolume ls").Set("vol_name", vol_name)
+	if group_name != "" {
+		cmd.Set("group_name", group_name)
+	}
+	return c.fsNames(cmd)
+}
+
+func (c *Commander) FsSubvolumeCreate(vol_name string, sub_name string, group_name string, opts FsSubvolumeOptions) error {
+	_, err := c.Mgr(opts.apply(subvolumeCommand("fs subvolume create", vol_name, sub_name, group_name)), nil)
+	return err
+}
+
+// 有快照的子卷需先删除快照
+func (c *Commander) FsSubvolumeRemove(vol_name string, sub_name string, group_name string, force bool) error {
+	cmd := subvolumeCommand("fs subvolume rm", vol_name, sub_name, group_name)
+	if force {
+		cmd.Set("force", true)
+	}
+	_, err := c.Mgr(cmd, nil)
+	return err
+}
+
+func (c *Commander) FsSubvolumeResize(vol_name string, sub_name string, group_name string, size uint64, no_shrink bool) (FsQuotaUsage, error) {
+	usage := FsQuotaUsage{}
+	cmd := subvolumeCommand("fs subvolume resize", vol_name, sub_name, group_name).Set("new_size", quotaSize(size))
+	if no_shrink {
+		cmd.Set("no_shrink", true)
+	}
+	_, err := c.Mgr(cmd, &usage)
+	return usage, err
+}
+
+func (c *Commander) FsSubvolumeGetpath(vol_name string, sub_name string, group_name string) (string, error) {
+	return c.fsGetpath(subvolumeCommand("fs subvolume getpath", vol_name, sub_name, group_name))
+}
+
+func (c *Commander) FsSubvolumeInfo(vol_name string, sub_name string, group_name string) (FsSubvolumeInfo, error) {
+	info := FsSubvolumeInfo{}
+	if _, err := c.Mgr(subvolumeCommand("fs subvolume info", vol_name, sub_name, group_name), &info); err != nil {
+		return info, err
+	}
+	info.Name = sub_name
+	info.Group = group_name
+	info.Mode &^= CEPHFS_S_IFMT
+	return info, nil
+}
+
+func (c *Commander) FsSubvolumeSnapshotList(vol_name string, sub_name string, group_name string) ([]string, error) {
+	return c.fsNames(subvolumeCommand("fs subvolume snapshot ls", vol_name, sub_name, group_name))
+}
+
+func (c *Commander) FsSubvolumeSnapshotInfo(vol_name string, sub_name string, snap_name string, group_name string) (FsSubvolumeSnapshotInfo, error) {
+	info := FsSubvolumeSnapshotInfo{}
+	cmd := subvolumeCommand("fs subvolume snapshot info", vol_name, sub_name, group_name).Set("snap_name", snap_name)
+	if _, err := c.Mgr(cmd, &info); err != nil {
+		return info, err
+	}
+	info.Name = snap_name
+	if info.PendingClones == nil {
+		info.PendingClones = []FsPendingClone{}
+	}
+	return info, nil
+}
+
+func (c *Commander) FsSubvolumeSnapshotCreate(vol_name string, sub_name string, snap_name string, group_name string) error {
+	if err := checkCephfsSnapName(snap_name); err != nil {
+		return errors.New("cannot create snapshot of subvolume[" + sub_name + "] " + err.Error())
+	}
+	cmd := subvolumeCommand("fs subvolume snapshot create", vol_name, sub_name, group_name).Set("snap_name", snap_name)
+	_, err := c.Mgr(cmd, nil)
+	return err
+}
+
+// 有未完成的克隆时不能删除
+func (c *Commander) FsSubvolumeSnapshotRemove(vol_name string, sub_name string, snap_name string, group_name string, force bool) error {
+	cmd := subvolumeCommand("fs subvolume snapshot rm", vol_name, sub_name, group_name).Set("snap_name", snap_name)
+	if force {
+		cmd.Set("force", true)
+	}
+	_, err := c.Mgr(cmd, nil)
+	return err
+}
+
+// 从快照克隆为新的子卷，克隆在后台进行，通过FsCloneStatus查询进度
+func (c *Commander) FsSubvolumeSnapshotClone(vol_name string, sub_name string, snap_name string, group_name string, target_sub_name string, target_group_name string, pool_layout string) error {
+	cmd := subvolumeCommand("fs subvolume snapshot clone", vol_name, sub_name, group_name).
+		Set("snap_name", snap_name).
+		Set("target_sub_name", target_sub_name)
+	if target_group_name != "" {
+		cmd.Set("target_group_name", target_group_name)
+	}
+	if pool_layout != "" {
+		cmd.Set("pool_layout", pool_layout)
+	}
+	_, err := c.Mgr(cmd, nil)
+	return err
+}
+
+func (c *Commander) FsCloneStatus(vol_name string, clone_name string, group_name string) (FsCloneStatus, error) {
+	result := struct {
+		Status FsCloneStatus `json:"status"`
+	}{}
+	cmd := NewCommand("fs clone status").Set("vol_name", vol_name).Set("clone_name", clone_name)
+	if group_name != "" {
+		cmd.Set("group_name", group_name)
+	}
+	if _, err := c.Mgr(cmd, &result); err != nil {
+		return result.Status, err
+	}
+	result.Status.Name = clone_name
+	return result.Status, nil
+}
+
+// 子卷组中由克隆创建的子卷及其克隆状态
+func (c *Commander) FsCloneList(vol_name string, group_name string) ([]FsCloneStatus, error) {
+	names, err := c.FsSubvolumeList(vol_name, group_name)
+	if err != nil {
+		return nil, err
+	}
+	clones := []FsCloneStatus{}
+	for _, name := range names {
+		// 克隆未完成时info返回EAGAIN，以clone status为准
+		info, infoErr := c.FsSubvolumeInfo(vol_name, name, group_name)
+		if infoErr == nil && info.Type != "clone" {
+			continue
+		}
+		status, err := c.FsCloneStatus(vol_name, name, group_name)
+		if err != nil {
+			if infoErr != nil {
+				return nil, infoErr
+			}
+			return nil, err
+		}
+		clones = append(clones, status)
+	}
+	return clones, nil
+}
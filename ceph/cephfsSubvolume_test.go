@@ -0,0 +1,139 @@
+package ceph
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFsQuotaUsage(t *testing.T) {
+	usage := FsQuotaUsage{}
+	data := `[{"bytes_used": 10}, {"bytes_quota": "infinite"}, {"bytes_pcent": "undefined"}]`
+	if err := json.Unmarshal([]byte(data), &usage); err != nil || usage.BytesUsed != 10 || usage.BytesQuota != 0 || usage.BytesPcent != "undefined" {
+		t.Fatalf("usage %+v %v", usage, err)
+	}
+	data = `{"bytes_used": 1, "bytes_quota": 1024, "bytes_pcent": "0.10"}`
+	if err := json.Unmarshal([]byte(data), &usage); err != nil || usage.BytesQuota != 1024 {
+		t.Fatalf("usage %+v %v", usage, err)
+	}
+}
+
+func TestFsSubvolume(t *testing.T) {
+	rados := newConnectedFake(t)
+	c := NewCommander(rados)
+
+	if err := c.FsSubvolumeGroupCreate("nofs", "csi", FsSubvolumeOptions{}); err == nil {
+		t.Fatal("expected error on unknown volume")
+	}
+	if err := c.FsSubvolumeGroupCreate("cephfs", "csi", FsSubvolumeOptions{Size: 100, Mode: "750"}); err != nil {
+		t.Fatal(err)
+	}
+	if groups, err := c.FsSubvolumeGroupList("cephfs"); err != nil || len(groups) != 1 || groups[0] != "csi" {
+		t.Fatalf("groups %v %v", groups, err)
+	}
+	info, err := c.FsSubvolumeGroupInfo("cephfs", "csi")
+	if err != nil || info.Path != "/volumes/csi" || info.BytesQuota != 100 || info.Mode != 0750 || info.DataPool != "data" {
+		t.Fatalf("group info %+v %v", info, err)
+	}
+
+	if err := c.FsSubvolumeCreate("cephfs", "pvc-1", "csi", FsSubvolumeOptions{Size: 50, NamespaceIsolated: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.FsSubvolumeCreate("cephfs", "pvc-2", "nogroup", FsSubvolumeOptions{}); err == nil {
+		t.Fatal("expected error on unknown group")
+	}
+	if err := c.FsSubvolumeCreate("cephfs", "plain", "", FsSubvolumeOptions{PoolLayout: "nopool"}); err == nil {
+		t.Fatal("expected error on unknown pool")
+	}
+	c.FsSubvolumeCreate("cephfs", "plain", "", FsSubvolumeOptions{})
+	if names, err := c.FsSubvolumeList("cephfs", ""); err != nil || len(names) != 1 || names[0] != "plain" {
+		t.Fatalf("subvolumes without group %v %v", names, err)
+	}
+	path, err := c.FsSubvolumeGetpath("cephfs", "pvc-1", "csi")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 子卷路径可通过libcephfs访问，配额生效
+	fs := mountFake(t, rados)
+	if err := writeFile(t, fs, path+"/f", "0123456789"); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := c.FsSubvolumeInfo("cephfs", "pvc-1", "csi")
+	if err != nil || sub.Path != path || sub.BytesUsed != 10 || sub.BytesQuota != 50 || sub.Type != "subvolume" || sub.PoolNamespace != "fsvolumens_pvc-1" {
+		t.Fatalf("subvolume info %+v %v", sub, err)
+	}
+	if _, err := c.FsSubvolumeResize("cephfs", "pvc-1", "csi", 5, true); err == nil {
+		t.Fatal("expected error shrinking below used size")
+	}
+	usage, err := c.FsSubvolumeResize("cephfs", "pvc-1", "csi", 0, false)
+	if err != nil || usage.BytesQuota != 0 || usage.BytesUsed != 10 {
+		t.Fatalf("resize %+v %v", usage, err)
+	}
+
+	if err := c.FsSubvolumeSnapshotCreate("cephfs", "pvc-1", "snap1", "csi"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.FsSubvolumeSnapshotCreate("cephfs", "pvc-1", "snap1", "csi"); err == nil {
+		t.Fatal("expected EEXIST")
+	}
+	writeFile(t, fs, path+"/f", "changed")
+	if snaps, err := c.FsSubvolumeSnapshotList("cephfs", "pvc-1", "csi"); err != nil || len(snaps) != 1 {
+		t.Fatalf("snapshots %v %v", snaps, err)
+	}
+	if snap, err := c.FsSubvolumeSnapshotInfo("cephfs", "pvc-1", "snap1", "csi"); err != nil || snap.Size != 10 || snap.HasPendingClones != "no" {
+		t.Fatalf("snapshot info %+v %v", snap, err)
+	}
+	if err := c.FsSubvolumeRemove("cephfs", "pvc-1", "csi", false); err == nil {
+		t.Fatal("expected ENOTEMPTY removing a subvolume with snapshots")
+	}
+
+	if err := c.FsSubvolumeSnapshotClone("cephfs", "pvc-1", "snap1", "csi", "pvc-3", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.FsSubvolumeSnapshotClone("cephfs", "pvc-1", "snap1", "csi", "pvc-3", "", ""); err == nil {
+		t.Fatal("expected EEXIST cloning to an existing subvolume")
+	}
+	status, err := c.FsCloneStatus("cephfs", "pvc-3", "")
+	if err != nil || status.State != "complete" || status.Source.Subvolume != "pvc-1" || status.Source.Group != "csi" {
+		t.Fatalf("clone status %+v %v", status, err)
+	}
+	if _, err := c.FsCloneStatus("cephfs", "plain", ""); err == nil {
+		t.Fatal("expected error on a subvolume that is not a clone")
+	}
+	if clones, err := c.FsCloneList("cephfs", ""); err != nil || len(clones) != 1 || clones[0].Name != "pvc-3" {
+		t.Fatalf("clones %+v %v", clones, err)
+	}
+	clonePath, _ := c.FsSubvolumeGetpath("cephfs", "pvc-3", "")
+	file, err := fs.Ceph_open(clonePath+"/f", CEPHFS_O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := make([]byte, 10)
+	file.ReadAt(p, 0)
+	file.Close()
+	if string(p) != "0123456789" {
+		t.Fatalf("clone content %q", p)
+	}
+
+	if err := c.FsSubvolumeGroupRemove("cephfs", "csi", false); err == nil {
+		t.Fatal("expected ENOTEMPTY removing a group with subvolumes")
+	}
+	if err := c.FsSubvolumeSnapshotRemove("cephfs", "pvc-1", "snap1", "csi", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.FsSubvolumeSnapshotRemove("cephfs", "pvc-1", "snap1", "csi", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.FsSubvolumeRemove("cephfs", "pvc-1", "csi", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.FsSubvolumeRemove("cephfs", "pvc-1", "csi", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.FsSubvolumeGroupRemove("cephfs", "csi", false); err != nil {
+		t.Fatal(err)
+	}
+	if groups, _ := c.FsSubvolumeGroupList("cephfs"); len(groups) != 0 {
+		t.Fatalf("groups after remove %v", groups)
+	}
+}
@@ -0,0 +1,175 @@
+package ceph
+
+import (
+	"testing"
+)
+
+// 在rados的克隆上挂载默认文件系统
+func mountFake(t *testing.T, rados LibRados) Libcephfs {
+	fs, err := NewLibCephfs(rados.Rados_clone())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Ceph_mount("", "/"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fs.Ceph_unmount() })
+	return fs
+}
+
+func writeFile(t *testing.T, fs Libcephfs, p string, data string) error {
+	file, err := fs.Ceph_open(p, CEPHFS_O_WRONLY|CEPHFS_O_CREAT|CEPHFS_O_TRUNC, CEPHFS_DEFAULT_FILE_MODE)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteAt([]byte(data), 0)
+	return err
+}
+
+func TestCephfsQuota(t *testing.T) {
+	fs := mountFake(t, newConnectedFake(t))
+	if err := fs.Ceph_mkdirs("/tenants/a", CEPHFS_DEFAULT_DIR_MODE); err != nil {
+		t.Fatal(err)
+	}
+	if quota, err := GetCephfsQuota(fs, "/tenants/a"); err != nil || quota != (CephfsQuota{}) {
+		t.Fatalf("quota without limits %+v %v", quota, err)
+	}
+	if err := SetCephfsQuota(fs, "/tenants/a", 10, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(t, fs, "/tenants/a/f1", "0123456789"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(t, fs, "/tenants/a/f2", "x"); err == nil || errnoOf(err) != -122 {
+		t.Fatalf("expected EDQUOT exceeding max_bytes, got %v", err)
+	}
+	fs.Ceph_mkdir("/tenants/a/d", CEPHFS_DEFAULT_DIR_MODE)
+	if err := fs.Ceph_mkdir("/tenants/a/d/e", CEPHFS_DEFAULT_DIR_MODE); err == nil {
+		t.Fatal("expected EDQUOT exceeding max_files")
+	}
+	quota, err := GetCephfsQuota(fs, "/tenants/a")
+	if err != nil || quota.MaxBytes != 10 || quota.MaxFiles != 3 || quota.UsedBytes != 10 || quota.UsedFiles != 3 {
+		t.Fatalf("quota %+v %v", quota, err)
+	}
+	// 同一配额目录内移动不受限制，移出再移入时计入配额
+	if err := fs.Ceph_rename("/tenants/a/f1", "/tenants/a/d/f1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Ceph_rename("/tenants/a/d/f1", "/tenants/f1"); err != nil {
+		t.Fatal(err)
+	}
+	SetCephfsQuota(fs, "/tenants/a", 5, 0)
+	if err := fs.Ceph_rename("/tenants/f1", "/tenants/a/f1"); err == nil {
+		t.Fatal("expected EDQUOT moving into the quota directory")
+	}
+	if err := SetCephfsQuota(fs, "/tenants/a", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if quota, _ := GetCephfsQuota(fs, "/tenants/a"); quota.MaxBytes != 0 || quota.MaxFiles != 0 {
+		t.Fatalf("quota not removed %+v", quota)
+	}
+	if err := SetCephfsQuota(fs, "/tenants/f1", 1, 0); err == nil {
+		t.Fatal("expected error setting quota on a file")
+	}
+}
+
+func TestCephfsLayout(t *testing.T) {
+	fs := mountFake(t, newConnectedFake(t))
+	fs.Ceph_mkdirs("/a/b", CEPHFS_DEFAULT_DIR_MODE)
+
+	layout, err := GetCephfsLayout(fs, "/a/b")
+	if err != nil || layout.Pool != "data" || layout.ObjectSize != 4<<20 || layout.Inherited != "/" {
+		t.Fatalf("inherited layout %+v %v", layout, err)
+	}
+	if err := SetCephfsLayout(fs, "/a", CephfsLayout{StripeUnit: 1 << 20, StripeCount: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if layout, _ := GetCephfsLayout(fs, "/a/b"); layout.Inherited != "/a" || layout.StripeUnit != 1<<20 || layout.StripeCount != 4 {
+		t.Fatalf("layout after set %+v", layout)
+	}
+	for _, bad := range []CephfsLayout{{StripeUnit: 1000}, {ObjectSize: 1536 << 10}, {Pool: "nopool"}} {
+		if err := SetCephfsLayout(fs, "/a", bad); err == nil {
+			t.Fatalf("expected error setting %+v", bad)
+		}
+	}
+	// 文件创建时确定布局，有数据后不能修改
+	writeFile(t, fs, "/a/b/f", "")
+	if err := SetCephfsLayout(fs, "/a/b/f", CephfsLayout{ObjectSize: 8 << 20}); err != nil {
+		t.Fatal(err)
+	}
+	if layout, _ := GetCephfsLayout(fs, "/a/b/f"); layout.ObjectSize != 8<<20 || layout.StripeCount != 4 || layout.Inherited != "" {
+		t.Fatalf("file layout %+v", layout)
+	}
+	writeFile(t, fs, "/a/b/f", "data")
+	if err := SetCephfsLayout(fs, "/a/b/f", CephfsLayout{ObjectSize: 4 << 20}); err == nil {
+		t.Fatal("expected error changing the layout of a non-empty file")
+	}
+
+	if err := RemoveCephfsLayout(fs, "/a"); err != nil {
+		t.Fatal(err)
+	}
+	if layout, _ := GetCephfsLayout(fs, "/a"); layout.Inherited != "/" || layout.StripeCount != 1 {
+		t.Fatalf("layout after remove %+v", layout)
+	}
+	if err := RemoveCephfsLayout(fs, "/a"); err == nil {
+		t.Fatal("expected ENODATA removing a missing layout")
+	}
+}
+
+func TestCephfsSnap(t *testing.T) {
+	fs := mountFake(t, newConnectedFake(t))
+	fs.Ceph_mkdirs("/a/b", CEPHFS_DEFAULT_DIR_MODE)
+	writeFile(t, fs, "/a/b/f", "v1")
+
+	if err := CephfsSnapCreate(fs, "/a", "s1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CephfsSnapCreate(fs, "/a", "s1"); err == nil {
+		t.Fatal("expected EEXIST")
+	}
+	if err := CephfsSnapCreate(fs, "/a", "_bad"); err == nil {
+		t.Fatal("expected error on name starting with _")
+	}
+	writeFile(t, fs, "/a/b/f", "v2")
+	CephfsSnapCreate(fs, "/a/b", "s2")
+
+	// 快照中为创建时的内容且只读
+	file, err := fs.Ceph_open("/a/.snap/s1/b/f", CEPHFS_O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := make([]byte, 2)
+	file.ReadAt(p, 0)
+	file.Close()
+	if string(p) != "v1" {
+		t.Fatalf("snapshot content %q", p)
+	}
+	if err := writeFile(t, fs, "/a/.snap/s1/b/f", "x"); err == nil {
+		t.Fatal("expected EROFS writing into a snapshot")
+	}
+
+	snaps, err := CephfsSnapList(fs, "/a/b")
+	if err != nil || len(snaps) != 2 || snaps[0].Name == snaps[1].Name {
+		t.Fatalf("snaps %+v %v", snaps, err)
+	}
+	inherited := 0
+	for _, snap := range snaps {
+		if snap.Inherited {
+			inherited++
+		}
+	}
+	if inherited != 1 {
+		t.Fatalf("expected one inherited snapshot %+v", snaps)
+	}
+
+	if err := CephfsSnapRemove(fs, "/a", "s1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CephfsSnapRemove(fs, "/a", "s1"); err == nil {
+		t.Fatal("expected ENOENT")
+	}
+	if snaps, _ := CephfsSnapList(fs, "/a/b"); len(snaps) != 1 || snaps[0].Name != "s2" {
+		t.Fatalf("snaps after remove %+v", snaps)
+	}
+}
@@ -0,0 +1,114 @@
+package ceph
+
+// 集群概况
+
+// rados_cluster_stat
+type ClusterStat struct {
+	Kb         uint64 `json:"kb"`
+	KbUsed     uint64 `json:"kb_used"`
+	KbAvail    uint64 `json:"kb_avail"`
+	NumObjects uint64 `json:"num_objects"`
+}
+
+type ClusterCapacity struct {
+	TotalBytes  uint64  `json:"total_bytes"`
+	UsedBytes   uint64  `json:"used_bytes"`
+	AvailBytes  uint64  `json:"avail_bytes"`
+	StoredBytes uint64  `json:"stored_bytes"` // 存储池中的数据量，不含副本
+	UsedRatio   float64 `json:"used_ratio"`
+}
+
+type MonSummary struct {
+	ElectionEpoch int      `json:"election_epoch"`
+	NumMons       int      `json:"num_mons"`
+	Quorum        []string `json:"quorum"`
+	OutOfQuorum   int      `json:"out_of_quorum"`
+}
+
+type OsdSummary struct {
+	Total int `json:"total"`
+	Up    int `json:"up"`
+	In    int `json:"in"`
+	Down  int `json:"down"`
+	Out   int `json:"out"`
+}
+
+type PgSummary struct {
+	Total   int            `json:"total"`
+	ByState []PgStateCount `json:"by_state"`
+}
+
+// 首页展示的集群概况，汇总status、cluster stat及df
+type ClusterSummary struct {
+	Fsid       string          `json:"fsid"`
+	Health     Health          `json:"health"`
+	Capacity   ClusterCapacity `json:"capacity"`
+	NumObjects uint64          `json:"num_objects"`
+	NumPools   int             `json:"num_pools"`
+	Pg         PgSummary       `json:"pg"`
+	Mon        MonSummary      `json:"mon"`
+	Osd        OsdSummary      `json:"osd"`
+	Pools      []DfPool        `json:"pools"`
+}
+
+func (c *Commander) Summary() (*ClusterSummary, error) {
+	status, err := c.Status()
+	if err != nil {
+		return nil, err
+	}
+	stat, err := c.rados.Rados_cluster_stat()
+	if err != nil {
+		return nil, err
+	}
+	df, err := c.Df()
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &ClusterSummary{
+		Fsid:       status.Fsid,
+		Health:     status.Health,
+		NumObjects: stat.NumObjects,
+		NumPools:   len(df.Pools),
+		Pools:      df.Pools,
+	}
+
+	summary.Capacity = ClusterCapacity{
+		TotalBytes: stat.Kb * 1024,
+		UsedBytes:  stat.KbUsed * 1024,
+		AvailBytes: stat.KbAvail * 1024,
+	}
+	for _, pool := range df.Pools {
+		summary.Capacity.StoredBytes += pool.Stats.Stored
+	}
+	if summary.Capacity.TotalBytes > 0 {
+		summary.Capacity.UsedRatio = float64(summary.Capacity.UsedBytes) / float64(summary.Capacity.TotalBytes)
+	}
+
+	summary.Pg = PgSummary{
+		Total:   status.PgMap.NumPgs,
+		ByState: status.PgMap.PgsByState,
+	}
+	if summary.Pg.ByState == nil {
+		summary.Pg.ByState = []PgStateCount{}
+	}
+
+	summary.Mon = MonSummary{
+		ElectionEpoch: status.ElectionEpoch,
+		NumMons:       status.MonMap.NumMons,
+		Quorum:        status.QuorumNames,
+		OutOfQuorum:   status.MonMap.NumMons - len(status.QuorumNames),
+	}
+	if summary.Mon.OutOfQuorum < 0 {
+		summary.Mon.OutOfQuorum = 0
+	}
+
+	summary.Osd = OsdSummary{
+		Total: status.OsdMap.NumOsds,
+		Up:    status.OsdMap.NumUpOsds,
+		In:    status.OsdMap.NumInOsds,
+		Down:  status.OsdMap.NumOsds - status.OsdMap.NumUpOsds,
+		Out:   status.OsdMap.NumOsds - status.OsdMap.NumInOsds,
+	}
+	return summary, nil
+}
@@ -0,0 +1,35 @@
+package ceph
+
+import "testing"
+
+func TestCommander_Summary(t *testing.T) {
+	rados := newConnectedFake(t)
+	if err := rados.Rados_ioctx_create("data"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rados.Rados_write_full("obj", make([]byte, 4096)); err != nil {
+		t.Fatal(err)
+	}
+	rados.cluster.osds[2].up = false
+	rados.cluster.osds[2].in = false
+
+	summary, err := NewCommander(rados).Summary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Health.Status != "HEALTH_WARN" || summary.Health.Checks[0].Name != "OSD_DOWN" {
+		t.Fatalf("health %+v", summary.Health)
+	}
+	if summary.Osd.Total != 3 || summary.Osd.Down != 1 || summary.Osd.Out != 1 {
+		t.Fatalf("osd %+v", summary.Osd)
+	}
+	if summary.Mon.NumMons != 3 || len(summary.Mon.Quorum) != 3 || summary.Mon.OutOfQuorum != 0 {
+		t.Fatalf("mon %+v", summary.Mon)
+	}
+	if summary.NumObjects != 1 || summary.Capacity.StoredBytes != 4096 || summary.Capacity.TotalBytes != 2*fakeOsdBytes {
+		t.Fatalf("capacity %+v objects %d", summary.Capacity, summary.NumObjects)
+	}
+	if summary.Pg.Total != 3*POOL_DEFAULT_PG_NUM || len(summary.Pg.ByState) != 2 {
+		t.Fatalf("pg %+v", summary.Pg)
+	}
+}
@@ -0,0 +1,364 @@
+package ceph
+
+// mon/osd/pg/mgr命令
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// json格式的命令，如 {"prefix": "status", "format": "json"}
+type Command map[string]interface{}
+
+func NewCommand(prefix string) Command {
+	return Command{
+		"prefix": prefix,
+		"format": "json",
+	}
+}
+
+func (c Command) Set(key string, value interface{}) Command {
+	c[key] = value
+	return c
+}
+
+func (c Command) Prefix() string {
+	prefix, _ := c["prefix"].(string)
+	return prefix
+}
+
+func (c Command) String() string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// 执行命令并将json输出解析到result
+type Commander struct {
+	rados LibRados
+}
+
+func NewCommander(rados LibRados) *Commander {
+	return &Commander{
+		rados: rados,
+	}
+}
+
+func decodeCommandOutput(cmd Command, out []byte, result interface{}) error {
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(out, result); err != nil {
+		return errors.New("cannot decode " + cmd.Prefix() + " output: " + err.Error())
+	}
+	return nil
+}
+
+func (c *Commander) Mon(cmd Command, result interface{}) (outs string, err error) {
+	out, outs, err := c.rados.Rados_mon_command(cmd.String(), nil)
+	if err != nil {
+		return outs, err
+	}
+	return outs, decodeCommandOutput(cmd, out, result)
+}
+
+func (c *Commander) Mgr(cmd Command, result interface{}) (outs string, err error) {
+	out, outs, err := c.rados.Rados_mgr_command(cmd.String(), nil)
+	if err != nil {
+		return outs, err
+	}
+	return outs, decodeCommandOutput(cmd, out, result)
+}
+
+func (c *Commander) Osd(osdId int, cmd Command, result interface{}) (outs string, err error) {
+	out, outs, err := c.rados.Rados_osd_command(osdId, cmd.String(), nil)
+	if err != nil {
+		return outs, err
+	}
+	return outs, decodeCommandOutput(cmd, out, result)
+}
+
+func (c *Commander) Pg(pgid string, cmd Command, result interface{}) (outs string, err error) {
+	out, outs, err := c.rados.Rados_pg_command(pgid, cmd.String(), nil)
+	if err != nil {
+		return outs, err
+	}
+	return outs, decodeCommandOutput(cmd, out, result)
+}
+
+type HealthCheck struct {
+	Name     string   `json:"name"`
+	Severity string   `json:"severity"`
+	Message  string   `json:"message"`
+	Detail   []string `json:"detail"`
+}
+
+type Health struct {
+	Status string        `json:"status"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+// checks在ceph中为以检查项名称为key的对象，转换为按名称排序的列表
+func (h *Health) UnmarshalJSON(data []byte) error {
+	raw := struct {
+		Status string `json:"status"`
+		Checks map[string]struct {
+			Severity string `json:"severity"`
+			Summary  struct {
+				Message string `json:"message"`
+			} `json:"summary"`
+			Detail []struct {
+				Message string `json:"message"`
+			} `json:"detail"`
+		} `json:"checks"`
+	}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	h.Status = raw.Status
+	h.Checks = []HealthCheck{}
+	for name, check := range raw.Checks {
+		item := HealthCheck{
+			Name:     name,
+			Severity: check.Severity,
+			Message:  check.Summary.Message,
+			Detail:   []string{},
+		}
+		for _, detail := range check.Detail {
+			item.Detail = append(item.Detail, detail.Message)
+		}
+		h.Checks = append(h.Checks, item)
+	}
+	sort.Slice(h.Checks, func(i, j int) bool { return h.Checks[i].Name < h.Checks[j].Name })
+	return nil
+}
+
+type OsdMapSummary struct {
+	Epoch          int  `json:"epoch"`
+	NumOsds        int  `json:"num_osds"`
+	NumUpOsds      int  `json:"num_up_osds"`
+	NumInOsds      int  `json:"num_in_osds"`
+	Full           bool `json:"full"`
+	Nearfull       bool `json:"nearfull"`
+	NumRemappedPgs int  `json:"num_remapped_pgs"`
+}
+
+// nautilus及以前版本osdmap多嵌套一层
+func (o *OsdMapSummary) UnmarshalJSON(data []byte) error {
+	type summary OsdMapSummary
+	nested := struct {
+		Osdmap *summary `json:"osdmap"`
+	}{}
+	if err := json.Unmarshal(data, &nested); err == nil && nested.Osdmap != nil {
+		*o = OsdMapSummary(*nested.Osdmap)
+		return nil
+	}
+	return json.Unmarshal(data, (*summary)(o))
+}
+
+type PgStateCount struct {
+	StateName string `json:"state_name"`
+	Count     int    `json:"count"`
+}
+
+type PgMapSummary struct {
+	PgsByState []PgStateCount `json:"pgs_by_state"`
+	NumPgs     int            `json:"num_pgs"`
+	NumPools   int            `json:"num_pools"`
+	NumObjects uint64         `json:"num_objects"`
+	DataBytes  uint64         `json:"data_bytes"`
+	BytesUsed  uint64         `json:"bytes_used"`
+	BytesAvail uint64         `json:"bytes_avail"`
+	BytesTotal uint64         `json:"bytes_total"`
+}
+
+type MonMapSummary struct {
+	Epoch   int `json:"epoch"`
+	NumMons int `json:"num_mons"`
+}
+
+// octopus以前版本没有num_mons，需统计mons
+func (m *MonMapSummary) UnmarshalJSON(data []byte) error {
+	raw := struct {
+		Epoch   int               `json:"epoch"`
+		NumMons *int              `json:"num_mons"`
+		Mons    []json.RawMessage `json:"mons"`
+	}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	m.Epoch = raw.Epoch
+	m.NumMons = len(raw.Mons)
+	if raw.NumMons != nil {
+		m.NumMons = *raw.NumMons
+	}
+	return nil
+}
+
+// ceph status
+type ClusterStatus struct {
+	Fsid          string        `json:"fsid"`
+	Health        Health        `json:"health"`
+	ElectionEpoch int           `json:"election_epoch"`
+	Quorum        []int         `json:"quorum"`
+	QuorumNames   []string      `json:"quorum_names"`
+	MonMap        MonMapSummary `json:"monmap"`
+	OsdMap        OsdMapSummary `json:"osdmap"`
+	PgMap         PgMapSummary  `json:"pgmap"`
+}
+
+func (c *Commander) Status() (*ClusterStatus, error) {
+	status := &ClusterStatus{}
+	if _, err := c.Mon(NewCommand("status"), status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (c *Commander) HealthDetail() (*Health, error) {
+	health := &Health{}
+	if _, err := c.Mon(NewCommand("health").Set("detail", "detail"), health); err != nil {
+		return nil, err
+	}
+	return health, nil
+}
+
+type DfStats struct {
+	TotalBytes        uint64  `json:"total_bytes"`
+	TotalUsedBytes    uint64  `json:"total_used_bytes"`
+	TotalAvailBytes   uint64  `json:"total_avail_bytes"`
+	TotalUsedRawBytes uint64  `json:"total_used_raw_bytes"`
+	TotalUsedRawRatio float64 `json:"total_used_raw_ratio"`
+}
+
+type DfPool struct {
+	Name  string `json:"name"`
+	Id    int64  `json:"id"`
+	Stats struct {
+		Stored      uint64  `json:"stored"`
+		Objects     uint64  `json:"objects"`
+		KbUsed      uint64  `json:"kb_used"`
+		BytesUsed   uint64  `json:"bytes_used"`
+		PercentUsed float64 `json:"percent_used"`
+		MaxAvail    uint64  `json:"max_avail"`
+	} `json:"stats"`
+}
+
+// ceph df
+type ClusterDf struct {
+	Stats        DfStats            `json:"stats"`
+	StatsByClass map[string]DfStats `json:"stats_by_class"`
+	Pools        []DfPool           `json:"pools"`
+}
+
+func (c *Commander) Df() (*ClusterDf, error) {
+	df := &ClusterDf{}
+	if _, err := c.Mon(NewCommand("df"), df); err != nil {
+		return nil, err
+	}
+	return df, nil
+}
+
+type OsdTreeNode struct {
+	Id              int     `json:"id"`
+	Name            string  `json:"name"`
+	Type            string  `json:"type"`
+	TypeId          int     `json:"type_id"`
+	Children        []int   `json:"children,omitempty"`
+	DeviceClass     string  `json:"device_class,omitempty"`
+	CrushWeight     float64 `json:"crush_weight"`
+	Depth           int     `json:"depth"`
+	Exists          int     `json:"exists,omitempty"`
+	Status          string  `json:"status,omitempty"`
+	Reweight        float64 `json:"reweight"`
+	PrimaryAffinity float64 `json:"primary_affinity"`
+}
+
+// ceph osd tree
+type OsdTree struct {
+	Nodes []OsdTreeNode `json:"nodes"`
+	Stray []OsdTreeNode `json:"stray"`
+}
+
+func (c *Commander) OsdTree() (*OsdTree, error) {
+	tree := &OsdTree{}
+	if _, err := c.Mon(NewCommand("osd tree"), tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// ceph pg stat
+type PgStat struct {
+	NumPgByState    []PgStateCount `json:"num_pg_by_state"`
+	NumPgs          int            `json:"num_pgs"`
+	NumBytes        uint64         `json:"num_bytes"`
+	TotalBytes      uint64         `json:"total_bytes"`
+	TotalAvailBytes uint64         `json:"total_avail_bytes"`
+	TotalUsedBytes  uint64         `json:"total_used_bytes"`
+}
+
+// nautilus及以后版本输出嵌套在pg_summary中，状态统计字段为name/num
+func (p *PgStat) UnmarshalJSON(data []byte) error {
+	type pgStateNum struct {
+		Name string `json:"name"`
+		Num  int    `json:"num"`
+	}
+	type summary struct {
+		NumPgByState    []pgStateNum `json:"num_pg_by_state"`
+		NumPgs          int          `json:"num_pgs"`
+		NumBytes        uint64       `json:"num_bytes"`
+		TotalBytes      uint64       `json:"total_bytes"`
+		TotalAvailBytes uint64       `json:"total_avail_bytes"`
+		TotalUsedBytes  uint64       `json:"total_used_bytes"`
+	}
+	raw := struct {
+		summary
+		PgSummary *summary `json:"pg_summary"`
+	}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	s := raw.summary
+	if raw.PgSummary != nil {
+		s = *raw.PgSummary
+	}
+	p.NumPgByState = []PgStateCount{}
+	for _, state := range s.NumPgByState {
+		p.NumPgByState = append(p.NumPgByState, PgStateCount{StateName: state.Name, Count: state.Num})
+	}
+	p.NumPgs = s.NumPgs
+	p.NumBytes = s.NumBytes
+	p.TotalBytes = s.TotalBytes
+	p.TotalAvailBytes = s.TotalAvailBytes
+	p.TotalUsedBytes = s.TotalUsedBytes
+	return nil
+}
+
+func (c *Commander) PgStat() (*PgStat, error) {
+	stat := &PgStat{}
+	if _, err := c.Mon(NewCommand("pg stat"), stat); err != nil {
+		return nil, err
+	}
+	return stat, nil
+}
+
+// 命令执行失败的错误信息
+func commandError(kind string, cmd string, ret interface{}, outs string) error {
+	prefix := cmd
+	args := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(cmd), &args); err == nil {
+		if p, ok := args["prefix"].(string); ok {
+			prefix = p
+		}
+	}
+	message := kind + " command[" + prefix + "] execute fail " + fmt.Sprintf("%v", ret)
+	if outs != "" {
+		message += " " + outs
+	}
+	return errors.New(message)
+}
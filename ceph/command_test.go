@@ -0,0 +1,100 @@
+package ceph
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNewCommand(t *testing.T) {
+	cmd := NewCommand("osd pool get").Set("pool", "rbd").Set("var", "size")
+	args := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(cmd.String()), &args); err != nil {
+		t.Fatal(err)
+	}
+	if args["prefix"] != "osd pool get" || args["format"] != "json" || args["pool"] != "rbd" {
+		t.Fatalf("command %s", cmd)
+	}
+}
+
+func TestClusterStatus_decode(t *testing.T) {
+	// nautilus格式，osdmap多嵌套一层
+	out := []byte(`{"fsid": "abc", "health": {"status": "HEALTH_WARN", "checks": {
+		"OSD_DOWN": {"severity": "HEALTH_WARN", "summary": {"message": "1 osds down"}},
+		"MON_CLOCK_SKEW": {"severity": "HEALTH_WARN", "summary": {"message": "clock skew detected"}}}},
+		"election_epoch": 8, "quorum": [0, 1], "quorum_names": ["a", "b"],
+		"osdmap": {"osdmap": {"epoch": 12, "num_osds": 3, "num_up_osds": 2, "num_in_osds": 3}},
+		"pgmap": {"pgs_by_state": [{"state_name": "active+clean", "count": 64}], "num_pgs": 64, "bytes_total": 100}}`)
+	status := &ClusterStatus{}
+	if err := json.Unmarshal(out, status); err != nil {
+		t.Fatal(err)
+	}
+	if status.OsdMap.NumUpOsds != 2 || status.OsdMap.Epoch != 12 {
+		t.Fatalf("osdmap %+v", status.OsdMap)
+	}
+	if len(status.Health.Checks) != 2 || status.Health.Checks[0].Name != "MON_CLOCK_SKEW" {
+		t.Fatalf("health %+v", status.Health)
+	}
+	if status.PgMap.PgsByState[0].Count != 64 {
+		t.Fatalf("pgmap %+v", status.PgMap)
+	}
+}
+
+func TestPgStat_decode(t *testing.T) {
+	for _, out := range []string{
+		`{"num_pg_by_state": [{"name": "active+clean", "num": 8}], "num_pgs": 8}`,
+		`{"pg_ready": true, "pg_summary": {"num_pg_by_state": [{"name": "active+clean", "num": 8}], "num_pgs": 8}}`,
+	} {
+		stat := &PgStat{}
+		if err := json.Unmarshal([]byte(out), stat); err != nil {
+			t.Fatal(err)
+		}
+		if stat.NumPgs != 8 || stat.NumPgByState[0].StateName != "active+clean" {
+			t.Fatalf("pg stat %+v", stat)
+		}
+	}
+}
+
+func TestCommander(t *testing.T) {
+	rados := newConnectedFake(t)
+	rados.cluster.osds[1].up = false
+	commander := NewCommander(rados)
+
+	status, err := commander.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Health.Status != "HEALTH_WARN" || status.OsdMap.NumUpOsds != 2 || len(status.QuorumNames) != 3 {
+		t.Fatalf("status %+v", status)
+	}
+	health, err := commander.HealthDetail()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(health.Checks) != 1 || len(health.Checks[0].Detail) != 1 {
+		t.Fatalf("health %+v", health)
+	}
+	tree, err := commander.OsdTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.Nodes) != 7 || tree.Nodes[0].Type != "root" {
+		t.Fatalf("tree %+v", tree)
+	}
+	df, err := commander.Df()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if df.Stats.TotalBytes != 3*fakeOsdBytes || len(df.Pools) != 3 {
+		t.Fatalf("df %+v", df)
+	}
+	stat, err := commander.PgStat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.NumPgs != 3*POOL_DEFAULT_PG_NUM {
+		t.Fatalf("pg stat %+v", stat)
+	}
+	if _, err := commander.Mon(NewCommand("no such command"), nil); err == nil {
+		t.Fatal("expected error for an unknown command")
+	}
+}
@@ -0,0 +1,602 @@
+package ceph
+
+// crush map解析、修改及规则管理
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	CRUSH_WEIGHT_ONE = 0x10000 // crush中的权重为16.16定点数
+	CRUSH_ITEM_NONE  = 0x7fffffff
+
+	CRUSH_RULE_REPLICATED = 1
+	CRUSH_RULE_ERASURE    = 3
+
+	CRUSH_BUCKET_STRAW2 = "straw2"
+)
+
+// 默认的bucket类型，type_id为下标
+var CRUSH_TYPES = []string{"osd", "host", "chassis", "rack", "row", "pdu", "pod", "room", "datacenter", "zone", "region", "root"}
+
+type CrushDevice struct {
+	Id    int    `json:"id"`
+	Name  string `json:"name"`
+	Class string `json:"class,omitempty"`
+}
+
+type CrushType struct {
+	TypeId int    `json:"type_id"`
+	Name   string `json:"name"`
+}
+
+type CrushBucketItem struct {
+	Id     int `json:"id"`
+	Weight int `json:"weight"` // 16.16定点数
+	Pos    int `json:"pos"`
+}
+
+type CrushBucket struct {
+	Id       int               `json:"id"`
+	Name     string            `json:"name"`
+	TypeId   int               `json:"type_id"`
+	TypeName string            `json:"type_name"`
+	Weight   int               `json:"weight"`
+	Alg      string            `json:"alg"`
+	Hash     string            `json:"hash"`
+	Items    []CrushBucketItem `json:"items"`
+}
+
+type CrushRuleStep struct {
+	Op       string `json:"op"`
+	Item     int    `json:"item,omitempty"`
+	ItemName string `json:"item_name,omitempty"`
+	Num      int    `json:"num,omitempty"`
+	Type     string `json:"type,omitempty"`
+}
+
+type CrushRule struct {
+	RuleId   int             `json:"rule_id"`
+	RuleName string          `json:"rule_name"`
+	Type     int             `json:"type"`
+	MinSize  int             `json:"min_size,omitempty"`
+	MaxSize  int             `json:"max_size,omitempty"`
+	Steps    []CrushRuleStep `json:"steps"`
+}
+
+type CrushTunables struct {
+	ChooseLocalTries         int    `json:"choose_local_tries"`
+	ChooseLocalFallbackTries int    `json:"choose_local_fallback_tries"`
+	ChooseTotalTries         int    `json:"choose_total_tries"`
+	ChooseleafDescendOnce    int    `json:"chooseleaf_descend_once"`
+	ChooseleafVaryR          int    `json:"chooseleaf_vary_r"`
+	ChooseleafStable         int    `json:"chooseleaf_stable"`
+	StrawCalcVersion         int    `json:"straw_calc_version"`
+	AllowedBucketAlgs        int    `json:"allowed_bucket_algs"`
+	Profile                  string `json:"profile"`
+}
+
+// ceph osd crush dump，包括设备类型的影子bucket，如default~hdd
+type CrushMap struct {
+	Devices  []CrushDevice `json:"devices"`
+	Types    []CrushType   `json:"types"`
+	Buckets  []CrushBucket `json:"buckets"`
+	Rules    []CrushRule   `json:"rules"`
+	Tunables CrushTunables `json:"tunables"`
+}
+
+// 树形结构中的bucket或osd
+type CrushNode struct {
+	Id       int          `json:"id"`
+	Name     string       `json:"name"`
+	Type     string       `json:"type"`
+	Class    string       `json:"class,omitempty"`
+	Weight   float64      `json:"weight"`
+	Children []*CrushNode `json:"children,omitempty"`
+}
+
+func crushWeight(weight int) float64 {
+	return float64(weight) / CRUSH_WEIGHT_ONE
+}
+
+// 影子bucket的名称为 原名称~设备类型
+func crushShadow(name string) (base string, class string, ok bool) {
+	i := strings.Index(name, "~")
+	if i < 0 {
+		return name, "", false
+	}
+	return name[:i], name[i+1:], true
+}
+
+func (m *CrushMap) Clone() *CrushMap {
+	data, _ := json.Marshal(m)
+	clone := &CrushMap{}
+	json.Unmarshal(data, clone)
+	return clone
+}
+
+func (m *CrushMap) bucket(id int) *CrushBucket {
+	for i := range m.Buckets {
+		if m.Buckets[i].Id == id {
+			return &m.Buckets[i]
+		}
+	}
+	return nil
+}
+
+func (m *CrushMap) bucketByName(name string) *CrushBucket {
+	for i := range m.Buckets {
+		if m.Buckets[i].Name == name {
+			return &m.Buckets[i]
+		}
+	}
+	return nil
+}
+
+func (m *CrushMap) device(id int) *CrushDevice {
+	for i := range m.Devices {
+		if m.Devices[i].Id == id {
+			return &m.Devices[i]
+		}
+	}
+	return nil
+}
+
+func (m *CrushMap) deviceByName(name string) *CrushDevice {
+	for i := range m.Devices {
+		if m.Devices[i].Name == name {
+			return &m.Devices[i]
+		}
+	}
+	return nil
+}
+
+func (m *CrushMap) typeId(name string) (int, bool) {
+	for _, t := range m.Types {
+		if t.Name == name {
+			return t.TypeId, true
+		}
+	}
+	return 0, false
+}
+
+func (m *CrushMap) typeName(id int) string {
+	for _, t := range m.Types {
+		if t.TypeId == id {
+			return t.Name
+		}
+	}
+	return strconv.Itoa(id)
+}
+
+func (m *CrushMap) Rule(name string) *CrushRule {
+	for i := range m.Rules {
+		if m.Rules[i].RuleName == name {
+			return &m.Rules[i]
+		}
+	}
+	return nil
+}
+
+func (m *CrushMap) ruleById(id int) *CrushRule {
+	for i := range m.Rules {
+		if m.Rules[i].RuleId == id {
+			return &m.Rules[i]
+		}
+	}
+	return nil
+}
+
+// 不在其他bucket中的bucket，shadow为true时返回影子bucket
+func (m *CrushMap) roots(shadow bool) []*CrushBucket {
+	children := map[int]bool{}
+	for _, b := range m.Buckets {
+		for _, item := range b.Items {
+			children[item.Id] = true
+		}
+	}
+	roots := []*CrushBucket{}
+	for i := range m.Buckets {
+		_, _, isShadow := crushShadow(m.Buckets[i].Name)
+		if !children[m.Buckets[i].Id] && isShadow == shadow {
+			roots = append(roots, &m.Buckets[i])
+		}
+	}
+	return roots
+}
+
+// 所在的非影子bucket
+func (m *CrushMap) parent(id int) *CrushBucket {
+	for i := range m.Buckets {
+		if _, _, shadow := crushShadow(m.Buckets[i].Name); shadow {
+			continue
+		}
+		for _, item := range m.Buckets[i].Items {
+			if item.Id == id {
+				return &m.Buckets[i]
+			}
+		}
+	}
+	return nil
+}
+
+// 不包括影子bucket的树
+func (m *CrushMap) Tree() []*CrushNode {
+	var node func(id int, weight int) *CrushNode
+	node = func(id int, weight int) *CrushNode {
+		if id >= 0 {
+			n := &CrushNode{Id: id, Name: "osd." + strconv.Itoa(id), Type: m.typeName(0), Weight: crushWeight(weight)}
+			if d := m.device(id); d != nil {
+				n.Name = d.Name
+				n.Class = d.Class
+			}
+			return n
+		}
+		b := m.bucket(id)
+		n := &CrushNode{Id: id, Name: b.Name, Type: b.TypeName, Weight: crushWeight(b.Weight), Children: []*CrushNode{}}
+		for _, item := range b.Items {
+			n.Children = append(n.Children, node(item.Id, item.Weight))
+		}
+		return n
+	}
+	tree := []*CrushNode{}
+	for _, root := range m.roots(false) {
+		tree = append(tree, node(root.Id, root.Weight))
+	}
+	return tree
+}
+
+// 已使用的设备类型
+func (m *CrushMap) Classes() []string {
+	classes := []string{}
+	for _, d := range m.Devices {
+		if d.Class != "" && !hasFlag(classes, d.Class) {
+			classes = append(classes, d.Class)
+		}
+	}
+	sort.Strings(classes)
+	return classes
+}
+
+func (m *CrushMap) nextBucketId() int {
+	id := -1
+	for _, b := range m.Buckets {
+		if b.Id <= id {
+			id = b.Id - 1
+		}
+	}
+	return id
+}
+
+func (m *CrushMap) addBucket(name string, typeId int) *CrushBucket {
+	m.Buckets = append(m.Buckets, CrushBucket{
+		Id:       m.nextBucketId(),
+		Name:     name,
+		TypeId:   typeId,
+		TypeName: m.typeName(typeId),
+		Alg:      CRUSH_BUCKET_STRAW2,
+		Hash:     "rjenkins1",
+		Items:    []CrushBucketItem{},
+	})
+	return &m.Buckets[len(m.Buckets)-1]
+}
+
+func (b *CrushBucket) removeItem(id int) {
+	items := []CrushBucketItem{}
+	for _, item := range b.Items {
+		if item.Id != id {
+			item.Pos = len(items)
+			items = append(items, item)
+		}
+	}
+	b.Items = items
+}
+
+// 重建影子bucket，保留已有影子bucket的id，然后重新计算权重
+// 与ceph一致，每个根节点的每种设备类型都有完整的影子树
+func (m *CrushMap) rebuild() {
+	ids := map[string]int{}
+	buckets := []CrushBucket{}
+	for _, b := range m.Buckets {
+		if _, _, shadow := crushShadow(b.Name); shadow {
+			ids[b.Name] = b.Id
+		} else {
+			buckets = append(buckets, b)
+		}
+	}
+	m.Buckets = buckets
+	nextId := m.nextBucketId()
+	for _, id := range ids {
+		if id <= nextId {
+			nextId = id - 1
+		}
+	}
+
+	var clone func(b CrushBucket, class string) int
+	clone = func(b CrushBucket, class string) int {
+		name := b.Name + "~" + class
+		id, ok := ids[name]
+		if !ok {
+			id = nextId
+			nextId--
+		}
+		shadow := CrushBucket{Id: id, Name: name, TypeId: b.TypeId, TypeName: b.TypeName, Alg: b.Alg, Hash: b.Hash, Items: []CrushBucketItem{}}
+		for _, item := range b.Items {
+			if item.Id >= 0 {
+				if d := m.device(item.Id); d == nil || d.Class != class {
+					continue
+				}
+				shadow.Items = append(shadow.Items, CrushBucketItem{Id: item.Id, Weight: item.Weight, Pos: len(shadow.Items)})
+				continue
+			}
+			child := clone(*m.bucket(item.Id), class)
+			shadow.Items = append(shadow.Items, CrushBucketItem{Id: child, Pos: len(shadow.Items)})
+		}
+		m.Buckets = append(m.Buckets, shadow)
+		return id
+	}
+	roots := m.roots(false)
+	real := []CrushBucket{}
+	for _, root := range roots {
+		real = append(real, *root)
+	}
+	for _, class := range m.Classes() {
+		for _, root := range real {
+			clone(root, class)
+		}
+	}
+	sort.Slice(m.Buckets, func(i, j int) bool { return m.Buckets[i].Id > m.Buckets[j].Id })
+
+	// 自底向上计算bucket权重
+	var weight func(b *CrushBucket) int
+	weight = func(b *CrushBucket) int {
+		b.Weight = 0
+		for i, item := range b.Items {
+			if item.Id < 0 {
+				b.Items[i].Weight = weight(m.bucket(item.Id))
+			}
+			b.Weight += b.Items[i].Weight
+		}
+		return b.Weight
+	}
+	for _, root := range m.roots(false) {
+		weight(root)
+	}
+	for _, root := range m.roots(true) {
+		weight(root)
+	}
+}
+
+// 移动bucket到location，如{"root": "default", "rack": "rack1"}，不存在的上级bucket会被创建
+func (m *CrushMap) Move(name string, location map[string]string) error {
+	b := m.bucketByName(name)
+	if b == nil {
+		if m.deviceByName(name) != nil {
+			return errors.New("cannot move device [" + name + "], only bucket can be moved")
+		}
+		return errors.New("crush bucket [" + name + "] does not exist")
+	}
+	if _, _, shadow := crushShadow(name); shadow {
+		return errors.New("cannot move shadow bucket [" + name + "]")
+	}
+	id, typeId := b.Id, b.TypeId
+	if len(location) == 0 {
+		return errors.New("crush location is empty")
+	}
+	// 按类型从低到高排列
+	levels := []int{}
+	for t, n := range location {
+		tid, ok := m.typeId(t)
+		if !ok {
+			return errors.New("unknown crush type [" + t + "]")
+		}
+		if tid <= typeId {
+			return errors.New("cannot move " + b.TypeName + " [" + name + "] under " + t + " [" + n + "]")
+		}
+		if p := m.bucketByName(n); p != nil && p.TypeId != tid {
+			return errors.New("crush bucket [" + n + "] is " + p.TypeName + ", not " + t)
+		}
+		levels = append(levels, tid)
+	}
+	sort.Ints(levels)
+	// 不能移动到自己的子树中
+	for _, tid := range levels {
+		for p := m.bucketByName(location[m.typeName(tid)]); p != nil; p = m.parent(p.Id) {
+			if p.Id == id {
+				return errors.New("cannot move crush bucket [" + name + "] into its own subtree")
+			}
+		}
+	}
+	if p := m.parent(id); p != nil && p.Name == location[m.typeName(levels[0])] {
+		return nil
+	}
+
+	if p := m.parent(id); p != nil {
+		p.removeItem(id)
+	}
+	child := id
+	for _, tid := range levels {
+		n := location[m.typeName(tid)]
+		p := m.bucketByName(n)
+		exists := p != nil
+		if !exists {
+			p = m.addBucket(n, tid)
+		}
+		p.Items = append(p.Items, CrushBucketItem{Id: child, Pos: len(p.Items)})
+		if exists {
+			break
+		}
+		child = p.Id
+	}
+	m.rebuild()
+	return nil
+}
+
+// 修改osd的crush权重，单位为TiB
+func (m *CrushMap) Reweight(name string, weight float64) error {
+	if weight < 0 {
+		return errors.New("invalid crush weight " + strconv.FormatFloat(weight, 'f', -1, 64))
+	}
+	d := m.deviceByName(name)
+	if d == nil {
+		if m.bucketByName(name) != nil {
+			return errors.New("device [" + name + "] is not a leaf in the crush map")
+		}
+		return errors.New("device [" + name + "] does not appear in the crush map")
+	}
+	for i := range m.Buckets {
+		for j := range m.Buckets[i].Items {
+			if m.Buckets[i].Items[j].Id == d.Id {
+				m.Buckets[i].Items[j].Weight = int(weight * CRUSH_WEIGHT_ONE)
+			}
+		}
+	}
+	m.rebuild()
+	return nil
+}
+
+// 规则中take的根节点和设备类型
+func (r *CrushRule) Root() (root string, class string) {
+	for _, step := range r.Steps {
+		if step.Op == "take" {
+			root, class, _ = crushShadow(step.ItemName)
+			return root, class
+		}
+	}
+	return "", ""
+}
+
+func (c *Commander) CrushDump() (*CrushMap, error) {
+	m := &CrushMap{}
+	if _, err := c.Mon(NewCommand("osd crush dump"), m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// 副本规则，failureDomain为故障域类型，默认host，class为空时使用所有设备
+func (c *Commander) CrushRuleCreate(name string, root string, failureDomain string, class string) (string, error) {
+	if name == "" || root == "" {
+		return "", errors.New("crush rule name or root is empty")
+	}
+	if failureDomain == "" {
+		failureDomain = "host"
+	}
+	cmd := NewCommand("osd crush rule create-replicated").Set("name", name).Set("root", root).Set("type", failureDomain)
+	if class != "" {
+		cmd.Set("class", class)
+	}
+	return c.Mon(cmd, nil)
+}
+
+// 使用中的规则不能删除
+func (c *Commander) CrushRuleRemove(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("crush rule name is empty")
+	}
+	return c.Mon(NewCommand("osd crush rule rm").Set("name", name), nil)
+}
+
+func crushLocation(location map[string]string) []string {
+	args := []string{}
+	for t, n := range location {
+		args = append(args, t+"="+n)
+	}
+	sort.Strings(args)
+	return args
+}
+
+func (c *Commander) CrushMove(name string, location map[string]string) (string, error) {
+	if name == "" || len(location) == 0 {
+		return "", errors.New("crush bucket name or location is empty")
+	}
+	return c.Mon(NewCommand("osd crush move").Set("name", name).Set("args", crushLocation(location)), nil)
+}
+
+func (c *Commander) CrushReweight(name string, weight float64) (string, error) {
+	if name == "" {
+		return "", errors.New("crush device name is empty")
+	}
+	if weight < 0 {
+		return "", errors.New("invalid crush weight " + strconv.FormatFloat(weight, 'f', -1, 64))
+	}
+	return c.Mon(NewCommand("osd crush reweight").Set("name", name).Set("weight", weight), nil)
+}
+
+// 存储池的pg参数及osd的reweight
+func (c *Commander) crushPools() ([]crushPool, []uint32, error) {
+	dump := struct {
+		Pools []osdDumpPool `json:"pools"`
+		Osds  []struct {
+			Osd    int     `json:"osd"`
+			In     int     `json:"in"`
+			Weight float64 `json:"weight"`
+		} `json:"osds"`
+	}{}
+	if _, err := c.Mon(NewCommand("osd dump"), &dump); err != nil {
+		return nil, nil, err
+	}
+	df, err := c.Df()
+	if err != nil {
+		return nil, nil, err
+	}
+	used := map[int64]uint64{}
+	for _, pool := range df.Pools {
+		used[pool.Id] = pool.Stats.BytesUsed
+	}
+	pools := []crushPool{}
+	for _, p := range dump.Pools {
+		pool := crushPool{
+			id:      p.Pool,
+			name:    p.PoolName,
+			pgNum:   p.PgNum,
+			pgpNum:  p.PgPlacementNum,
+			size:    p.Size,
+			rule:    p.CrushRule,
+			erasure: p.Type == CRUSH_RULE_ERASURE,
+		}
+		if pool.pgNum > 0 && pool.size > 0 {
+			pool.shardBytes = used[p.Pool] / uint64(pool.pgNum*pool.size)
+		}
+		pools = append(pools, pool)
+	}
+	weights := []uint32{}
+	for _, osd := range dump.Osds {
+		for len(weights) <= osd.Osd {
+			weights = append(weights, 0)
+		}
+		if osd.In != 0 {
+			weights[osd.Osd] = uint32(osd.Weight * CRUSH_WEIGHT_ONE)
+		}
+	}
+	return pools, weights, nil
+}
+
+// 在当前crush map的副本上执行change，预测数据迁移，不修改集群
+func (c *Commander) CrushDryRun(change func(m *CrushMap) error) (*CrushMovement, error) {
+	before, err := c.CrushDump()
+	if err != nil {
+		return nil, err
+	}
+	after := before.Clone()
+	if err := change(after); err != nil {
+		return nil, err
+	}
+	pools, weights, err := c.crushPools()
+	if err != nil {
+		return nil, err
+	}
+	return crushMovement(before, after, pools, weights)
+}
+
+func (c *Commander) CrushMoveDryRun(name string, location map[string]string) (*CrushMovement, error) {
+	return c.CrushDryRun(func(m *CrushMap) error { return m.Move(name, location) })
+}
+
+func (c *Commander) CrushReweightDryRun(name string, weight float64) (*CrushMovement, error) {
+	return c.CrushDryRun(func(m *CrushMap) error { return m.Reweight(name, weight) })
+}
@@ -0,0 +1,599 @@
+package ceph
+
+// crush规则计算，与ceph的mapper.c一致，只支持straw2类型的bucket
+// 用于在修改前预测pg映射的变化
+
+import (
+	"errors"
+	"math/bits"
+	"sort"
+	"strconv"
+)
+
+const crushHashSeed = 1315423911
+
+func crushHashMix(a, b, c uint32) (uint32, uint32, uint32) {
+	a -= b
+	a -= c
+	a ^= c >> 13
+	b -= c
+	b -= a
+	b ^= a << 8
+	c -= a
+	c -= b
+	c ^= b >> 13
+	a -= b
+	a -= c
+	a ^= c >> 12
+	b -= c
+	b -= a
+	b ^= a << 16
+	c -= a
+	c -= b
+	c ^= b >> 5
+	a -= b
+	a -= c
+	a ^= c >> 3
+	b -= c
+	b -= a
+	b ^= a << 10
+	c -= a
+	c -= b
+	c ^= b >> 15
+	return a, b, c
+}
+
+// rjenkins1
+func crushHash32_2(a, b uint32) uint32 {
+	hash := crushHashSeed ^ a ^ b
+	x := uint32(231232)
+	y := uint32(1232)
+	a, b, hash = crushHashMix(a, b, hash)
+	x, a, hash = crushHashMix(x, a, hash)
+	b, y, hash = crushHashMix(b, y, hash)
+	return hash
+}
+
+func crushHash32_3(a, b, c uint32) uint32 {
+	hash := crushHashSeed ^ a ^ b ^ c
+	x := uint32(231232)
+	y := uint32(1232)
+	a, b, hash = crushHashMix(a, b, hash)
+	c, x, hash = crushHashMix(c, x, hash)
+	y, a, hash = crushHashMix(y, a, hash)
+	b, x, hash = crushHashMix(b, x, hash)
+	y, c, hash = crushHashMix(y, c, hash)
+	return hash
+}
+
+// 2^44*log2(x+1)，x为16位
+func crushLn(xin uint32) uint64 {
+	x := xin + 1
+	iexpon := 15
+	if x&0x18000 == 0 {
+		n := bits.LeadingZeros32(x&0x1ffff) - 16
+		x <<= uint(n)
+		iexpon = 15 - n
+	}
+	index1 := (x >> 8) << 1
+	rh := crushRHLH[index1-256]
+	lh := crushRHLH[index1+1-256]
+	xl64 := (uint64(x) * rh) >> 48
+	result := uint64(iexpon) << (12 + 32)
+	lh += crushLL[xl64&0xff]
+	lh >>= 48 - 12 - 32
+	return result + lh
+}
+
+type crushMapper struct {
+	m          *CrushMap
+	buckets    map[int]*CrushBucket
+	maxDevices int
+	weights    []uint32 // osd的reweight，16.16定点数
+}
+
+func newCrushMapper(m *CrushMap, weights []uint32) (*crushMapper, error) {
+	c := &crushMapper{m: m, buckets: map[int]*CrushBucket{}, weights: weights}
+	for i := range m.Buckets {
+		b := &m.Buckets[i]
+		if b.Alg != CRUSH_BUCKET_STRAW2 {
+			return nil, errors.New("crush bucket [" + b.Name + "] alg " + b.Alg + " is not supported, only straw2")
+		}
+		c.buckets[b.Id] = b
+	}
+	for _, d := range m.Devices {
+		if d.Id >= c.maxDevices {
+			c.maxDevices = d.Id + 1
+		}
+	}
+	return c, nil
+}
+
+func (c *crushMapper) straw2(b *CrushBucket, x uint32, r int) int {
+	high := 0
+	var highDraw int64
+	for i, item := range b.Items {
+		var draw int64
+		if item.Weight > 0 {
+			u := crushHash32_3(x, uint32(item.Id), uint32(r)) & 0xffff
+			ln := int64(crushLn(u)) - 0x1000000000000
+			draw = ln / int64(item.Weight)
+		} else {
+			draw = -1 << 63
+		}
+		if i == 0 || draw > highDraw {
+			high = i
+			highDraw = draw
+		}
+	}
+	return b.Items[high].Id
+}
+
+func (c *crushMapper) itemType(item int) int {
+	if item < 0 {
+		if b, ok := c.buckets[item]; ok {
+			return b.TypeId
+		}
+	}
+	return 0
+}
+
+// 按reweight概率性地拒绝osd
+func (c *crushMapper) isOut(item int, x uint32) bool {
+	if item >= len(c.weights) {
+		return true
+	}
+	weight := c.weights[item]
+	if weight >= CRUSH_WEIGHT_ONE {
+		return false
+	}
+	if weight == 0 {
+		return true
+	}
+	return crushHash32_2(x, uint32(item))&0xffff >= weight
+}
+
+type crushChoose struct {
+	tries        int
+	recurseTries int
+	localRetries int
+	varyR        int
+	stable       int
+}
+
+func (c *crushMapper) chooseFirstn(bucket *CrushBucket, x uint32, numrep int, typ int, out []int, outpos int, outSize int,
+	opts crushChoose, recurseToLeaf bool, out2 []int, parentR int) int {
+	count := outSize
+	rep := outpos
+	if opts.stable != 0 {
+		rep = 0
+	}
+	for ; rep < numrep && count > 0; rep++ {
+		ftotal := 0
+		skip := false
+		item := 0
+		for {
+			retryDescent := false
+			in := bucket
+			flocal := 0
+			for {
+				retryBucket := false
+				collide := false
+				reject := false
+				r := rep + parentR + ftotal
+				if len(in.Items) == 0 {
+					reject = true
+				} else {
+					item = c.straw2(in, x, r)
+					if item >= c.maxDevices {
+						skip = true
+						break
+					}
+					itemType := c.itemType(item)
+					if itemType != typ {
+						next, ok := c.buckets[item]
+						if item >= 0 || !ok {
+							skip = true
+							break
+						}
+						in = next
+						continue
+					}
+					for i := 0; i < outpos; i++ {
+						if out[i] == item {
+							collide = true
+							break
+						}
+					}
+					if !collide && recurseToLeaf {
+						if item < 0 {
+							subR := 0
+							if opts.varyR != 0 {
+								subR = r >> uint(opts.varyR-1)
+							}
+							sub := opts
+							sub.tries = opts.recurseTries
+							sub.recurseTries = 0
+							n := outpos + 1
+							if opts.stable != 0 {
+								n = 1
+							}
+							if c.chooseFirstn(c.buckets[item], x, n, 0, out2, outpos, count, sub, false, nil, subR) <= outpos {
+								reject = true
+							}
+						} else {
+							out2[outpos] = item
+						}
+					}
+					if !reject && !collide && itemType == 0 {
+						reject = c.isOut(item, x)
+					}
+				}
+				if reject || collide {
+					ftotal++
+					flocal++
+					if collide && flocal <= opts.localRetries {
+						retryBucket = true
+					} else if ftotal < opts.tries {
+						retryDescent = true
+					} else {
+						skip = true
+					}
+				}
+				if !retryBucket {
+					break
+				}
+			}
+			if !retryDescent {
+				break
+			}
+		}
+		if skip {
+			continue
+		}
+		out[outpos] = item
+		outpos++
+		count--
+	}
+	return outpos
+}
+
+const crushItemUndef = 0x7ffffffe
+
+func (c *crushMapper) chooseIndep(bucket *CrushBucket, x uint32, left int, numrep int, typ int, out []int, outpos int,
+	tries int, recurseTries int, recurseToLeaf bool, out2 []int, parentR int) {
+	endpos := outpos + left
+	for rep := outpos; rep < endpos; rep++ {
+		out[rep] = crushItemUndef
+		if out2 != nil {
+			out2[rep] = crushItemUndef
+		}
+	}
+	for ftotal := 0; left > 0 && ftotal < tries; ftotal++ {
+		for rep := outpos; rep < endpos; rep++ {
+			if out[rep] != crushItemUndef {
+				continue
+			}
+			in := bucket
+			for {
+				r := rep + parentR + numrep*ftotal
+				if len(in.Items) == 0 {
+					break
+				}
+				item := c.straw2(in, x, r)
+				if item >= c.maxDevices {
+					out[rep] = CRUSH_ITEM_NONE
+					if out2 != nil {
+						out2[rep] = CRUSH_ITEM_NONE
+					}
+					left--
+					break
+				}
+				itemType := c.itemType(item)
+				if itemType != typ {
+					next, ok := c.buckets[item]
+					if item >= 0 || !ok {
+						out[rep] = CRUSH_ITEM_NONE
+						if out2 != nil {
+							out2[rep] = CRUSH_ITEM_NONE
+						}
+						left--
+						break
+					}
+					in = next
+					continue
+				}
+				collide := false
+				for i := outpos; i < endpos; i++ {
+					if out[i] == item {
+						collide = true
+						break
+					}
+				}
+				if collide {
+					break
+				}
+				if recurseToLeaf {
+					if item < 0 {
+						c.chooseIndep(c.buckets[item], x, 1, numrep, 0, out2, rep, recurseTries, 0, false, nil, r)
+						if out2[rep] == CRUSH_ITEM_NONE {
+							break
+						}
+					} else {
+						out2[rep] = item
+					}
+				}
+				if itemType == 0 && c.isOut(item, x) {
+					break
+				}
+				out[rep] = item
+				left--
+				break
+			}
+		}
+	}
+	for rep := outpos; rep < endpos; rep++ {
+		if out[rep] == crushItemUndef {
+			out[rep] = CRUSH_ITEM_NONE
+		}
+		if out2 != nil && out2[rep] == crushItemUndef {
+			out2[rep] = CRUSH_ITEM_NONE
+		}
+	}
+}
+
+// 按规则计算x的映射结果，最多resultMax个osd，indep规则中无法映射的位置为CRUSH_ITEM_NONE
+func (c *crushMapper) doRule(rule *CrushRule, x uint32, resultMax int) ([]int, error) {
+	t := c.m.Tunables
+	chooseTries := t.ChooseTotalTries + 1
+	chooseLeafTries := 0
+	localRetries := t.ChooseLocalTries
+	varyR := t.ChooseleafVaryR
+	stable := t.ChooseleafStable
+
+	result := []int{}
+	w := []int{}
+	for _, step := range rule.Steps {
+		switch step.Op {
+		case "take":
+			_, isBucket := c.buckets[step.Item]
+			if !(step.Item >= 0 && step.Item < c.maxDevices) && !isBucket {
+				return nil, errors.New("crush rule [" + rule.RuleName + "] takes unknown item " + strconv.Itoa(step.Item))
+			}
+			w = []int{step.Item}
+		case "set_choose_tries":
+			if step.Num > 0 {
+				chooseTries = step.Num
+			}
+		case "set_chooseleaf_tries":
+			if step.Num > 0 {
+				chooseLeafTries = step.Num
+			}
+		case "set_choose_local_tries":
+			if step.Num >= 0 {
+				localRetries = step.Num
+			}
+		case "set_chooseleaf_vary_r":
+			if step.Num >= 0 {
+				varyR = step.Num
+			}
+		case "set_chooseleaf_stable":
+			if step.Num >= 0 {
+				stable = step.Num
+			}
+		case "choose_firstn", "chooseleaf_firstn", "choose_indep", "chooseleaf_indep":
+			typ, ok := c.m.typeId(step.Type)
+			if !ok {
+				return nil, errors.New("crush rule [" + rule.RuleName + "] uses unknown type " + step.Type)
+			}
+			recurseToLeaf := step.Op == "chooseleaf_firstn" || step.Op == "chooseleaf_indep"
+			firstn := step.Op == "choose_firstn" || step.Op == "chooseleaf_firstn"
+			o := make([]int, resultMax)
+			c2 := make([]int, resultMax)
+			osize := 0
+			for _, item := range w {
+				numrep := step.Num
+				if numrep <= 0 {
+					numrep += resultMax
+					if numrep <= 0 {
+						continue
+					}
+				}
+				bucket, ok := c.buckets[item]
+				if !ok {
+					continue
+				}
+				if firstn {
+					recurseTries := chooseTries
+					if chooseLeafTries > 0 {
+						recurseTries = chooseLeafTries
+					} else if t.ChooseleafDescendOnce != 0 {
+						recurseTries = 1
+					}
+					opts := crushChoose{tries: chooseTries, recurseTries: recurseTries, localRetries: localRetries, varyR: varyR, stable: stable}
+					osize += c.chooseFirstn(bucket, x, numrep, typ, o[osize:], 0, resultMax-osize, opts, recurseToLeaf, c2[osize:], 0)
+				} else {
+					size := numrep
+					if resultMax-osize < size {
+						size = resultMax - osize
+					}
+					recurseTries := 1
+					if chooseLeafTries > 0 {
+						recurseTries = chooseLeafTries
+					}
+					c.chooseIndep(bucket, x, size, numrep, typ, o[osize:], 0, chooseTries, recurseTries, recurseToLeaf, c2[osize:], 0)
+					osize += size
+				}
+			}
+			if recurseToLeaf {
+				copy(o, c2[:osize])
+			}
+			w = o[:osize]
+		case "emit":
+			for _, item := range w {
+				if len(result) < resultMax {
+					result = append(result, item)
+				}
+			}
+			w = nil
+		}
+	}
+	return result, nil
+}
+
+// 存储池的pg映射参数
+type crushPool struct {
+	id         int64
+	name       string
+	pgNum      int
+	pgpNum     int
+	size       int
+	rule       int
+	erasure    bool
+	shardBytes uint64 // pg每个副本或分片的平均大小
+}
+
+func cephStableMod(x, b, bmask uint32) uint32 {
+	if x&bmask < b {
+		return x & bmask
+	}
+	return x & (bmask >> 1)
+}
+
+// pg的crush输入，存储池都有hashpspool标志
+func (p *crushPool) pps(ps int) uint32 {
+	mask := uint32(1)
+	for int(mask) < p.pgpNum {
+		mask <<= 1
+	}
+	return crushHash32_2(cephStableMod(uint32(ps), uint32(p.pgpNum), mask-1), uint32(p.id))
+}
+
+func (c *crushMapper) mapPool(p *crushPool) ([][]int, error) {
+	rule := c.m.ruleById(p.rule)
+	if rule == nil {
+		return nil, errors.New("crush rule " + strconv.Itoa(p.rule) + " of pool[" + p.name + "] does not exist")
+	}
+	pgs := [][]int{}
+	for ps := 0; ps < p.pgNum; ps++ {
+		osds, err := c.doRule(rule, p.pps(ps), p.size)
+		if err != nil {
+			return nil, err
+		}
+		pgs = append(pgs, osds)
+	}
+	return pgs, nil
+}
+
+type CrushPoolMovement struct {
+	Id          int64  `json:"id"`
+	Name        string `json:"name"`
+	Pgs         int    `json:"pgs"`
+	MovedPgs    int    `json:"moved_pgs"`
+	MovedShards int    `json:"moved_shards"` // 需要迁移的副本或分片数
+	MovedBytes  uint64 `json:"moved_bytes"`  // 按pg平均大小估算
+}
+
+type CrushOsdMovement struct {
+	Id        int `json:"id"`
+	PgsBefore int `json:"pgs_before"`
+	PgsAfter  int `json:"pgs_after"`
+}
+
+// 修改crush map后预计的数据迁移，不考虑pg_upmap及osd的up状态
+type CrushMovement struct {
+	Pgs         int                 `json:"pgs"`
+	MovedPgs    int                 `json:"moved_pgs"`
+	MovedShards int                 `json:"moved_shards"`
+	MovedBytes  uint64              `json:"moved_bytes"`
+	Pools       []CrushPoolMovement `json:"pools"`
+	Osds        []CrushOsdMovement  `json:"osds"` // pg数有变化的osd
+}
+
+// 迁移的副本数，副本存储池比较集合，纠删码存储池比较每个位置
+func crushMovedShards(before []int, after []int, erasure bool) int {
+	moved := 0
+	for i, osd := range after {
+		if osd == CRUSH_ITEM_NONE {
+			continue
+		}
+		if erasure {
+			if i >= len(before) || before[i] != osd {
+				moved++
+			}
+			continue
+		}
+		found := false
+		for _, b := range before {
+			if b == osd {
+				found = true
+				break
+			}
+		}
+		if !found {
+			moved++
+		}
+	}
+	return moved
+}
+
+func crushMovement(before *CrushMap, after *CrushMap, pools []crushPool, weights []uint32) (*CrushMovement, error) {
+	mb, err := newCrushMapper(before, weights)
+	if err != nil {
+		return nil, err
+	}
+	ma, err := newCrushMapper(after, weights)
+	if err != nil {
+		return nil, err
+	}
+	movement := &CrushMovement{Pools: []CrushPoolMovement{}, Osds: []CrushOsdMovement{}}
+	osds := map[int]*CrushOsdMovement{}
+	count := func(pgs []int, after bool) {
+		for _, osd := range pgs {
+			if osd == CRUSH_ITEM_NONE {
+				continue
+			}
+			if osds[osd] == nil {
+				osds[osd] = &CrushOsdMovement{Id: osd}
+			}
+			if after {
+				osds[osd].PgsAfter++
+			} else {
+				osds[osd].PgsBefore++
+			}
+		}
+	}
+	for i := range pools {
+		p := &pools[i]
+		pb, err := mb.mapPool(p)
+		if err != nil {
+			return nil, err
+		}
+		pa, err := ma.mapPool(p)
+		if err != nil {
+			return nil, err
+		}
+		pm := CrushPoolMovement{Id: p.id, Name: p.name, Pgs: p.pgNum}
+		for ps := range pb {
+			count(pb[ps], false)
+			count(pa[ps], true)
+			if moved := crushMovedShards(pb[ps], pa[ps], p.erasure); moved > 0 {
+				pm.MovedPgs++
+				pm.MovedShards += moved
+			}
+		}
+		pm.MovedBytes = uint64(pm.MovedShards) * p.shardBytes
+		movement.Pgs += pm.Pgs
+		movement.MovedPgs += pm.MovedPgs
+		movement.MovedShards += pm.MovedShards
+		movement.MovedBytes += pm.MovedBytes
+		movement.Pools = append(movement.Pools, pm)
+	}
+	for _, osd := range osds {
+		if osd.PgsBefore != osd.PgsAfter {
+			movement.Osds = append(movement.Osds, *osd)
+		}
+	}
+	sort.Slice(movement.Osds, func(i, j int) bool { return movement.Osds[i].Id < movement.Osds[j].Id })
+	return movement, nil
+}
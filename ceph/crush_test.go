@@ -0,0 +1,291 @@
+package ceph
+
+import (
+	"strings"
+	"testing"
+)
+
+// 期望值按ceph的crush/mapper.c、crush/hash.c及crush_ln_table.h计算
+func TestCrushLn(t *testing.T) {
+	for _, c := range []struct {
+		x  uint32
+		ln uint64
+	}{
+		{0, 0},
+		{0x1, 0x100000000000},
+		{0x2, 0x195c01a39fbd},
+		{0x7f, 0x700000000000},
+		{0x100, 0x80171e3b6d7a},
+		{0x1234, 0xc2fb9e09ec18},
+		{0x8000, 0xf0002e2a60a0},
+		{0xabcd, 0xf6cb4f87c148},
+		{0xfffe, 0xfffffd61ad10},
+		{0xffff, 0x1000000000000},
+	} {
+		if ln := crushLn(c.x); ln != c.ln {
+			t.Fatalf("ln(%#x) %#x, expected %#x", c.x, ln, c.ln)
+		}
+	}
+}
+
+func TestCrushMapper_straw2(t *testing.T) {
+	b := &CrushBucket{Items: []CrushBucketItem{
+		{Id: 0, Weight: 0x10000}, {Id: 1, Weight: 0x10000}, {Id: 2, Weight: 0x20000}, {Id: 3, Weight: 0x8000},
+	}}
+	expected := [][]int{
+		{0, 3, 1, 0, 2, 3, 2, 2, 2, 2, 0, 0, 3, 0, 1, 1},
+		{0, 0, 3, 0, 0, 0, 2, 2, 2, 1, 0, 2, 2, 0, 0, 2},
+	}
+	c := &crushMapper{}
+	for r, items := range expected {
+		for x, item := range items {
+			if got := c.straw2(b, uint32(x), r); got != item {
+				t.Fatalf("straw2 x=%d r=%d %d, expected %d", x, r, got, item)
+			}
+		}
+	}
+}
+
+func TestCrushMap_Tree(t *testing.T) {
+	rados := newConnectedFake(t)
+	commander := NewCommander(rados)
+
+	m, err := commander.CrushDump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := m.Tree()
+	if len(tree) != 1 || tree[0].Name != "default" || tree[0].Type != "root" || len(tree[0].Children) != 3 {
+		t.Fatalf("crush tree %+v", tree)
+	}
+	host := tree[0].Children[0]
+	if host.Name != "node1" || host.Type != "host" || len(host.Children) != 1 || host.Children[0].Name != "osd.0" ||
+		host.Children[0].Class != "hdd" || host.Weight != host.Children[0].Weight {
+		t.Fatalf("crush host %+v", host)
+	}
+	if m.bucketByName("default~hdd") == nil || m.bucketByName("node1~hdd") == nil {
+		t.Fatalf("shadow buckets %+v", m.Buckets)
+	}
+	if classes := m.Classes(); len(classes) != 1 || classes[0] != "hdd" {
+		t.Fatalf("classes %v", classes)
+	}
+	if root, class := m.Rule("replicated_rule").Root(); root != "default" || class != "" {
+		t.Fatalf("rule root %s %s", root, class)
+	}
+}
+
+func TestCommander_CrushRule(t *testing.T) {
+	rados := newConnectedFake(t)
+	commander := NewCommander(rados)
+
+	if _, err := commander.CrushRuleCreate("fast", "default", "", "ssd"); err == nil {
+		t.Fatal("expected error for missing device class")
+	}
+	if _, err := commander.OsdSetDeviceClass("ssd", []int{2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := commander.CrushRuleCreate("fast", "default", "osd", "ssd"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := commander.CrushRuleCreate("bad", "missing", "host", ""); err == nil {
+		t.Fatal("expected error for missing root")
+	}
+	if _, err := commander.CrushRuleCreate("bad", "default", "shelf", ""); err == nil {
+		t.Fatal("expected error for unknown failure domain")
+	}
+	m, _ := commander.CrushDump()
+	rule := m.Rule("fast")
+	if rule == nil || rule.Steps[0].ItemName != "default~ssd" || rule.Steps[1].Type != "osd" {
+		t.Fatalf("crush rule %+v", rule)
+	}
+	if root, class := rule.Root(); root != "default" || class != "ssd" {
+		t.Fatalf("rule root %s %s", root, class)
+	}
+	if classes := m.Classes(); len(classes) != 2 {
+		t.Fatalf("classes %v", classes)
+	}
+
+	// 规则只选择ssd设备
+	mapper, err := newCrushMapper(m, []uint32{CRUSH_WEIGHT_ONE, CRUSH_WEIGHT_ONE, CRUSH_WEIGHT_ONE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := uint32(0); x < 100; x++ {
+		osds, err := mapper.doRule(rule, x, 3)
+		if err != nil || len(osds) != 1 || osds[0] != 2 {
+			t.Fatalf("map %d %v %v", x, osds, err)
+		}
+	}
+
+	if err := rados.Rados_pool_create("ssd", PoolCreateOptions{PgNum: 8, Size: 1, CrushRule: "fast"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := commander.CrushRuleRemove("fast"); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Fatalf("remove rule in use %v", err)
+	}
+	if err := rados.Rados_pool_delete("ssd", "ssd"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := commander.CrushRuleRemove("fast"); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ = commander.CrushDump(); m.Rule("fast") != nil {
+		t.Fatal("rule is not removed")
+	}
+}
+
+func TestCommander_CrushMove(t *testing.T) {
+	rados := newConnectedFake(t)
+	commander := NewCommander(rados)
+
+	if _, err := commander.CrushMove("node1", map[string]string{"root": "default", "rack": "rack1"}); err != nil {
+		t.Fatal(err)
+	}
+	m, _ := commander.CrushDump()
+	rack := m.bucketByName("rack1")
+	if rack == nil || rack.TypeName != "rack" || len(rack.Items) != 1 || rack.Items[0].Id != m.bucketByName("node1").Id {
+		t.Fatalf("rack %+v", rack)
+	}
+	if p := m.parent(rack.Id); p == nil || p.Name != "default" {
+		t.Fatalf("rack parent %+v", p)
+	}
+	if m.bucketByName("rack1~hdd") == nil || m.bucketByName("default").Weight != m.bucketByName("default~hdd").Weight {
+		t.Fatalf("shadow buckets %+v", m.Buckets)
+	}
+	if _, err := commander.CrushMove("default", map[string]string{"rack": "rack1"}); err == nil {
+		t.Fatal("expected error moving root under rack")
+	}
+	if _, err := commander.CrushMove("rack1", map[string]string{"root": "default", "datacenter": "rack1"}); err == nil {
+		t.Fatal("expected error for bucket type mismatch")
+	}
+	if _, err := commander.CrushMove("missing", map[string]string{"root": "default"}); err == nil {
+		t.Fatal("expected error for missing bucket")
+	}
+
+	// 标志可以设置在新建的crush节点上
+	if _, err := commander.OsdSetGroupFlags([]string{"noout"}, []string{"rack1"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommander_CrushReweight(t *testing.T) {
+	rados := newConnectedFake(t)
+	commander := NewCommander(rados)
+
+	if _, err := commander.CrushReweight("osd.1", 0.5); err != nil {
+		t.Fatal(err)
+	}
+	m, _ := commander.CrushDump()
+	if b := m.bucketByName("node2"); b.Weight != CRUSH_WEIGHT_ONE/2 || b.Items[0].Weight != CRUSH_WEIGHT_ONE/2 {
+		t.Fatalf("node2 %+v", b)
+	}
+	list, _ := commander.OsdList()
+	if list[1].CrushWeight != 0.5 {
+		t.Fatalf("osd list %+v", list[1])
+	}
+	if _, err := commander.CrushReweight("node2", 1); err == nil {
+		t.Fatal("expected error reweighting bucket")
+	}
+	if _, err := commander.CrushReweight("osd.1", -1); err == nil {
+		t.Fatal("expected error for negative weight")
+	}
+}
+
+func TestCrushMovement(t *testing.T) {
+	// 每个host两个osd
+	osds := []*fakeOsd{}
+	for i := 0; i < 8; i++ {
+		osds = append(osds, &fakeOsd{id: i, host: []string{"node1", "node2", "node3", "node4"}[i/2], class: "hdd", weight: 1})
+	}
+	before := newFakeCrush(osds)
+	weights := []uint32{}
+	for range osds {
+		weights = append(weights, CRUSH_WEIGHT_ONE)
+	}
+	pools := []crushPool{{id: 1, name: "rbd", pgNum: 128, pgpNum: 128, size: 3, shardBytes: 10}}
+
+	mapper, _ := newCrushMapper(before, weights)
+	pgs, err := mapper.mapPool(&pools[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[int]int{}
+	for _, pg := range pgs {
+		hosts := map[string]bool{}
+		for _, osd := range pg {
+			hosts[osds[osd].host] = true
+			counts[osd]++
+		}
+		if len(pg) != 3 || len(hosts) != 3 {
+			t.Fatalf("pg mapping %v", pg)
+		}
+	}
+	for id, n := range counts {
+		if n < 128*3/8/2 {
+			t.Fatalf("osd.%d has only %d pgs", id, n)
+		}
+	}
+
+	// 相同的输入得到相同的映射
+	movement, err := crushMovement(before, before.Clone(), pools, weights)
+	if err != nil || movement.MovedPgs != 0 || len(movement.Osds) != 0 || movement.Pgs != 128 {
+		t.Fatalf("no change %+v %v", movement, err)
+	}
+
+	after := before.Clone()
+	if err := after.Reweight("osd.0", 0); err != nil {
+		t.Fatal(err)
+	}
+	movement, err = crushMovement(before, after, pools, weights)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// host的权重同时降低，除osd.0上的pg外node1上的部分pg也会迁出，其他osd上的pg只增不减
+	if movement.MovedPgs < counts[0] || movement.MovedShards < movement.MovedPgs || movement.MovedBytes != uint64(movement.MovedShards)*10 {
+		t.Fatalf("reweight movement %+v, osd.0 had %d pgs", movement, counts[0])
+	}
+	for _, osd := range movement.Osds {
+		if osd.Id == 0 && (osd.PgsBefore != counts[0] || osd.PgsAfter != 0) {
+			t.Fatalf("osd.0 %+v", osd)
+		}
+		if osd.Id > 1 && osd.PgsAfter < osd.PgsBefore {
+			t.Fatalf("osd.%d %+v", osd.Id, osd)
+		}
+	}
+	if len(movement.Pools) != 1 || movement.Pools[0].MovedPgs != movement.MovedPgs {
+		t.Fatalf("pools %+v", movement.Pools)
+	}
+
+	// 非straw2的bucket不支持预测
+	after.Buckets[0].Alg = "straw"
+	if _, err := crushMovement(before, after, pools, weights); err == nil {
+		t.Fatal("expected error for straw bucket")
+	}
+}
+
+func TestCommander_CrushDryRun(t *testing.T) {
+	rados := newConnectedFake(t)
+	commander := NewCommander(rados)
+
+	movement, err := commander.CrushMoveDryRun("node1", map[string]string{"root": "default"})
+	if err != nil || movement.MovedPgs != 0 || movement.Pgs != 3*POOL_DEFAULT_PG_NUM {
+		t.Fatalf("no-op move %+v %v", movement, err)
+	}
+	movement, err = commander.CrushReweightDryRun("osd.0", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 只有三个host，osd.0的副本无处迁移
+	if len(movement.Osds) != 1 || movement.Osds[0].Id != 0 || movement.Osds[0].PgsBefore != 3*POOL_DEFAULT_PG_NUM ||
+		movement.Osds[0].PgsAfter != 0 || movement.MovedShards != 0 {
+		t.Fatalf("reweight movement %+v", movement)
+	}
+	// 不修改集群
+	m, _ := commander.CrushDump()
+	if m.bucketByName("node1").Weight == 0 {
+		t.Fatal("dry run changed crush map")
+	}
+	if _, err := commander.CrushReweightDryRun("missing", 1); err == nil {
+		t.Fatal("expected error for missing device")
+	}
+}
@@ -0,0 +1,173 @@
+package ceph
+
+// mon及mgr守护进程状态，mgr模块启用/禁用
+
+import (
+	"errors"
+	"sort"
+)
+
+type MonDaemon struct {
+	Name     string  `json:"name"`
+	Rank     int     `json:"rank"`
+	Addr     string  `json:"addr"`
+	InQuorum bool    `json:"in_quorum"`
+	Leader   bool    `json:"leader"`
+	Skew     float64 `json:"skew"`    // 与leader的时钟偏差，秒
+	Latency  float64 `json:"latency"` // 秒
+	Health   string  `json:"health"`  // 时钟检查结果，如HEALTH_OK
+}
+
+type MonStatus struct {
+	Epoch         int         `json:"epoch"` // monmap版本
+	ElectionEpoch int         `json:"election_epoch"`
+	Leader        string      `json:"leader"`
+	QuorumAge     int         `json:"quorum_age"` // 秒
+	Mons          []MonDaemon `json:"mons"`
+}
+
+type MgrDaemon struct {
+	Gid       int64  `json:"gid"`
+	Name      string `json:"name"`
+	Addr      string `json:"addr,omitempty"`
+	Active    bool   `json:"active"`
+	Available bool   `json:"available"`
+}
+
+type MgrModule struct {
+	Name     string `json:"name"`
+	Enabled  bool   `json:"enabled"`
+	AlwaysOn bool   `json:"always_on"` // 总是启用，不能禁用
+	CanRun   bool   `json:"can_run"`
+	Error    string `json:"error,omitempty"` // 不能运行的原因
+}
+
+type MgrStatus struct {
+	Epoch   int         `json:"epoch"`
+	Active  string      `json:"active"` // 为空表示没有active的mgr
+	Daemons []MgrDaemon `json:"daemons"`
+	Modules []MgrModule `json:"modules"`
+}
+
+// 汇总quorum_status及time-sync-status
+func (c *Commander) MonStatus() (*MonStatus, error) {
+	quorum := struct {
+		ElectionEpoch int    `json:"election_epoch"`
+		Quorum        []int  `json:"quorum"`
+		Leader        string `json:"quorum_leader_name"`
+		QuorumAge     int    `json:"quorum_age"`
+		Monmap        struct {
+			Epoch int `json:"epoch"`
+			Mons  []struct {
+				Rank       int    `json:"rank"`
+				Name       string `json:"name"`
+				Addr       string `json:"addr"`
+				PublicAddr string `json:"public_addr"`
+			} `json:"mons"`
+		} `json:"monmap"`
+	}{}
+	if _, err := c.Mon(NewCommand("quorum_status"), &quorum); err != nil {
+		return nil, err
+	}
+	// 只有一个mon时没有时钟检查
+	timeSync := struct {
+		TimeSkewStatus map[string]struct {
+			Skew    float64 `json:"skew"`
+			Latency float64 `json:"latency"`
+			Health  string  `json:"health"`
+		} `json:"time_skew_status"`
+	}{}
+	if _, err := c.Mon(NewCommand("time-sync-status"), &timeSync); err != nil {
+		return nil, err
+	}
+	status := &MonStatus{
+		Epoch:         quorum.Monmap.Epoch,
+		ElectionEpoch: quorum.ElectionEpoch,
+		Leader:        quorum.Leader,
+		QuorumAge:     quorum.QuorumAge,
+		Mons:          []MonDaemon{},
+	}
+	for _, m := range quorum.Monmap.Mons {
+		mon := MonDaemon{Name: m.Name, Rank: m.Rank, Addr: m.PublicAddr, Leader: m.Name == quorum.Leader}
+		if mon.Addr == "" {
+			mon.Addr = m.Addr
+		}
+		for _, rank := range quorum.Quorum {
+			mon.InQuorum = mon.InQuorum || rank == m.Rank
+		}
+		if skew, ok := timeSync.TimeSkewStatus[m.Name]; ok {
+			mon.Skew, mon.Latency, mon.Health = skew.Skew, skew.Latency, skew.Health
+		}
+		status.Mons = append(status.Mons, mon)
+	}
+	return status, nil
+}
+
+func (c *Commander) MgrStatus() (*MgrStatus, error) {
+	dump := struct {
+		Epoch      int    `json:"epoch"`
+		ActiveGid  int64  `json:"active_gid"`
+		ActiveName string `json:"active_name"`
+		ActiveAddr string `json:"active_addr"`
+		Available  bool   `json:"available"`
+		Standbys   []struct {
+			Gid  int64  `json:"gid"`
+			Name string `json:"name"`
+		} `json:"standbys"`
+		Modules          []string            `json:"modules"`
+		AlwaysOnModules  map[string][]string `json:"always_on_modules"` // 按版本分组
+		AvailableModules []struct {
+			Name        string `json:"name"`
+			CanRun      bool   `json:"can_run"`
+			ErrorString string `json:"error_string"`
+		} `json:"available_modules"`
+	}{}
+	if _, err := c.Mon(NewCommand("mgr dump"), &dump); err != nil {
+		return nil, err
+	}
+	status := &MgrStatus{Epoch: dump.Epoch, Active: dump.ActiveName, Daemons: []MgrDaemon{}, Modules: []MgrModule{}}
+	if dump.ActiveName != "" {
+		status.Daemons = append(status.Daemons, MgrDaemon{Gid: dump.ActiveGid, Name: dump.ActiveName, Addr: dump.ActiveAddr, Active: true, Available: dump.Available})
+	}
+	for _, s := range dump.Standbys {
+		status.Daemons = append(status.Daemons, MgrDaemon{Gid: s.Gid, Name: s.Name, Available: true})
+	}
+	// 只有mon当前版本的列表生效，其他版本的列表用于升级
+	monmap := struct {
+		MinMonReleaseName string `json:"min_mon_release_name"`
+	}{}
+	if _, err := c.Mon(NewCommand("mon dump"), &monmap); err != nil {
+		return nil, err
+	}
+	alwaysOn := dump.AlwaysOnModules[monmap.MinMonReleaseName]
+	for _, m := range dump.AvailableModules {
+		status.Modules = append(status.Modules, MgrModule{
+			Name:     m.Name,
+			Enabled:  hasFlag(dump.Modules, m.Name) || hasFlag(alwaysOn, m.Name),
+			AlwaysOn: hasFlag(alwaysOn, m.Name),
+			CanRun:   m.CanRun,
+			Error:    m.ErrorString,
+		})
+	}
+	sort.Slice(status.Modules, func(i, j int) bool { return status.Modules[i].Name < status.Modules[j].Name })
+	return status, nil
+}
+
+// force为true时即使mgr报告模块不能运行也启用
+func (c *Commander) MgrModuleEnable(name string, force bool) (string, error) {
+	if name == "" {
+		return "", errors.New("mgr module name is empty")
+	}
+	cmd := NewCommand("mgr module enable").Set("module", name)
+	if force {
+		cmd.Set("force", "--force")
+	}
+	return c.Mon(cmd, nil)
+}
+
+func (c *Commander) MgrModuleDisable(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("mgr module name is empty")
+	}
+	return c.Mon(NewCommand("mgr module disable").Set("module", name), nil)
+}
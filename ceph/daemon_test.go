@@ -0,0 +1,85 @@
+package ceph
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommander_MonStatus(t *testing.T) {
+	rados := newConnectedFake(t)
+	commander := NewCommander(rados)
+
+	rados.cluster.mons[2].skew = 0.2
+	status, err := commander.MonStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Leader != "node1" || status.ElectionEpoch != 6 || status.Epoch != 1 || len(status.Mons) != 3 {
+		t.Fatalf("mon status %+v", status)
+	}
+	for i, mon := range status.Mons {
+		if mon.Rank != i || !mon.InQuorum || mon.Leader != (i == 0) || mon.Addr == "" {
+			t.Fatalf("mon %+v", mon)
+		}
+	}
+	if status.Mons[0].Health != "HEALTH_OK" || status.Mons[2].Skew != 0.2 || status.Mons[2].Health != "HEALTH_WARN" {
+		t.Fatalf("clock skew %+v", status.Mons)
+	}
+}
+
+func TestCommander_MgrStatus(t *testing.T) {
+	rados := newConnectedFake(t)
+	commander := NewCommander(rados)
+
+	status, err := commander.MgrStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Active != "node1" || len(status.Daemons) != 3 || !status.Daemons[0].Active || status.Daemons[1].Active {
+		t.Fatalf("mgr status %+v", status)
+	}
+	modules := map[string]MgrModule{}
+	for _, m := range status.Modules {
+		modules[m.Name] = m
+	}
+	if !modules["status"].Enabled || !modules["status"].AlwaysOn || !modules["iostat"].Enabled || modules["iostat"].AlwaysOn ||
+		modules["prometheus"].Enabled || modules["influx"].CanRun || modules["influx"].Error == "" {
+		t.Fatalf("mgr modules %+v", modules)
+	}
+	// 只在squid的always-on列表中
+	if modules["dashboard"].AlwaysOn || modules["dashboard"].Enabled {
+		t.Fatalf("module of another release %+v", modules["dashboard"])
+	}
+
+	if _, err := commander.MgrModuleEnable("prometheus", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := commander.MgrModuleDisable("iostat"); err != nil {
+		t.Fatal(err)
+	}
+	status, _ = commander.MgrStatus()
+	for _, m := range status.Modules {
+		if (m.Name == "prometheus" && !m.Enabled) || (m.Name == "iostat" && m.Enabled) {
+			t.Fatalf("module %+v", m)
+		}
+	}
+	if status.Epoch != 3 {
+		t.Fatalf("mgr epoch %d", status.Epoch)
+	}
+
+	if _, err := commander.MgrModuleEnable("bogus", false); err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Fatalf("enable unknown module %v", err)
+	}
+	if _, err := commander.MgrModuleEnable("influx", false); err == nil {
+		t.Fatal("expected error enabling module that cannot run")
+	}
+	if _, err := commander.MgrModuleEnable("influx", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := commander.MgrModuleDisable("balancer"); err == nil || !strings.Contains(err.Error(), "always-on") {
+		t.Fatalf("disable always-on module %v", err)
+	}
+	if _, err := commander.MgrModuleEnable("", false); err == nil {
+		t.Fatal("expected error for empty module name")
+	}
+}
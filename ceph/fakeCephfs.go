@@ -0,0 +1,1019 @@
+package ceph
+
+// 模拟的文件系统，数据保存在内存中
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var _ Libcephfs = (*fakeRados)(nil)
+
+func init() {
+	fakeCommands["fs ls"] = fakeFsLs
+}
+
+func fakeFsLs(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	list := []FsInfo{}
+	for _, fs := range f.cluster.filesystems {
+		info := FsInfo{
+			Name:         fs.name,
+			MetadataPool: fs.metadataPool,
+			DataPools:    fs.dataPools,
+			DataPoolIds:  []int64{},
+		}
+		if pool, ok := f.cluster.pools[fs.metadataPool]; ok {
+			info.MetadataPoolId = pool.id
+		}
+		for _, name := range fs.dataPools {
+			if pool, ok := f.cluster.pools[name]; ok {
+				info.DataPoolIds = append(info.DataPoolIds, pool.id)
+			}
+		}
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return fakeJson(list)
+}
+
+type fakeInode struct {
+	ino      uint64
+	mode     uint32 // 包含文件类型
+	uid      uint32
+	gid      uint32
+	data     []byte
+	parent   *fakeInode
+	children map[string]*fakeInode // 目录的内容
+	atime    time.Time
+	mtime    time.Time
+	ctime    time.Time
+
+	xattrs   map[string][]byte // user.*属性
+	maxBytes uint64            // 配额，0为不限制
+	maxFiles uint64
+	layout   *CephfsLayout         // 目录为显式设置的布局，文件为创建时继承的布局
+	snaps    map[string]*fakeInode // 目录的快照
+	snapOf   *fakeInode            // .snap虚拟目录所属的目录
+	readonly bool                  // 快照中的内容
+}
+
+func (i *fakeInode) isDir() bool {
+	return i.mode&CEPHFS_S_IFMT == CEPHFS_S_IFDIR
+}
+
+// 递归的文件数和子目录数，不含自身
+func (i *fakeInode) rcount() (files uint64, subdirs uint64) {
+	for _, child := range i.children {
+		if child.isDir() {
+			f, d := child.rcount()
+			files += f
+			subdirs += d + 1
+		} else {
+			files++
+		}
+	}
+	return files, subdirs
+}
+
+func (i *fakeInode) rentries() uint64 {
+	files, subdirs := i.rcount()
+	return files + subdirs
+}
+
+// a是否为b或b的上级目录
+func (a *fakeInode) contains(b *fakeInode) bool {
+	for ; b != nil; b = b.parent {
+		if a == b {
+			return true
+		}
+	}
+	return false
+}
+
+// 增加bytes字节和files个文件后是否超出所在目录及上级目录的配额，跳过包含except的目录
+func (i *fakeInode) quotaExceeded(bytes uint64, files uint64, except *fakeInode) bool {
+	for dir := i; dir != nil; dir = dir.parent {
+		if except != nil && dir.contains(except) {
+			continue
+		}
+		if dir.maxBytes > 0 && bytes > 0 && dir.rbytes()+bytes > dir.maxBytes {
+			return true
+		}
+		if dir.maxFiles > 0 && files > 0 && dir.rentries()+files > dir.maxFiles {
+			return true
+		}
+	}
+	return false
+}
+
+// 生效的布局，目录未设置时继承上级目录
+func (i *fakeInode) effectiveLayout() CephfsLayout {
+	for dir := i; dir != nil; dir = dir.parent {
+		if dir.layout != nil {
+			return *dir.layout
+		}
+	}
+	return CephfsLayout{}
+}
+
+// 只读的副本，用于快照
+func (i *fakeInode) snapshot(parent *fakeInode) *fakeInode {
+	c := *i
+	c.parent = parent
+	c.readonly = true
+	c.snaps = nil
+	c.data = append([]byte(nil), i.data...)
+	if i.layout != nil {
+		layout := *i.layout
+		c.layout = &layout
+	}
+	if i.xattrs != nil {
+		c.xattrs = map[string][]byte{}
+		for k, v := range i.xattrs {
+			c.xattrs[k] = v
+		}
+	}
+	if i.isDir() {
+		c.children = make(map[string]*fakeInode, len(i.children))
+		for name, child := range i.children {
+			c.children[name] = child.snapshot(&c)
+		}
+	}
+	return &c
+}
+
+// 按相对路径查找，不存在时返回nil
+func (i *fakeInode) walk(parts []string) *fakeInode {
+	for _, part := range parts {
+		if i = i.children[part]; i == nil {
+			return nil
+		}
+	}
+	return i
+}
+
+// .snap虚拟目录，dirs为从根目录到所属目录的各级目录，parts为对应的路径
+// 上级目录的快照名称为_快照名_上级目录inode
+func snapDir(dirs []*fakeInode, parts []string) *fakeInode {
+	dir := dirs[len(dirs)-1]
+	snapdir := &fakeInode{
+		ino:      dir.ino,
+		mode:     CEPHFS_S_IFDIR | CEPHFS_DEFAULT_DIR_MODE,
+		parent:   dir,
+		children: map[string]*fakeInode{},
+		atime:    dir.mtime,
+		mtime:    dir.mtime,
+		ctime:    dir.mtime,
+		snapOf:   dir,
+		readonly: true,
+	}
+	for name, snap := range dir.snaps {
+		snapdir.children[name] = snap
+	}
+	for j, ancestor := range dirs[:len(dirs)-1] {
+		for name, snap := range ancestor.snaps {
+			if inode := snap.walk(parts[j:]); inode != nil && inode.isDir() {
+				snapdir.children[fmt.Sprintf("_%s_%d", name, ancestor.ino)] = inode
+			}
+		}
+	}
+	return snapdir
+}
+
+// 目录的大小为递归的字节数，与cephfs的rbytes一致
+func (i *fakeInode) rbytes() uint64 {
+	if !i.isDir() {
+		return uint64(len(i.data))
+	}
+	var size uint64
+	for _, child := range i.children {
+		size += child.rbytes()
+	}
+	return size
+}
+
+func (i *fakeInode) stat(name string) CephfsStat {
+	nlink := uint32(1)
+	if i.isDir() {
+		nlink = 2
+		for _, child := range i.children {
+			if child.isDir() {
+				nlink++
+			}
+		}
+	}
+	return CephfsStat{
+		Name:  name,
+		Type:  cephfsFileType(i.mode),
+		Ino:   i.ino,
+		Mode:  i.mode &^ CEPHFS_S_IFMT,
+		Uid:   i.uid,
+		Gid:   i.gid,
+		Size:  i.rbytes(),
+		Nlink: nlink,
+		Atime: i.atime,
+		Mtime: i.mtime,
+		Ctime: i.ctime,
+	}
+}
+
+type fakeFs struct {
+	id           int
+	name         string
+	metadataPool string
+	dataPools    []string
+	root         *fakeInode
+	inoSeq       uint64
+	subvolumes   map[string]*fakeSubvolume // 组名/子卷名
+}
+
+func newFakeFs(id int, name string, metadata string, data string) *fakeFs {
+	fs := &fakeFs{
+		id:           id,
+		name:         name,
+		metadataPool: metadata,
+		dataPools:    []string{data},
+		inoSeq:       0x10000000000,
+	}
+	fs.root = fs.newInode(CEPHFS_S_IFDIR | CEPHFS_DEFAULT_DIR_MODE)
+	fs.root.ino = 1
+	fs.root.layout = &CephfsLayout{
+		Pool:        data,
+		StripeUnit:  4 << 20,
+		StripeCount: 1,
+		ObjectSize:  4 << 20,
+	}
+	return fs
+}
+
+func (fs *fakeFs) newInode(mode uint32) *fakeInode {
+	fs.inoSeq++
+	now := time.Now()
+	inode := &fakeInode{
+		ino:   fs.inoSeq,
+		mode:  mode,
+		atime: now,
+		mtime: now,
+		ctime: now,
+	}
+	if inode.isDir() {
+		inode.children = map[string]*fakeInode{}
+	}
+	return inode
+}
+
+// 在目录下创建，调用方需持有锁
+func (fs *fakeFs) link(parent *fakeInode, name string, inode *fakeInode) {
+	inode.parent = parent
+	parent.children[name] = inode
+	parent.mtime = time.Now()
+}
+
+// 查找路径，返回上级目录、名称和inode，inode不存在时为nil，full需为规范的绝对路径
+func (fs *fakeFs) lookup(full string) (parent *fakeInode, name string, inode *fakeInode, ret int) {
+	if full == "/" {
+		return nil, "", fs.root, 0
+	}
+	parts := strings.Split(full[1:], "/")
+	dirs := []*fakeInode{fs.root}
+	dir := fs.root
+	for i, part := range parts {
+		var child *fakeInode
+		if part == CEPHFS_SNAP_DIR && !dir.readonly {
+			child = snapDir(dirs, parts[:i])
+		} else {
+			child = dir.children[part]
+		}
+		if i == len(parts)-1 {
+			return dir, part, child, 0
+		}
+		if child == nil {
+			return nil, "", nil, fakeENOENT
+		}
+		if !child.isDir() {
+			return nil, "", nil, fakeENOTDIR
+		}
+		dir = child
+		dirs = append(dirs, dir)
+	}
+	return nil, "", nil, fakeENOENT
+}
+
+func fsError(op string, p string, ret int) error {
+	return errors.New("cannot " + op + "[" + p + "] " + fmt.Sprintf("%v", ret))
+}
+
+// 挂载点下的完整路径，调用方需持有锁
+func (f *fakeRados) fsPath(op string, p string) (string, error) {
+	if f.fs == nil {
+		return "", fsError(op, p, fakeENOTCONN)
+	}
+	clean, err := CleanCephfsPath(p)
+	if err != nil {
+		return "", errors.New("cannot " + op + "[" + p + "] " + err.Error())
+	}
+	return path.Join(f.fs_root, clean), nil
+}
+
+// 查找已存在的路径，调用方需持有锁
+func (f *fakeRados) fsLookup(op string, p string) (parent *fakeInode, name string, inode *fakeInode, err error) {
+	full, err := f.fsPath(op, p)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	parent, name, inode, ret := f.fs.lookup(full)
+	if ret < 0 {
+		return nil, "", nil, fsError(op, p, ret)
+	}
+	if inode == nil {
+		return nil, "", nil, fsError(op, p, fakeENOENT)
+	}
+	return parent, name, inode, nil
+}
+
+// 查找上级目录，用于创建，调用方需持有锁
+func (f *fakeRados) fsParent(op string, p string) (parent *fakeInode, name string, inode *fakeInode, err error) {
+	full, err := f.fsPath(op, p)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if full == "/" {
+		return nil, "", nil, fsError(op, p, fakeEEXIST)
+	}
+	parent, name, inode, ret := f.fs.lookup(full)
+	if ret < 0 {
+		return nil, "", nil, fsError(op, p, ret)
+	}
+	return parent, name, inode, nil
+}
+
+func (f *fakeRados) Ceph_mount(fs_name string, root string) error {
+	if !f.connected {
+		return errors.New("cannot mount cephfs[" + fs_name + "] " + fmt.Sprintf("%v", fakeENOTCONN))
+	}
+	if f.fs != nil {
+		return errors.New("cannot mount cephfs[" + fs_name + "] " + fmt.Sprintf("%v", fakeEISCONN))
+	}
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	var fs *fakeFs
+	if fs_name == "" {
+		// 默认文件系统为最先创建的
+		for _, candidate := range f.cluster.filesystems {
+			if fs == nil || candidate.id < fs.id {
+				fs = candidate
+			}
+		}
+	} else {
+		fs = f.cluster.filesystems[fs_name]
+	}
+	if fs == nil {
+		return errors.New("cannot mount cephfs[" + fs_name + "] " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	if root == "" {
+		root = "/"
+	}
+	root, err := CleanCephfsPath(root)
+	if err != nil {
+		return errors.New("cannot mount cephfs[" + fs_name + "] " + err.Error())
+	}
+	_, _, inode, ret := fs.lookup(root)
+	if ret == 0 && inode == nil {
+		ret = fakeENOENT
+	} else if ret == 0 && !inode.isDir() {
+		ret = fakeENOTDIR
+	}
+	if ret < 0 {
+		return errors.New("cannot mount cephfs[" + fs_name + "] at " + root + " " + fmt.Sprintf("%v", ret))
+	}
+	f.fs = fs
+	f.fs_root = root
+	return nil
+}
+
+func (f *fakeRados) Ceph_unmount() error {
+	if f.fs == nil {
+		return errors.New("cannot unmount cephfs " + fmt.Sprintf("%v", fakeENOTCONN))
+	}
+	f.fs = nil
+	f.fs_root = ""
+	return nil
+}
+
+func (f *fakeRados) Ceph_stat(p string) (CephfsStat, error) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	parent, name, inode, err := f.fsLookup("stat", p)
+	if err != nil {
+		return CephfsStat{}, err
+	}
+	if parent == nil {
+		name = "/"
+	}
+	return inode.stat(name), nil
+}
+
+func (f *fakeRados) Ceph_listdir(p string) ([]CephfsStat, error) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	_, _, inode, err := f.fsLookup("list directory", p)
+	if err != nil {
+		return nil, err
+	}
+	if !inode.isDir() {
+		return nil, fsError("list directory", p, fakeENOTDIR)
+	}
+	entries := make([]CephfsStat, 0, len(inode.children))
+	for name, child := range inode.children {
+		entries = append(entries, child.stat(name))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+func (f *fakeRados) Ceph_mkdir(p string, mode uint32) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	parent, name, inode, err := f.fsParent("mkdir", p)
+	if err != nil {
+		return err
+	}
+	if inode != nil {
+		return fsError("mkdir", p, fakeEEXIST)
+	}
+	// 在.snap下创建目录即创建快照
+	if dir := parent.snapOf; dir != nil {
+		if strings.HasPrefix(name, "_") {
+			return fsError("mkdir", p, fakeEINVAL)
+		}
+		if dir.snaps == nil {
+			dir.snaps = map[string]*fakeInode{}
+		}
+		snap := dir.snapshot(nil)
+		snap.ctime = time.Now()
+		dir.snaps[name] = snap
+		return nil
+	}
+	if parent.readonly {
+		return fsError("mkdir", p, fakeEROFS)
+	}
+	if parent.quotaExceeded(0, 1, nil) {
+		return fsError("mkdir", p, fakeEDQUOT)
+	}
+	f.fs.link(parent, name, f.fs.newInode(CEPHFS_S_IFDIR|mode&07777))
+	return nil
+}
+
+// 与libcephfs一致，路径已存在时返回EEXIST
+func (f *fakeRados) Ceph_mkdirs(p string, mode uint32) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	full, err := f.fsPath("mkdirs", p)
+	if err != nil {
+		return err
+	}
+	if full == "/" {
+		return fsError("mkdirs", p, fakeEEXIST)
+	}
+	dir := f.fs.root
+	created := false
+	for _, part := range strings.Split(full[1:], "/") {
+		if part == CEPHFS_SNAP_DIR {
+			return fsError("mkdirs", p, fakeEINVAL)
+		}
+		child, ok := dir.children[part]
+		if !ok {
+			if dir.quotaExceeded(0, 1, nil) {
+				return fsError("mkdirs", p, fakeEDQUOT)
+			}
+			child = f.fs.newInode(CEPHFS_S_IFDIR | mode&07777)
+			f.fs.link(dir, part, child)
+			created = true
+		} else if !child.isDir() {
+			return fsError("mkdirs", p, fakeENOTDIR)
+		}
+		dir = child
+	}
+	if !created {
+		return fsError("mkdirs", p, fakeEEXIST)
+	}
+	return nil
+}
+
+func (f *fakeRados) Ceph_rmdir(p string) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	parent, name, inode, err := f.fsLookup("rmdir", p)
+	if err != nil {
+		return err
+	}
+	if parent == nil {
+		return fsError("rmdir", p, fakeEBUSY)
+	}
+	// 删除.snap下的目录即删除快照，不能删除上级目录的快照
+	if dir := parent.snapOf; dir != nil {
+		if _, ok := dir.snaps[name]; !ok {
+			return fsError("rmdir", p, fakeEINVAL)
+		}
+		delete(dir.snaps, name)
+		return nil
+	}
+	if parent.readonly || inode.readonly {
+		return fsError("rmdir", p, fakeEROFS)
+	}
+	if !inode.isDir() {
+		return fsError("rmdir", p, fakeENOTDIR)
+	}
+	if len(inode.children) > 0 {
+		return fsError("rmdir", p, fakeENOTEMPTY)
+	}
+	delete(parent.children, name)
+	parent.mtime = time.Now()
+	return nil
+}
+
+func (f *fakeRados) Ceph_unlink(p string) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	parent, name, inode, err := f.fsLookup("unlink", p)
+	if err != nil {
+		return err
+	}
+	if inode.isDir() {
+		return fsError("unlink", p, fakeEISDIR)
+	}
+	if parent.readonly {
+		return fsError("unlink", p, fakeEROFS)
+	}
+	delete(parent.children, name)
+	parent.mtime = time.Now()
+	return nil
+}
+
+// 目标存在时替换，目录只能替换空目录
+func (f *fakeRados) Ceph_rename(from string, to string) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	parent, name, inode, err := f.fsLookup("rename", from)
+	if err != nil {
+		return err
+	}
+	if parent == nil {
+		return fsError("rename", from, fakeEBUSY)
+	}
+	if parent.readonly || inode.readonly {
+		return fsError("rename", from, fakeEROFS)
+	}
+	toFull, err := f.fsPath("rename", to)
+	if err != nil {
+		return err
+	}
+	fromFull, _ := f.fsPath("rename", from)
+	if toFull == fromFull {
+		return nil
+	}
+	// 不能移动到自身的子目录
+	if strings.HasPrefix(toFull, fromFull+"/") {
+		return fsError("rename", from+" to "+to, fakeEINVAL)
+	}
+	toParent, toName, existing, err := f.fsParent("rename", to)
+	if err != nil {
+		return err
+	}
+	if !toParent.isDir() {
+		return fsError("rename", to, fakeENOTDIR)
+	}
+	if toParent.readonly || toName == CEPHFS_SNAP_DIR {
+		return fsError("rename", to, fakeEROFS)
+	}
+	if toParent.quotaExceeded(inode.rbytes(), inode.rentries()+1, parent) {
+		return fsError("rename", to, fakeEDQUOT)
+	}
+	if existing != nil {
+		switch {
+		case existing.isDir() && !inode.isDir():
+			return fsError("rename", to, fakeEISDIR)
+		case !existing.isDir() && inode.isDir():
+			return fsError("rename", to, fakeENOTDIR)
+		case existing.isDir() && len(existing.children) > 0:
+			return fsError("rename", to, fakeENOTEMPTY)
+		}
+	}
+	delete(parent.children, name)
+	f.fs.link(toParent, toName, inode)
+	now := time.Now()
+	parent.mtime = now
+	inode.ctime = now
+	return nil
+}
+
+func (f *fakeRados) Ceph_chmod(p string, mode uint32) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	_, _, inode, err := f.fsLookup("chmod", p)
+	if err != nil {
+		return err
+	}
+	if inode.readonly {
+		return fsError("chmod", p, fakeEROFS)
+	}
+	inode.mode = inode.mode&CEPHFS_S_IFMT | mode&07777
+	inode.ctime = time.Now()
+	return nil
+}
+
+func (f *fakeRados) Ceph_truncate(p string, size uint64) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	_, _, inode, err := f.fsLookup("truncate", p)
+	if err != nil {
+		return err
+	}
+	if inode.isDir() {
+		return fsError("truncate", p, fakeEISDIR)
+	}
+	if inode.readonly {
+		return fsError("truncate", p, fakeEROFS)
+	}
+	if size > uint64(len(inode.data)) && inode.parent.quotaExceeded(size-uint64(len(inode.data)), 0, nil) {
+		return fsError("truncate", p, fakeEDQUOT)
+	}
+	inode.truncate(size)
+	return nil
+}
+
+func (i *fakeInode) truncate(size uint64) {
+	if size <= uint64(len(i.data)) {
+		i.data = i.data[:size]
+	} else {
+		i.data = append(i.data, make([]byte, size-uint64(len(i.data)))...)
+	}
+	i.mtime = time.Now()
+}
+
+type fakeCephfsFile struct {
+	f        *fakeRados
+	path     string
+	inode    *fakeInode
+	readable bool
+	writable bool
+	closed   bool
+}
+
+func (f *fakeRados) Ceph_open(p string, flags int, mode uint32) (CephfsFile, error) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	full, err := f.fsPath("open", p)
+	if err != nil {
+		return nil, err
+	}
+	parent, name, inode, ret := f.fs.lookup(full)
+	if ret < 0 {
+		return nil, fsError("open", p, ret)
+	}
+	access := flags & 03
+	file := &fakeCephfsFile{
+		f:        f,
+		path:     p,
+		readable: access == CEPHFS_O_RDONLY || access == CEPHFS_O_RDWR,
+		writable: access == CEPHFS_O_WRONLY || access == CEPHFS_O_RDWR,
+	}
+	if inode == nil {
+		if flags&CEPHFS_O_CREAT == 0 {
+			return nil, fsError("open", p, fakeENOENT)
+		}
+		if parent.readonly {
+			return nil, fsError("open", p, fakeEROFS)
+		}
+		if parent.quotaExceeded(0, 1, nil) {
+			return nil, fsError("open", p, fakeEDQUOT)
+		}
+		inode = f.fs.newInode(CEPHFS_S_IFREG | mode&07777)
+		layout := parent.effectiveLayout()
+		inode.layout = &layout
+		f.fs.link(parent, name, inode)
+	} else if flags&CEPHFS_O_CREAT != 0 && flags&CEPHFS_O_EXCL != 0 {
+		return nil, fsError("open", p, fakeEEXIST)
+	}
+	if inode.isDir() && file.writable {
+		return nil, fsError("open", p, fakeEISDIR)
+	}
+	if inode.readonly && file.writable {
+		return nil, fsError("open", p, fakeEROFS)
+	}
+	if flags&CEPHFS_O_TRUNC != 0 && file.writable {
+		inode.truncate(0)
+	}
+	file.inode = inode
+	return file, nil
+}
+
+func (file *fakeCephfsFile) ReadAt(p []byte, off int64) (int, error) {
+	file.f.cluster.lock.RLock()
+	defer file.f.cluster.lock.RUnlock()
+	if file.closed || !file.readable {
+		return 0, fsError("read", file.path, fakeEBADF)
+	}
+	if file.inode.isDir() {
+		return 0, fsError("read", file.path, fakeEISDIR)
+	}
+	if off < 0 {
+		return 0, fsError("read", file.path, fakeEINVAL)
+	}
+	if off >= int64(len(file.inode.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, file.inode.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (file *fakeCephfsFile) WriteAt(p []byte, off int64) (int, error) {
+	file.f.cluster.lock.Lock()
+	defer file.f.cluster.lock.Unlock()
+	if file.closed || !file.writable {
+		return 0, fsError("write", file.path, fakeEBADF)
+	}
+	if off < 0 {
+		return 0, fsError("write", file.path, fakeEINVAL)
+	}
+	end := uint64(off) + uint64(len(p))
+	if end > uint64(len(file.inode.data)) {
+		if file.inode.parent != nil && file.inode.parent.quotaExceeded(end-uint64(len(file.inode.data)), 0, nil) {
+			return 0, fsError("write", file.path, fakeEDQUOT)
+		}
+		file.inode.truncate(end)
+	}
+	copy(file.inode.data[off:], p)
+	file.inode.mtime = time.Now()
+	return len(p), nil
+}
+
+func (file *fakeCephfsFile) Close() error {
+	if file.closed {
+		return fsError("close", file.path, fakeEBADF)
+	}
+	file.closed = true
+	return nil
+}
+
+// ceph.dir.layout或ceph.file.layout及其字段
+func layoutXattr(name string) (prefix string, field string, ok bool) {
+	for _, prefix := range []string{"ceph.dir.layout", "ceph.file.layout"} {
+		if name == prefix {
+			return prefix, "", true
+		}
+		if strings.HasPrefix(name, prefix+".") {
+			return prefix, name[len(prefix)+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// 虚拟属性及user.*属性，调用方需持有锁
+func (fs *fakeFs) getxattr(inode *fakeInode, name string) ([]byte, int) {
+	num := func(n uint64) ([]byte, int) {
+		return []byte(strconv.FormatUint(n, 10)), 0
+	}
+	if strings.HasPrefix(name, "ceph.dir.") || strings.HasPrefix(name, "ceph.quota") {
+		if !inode.isDir() {
+			return nil, fakeENODATA
+		}
+	}
+	if strings.HasPrefix(name, "ceph.file.") && inode.isDir() {
+		return nil, fakeENODATA
+	}
+	noQuota := inode.maxBytes == 0 && inode.maxFiles == 0
+	files, subdirs := inode.rcount()
+	switch name {
+	case "ceph.quota":
+		if noQuota {
+			return nil, fakeENODATA
+		}
+		return []byte(fmt.Sprintf("max_bytes=%d max_files=%d", inode.maxBytes, inode.maxFiles)), 0
+	case "ceph.quota.max_bytes":
+		if noQuota {
+			return nil, fakeENODATA
+		}
+		return num(inode.maxBytes)
+	case "ceph.quota.max_files":
+		if noQuota {
+			return nil, fakeENODATA
+		}
+		return num(inode.maxFiles)
+	case "ceph.dir.rbytes":
+		return num(inode.rbytes())
+	case "ceph.dir.rentries":
+		return num(files + subdirs)
+	case "ceph.dir.rfiles":
+		return num(files)
+	case "ceph.dir.rsubdirs":
+		return num(subdirs)
+	case "ceph.dir.entries", "ceph.dir.files", "ceph.dir.subdirs":
+		var nfiles, ndirs uint64
+		for _, child := range inode.children {
+			if child.isDir() {
+				ndirs++
+			} else {
+				nfiles++
+			}
+		}
+		switch name {
+		case "ceph.dir.files":
+			return num(nfiles)
+		case "ceph.dir.subdirs":
+			return num(ndirs)
+		}
+		return num(nfiles + ndirs)
+	}
+	if _, field, ok := layoutXattr(name); ok {
+		if inode.layout == nil {
+			return nil, fakeENODATA
+		}
+		layout := inode.layout
+		switch field {
+		case "":
+			return []byte(layout.xattr()), 0
+		case "pool":
+			return []byte(layout.Pool), 0
+		case "pool_namespace":
+			return []byte(layout.PoolNamespace), 0
+		case "stripe_unit":
+			return num(layout.StripeUnit)
+		case "stripe_count":
+			return num(layout.StripeCount)
+		case "object_size":
+			return num(layout.ObjectSize)
+		}
+		return nil, fakeENODATA
+	}
+	value, ok := inode.xattrs[name]
+	if !ok || !strings.HasPrefix(name, "user.") {
+		return nil, fakeENODATA
+	}
+	return value, 0
+}
+
+func (fs *fakeFs) setxattr(inode *fakeInode, name string, value []byte) int {
+	if inode.readonly {
+		return fakeEROFS
+	}
+	switch name {
+	case "ceph.quota", "ceph.quota.max_bytes", "ceph.quota.max_files":
+		if !inode.isDir() {
+			return fakeEINVAL
+		}
+		maxBytes, maxFiles := inode.maxBytes, inode.maxFiles
+		fields := strings.Fields(string(value))
+		if name != "ceph.quota" {
+			fields = []string{name[len("ceph.quota."):] + "=" + strings.TrimSpace(string(value))}
+		}
+		for _, field := range fields {
+			i := strings.Index(field, "=")
+			if i < 0 {
+				return fakeEINVAL
+			}
+			n, err := strconv.ParseUint(field[i+1:], 10, 64)
+			if err != nil {
+				return fakeEINVAL
+			}
+			switch field[:i] {
+			case "max_bytes":
+				maxBytes = n
+			case "max_files":
+				maxFiles = n
+			default:
+				return fakeEINVAL
+			}
+		}
+		inode.maxBytes, inode.maxFiles = maxBytes, maxFiles
+		inode.ctime = time.Now()
+		return 0
+	}
+	if prefix, field, ok := layoutXattr(name); ok {
+		if (prefix == "ceph.dir.layout") != inode.isDir() {
+			return fakeEINVAL
+		}
+		// 文件有数据后不能修改布局
+		if !inode.isDir() && len(inode.data) > 0 {
+			return fakeENOTEMPTY
+		}
+		layout := inode.effectiveLayout()
+		var err error
+		if field == "" {
+			layout, err = parseCephfsLayout(string(value), layout)
+		} else {
+			err = layout.set(field, string(value))
+		}
+		if err != nil || layout.check() != nil {
+			return fakeEINVAL
+		}
+		known := false
+		for _, pool := range fs.dataPools {
+			known = known || pool == layout.Pool
+		}
+		if !known {
+			return fakeEINVAL
+		}
+		layout.Inherited = ""
+		inode.layout = &layout
+		inode.ctime = time.Now()
+		return 0
+	}
+	if !strings.HasPrefix(name, "user.") {
+		return fakeEOPNOTSUPP
+	}
+	if inode.xattrs == nil {
+		inode.xattrs = map[string][]byte{}
+	}
+	inode.xattrs[name] = append([]byte(nil), value...)
+	inode.ctime = time.Now()
+	return 0
+}
+
+func (fs *fakeFs) removexattr(inode *fakeInode, name string) int {
+	if inode.readonly {
+		return fakeEROFS
+	}
+	switch name {
+	case "ceph.dir.layout":
+		// 根目录的布局不能删除
+		if !inode.isDir() || inode.parent == nil {
+			return fakeEINVAL
+		}
+		if inode.layout == nil {
+			return fakeENODATA
+		}
+		inode.layout = nil
+	case "ceph.quota":
+		inode.maxBytes, inode.maxFiles = 0, 0
+	case "ceph.quota.max_bytes":
+		inode.maxBytes = 0
+	case "ceph.quota.max_files":
+		inode.maxFiles = 0
+	default:
+		if !strings.HasPrefix(name, "user.") {
+			return fakeEOPNOTSUPP
+		}
+		if _, ok := inode.xattrs[name]; !ok {
+			return fakeENODATA
+		}
+		delete(inode.xattrs, name)
+	}
+	inode.ctime = time.Now()
+	return 0
+}
+
+func (f *fakeRados) Ceph_getxattr(p string, name string) ([]byte, error) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	_, _, inode, err := f.fsLookup("getxattr "+name, p)
+	if err != nil {
+		return nil, err
+	}
+	value, ret := f.fs.getxattr(inode, name)
+	if ret < 0 {
+		return nil, fsError("getxattr "+name, p, ret)
+	}
+	return value, nil
+}
+
+func (f *fakeRados) Ceph_setxattr(p string, name string, value []byte) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	_, _, inode, err := f.fsLookup("setxattr "+name, p)
+	if err != nil {
+		return err
+	}
+	if ret := f.fs.setxattr(inode, name, value); ret < 0 {
+		return fsError("setxattr "+name, p, ret)
+	}
+	return nil
+}
+
+func (f *fakeRados) Ceph_removexattr(p string, name string) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	_, _, inode, err := f.fsLookup("removexattr "+name, p)
+	if err != nil {
+		return err
+	}
+	if ret := f.fs.removexattr(inode, name); ret < 0 {
+		return fsError("removexattr "+name, p, ret)
+	}
+	return nil
+}
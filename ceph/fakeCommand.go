@@ -0,0 +1,466 @@
+package ceph
+
+// 模拟集群的mon/osd/pg/mgr命令
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// args为解析后的json命令，ret与librados一致，0表示成功，负数为errno
+type fakeCommand func(f *fakeRados, args map[string]interface{}) (out []byte, outs string, ret int)
+
+var fakeCommands = map[string]fakeCommand{}
+
+func init() {
+	fakeCommands["osd lspools"] = fakeOsdPoolLs
+	fakeCommands["osd pool ls"] = fakeOsdPoolLs
+	fakeCommands["osd pool get-quota"] = fakeOsdPoolGetQuota
+	fakeCommands["osd dump"] = fakeOsdDump
+	fakeCommands["osd tree"] = fakeOsdTree
+	fakeCommands["status"] = fakeStatus
+	fakeCommands["health"] = fakeHealth
+	fakeCommands["df"] = fakeDf
+	fakeCommands["pg stat"] = fakePgStat
+}
+
+// 解析json命令并分发给模拟实现
+func (f *fakeRados) command(kind string, cmd string) (out []byte, outs string, err error) {
+	if !f.connected {
+		return nil, "", commandError(kind, cmd, fakeENOTCONN, "")
+	}
+	args := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(cmd), &args); err != nil {
+		return nil, "", commandError(kind, cmd, fakeEINVAL, "command is not json")
+	}
+	prefix, _ := args["prefix"].(string)
+	handler, ok := fakeCommands[prefix]
+	if !ok {
+		return nil, "", commandError(kind, cmd, fakeEINVAL, "command not supported by fake backend")
+	}
+	out, outs, ret := handler(f, args)
+	if ret < 0 {
+		return out, outs, commandError(kind, cmd, ret, outs)
+	}
+	return out, outs, nil
+}
+
+func fakeArgString(args map[string]interface{}, key string) string {
+	value, _ := args[key].(string)
+	return value
+}
+
+func fakeJson(data interface{}) ([]byte, string, int) {
+	out, err := json.Marshal(data)
+	if err != nil {
+		return nil, err.Error(), fakeEINVAL
+	}
+	return out, "", 0
+}
+
+// 以下函数调用方需持有读锁
+
+// 存储池原始占用
+func (c *fakeCluster) poolUsed(pool *fakePool) (stored uint64, raw uint64) {
+	for _, obj := range pool.objects {
+		stored += uint64(len(obj.data))
+	}
+	return stored, stored * uint64(pool.size)
+}
+
+func (c *fakeCluster) capacity() (total uint64, used uint64) {
+	for _, osd := range c.osds {
+		if osd.in {
+			total += fakeOsdBytes
+		}
+	}
+	for _, pool := range c.pools {
+		_, raw := c.poolUsed(pool)
+		used += raw
+	}
+	if used > total {
+		used = total
+	}
+	return total, used
+}
+
+func (c *fakeCluster) numObjects() (num uint64) {
+	for _, pool := range c.pools {
+		num += uint64(len(pool.objects))
+	}
+	return num
+}
+
+func (c *fakeCluster) osdCounts() (up int, in int) {
+	for _, osd := range c.osds {
+		if osd.up {
+			up++
+		}
+		if osd.in {
+			in++
+		}
+	}
+	return up, in
+}
+
+// pg状态统计，有osd down时按比例降级
+func (c *fakeCluster) pgStates() []PgStateCount {
+	total := 0
+	for _, pool := range c.pools {
+		total += pool.pgNum
+	}
+	up, _ := c.osdCounts()
+	degraded := 0
+	if len(c.osds) > 0 {
+		degraded = total * (len(c.osds) - up) / len(c.osds)
+	}
+	states := []PgStateCount{}
+	if total-degraded > 0 {
+		states = append(states, PgStateCount{StateName: "active+clean", Count: total - degraded})
+	}
+	if degraded > 0 {
+		states = append(states, PgStateCount{StateName: "active+undersized+degraded", Count: degraded})
+	}
+	return states
+}
+
+type fakeHealthCheck struct {
+	Severity string `json:"severity"`
+	Summary  struct {
+		Message string `json:"message"`
+	} `json:"summary"`
+	Detail []map[string]string `json:"detail,omitempty"`
+}
+
+func (c *fakeCluster) health(detail bool) map[string]interface{} {
+	checks := map[string]*fakeHealthCheck{}
+	down := []string{}
+	for _, osd := range c.osds {
+		if !osd.up {
+			down = append(down, fmt.Sprintf("osd.%d (root=default,host=%s) is down", osd.id, osd.host))
+		}
+	}
+	if len(down) > 0 {
+		check := &fakeHealthCheck{Severity: "HEALTH_WARN"}
+		check.Summary.Message = fmt.Sprintf("%d osds down", len(down))
+		if detail {
+			for _, message := range down {
+				check.Detail = append(check.Detail, map[string]string{"message": message})
+			}
+		}
+		checks["OSD_DOWN"] = check
+	}
+	if flags := fakeFlagList(c.flags); len(flags) > 0 {
+		check := &fakeHealthCheck{Severity: "HEALTH_WARN"}
+		check.Summary.Message = strings.Join(flags, ",") + " flag(s) set"
+		checks["OSDMAP_FLAGS"] = check
+	}
+	groups := []string{}
+	for name, flags := range c.groupFlags {
+		if len(flags) > 0 {
+			groups = append(groups, name)
+		}
+	}
+	if len(groups) > 0 {
+		sort.Strings(groups)
+		check := &fakeHealthCheck{Severity: "HEALTH_WARN"}
+		check.Summary.Message = fmt.Sprintf("%d OSDs or CRUSH {nodes, device-classes} have {NOUP,NODOWN,NOIN,NOOUT} flags set", len(groups))
+		if detail {
+			for _, name := range groups {
+				check.Detail = append(check.Detail, map[string]string{"message": name + " has flags " + strings.Join(fakeFlagList(c.groupFlags[name]), ",")})
+			}
+		}
+		checks["OSD_FLAGS"] = check
+	}
+	status := "HEALTH_OK"
+	for _, check := range checks {
+		if check.Severity == "HEALTH_ERR" {
+			status = "HEALTH_ERR"
+			break
+		}
+		status = "HEALTH_WARN"
+	}
+	return map[string]interface{}{
+		"status": status,
+		"checks": checks,
+	}
+}
+
+func (c *fakeCluster) poolNames() []string {
+	names := []string{}
+	for name := range c.pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func fakeOsdPoolLs(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	names := f.cluster.poolNames()
+	if strings.HasPrefix(fakeArgString(args, "format"), "json") {
+		return fakeJson(names)
+	}
+	return []byte(strings.Join(names, "\n")), "", 0
+}
+
+func fakeOsdPoolGetQuota(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	name := fakeArgString(args, "pool")
+	pool, ok := f.cluster.pools[name]
+	if !ok {
+		return nil, "unrecognized pool '" + name + "'", fakeENOENT
+	}
+	return fakeJson(map[string]interface{}{
+		"pool_name":         pool.name,
+		"pool_id":           pool.id,
+		"quota_max_objects": pool.quota.MaxObjects,
+		"quota_max_bytes":   pool.quota.MaxBytes,
+	})
+}
+
+func fakeOsdDump(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	pools := []map[string]interface{}{}
+	for _, name := range f.cluster.poolNames() {
+		pool := f.cluster.pools[name]
+		pools = append(pools, map[string]interface{}{
+			"pool":                 pool.id,
+			"pool_name":            pool.name,
+			"type":                 1,
+			"size":                 pool.size,
+			"min_size":             pool.minSize,
+			"crush_rule":           pool.crushRule,
+			"pg_num":               pool.pgNum,
+			"pg_placement_num":     pool.pgNum,
+			"quota_max_bytes":      pool.quota.MaxBytes,
+			"quota_max_objects":    pool.quota.MaxObjects,
+			"application_metadata": map[string]interface{}{},
+		})
+	}
+	osds := []map[string]interface{}{}
+	for _, osd := range f.cluster.osds {
+		up, in := 0, 0
+		if osd.up {
+			up = 1
+		}
+		if osd.in {
+			in = 1
+		}
+		state := []string{"exists"}
+		if osd.up {
+			state = append(state, "up")
+		}
+		name := fmt.Sprintf("osd.%d", osd.id)
+		state = append(state, fakeFlagList(f.cluster.groupFlags[name])...)
+		osds = append(osds, map[string]interface{}{
+			"osd":              osd.id,
+			"up":               up,
+			"in":               in,
+			"weight":           osd.reweight,
+			"primary_affinity": 1,
+			"state":            state,
+		})
+	}
+	// 不是osd的目标为crush节点
+	nodeFlags := map[string][]string{}
+	for name, flags := range f.cluster.groupFlags {
+		if !strings.HasPrefix(name, "osd.") && len(flags) > 0 {
+			nodeFlags[name] = fakeFlagList(flags)
+		}
+	}
+	flags := append(fakeFlagList(f.cluster.flags), "sortbitwise", "recovery_deletes", "purged_snapdirs", "pglog_hardlimit")
+	return fakeJson(map[string]interface{}{
+		"epoch":              f.cluster.epoch,
+		"fsid":               f.cluster.fsid,
+		"flags":              strings.Join(flags, ","),
+		"crush_node_flags":   nodeFlags,
+		"device_class_flags": map[string][]string{},
+		"pools":              pools,
+		"osds":               osds,
+	})
+}
+
+// 由crush map生成，不包括影子bucket
+func fakeOsdTree(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	m := f.cluster.crush
+	nodes := []OsdTreeNode{}
+	var walk func(id int, weight int, depth int)
+	walk = func(id int, weight int, depth int) {
+		if id >= 0 {
+			osd := f.cluster.osd(id)
+			if osd == nil {
+				return
+			}
+			status := "down"
+			if osd.up {
+				status = "up"
+			}
+			reweight := osd.reweight
+			if !osd.in {
+				reweight = 0
+			}
+			nodes = append(nodes, OsdTreeNode{
+				Id:              osd.id,
+				Name:            fmt.Sprintf("osd.%d", osd.id),
+				Type:            "osd",
+				DeviceClass:     osd.class,
+				CrushWeight:     crushWeight(weight),
+				Depth:           depth,
+				Exists:          1,
+				Status:          status,
+				Reweight:        reweight,
+				PrimaryAffinity: 1,
+			})
+			return
+		}
+		b := m.bucket(id)
+		node := OsdTreeNode{Id: b.Id, Name: b.Name, Type: b.TypeName, TypeId: b.TypeId, CrushWeight: crushWeight(b.Weight), Depth: depth, Children: []int{}}
+		for _, item := range b.Items {
+			node.Children = append(node.Children, item.Id)
+		}
+		nodes = append(nodes, node)
+		for _, item := range b.Items {
+			walk(item.Id, item.Weight, depth+1)
+		}
+	}
+	for _, root := range m.roots(false) {
+		walk(root.Id, root.Weight, 0)
+	}
+	return fakeJson(OsdTree{Nodes: nodes, Stray: []OsdTreeNode{}})
+}
+
+func fakeStatus(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	quorum := []int{}
+	names := []string{}
+	for _, mon := range f.cluster.mons {
+		quorum = append(quorum, mon.rank)
+		names = append(names, mon.name)
+	}
+	up, in := f.cluster.osdCounts()
+	total, used := f.cluster.capacity()
+	var stored uint64
+	for _, pool := range f.cluster.pools {
+		s, _ := f.cluster.poolUsed(pool)
+		stored += s
+	}
+	states := f.cluster.pgStates()
+	numPgs := 0
+	for _, state := range states {
+		numPgs += state.Count
+	}
+	return fakeJson(map[string]interface{}{
+		"fsid":           f.cluster.fsid,
+		"health":         f.cluster.health(false),
+		"election_epoch": 6,
+		"quorum":         quorum,
+		"quorum_names":   names,
+		"monmap": map[string]interface{}{
+			"epoch":    1,
+			"num_mons": len(f.cluster.mons),
+		},
+		"osdmap": map[string]interface{}{
+			"epoch":            f.cluster.epoch,
+			"num_osds":         len(f.cluster.osds),
+			"num_up_osds":      up,
+			"num_in_osds":      in,
+			"num_remapped_pgs": 0,
+		},
+		"pgmap": map[string]interface{}{
+			"pgs_by_state": states,
+			"num_pgs":      numPgs,
+			"num_pools":    len(f.cluster.pools),
+			"num_objects":  f.cluster.numObjects(),
+			"data_bytes":   stored,
+			"bytes_used":   used,
+			"bytes_avail":  total - used,
+			"bytes_total":  total,
+		},
+	})
+}
+
+func fakeHealth(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	return fakeJson(f.cluster.health(fakeArgString(args, "detail") == "detail"))
+}
+
+func fakeDf(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	total, used := f.cluster.capacity()
+	stats := map[string]interface{}{
+		"total_bytes":          total,
+		"total_used_bytes":     used,
+		"total_avail_bytes":    total - used,
+		"total_used_raw_bytes": used,
+		"total_used_raw_ratio": 0.0,
+	}
+	if total > 0 {
+		stats["total_used_raw_ratio"] = float64(used) / float64(total)
+	}
+	pools := []map[string]interface{}{}
+	for _, name := range f.cluster.poolNames() {
+		pool := f.cluster.pools[name]
+		stored, raw := f.cluster.poolUsed(pool)
+		maxAvail := (total - used) / uint64(pool.size)
+		percent := 0.0
+		if raw+total-used > 0 {
+			percent = float64(raw) / float64(raw+total-used)
+		}
+		pools = append(pools, map[string]interface{}{
+			"name": pool.name,
+			"id":   pool.id,
+			"stats": map[string]interface{}{
+				"stored":       stored,
+				"objects":      len(pool.objects),
+				"kb_used":      (raw + 1023) / 1024,
+				"bytes_used":   raw,
+				"percent_used": percent,
+				"max_avail":    maxAvail,
+			},
+		})
+	}
+	return fakeJson(map[string]interface{}{
+		"stats":          stats,
+		"stats_by_class": map[string]interface{}{"hdd": stats},
+		"pools":          pools,
+	})
+}
+
+func fakePgStat(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	total, used := f.cluster.capacity()
+	var stored uint64
+	for _, pool := range f.cluster.pools {
+		s, _ := f.cluster.poolUsed(pool)
+		stored += s
+	}
+	states := []map[string]interface{}{}
+	numPgs := 0
+	for _, state := range f.cluster.pgStates() {
+		states = append(states, map[string]interface{}{"name": state.StateName, "num": state.Count})
+		numPgs += state.Count
+	}
+	return fakeJson(map[string]interface{}{
+		"pg_ready": true,
+		"pg_summary": map[string]interface{}{
+			"num_pg_by_state":   states,
+			"num_pgs":           numPgs,
+			"num_bytes":         stored,
+			"total_bytes":       total,
+			"total_avail_bytes": total - used,
+			"total_used_bytes":  used,
+		},
+	})
+}
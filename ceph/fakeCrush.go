@@ -0,0 +1,220 @@
+package ceph
+
+// 模拟集群的crush map及crush命令
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	fakeCommands["osd crush dump"] = fakeOsdCrushDump
+	fakeCommands["osd crush rule ls"] = fakeOsdCrushRuleLs
+	fakeCommands["osd crush class ls"] = fakeOsdCrushClassLs
+	fakeCommands["osd crush rule create-replicated"] = fakeOsdCrushRuleCreate
+	fakeCommands["osd crush rule rm"] = fakeOsdCrushRuleRm
+	fakeCommands["osd crush move"] = fakeOsdCrushMove
+	fakeCommands["osd crush reweight"] = fakeOsdCrushReweight
+}
+
+// 与新建集群一致：default根节点下每个host一个bucket，一条默认副本规则
+func newFakeCrush(osds []*fakeOsd) *CrushMap {
+	m := &CrushMap{
+		Devices: []CrushDevice{},
+		Types:   []CrushType{},
+		Buckets: []CrushBucket{},
+		Rules: []CrushRule{{
+			RuleId:   0,
+			RuleName: "replicated_rule",
+			Type:     CRUSH_RULE_REPLICATED,
+			Steps: []CrushRuleStep{
+				{Op: "take", Item: -1, ItemName: "default"},
+				{Op: "chooseleaf_firstn", Num: 0, Type: "host"},
+				{Op: "emit"},
+			},
+		}},
+		Tunables: CrushTunables{
+			ChooseLocalTries:         0,
+			ChooseLocalFallbackTries: 0,
+			ChooseTotalTries:         50,
+			ChooseleafDescendOnce:    1,
+			ChooseleafVaryR:          1,
+			ChooseleafStable:         1,
+			StrawCalcVersion:         1,
+			AllowedBucketAlgs:        54,
+			Profile:                  "jewel",
+		},
+	}
+	for id, name := range CRUSH_TYPES {
+		m.Types = append(m.Types, CrushType{TypeId: id, Name: name})
+	}
+	root, _ := m.typeId("root")
+	host, _ := m.typeId("host")
+	m.addBucket("default", root)
+	for _, osd := range osds {
+		name := fmt.Sprintf("osd.%d", osd.id)
+		m.Devices = append(m.Devices, CrushDevice{Id: osd.id, Name: name, Class: osd.class})
+		b := m.bucketByName(osd.host)
+		if b == nil {
+			b = m.addBucket(osd.host, host)
+			id := b.Id
+			r := m.bucketByName("default")
+			r.Items = append(r.Items, CrushBucketItem{Id: id, Pos: len(r.Items)})
+			b = m.bucket(id)
+		}
+		b.Items = append(b.Items, CrushBucketItem{Id: osd.id, Weight: int(osd.weight * CRUSH_WEIGHT_ONE), Pos: len(b.Items)})
+	}
+	m.rebuild()
+	return m
+}
+
+// osd的设备类型修改后同步到crush map，调用方需持有锁
+func (c *fakeCluster) syncCrush() {
+	for _, osd := range c.osds {
+		if d := c.crush.device(osd.id); d != nil {
+			d.Class = osd.class
+		}
+	}
+	c.crush.rebuild()
+}
+
+func fakeOsdCrushDump(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	return fakeJson(f.cluster.crush)
+}
+
+func fakeOsdCrushRuleLs(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	names := []string{}
+	for _, rule := range f.cluster.crush.Rules {
+		names = append(names, rule.RuleName)
+	}
+	return fakeJson(names)
+}
+
+func fakeOsdCrushClassLs(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	return fakeJson(f.cluster.crush.Classes())
+}
+
+func fakeOsdCrushRuleCreate(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	name := fakeArgString(args, "name")
+	root := fakeArgString(args, "root")
+	typ := fakeArgString(args, "type")
+	class := fakeArgString(args, "class")
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	m := f.cluster.crush
+	if m.Rule(name) != nil {
+		return nil, "rule " + name + " already exists", 0
+	}
+	take := m.bucketByName(root)
+	if take == nil {
+		return nil, "root item " + root + " does not exist", fakeENOENT
+	}
+	if _, ok := m.typeId(typ); !ok {
+		return nil, "unknown type " + typ, fakeEINVAL
+	}
+	if class != "" {
+		if take = m.bucketByName(root + "~" + class); take == nil {
+			return nil, "device class " + class + " does not exist", fakeEINVAL
+		}
+	}
+	id := 0
+	for _, rule := range m.Rules {
+		if rule.RuleId >= id {
+			id = rule.RuleId + 1
+		}
+	}
+	m.Rules = append(m.Rules, CrushRule{
+		RuleId:   id,
+		RuleName: name,
+		Type:     CRUSH_RULE_REPLICATED,
+		Steps: []CrushRuleStep{
+			{Op: "take", Item: take.Id, ItemName: take.Name},
+			{Op: "chooseleaf_firstn", Num: 0, Type: typ},
+			{Op: "emit"},
+		},
+	})
+	f.cluster.epoch++
+	return nil, "", 0
+}
+
+func fakeOsdCrushRuleRm(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	name := fakeArgString(args, "name")
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	m := f.cluster.crush
+	rule := m.Rule(name)
+	if rule == nil {
+		return nil, "rule " + name + " does not exist", 0
+	}
+	for _, pool := range f.cluster.pools {
+		if pool.crushRule == rule.RuleId {
+			return nil, fmt.Sprintf("crush rule %s %d is in use", name, rule.RuleId), fakeEBUSY
+		}
+	}
+	rules := []CrushRule{}
+	for _, r := range m.Rules {
+		if r.RuleName != name {
+			rules = append(rules, r)
+		}
+	}
+	m.Rules = rules
+	f.cluster.epoch++
+	return nil, "", 0
+}
+
+func fakeOsdCrushMove(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	name := fakeArgString(args, "name")
+	values, _ := args["args"].([]interface{})
+	location := map[string]string{}
+	for _, value := range values {
+		s, _ := value.(string)
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, "invalid crush location " + s, fakeEINVAL
+		}
+		location[kv[0]] = kv[1]
+	}
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	m := f.cluster.crush
+	if m.bucketByName(name) == nil && m.deviceByName(name) == nil {
+		return nil, "item " + name + " does not exist", fakeENOENT
+	}
+	if err := m.Move(name, location); err != nil {
+		return nil, err.Error(), fakeEINVAL
+	}
+	f.cluster.epoch++
+	return nil, "moved item id " + name + " to location " + strings.Join(crushLocation(location), ","), 0
+}
+
+func fakeOsdCrushReweight(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	name := fakeArgString(args, "name")
+	weight, ok := args["weight"].(float64)
+	if !ok || weight < 0 {
+		return nil, "invalid weight", fakeEINVAL
+	}
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	m := f.cluster.crush
+	d := m.deviceByName(name)
+	if d == nil {
+		if m.bucketByName(name) != nil {
+			return nil, "device '" + name + "' is not a leaf in the crush map", fakeEINVAL
+		}
+		return nil, "device '" + name + "' does not appear in the crush map", fakeENOENT
+	}
+	if err := m.Reweight(name, weight); err != nil {
+		return nil, err.Error(), fakeEINVAL
+	}
+	if osd := f.cluster.osd(d.Id); osd != nil {
+		osd.weight = weight
+	}
+	f.cluster.epoch++
+	return nil, fmt.Sprintf("reweighted item id %d name '%s' to %g in crush map", d.Id, name, weight), 0
+}
@@ -0,0 +1,180 @@
+package ceph
+
+// 模拟集群的mon及mgr状态
+
+import (
+	"math"
+	"time"
+)
+
+func init() {
+	fakeCommands["quorum_status"] = fakeQuorumStatus
+	fakeCommands["mon dump"] = fakeMonDump
+	fakeCommands["time-sync-status"] = fakeTimeSyncStatus
+	fakeCommands["mgr dump"] = fakeMgrDump
+	fakeCommands["mgr module enable"] = fakeMgrModuleEnable
+	fakeCommands["mgr module disable"] = fakeMgrModuleDisable
+}
+
+const (
+	// 与mon_clock_drift_allowed的默认值一致
+	fakeClockDriftAllowed = 0.05
+	// 所有mon的版本
+	fakeMonRelease     = 18
+	fakeMonReleaseName = "reef"
+)
+
+var (
+	fakeMgrAlwaysOn = []string{"balancer", "crash", "devicehealth", "orchestrator", "pg_autoscaler", "progress",
+		"rbd_support", "status", "telemetry", "volumes"}
+	fakeMgrOptional = []string{"dashboard", "influx", "iostat", "nfs", "prometheus", "restful", "zabbix"}
+	// 不能运行的模块及原因
+	fakeMgrErrors = map[string]string{"influx": "influxdb python module not found"}
+	// mgr map保存各版本的always-on模块，只有与mon版本一致的列表生效
+	fakeMgrAlwaysOnReleases = map[string][]string{
+		"quincy": fakeMgrAlwaysOn,
+		"reef":   fakeMgrAlwaysOn,
+		"squid":  append(append([]string{}, fakeMgrAlwaysOn...), "dashboard"),
+	}
+)
+
+// 调用方需持有锁
+func (c *fakeCluster) monmap() map[string]interface{} {
+	mons := []map[string]interface{}{}
+	for _, mon := range c.mons {
+		mons = append(mons, map[string]interface{}{
+			"rank":        mon.rank,
+			"name":        mon.name,
+			"addr":        mon.addr,
+			"public_addr": mon.addr,
+		})
+	}
+	return map[string]interface{}{
+		"epoch":                1,
+		"fsid":                 c.fsid,
+		"min_mon_release":      fakeMonRelease,
+		"min_mon_release_name": fakeMonReleaseName,
+		"mons":                 mons,
+	}
+}
+
+// 第一个mon为leader，第一个节点上的mgr为active
+func fakeQuorumStatus(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	quorum := []int{}
+	names := []string{}
+	for _, mon := range f.cluster.mons {
+		quorum = append(quorum, mon.rank)
+		names = append(names, mon.name)
+	}
+	leader := ""
+	if len(names) > 0 {
+		leader = names[0]
+	}
+	return fakeJson(map[string]interface{}{
+		"election_epoch":     6,
+		"quorum":             quorum,
+		"quorum_names":       names,
+		"quorum_leader_name": leader,
+		"quorum_age":         int(time.Since(f.cluster.created).Seconds()),
+		"monmap":             f.cluster.monmap(),
+	})
+}
+
+func fakeMonDump(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	return fakeJson(f.cluster.monmap())
+}
+
+func fakeTimeSyncStatus(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	skews := map[string]interface{}{}
+	for _, mon := range f.cluster.mons {
+		health := "HEALTH_OK"
+		if math.Abs(mon.skew) > fakeClockDriftAllowed {
+			health = "HEALTH_WARN"
+		}
+		skews[mon.name] = map[string]interface{}{"skew": mon.skew, "latency": 0.0003, "health": health}
+	}
+	return fakeJson(map[string]interface{}{
+		"time_skew_status": skews,
+		"timechecks":       map[string]interface{}{"epoch": 6, "round": 2, "round_status": "finished"},
+	})
+}
+
+func fakeMgrDump(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	standbys := []map[string]interface{}{}
+	for i, mon := range f.cluster.mons {
+		if i > 0 {
+			standbys = append(standbys, map[string]interface{}{"gid": 14100 + i, "name": mon.name})
+		}
+	}
+	available := []map[string]interface{}{}
+	for _, name := range append(append([]string{}, fakeMgrAlwaysOn...), fakeMgrOptional...) {
+		available = append(available, map[string]interface{}{
+			"name":         name,
+			"can_run":      fakeMgrErrors[name] == "",
+			"error_string": fakeMgrErrors[name],
+		})
+	}
+	dump := map[string]interface{}{
+		"epoch":             f.cluster.mgrEpoch,
+		"active_gid":        0,
+		"active_name":       "",
+		"active_addr":       "",
+		"available":         false,
+		"standbys":          standbys,
+		"modules":           fakeFlagList(f.cluster.mgrModules),
+		"always_on_modules": fakeMgrAlwaysOnReleases,
+		"available_modules": available,
+	}
+	if len(f.cluster.mons) > 0 {
+		dump["active_gid"] = 14100
+		dump["active_name"] = f.cluster.mons[0].name
+		dump["active_addr"] = "10.0.0.1:6800/1000"
+		dump["available"] = true
+	}
+	return fakeJson(dump)
+}
+
+func fakeMgrModuleEnable(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	name := fakeArgString(args, "module")
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	if hasFlag(fakeMgrAlwaysOn, name) {
+		return nil, "module '" + name + "' is already enabled (always-on)", 0
+	}
+	if !hasFlag(fakeMgrOptional, name) && fakeArgString(args, "force") != "--force" {
+		return nil, "all mgr daemons do not support module '" + name + "', pass --force to force enablement", fakeENOENT
+	}
+	if fakeMgrErrors[name] != "" && fakeArgString(args, "force") != "--force" {
+		return nil, "module '" + name + "' reports that it cannot run on the active manager daemon: " +
+			fakeMgrErrors[name] + " (pass --force to force enablement)", fakeENOENT
+	}
+	if f.cluster.mgrModules[name] {
+		return nil, "module '" + name + "' is already enabled", 0
+	}
+	f.cluster.mgrModules[name] = true
+	f.cluster.mgrEpoch++
+	return nil, "", 0
+}
+
+func fakeMgrModuleDisable(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	name := fakeArgString(args, "module")
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	if hasFlag(fakeMgrAlwaysOn, name) {
+		return nil, "module '" + name + "' cannot be disabled (always-on)", fakeEINVAL
+	}
+	if !f.cluster.mgrModules[name] {
+		return nil, "module '" + name + "' is already disabled", 0
+	}
+	delete(f.cluster.mgrModules, name)
+	f.cluster.mgrEpoch++
+	return nil, "", 0
+}
@@ -0,0 +1,198 @@
+package ceph
+
+// 模拟集群的osd标志及config-key命令
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+func init() {
+	fakeCommands["osd set"] = fakeOsdSet
+	fakeCommands["osd unset"] = fakeOsdUnset
+	fakeCommands["osd set-group"] = fakeOsdSetGroup
+	fakeCommands["osd unset-group"] = fakeOsdUnsetGroup
+	fakeCommands["config-key get"] = fakeConfigKeyGet
+	fakeCommands["config-key set"] = fakeConfigKeySet
+	fakeCommands["config-key rm"] = fakeConfigKeyRm
+	fakeCommands["config-key exists"] = fakeConfigKeyExists
+	fakeCommands["config-key dump"] = fakeConfigKeyDump
+	fakeCommands["config-key ls"] = fakeConfigKeyLs
+}
+
+// 已设置的标志，按名称排序
+func fakeFlagList(flags map[string]bool) []string {
+	list := []string{}
+	for flag, set := range flags {
+		if set {
+			list = append(list, flag)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+func fakeOsdFlag(f *fakeRados, args map[string]interface{}, set bool) ([]byte, string, int) {
+	key := fakeArgString(args, "key")
+	if !hasFlag(OSD_FLAGS, key) {
+		return nil, "unrecognized flag '" + key + "'", fakeEINVAL
+	}
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	// 与mon一致，pause在osdmap中记录为pauserd和pausewr
+	keys := []string{key}
+	if key == "pause" {
+		keys = OSD_PAUSE_FLAGS
+	}
+	changed := false
+	for _, k := range keys {
+		if f.cluster.flags[k] != set {
+			f.cluster.flags[k] = set
+			changed = true
+		}
+	}
+	if changed {
+		f.cluster.epoch++
+	}
+	if set {
+		return nil, key + " is set", 0
+	}
+	return nil, key + " is unset", 0
+}
+
+func fakeOsdSet(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	return fakeOsdFlag(f, args, true)
+}
+
+func fakeOsdUnset(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	return fakeOsdFlag(f, args, false)
+}
+
+// 调用方需持有锁
+func (c *fakeCluster) isCrushNode(name string) bool {
+	b := c.crush.bucketByName(name)
+	if b == nil {
+		return false
+	}
+	_, _, shadow := crushShadow(name)
+	return !shadow
+}
+
+// who中的osd和crush节点全部存在时才修改
+func fakeOsdGroupFlag(f *fakeRados, args map[string]interface{}, set bool) ([]byte, string, int) {
+	flags := strings.Split(fakeArgString(args, "flags"), ",")
+	for _, flag := range flags {
+		if !hasFlag(OSD_GROUP_FLAGS, flag) {
+			return nil, "unrecognized flag '" + flag + "', must be one of " + strings.Join(OSD_GROUP_FLAGS, ","), fakeEINVAL
+		}
+	}
+	values, _ := args["who"].([]interface{})
+	if len(values) == 0 {
+		return nil, "must specify at least one osd id, crush node or device class", fakeEINVAL
+	}
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	who := []string{}
+	for _, value := range values {
+		name, _ := value.(string)
+		id := -1
+		if _, err := fmt.Sscanf(name, "osd.%d", &id); err == nil && f.cluster.osd(id) != nil {
+			who = append(who, fmt.Sprintf("osd.%d", id))
+			continue
+		}
+		if !f.cluster.isCrushNode(name) {
+			return nil, "unable to parse osd id or crush node or device class: " + name, fakeENOENT
+		}
+		who = append(who, name)
+	}
+	for _, name := range who {
+		if f.cluster.groupFlags[name] == nil {
+			f.cluster.groupFlags[name] = map[string]bool{}
+		}
+		for _, flag := range flags {
+			if set {
+				f.cluster.groupFlags[name][flag] = true
+			} else {
+				delete(f.cluster.groupFlags[name], flag)
+			}
+		}
+		if len(f.cluster.groupFlags[name]) == 0 {
+			delete(f.cluster.groupFlags, name)
+		}
+	}
+	f.cluster.epoch++
+	return nil, "", 0
+}
+
+func fakeOsdSetGroup(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	return fakeOsdGroupFlag(f, args, true)
+}
+
+func fakeOsdUnsetGroup(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	return fakeOsdGroupFlag(f, args, false)
+}
+
+func fakeConfigKeyGet(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	key := fakeArgString(args, "key")
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	value, ok := f.cluster.configKeys[key]
+	if !ok {
+		return nil, "error obtaining '" + key + "': (2) No such file or directory", fakeENOENT
+	}
+	return []byte(value), "obtained '" + key + "'", 0
+}
+
+func fakeConfigKeySet(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	key := fakeArgString(args, "key")
+	if key == "" {
+		return nil, "key is empty", fakeEINVAL
+	}
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	f.cluster.configKeys[key] = fakeArgString(args, "val")
+	return nil, "set " + key, 0
+}
+
+func fakeConfigKeyRm(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	delete(f.cluster.configKeys, fakeArgString(args, "key"))
+	return nil, "key deleted", 0
+}
+
+func fakeConfigKeyExists(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	key := fakeArgString(args, "key")
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	if _, ok := f.cluster.configKeys[key]; !ok {
+		return nil, "key '" + key + "' doesn't exist", fakeENOENT
+	}
+	return nil, "key '" + key + "' exists", 0
+}
+
+// key为前缀，为空时返回所有键值
+func fakeConfigKeyDump(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	prefix := fakeArgString(args, "key")
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	values := map[string]string{}
+	for key, value := range f.cluster.configKeys {
+		if strings.HasPrefix(key, prefix) {
+			values[key] = value
+		}
+	}
+	return fakeJson(values)
+}
+
+func fakeConfigKeyLs(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	keys := []string{}
+	for key := range f.cluster.configKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return fakeJson(keys)
+}
@@ -0,0 +1,275 @@
+package ceph
+
+// 模拟集群的osd命令
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	fakeCommands["osd df"] = fakeOsdDf
+	fakeCommands["osd out"] = fakeOsdOut
+	fakeCommands["osd in"] = fakeOsdIn
+	fakeCommands["osd down"] = fakeOsdDown
+	fakeCommands["osd reweight"] = fakeOsdReweight
+	fakeCommands["osd crush rm-device-class"] = fakeOsdRmDeviceClass
+	fakeCommands["osd crush set-device-class"] = fakeOsdSetDeviceClass
+	fakeCommands["osd lost"] = fakeOsdLost
+}
+
+// 以下函数调用方需持有锁
+
+func (c *fakeCluster) osd(id int) *fakeOsd {
+	for _, osd := range c.osds {
+		if osd.id == id {
+			return osd
+		}
+	}
+	return nil
+}
+
+// 命令中的ids参数，支持0和osd.0两种格式
+func (c *fakeCluster) osdArgs(args map[string]interface{}) ([]*fakeOsd, string, int) {
+	values, _ := args["ids"].([]interface{})
+	if len(values) == 0 {
+		return nil, "ids is empty", fakeEINVAL
+	}
+	osds := []*fakeOsd{}
+	for _, value := range values {
+		name, _ := value.(string)
+		id, err := strconv.Atoi(strings.TrimPrefix(name, "osd."))
+		if err != nil {
+			return nil, "invalid osd id '" + name + "'", fakeEINVAL
+		}
+		osd := c.osd(id)
+		if osd == nil {
+			return nil, fmt.Sprintf("osd.%d does not exist", id), fakeENOENT
+		}
+		osds = append(osds, osd)
+	}
+	return osds, "", 0
+}
+
+// 单个osd的id参数，json中的数字为float64
+func (c *fakeCluster) osdArg(args map[string]interface{}) (*fakeOsd, string, int) {
+	value, ok := args["id"].(float64)
+	if !ok || value < 0 || value != math.Trunc(value) {
+		return nil, "invalid osd id", fakeEINVAL
+	}
+	osd := c.osd(int(value))
+	if osd == nil {
+		return nil, fmt.Sprintf("osd.%d does not exist", int(value)), fakeENOENT
+	}
+	return osd, "", 0
+}
+
+// osd上的pg副本数，pg按权重平均分布在up且in的osd上
+func (c *fakeCluster) osdPgs() map[int]int {
+	total := 0
+	for _, pool := range c.pools {
+		total += pool.pgNum * pool.size
+	}
+	active := []*fakeOsd{}
+	for _, osd := range c.osds {
+		if osd.up && osd.in && osd.weight > 0 {
+			active = append(active, osd)
+		}
+	}
+	pgs := map[int]int{}
+	if len(active) == 0 {
+		return pgs
+	}
+	var weights float64
+	for _, osd := range active {
+		weights += osd.weight * osd.reweight
+	}
+	assigned := 0
+	for _, osd := range active {
+		if weights > 0 {
+			pgs[osd.id] = int(float64(total) * osd.weight * osd.reweight / weights)
+		}
+		assigned += pgs[osd.id]
+	}
+	// 余数分配给id最小的osd
+	for i := 0; assigned < total; i, assigned = (i+1)%len(active), assigned+1 {
+		pgs[active[i].id]++
+	}
+	return pgs
+}
+
+func fakeOsdDf(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	_, used := f.cluster.capacity()
+	_, in := f.cluster.osdCounts()
+	pgs := f.cluster.osdPgs()
+	df := OsdDf{Nodes: []OsdDfNode{}, Stray: []OsdDfNode{}}
+	for _, osd := range f.cluster.osds {
+		node := OsdDfNode{
+			Id:          osd.id,
+			Name:        fmt.Sprintf("osd.%d", osd.id),
+			Type:        "osd",
+			DeviceClass: osd.class,
+			CrushWeight: osd.weight,
+			Kb:          fakeOsdBytes / 1024,
+			Pgs:         pgs[osd.id],
+			Status:      "down",
+		}
+		if osd.up {
+			node.Status = "up"
+		}
+		// 原始占用平均分布在in的osd上
+		if osd.in {
+			node.Reweight = osd.reweight
+			node.KbUsed = used / uint64(in) / 1024
+		}
+		node.KbAvail = node.Kb - node.KbUsed
+		node.Utilization = float64(node.KbUsed) / float64(node.Kb) * 100
+		df.Summary.TotalKb += node.Kb
+		df.Summary.TotalKbUsed += node.KbUsed
+		df.Summary.TotalKbAvail += node.KbAvail
+		df.Nodes = append(df.Nodes, node)
+	}
+	if df.Summary.TotalKb > 0 {
+		df.Summary.AverageUtilization = float64(df.Summary.TotalKbUsed) / float64(df.Summary.TotalKb) * 100
+	}
+	for i := range df.Nodes {
+		if df.Summary.AverageUtilization > 0 {
+			df.Nodes[i].Var = df.Nodes[i].Utilization / df.Summary.AverageUtilization
+		}
+		if i == 0 || df.Nodes[i].Var < df.Summary.MinVar {
+			df.Summary.MinVar = df.Nodes[i].Var
+		}
+		if df.Nodes[i].Var > df.Summary.MaxVar {
+			df.Summary.MaxVar = df.Nodes[i].Var
+		}
+	}
+	return fakeJson(df)
+}
+
+// 修改osd状态，changed返回是否改变
+func fakeOsdState(f *fakeRados, args map[string]interface{}, change func(osd *fakeOsd) (changed bool, outs string)) ([]byte, string, int) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	osds, outs, ret := f.cluster.osdArgs(args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	changed := false
+	for _, osd := range osds {
+		c, message := change(osd)
+		changed = changed || c
+		outs += message + ". "
+	}
+	if changed {
+		f.cluster.syncCrush()
+		f.cluster.epoch++
+	}
+	return nil, strings.TrimSpace(outs), 0
+}
+
+func fakeOsdOut(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	return fakeOsdState(f, args, func(osd *fakeOsd) (bool, string) {
+		if !osd.in {
+			return false, fmt.Sprintf("osd.%d is already out", osd.id)
+		}
+		osd.in = false
+		return true, fmt.Sprintf("marked out osd.%d", osd.id)
+	})
+}
+
+func fakeOsdIn(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	return fakeOsdState(f, args, func(osd *fakeOsd) (bool, string) {
+		if osd.in {
+			return false, fmt.Sprintf("osd.%d is already in", osd.id)
+		}
+		osd.in = true
+		osd.reweight = 1
+		return true, fmt.Sprintf("marked in osd.%d", osd.id)
+	})
+}
+
+func fakeOsdDown(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	return fakeOsdState(f, args, func(osd *fakeOsd) (bool, string) {
+		if !osd.up {
+			return false, fmt.Sprintf("osd.%d is already down", osd.id)
+		}
+		osd.up = false
+		return true, fmt.Sprintf("marked down osd.%d", osd.id)
+	})
+}
+
+func fakeOsdReweight(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	osd, outs, ret := f.cluster.osdArg(args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	weight, ok := args["weight"].(float64)
+	if !ok || weight < 0 || weight > 1 {
+		return nil, "weight must be in the range [0..1]", fakeEINVAL
+	}
+	osd.in = weight > 0
+	if osd.in {
+		osd.reweight = weight
+	}
+	f.cluster.epoch++
+	return nil, fmt.Sprintf("reweighted osd.%d to %g (%x)", osd.id, weight, int(weight*0x10000)), 0
+}
+
+func fakeOsdRmDeviceClass(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	return fakeOsdState(f, args, func(osd *fakeOsd) (bool, string) {
+		changed := osd.class != ""
+		osd.class = ""
+		return changed, fmt.Sprintf("done removing class of osd(s): %d", osd.id)
+	})
+}
+
+func fakeOsdSetDeviceClass(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	class := fakeArgString(args, "class")
+	if class == "" {
+		return nil, "class is empty", fakeEINVAL
+	}
+	f.cluster.lock.Lock()
+	osds, outs, ret := f.cluster.osdArgs(args)
+	if ret == 0 {
+		for _, osd := range osds {
+			if osd.class != "" && osd.class != class {
+				outs, ret = fmt.Sprintf("osd.%d has already bound to class '%s', can not reset class to '%s'; "+
+					"use 'ceph osd crush rm-device-class <id>' to remove old class first", osd.id, osd.class, class), fakeEBUSY
+				break
+			}
+		}
+	}
+	f.cluster.lock.Unlock()
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	return fakeOsdState(f, args, func(osd *fakeOsd) (bool, string) {
+		changed := osd.class != class
+		osd.class = class
+		return changed, fmt.Sprintf("set osd(s) %d to class '%s'", osd.id, class)
+	})
+}
+
+func fakeOsdLost(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	if !fakeArgBool(args, "yes_i_really_mean_it") {
+		return nil, "are you SURE?  this might mean real, permanent data loss.  pass --yes-i-really-mean-it if you really do.", fakeEPERM
+	}
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	osd, outs, ret := f.cluster.osdArg(args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	if osd.up {
+		return nil, fmt.Sprintf("osd.%d is not down", osd.id), fakeEBUSY
+	}
+	osd.lost = true
+	f.cluster.epoch++
+	return nil, fmt.Sprintf("marked osd lost in epoch %d", f.cluster.epoch), 0
+}
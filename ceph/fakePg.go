@@ -0,0 +1,271 @@
+package ceph
+
+// 模拟集群的pg，由crush map计算映射，对象按名称哈希分布到pg
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+)
+
+func init() {
+	fakeCommands["pg ls"] = fakePgLs
+	fakeCommands["pg ls-by-pool"] = fakePgLs
+	fakeCommands["pg ls-by-osd"] = fakePgLs
+	fakeCommands["pg dump_stuck"] = fakePgDumpStuck
+	fakeCommands["query"] = fakePgQuery
+	fakeCommands["pg scrub"] = fakePgScrub
+	fakeCommands["pg deep-scrub"] = fakePgScrub
+	fakeCommands["pg repair"] = fakePgScrub
+}
+
+type fakePg struct {
+	lastScrub     time.Time
+	lastDeepScrub time.Time
+	inconsistent  []InconsistentObject // 最近一次deep-scrub发现的不一致对象
+}
+
+const fakePgStamp = "2006-01-02T15:04:05.000000-0700"
+
+// 对象所在的pg序号
+func fakeObjectPs(key string, pgNum int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(pgNum))
+}
+
+// 所有pg的状态，调用方需持有锁
+func (c *fakeCluster) pgInfos() ([]PgInfo, error) {
+	weights := []uint32{}
+	for _, osd := range c.osds {
+		for len(weights) <= osd.id {
+			weights = append(weights, 0)
+		}
+		if osd.in {
+			weights[osd.id] = uint32(osd.reweight * CRUSH_WEIGHT_ONE)
+		}
+	}
+	mapper, err := newCrushMapper(c.crush, weights)
+	if err != nil {
+		return nil, err
+	}
+	pgs := []PgInfo{}
+	for _, name := range c.poolNames() {
+		pool := c.pools[name]
+		sums := make([]PgStatSum, pool.pgNum)
+		for key, obj := range pool.objects {
+			sum := &sums[fakeObjectPs(key, pool.pgNum)]
+			sum.NumObjects++
+			sum.NumBytes += int64(len(obj.data))
+		}
+		p := &crushPool{id: pool.id, name: pool.name, pgNum: pool.pgNum, pgpNum: pool.pgNum, size: pool.size, rule: pool.crushRule}
+		mapped, err := mapper.mapPool(p)
+		if err != nil {
+			return nil, err
+		}
+		for ps, osds := range mapped {
+			pgid := fmt.Sprintf("%d.%x", pool.id, ps)
+			up := []int{}
+			for _, id := range osds {
+				if osd := c.osd(id); osd != nil && osd.up {
+					up = append(up, id)
+				}
+			}
+			pg := PgInfo{PgId: pgid, Up: up, Acting: up, UpPrimary: -1, ActingPrimary: -1, StatSum: sums[ps]}
+			if len(up) > 0 {
+				pg.UpPrimary, pg.ActingPrimary = up[0], up[0]
+			}
+			state := []string{"active", "clean"}
+			if len(up) < pool.size {
+				state = []string{"active", "undersized", "degraded"}
+				pg.StatSum.NumObjectsDegraded = pg.StatSum.NumObjects * int64(pool.size-len(up))
+			}
+			if len(up) == 0 {
+				state = append([]string{"stale"}, state...)
+			}
+			scrub, deepScrub := c.created, c.created
+			if s := c.pgs[pgid]; s != nil {
+				if len(s.inconsistent) > 0 {
+					state = append(state, "inconsistent")
+					pg.StatSum.NumScrubErrors = int64(len(s.inconsistent))
+				}
+				if s.lastScrub.After(scrub) {
+					scrub = s.lastScrub
+				}
+				if s.lastDeepScrub.After(deepScrub) {
+					deepScrub = s.lastDeepScrub
+				}
+			}
+			pg.State = strings.Join(state, "+")
+			pg.LastScrubStamp = scrub.Format(fakePgStamp)
+			pg.LastDeepScrubStamp = deepScrub.Format(fakePgStamp)
+			pgs = append(pgs, pg)
+		}
+	}
+	return pgs, nil
+}
+
+func (c *fakeCluster) pgInfo(pgid string) (*PgInfo, error) {
+	pgs, err := c.pgInfos()
+	if err != nil {
+		return nil, err
+	}
+	for i := range pgs {
+		if pgs[i].PgId == pgid {
+			return &pgs[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func fakePgLs(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	filter := PgFilter{Osd: -1}
+	if args["prefix"] == "pg ls-by-pool" {
+		filter.Pool = fakeArgString(args, "poolstr")
+		if _, ok := f.cluster.pools[filter.Pool]; !ok {
+			return nil, "pool '" + filter.Pool + "' does not exist", fakeENOENT
+		}
+	}
+	if args["prefix"] == "pg ls-by-osd" {
+		name := fakeArgString(args, "osd")
+		if _, err := fmt.Sscanf(name, "osd.%d", &filter.Osd); err != nil || f.cluster.osd(filter.Osd) == nil {
+			return nil, "osd " + name + " does not exist", fakeENOENT
+		}
+	}
+	values, _ := args["states"].([]interface{})
+	for _, value := range values {
+		state, _ := value.(string)
+		filter.States = append(filter.States, state)
+	}
+	pgs, err := f.cluster.pgInfos()
+	if err != nil {
+		return nil, err.Error(), fakeEINVAL
+	}
+	list := []PgInfo{}
+	for _, pg := range filterPgs(pgs, filter) {
+		if filter.Pool == "" || strings.HasPrefix(pg.PgId, fmt.Sprintf("%d.", f.cluster.pools[filter.Pool].id)) {
+			list = append(list, pg)
+		}
+	}
+	return fakeJson(map[string]interface{}{"pg_ready": true, "pg_stats": list})
+}
+
+func fakePgDumpStuck(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	values, _ := args["stuckops"].([]interface{})
+	ops := []string{}
+	for _, value := range values {
+		op, _ := value.(string)
+		if !hasFlag(PG_STUCK_TYPES, op) {
+			return nil, "unknown stuck op '" + op + "'", fakeEINVAL
+		}
+		ops = append(ops, op)
+	}
+	if len(ops) == 0 {
+		ops = []string{"unclean"}
+	}
+	pgs, err := f.cluster.pgInfos()
+	if err != nil {
+		return nil, err.Error(), fakeEINVAL
+	}
+	stuck := []PgInfo{}
+	for _, pg := range pgs {
+		for _, op := range ops {
+			if (op == "inactive" && !pg.HasState("active")) || (op == "unclean" && !pg.HasState("clean")) ||
+				(op != "inactive" && op != "unclean" && pg.HasState(op)) {
+				pg.StatSum = PgStatSum{}
+				stuck = append(stuck, pg)
+				break
+			}
+		}
+	}
+	if len(stuck) == 0 {
+		return nil, "ok", 0
+	}
+	return fakeJson(map[string]interface{}{"stuck_pg_stats": stuck})
+}
+
+func fakePgQuery(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	pgid := fakeArgString(args, "pgid")
+	pg, err := f.cluster.pgInfo(pgid)
+	if err != nil {
+		return nil, err.Error(), fakeEINVAL
+	}
+	if pg == nil {
+		return nil, "pgid '" + pgid + "' does not exist", fakeENOENT
+	}
+	return fakeJson(map[string]interface{}{
+		"snap_trimq": "[]",
+		"state":      pg.State,
+		"epoch":      f.cluster.epoch,
+		"up":         pg.Up,
+		"acting":     pg.Acting,
+		"info": map[string]interface{}{
+			"pgid":  pg.PgId,
+			"stats": pg,
+		},
+		"recovery_state": []map[string]interface{}{
+			{"name": "Started/Primary/Active", "enter_time": f.cluster.created.Format(fakePgStamp)},
+			{"name": "Started", "enter_time": f.cluster.created.Format(fakePgStamp)},
+		},
+	})
+}
+
+// scrub立即完成，repair清除不一致对象
+func fakePgScrub(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	pgid := fakeArgString(args, "pgid")
+	pg, err := f.cluster.pgInfo(pgid)
+	if err != nil {
+		return nil, err.Error(), fakeEINVAL
+	}
+	if pg == nil {
+		return nil, "pg " + pgid + " dne", fakeENOENT
+	}
+	if pg.ActingPrimary < 0 {
+		return nil, "pg " + pgid + " has no primary osd", fakeEAGAIN
+	}
+	s := f.cluster.pgs[pgid]
+	if s == nil {
+		s = &fakePg{}
+		f.cluster.pgs[pgid] = s
+	}
+	op := strings.TrimPrefix(fakeArgString(args, "prefix"), "pg ")
+	now := time.Now()
+	s.lastScrub = now
+	if op != "scrub" {
+		s.lastDeepScrub = now
+	}
+	if op == "repair" {
+		s.inconsistent = nil
+	}
+	return nil, fmt.Sprintf("instructing pg %s on osd.%d to %s", pgid, pg.ActingPrimary, op), 0
+}
+
+func (f *fakeRados) Rados_pg_inconsistent_objects(pgstr string) (objects []InconsistentObject, err error) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	if !f.connected {
+		return nil, errors.New("cannot list inconsistent objects of pg[" + pgstr + "] " + fmt.Sprintf("%v", fakeENOTCONN))
+	}
+	pg, err := f.cluster.pgInfo(pgstr)
+	if err != nil {
+		return nil, err
+	}
+	if pg == nil {
+		return nil, errors.New("cannot list inconsistent objects of pg[" + pgstr + "] " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	objects = []InconsistentObject{}
+	if s := f.cluster.pgs[pgstr]; s != nil {
+		objects = append(objects, s.inconsistent...)
+	}
+	return objects, nil
+}
@@ -0,0 +1,691 @@
+package ceph
+
+// 模拟对象存储网关，校验签名并实现admin ops接口，用于测试
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const fakeRgwAdmin = "admin"
+
+type fakeRgwObject struct {
+	data        []byte
+	mtime       time.Time
+	etag        string
+	contentType string
+	meta        map[string]string
+}
+
+func newFakeRgwObject(data []byte, content_type string) *fakeRgwObject {
+	if content_type == "" {
+		content_type = "binary/octet-stream"
+	}
+	sum := md5.Sum(data)
+	return &fakeRgwObject{
+		data:        data,
+		mtime:       time.Now(),
+		etag:        hex.EncodeToString(sum[:]),
+		contentType: content_type,
+		meta:        map[string]string{},
+	}
+}
+
+type fakeRgwBucket struct {
+	name    string
+	id      string
+	owner   string // 为空表示未关联用户
+	mtime   time.Time
+	quota   RgwQuota
+	objects map[string]*fakeRgwObject
+}
+
+func (b *fakeRgwBucket) size() (size uint64, actual uint64) {
+	for _, obj := range b.objects {
+		size += uint64(len(obj.data))
+		actual += (uint64(len(obj.data)) + 4095) &^ 4095
+	}
+	return size, actual
+}
+
+type fakeRgwUser struct {
+	RgwUser
+	system bool // system用户可以通过S3接口访问所有存储桶
+}
+
+// 按用户、存储桶、小时和类别累计的使用量
+type fakeRgwUsage struct {
+	user     string
+	bucket   string
+	epoch    int64
+	category string
+	sent     uint64
+	received uint64
+	ops      uint64
+}
+
+type fakeRadosGW struct {
+	sync.Mutex
+	Region      string
+	MinPartSize int // 分块上传除最后一块外的最小分块大小
+	users       map[string]*fakeRgwUser
+	buckets     map[string]*fakeRgwBucket
+	uploads     map[string]*fakeRgwUpload
+	usage       []*fakeRgwUsage
+	nextId      int
+}
+
+// 创建模拟网关，access_key和secret_key为具有所有admin权限的system用户admin的密钥
+func NewFakeRadosGW(access_key string, secret_key string) *fakeRadosGW {
+	gw := &fakeRadosGW{
+		Region:      RGW_DEFAULT_REGION,
+		MinPartSize: S3_MIN_PART_SIZE,
+		users:       map[string]*fakeRgwUser{},
+		buckets:     map[string]*fakeRgwBucket{},
+		uploads:     map[string]*fakeRgwUpload{},
+	}
+	admin := gw.newUser(fakeRgwAdmin, "Administrator", "")
+	admin.system = true
+	admin.Keys = []RgwKey{{User: fakeRgwAdmin, AccessKey: access_key, SecretKey: secret_key}}
+	for _, typ := range []string{"users", "buckets", "usage", "metadata"} {
+		admin.Caps = append(admin.Caps, RgwCap{Type: typ, Perm: "*"})
+	}
+	return gw
+}
+
+func defaultRgwQuota() RgwQuota {
+	return RgwQuota{MaxSize: -1, MaxObjects: -1}
+}
+
+func (gw *fakeRadosGW) newUser(uid string, display_name string, email string) *fakeRgwUser {
+	user := &fakeRgwUser{RgwUser: RgwUser{
+		UserId:      uid,
+		DisplayName: display_name,
+		Email:       email,
+		MaxBuckets:  1000,
+		Keys:        []RgwKey{},
+		Caps:        []RgwCap{},
+		BucketQuota: defaultRgwQuota(),
+		UserQuota:   defaultRgwQuota(),
+	}}
+	gw.users[uid] = user
+	return user
+}
+
+func fakeRgwRandom(n int, alphabet string) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	for i := range b {
+		b[i] = alphabet[int(b[i])%len(alphabet)]
+	}
+	return string(b)
+}
+
+func fakeRgwGenerateKey(uid string) RgwKey {
+	return RgwKey{
+		User:      uid,
+		AccessKey: fakeRgwRandom(20, "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"),
+		SecretKey: fakeRgwRandom(40, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"),
+	}
+}
+
+// access key所属的用户
+func (gw *fakeRadosGW) keyOwner(access_key string) (*fakeRgwUser, *RgwKey) {
+	for _, user := range gw.users {
+		for i := range user.Keys {
+			if user.Keys[i].AccessKey == access_key {
+				return user, &user.Keys[i]
+			}
+		}
+	}
+	return nil, nil
+}
+
+// 创建存储桶，用于测试数据准备
+func (gw *fakeRadosGW) CreateBucket(uid string, bucket string) error {
+	gw.Lock()
+	defer gw.Unlock()
+	if _, ok := gw.users[uid]; !ok {
+		return &RgwError{Op: "create bucket[" + bucket + "]", Status: http.StatusNotFound, Code: "NoSuchUser"}
+	}
+	if _, ok := gw.buckets[bucket]; ok {
+		return &RgwError{Op: "create bucket[" + bucket + "]", Status: http.StatusConflict, Code: "BucketAlreadyExists"}
+	}
+	gw.createBucket(uid, bucket)
+	return nil
+}
+
+func (gw *fakeRadosGW) createBucket(uid string, bucket string) *fakeRgwBucket {
+	gw.nextId++
+	b := &fakeRgwBucket{
+		name:    bucket,
+		id:      fmt.Sprintf("fake.%d.%d", gw.nextId, time.Now().UnixNano()%100000),
+		owner:   uid,
+		mtime:   time.Now(),
+		quota:   gw.users[uid].BucketQuota,
+		objects: map[string]*fakeRgwObject{},
+	}
+	gw.buckets[bucket] = b
+	gw.record(uid, bucket, "create_bucket", 0, 0)
+	return b
+}
+
+// 写入对象，用于测试数据准备
+func (gw *fakeRadosGW) PutObject(bucket string, key string, data []byte) error {
+	gw.Lock()
+	defer gw.Unlock()
+	b, ok := gw.buckets[bucket]
+	if !ok {
+		return &RgwError{Op: "put object[" + key + "]", Status: http.StatusNotFound, Code: "NoSuchBucket"}
+	}
+	if code := gw.putObject(b, key, newFakeRgwObject(append([]byte{}, data...), "")); code != "" {
+		return &RgwError{Op: "put object[" + key + "]", Status: http.StatusForbidden, Code: code}
+	}
+	gw.record(b.owner, b.name, "put_obj", 0, uint64(len(data)))
+	return nil
+}
+
+// 检查配额并写入对象，失败时返回错误码
+func (gw *fakeRadosGW) putObject(b *fakeRgwBucket, key string, obj *fakeRgwObject) string {
+	data := obj.data
+	var old uint64
+	objects := uint64(1)
+	if obj, ok := b.objects[key]; ok {
+		old = uint64(len(obj.data))
+		objects = 0
+	}
+	size, _ := b.size()
+	if rgwQuotaExceeded(b.quota, size-old+uint64(len(data)), uint64(len(b.objects))+objects) {
+		return "QuotaExceeded"
+	}
+	if user, ok := gw.users[b.owner]; ok {
+		var total, count uint64
+		for _, other := range gw.buckets {
+			if other.owner == b.owner {
+				s, _ := other.size()
+				total += s
+				count += uint64(len(other.objects))
+			}
+		}
+		if rgwQuotaExceeded(user.UserQuota, total-old+uint64(len(data)), count+objects) {
+			return "QuotaExceeded"
+		}
+	}
+	b.objects[key] = obj
+	return ""
+}
+
+func rgwQuotaExceeded(quota RgwQuota, size uint64, objects uint64) bool {
+	if !quota.Enabled {
+		return false
+	}
+	return (quota.MaxSize >= 0 && size > uint64(quota.MaxSize)) ||
+		(quota.MaxObjects >= 0 && objects > uint64(quota.MaxObjects))
+}
+
+// 记录使用量，按小时合并
+func (gw *fakeRadosGW) record(uid string, bucket string, category string, sent uint64, received uint64) {
+	epoch := time.Now().Truncate(time.Hour).Unix()
+	for _, u := range gw.usage {
+		if u.user == uid && u.bucket == bucket && u.epoch == epoch && u.category == category {
+			u.sent += sent
+			u.received += received
+			u.ops++
+			return
+		}
+	}
+	gw.usage = append(gw.usage, &fakeRgwUsage{user: uid, bucket: bucket, epoch: epoch, category: category, sent: sent, received: received, ops: 1})
+}
+
+func fakeRgwReply(w http.ResponseWriter, status int, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if result != nil {
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+func fakeRgwError(w http.ResponseWriter, status int, code string) {
+	fakeRgwReply(w, status, map[string]string{"Code": code})
+}
+
+func (gw *fakeRadosGW) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	admin := r.URL.Path == RGW_ADMIN_PATH || strings.HasPrefix(r.URL.Path, RGW_ADMIN_PATH+"/")
+	// admin ops的错误为json，S3接口的错误为xml
+	fail := func(status int, code string) {
+		if admin {
+			fakeRgwError(w, status, code)
+		} else {
+			fakeS3Error(w, r, status, code)
+		}
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		fail(http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+	gw.Lock()
+	defer gw.Unlock()
+	access_key, err := VerifyRgwSignature(r, body, gw.Region, func(access_key string) string {
+		if _, key := gw.keyOwner(access_key); key != nil {
+			return key.SecretKey
+		}
+		return ""
+	})
+	if err != nil {
+		code := strings.SplitN(err.Error(), ":", 2)[0]
+		if strings.Contains(code, " ") {
+			code = "AccessDenied"
+		}
+		fail(http.StatusForbidden, code)
+		return
+	}
+	user, _ := gw.keyOwner(access_key)
+	if user.Suspended != 0 {
+		fail(http.StatusForbidden, "UserSuspended")
+		return
+	}
+	if admin {
+		gw.serveAdmin(w, r, user, body)
+		return
+	}
+	gw.serveS3(w, r, user, body)
+}
+
+// 检查admin权限，GET需要read，其他需要write
+func (user *fakeRgwUser) allowed(typ string, method string) bool {
+	for _, c := range user.Caps {
+		if c.Type != typ {
+			continue
+		}
+		if c.Perm == "*" || (method == http.MethodGet && c.Perm == "read") || (method != http.MethodGet && c.Perm == "write") {
+			return true
+		}
+	}
+	return false
+}
+
+func (gw *fakeRadosGW) serveAdmin(w http.ResponseWriter, r *http.Request, caller *fakeRgwUser, body []byte) {
+	resource := strings.TrimPrefix(r.URL.Path, RGW_ADMIN_PATH)
+	typ := map[string]string{"/user": "users", "/bucket": "buckets", "/usage": "usage", "/metadata/user": "metadata"}[resource]
+	if typ == "" {
+		fakeRgwError(w, http.StatusNotFound, "NoSuchResource")
+		return
+	}
+	if !caller.allowed(typ, r.Method) {
+		fakeRgwError(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+	query := r.URL.Query()
+	var status int
+	var result interface{}
+	switch resource {
+	case "/metadata/user":
+		if r.Method != http.MethodGet {
+			status = http.StatusMethodNotAllowed
+			break
+		}
+		uids := []string{}
+		for uid := range gw.users {
+			uids = append(uids, uid)
+		}
+		sort.Strings(uids)
+		status, result = http.StatusOK, uids
+	case "/user":
+		if _, ok := query["key"]; ok {
+			status, result = gw.adminKey(r.Method, query)
+		} else if _, ok := query["quota"]; ok {
+			status, result = gw.adminQuota(r.Method, query, body)
+		} else {
+			status, result = gw.adminUser(r.Method, query)
+		}
+	case "/bucket":
+		status, result = gw.adminBucket(r.Method, query)
+	case "/usage":
+		if r.Method != http.MethodGet {
+			status = http.StatusMethodNotAllowed
+			break
+		}
+		status, result = http.StatusOK, gw.adminUsage(query)
+	}
+	if code, ok := result.(string); ok && status >= 300 {
+		fakeRgwError(w, status, code)
+		return
+	}
+	if status == http.StatusMethodNotAllowed {
+		fakeRgwError(w, status, "MethodNotAllowed")
+		return
+	}
+	fakeRgwReply(w, status, result)
+}
+
+func fakeRgwBool(query url.Values, key string) bool {
+	v, _ := strconv.ParseBool(query.Get(key))
+	return v
+}
+
+func (gw *fakeRadosGW) userInfo(user *fakeRgwUser, stats bool) RgwUser {
+	info := user.RgwUser
+	info.Keys = append([]RgwKey{}, user.Keys...)
+	info.Caps = append([]RgwCap{}, user.Caps...)
+	if stats {
+		info.Stats = &RgwUserStats{}
+		for _, b := range gw.buckets {
+			if b.owner == user.UserId {
+				size, actual := b.size()
+				info.Stats.Size += size
+				info.Stats.SizeActual += actual
+				info.Stats.NumObjects += uint64(len(b.objects))
+			}
+		}
+	}
+	return info
+}
+
+func (gw *fakeRadosGW) emailUsed(email string, except string) bool {
+	for uid, user := range gw.users {
+		if email != "" && user.Email == email && uid != except {
+			return true
+		}
+	}
+	return false
+}
+
+func (gw *fakeRadosGW) adminUser(method string, query url.Values) (int, interface{}) {
+	uid := query.Get("uid")
+	if uid == "" {
+		return http.StatusBadRequest, "InvalidArgument"
+	}
+	user, exists := gw.users[uid]
+	if !exists && method != http.MethodPut {
+		return http.StatusNotFound, "NoSuchUser"
+	}
+	switch method {
+	case http.MethodGet:
+		return http.StatusOK, gw.userInfo(user, fakeRgwBool(query, "stats"))
+	case http.MethodPut:
+		if exists {
+			return http.StatusConflict, "UserAlreadyExists"
+		}
+		if query.Get("display-name") == "" {
+			return http.StatusBadRequest, "InvalidArgument"
+		}
+		if gw.emailUsed(query.Get("email"), "") {
+			return http.StatusConflict, "EmailExists"
+		}
+		key := fakeRgwGenerateKey(uid)
+		if !fakeRgwBool(query, "generate-key") {
+			key.AccessKey, key.SecretKey = query.Get("access-key"), query.Get("secret-key")
+			if key.AccessKey == "" || key.SecretKey == "" {
+				return http.StatusBadRequest, "InvalidArgument"
+			}
+			if owner, _ := gw.keyOwner(key.AccessKey); owner != nil {
+				return http.StatusConflict, "KeyExists"
+			}
+		}
+		user = gw.newUser(uid, query.Get("display-name"), query.Get("email"))
+		user.Keys = append(user.Keys, key)
+		if max := query.Get("max-buckets"); max != "" {
+			user.MaxBuckets, _ = strconv.Atoi(max)
+		}
+		return http.StatusOK, gw.userInfo(user, false)
+	case http.MethodPost:
+		if name := query.Get("display-name"); name != "" {
+			user.DisplayName = name
+		}
+		if email := query.Get("email"); email != "" {
+			if gw.emailUsed(email, uid) {
+				return http.StatusConflict, "EmailExists"
+			}
+			user.Email = email
+		}
+		if max := query.Get("max-buckets"); max != "" {
+			n, err := strconv.Atoi(max)
+			if err != nil {
+				return http.StatusBadRequest, "InvalidArgument"
+			}
+			user.MaxBuckets = n
+		}
+		if suspended := query.Get("suspended"); suspended != "" {
+			user.Suspended = 0
+			if fakeRgwBool(query, "suspended") {
+				user.Suspended = 1
+			}
+		}
+		return http.StatusOK, gw.userInfo(user, false)
+	case http.MethodDelete:
+		owned := []string{}
+		for name, b := range gw.buckets {
+			if b.owner == uid {
+				owned = append(owned, name)
+			}
+		}
+		if len(owned) > 0 && !fakeRgwBool(query, "purge-data") {
+			return http.StatusConflict, "BucketNotEmpty"
+		}
+		for _, name := range owned {
+			delete(gw.buckets, name)
+		}
+		delete(gw.users, uid)
+		return http.StatusOK, nil
+	}
+	return http.StatusMethodNotAllowed, nil
+}
+
+func (gw *fakeRadosGW) adminKey(method string, query url.Values) (int, interface{}) {
+	user, ok := gw.users[query.Get("uid")]
+	if !ok {
+		return http.StatusNotFound, "NoSuchUser"
+	}
+	switch method {
+	case http.MethodPut:
+		key := fakeRgwGenerateKey(user.UserId)
+		if !fakeRgwBool(query, "generate-key") {
+			key.AccessKey, key.SecretKey = query.Get("access-key"), query.Get("secret-key")
+			if key.AccessKey == "" || key.SecretKey == "" {
+				return http.StatusBadRequest, "InvalidArgument"
+			}
+			if owner, _ := gw.keyOwner(key.AccessKey); owner != nil {
+				return http.StatusConflict, "KeyExists"
+			}
+		}
+		user.Keys = append(user.Keys, key)
+		return http.StatusOK, append([]RgwKey{}, user.Keys...)
+	case http.MethodDelete:
+		for i, key := range user.Keys {
+			if key.AccessKey == query.Get("access-key") {
+				user.Keys = append(user.Keys[:i], user.Keys[i+1:]...)
+				return http.StatusOK, nil
+			}
+		}
+		return http.StatusNotFound, "InvalidAccessKeyId"
+	}
+	return http.StatusMethodNotAllowed, nil
+}
+
+func (gw *fakeRadosGW) adminQuota(method string, query url.Values, body []byte) (int, interface{}) {
+	user, ok := gw.users[query.Get("uid")]
+	if !ok {
+		return http.StatusNotFound, "NoSuchUser"
+	}
+	var quota *RgwQuota
+	switch query.Get("quota-type") {
+	case RGW_QUOTA_USER:
+		quota = &user.UserQuota
+	case RGW_QUOTA_BUCKET:
+		quota = &user.BucketQuota
+	default:
+		return http.StatusBadRequest, "InvalidArgument"
+	}
+	switch method {
+	case http.MethodGet:
+		return http.StatusOK, *quota
+	case http.MethodPut:
+		q := defaultRgwQuota()
+		if err := json.Unmarshal(body, &q); err != nil {
+			return http.StatusBadRequest, "InvalidArgument"
+		}
+		if q.MaxSize < 0 {
+			q.MaxSize, q.MaxSizeKb = -1, 0
+		} else {
+			q.MaxSizeKb = (q.MaxSize + 1023) / 1024
+		}
+		if q.MaxObjects < 0 {
+			q.MaxObjects = -1
+		}
+		*quota = q
+		return http.StatusOK, nil
+	}
+	return http.StatusMethodNotAllowed, nil
+}
+
+func (gw *fakeRadosGW) bucketInfo(b *fakeRgwBucket) RgwBucket {
+	size, actual := b.size()
+	return RgwBucket{
+		Bucket:        b.name,
+		Id:            b.id,
+		Marker:        b.id,
+		Owner:         b.owner,
+		NumShards:     11,
+		Zonegroup:     "default",
+		PlacementRule: "default-placement",
+		Mtime:         b.mtime.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		Usage: map[string]RgwBucketUsage{"rgw.main": {
+			Size:       size,
+			SizeActual: actual,
+			SizeKb:     (size + 1023) / 1024,
+			NumObjects: uint64(len(b.objects)),
+		}},
+		BucketQuota: b.quota,
+	}
+}
+
+func (gw *fakeRadosGW) adminBucket(method string, query url.Values) (int, interface{}) {
+	name := query.Get("bucket")
+	if method == http.MethodGet && name == "" {
+		uid := query.Get("uid")
+		if _, ok := gw.users[uid]; uid != "" && !ok {
+			return http.StatusNotFound, "NoSuchUser"
+		}
+		names := []string{}
+		for _, b := range gw.buckets {
+			if uid == "" || b.owner == uid {
+				names = append(names, b.name)
+			}
+		}
+		sort.Strings(names)
+		return http.StatusOK, names
+	}
+	b, ok := gw.buckets[name]
+	if !ok {
+		return http.StatusNotFound, "NoSuchBucket"
+	}
+	switch method {
+	case http.MethodGet:
+		return http.StatusOK, gw.bucketInfo(b)
+	case http.MethodPut:
+		if id := query.Get("bucket-id"); id != "" && id != b.id {
+			return http.StatusBadRequest, "InvalidArgument"
+		}
+		if _, ok := gw.users[query.Get("uid")]; !ok {
+			return http.StatusNotFound, "NoSuchUser"
+		}
+		b.owner = query.Get("uid")
+		return http.StatusOK, nil
+	case http.MethodPost:
+		if b.owner != query.Get("uid") {
+			return http.StatusBadRequest, "InvalidArgument"
+		}
+		b.owner = ""
+		return http.StatusOK, nil
+	case http.MethodDelete:
+		if len(b.objects) > 0 && !fakeRgwBool(query, "purge-objects") {
+			return http.StatusConflict, "BucketNotEmpty"
+		}
+		delete(gw.buckets, name)
+		return http.StatusOK, nil
+	}
+	return http.StatusMethodNotAllowed, nil
+}
+
+func (gw *fakeRadosGW) adminUsage(query url.Values) RgwUsage {
+	var start, end time.Time
+	if s := query.Get("start"); s != "" {
+		start, _ = time.Parse("2006-01-02 15:04:05", s)
+	}
+	if s := query.Get("end"); s != "" {
+		end, _ = time.Parse("2006-01-02 15:04:05", s)
+	}
+	usage := RgwUsage{Entries: []RgwUsageEntry{}, Summary: []RgwUsageSummary{}}
+	entries := map[string]*RgwUsageEntry{}
+	summary := map[string]*RgwUsageSummary{}
+	users := []string{}
+	for _, u := range gw.usage {
+		if (query.Get("uid") != "" && u.user != query.Get("uid")) || (query.Get("bucket") != "" && u.bucket != query.Get("bucket")) ||
+			(!start.IsZero() && u.epoch < start.Unix()) || (!end.IsZero() && u.epoch >= end.Unix()) {
+			continue
+		}
+		category := RgwUsageCategory{Category: u.category, BytesSent: u.sent, BytesReceived: u.received, Ops: u.ops, SuccessfulOps: u.ops}
+		if _, ok := entries[u.user]; !ok {
+			users = append(users, u.user)
+			entries[u.user] = &RgwUsageEntry{User: u.user, Buckets: []RgwUsageBucket{}}
+			summary[u.user] = &RgwUsageSummary{User: u.user, Categories: []RgwUsageCategory{}}
+		}
+		e := entries[u.user]
+		found := false
+		for i := range e.Buckets {
+			if e.Buckets[i].Bucket == u.bucket && e.Buckets[i].Epoch == u.epoch {
+				e.Buckets[i].Categories = append(e.Buckets[i].Categories, category)
+				found = true
+			}
+		}
+		if !found {
+			e.Buckets = append(e.Buckets, RgwUsageBucket{
+				Bucket:     u.bucket,
+				Time:       time.Unix(u.epoch, 0).UTC().Format("2006-01-02 15:04:05.000000Z"),
+				Epoch:      u.epoch,
+				Owner:      u.user,
+				Categories: []RgwUsageCategory{category},
+			})
+		}
+		s := summary[u.user]
+		found = false
+		for i := range s.Categories {
+			if s.Categories[i].Category == u.category {
+				s.Categories[i].BytesSent += u.sent
+				s.Categories[i].BytesReceived += u.received
+				s.Categories[i].Ops += u.ops
+				s.Categories[i].SuccessfulOps += u.ops
+				found = true
+			}
+		}
+		if !found {
+			s.Categories = append(s.Categories, category)
+		}
+		s.Total.BytesSent += u.sent
+		s.Total.BytesReceived += u.received
+		s.Total.Ops += u.ops
+		s.Total.SuccessfulOps += u.ops
+	}
+	sort.Strings(users)
+	for _, uid := range users {
+		if fakeRgwBool(query, "show-entries") {
+			usage.Entries = append(usage.Entries, *entries[uid])
+		}
+		if query.Get("show-summary") == "" || fakeRgwBool(query, "show-summary") {
+			usage.Summary = append(usage.Summary, *summary[uid])
+		}
+	}
+	return usage
+}
@@ -0,0 +1,1243 @@
+package ceph
+
+// 内存模拟集群，用于测试以及没有安装ceph的开发环境
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 模拟librados返回的errno
+const (
+	fakeEPERM      = -1
+	fakeENOENT     = -2
+	fakeEBADF      = -9
+	fakeEAGAIN     = -11
+	fakeEBUSY      = -16
+	fakeEEXIST     = -17
+	fakeENOTDIR    = -20
+	fakeEISDIR     = -21
+	fakeEINVAL     = -22
+	fakeEROFS      = -30
+	fakeENOTEMPTY  = -39
+	fakeENODATA    = -61
+	fakeEOPNOTSUPP = -95
+	fakeEISCONN    = -106
+	fakeENOTCONN   = -107
+	fakeEDQUOT     = -122
+)
+
+type fakeObject struct {
+	data       []byte
+	xattrs     map[string][]byte
+	omap       map[string][]byte
+	omapHeader []byte
+	locks      map[string]*fakeLock
+	mtime      time.Time
+}
+
+type fakeLocker struct {
+	Locker
+	description string
+	expire      time.Time // 零值表示不过期
+}
+
+type fakeLock struct {
+	exclusive bool
+	tag       string
+	lockers   map[string]*fakeLocker // key为client/cookie
+}
+
+// 清理过期的持有者
+func (l *fakeLock) expire() {
+	now := time.Now()
+	for key, locker := range l.lockers {
+		if !locker.expire.IsZero() && now.After(locker.expire) {
+			delete(l.lockers, key)
+		}
+	}
+}
+
+func newFakeObject() *fakeObject {
+	return &fakeObject{
+		xattrs: map[string][]byte{},
+		omap:   map[string][]byte{},
+		locks:  map[string]*fakeLock{},
+		mtime:  time.Now(),
+	}
+}
+
+func (o *fakeObject) clone() *fakeObject {
+	obj := &fakeObject{
+		data:       append([]byte{}, o.data...),
+		xattrs:     make(map[string][]byte, len(o.xattrs)),
+		omap:       make(map[string][]byte, len(o.omap)),
+		omapHeader: append([]byte{}, o.omapHeader...),
+		locks:      map[string]*fakeLock{},
+		mtime:      o.mtime,
+	}
+	for k, v := range o.xattrs {
+		obj.xattrs[k] = append([]byte{}, v...)
+	}
+	for k, v := range o.omap {
+		obj.omap[k] = append([]byte{}, v...)
+	}
+	return obj
+}
+
+type fakeSnap struct {
+	id      uint64
+	name    string
+	stamp   time.Time
+	objects map[string]*fakeObject
+}
+
+type fakePool struct {
+	id        int64
+	name      string
+	pgNum     int
+	size      int
+	minSize   int
+	crushRule int
+	quota     PoolQuota
+
+	objects map[string]*fakeObject
+	snaps   map[string]*fakeSnap
+	snapSeq uint64
+	images  map[string]*fakeImage // rbd镜像，key与对象相同包含命名空间
+}
+
+func newFakePool(id int64, name string, opts PoolCreateOptions) *fakePool {
+	pool := &fakePool{
+		id:      id,
+		name:    name,
+		pgNum:   opts.PgNum,
+		size:    opts.Size,
+		objects: map[string]*fakeObject{},
+		snaps:   map[string]*fakeSnap{},
+		images:  map[string]*fakeImage{},
+	}
+	if pool.size == 0 {
+		pool.size = 3
+	}
+	pool.minSize = pool.size - pool.size/2
+	return pool
+}
+
+// 写入后是否超出配额，truncate表示覆盖写
+func (p *fakePool) overQuota(key string, end uint64, truncate bool) bool {
+	if p.quota.MaxObjects > 0 {
+		if _, ok := p.objects[key]; !ok && uint64(len(p.objects)) >= p.quota.MaxObjects {
+			return true
+		}
+	}
+	if p.quota.MaxBytes > 0 {
+		var used uint64
+		for k, obj := range p.objects {
+			if k != key {
+				used += uint64(len(obj.data))
+			}
+		}
+		if obj, ok := p.objects[key]; ok && !truncate && uint64(len(obj.data)) > end {
+			end = uint64(len(obj.data))
+		}
+		if used+end > p.quota.MaxBytes {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *fakePool) snapById(id uint64) *fakeSnap {
+	for _, snap := range p.snaps {
+		if snap.id == id {
+			return snap
+		}
+	}
+	return nil
+}
+
+type fakeOsd struct {
+	id       int
+	host     string
+	class    string
+	weight   float64 // crush权重，单位TiB
+	reweight float64
+	up       bool
+	in       bool
+	lost     bool
+}
+
+type fakeMon struct {
+	name string
+	rank int
+	addr string
+	skew float64 // 与leader的时钟偏差，秒
+}
+
+// 集群状态，同一个集群的句柄共享
+type fakeCluster struct {
+	lock    sync.RWMutex
+	fsid    string
+	epoch   int
+	pools   map[string]*fakePool
+	poolSeq int64
+	osds    []*fakeOsd
+	mons    []*fakeMon
+
+	clientSeq int // 客户端id
+	imageSeq  int // rbd镜像id
+	clones    int // 未释放的Rados_clone句柄数
+
+	filesystems map[string]*fakeFs
+
+	flags      map[string]bool            // osd set设置的集群标志
+	groupFlags map[string]map[string]bool // osd set-group设置在osd.N或crush节点上的标志
+	configKeys map[string]string          // config-key存储
+	crush      *CrushMap
+	pgs        map[string]*fakePg // 执行过scrub的pg，key为pgid
+	created    time.Time
+
+	mgrEpoch   int
+	mgrModules map[string]bool // 已启用的mgr模块，不包括总是启用的模块
+}
+
+// 每个osd的容量
+const fakeOsdBytes uint64 = 20 << 30
+
+func newFakeCluster() *fakeCluster {
+	cluster := &fakeCluster{
+		fsid:  "5b2a5d3c-6f0e-4e8a-9c1d-3f2b7a9e4c10",
+		epoch: 1,
+		pools: map[string]*fakePool{},
+
+		flags:      map[string]bool{},
+		groupFlags: map[string]map[string]bool{},
+		configKeys: map[string]string{},
+		pgs:        map[string]*fakePg{},
+		created:    time.Now(),
+
+		mgrEpoch:   1,
+		mgrModules: map[string]bool{"iostat": true, "nfs": true, "restful": true},
+	}
+	// 三个节点，每个节点一个osd和一个mon
+	for i, host := range []string{"node1", "node2", "node3"} {
+		cluster.osds = append(cluster.osds, &fakeOsd{
+			id:       i,
+			host:     host,
+			class:    "hdd",
+			weight:   float64(fakeOsdBytes) / (1 << 40),
+			reweight: 1,
+			up:       true,
+			in:       true,
+		})
+		cluster.mons = append(cluster.mons, &fakeMon{
+			name: host,
+			rank: i,
+			addr: fmt.Sprintf("10.0.0.%d:6789/0", i+1),
+		})
+	}
+	cluster.crush = newFakeCrush(cluster.osds)
+	// 与新建集群的默认存储池保持一致
+	for _, name := range []string{"data", "metadata", "rbd"} {
+		cluster.poolSeq++
+		cluster.pools[name] = newFakePool(cluster.poolSeq, name, PoolCreateOptions{PgNum: POOL_DEFAULT_PG_NUM})
+	}
+	cluster.filesystems = map[string]*fakeFs{
+		"cephfs": newFakeFs(1, "cephfs", "metadata", "data"),
+	}
+	return cluster
+}
+
+func init() {
+	RegisterBackend(BACKEND_FAKE, func(cluster_name string, user_name string) LibRados {
+		return NewFakeRados(cluster_name, user_name)
+	})
+}
+
+type fakeRados struct {
+	cluster *fakeCluster
+
+	cluster_name string
+	user_name    string
+	conf_path    string
+	conf         map[string]string
+
+	created   bool
+	connected bool
+	client    string // 连接后分配的客户端名称，如client.4101
+	clone     bool   // 由Rados_clone创建
+
+	pool_name string // 对象池
+	nspace    string // 命名空间
+	read_snap uint64 // 读取的快照
+
+	fs      *fakeFs // 挂载的文件系统
+	fs_root string  // 挂载的子目录
+}
+
+func NewFakeRados(cluster_name string, user_name string) *fakeRados {
+	return &fakeRados{
+		cluster:      newFakeCluster(),
+		cluster_name: cluster_name,
+		user_name:    user_name,
+		read_snap:    SNAP_HEAD,
+	}
+}
+
+func (f *fakeRados) Rados_create2(flags uint64) error {
+	f.created = true
+	return nil
+}
+
+func (f *fakeRados) Rados_create() error {
+	f.created = true
+	return nil
+}
+
+func (f *fakeRados) Rados_conf_read_file(path string) error {
+	if !f.created {
+		return errors.New("Cannot read config file: " + path + " " + fmt.Sprintf("%v", fakeENOTCONN))
+	}
+	f.conf_path = path
+	return nil
+}
+
+func (f *fakeRados) Rados_conf_set(option string, value string) error {
+	if !f.created {
+		return errors.New("cannot set config option[" + option + "] " + fmt.Sprintf("%v", fakeENOTCONN))
+	}
+	if f.conf == nil {
+		f.conf = map[string]string{}
+	}
+	f.conf[option] = value
+	return nil
+}
+
+func (f *fakeRados) Rados_connect() error {
+	if !f.created {
+		return errors.New("cannot connect to cluster " + fmt.Sprintf("%v", fakeENOTCONN))
+	}
+	f.cluster.lock.Lock()
+	f.cluster.clientSeq++
+	f.client = fmt.Sprintf("client.%d", 4100+f.cluster.clientSeq)
+	f.cluster.lock.Unlock()
+	f.connected = true
+	return nil
+}
+
+// 克隆句柄在created时计数，重复调用只释放一次
+func (f *fakeRados) Rados_shutdown() {
+	if f.clone && f.created {
+		f.cluster.lock.Lock()
+		f.cluster.clones--
+		f.cluster.lock.Unlock()
+	}
+	f.Rados_ioctx_destroy()
+	f.connected = false
+	f.created = false
+}
+
+func (f *fakeRados) Rados_clone() LibRados {
+	if f.created {
+		f.cluster.lock.Lock()
+		f.cluster.clones++
+		f.cluster.lock.Unlock()
+	}
+	return &fakeRados{
+		cluster:      f.cluster,
+		cluster_name: f.cluster_name,
+		user_name:    f.user_name,
+		conf_path:    f.conf_path,
+		created:      f.created,
+		connected:    f.connected,
+		client:       f.client,
+		clone:        true,
+		read_snap:    SNAP_HEAD,
+	}
+}
+
+func (f *fakeRados) Rados_ioctx_set_namespace(nspace string) {
+	f.nspace = nspace
+}
+
+// 按key排序列出，游标为上一页最后一个对象的key
+func (f *fakeRados) Rados_nobjects_list(cursor string, max int) (page ObjectListPage, err error) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	objects, err := f.readObjects()
+	if err != nil {
+		return page, errors.New("cannot list objects " + err.Error())
+	}
+	keys := []string{}
+	for key := range objects {
+		nspace, _ := splitOid(key)
+		if f.nspace == ALL_NAMESPACES || nspace == f.nspace {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	max = listLimit(max)
+	page.Objects = []ObjectEntry{}
+	last := ""
+	for _, key := range keys[sort.SearchStrings(keys, cursor):] {
+		if cursor != "" && key == cursor {
+			continue
+		}
+		if len(page.Objects) == max {
+			page.Next = last
+			break
+		}
+		nspace, name := splitOid(key)
+		page.Objects = append(page.Objects, ObjectEntry{Name: name, Namespace: nspace})
+		last = key
+	}
+	return page, nil
+}
+
+// 当前io上下文对应的存储池，调用方需持有锁
+func (f *fakeRados) pool() (*fakePool, error) {
+	if f.pool_name == "" {
+		return nil, errors.New("io context is not created " + fmt.Sprintf("%v", fakeEBADF))
+	}
+	pool, ok := f.cluster.pools[f.pool_name]
+	if !ok {
+		return nil, errors.New("pool[" + f.pool_name + "] not found " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	return pool, nil
+}
+
+// 对象在存储池中的key，命名空间与对象名之间以\x00分隔
+func (f *fakeRados) oid(object_name string) string {
+	if f.nspace == "" {
+		return object_name
+	}
+	return f.nspace + "\x00" + object_name
+}
+
+func splitOid(key string) (nspace string, object_name string) {
+	if i := strings.IndexByte(key, 0); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+	return "", key
+}
+
+// 按当前读取快照返回对象，调用方需持有锁
+func (f *fakeRados) readObject(object_name string) (*fakeObject, error) {
+	objects, err := f.readObjects()
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := objects[f.oid(object_name)]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("%v", fakeENOENT))
+	}
+	return obj, nil
+}
+
+// 写入操作的目标对象，不存在时创建，调用方需持有写锁
+func (f *fakeRados) writeObject(pool *fakePool, object_name string) *fakeObject {
+	obj, ok := pool.objects[f.oid(object_name)]
+	if !ok {
+		obj = newFakeObject()
+		pool.objects[f.oid(object_name)] = obj
+	}
+	return obj
+}
+
+// 按当前读取快照返回对象集合，调用方需持有锁
+func (f *fakeRados) readObjects() (map[string]*fakeObject, error) {
+	pool, err := f.pool()
+	if err != nil {
+		return nil, err
+	}
+	if f.read_snap == SNAP_HEAD {
+		return pool.objects, nil
+	}
+	snap := pool.snapById(f.read_snap)
+	if snap == nil {
+		return nil, errors.New("snapshot not found " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	return snap.objects, nil
+}
+
+func (f *fakeRados) Rados_ioctx_create(pool_name string) error {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	if !f.connected {
+		return errors.New("cannot open rados pool[" + pool_name + "] " + fmt.Sprintf("%v", fakeENOTCONN))
+	}
+	if _, ok := f.cluster.pools[pool_name]; !ok {
+		return errors.New("cannot open rados pool[" + pool_name + "] " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	f.pool_name = pool_name
+	f.read_snap = SNAP_HEAD
+	return nil
+}
+
+func (f *fakeRados) Rados_ioctx_destroy() {
+	f.pool_name = ""
+	f.nspace = ""
+	f.read_snap = SNAP_HEAD
+}
+
+func (f *fakeRados) write(key string, value []byte, offset uint64, truncate bool) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	pool, err := f.pool()
+	if err != nil {
+		return err
+	}
+	key = f.oid(key)
+	end := offset + uint64(len(value))
+	if pool.overQuota(key, end, truncate) {
+		return errors.New(fmt.Sprintf("%v", fakeEDQUOT))
+	}
+	obj, ok := pool.objects[key]
+	if !ok {
+		obj = newFakeObject()
+		pool.objects[key] = obj
+	}
+	if truncate {
+		obj.data = obj.data[:0]
+	}
+	if end > uint64(len(obj.data)) {
+		obj.data = append(obj.data, make([]byte, end-uint64(len(obj.data)))...)
+	}
+	copy(obj.data[offset:], value)
+	obj.mtime = time.Now()
+	return nil
+}
+
+func (f *fakeRados) Rados_write(key string, value []byte, offset uint) error {
+	if err := f.write(key, value, uint64(offset), false); err != nil {
+		return errors.New("cannot write object to pool[" + f.pool_name + "] " + err.Error())
+	}
+	return nil
+}
+
+func (f *fakeRados) Rados_append(object_name string, value []byte) error {
+	f.cluster.lock.Lock()
+	pool, err := f.pool()
+	var size uint64
+	if err == nil {
+		if obj, ok := pool.objects[f.oid(object_name)]; ok {
+			size = uint64(len(obj.data))
+		}
+	}
+	f.cluster.lock.Unlock()
+	if err == nil {
+		err = f.write(object_name, value, size, false)
+	}
+	if err != nil {
+		return errors.New("cannot append object[" + object_name + "] " + err.Error())
+	}
+	return nil
+}
+
+func (f *fakeRados) Rados_write_full(object_name string, value []byte) error {
+	if err := f.write(object_name, value, 0, true); err != nil {
+		return errors.New("cannot write pool[" + object_name + "] " + err.Error())
+	}
+	return nil
+}
+
+func (f *fakeRados) Rados_Read(key string, size uint, offset uint64) (out bytes.Buffer, err error) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	objects, err := f.readObjects()
+	if err != nil {
+		return out, errors.New("cannot read object to pool[" + f.pool_name + "] " + err.Error())
+	}
+	obj, ok := objects[f.oid(key)]
+	if !ok {
+		return out, errors.New("cannot read object to pool[" + f.pool_name + "] " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	if offset < uint64(len(obj.data)) {
+		end := offset + uint64(size)
+		if end > uint64(len(obj.data)) {
+			end = uint64(len(obj.data))
+		}
+		out.Write(obj.data[offset:end])
+	}
+	return out, nil
+}
+
+func (f *fakeRados) Rados_setxattr(object_name string, attr_name string, value []byte) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	pool, err := f.pool()
+	if err != nil {
+		return errors.New("cannot set extended attribute on object[" + object_name + "] " + err.Error())
+	}
+	obj := f.writeObject(pool, object_name)
+	obj.xattrs[attr_name] = append([]byte{}, value...)
+	return nil
+}
+
+func (f *fakeRados) Rados_getxattr(object_name string, attr_name string) (value []byte, err error) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	objects, err := f.readObjects()
+	if err != nil {
+		return nil, errors.New("cannot get extended attribute on object[" + object_name + "] " + err.Error())
+	}
+	obj, ok := objects[f.oid(object_name)]
+	if !ok {
+		return nil, errors.New("cannot get extended attribute on object[" + object_name + "] " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	value, ok = obj.xattrs[attr_name]
+	if !ok {
+		return nil, errors.New("cannot get extended attribute on object[" + object_name + "] " + fmt.Sprintf("%v", fakeENODATA))
+	}
+	return append([]byte{}, value...), nil
+}
+
+func (f *fakeRados) Rados_getxattrs(object_name string) (attrs []XattrEntry, err error) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	obj, err := f.readObject(object_name)
+	if err != nil {
+		return nil, errors.New("cannot get extended attributes on object[" + object_name + "] " + err.Error())
+	}
+	values := make(map[string][]byte, len(obj.xattrs))
+	for name, value := range obj.xattrs {
+		values[name] = append([]byte{}, value...)
+	}
+	return sortXattrs(values), nil
+}
+
+func (f *fakeRados) Rados_rmxattr(object_name string, attr_name string) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	pool, err := f.pool()
+	if err != nil {
+		return errors.New("cannot remove extended attribute on object[" + object_name + "] " + err.Error())
+	}
+	obj, ok := pool.objects[f.oid(object_name)]
+	if !ok {
+		return errors.New("cannot remove extended attribute on object[" + object_name + "] " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	if _, ok := obj.xattrs[attr_name]; !ok {
+		return errors.New("cannot remove extended attribute on object[" + object_name + "] " + fmt.Sprintf("%v", fakeENODATA))
+	}
+	delete(obj.xattrs, attr_name)
+	return nil
+}
+
+func (f *fakeRados) Rados_omap_get_vals(object_name string, start_after string, prefix string, max int) (page OmapPage, err error) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	obj, err := f.readObject(object_name)
+	if err != nil {
+		return page, errors.New("cannot get omap values on object[" + object_name + "] " + err.Error())
+	}
+	keys := []string{}
+	for key := range obj.omap {
+		if key > start_after && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	max = listLimit(max)
+	if len(keys) > max {
+		keys = keys[:max]
+		page.More = true
+	}
+	page.Vals = []OmapEntry{}
+	for _, key := range keys {
+		page.Vals = append(page.Vals, OmapEntry{Key: key, Value: append([]byte{}, obj.omap[key]...)})
+	}
+	return page, nil
+}
+
+func (f *fakeRados) Rados_omap_set(object_name string, vals []OmapEntry) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	pool, err := f.pool()
+	if err != nil {
+		return errors.New("cannot set omap values on object[" + object_name + "] " + err.Error())
+	}
+	obj := f.writeObject(pool, object_name)
+	for _, val := range vals {
+		obj.omap[val.Key] = append([]byte{}, val.Value...)
+	}
+	return nil
+}
+
+func (f *fakeRados) Rados_omap_rm_keys(object_name string, keys []string) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	pool, err := f.pool()
+	if err != nil {
+		return errors.New("cannot remove omap keys on object[" + object_name + "] " + err.Error())
+	}
+	obj, ok := pool.objects[f.oid(object_name)]
+	if !ok {
+		return errors.New("cannot remove omap keys on object[" + object_name + "] " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	for _, key := range keys {
+		delete(obj.omap, key)
+	}
+	return nil
+}
+
+func (f *fakeRados) Rados_omap_clear(object_name string) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	pool, err := f.pool()
+	if err != nil {
+		return errors.New("cannot clear omap on object[" + object_name + "] " + err.Error())
+	}
+	obj, ok := pool.objects[f.oid(object_name)]
+	if !ok {
+		return errors.New("cannot clear omap on object[" + object_name + "] " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	obj.omap = map[string][]byte{}
+	return nil
+}
+
+func (f *fakeRados) Rados_omap_get_header(object_name string) (header []byte, err error) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	obj, err := f.readObject(object_name)
+	if err != nil {
+		return nil, errors.New("cannot get omap header on object[" + object_name + "] " + err.Error())
+	}
+	return append([]byte{}, obj.omapHeader...), nil
+}
+
+func (f *fakeRados) Rados_omap_set_header(object_name string, header []byte) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	pool, err := f.pool()
+	if err != nil {
+		return errors.New("cannot set omap header on object[" + object_name + "] " + err.Error())
+	}
+	obj := f.writeObject(pool, object_name)
+	obj.omapHeader = append([]byte{}, header...)
+	return nil
+}
+
+// 模拟集群的异步IO在提交时同步完成
+func (f *fakeRados) aio(op string, object_name string, do func() ([]byte, int)) (*AioFuture, error) {
+	if f.pool_name == "" {
+		return nil, errors.New("cannot schedule aio " + op + " " + fmt.Sprintf("%v", fakeEBADF))
+	}
+	future := newAioFuture(op, object_name, nil)
+	data, ret := do()
+	future.setComplete(ret, data)
+	future.setSafe()
+	return future, nil
+}
+
+// 从错误信息末尾取出errno
+func fakeErrno(err error) int {
+	if err == nil {
+		return 0
+	}
+	msg := err.Error()
+	var errno int
+	if _, e := fmt.Sscanf(msg[strings.LastIndex(msg, " ")+1:], "%d", &errno); e != nil || errno >= 0 {
+		return fakeEINVAL
+	}
+	return errno
+}
+
+func (f *fakeRados) Rados_aio_write(object_name string, value []byte, offset uint64) (*AioFuture, error) {
+	return f.aio("write", object_name, func() ([]byte, int) {
+		return nil, fakeErrno(f.write(object_name, value, offset, false))
+	})
+}
+
+func (f *fakeRados) Rados_aio_write_full(object_name string, value []byte) (*AioFuture, error) {
+	return f.aio("write_full", object_name, func() ([]byte, int) {
+		return nil, fakeErrno(f.write(object_name, value, 0, true))
+	})
+}
+
+func (f *fakeRados) Rados_aio_append(object_name string, value []byte) (*AioFuture, error) {
+	return f.aio("append", object_name, func() ([]byte, int) {
+		return nil, fakeErrno(f.Rados_append(object_name, value))
+	})
+}
+
+func (f *fakeRados) Rados_aio_read(object_name string, size uint, offset uint64) (*AioFuture, error) {
+	return f.aio("read", object_name, func() ([]byte, int) {
+		out, err := f.Rados_Read(object_name, size, offset)
+		if err != nil {
+			return nil, fakeErrno(err)
+		}
+		return out.Bytes(), out.Len()
+	})
+}
+
+func (f *fakeRados) Rados_aio_remove(object_name string) (*AioFuture, error) {
+	return f.aio("remove", object_name, func() ([]byte, int) {
+		return nil, fakeErrno(f.Rados_remove(object_name))
+	})
+}
+
+func (f *fakeRados) Rados_aio_flush() error {
+	if f.pool_name == "" {
+		return errors.New("flush to disk error " + fmt.Sprintf("%v", fakeEBADF))
+	}
+	return nil
+}
+
+func (f *fakeRados) Rados_mon_command(cmd string, params []byte) (out []byte, outs string, err error) {
+	return f.command("mon", cmd)
+}
+
+func (f *fakeRados) Rados_mgr_command(cmd string, params []byte) (out []byte, outs string, err error) {
+	return f.command("mgr", cmd)
+}
+
+func (f *fakeRados) Rados_osd_command(osdId int, cmd string, params []byte) (out []byte, outs string, err error) {
+	return f.command("osd", cmd)
+}
+
+func (f *fakeRados) Rados_pg_command(pgstr string, cmd string, params []byte) (out []byte, outs string, err error) {
+	return f.command("pg", cmd)
+}
+
+func (f *fakeRados) Rados_monitor_log() error {
+	return nil
+}
+
+func (f *fakeRados) Rados_monitor_log2() error {
+	return nil
+}
+
+func (f *fakeRados) Rados_pool_list() (pools []Pool, err error) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	if !f.connected {
+		return nil, errors.New("cannot list pools " + fmt.Sprintf("%v", fakeENOTCONN))
+	}
+	pools = []Pool{}
+	for _, name := range f.cluster.poolNames() {
+		p := f.cluster.pools[name]
+		pools = append(pools, Pool{
+			Id:              p.id,
+			Name:            p.name,
+			Type:            POOL_TYPE_REPLICATED,
+			Size:            p.size,
+			MinSize:         p.minSize,
+			PgNum:           p.pgNum,
+			PgpNum:          p.pgNum,
+			CrushRule:       p.crushRule,
+			QuotaMaxBytes:   p.quota.MaxBytes,
+			QuotaMaxObjects: p.quota.MaxObjects,
+			Applications:    []string{},
+		})
+	}
+	return pools, nil
+}
+
+func (f *fakeRados) Rados_pool_create(pool_name string, opts PoolCreateOptions) error {
+	if err := checkPoolName(pool_name); err != nil {
+		return err
+	}
+	if err := opts.check(); err != nil {
+		return err
+	}
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	if !f.connected {
+		return errors.New("cannot create pool[" + pool_name + "] " + fmt.Sprintf("%v", fakeENOTCONN))
+	}
+	if _, ok := f.cluster.pools[pool_name]; ok {
+		return errors.New("cannot create pool[" + pool_name + "] " + fmt.Sprintf("%v", fakeEEXIST))
+	}
+	rule := f.cluster.crush.Rule("replicated_rule")
+	if opts.CrushRule != "" {
+		rule = f.cluster.crush.Rule(opts.CrushRule)
+	}
+	if rule == nil {
+		return errors.New("cannot create pool[" + pool_name + "] " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	f.cluster.poolSeq++
+	f.cluster.pools[pool_name] = newFakePool(f.cluster.poolSeq, pool_name, opts)
+	f.cluster.pools[pool_name].crushRule = rule.RuleId
+	return nil
+}
+
+func (f *fakeRados) Rados_pool_delete(pool_name string, confirm string) error {
+	if err := checkPoolDelete(pool_name, confirm); err != nil {
+		return err
+	}
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	if !f.connected {
+		return errors.New("cannot delete pool[" + pool_name + "] " + fmt.Sprintf("%v", fakeENOTCONN))
+	}
+	if _, ok := f.cluster.pools[pool_name]; !ok {
+		return errors.New("cannot delete pool[" + pool_name + "] " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	delete(f.cluster.pools, pool_name)
+	return nil
+}
+
+func (f *fakeRados) Rados_pool_get_quota(pool_name string) (quota PoolQuota, err error) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	if !f.connected {
+		return quota, errors.New("cannot get quota of pool[" + pool_name + "] " + fmt.Sprintf("%v", fakeENOTCONN))
+	}
+	pool, ok := f.cluster.pools[pool_name]
+	if !ok {
+		return quota, errors.New("cannot get quota of pool[" + pool_name + "] " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	return pool.quota, nil
+}
+
+func (f *fakeRados) Rados_pool_set_quota(pool_name string, quota PoolQuota) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	if !f.connected {
+		return errors.New("cannot set quota of pool[" + pool_name + "] " + fmt.Sprintf("%v", fakeENOTCONN))
+	}
+	pool, ok := f.cluster.pools[pool_name]
+	if !ok {
+		return errors.New("cannot set quota of pool[" + pool_name + "] " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	pool.quota = quota
+	return nil
+}
+
+func (f *fakeRados) Rados_pool_stat(pool_name string) (stat PoolStat, err error) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	if !f.connected {
+		return stat, errors.New("cannot open rados pool[" + pool_name + "] " + fmt.Sprintf("%v", fakeENOTCONN))
+	}
+	pool, ok := f.cluster.pools[pool_name]
+	if !ok {
+		return stat, errors.New("cannot open rados pool[" + pool_name + "] " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	for _, obj := range pool.objects {
+		stat.NumBytes += uint64(len(obj.data))
+	}
+	stat.NumKb = (stat.NumBytes + 1023) / 1024
+	stat.NumObjects = uint64(len(pool.objects))
+	stat.NumObjectCopies = stat.NumObjects * uint64(pool.size)
+	return stat, nil
+}
+
+func (f *fakeRados) Rados_ioctx_snap_create(snapname string) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	pool, err := f.pool()
+	if err != nil {
+		return errors.New("cannot create snapshot[" + snapname + "] " + err.Error())
+	}
+	if _, ok := pool.snaps[snapname]; ok {
+		return errors.New("cannot create snapshot[" + snapname + "] " + fmt.Sprintf("%v", fakeEEXIST))
+	}
+	pool.snapSeq++
+	snap := &fakeSnap{
+		id:      pool.snapSeq,
+		name:    snapname,
+		stamp:   time.Now(),
+		objects: make(map[string]*fakeObject, len(pool.objects)),
+	}
+	for key, obj := range pool.objects {
+		snap.objects[key] = obj.clone()
+	}
+	pool.snaps[snapname] = snap
+	return nil
+}
+
+func (f *fakeRados) Rados_ioctx_snap_remove(snapname string) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	pool, err := f.pool()
+	if err != nil {
+		return errors.New("cannot remove snapshot[" + snapname + "] " + err.Error())
+	}
+	if _, ok := pool.snaps[snapname]; !ok {
+		return errors.New("cannot remove snapshot[" + snapname + "] " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	delete(pool.snaps, snapname)
+	return nil
+}
+
+func (f *fakeRados) Rados_ioctx_snap_rollback(snapname string, key string) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	pool, err := f.pool()
+	if err != nil {
+		return errors.New("cannot rollback object[" + key + "] " + err.Error())
+	}
+	snap, ok := pool.snaps[snapname]
+	if !ok {
+		return errors.New("cannot rollback object[" + key + "] " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	// 快照中不存在的对象回滚后被删除
+	if obj, ok := snap.objects[f.oid(key)]; ok {
+		pool.objects[f.oid(key)] = obj.clone()
+	} else {
+		delete(pool.objects, f.oid(key))
+	}
+	return nil
+}
+
+func (f *fakeRados) Rados_rollback(snapname string, key string) error {
+	return f.Rados_ioctx_snap_rollback(snapname, key)
+}
+
+func (f *fakeRados) Rados_ioctx_snap_set_read(snap uint64) error {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	pool, err := f.pool()
+	if err != nil {
+		return errors.New("cannot set read snapshot " + err.Error())
+	}
+	if snap != SNAP_HEAD && pool.snapById(snap) == nil {
+		return errors.New("cannot set read snapshot " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	f.read_snap = snap
+	return nil
+}
+
+func (f *fakeRados) Rados_ioctx_snap_lookup(snapname string) (uint64, error) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	pool, err := f.pool()
+	if err != nil {
+		return 0, errors.New("cannot lookup snapshot[" + snapname + "] " + err.Error())
+	}
+	snap, ok := pool.snaps[snapname]
+	if !ok {
+		return 0, errors.New("cannot lookup snapshot[" + snapname + "] " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	return snap.id, nil
+}
+
+func (f *fakeRados) Rados_ioctx_snap_list() (snaps []PoolSnap, err error) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	pool, err := f.pool()
+	if err != nil {
+		return nil, errors.New("cannot list snapshots " + err.Error())
+	}
+	snaps = []PoolSnap{}
+	for _, snap := range pool.snaps {
+		snaps = append(snaps, PoolSnap{
+			Id:    snap.id,
+			Name:  snap.name,
+			Stamp: snap.stamp,
+		})
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].Id < snaps[j].Id })
+	return snaps, nil
+}
+
+func (f *fakeRados) Rados_cluster_stat() (stat ClusterStat, err error) {
+	if !f.connected {
+		return stat, errors.New("read cluster stat error " + fmt.Sprintf("%v", fakeENOTCONN))
+	}
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	total, used := f.cluster.capacity()
+	stat = ClusterStat{
+		Kb:         total / 1024,
+		KbUsed:     used / 1024,
+		KbAvail:    (total - used) / 1024,
+		NumObjects: f.cluster.numObjects(),
+	}
+	return stat, nil
+}
+
+func (f *fakeRados) Rados_version() (major int, minor int, extra int) {
+	return 3, 0, 0
+}
+
+func (f *fakeRados) Rados_stat(object_name string) (stat ObjectStat, err error) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	objects, err := f.readObjects()
+	if err != nil {
+		return stat, errors.New("cannot stat object[" + object_name + "] " + err.Error())
+	}
+	obj, ok := objects[f.oid(object_name)]
+	if !ok {
+		return stat, errors.New("cannot stat object[" + object_name + "] " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	stat.Size = uint64(len(obj.data))
+	stat.Mtime = obj.mtime
+	return stat, nil
+}
+
+func (f *fakeRados) Rados_remove(object_name string) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	pool, err := f.pool()
+	if err != nil {
+		return errors.New("cannot remove object[" + object_name + "] " + err.Error())
+	}
+	if _, ok := pool.objects[f.oid(object_name)]; !ok {
+		return errors.New("cannot remove object[" + object_name + "] " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	delete(pool.objects, f.oid(object_name))
+	return nil
+}
+
+func (f *fakeRados) lock(object_name string, lock_name string, exclusive bool, opts LockOptions) error {
+	if err := checkLockName(lock_name); err != nil {
+		return err
+	}
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	pool, err := f.pool()
+	if err != nil {
+		return err
+	}
+	obj := f.writeObject(pool, object_name)
+	lock, ok := obj.locks[lock_name]
+	if !ok {
+		lock = &fakeLock{lockers: map[string]*fakeLocker{}}
+		obj.locks[lock_name] = lock
+	}
+	lock.expire()
+	key := f.client + "/" + opts.Cookie
+	if locker, ok := lock.lockers[key]; ok {
+		if !opts.Renew {
+			return errors.New(fmt.Sprintf("%v", fakeEEXIST))
+		}
+		locker.expire = time.Time{}
+		if opts.Duration > 0 {
+			locker.expire = time.Now().Add(opts.Duration)
+		}
+		return nil
+	}
+	if len(lock.lockers) > 0 && (exclusive || lock.exclusive || lock.tag != opts.Tag) {
+		return errors.New(fmt.Sprintf("%v", fakeEBUSY))
+	}
+	lock.exclusive = exclusive
+	lock.tag = opts.Tag
+	locker := &fakeLocker{
+		Locker: Locker{
+			Client:  f.client,
+			Cookie:  opts.Cookie,
+			Address: "10.0.0.100:0/" + strings.TrimPrefix(f.client, "client."),
+		},
+		description: opts.Description,
+	}
+	if opts.Duration > 0 {
+		locker.expire = time.Now().Add(opts.Duration)
+	}
+	lock.lockers[key] = locker
+	return nil
+}
+
+func (f *fakeRados) Rados_lock_exclusive(object_name string, lock_name string, opts LockOptions) error {
+	if err := f.lock(object_name, lock_name, true, opts); err != nil {
+		return errors.New("cannot lock object[" + object_name + "] exclusive[" + lock_name + "] " + err.Error())
+	}
+	return nil
+}
+
+func (f *fakeRados) Rados_lock_shared(object_name string, lock_name string, opts LockOptions) error {
+	if err := f.lock(object_name, lock_name, false, opts); err != nil {
+		return errors.New("cannot lock object[" + object_name + "] shared[" + lock_name + "] " + err.Error())
+	}
+	return nil
+}
+
+// 删除持有者，调用方需持有写锁
+func (f *fakeRados) removeLocker(object_name string, lock_name string, client string, cookie string) error {
+	pool, err := f.pool()
+	if err != nil {
+		return err
+	}
+	obj, ok := pool.objects[f.oid(object_name)]
+	if !ok {
+		return errors.New(fmt.Sprintf("%v", fakeENOENT))
+	}
+	lock, ok := obj.locks[lock_name]
+	if !ok {
+		return errors.New(fmt.Sprintf("%v", fakeENOENT))
+	}
+	lock.expire()
+	key := client + "/" + cookie
+	if _, ok := lock.lockers[key]; !ok {
+		return errors.New(fmt.Sprintf("%v", fakeENOENT))
+	}
+	delete(lock.lockers, key)
+	if len(lock.lockers) == 0 {
+		delete(obj.locks, lock_name)
+	}
+	return nil
+}
+
+func (f *fakeRados) Rados_unlock(object_name string, lock_name string, cookie string) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	if err := f.removeLocker(object_name, lock_name, f.client, cookie); err != nil {
+		return errors.New("cannot unlock object[" + object_name + "] lock[" + lock_name + "] " + err.Error())
+	}
+	return nil
+}
+
+func (f *fakeRados) Rados_list_locks(object_name string) (names []string, err error) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	obj, err := f.readObject(object_name)
+	if err != nil {
+		return nil, errors.New("cannot list locks on object[" + object_name + "] " + err.Error())
+	}
+	names = []string{}
+	for name, lock := range obj.locks {
+		lock.expire()
+		if len(lock.lockers) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (f *fakeRados) Rados_list_lockers(object_name string, lock_name string) (info LockInfo, err error) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	obj, err := f.readObject(object_name)
+	if err != nil {
+		return info, errors.New("cannot list lockers on object[" + object_name + "] lock[" + lock_name + "] " + err.Error())
+	}
+	info = LockInfo{Name: lock_name, Type: LOCK_SHARED, Lockers: []Locker{}}
+	lock, ok := obj.locks[lock_name]
+	if !ok {
+		return info, nil
+	}
+	lock.expire()
+	if lock.exclusive {
+		info.Type = LOCK_EXCLUSIVE
+	}
+	info.Tag = lock.tag
+	for _, locker := range lock.lockers {
+		info.Lockers = append(info.Lockers, locker.Locker)
+	}
+	sort.Slice(info.Lockers, func(i, j int) bool {
+		if info.Lockers[i].Client != info.Lockers[j].Client {
+			return info.Lockers[i].Client < info.Lockers[j].Client
+		}
+		return info.Lockers[i].Cookie < info.Lockers[j].Cookie
+	})
+	return info, nil
+}
+
+func (f *fakeRados) Rados_break_lock(object_name string, lock_name string, client string, cookie string) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	if err := f.removeLocker(object_name, lock_name, client, cookie); err != nil {
+		return errors.New("cannot break lock[" + lock_name + "] of " + client + " on object[" + object_name + "] " + err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package ceph
+
+import "testing"
+
+func newConnectedFake(t *testing.T) *fakeRados {
+	rados := NewFakeRados("ceph", "client.admin")
+	if err := rados.Rados_create2(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := rados.Rados_connect(); err != nil {
+		t.Fatal(err)
+	}
+	return rados
+}
+
+func TestNewFakeRados(t *testing.T) {
+	rados := newConnectedFake(t)
+	if err := rados.Rados_ioctx_create("missing"); err == nil {
+		t.Fatal("expected error opening a missing pool")
+	}
+	if err := rados.Rados_ioctx_create("data"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rados.Rados_write_full("obj", []byte("hello world")); err != nil {
+		t.Fatal(err)
+	}
+	if err := rados.Rados_write("obj", []byte("ceph!"), 6); err != nil {
+		t.Fatal(err)
+	}
+	out, err := rados.Rados_Read("obj", 64, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "hello ceph!" {
+		t.Fatalf("read %q", out.String())
+	}
+
+	if err := rados.Rados_setxattr("obj", "user.owner", []byte("panel")); err != nil {
+		t.Fatal(err)
+	}
+	value, err := rados.Rados_getxattr("obj", "user.owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "panel" {
+		t.Fatalf("xattr %v", value)
+	}
+	if _, err := rados.Rados_getxattr("obj", "user.missing"); err == nil {
+		t.Fatal("expected ENODATA for a missing attribute")
+	}
+	if err := rados.Rados_rmxattr("obj", "user.owner"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFakeRados_snapshot(t *testing.T) {
+	rados := newConnectedFake(t)
+	if err := rados.Rados_ioctx_create("data"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rados.Rados_write_full("obj", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := rados.Rados_ioctx_snap_create("snap1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rados.Rados_write_full("obj", []byte("v2")); err != nil {
+		t.Fatal(err)
+	}
+	snaps, err := rados.Rados_ioctx_snap_list()
+	if err != nil || len(snaps) != 1 {
+		t.Fatalf("snaps %v %v", snaps, err)
+	}
+
+	if snaps[0].Name != "snap1" || snaps[0].Stamp.IsZero() {
+		t.Fatalf("snap %+v", snaps[0])
+	}
+	if id, err := rados.Rados_ioctx_snap_lookup("snap1"); err != nil || id != snaps[0].Id {
+		t.Fatalf("lookup %v %v", id, err)
+	}
+	if err := rados.Rados_ioctx_snap_set_read(snaps[0].Id); err != nil {
+		t.Fatal(err)
+	}
+	out, _ := rados.Rados_Read("obj", 16, 0)
+	if out.String() != "v1" {
+		t.Fatalf("snapshot read %q", out.String())
+	}
+	if err := rados.Rados_ioctx_snap_set_read(SNAP_HEAD); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rados.Rados_ioctx_snap_rollback("snap1", "obj"); err != nil {
+		t.Fatal(err)
+	}
+	out, _ = rados.Rados_Read("obj", 16, 0)
+	if out.String() != "v1" {
+		t.Fatalf("rollback read %q", out.String())
+	}
+
+	// 克隆的句柄拥有独立的io上下文
+	clone := rados.Rados_clone()
+	if err := clone.Rados_ioctx_create("metadata"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rados.Rados_ioctx_snap_remove("snap1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := clone.Rados_ioctx_snap_remove("snap1"); err == nil {
+		t.Fatal("expected ENOENT removing a snapshot of another pool")
+	}
+}
+
+func TestFakeRados_command(t *testing.T) {
+	rados := newConnectedFake(t)
+	out, _, err := rados.Rados_mon_command(`{"prefix": "osd pool ls", "format": "json"}`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `["data","metadata","rbd"]` {
+		t.Fatalf("pool ls %s", out)
+	}
+	if _, _, err := rados.Rados_mon_command(`{"prefix": "no such command"}`, nil); err == nil {
+		t.Fatal("expected error for an unknown command")
+	}
+}
+
+func TestFakeRados_pool(t *testing.T) {
+	rados := newConnectedFake(t)
+	if err := rados.Rados_pool_create("images", PoolCreateOptions{PgNum: 64, Size: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rados.Rados_pool_create("images", PoolCreateOptions{}); err == nil {
+		t.Fatal("expected EEXIST creating a duplicate pool")
+	}
+	pools, err := rados.Rados_pool_list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pools) != 4 || pools[1].Name != "images" || pools[1].PgNum != 64 || pools[1].Size != 2 {
+		t.Fatalf("pools %+v", pools)
+	}
+
+	if err := rados.Rados_pool_set_quota("images", PoolQuota{MaxObjects: 1}); err != nil {
+		t.Fatal(err)
+	}
+	quota, err := rados.Rados_pool_get_quota("images")
+	if err != nil || quota.MaxObjects != 1 {
+		t.Fatalf("quota %+v %v", quota, err)
+	}
+	if err := rados.Rados_ioctx_create("images"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rados.Rados_write_full("a", []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := rados.Rados_write_full("b", []byte("b")); err == nil {
+		t.Fatal("expected EDQUOT once max_objects is reached")
+	}
+
+	if err := rados.Rados_pool_delete("images", "image"); err == nil {
+		t.Fatal("expected delete without confirmation to fail")
+	}
+	if err := rados.Rados_pool_delete("images", "images"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,871 @@
+package ceph
+
+// 模拟集群的rbd镜像
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+var _ LibRBD = (*fakeRados)(nil)
+
+type fakeImage struct {
+	id          string
+	size        uint64
+	order       int
+	features    uint64
+	stripeUnit  uint64
+	stripeCount uint64
+	dataPool    string
+	created     time.Time
+	metadata    map[string]string
+	parent      *fakeImageParent
+	snaps       []*fakeImageSnap
+	snapSeq     uint64
+	data        map[uint64][]byte // 已分配的对象，key为对象序号
+}
+
+// 以镜像id和快照id引用父镜像，父镜像改名后仍然有效
+type fakeImageParent struct {
+	pool    string
+	nspace  string
+	id      string
+	snap    uint64
+	overlap uint64 // 与父镜像重叠的范围，缩小镜像时减小
+}
+
+type fakeImageSnap struct {
+	id        uint64
+	name      string
+	size      uint64
+	protected bool
+	created   time.Time
+	data      map[uint64][]byte
+}
+
+func copyImageData(data map[uint64][]byte) map[uint64][]byte {
+	out := make(map[uint64][]byte, len(data))
+	for k, v := range data {
+		out[k] = append([]byte{}, v...)
+	}
+	return out
+}
+
+func (img *fakeImage) snap(snap_name string) *fakeImageSnap {
+	for _, snap := range img.snaps {
+		if snap.name == snap_name {
+			return snap
+		}
+	}
+	return nil
+}
+
+// 按id查找镜像，调用方需持有锁
+func (c *fakeCluster) imageById(pool_name string, nspace string, id string) (name string, img *fakeImage) {
+	pool, ok := c.pools[pool_name]
+	if !ok {
+		return "", nil
+	}
+	for key, img := range pool.images {
+		ns, name := splitOid(key)
+		if ns == nspace && img.id == id {
+			return name, img
+		}
+	}
+	return "", nil
+}
+
+// 镜像快照的所有克隆，调用方需持有锁
+func (c *fakeCluster) imageChildren(pool_name string, nspace string, id string, snap uint64) []RbdImageSpec {
+	children := []RbdImageSpec{}
+	for _, pool := range c.pools {
+		for key, img := range pool.images {
+			p := img.parent
+			if p == nil || p.pool != pool_name || p.nspace != nspace || p.id != id || p.snap != snap {
+				continue
+			}
+			ns, name := splitOid(key)
+			children = append(children, RbdImageSpec{Pool: pool.name, Namespace: ns, Image: name})
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		a, b := children[i], children[j]
+		if a.Pool != b.Pool {
+			return a.Pool < b.Pool
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Image < b.Image
+	})
+	return children
+}
+
+// 按名称查找镜像，调用方需持有锁
+func (f *fakeRados) image(image_name string) (*fakePool, *fakeImage, error) {
+	pool, err := f.pool()
+	if err != nil {
+		return nil, nil, err
+	}
+	img, ok := pool.images[f.oid(image_name)]
+	if !ok {
+		return pool, nil, errors.New(fmt.Sprintf("%v", fakeENOENT))
+	}
+	return pool, img, nil
+}
+
+func (f *fakeRados) Rbd_list() (names []string, err error) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	pool, err := f.pool()
+	if err != nil {
+		return nil, errors.New("cannot list rbd images " + err.Error())
+	}
+	names = []string{}
+	for key := range pool.images {
+		nspace, name := splitOid(key)
+		if nspace == f.nspace {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (f *fakeRados) Rbd_create(image_name string, size uint64, opts RbdCreateOptions) error {
+	opts, err := rbdCreateOptions(image_name, size, opts)
+	if err != nil {
+		return errors.New("cannot create rbd image[" + image_name + "] " + err.Error() + " " + fmt.Sprintf("%v", fakeEINVAL))
+	}
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	pool, err := f.pool()
+	if err != nil {
+		return errors.New("cannot create rbd image[" + image_name + "] " + err.Error())
+	}
+	if _, ok := pool.images[f.oid(image_name)]; ok {
+		return errors.New("cannot create rbd image[" + image_name + "] " + fmt.Sprintf("%v", fakeEEXIST))
+	}
+	if opts.DataPool != "" {
+		if _, ok := f.cluster.pools[opts.DataPool]; !ok {
+			return errors.New("cannot create rbd image[" + image_name + "] data pool not found " + fmt.Sprintf("%v", fakeENOENT))
+		}
+	}
+	f.cluster.imageSeq++
+	pool.images[f.oid(image_name)] = &fakeImage{
+		id:          fmt.Sprintf("%x", 0x1c2d3e4f5a00+f.cluster.imageSeq),
+		size:        size,
+		order:       opts.Order,
+		features:    opts.Features,
+		stripeUnit:  opts.StripeUnit,
+		stripeCount: opts.StripeCount,
+		dataPool:    opts.DataPool,
+		created:     time.Now(),
+		metadata:    map[string]string{},
+		data:        map[uint64][]byte{},
+	}
+	return nil
+}
+
+func (f *fakeRados) Rbd_remove(image_name string) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	pool, img, err := f.image(image_name)
+	if err != nil {
+		return errors.New("cannot remove rbd image[" + image_name + "] " + err.Error())
+	}
+	if len(img.snaps) > 0 {
+		return errors.New("cannot remove rbd image[" + image_name + "] with snapshots " + fmt.Sprintf("%v", fakeENOTEMPTY))
+	}
+	delete(pool.images, f.oid(image_name))
+	return nil
+}
+
+func (f *fakeRados) Rbd_rename(src_name string, dst_name string) error {
+	if err := checkImageName(dst_name); err != nil {
+		return errors.New("cannot rename rbd image[" + src_name + "] " + err.Error() + " " + fmt.Sprintf("%v", fakeEINVAL))
+	}
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	pool, img, err := f.image(src_name)
+	if err != nil {
+		return errors.New("cannot rename rbd image[" + src_name + "] " + err.Error())
+	}
+	if _, ok := pool.images[f.oid(dst_name)]; ok {
+		return errors.New("cannot rename rbd image[" + src_name + "] to " + dst_name + " " + fmt.Sprintf("%v", fakeEEXIST))
+	}
+	delete(pool.images, f.oid(src_name))
+	pool.images[f.oid(dst_name)] = img
+	return nil
+}
+
+func (f *fakeRados) Rbd_resize(image_name string, size uint64, allow_shrink bool) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	_, img, err := f.image(image_name)
+	if err != nil {
+		return errors.New("cannot resize rbd image[" + image_name + "] " + err.Error())
+	}
+	if size < img.size && !allow_shrink {
+		return errors.New("cannot shrink rbd image[" + image_name + "] without allow_shrink " + fmt.Sprintf("%v", fakeEINVAL))
+	}
+	if size < img.size {
+		img.shrink(size)
+	}
+	img.size = size
+	return nil
+}
+
+func (f *fakeRados) Rbd_stat(image_name string) (info RbdImageInfo, err error) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	_, img, err := f.image(image_name)
+	if err != nil {
+		return info, errors.New("cannot stat rbd image[" + image_name + "] " + err.Error())
+	}
+	objectSize := uint64(1) << uint(img.order)
+	info = RbdImageInfo{
+		Name:            image_name,
+		Id:              img.id,
+		Size:            img.size,
+		ObjectSize:      objectSize,
+		NumObjs:         (img.size + objectSize - 1) / objectSize,
+		Order:           img.order,
+		Features:        img.features,
+		FeatureNames:    RbdFeatureNames(img.features),
+		StripeUnit:      objectSize,
+		StripeCount:     1,
+		BlockNamePrefix: "rbd_data." + img.id,
+		CreateTime:      img.created,
+	}
+	if img.stripeUnit > 0 {
+		info.StripeUnit = img.stripeUnit
+		info.StripeCount = img.stripeCount
+	}
+	if p := img.parent; p != nil {
+		info.Parent = &RbdParent{Pool: p.pool, Namespace: p.nspace}
+		if name, parent := f.cluster.imageById(p.pool, p.nspace, p.id); parent != nil {
+			info.Parent.Image = name
+			for _, snap := range parent.snaps {
+				if snap.id == p.snap {
+					info.Parent.Snap = snap.name
+				}
+			}
+		}
+	}
+	return info, nil
+}
+
+func (f *fakeRados) Rbd_metadata_list(image_name string) (metadata []RbdMetadata, err error) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	_, img, err := f.image(image_name)
+	if err != nil {
+		return nil, errors.New("cannot list metadata of rbd image[" + image_name + "] " + err.Error())
+	}
+	metadata = []RbdMetadata{}
+	for key, value := range img.metadata {
+		metadata = append(metadata, RbdMetadata{Key: key, Value: value})
+	}
+	sort.Slice(metadata, func(i, j int) bool { return metadata[i].Key < metadata[j].Key })
+	return metadata, nil
+}
+
+func (f *fakeRados) Rbd_metadata_get(image_name string, key string) (value string, err error) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	_, img, err := f.image(image_name)
+	if err != nil {
+		return "", errors.New("cannot get metadata of rbd image[" + image_name + "] " + err.Error())
+	}
+	value, ok := img.metadata[key]
+	if !ok {
+		return "", errors.New("cannot get metadata[" + key + "] of rbd image[" + image_name + "] " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	return value, nil
+}
+
+func (f *fakeRados) Rbd_metadata_set(image_name string, key string, value string) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	_, img, err := f.image(image_name)
+	if err != nil {
+		return errors.New("cannot set metadata of rbd image[" + image_name + "] " + err.Error())
+	}
+	img.metadata[key] = value
+	return nil
+}
+
+func (f *fakeRados) Rbd_metadata_remove(image_name string, key string) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	_, img, err := f.image(image_name)
+	if err != nil {
+		return errors.New("cannot remove metadata of rbd image[" + image_name + "] " + err.Error())
+	}
+	if _, ok := img.metadata[key]; !ok {
+		return errors.New("cannot remove metadata[" + key + "] of rbd image[" + image_name + "] " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	delete(img.metadata, key)
+	return nil
+}
+
+func (f *fakeRados) Rbd_snap_list(image_name string) (snaps []RbdSnap, err error) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	_, img, err := f.image(image_name)
+	if err != nil {
+		return nil, errors.New("cannot list snapshots of rbd image[" + image_name + "] " + err.Error())
+	}
+	snaps = []RbdSnap{}
+	for _, snap := range img.snaps {
+		snaps = append(snaps, RbdSnap{
+			Id:        snap.id,
+			Name:      snap.name,
+			Size:      snap.size,
+			Protected: snap.protected,
+			Timestamp: snap.created,
+		})
+	}
+	return snaps, nil
+}
+
+func (f *fakeRados) Rbd_snap_create(image_name string, snap_name string) error {
+	if err := checkSnapName(snap_name); err != nil {
+		return errors.New("cannot create snapshot of rbd image[" + image_name + "] " + err.Error() + " " + fmt.Sprintf("%v", fakeEINVAL))
+	}
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	_, img, err := f.image(image_name)
+	if err != nil {
+		return errors.New("cannot create snapshot of rbd image[" + image_name + "] " + err.Error())
+	}
+	if img.snap(snap_name) != nil {
+		return errors.New("cannot create snapshot[" + snap_name + "] of rbd image[" + image_name + "] " + fmt.Sprintf("%v", fakeEEXIST))
+	}
+	img.snapSeq++
+	img.snaps = append(img.snaps, &fakeImageSnap{
+		id:      img.snapSeq,
+		name:    snap_name,
+		size:    img.size,
+		created: time.Now(),
+		data:    copyImageData(img.data),
+	})
+	return nil
+}
+
+func (f *fakeRados) Rbd_snap_remove(image_name string, snap_name string) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	_, img, err := f.image(image_name)
+	if err != nil {
+		return errors.New("cannot remove snapshot of rbd image[" + image_name + "] " + err.Error())
+	}
+	for i, snap := range img.snaps {
+		if snap.name != snap_name {
+			continue
+		}
+		if snap.protected {
+			return errors.New("cannot remove protected snapshot[" + snap_name + "] of rbd image[" + image_name + "] " + fmt.Sprintf("%v", fakeEBUSY))
+		}
+		img.snaps = append(img.snaps[:i], img.snaps[i+1:]...)
+		return nil
+	}
+	return errors.New("cannot remove snapshot[" + snap_name + "] of rbd image[" + image_name + "] " + fmt.Sprintf("%v", fakeENOENT))
+}
+
+func (f *fakeRados) Rbd_snap_rollback(image_name string, snap_name string) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	_, img, err := f.image(image_name)
+	if err != nil {
+		return errors.New("cannot rollback rbd image[" + image_name + "] " + err.Error())
+	}
+	snap := img.snap(snap_name)
+	if snap == nil {
+		return errors.New("cannot rollback rbd image[" + image_name + "] to snapshot[" + snap_name + "] " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	img.size = snap.size
+	img.data = copyImageData(snap.data)
+	return nil
+}
+
+func (f *fakeRados) protect(image_name string, snap_name string, protect bool) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	_, img, err := f.image(image_name)
+	if err != nil {
+		return err
+	}
+	snap := img.snap(snap_name)
+	if snap == nil {
+		return errors.New(fmt.Sprintf("%v", fakeENOENT))
+	}
+	if snap.protected == protect {
+		return errors.New(fmt.Sprintf("%v", fakeEINVAL))
+	}
+	if !protect && len(f.cluster.imageChildren(f.pool_name, f.nspace, img.id, snap.id)) > 0 {
+		return errors.New("snapshot has children " + fmt.Sprintf("%v", fakeEBUSY))
+	}
+	snap.protected = protect
+	return nil
+}
+
+func (f *fakeRados) Rbd_snap_protect(image_name string, snap_name string) error {
+	if err := f.protect(image_name, snap_name, true); err != nil {
+		return errors.New("cannot protect snapshot[" + snap_name + "] of rbd image[" + image_name + "] " + err.Error())
+	}
+	return nil
+}
+
+func (f *fakeRados) Rbd_snap_unprotect(image_name string, snap_name string) error {
+	if err := f.protect(image_name, snap_name, false); err != nil {
+		return errors.New("cannot unprotect snapshot[" + snap_name + "] of rbd image[" + image_name + "] " + err.Error())
+	}
+	return nil
+}
+
+func (f *fakeRados) Rbd_clone(image_name string, snap_name string, dst RbdImageSpec, opts RbdCreateOptions) error {
+	prefix := "cannot clone rbd image[" + image_name + "@" + snap_name + "] to " + dst.Pool + "/" + dst.Image + " "
+	order := opts.Order
+	opts, err := rbdCreateOptions(dst.Image, 0, opts)
+	if err != nil {
+		return errors.New(prefix + err.Error() + " " + fmt.Sprintf("%v", fakeEINVAL))
+	}
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	_, img, err := f.image(image_name)
+	if err != nil {
+		return errors.New(prefix + err.Error())
+	}
+	snap := img.snap(snap_name)
+	if snap == nil {
+		return errors.New(prefix + "snapshot not found " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	if img.features&RBD_FEATURE_LAYERING == 0 || opts.Features&RBD_FEATURE_LAYERING == 0 {
+		return errors.New(prefix + "layering is not enabled " + fmt.Sprintf("%v", fakeEINVAL))
+	}
+	if !snap.protected {
+		return errors.New(prefix + "snapshot is not protected " + fmt.Sprintf("%v", fakeEINVAL))
+	}
+	pool, ok := f.cluster.pools[dst.Pool]
+	if !ok {
+		return errors.New(prefix + "pool not found " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	key := dst.Image
+	if dst.Namespace != "" {
+		key = dst.Namespace + "\x00" + dst.Image
+	}
+	if _, ok := pool.images[key]; ok {
+		return errors.New(prefix + fmt.Sprintf("%v", fakeEEXIST))
+	}
+	if order == 0 {
+		opts.Order = img.order
+	}
+	f.cluster.imageSeq++
+	pool.images[key] = &fakeImage{
+		id:          fmt.Sprintf("%x", 0x1c2d3e4f5a00+f.cluster.imageSeq),
+		size:        snap.size,
+		order:       opts.Order,
+		features:    opts.Features,
+		stripeUnit:  opts.StripeUnit,
+		stripeCount: opts.StripeCount,
+		dataPool:    opts.DataPool,
+		created:     time.Now(),
+		metadata:    map[string]string{},
+		parent:      &fakeImageParent{pool: f.pool_name, nspace: f.nspace, id: img.id, snap: snap.id, overlap: snap.size},
+		data:        map[uint64][]byte{},
+	}
+	return nil
+}
+
+func (f *fakeRados) Rbd_list_children(image_name string, snap_name string) (children []RbdImageSpec, err error) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	_, img, err := f.image(image_name)
+	if err != nil {
+		return nil, errors.New("cannot list children of rbd image[" + image_name + "] " + err.Error())
+	}
+	snap := img.snap(snap_name)
+	if snap == nil {
+		return nil, errors.New("cannot list children of rbd image[" + image_name + "@" + snap_name + "] " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	return f.cluster.imageChildren(f.pool_name, f.nspace, img.id, snap.id), nil
+}
+
+func (f *fakeRados) Rbd_flatten(image_name string) error {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	_, img, err := f.image(image_name)
+	if err != nil {
+		return errors.New("cannot flatten rbd image[" + image_name + "] " + err.Error())
+	}
+	if img.parent == nil {
+		return errors.New("cannot flatten rbd image[" + image_name + "] without parent " + fmt.Sprintf("%v", fakeEINVAL))
+	}
+	// 复制重叠范围内尚未分配的对象
+	head := fakeImageView{img: img, data: img.data, size: img.size}
+	objectSize := img.objectSize()
+	for objNo := uint64(0); objNo*objectSize < img.parent.overlap; objNo++ {
+		if _, ok := img.data[objNo]; !ok {
+			obj := make([]byte, objectSize)
+			f.cluster.readImage(head, objNo*objectSize, obj[:head.objectLen(objNo)])
+			img.data[objNo] = obj
+		}
+	}
+	img.parent = nil
+	return nil
+}
+
+func (img *fakeImage) objectSize() uint64 {
+	return uint64(1) << uint(img.order)
+}
+
+func (img *fakeImage) snapById(id uint64) *fakeImageSnap {
+	for _, snap := range img.snaps {
+		if snap.id == id {
+			return snap
+		}
+	}
+	return nil
+}
+
+// 缩小镜像，释放超出的对象并清零最后一个对象的尾部
+func (img *fakeImage) shrink(size uint64) {
+	objectSize := img.objectSize()
+	for objNo, obj := range img.data {
+		start := objNo * objectSize
+		if start >= size {
+			delete(img.data, objNo)
+		} else if start+objectSize > size {
+			for i := size - start; i < objectSize; i++ {
+				obj[i] = 0
+			}
+		}
+	}
+	if img.parent != nil && img.parent.overlap > size {
+		img.parent.overlap = size
+	}
+}
+
+// 镜像的最新数据或某个快照
+type fakeImageView struct {
+	img  *fakeImage
+	data map[uint64][]byte
+	size uint64
+}
+
+// 对象在镜像范围内的长度
+func (v fakeImageView) objectLen(objNo uint64) uint64 {
+	objectSize := v.img.objectSize()
+	start := objNo * objectSize
+	if start >= v.size {
+		return 0
+	}
+	if v.size-start < objectSize {
+		return v.size - start
+	}
+	return objectSize
+}
+
+// 父镜像快照，调用方需持有锁
+func (c *fakeCluster) parentView(img *fakeImage) (fakeImageView, uint64, bool) {
+	p := img.parent
+	if p == nil {
+		return fakeImageView{}, 0, false
+	}
+	_, parent := c.imageById(p.pool, p.nspace, p.id)
+	if parent == nil {
+		return fakeImageView{}, 0, false
+	}
+	snap := parent.snapById(p.snap)
+	if snap == nil {
+		return fakeImageView{}, 0, false
+	}
+	return fakeImageView{img: parent, data: snap.data, size: snap.size}, p.overlap, true
+}
+
+// 读取到p，未分配的区域在重叠范围内从父镜像读取，否则为0，调用方需持有锁
+func (c *fakeCluster) readImage(v fakeImageView, offset uint64, p []byte) {
+	objectSize := v.img.objectSize()
+	end := offset + uint64(len(p))
+	for pos := offset; pos < end; {
+		objNo, objOff := pos/objectSize, pos%objectSize
+		n := objectSize - objOff
+		if n > end-pos {
+			n = end - pos
+		}
+		out := p[pos-offset : pos-offset+n]
+		if obj, ok := v.data[objNo]; ok {
+			copy(out, obj[objOff:objOff+n])
+		} else if parent, overlap, ok := c.parentView(v.img); ok && pos < overlap {
+			m := n
+			if m > overlap-pos {
+				m = overlap - pos
+			}
+			c.readImage(parent, pos, out[:m])
+			for i := m; i < n; i++ {
+				out[i] = 0
+			}
+		} else {
+			for i := range out {
+				out[i] = 0
+			}
+		}
+		pos += n
+	}
+}
+
+func isZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// 打开的模拟镜像，以id定位，镜像改名后仍然有效
+type fakeRbdImage struct {
+	f        *fakeRados
+	name     string
+	pool     string
+	nspace   string
+	id       string
+	snap     uint64 // 0表示最新数据
+	readOnly bool
+}
+
+func (f *fakeRados) Rbd_open(image_name string, snap_name string, read_only bool) (RbdImage, error) {
+	f.cluster.lock.RLock()
+	defer f.cluster.lock.RUnlock()
+	_, img, err := f.image(image_name)
+	if err != nil {
+		return nil, errors.New("cannot open rbd image[" + image_name + "] " + err.Error())
+	}
+	image := &fakeRbdImage{
+		f:        f,
+		name:     image_name,
+		pool:     f.pool_name,
+		nspace:   f.nspace,
+		id:       img.id,
+		readOnly: read_only || snap_name != "",
+	}
+	if snap_name != "" {
+		snap := img.snap(snap_name)
+		if snap == nil {
+			return nil, errors.New("cannot open rbd image[" + image_name + "@" + snap_name + "] " + fmt.Sprintf("%v", fakeENOENT))
+		}
+		image.snap = snap.id
+	}
+	return image, nil
+}
+
+// 调用方需持有锁
+func (i *fakeRbdImage) view() (fakeImageView, error) {
+	_, img := i.f.cluster.imageById(i.pool, i.nspace, i.id)
+	if img == nil {
+		return fakeImageView{}, errors.New("rbd image[" + i.name + "] not found " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	if i.snap == 0 {
+		return fakeImageView{img: img, data: img.data, size: img.size}, nil
+	}
+	snap := img.snapById(i.snap)
+	if snap == nil {
+		return fakeImageView{}, errors.New("snapshot of rbd image[" + i.name + "] not found " + fmt.Sprintf("%v", fakeENOENT))
+	}
+	return fakeImageView{img: img, data: snap.data, size: snap.size}, nil
+}
+
+// 可写的最新数据，调用方需持有写锁
+func (i *fakeRbdImage) head(offset uint64, length uint64) (fakeImageView, error) {
+	if i.readOnly {
+		return fakeImageView{}, errors.New("rbd image[" + i.name + "] is read only " + fmt.Sprintf("%v", fakeEROFS))
+	}
+	v, err := i.view()
+	if err != nil {
+		return v, err
+	}
+	if offset+length > v.size {
+		return v, errors.New("write beyond the end of rbd image[" + i.name + "] " + fmt.Sprintf("%v", fakeEINVAL))
+	}
+	return v, nil
+}
+
+// 对象不存在时从父镜像复制，调用方需持有写锁
+func (i *fakeRbdImage) copyup(v fakeImageView, objNo uint64) []byte {
+	obj, ok := v.data[objNo]
+	if !ok {
+		obj = make([]byte, v.img.objectSize())
+		i.f.cluster.readImage(v, objNo*v.img.objectSize(), obj[:v.objectLen(objNo)])
+		v.data[objNo] = obj
+	}
+	return obj
+}
+
+func (i *fakeRbdImage) Size() (uint64, error) {
+	i.f.cluster.lock.RLock()
+	defer i.f.cluster.lock.RUnlock()
+	v, err := i.view()
+	if err != nil {
+		return 0, err
+	}
+	return v.size, nil
+}
+
+func (i *fakeRbdImage) ReadAt(p []byte, off int64) (int, error) {
+	i.f.cluster.lock.RLock()
+	defer i.f.cluster.lock.RUnlock()
+	v, err := i.view()
+	if err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, errors.New("negative offset " + fmt.Sprintf("%v", fakeEINVAL))
+	}
+	if uint64(off) >= v.size {
+		return 0, io.EOF
+	}
+	n := uint64(len(p))
+	if n > v.size-uint64(off) {
+		n = v.size - uint64(off)
+	}
+	i.f.cluster.readImage(v, uint64(off), p[:n])
+	if n < uint64(len(p)) {
+		return int(n), io.EOF
+	}
+	return int(n), nil
+}
+
+func (i *fakeRbdImage) WriteAt(p []byte, off int64) (int, error) {
+	i.f.cluster.lock.Lock()
+	defer i.f.cluster.lock.Unlock()
+	if off < 0 {
+		return 0, errors.New("negative offset " + fmt.Sprintf("%v", fakeEINVAL))
+	}
+	v, err := i.head(uint64(off), uint64(len(p)))
+	if err != nil {
+		return 0, errors.New("cannot write rbd image[" + i.name + "] " + err.Error())
+	}
+	objectSize := v.img.objectSize()
+	for pos := uint64(0); pos < uint64(len(p)); {
+		abs := uint64(off) + pos
+		objNo, objOff := abs/objectSize, abs%objectSize
+		obj := i.copyup(v, objNo)
+		pos += uint64(copy(obj[objOff:], p[pos:]))
+	}
+	return len(p), nil
+}
+
+// 整个对象被清零时释放对象，有父镜像时保留全0对象以屏蔽父镜像的数据
+func (i *fakeRbdImage) Discard(offset uint64, length uint64) error {
+	i.f.cluster.lock.Lock()
+	defer i.f.cluster.lock.Unlock()
+	v, err := i.head(offset, length)
+	if err != nil {
+		return errors.New("cannot discard rbd image[" + i.name + "] " + err.Error())
+	}
+	objectSize := v.img.objectSize()
+	_, overlap, hasParent := i.f.cluster.parentView(v.img)
+	end := offset + length
+	for pos := offset; pos < end; {
+		objNo, objOff := pos/objectSize, pos%objectSize
+		n := objectSize - objOff
+		if n > end-pos {
+			n = end - pos
+		}
+		if objOff == 0 && n == v.objectLen(objNo) && !(hasParent && pos < overlap) {
+			delete(v.data, objNo)
+		} else {
+			obj := i.copyup(v, objNo)
+			for j := objOff; j < objOff+n; j++ {
+				obj[j] = 0
+			}
+		}
+		pos += n
+	}
+	return nil
+}
+
+func (i *fakeRbdImage) Resize(size uint64) error {
+	i.f.cluster.lock.Lock()
+	defer i.f.cluster.lock.Unlock()
+	if i.readOnly {
+		return errors.New("cannot resize read only rbd image[" + i.name + "] " + fmt.Sprintf("%v", fakeEROFS))
+	}
+	v, err := i.view()
+	if err != nil {
+		return errors.New("cannot resize rbd image[" + i.name + "] " + err.Error())
+	}
+	if size < v.img.size {
+		v.img.shrink(size)
+	}
+	v.img.size = size
+	return nil
+}
+
+// 按对象比较内容，from_snap为空时返回非0的对象
+func (i *fakeRbdImage) DiffIterate(from_snap string, offset uint64, length uint64, cb func(offset uint64, length uint64, exists bool) error) error {
+	i.f.cluster.lock.RLock()
+	v, err := i.view()
+	if err != nil {
+		i.f.cluster.lock.RUnlock()
+		return errors.New("cannot diff rbd image[" + i.name + "] " + err.Error())
+	}
+	from := fakeImageView{img: v.img, data: map[uint64][]byte{}}
+	if from_snap != "" {
+		snap := v.img.snap(from_snap)
+		if snap == nil {
+			i.f.cluster.lock.RUnlock()
+			return errors.New("cannot diff rbd image[" + i.name + "] from snapshot[" + from_snap + "] " + fmt.Sprintf("%v", fakeENOENT))
+		}
+		from = fakeImageView{img: v.img, data: snap.data, size: snap.size}
+	}
+	type extent struct {
+		offset uint64
+		length uint64
+		exists bool
+	}
+	extents := []extent{}
+	objectSize := v.img.objectSize()
+	end := offset + length
+	if end > v.size {
+		end = v.size
+	}
+	for pos := offset; pos < end; {
+		n := objectSize - pos%objectSize
+		if n > end-pos {
+			n = end - pos
+		}
+		cur := make([]byte, n)
+		i.f.cluster.readImage(v, pos, cur)
+		old := make([]byte, n)
+		if pos < from.size {
+			m := n
+			if m > from.size-pos {
+				m = from.size - pos
+			}
+			i.f.cluster.readImage(from, pos, old[:m])
+		}
+		if !bytes.Equal(cur, old) {
+			extents = append(extents, extent{pos, n, !isZero(cur)})
+		}
+		pos += n
+	}
+	// 回调时不持有锁，回调中可以读取镜像
+	i.f.cluster.lock.RUnlock()
+	for _, e := range extents {
+		if err := cb(e.offset, e.length, e.exists); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *fakeRbdImage) Close() error {
+	return nil
+}
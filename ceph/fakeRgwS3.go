@@ -0,0 +1,373 @@
+package ceph
+
+// 模拟对象存储网关的S3接口
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type fakeRgwUpload struct {
+	id          string
+	bucket      string
+	key         string
+	contentType string
+	meta        map[string]string
+	initiated   time.Time
+	parts       map[int]*fakeRgwObject
+}
+
+type fakeS3ErrorResult struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string   `xml:"Code"`
+	Resource string   `xml:"Resource"`
+}
+
+func fakeS3Error(w http.ResponseWriter, r *http.Request, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		xml.NewEncoder(w).Encode(fakeS3ErrorResult{Code: code, Resource: r.URL.Path})
+	}
+}
+
+func fakeS3Reply(w http.ResponseWriter, result interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(result)
+}
+
+// 请求中的x-amz-meta-*头
+func fakeS3Meta(header http.Header) map[string]string {
+	meta := map[string]string{}
+	for name := range header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-meta-") {
+			meta[strings.TrimPrefix(lower, "x-amz-meta-")] = header.Get(name)
+		}
+	}
+	return meta
+}
+
+func (gw *fakeRadosGW) serveS3(w http.ResponseWriter, r *http.Request, caller *fakeRgwUser, body []byte) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	name := parts[0]
+	if name == "" {
+		if r.Method != http.MethodGet {
+			fakeS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed")
+			return
+		}
+		gw.s3ListBuckets(w, caller)
+		return
+	}
+	b, ok := gw.buckets[name]
+	if !ok {
+		fakeS3Error(w, r, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	if b.owner != caller.UserId && !caller.system {
+		fakeS3Error(w, r, http.StatusForbidden, "AccessDenied")
+		return
+	}
+	query := r.URL.Query()
+	if len(parts) == 1 || parts[1] == "" {
+		_, uploads := query["uploads"]
+		switch {
+		case r.Method == http.MethodGet && uploads:
+			gw.s3ListUploads(w, b)
+		case r.Method == http.MethodGet:
+			gw.s3ListObjects(w, r, b, query)
+		default:
+			fakeS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed")
+		}
+		return
+	}
+	key := parts[1]
+	_, uploads := query["uploads"]
+	upload_id := query.Get("uploadId")
+	switch {
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		gw.s3GetObject(w, r, b, key)
+	case r.Method == http.MethodPut && upload_id != "":
+		gw.s3UploadPart(w, r, b, key, upload_id, body)
+	case r.Method == http.MethodPut:
+		obj := newFakeRgwObject(body, r.Header.Get("Content-Type"))
+		obj.meta = fakeS3Meta(r.Header)
+		if code := gw.putObject(b, key, obj); code != "" {
+			fakeS3Error(w, r, http.StatusForbidden, code)
+			return
+		}
+		gw.record(b.owner, b.name, "put_obj", 0, uint64(len(body)))
+		w.Header().Set("ETag", "\""+obj.etag+"\"")
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPost && uploads:
+		gw.nextId++
+		upload := &fakeRgwUpload{
+			id:          fmt.Sprintf("2~fake%d", gw.nextId),
+			bucket:      b.name,
+			key:         key,
+			contentType: r.Header.Get("Content-Type"),
+			meta:        fakeS3Meta(r.Header),
+			initiated:   time.Now(),
+			parts:       map[int]*fakeRgwObject{},
+		}
+		gw.uploads[upload.id] = upload
+		fakeS3Reply(w, s3InitiateMultipartUploadResult{Bucket: b.name, Key: key, UploadId: upload.id})
+	case r.Method == http.MethodPost && upload_id != "":
+		gw.s3CompleteUpload(w, r, b, key, upload_id, body)
+	case r.Method == http.MethodDelete && upload_id != "":
+		if _, ok := gw.upload(b, key, upload_id); !ok {
+			fakeS3Error(w, r, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		delete(gw.uploads, upload_id)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete:
+		// 对象不存在时同样返回成功
+		delete(b.objects, key)
+		gw.record(b.owner, b.name, "delete_obj", 0, 0)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		fakeS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (gw *fakeRadosGW) s3ListBuckets(w http.ResponseWriter, caller *fakeRgwUser) {
+	result := s3ListAllMyBucketsResult{Owner: caller.UserId}
+	for _, b := range gw.buckets {
+		if b.owner == caller.UserId {
+			result.Buckets = append(result.Buckets, S3Bucket{Name: b.name, CreationDate: b.mtime.UTC()})
+		}
+	}
+	sort.Slice(result.Buckets, func(i, j int) bool { return result.Buckets[i].Name < result.Buckets[j].Name })
+	gw.record(caller.UserId, "", "list_buckets", 0, 0)
+	fakeS3Reply(w, result)
+}
+
+// ListObjectsV2，continuation token为上一页最后一个对象或公共前缀
+func (gw *fakeRadosGW) s3ListObjects(w http.ResponseWriter, r *http.Request, b *fakeRgwBucket, query url.Values) {
+	list := S3ObjectList{
+		Name:              b.name,
+		Prefix:            query.Get("prefix"),
+		Delimiter:         query.Get("delimiter"),
+		MaxKeys:           S3_MAX_KEYS,
+		ContinuationToken: query.Get("continuation-token"),
+	}
+	if max := query.Get("max-keys"); max != "" {
+		n, err := strconv.Atoi(max)
+		if err != nil || n < 0 {
+			fakeS3Error(w, r, http.StatusBadRequest, "InvalidArgument")
+			return
+		}
+		if n < list.MaxKeys {
+			list.MaxKeys = n
+		}
+	}
+	after := ""
+	if list.ContinuationToken != "" {
+		data, err := base64.StdEncoding.DecodeString(list.ContinuationToken)
+		if err != nil {
+			fakeS3Error(w, r, http.StatusBadRequest, "InvalidArgument")
+			return
+		}
+		after = string(data)
+	}
+	keys := []string{}
+	for key := range b.objects {
+		if strings.HasPrefix(key, list.Prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	last := ""
+	for _, key := range keys {
+		if key <= after || (list.Delimiter != "" && strings.HasSuffix(after, list.Delimiter) && strings.HasPrefix(key, after)) {
+			continue
+		}
+		item := key
+		if list.Delimiter != "" {
+			if i := strings.Index(key[len(list.Prefix):], list.Delimiter); i >= 0 {
+				item = key[:len(list.Prefix)+i+len(list.Delimiter)]
+			}
+		}
+		if item == last {
+			continue
+		}
+		if list.KeyCount == list.MaxKeys {
+			list.IsTruncated = true
+			list.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(last))
+			break
+		}
+		if item == key {
+			obj := b.objects[key]
+			list.Contents = append(list.Contents, S3Object{
+				Key:          key,
+				LastModified: obj.mtime.UTC(),
+				ETag:         "\"" + obj.etag + "\"",
+				Size:         int64(len(obj.data)),
+				StorageClass: "STANDARD",
+			})
+		} else {
+			list.CommonPrefixes = append(list.CommonPrefixes, S3Prefix{Prefix: item})
+		}
+		last = item
+		list.KeyCount++
+	}
+	gw.record(b.owner, b.name, "list_bucket", 0, 0)
+	fakeS3Reply(w, list)
+}
+
+func (gw *fakeRadosGW) s3ListUploads(w http.ResponseWriter, b *fakeRgwBucket) {
+	result := s3ListMultipartUploadsResult{Bucket: b.name}
+	for _, upload := range gw.uploads {
+		if upload.bucket == b.name {
+			result.Uploads = append(result.Uploads, S3Upload{Key: upload.key, UploadId: upload.id, Initiated: upload.initiated.UTC()})
+		}
+	}
+	sort.Slice(result.Uploads, func(i, j int) bool {
+		if result.Uploads[i].Key != result.Uploads[j].Key {
+			return result.Uploads[i].Key < result.Uploads[j].Key
+		}
+		return result.Uploads[i].Initiated.Before(result.Uploads[j].Initiated)
+	})
+	fakeS3Reply(w, result)
+}
+
+// 解析Range头，只支持单个范围
+func fakeS3Range(header string, size int64) (start int64, end int64, ok bool) {
+	spec := strings.TrimPrefix(header, "bytes=")
+	parts := strings.SplitN(spec, "-", 2)
+	if spec == header || len(parts) != 2 || parts[0] == "" {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end = size - 1
+	if parts[1] != "" {
+		end, err = strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, true
+}
+
+func (gw *fakeRadosGW) s3GetObject(w http.ResponseWriter, r *http.Request, b *fakeRgwBucket, key string) {
+	obj, ok := b.objects[key]
+	if !ok {
+		fakeS3Error(w, r, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+	data := obj.data
+	status := http.StatusOK
+	if spec := r.Header.Get("Range"); spec != "" {
+		start, end, ok := fakeS3Range(spec, int64(len(data)))
+		if !ok {
+			fakeS3Error(w, r, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		data = data[start : end+1]
+		status = http.StatusPartialContent
+	}
+	w.Header().Set("Content-Type", obj.contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("ETag", "\""+obj.etag+"\"")
+	w.Header().Set("Last-Modified", obj.mtime.UTC().Format(http.TimeFormat))
+	for name, value := range obj.meta {
+		w.Header().Set("X-Amz-Meta-"+name, value)
+	}
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		w.Write(data)
+		gw.record(b.owner, b.name, "get_obj", uint64(len(data)), 0)
+	}
+}
+
+func (gw *fakeRadosGW) upload(b *fakeRgwBucket, key string, upload_id string) (*fakeRgwUpload, bool) {
+	upload, ok := gw.uploads[upload_id]
+	if !ok || upload.bucket != b.name || upload.key != key {
+		return nil, false
+	}
+	return upload, true
+}
+
+func (gw *fakeRadosGW) s3UploadPart(w http.ResponseWriter, r *http.Request, b *fakeRgwBucket, key string, upload_id string, body []byte) {
+	upload, ok := gw.upload(b, key, upload_id)
+	if !ok {
+		fakeS3Error(w, r, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+	number, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || number < 1 || number > S3_MAX_PARTS {
+		fakeS3Error(w, r, http.StatusBadRequest, "InvalidArgument")
+		return
+	}
+	part := newFakeRgwObject(body, "")
+	upload.parts[number] = part
+	gw.record(b.owner, b.name, "put_obj", 0, uint64(len(body)))
+	w.Header().Set("ETag", "\""+part.etag+"\"")
+	w.WriteHeader(http.StatusOK)
+}
+
+// 合并分块，ETag为各分块md5拼接后的md5加分块数
+func (gw *fakeRadosGW) s3CompleteUpload(w http.ResponseWriter, r *http.Request, b *fakeRgwBucket, key string, upload_id string, body []byte) {
+	upload, ok := gw.upload(b, key, upload_id)
+	if !ok {
+		fakeS3Error(w, r, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+	complete := s3CompleteMultipartUpload{}
+	if err := xml.Unmarshal(body, &complete); err != nil || len(complete.Parts) == 0 {
+		fakeS3Error(w, r, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+	var data bytes.Buffer
+	sums := []byte{}
+	for i, p := range complete.Parts {
+		if i > 0 && p.PartNumber <= complete.Parts[i-1].PartNumber {
+			fakeS3Error(w, r, http.StatusBadRequest, "InvalidPartOrder")
+			return
+		}
+	}
+	for i, p := range complete.Parts {
+		part, ok := upload.parts[p.PartNumber]
+		if !ok || part.etag != s3ETag(p.ETag) {
+			fakeS3Error(w, r, http.StatusBadRequest, "InvalidPart")
+			return
+		}
+		if i < len(complete.Parts)-1 && len(part.data) < gw.MinPartSize {
+			fakeS3Error(w, r, http.StatusBadRequest, "EntityTooSmall")
+			return
+		}
+		data.Write(part.data)
+		sum, _ := hex.DecodeString(part.etag)
+		sums = append(sums, sum...)
+	}
+	obj := newFakeRgwObject(data.Bytes(), upload.contentType)
+	sum := md5.Sum(sums)
+	obj.etag = hex.EncodeToString(sum[:]) + "-" + strconv.Itoa(len(complete.Parts))
+	obj.meta = upload.meta
+	if code := gw.putObject(b, key, obj); code != "" {
+		fakeS3Error(w, r, http.StatusForbidden, code)
+		return
+	}
+	delete(gw.uploads, upload_id)
+	gw.record(b.owner, b.name, "complete_multipart", 0, 0)
+	fakeS3Reply(w, s3CompleteMultipartUploadResult{Bucket: b.name, Key: key, ETag: "\"" + obj.etag + "\""})
+}
@@ -0,0 +1,688 @@
+package ceph
+
+// 模拟mgr volumes模块的子卷命令，子卷保存在文件系统的/volumes/<组>/<子卷>/<uuid>下
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	fakeCommands["fs subvolumegroup ls"] = fakeSubvolumeGroupLs
+	fakeCommands["fs subvolumegroup create"] = fakeSubvolumeGroupCreate
+	fakeCommands["fs subvolumegroup rm"] = fakeSubvolumeGroupRm
+	fakeCommands["fs subvolumegroup resize"] = fakeSubvolumeGroupResize
+	fakeCommands["fs subvolumegroup getpath"] = fakeSubvolumeGroupGetpath
+	fakeCommands["fs subvolumegroup info"] = fakeSubvolumeGroupInfo
+	fakeCommands["fs subvolume ls"] = fakeSubvolumeLs
+	fakeCommands["fs subvolume create"] = fakeSubvolumeCreate
+	fakeCommands["fs subvolume rm"] = fakeSubvolumeRm
+	fakeCommands["fs subvolume resize"] = fakeSubvolumeResize
+	fakeCommands["fs subvolume getpath"] = fakeSubvolumeGetpath
+	fakeCommands["fs subvolume info"] = fakeSubvolumeInfo
+	fakeCommands["fs subvolume snapshot ls"] = fakeSubvolumeSnapshotLs
+	fakeCommands["fs subvolume snapshot create"] = fakeSubvolumeSnapshotCreate
+	fakeCommands["fs subvolume snapshot rm"] = fakeSubvolumeSnapshotRm
+	fakeCommands["fs subvolume snapshot info"] = fakeSubvolumeSnapshotInfo
+	fakeCommands["fs subvolume snapshot clone"] = fakeSubvolumeSnapshotClone
+	fakeCommands["fs clone status"] = fakeCloneStatus
+}
+
+const fakeVolumesDir = "/volumes"
+
+type fakeSubvolume struct {
+	uuid    string
+	created time.Time
+	clone   *FsCloneSource // 由快照克隆时的来源
+}
+
+func fakeArgBool(args map[string]interface{}, key string) bool {
+	value, _ := args[key].(bool)
+	return value
+}
+
+func fakeTimestamp(t time.Time) string {
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// 以下函数调用方需持有写锁
+
+func fakeVolume(f *fakeRados, args map[string]interface{}) (*fakeFs, string, int) {
+	name := fakeArgString(args, "vol_name")
+	fs, ok := f.cluster.filesystems[name]
+	if !ok {
+		return nil, "volume '" + name + "' does not exist", fakeENOENT
+	}
+	if fs.subvolumes == nil {
+		fs.subvolumes = map[string]*fakeSubvolume{}
+	}
+	return fs, "", 0
+}
+
+// 子卷组目录，不存在时为nil
+func (fs *fakeFs) subvolumeGroup(group string) *fakeInode {
+	_, _, inode, ret := fs.lookup(path.Join(fakeVolumesDir, group))
+	if ret < 0 || inode == nil || !inode.isDir() {
+		return nil
+	}
+	return inode
+}
+
+// 创建目录及上级目录，返回最后一级
+func (fs *fakeFs) mkdirAll(full string, mode uint32) *fakeInode {
+	dir := fs.root
+	for _, part := range strings.Split(full[1:], "/") {
+		child, ok := dir.children[part]
+		if !ok {
+			child = fs.newInode(CEPHFS_S_IFDIR | mode)
+			fs.link(dir, part, child)
+		}
+		dir = child
+	}
+	return dir
+}
+
+// 可写的副本，使用新的inode编号，用于克隆
+func (fs *fakeFs) copyTree(src *fakeInode, parent *fakeInode) *fakeInode {
+	c := fs.newInode(src.mode)
+	c.uid, c.gid = src.uid, src.gid
+	c.parent = parent
+	c.data = append([]byte(nil), src.data...)
+	if src.layout != nil && !src.isDir() {
+		layout := *src.layout
+		c.layout = &layout
+	}
+	for name, child := range src.children {
+		c.children[name] = fs.copyTree(child, c)
+	}
+	return c
+}
+
+func fakeParseMode(args map[string]interface{}) (uint32, string, int) {
+	mode := fakeArgString(args, "mode")
+	if mode == "" {
+		return CEPHFS_DEFAULT_DIR_MODE, "", 0
+	}
+	n, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || n > 07777 {
+		return 0, "invalid mode '" + mode + "'", fakeEINVAL
+	}
+	return uint32(n), "", 0
+}
+
+// pool_layout需为文件系统的数据存储池
+func (fs *fakeFs) checkPoolLayout(pool string) (string, int) {
+	if pool == "" {
+		return "", 0
+	}
+	for _, name := range fs.dataPools {
+		if name == pool {
+			return "", 0
+		}
+	}
+	return "invalid pool layout '" + pool + "'", fakeEINVAL
+}
+
+// 设置目录的布局，目录需已在文件系统中以继承上级的布局
+func setPoolLayout(dir *fakeInode, pool string, namespace string) {
+	if pool == "" && namespace == "" {
+		return
+	}
+	layout := dir.effectiveLayout()
+	if pool != "" {
+		layout.Pool = pool
+	}
+	layout.PoolNamespace = namespace
+	dir.layout = &layout
+}
+
+// resize的new_size，infinite为取消限制
+func fakeParseNewSize(args map[string]interface{}) (uint64, string, int) {
+	size := fakeArgString(args, "new_size")
+	if size == "infinite" {
+		return 0, "", 0
+	}
+	n, err := strconv.ParseUint(size, 10, 64)
+	if err != nil || n == 0 {
+		return 0, "invalid size '" + size + "'", fakeEINVAL
+	}
+	return n, "", 0
+}
+
+func fakeQuotaUsage(dir *fakeInode) map[string]interface{} {
+	usage := map[string]interface{}{
+		"bytes_used":  dir.rbytes(),
+		"bytes_quota": "infinite",
+		"bytes_pcent": "undefined",
+	}
+	if dir.maxBytes > 0 {
+		usage["bytes_quota"] = dir.maxBytes
+		usage["bytes_pcent"] = fmt.Sprintf("%.2f", float64(dir.rbytes())*100/float64(dir.maxBytes))
+	}
+	return usage
+}
+
+func fakeResize(dir *fakeInode, args map[string]interface{}) ([]byte, string, int) {
+	size, outs, ret := fakeParseNewSize(args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	if fakeArgBool(args, "no_shrink") && size > 0 && size < dir.rbytes() {
+		return nil, fmt.Sprintf("Can't resize the subvolume. The new size '%d' would be lesser than the current used size '%d'", size, dir.rbytes()), fakeEINVAL
+	}
+	dir.maxBytes = size
+	usage := fakeQuotaUsage(dir)
+	return fakeJson([]map[string]interface{}{
+		{"bytes_used": usage["bytes_used"]},
+		{"bytes_quota": usage["bytes_quota"]},
+		{"bytes_pcent": usage["bytes_pcent"]},
+	})
+}
+
+func fakeDirInfo(dir *fakeInode) map[string]interface{} {
+	info := fakeQuotaUsage(dir)
+	info["data_pool"] = dir.effectiveLayout().Pool
+	info["uid"] = dir.uid
+	info["gid"] = dir.gid
+	info["mode"] = dir.mode
+	info["atime"] = fakeTimestamp(dir.atime)
+	info["mtime"] = fakeTimestamp(dir.mtime)
+	info["ctime"] = fakeTimestamp(dir.ctime)
+	info["created_at"] = fakeTimestamp(dir.ctime)
+	return info
+}
+
+func fakeSubvolumeGroupLs(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	fs, outs, ret := fakeVolume(f, args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	list := []map[string]string{}
+	if dir := fs.subvolumeGroup(""); dir != nil {
+		names := []string{}
+		for name, child := range dir.children {
+			// _nogroup等为内部目录
+			if child.isDir() && !strings.HasPrefix(name, "_") {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			list = append(list, map[string]string{"name": name})
+		}
+	}
+	return fakeJson(list)
+}
+
+// 已存在时不报错，与ceph一致
+func fakeSubvolumeGroupCreate(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	fs, outs, ret := fakeVolume(f, args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	group := fakeArgString(args, "group_name")
+	if group == "" || strings.HasPrefix(group, "_") || strings.Contains(group, "/") {
+		return nil, "invalid group name '" + group + "'", fakeEINVAL
+	}
+	if fs.subvolumeGroup(group) != nil {
+		return nil, "", 0
+	}
+	mode, outs, ret := fakeParseMode(args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	pool := fakeArgString(args, "pool_layout")
+	if outs, ret := fs.checkPoolLayout(pool); ret < 0 {
+		return nil, outs, ret
+	}
+	dir := fs.newInode(CEPHFS_S_IFDIR | mode)
+	fs.link(fs.mkdirAll(fakeVolumesDir, CEPHFS_DEFAULT_DIR_MODE), group, dir)
+	setPoolLayout(dir, pool, "")
+	if size, ok := args["size"].(float64); ok && size > 0 {
+		dir.maxBytes = uint64(size)
+	}
+	return nil, "", 0
+}
+
+func fakeSubvolumeGroupRm(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	fs, outs, ret := fakeVolume(f, args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	group := fakeArgString(args, "group_name")
+	dir := fs.subvolumeGroup(group)
+	if dir == nil || strings.HasPrefix(group, "_") {
+		if fakeArgBool(args, "force") {
+			return nil, "", 0
+		}
+		return nil, "subvolume group '" + group + "' does not exist", fakeENOENT
+	}
+	if len(dir.children) > 0 {
+		return nil, "error in rmdir /volumes/" + group, fakeENOTEMPTY
+	}
+	volumes := fs.subvolumeGroup("")
+	delete(volumes.children, group)
+	volumes.mtime = time.Now()
+	return nil, "", 0
+}
+
+// 已存在的子卷组，_nogroup不能直接操作
+func fakeGroupArg(fs *fakeFs, args map[string]interface{}) (*fakeInode, string, string, int) {
+	group := fakeArgString(args, "group_name")
+	dir := fs.subvolumeGroup(group)
+	if dir == nil || group == "" || strings.HasPrefix(group, "_") {
+		return nil, group, "subvolume group '" + group + "' does not exist", fakeENOENT
+	}
+	return dir, group, "", 0
+}
+
+func fakeSubvolumeGroupResize(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	fs, outs, ret := fakeVolume(f, args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	dir, _, outs, ret := fakeGroupArg(fs, args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	return fakeResize(dir, args)
+}
+
+func fakeSubvolumeGroupGetpath(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	fs, outs, ret := fakeVolume(f, args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	_, group, outs, ret := fakeGroupArg(fs, args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	return []byte(path.Join(fakeVolumesDir, group)), "", 0
+}
+
+func fakeSubvolumeGroupInfo(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	fs, outs, ret := fakeVolume(f, args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	dir, _, outs, ret := fakeGroupArg(fs, args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	return fakeJson(fakeDirInfo(dir))
+}
+
+// 子卷所在的组，group_name为空时为_nogroup
+func fakeSubvolumeGroupName(args map[string]interface{}) string {
+	if group := fakeArgString(args, "group_name"); group != "" {
+		return group
+	}
+	return FS_SUBVOLUME_NOGROUP
+}
+
+// 已存在的子卷，返回子卷目录(快照所在)和数据目录
+func fakeSubvolumeArg(fs *fakeFs, args map[string]interface{}, key string) (sub *fakeSubvolume, base *fakeInode, data *fakeInode, outs string, ret int) {
+	group := fakeSubvolumeGroupName(args)
+	if group != FS_SUBVOLUME_NOGROUP && fs.subvolumeGroup(group) == nil {
+		return nil, nil, nil, "subvolume group '" + group + "' does not exist", fakeENOENT
+	}
+	name := fakeArgString(args, key)
+	sub, ok := fs.subvolumes[group+"/"+name]
+	if !ok {
+		return nil, nil, nil, "subvolume '" + name + "' does not exist", fakeENOENT
+	}
+	// 子卷目录可能已通过文件系统删除
+	base = fs.subvolumeGroup(path.Join(group, name))
+	if base == nil || base.children[sub.uuid] == nil {
+		return nil, nil, nil, "subvolume '" + name + "' does not exist", fakeENOENT
+	}
+	return sub, base, base.children[sub.uuid], "", 0
+}
+
+func fakeSubvolumeLs(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	fs, outs, ret := fakeVolume(f, args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	group := fakeSubvolumeGroupName(args)
+	if group != FS_SUBVOLUME_NOGROUP && fs.subvolumeGroup(group) == nil {
+		return nil, "subvolume group '" + group + "' does not exist", fakeENOENT
+	}
+	names := []string{}
+	for key := range fs.subvolumes {
+		if strings.HasPrefix(key, group+"/") {
+			names = append(names, key[len(group)+1:])
+		}
+	}
+	sort.Strings(names)
+	list := []map[string]string{}
+	for _, name := range names {
+		list = append(list, map[string]string{"name": name})
+	}
+	return fakeJson(list)
+}
+
+// 创建子卷目录，返回数据目录
+func (fs *fakeFs) createSubvolume(group string, name string, mode uint32, pool string, namespace string) (*fakeInode, string, int) {
+	if group != FS_SUBVOLUME_NOGROUP && fs.subvolumeGroup(group) == nil {
+		return nil, "subvolume group '" + group + "' does not exist", fakeENOENT
+	}
+	if name == "" || strings.Contains(name, "/") || strings.HasPrefix(name, "_") {
+		return nil, "invalid subvolume name '" + name + "'", fakeEINVAL
+	}
+	if outs, ret := fs.checkPoolLayout(pool); ret < 0 {
+		return nil, outs, ret
+	}
+	groupDir := fs.mkdirAll(path.Join(fakeVolumesDir, group), CEPHFS_DEFAULT_DIR_MODE)
+	if groupDir.quotaExceeded(0, 2, nil) {
+		return nil, "error in mkdir " + path.Join(fakeVolumesDir, group, name), fakeEDQUOT
+	}
+	base := fs.newInode(CEPHFS_S_IFDIR | CEPHFS_DEFAULT_DIR_MODE)
+	data := fs.newInode(CEPHFS_S_IFDIR | mode)
+	sub := &fakeSubvolume{
+		uuid:    fmt.Sprintf("00000000-0000-4000-8000-%012x", data.ino),
+		created: time.Now(),
+	}
+	fs.link(groupDir, name, base)
+	fs.link(base, sub.uuid, data)
+	setPoolLayout(data, pool, namespace)
+	fs.subvolumes[group+"/"+name] = sub
+	return data, "", 0
+}
+
+// 已存在时不报错，与ceph一致
+func fakeSubvolumeCreate(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	fs, outs, ret := fakeVolume(f, args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	group, name := fakeSubvolumeGroupName(args), fakeArgString(args, "sub_name")
+	if _, ok := fs.subvolumes[group+"/"+name]; ok {
+		return nil, "", 0
+	}
+	mode, outs, ret := fakeParseMode(args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	namespace := ""
+	if fakeArgBool(args, "namespace_isolated") {
+		namespace = "fsvolumens_" + name
+	}
+	data, outs, ret := fs.createSubvolume(group, name, mode, fakeArgString(args, "pool_layout"), namespace)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	if size, ok := args["size"].(float64); ok && size > 0 {
+		data.maxBytes = uint64(size)
+	}
+	return nil, "", 0
+}
+
+func fakeSubvolumeRm(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	fs, outs, ret := fakeVolume(f, args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	_, base, _, outs, ret := fakeSubvolumeArg(fs, args, "sub_name")
+	if ret == fakeENOENT && fakeArgBool(args, "force") {
+		return nil, "", 0
+	}
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	name := fakeArgString(args, "sub_name")
+	if len(base.snaps) > 0 {
+		return nil, "subvolume '" + name + "' has snapshots", fakeENOTEMPTY
+	}
+	group := fakeSubvolumeGroupName(args)
+	delete(base.parent.children, name)
+	base.parent.mtime = time.Now()
+	delete(fs.subvolumes, group+"/"+name)
+	return nil, "", 0
+}
+
+func fakeSubvolumeResize(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	fs, outs, ret := fakeVolume(f, args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	_, _, data, outs, ret := fakeSubvolumeArg(fs, args, "sub_name")
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	return fakeResize(data, args)
+}
+
+func fakeSubvolumeGetpath(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	fs, outs, ret := fakeVolume(f, args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	sub, _, _, outs, ret := fakeSubvolumeArg(fs, args, "sub_name")
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	return []byte(path.Join(fakeVolumesDir, fakeSubvolumeGroupName(args), fakeArgString(args, "sub_name"), sub.uuid)), "", 0
+}
+
+func fakeSubvolumeInfo(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	fs, outs, ret := fakeVolume(f, args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	sub, _, data, outs, ret := fakeSubvolumeArg(fs, args, "sub_name")
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	info := fakeDirInfo(data)
+	info["created_at"] = fakeTimestamp(sub.created)
+	info["path"] = path.Join(fakeVolumesDir, fakeSubvolumeGroupName(args), fakeArgString(args, "sub_name"), sub.uuid)
+	info["pool_namespace"] = data.effectiveLayout().PoolNamespace
+	info["features"] = []string{"snapshot-clone", "snapshot-autoprotect"}
+	info["state"] = "complete"
+	info["type"] = "subvolume"
+	if sub.clone != nil {
+		info["type"] = "clone"
+	}
+	return fakeJson(info)
+}
+
+func fakeSubvolumeSnapshotLs(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	fs, outs, ret := fakeVolume(f, args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	_, base, _, outs, ret := fakeSubvolumeArg(fs, args, "sub_name")
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	names := []string{}
+	for name := range base.snaps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := []map[string]string{}
+	for _, name := range names {
+		list = append(list, map[string]string{"name": name})
+	}
+	return fakeJson(list)
+}
+
+// 快照保存在子卷目录(数据目录的上级)
+func fakeSubvolumeSnapshotCreate(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	fs, outs, ret := fakeVolume(f, args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	_, base, _, outs, ret := fakeSubvolumeArg(fs, args, "sub_name")
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	name := fakeArgString(args, "snap_name")
+	if name == "" || strings.HasPrefix(name, "_") || strings.Contains(name, "/") {
+		return nil, "invalid snapshot name '" + name + "'", fakeEINVAL
+	}
+	if _, ok := base.snaps[name]; ok {
+		return nil, "snapshot '" + name + "' already exists", fakeEEXIST
+	}
+	if base.snaps == nil {
+		base.snaps = map[string]*fakeInode{}
+	}
+	snap := base.snapshot(nil)
+	snap.ctime = time.Now()
+	base.snaps[name] = snap
+	return nil, "", 0
+}
+
+func fakeSubvolumeSnapshotRm(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	fs, outs, ret := fakeVolume(f, args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	_, base, _, outs, ret := fakeSubvolumeArg(fs, args, "sub_name")
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	name := fakeArgString(args, "snap_name")
+	if _, ok := base.snaps[name]; !ok {
+		if fakeArgBool(args, "force") {
+			return nil, "", 0
+		}
+		return nil, "snapshot '" + name + "' does not exist", fakeENOENT
+	}
+	delete(base.snaps, name)
+	return nil, "", 0
+}
+
+func fakeSubvolumeSnapshotInfo(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	fs, outs, ret := fakeVolume(f, args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	sub, base, _, outs, ret := fakeSubvolumeArg(fs, args, "sub_name")
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	name := fakeArgString(args, "snap_name")
+	snap, ok := base.snaps[name]
+	if !ok {
+		return nil, "snapshot '" + name + "' does not exist", fakeENOENT
+	}
+	data := snap.children[sub.uuid]
+	if data == nil {
+		return nil, "snapshot '" + name + "' does not exist", fakeENOENT
+	}
+	// 模拟的克隆同步完成，没有未完成的克隆
+	return fakeJson(map[string]interface{}{
+		"created_at":         fakeTimestamp(snap.ctime),
+		"data_pool":          data.effectiveLayout().Pool,
+		"has_pending_clones": "no",
+		"size":               data.rbytes(),
+	})
+}
+
+// 克隆立即完成
+func fakeSubvolumeSnapshotClone(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	fs, outs, ret := fakeVolume(f, args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	sub, base, srcData, outs, ret := fakeSubvolumeArg(fs, args, "sub_name")
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	snapName := fakeArgString(args, "snap_name")
+	snap, ok := base.snaps[snapName]
+	if !ok || snap.children[sub.uuid] == nil {
+		return nil, "snapshot '" + snapName + "' does not exist", fakeENOENT
+	}
+	target := fakeArgString(args, "target_sub_name")
+	targetGroup := fakeArgString(args, "target_group_name")
+	if targetGroup == "" {
+		targetGroup = FS_SUBVOLUME_NOGROUP
+	}
+	if _, ok := fs.subvolumes[targetGroup+"/"+target]; ok {
+		return nil, "subvolume '" + target + "' exists", fakeEEXIST
+	}
+	pool := fakeArgString(args, "pool_layout")
+	if pool == "" {
+		pool = srcData.effectiveLayout().Pool
+	}
+	data, outs, ret := fs.createSubvolume(targetGroup, target, srcData.mode&07777, pool, "")
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	for name, child := range snap.children[sub.uuid].children {
+		data.children[name] = fs.copyTree(child, data)
+	}
+	source := &FsCloneSource{
+		Volume:    fs.name,
+		Subvolume: fakeArgString(args, "sub_name"),
+		Snapshot:  snapName,
+	}
+	if group := fakeArgString(args, "group_name"); group != "" {
+		source.Group = group
+	}
+	fs.subvolumes[targetGroup+"/"+target].clone = source
+	return nil, "", 0
+}
+
+func fakeCloneStatus(f *fakeRados, args map[string]interface{}) ([]byte, string, int) {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+	fs, outs, ret := fakeVolume(f, args)
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	sub, _, _, outs, ret := fakeSubvolumeArg(fs, args, "clone_name")
+	if ret < 0 {
+		return nil, outs, ret
+	}
+	if sub.clone == nil {
+		return nil, "subvolume '" + fakeArgString(args, "clone_name") + "' is not a clone", fakeEOPNOTSUPP
+	}
+	return fakeJson(map[string]interface{}{
+		"status": map[string]interface{}{
+			"state":  "complete",
+			"source": sub.clone,
+		},
+	})
+}
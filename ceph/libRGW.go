@@ -1 +1,466 @@
 package ceph
+
+// 对象存储网关的S3接口，用于浏览存储桶和对象
+// 访问其他用户的存储桶需要使用system用户的密钥
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	S3_MAX_KEYS       = 1000
+	S3_MIN_PART_SIZE  = 5 << 20
+	S3_PART_SIZE      = 16 << 20 // UploadObject默认的分块大小
+	S3_MAX_PARTS      = 10000
+	S3_PRESIGN_EXPIRE = 7 * 24 * time.Hour // v4预签名的最长有效期
+)
+
+type S3Bucket struct {
+	Name         string    `xml:"Name" json:"name"`
+	CreationDate time.Time `xml:"CreationDate" json:"creation_date"`
+}
+
+type S3Object struct {
+	Key          string    `xml:"Key" json:"key"`
+	LastModified time.Time `xml:"LastModified" json:"last_modified"`
+	ETag         string    `xml:"ETag" json:"etag"`
+	Size         int64     `xml:"Size" json:"size"`
+	StorageClass string    `xml:"StorageClass" json:"storage_class"`
+}
+
+type S3Prefix struct {
+	Prefix string `xml:"Prefix" json:"prefix"`
+}
+
+// 对象列表查询条件，Delimiter为/时按目录浏览
+type S3ListOptions struct {
+	Prefix            string
+	Delimiter         string
+	ContinuationToken string // 上一页的NextContinuationToken
+	MaxKeys           int    // 为0时使用S3_MAX_KEYS
+}
+
+type S3ObjectList struct {
+	XMLName               xml.Name   `xml:"ListBucketResult" json:"-"`
+	Name                  string     `xml:"Name" json:"name"`
+	Prefix                string     `xml:"Prefix" json:"prefix"`
+	Delimiter             string     `xml:"Delimiter" json:"delimiter"`
+	MaxKeys               int        `xml:"MaxKeys" json:"max_keys"`
+	KeyCount              int        `xml:"KeyCount" json:"key_count"`
+	IsTruncated           bool       `xml:"IsTruncated" json:"is_truncated"`
+	ContinuationToken     string     `xml:"ContinuationToken" json:"continuation_token"`
+	NextContinuationToken string     `xml:"NextContinuationToken" json:"next_continuation_token"`
+	Contents              []S3Object `xml:"Contents" json:"contents"`
+	CommonPrefixes        []S3Prefix `xml:"CommonPrefixes" json:"common_prefixes"`
+}
+
+type S3ObjectInfo struct {
+	Key          string            `json:"key"`
+	Size         int64             `json:"size"`
+	ETag         string            `json:"etag"`
+	ContentType  string            `json:"content_type"`
+	LastModified time.Time         `json:"last_modified"`
+	Metadata     map[string]string `json:"metadata"` // x-amz-meta-*，key为小写
+}
+
+type S3Part struct {
+	PartNumber int    `xml:"PartNumber" json:"part_number"`
+	ETag       string `xml:"ETag" json:"etag"`
+}
+
+type S3Upload struct {
+	Key       string    `xml:"Key" json:"key"`
+	UploadId  string    `xml:"UploadId" json:"upload_id"`
+	Initiated time.Time `xml:"Initiated" json:"initiated"`
+}
+
+type s3ListAllMyBucketsResult struct {
+	XMLName xml.Name   `xml:"ListAllMyBucketsResult"`
+	Owner   string     `xml:"Owner>ID"`
+	Buckets []S3Bucket `xml:"Buckets>Bucket"`
+}
+
+type s3InitiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadId string   `xml:"UploadId"`
+}
+
+type s3CompleteMultipartUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []S3Part `xml:"Part"`
+}
+
+type s3CompleteMultipartUploadResult struct {
+	XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+	Bucket  string   `xml:"Bucket"`
+	Key     string   `xml:"Key"`
+	ETag    string   `xml:"ETag"`
+}
+
+type s3ListMultipartUploadsResult struct {
+	XMLName xml.Name   `xml:"ListMultipartUploadsResult"`
+	Bucket  string     `xml:"Bucket"`
+	Uploads []S3Upload `xml:"Upload"`
+}
+
+func s3ObjectPath(bucket string, key string) (string, error) {
+	if bucket == "" || strings.Contains(bucket, "/") {
+		return "", errors.New("invalid bucket name[" + bucket + "]")
+	}
+	if key == "" {
+		return "", errors.New("object key is empty")
+	}
+	return "/" + bucket + "/" + key, nil
+}
+
+func s3ETag(etag string) string {
+	return strings.Trim(etag, "\"")
+}
+
+// S3请求，payload为空时请求体不签名
+func (gw *radosGW) s3(op string, method string, path string, query url.Values, header http.Header, body io.Reader, length int64, payload_hash string) (*http.Response, error) {
+	return gw.s3Do(gw.client, op, method, path, query, header, body, length, payload_hash)
+}
+
+// 读写对象数据的S3请求，不限制传输的总时长
+func (gw *radosGW) s3Stream(op string, method string, path string, query url.Values, header http.Header, body io.Reader, length int64, payload_hash string) (*http.Response, error) {
+	return gw.s3Do(gw.stream, op, method, path, query, header, body, length, payload_hash)
+}
+
+func (gw *radosGW) s3Do(client *http.Client, op string, method string, path string, query url.Values, header http.Header, body io.Reader, length int64, payload_hash string) (*http.Response, error) {
+	resp, err := gw.do(client, method, path, query, header, body, length, payload_hash)
+	if err != nil {
+		return nil, errors.New("cannot " + op + " " + err.Error())
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		err := rgwResponseError(op, resp)
+		if method == http.MethodHead && resp.StatusCode == http.StatusNotFound {
+			err.(*RgwError).Code = "NoSuchKey"
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// 请求体为xml的S3请求，结果为xml
+func (gw *radosGW) s3xml(op string, method string, path string, query url.Values, body interface{}, result interface{}) error {
+	var reader io.Reader
+	payload := []byte{}
+	if body != nil {
+		data, err := xml.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = data
+		reader = bytes.NewReader(data)
+	}
+	resp, err := gw.s3(op, method, path, query, nil, reader, int64(len(payload)), sha256Hex(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if result == nil {
+		return nil
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(result); err != nil {
+		return errors.New("cannot " + op + " decode response " + err.Error())
+	}
+	return nil
+}
+
+func (gw *radosGW) ListBuckets() ([]S3Bucket, error) {
+	result := s3ListAllMyBucketsResult{}
+	if err := gw.s3xml("list s3 buckets", http.MethodGet, "/", url.Values{}, nil, &result); err != nil {
+		return nil, err
+	}
+	if result.Buckets == nil {
+		result.Buckets = []S3Bucket{}
+	}
+	return result.Buckets, nil
+}
+
+func (gw *radosGW) ListObjects(bucket string, opts S3ListOptions) (*S3ObjectList, error) {
+	if bucket == "" || strings.Contains(bucket, "/") {
+		return nil, errors.New("invalid bucket name[" + bucket + "]")
+	}
+	if opts.MaxKeys <= 0 || opts.MaxKeys > S3_MAX_KEYS {
+		opts.MaxKeys = S3_MAX_KEYS
+	}
+	query := url.Values{
+		"list-type": {"2"},
+		"max-keys":  {strconv.Itoa(opts.MaxKeys)},
+		"prefix":    {opts.Prefix},
+	}
+	if opts.Delimiter != "" {
+		query.Set("delimiter", opts.Delimiter)
+	}
+	if opts.ContinuationToken != "" {
+		query.Set("continuation-token", opts.ContinuationToken)
+	}
+	list := &S3ObjectList{}
+	if err := gw.s3xml("list objects of bucket["+bucket+"]", http.MethodGet, "/"+bucket, query, nil, list); err != nil {
+		return nil, err
+	}
+	if list.Contents == nil {
+		list.Contents = []S3Object{}
+	}
+	if list.CommonPrefixes == nil {
+		list.CommonPrefixes = []S3Prefix{}
+	}
+	for i := range list.Contents {
+		list.Contents[i].ETag = s3ETag(list.Contents[i].ETag)
+	}
+	return list, nil
+}
+
+func s3ObjectInfo(key string, header http.Header) *S3ObjectInfo {
+	info := &S3ObjectInfo{
+		Key:         key,
+		ETag:        s3ETag(header.Get("ETag")),
+		ContentType: header.Get("Content-Type"),
+		Metadata:    map[string]string{},
+	}
+	info.Size, _ = strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if total := header.Get("Content-Range"); total != "" {
+		// 范围读取时Content-Range为bytes start-end/size
+		if i := strings.LastIndex(total, "/"); i >= 0 {
+			info.Size, _ = strconv.ParseInt(total[i+1:], 10, 64)
+		}
+	}
+	info.LastModified, _ = http.ParseTime(header.Get("Last-Modified"))
+	for name := range header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-meta-") {
+			info.Metadata[strings.TrimPrefix(lower, "x-amz-meta-")] = header.Get(name)
+		}
+	}
+	return info
+}
+
+func (gw *radosGW) HeadObject(bucket string, key string) (*S3ObjectInfo, error) {
+	path, err := s3ObjectPath(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := gw.s3("head object["+key+"]", http.MethodHead, path, nil, nil, nil, 0, rgwEmptyBodyHash)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return s3ObjectInfo(key, resp.Header), nil
+}
+
+// 读取对象，length为0时读取到末尾，返回的reader使用完毕需关闭
+func (gw *radosGW) GetObject(bucket string, key string, offset int64, length int64) (io.ReadCloser, *S3ObjectInfo, error) {
+	path, err := s3ObjectPath(bucket, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if offset < 0 || length < 0 {
+		return nil, nil, errors.New("invalid range of object[" + key + "]")
+	}
+	header := http.Header{}
+	if length > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	} else if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := gw.s3Stream("get object["+key+"]", http.MethodGet, path, nil, header, nil, 0, rgwEmptyBodyHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Body, s3ObjectInfo(key, resp.Header), nil
+}
+
+// 写入对象，请求体不签名以便流式上传，size为请求体长度
+func (gw *radosGW) PutObject(bucket string, key string, body io.Reader, size int64, content_type string) (string, error) {
+	path, err := s3ObjectPath(bucket, key)
+	if err != nil {
+		return "", err
+	}
+	header := http.Header{}
+	if content_type != "" {
+		header.Set("Content-Type", content_type)
+	}
+	resp, err := gw.s3Stream("put object["+key+"]", http.MethodPut, path, nil, header, body, size, "")
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return s3ETag(resp.Header.Get("ETag")), nil
+}
+
+func (gw *radosGW) DeleteObject(bucket string, key string) error {
+	path, err := s3ObjectPath(bucket, key)
+	if err != nil {
+		return err
+	}
+	resp, err := gw.s3("delete object["+key+"]", http.MethodDelete, path, nil, nil, nil, 0, rgwEmptyBodyHash)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (gw *radosGW) CreateMultipartUpload(bucket string, key string, content_type string) (string, error) {
+	path, err := s3ObjectPath(bucket, key)
+	if err != nil {
+		return "", err
+	}
+	header := http.Header{}
+	if content_type != "" {
+		header.Set("Content-Type", content_type)
+	}
+	resp, err := gw.s3("create multipart upload of object["+key+"]", http.MethodPost, path, url.Values{"uploads": {""}}, header, nil, 0, rgwEmptyBodyHash)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	result := s3InitiateMultipartUploadResult{}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", errors.New("cannot create multipart upload of object[" + key + "] decode response " + err.Error())
+	}
+	return result.UploadId, nil
+}
+
+func (gw *radosGW) UploadPart(bucket string, key string, upload_id string, part_number int, body io.Reader, size int64) (string, error) {
+	path, err := s3ObjectPath(bucket, key)
+	if err != nil {
+		return "", err
+	}
+	if part_number < 1 || part_number > S3_MAX_PARTS {
+		return "", errors.New("invalid part number " + strconv.Itoa(part_number))
+	}
+	query := url.Values{"partNumber": {strconv.Itoa(part_number)}, "uploadId": {upload_id}}
+	resp, err := gw.s3Stream("upload part "+strconv.Itoa(part_number)+" of object["+key+"]", http.MethodPut, path, query, nil, body, size, "")
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return s3ETag(resp.Header.Get("ETag")), nil
+}
+
+func (gw *radosGW) CompleteMultipartUpload(bucket string, key string, upload_id string, parts []S3Part) (string, error) {
+	path, err := s3ObjectPath(bucket, key)
+	if err != nil {
+		return "", err
+	}
+	body := s3CompleteMultipartUpload{}
+	for _, part := range parts {
+		body.Parts = append(body.Parts, S3Part{PartNumber: part.PartNumber, ETag: "\"" + s3ETag(part.ETag) + "\""})
+	}
+	result := s3CompleteMultipartUploadResult{}
+	if err := gw.s3xml("complete multipart upload of object["+key+"]", http.MethodPost, path, url.Values{"uploadId": {upload_id}}, body, &result); err != nil {
+		return "", err
+	}
+	return s3ETag(result.ETag), nil
+}
+
+func (gw *radosGW) AbortMultipartUpload(bucket string, key string, upload_id string) error {
+	path, err := s3ObjectPath(bucket, key)
+	if err != nil {
+		return err
+	}
+	return gw.s3xml("abort multipart upload of object["+key+"]", http.MethodDelete, path, url.Values{"uploadId": {upload_id}}, nil, nil)
+}
+
+func (gw *radosGW) ListMultipartUploads(bucket string) ([]S3Upload, error) {
+	if bucket == "" || strings.Contains(bucket, "/") {
+		return nil, errors.New("invalid bucket name[" + bucket + "]")
+	}
+	result := s3ListMultipartUploadsResult{}
+	if err := gw.s3xml("list multipart uploads of bucket["+bucket+"]", http.MethodGet, "/"+bucket, url.Values{"uploads": {""}}, nil, &result); err != nil {
+		return nil, err
+	}
+	if result.Uploads == nil {
+		result.Uploads = []S3Upload{}
+	}
+	return result.Uploads, nil
+}
+
+// 上传对象，size大于part_size时使用分块上传，失败时取消分块上传
+func (gw *radosGW) UploadObject(bucket string, key string, body io.Reader, size int64, content_type string, part_size int64) (string, error) {
+	if part_size <= 0 {
+		part_size = S3_PART_SIZE
+	}
+	if part_size < S3_MIN_PART_SIZE {
+		part_size = S3_MIN_PART_SIZE
+	}
+	if size <= part_size {
+		return gw.PutObject(bucket, key, body, size, content_type)
+	}
+	for size > part_size*S3_MAX_PARTS {
+		part_size *= 2
+	}
+	upload_id, err := gw.CreateMultipartUpload(bucket, key, content_type)
+	if err != nil {
+		return "", err
+	}
+	parts := []S3Part{}
+	for offset, number := int64(0), 1; offset < size; offset, number = offset+part_size, number+1 {
+		n := part_size
+		if size-offset < n {
+			n = size - offset
+		}
+		// 读取整个分块以便失败时不会向网关发送不完整的请求体
+		data, err := ioutil.ReadAll(io.LimitReader(body, n))
+		if err == nil && int64(len(data)) != n {
+			err = errors.New("cannot upload object[" + key + "] unexpected end of data")
+		}
+		var etag string
+		if err == nil {
+			etag, err = gw.UploadPart(bucket, key, upload_id, number, bytes.NewReader(data), n)
+		}
+		if err != nil {
+			gw.AbortMultipartUpload(bucket, key, upload_id)
+			return "", err
+		}
+		parts = append(parts, S3Part{PartNumber: number, ETag: etag})
+	}
+	etag, err := gw.CompleteMultipartUpload(bucket, key, upload_id, parts)
+	if err != nil {
+		gw.AbortMultipartUpload(bucket, key, upload_id)
+		return "", err
+	}
+	return etag, nil
+}
+
+// 生成预签名URL，method为GET、PUT、HEAD或DELETE
+func (gw *radosGW) PresignObject(method string, bucket string, key string, expires time.Duration) (string, error) {
+	path, err := s3ObjectPath(bucket, key)
+	if err != nil {
+		return "", err
+	}
+	switch method {
+	case http.MethodGet, http.MethodPut, http.MethodHead, http.MethodDelete:
+	default:
+		return "", errors.New("invalid presign method[" + method + "]")
+	}
+	if expires < time.Second || expires > S3_PRESIGN_EXPIRE {
+		return "", errors.New("invalid presign expires " + expires.String())
+	}
+	r, err := http.NewRequest(method, gw.config.Endpoint+rgwEscape(path, true), nil)
+	if err != nil {
+		return "", err
+	}
+	now := gw.now()
+	if gw.config.Signature == RGW_SIGNATURE_V2 {
+		PresignRgwV2(r, gw.config.AccessKey, gw.config.SecretKey, now.Add(expires))
+	} else {
+		PresignRgwV4(r, gw.config.AccessKey, gw.config.SecretKey, gw.config.Region, now, expires)
+	}
+	return r.URL.String(), nil
+}
@@ -0,0 +1,321 @@
+package ceph
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// AWS文档中的预签名示例
+func TestPresignRgwV4(t *testing.T) {
+	r, _ := http.NewRequest(http.MethodGet, "https://examplebucket.s3.amazonaws.com/test.txt", nil)
+	PresignRgwV4(r, testRgwAccessKey, testRgwSecretKey, "us-east-1", time.Date(2013, 5, 24, 0, 0, 0, 0, time.UTC), 24*time.Hour)
+	want := "aeeed9bbccd4d02ee5c0109b86d86835f995330da4c265957d157751f604d404"
+	if got := r.URL.Query().Get("X-Amz-Signature"); got != want {
+		t.Errorf("PresignRgwV4() signature = %s, want %s", got, want)
+	}
+	// 已过期
+	if _, err := VerifyRgwSignature(r, nil, "us-east-1", func(string) string { return testRgwSecretKey }); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("VerifyRgwSignature() expired error = %v", err)
+	}
+}
+
+func TestRadosGW_s3(t *testing.T) {
+	for _, signature := range []string{RGW_SIGNATURE_V2, RGW_SIGNATURE_V4} {
+		t.Run(signature, func(t *testing.T) {
+			gw, fake := newTestRadosGW(t, signature)
+			gw.UserCreate(RgwUserOptions{Uid: "alice", DisplayName: "Alice"})
+			fake.CreateBucket("admin", "panel")
+			fake.CreateBucket("alice", "photos")
+
+			buckets, err := gw.ListBuckets()
+			if err != nil || len(buckets) != 1 || buckets[0].Name != "panel" {
+				t.Errorf("ListBuckets() = %v, %v", buckets, err)
+			}
+			// system用户可以访问其他用户的存储桶
+			for _, key := range []string{"2024/a.jpg", "2024/b.jpg", "2025/c.jpg", "d e+f.txt", "z.txt"} {
+				if _, err := gw.PutObject("photos", key, strings.NewReader(key), int64(len(key)), "image/jpeg"); err != nil {
+					t.Fatalf("PutObject(%s) error = %v", key, err)
+				}
+			}
+			if _, err := gw.PutObject("nobucket", "a", strings.NewReader("a"), 1, ""); !IsRgwError(err, "NoSuchBucket") {
+				t.Errorf("PutObject() without bucket error = %v", err)
+			}
+
+			list, err := gw.ListObjects("photos", S3ListOptions{Delimiter: "/"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(list.CommonPrefixes) != 2 || list.CommonPrefixes[0].Prefix != "2024/" || len(list.Contents) != 2 || list.Contents[0].Key != "d e+f.txt" {
+				t.Errorf("ListObjects() with delimiter = %+v", list)
+			}
+			list, err = gw.ListObjects("photos", S3ListOptions{Prefix: "2024/", Delimiter: "/"})
+			if err != nil || len(list.Contents) != 2 || len(list.CommonPrefixes) != 0 || list.Contents[0].Size != 10 || list.Contents[0].ETag == "" {
+				t.Errorf("ListObjects() with prefix = %+v, %v", list, err)
+			}
+			// 分页
+			keys := []string{}
+			opts := S3ListOptions{Delimiter: "/", MaxKeys: 2}
+			for page := 0; page < 5; page++ {
+				list, err := gw.ListObjects("photos", opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, p := range list.CommonPrefixes {
+					keys = append(keys, p.Prefix)
+				}
+				for _, obj := range list.Contents {
+					keys = append(keys, obj.Key)
+				}
+				if !list.IsTruncated {
+					break
+				}
+				opts.ContinuationToken = list.NextContinuationToken
+			}
+			if strings.Join(keys, ",") != "2024/,2025/,d e+f.txt,z.txt" {
+				t.Errorf("ListObjects() pages = %v", keys)
+			}
+
+			info, err := gw.HeadObject("photos", "d e+f.txt")
+			if err != nil || info.Size != 9 || info.ContentType != "image/jpeg" || info.ETag == "" {
+				t.Errorf("HeadObject() = %+v, %v", info, err)
+			}
+			if _, err := gw.HeadObject("photos", "missing"); !IsRgwError(err, "NoSuchKey") {
+				t.Errorf("HeadObject() missing error = %v", err)
+			}
+			body, info, err := gw.GetObject("photos", "d e+f.txt", 2, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := ioutil.ReadAll(body)
+			body.Close()
+			if string(data) != "e+f" || info.Size != 9 {
+				t.Errorf("GetObject() range = %q, %+v", data, info)
+			}
+			if err := gw.DeleteObject("photos", "z.txt"); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := gw.GetObject("photos", "z.txt", 0, 0); !IsRgwError(err, "NoSuchKey") {
+				t.Errorf("GetObject() after delete error = %v", err)
+			}
+
+			// 用户自己的密钥不能访问其他用户的存储桶
+			keys2, _ := gw.KeyCreate("alice", "ALICEKEY", "alicesecret")
+			if len(keys2) != 2 {
+				t.Fatalf("KeyCreate() = %v", keys2)
+			}
+			alice, _ := NewRadosGW(RgwConfig{Endpoint: gw.(*radosGW).config.Endpoint, AccessKey: "ALICEKEY", SecretKey: "alicesecret", Signature: signature})
+			if _, err := alice.ListObjects("panel", S3ListOptions{}); !IsRgwError(err, "AccessDenied") {
+				t.Errorf("ListObjects() by other user error = %v", err)
+			}
+			if buckets, _ := alice.ListBuckets(); len(buckets) != 1 || buckets[0].Name != "photos" {
+				t.Errorf("ListBuckets() by user = %v", buckets)
+			}
+		})
+	}
+}
+
+func TestRadosGW_multipart(t *testing.T) {
+	gw, fake := newTestRadosGW(t, RGW_SIGNATURE_V4)
+	fake.MinPartSize = 1 << 10
+	fake.CreateBucket("admin", "panel")
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), S3_MIN_PART_SIZE/16*2+100)
+	etag, err := gw.UploadObject("panel", "big.bin", bytes.NewReader(data), int64(len(data)), "application/octet-stream", S3_MIN_PART_SIZE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(etag, "-3") {
+		t.Errorf("UploadObject() etag = %s", etag)
+	}
+	body, info, err := gw.GetObject("panel", "big.bin", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := ioutil.ReadAll(body)
+	body.Close()
+	if !bytes.Equal(got, data) || info.ETag != etag || info.ContentType != "application/octet-stream" {
+		t.Errorf("GetObject() after multipart size = %d, %+v", len(got), info)
+	}
+
+	// 数据不足时取消分块上传
+	if _, err := gw.UploadObject("panel", "short.bin", bytes.NewReader(data[:100]), int64(len(data)), "", 0); err == nil {
+		t.Errorf("UploadObject() with short data should fail")
+	}
+	if uploads, err := gw.ListMultipartUploads("panel"); err != nil || len(uploads) != 0 {
+		t.Errorf("ListMultipartUploads() after abort = %v, %v", uploads, err)
+	}
+
+	upload_id, err := gw.CreateMultipartUpload("panel", "parts.bin", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e1, _ := gw.UploadPart("panel", "parts.bin", upload_id, 1, strings.NewReader("small"), 5)
+	e2, _ := gw.UploadPart("panel", "parts.bin", upload_id, 2, strings.NewReader("last"), 4)
+	if uploads, _ := gw.ListMultipartUploads("panel"); len(uploads) != 1 || uploads[0].UploadId != upload_id {
+		t.Errorf("ListMultipartUploads() = %v", uploads)
+	}
+	if _, err := gw.CompleteMultipartUpload("panel", "parts.bin", upload_id, []S3Part{{1, e1}, {2, e2}}); !IsRgwError(err, "EntityTooSmall") {
+		t.Errorf("CompleteMultipartUpload() small part error = %v", err)
+	}
+	if _, err := gw.CompleteMultipartUpload("panel", "parts.bin", upload_id, []S3Part{{2, e2}, {1, e1}}); !IsRgwError(err, "InvalidPartOrder") {
+		t.Errorf("CompleteMultipartUpload() order error = %v", err)
+	}
+	if err := gw.AbortMultipartUpload("panel", "parts.bin", upload_id); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.AbortMultipartUpload("panel", "parts.bin", upload_id); !IsRgwError(err, "NoSuchUpload") {
+		t.Errorf("AbortMultipartUpload() twice error = %v", err)
+	}
+}
+
+func TestRadosGW_presign(t *testing.T) {
+	for _, signature := range []string{RGW_SIGNATURE_V2, RGW_SIGNATURE_V4} {
+		t.Run(signature, func(t *testing.T) {
+			gw, fake := newTestRadosGW(t, signature)
+			fake.CreateBucket("admin", "panel")
+			fake.PutObject("panel", "dir/hello world.txt", []byte("hello"))
+
+			if _, err := gw.PresignObject(http.MethodPost, "panel", "a", time.Hour); err == nil {
+				t.Errorf("PresignObject() with POST should fail")
+			}
+			if _, err := gw.PresignObject(http.MethodGet, "panel", "a", 8*24*time.Hour); err == nil {
+				t.Errorf("PresignObject() with too long expires should fail")
+			}
+			u, err := gw.PresignObject(http.MethodGet, "panel", "dir/hello world.txt", time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.Get(u)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || string(data) != "hello" {
+				t.Errorf("GET presigned url = %d %s", resp.StatusCode, data)
+			}
+
+			u, _ = gw.PresignObject(http.MethodPut, "panel", "upload.txt", time.Hour)
+			r, _ := http.NewRequest(http.MethodPut, u, strings.NewReader("uploaded"))
+			resp, err = http.DefaultClient.Do(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if info, err := gw.HeadObject("panel", "upload.txt"); resp.StatusCode != http.StatusOK || err != nil || info.Size != 8 {
+				t.Errorf("PUT presigned url = %d, %+v, %v", resp.StatusCode, info, err)
+			}
+
+			// 篡改的URL
+			resp, _ = http.Get(strings.Replace(u, "upload.txt", "other.txt", 1))
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusForbidden {
+				t.Errorf("GET tampered url = %d", resp.StatusCode)
+			}
+			// 已过期
+			gw.(*radosGW).now = func() time.Time { return time.Now().Add(-2 * time.Hour) }
+			u, _ = gw.PresignObject(http.MethodGet, "panel", "upload.txt", time.Hour)
+			resp, _ = http.Get(u)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusForbidden {
+				t.Errorf("GET expired url = %d", resp.StatusCode)
+			}
+		})
+	}
+}
+
+// 分块缓慢返回对象数据的RGW
+type slowRgwHandler struct {
+	http.Handler
+	delay time.Duration
+	stall time.Duration // 非对象请求在返回响应头前等待的时长
+}
+
+func (h *slowRgwHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || r.URL.Path != "/panel/slow.bin" {
+		time.Sleep(h.stall)
+		h.Handler.ServeHTTP(w, r)
+		return
+	}
+	rec := httptest.NewRecorder()
+	h.Handler.ServeHTTP(rec, r)
+	for k, v := range rec.Header() {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rec.Code)
+	for _, b := range rec.Body.Bytes() {
+		w.Write([]byte{b})
+		w.(http.Flusher).Flush()
+		time.Sleep(h.delay)
+	}
+}
+
+// 每次读取一个字节并等待
+type slowReader struct {
+	data  []byte
+	delay time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(r.delay)
+	p[0] = r.data[0]
+	r.data = r.data[1:]
+	return 1, nil
+}
+
+// 对象数据的传输时长不受Timeout限制，其他请求仍受限制
+func TestRadosGW_slowTransfer(t *testing.T) {
+	fake := NewFakeRadosGW(testRgwAccessKey, testRgwSecretKey)
+	fake.CreateBucket("admin", "panel")
+	handler := &slowRgwHandler{Handler: fake, delay: 50 * time.Millisecond}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	timeout := 200 * time.Millisecond
+	gw, err := NewRadosGW(RgwConfig{Endpoint: server.URL, AccessKey: testRgwAccessKey, SecretKey: testRgwSecretKey, Timeout: timeout})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := "0123456789"
+	start := time.Now()
+	if _, err := gw.PutObject("panel", "slow.bin", &slowReader{data: []byte(data), delay: handler.delay}, int64(len(data)), ""); err != nil {
+		t.Fatalf("PutObject() with slow body error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < timeout {
+		t.Fatalf("PutObject() took %v, want longer than %v", elapsed, timeout)
+	}
+	start = time.Now()
+	body, _, err := gw.GetObject("panel", "slow.bin", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(body)
+	body.Close()
+	if err != nil || string(got) != data {
+		t.Errorf("GetObject() with slow body = %q, %v", got, err)
+	}
+	if elapsed := time.Since(start); elapsed < timeout {
+		t.Errorf("GetObject() took %v, want longer than %v", elapsed, timeout)
+	}
+
+	// 等待响应头超时
+	handler.stall = 2 * timeout
+	if _, err := gw.ListObjects("panel", S3ListOptions{}); err == nil {
+		t.Errorf("ListObjects() should time out")
+	}
+	if _, err := gw.UserInfo("admin"); err == nil {
+		t.Errorf("UserInfo() should time out")
+	}
+	if _, err := gw.HeadObject("panel", "slow.bin"); err == nil {
+		t.Errorf("HeadObject() should time out")
+	}
+}
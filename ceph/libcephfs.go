@@ -1,14 +1,135 @@
 package ceph
 
 // 文件系统
+
+import (
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// 文件类型，与stat的st_mode一致
+const (
+	CEPHFS_S_IFMT  uint32 = 0170000
+	CEPHFS_S_IFDIR uint32 = 0040000
+	CEPHFS_S_IFREG uint32 = 0100000
+	CEPHFS_S_IFLNK uint32 = 0120000
+
+	CEPHFS_DEFAULT_DIR_MODE  uint32 = 0755
+	CEPHFS_DEFAULT_FILE_MODE uint32 = 0644
+)
+
+// 打开文件的标志，与linux的open一致
+const (
+	CEPHFS_O_RDONLY = 00
+	CEPHFS_O_WRONLY = 01
+	CEPHFS_O_RDWR   = 02
+	CEPHFS_O_CREAT  = 0100
+	CEPHFS_O_EXCL   = 0200
+	CEPHFS_O_TRUNC  = 01000
+)
+
+type CephfsStat struct {
+	Name  string    `json:"name"`
+	Type  string    `json:"type"` // dir、file、symlink或other
+	Ino   uint64    `json:"ino"`
+	Mode  uint32    `json:"mode"` // 权限位
+	Uid   uint32    `json:"uid"`
+	Gid   uint32    `json:"gid"`
+	Size  uint64    `json:"size"`
+	Nlink uint32    `json:"nlink"`
+	Atime time.Time `json:"atime"`
+	Mtime time.Time `json:"mtime"`
+	Ctime time.Time `json:"ctime"`
+}
+
+func (s CephfsStat) IsDir() bool {
+	return s.Type == "dir"
+}
+
+func cephfsFileType(mode uint32) string {
+	switch mode & CEPHFS_S_IFMT {
+	case CEPHFS_S_IFDIR:
+		return "dir"
+	case CEPHFS_S_IFREG:
+		return "file"
+	case CEPHFS_S_IFLNK:
+		return "symlink"
+	}
+	return "other"
+}
+
+// 文件系统操作，挂载后使用，路径为挂载点下的绝对路径
 type Libcephfs interface {
 	LibRados
+
+	// fs_name为空时挂载默认文件系统，root为挂载的子目录
+	Ceph_mount(fs_name string, root string) error
+	Ceph_unmount() error
+
+	Ceph_stat(path string) (stat CephfsStat, err error)
+	// 目录内容，不含.和..，按名称排序
+	Ceph_listdir(path string) (entries []CephfsStat, err error)
+	Ceph_mkdir(path string, mode uint32) error
+	// 创建目录及不存在的上级目录
+	Ceph_mkdirs(path string, mode uint32) error
+	Ceph_rmdir(path string) error
+	Ceph_unlink(path string) error
+	Ceph_rename(from string, to string) error
+	Ceph_chmod(path string, mode uint32) error
+	Ceph_truncate(path string, size uint64) error
+
+	// flags为CEPHFS_O_*的组合
+	Ceph_open(path string, flags int, mode uint32) (CephfsFile, error)
+
+	// 扩展属性，包括ceph.quota.*、ceph.dir.layout.*等虚拟属性
+	Ceph_getxattr(path string, name string) (value []byte, err error)
+	Ceph_setxattr(path string, name string, value []byte) error
+	Ceph_removexattr(path string, name string) error
+}
+
+// 打开的文件，使用后需Close
+type CephfsFile interface {
+	io.ReaderAt
+	io.WriterAt
+	Close() error
+}
+
+// 后端需同时实现Libcephfs
+func NewLibCephfs(rados LibRados) (Libcephfs, error) {
+	fs, ok := rados.(Libcephfs)
+	if !ok {
+		return nil, errors.New("backend does not support cephfs")
+	}
+	return fs, nil
+}
+
+// 检查并规范化路径，只接受绝对路径
+func CleanCephfsPath(p string) (string, error) {
+	if !strings.HasPrefix(p, "/") {
+		return "", errors.New("path[" + p + "] must be absolute")
+	}
+	if strings.ContainsRune(p, 0) {
+		return "", errors.New("path contains NUL")
+	}
+	return path.Clean(p), nil
 }
 
-type libcephfs struct {
-	libRados
+// fs ls的输出
+type FsInfo struct {
+	Name           string   `json:"name"`
+	MetadataPool   string   `json:"metadata_pool"`
+	MetadataPoolId int64    `json:"metadata_pool_id"`
+	DataPools      []string `json:"data_pools"`
+	DataPoolIds    []int64  `json:"data_pool_ids"`
 }
 
-func NewLibCephfs() *libcephfs {
-	return &libcephfs{}
+func (c *Commander) FsList() ([]FsInfo, error) {
+	list := []FsInfo{}
+	if _, err := c.Mon(NewCommand("fs ls"), &list); err != nil {
+		return nil, err
+	}
+	return list, nil
 }
@@ -0,0 +1,319 @@
+//go:build rados
+// +build rados
+
+package ceph
+
+// libcephfs文件系统，挂载使用libRados的集群句柄
+
+/*
+#cgo LDFLAGS: -lcephfs
+#include <stdlib.h>
+#include <errno.h>
+#include <fcntl.h>
+#include <cephfs/libcephfs.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+var _ Libcephfs = (*libRados)(nil)
+
+func (lib *libRados) mountInfo() *C.struct_ceph_mount_info {
+	return (*C.struct_ceph_mount_info)(lib.cmount)
+}
+
+// 未挂载时返回错误
+func (lib *libRados) mounted(op string, path string) error {
+	if lib.cmount == nil {
+		return errors.New("cannot " + op + "[" + path + "] cephfs not mounted " + fmt.Sprintf("%v", -C.ENOTCONN))
+	}
+	return nil
+}
+
+func (lib *libRados) Ceph_mount(fs_name string, root string) error {
+	if lib.cmount != nil {
+		return errors.New("cannot mount cephfs[" + fs_name + "] " + fmt.Sprintf("%v", -C.EISCONN))
+	}
+	var cmount *C.struct_ceph_mount_info
+	ret := C.ceph_create_from_rados(&cmount, lib.cluster)
+	if int32(ret) < 0 {
+		return errors.New("cannot create cephfs mount " + fmt.Sprintf("%v", ret))
+	}
+	fail := func(op string, ret C.int) error {
+		C.ceph_release(cmount)
+		return errors.New("cannot " + op + " cephfs[" + fs_name + "] " + fmt.Sprintf("%v", ret))
+	}
+	if ret = C.ceph_init(cmount); int32(ret) < 0 {
+		return fail("init", ret)
+	}
+	if fs_name != "" {
+		cname := C.CString(fs_name)
+		defer C.free(unsafe.Pointer(cname))
+		if ret = C.ceph_select_filesystem(cmount, cname); int32(ret) < 0 {
+			return fail("select", ret)
+		}
+	}
+	if root == "" {
+		root = "/"
+	}
+	croot := C.CString(root)
+	defer C.free(unsafe.Pointer(croot))
+	if ret = C.ceph_mount(cmount, croot); int32(ret) < 0 {
+		return fail("mount", ret)
+	}
+	lib.cmount = unsafe.Pointer(cmount)
+	return nil
+}
+
+func (lib *libRados) Ceph_unmount() error {
+	if err := lib.mounted("unmount", "/"); err != nil {
+		return err
+	}
+	ret := C.ceph_unmount(lib.mountInfo())
+	C.ceph_release(lib.mountInfo())
+	lib.cmount = nil
+	if int32(ret) < 0 {
+		return errors.New("cannot unmount cephfs " + fmt.Sprintf("%v", ret))
+	}
+	return nil
+}
+
+func timespecTime(ts C.struct_timespec) time.Time {
+	return time.Unix(int64(ts.tv_sec), int64(ts.tv_nsec))
+}
+
+func statxToStat(name string, stx *C.struct_ceph_statx) CephfsStat {
+	mode := uint32(stx.stx_mode)
+	return CephfsStat{
+		Name:  name,
+		Type:  cephfsFileType(mode),
+		Ino:   uint64(stx.stx_ino),
+		Mode:  mode &^ CEPHFS_S_IFMT,
+		Uid:   uint32(stx.stx_uid),
+		Gid:   uint32(stx.stx_gid),
+		Size:  uint64(stx.stx_size),
+		Nlink: uint32(stx.stx_nlink),
+		Atime: timespecTime(stx.stx_atime),
+		Mtime: timespecTime(stx.stx_mtime),
+		Ctime: timespecTime(stx.stx_ctime),
+	}
+}
+
+// 对路径调用C函数，ret小于0时返回错误
+func (lib *libRados) fsCall(op string, path string, call func(cpath *C.char) C.int) error {
+	if err := lib.mounted(op, path); err != nil {
+		return err
+	}
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+	ret := call(cpath)
+	if int32(ret) < 0 {
+		return errors.New("cannot " + op + "[" + path + "] " + fmt.Sprintf("%v", ret))
+	}
+	return nil
+}
+
+func (lib *libRados) Ceph_stat(path string) (stat CephfsStat, err error) {
+	var stx C.struct_ceph_statx
+	err = lib.fsCall("stat", path, func(cpath *C.char) C.int {
+		return C.ceph_statx(lib.mountInfo(), cpath, &stx, C.CEPH_STATX_BASIC_STATS, C.AT_SYMLINK_NOFOLLOW)
+	})
+	if err != nil {
+		return stat, err
+	}
+	name := path
+	if i := strings.LastIndexByte(path, '/'); i >= 0 && len(path) > 1 {
+		name = path[i+1:]
+	}
+	return statxToStat(name, &stx), nil
+}
+
+func (lib *libRados) Ceph_listdir(path string) (entries []CephfsStat, err error) {
+	var dir *C.struct_ceph_dir_result
+	err = lib.fsCall("list directory", path, func(cpath *C.char) C.int {
+		return C.ceph_opendir(lib.mountInfo(), cpath, &dir)
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer C.ceph_closedir(lib.mountInfo(), dir)
+	entries = []CephfsStat{}
+	for {
+		var de C.struct_dirent
+		var stx C.struct_ceph_statx
+		ret := C.ceph_readdirplus_r(lib.mountInfo(), dir, &de, &stx, C.CEPH_STATX_BASIC_STATS, C.AT_SYMLINK_NOFOLLOW, nil)
+		if int32(ret) < 0 {
+			return nil, errors.New("cannot list directory[" + path + "] " + fmt.Sprintf("%v", ret))
+		}
+		if ret == 0 {
+			break
+		}
+		name := C.GoString(&de.d_name[0])
+		if name == "." || name == ".." {
+			continue
+		}
+		entries = append(entries, statxToStat(name, &stx))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+func (lib *libRados) Ceph_mkdir(path string, mode uint32) error {
+	return lib.fsCall("mkdir", path, func(cpath *C.char) C.int {
+		return C.ceph_mkdir(lib.mountInfo(), cpath, C.mode_t(mode))
+	})
+}
+
+func (lib *libRados) Ceph_mkdirs(path string, mode uint32) error {
+	return lib.fsCall("mkdirs", path, func(cpath *C.char) C.int {
+		return C.ceph_mkdirs(lib.mountInfo(), cpath, C.mode_t(mode))
+	})
+}
+
+func (lib *libRados) Ceph_rmdir(path string) error {
+	return lib.fsCall("rmdir", path, func(cpath *C.char) C.int {
+		return C.ceph_rmdir(lib.mountInfo(), cpath)
+	})
+}
+
+func (lib *libRados) Ceph_unlink(path string) error {
+	return lib.fsCall("unlink", path, func(cpath *C.char) C.int {
+		return C.ceph_unlink(lib.mountInfo(), cpath)
+	})
+}
+
+func (lib *libRados) Ceph_rename(from string, to string) error {
+	cto := C.CString(to)
+	defer C.free(unsafe.Pointer(cto))
+	return lib.fsCall("rename", from, func(cfrom *C.char) C.int {
+		return C.ceph_rename(lib.mountInfo(), cfrom, cto)
+	})
+}
+
+func (lib *libRados) Ceph_chmod(path string, mode uint32) error {
+	return lib.fsCall("chmod", path, func(cpath *C.char) C.int {
+		return C.ceph_chmod(lib.mountInfo(), cpath, C.mode_t(mode))
+	})
+}
+
+func (lib *libRados) Ceph_truncate(path string, size uint64) error {
+	return lib.fsCall("truncate", path, func(cpath *C.char) C.int {
+		return C.ceph_truncate(lib.mountInfo(), cpath, C.int64_t(size))
+	})
+}
+
+func (lib *libRados) Ceph_getxattr(path string, name string) (value []byte, err error) {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	// 先取得长度，属性在两次调用之间变长时重试
+	for {
+		var size C.int
+		err = lib.fsCall("getxattr "+name, path, func(cpath *C.char) C.int {
+			size = C.ceph_getxattr(lib.mountInfo(), cpath, cname, nil, 0)
+			return size
+		})
+		if err != nil || size == 0 {
+			return []byte{}, err
+		}
+		buf := make([]byte, int(size))
+		var ret C.int
+		err = lib.fsCall("getxattr "+name, path, func(cpath *C.char) C.int {
+			ret = C.ceph_getxattr(lib.mountInfo(), cpath, cname, unsafe.Pointer(&buf[0]), C.size_t(len(buf)))
+			if ret == -C.ERANGE {
+				return 0
+			}
+			return ret
+		})
+		if err != nil {
+			return nil, err
+		}
+		if ret != -C.ERANGE {
+			return buf[:int(ret)], nil
+		}
+	}
+}
+
+func (lib *libRados) Ceph_setxattr(path string, name string, value []byte) error {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	var cvalue unsafe.Pointer
+	if len(value) > 0 {
+		cvalue = C.CBytes(value)
+		defer C.free(cvalue)
+	}
+	return lib.fsCall("setxattr "+name, path, func(cpath *C.char) C.int {
+		return C.ceph_setxattr(lib.mountInfo(), cpath, cname, cvalue, C.size_t(len(value)), 0)
+	})
+}
+
+func (lib *libRados) Ceph_removexattr(path string, name string) error {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	return lib.fsCall("removexattr "+name, path, func(cpath *C.char) C.int {
+		return C.ceph_removexattr(lib.mountInfo(), cpath, cname)
+	})
+}
+
+type cephfsFile struct {
+	lib  *libRados
+	path string
+	fd   C.int
+}
+
+func (lib *libRados) Ceph_open(path string, flags int, mode uint32) (CephfsFile, error) {
+	var fd C.int
+	err := lib.fsCall("open", path, func(cpath *C.char) C.int {
+		fd = C.ceph_open(lib.mountInfo(), cpath, C.int(flags), C.mode_t(mode))
+		return fd
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &cephfsFile{lib: lib, path: path, fd: fd}, nil
+}
+
+func (file *cephfsFile) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	ret := C.ceph_read(file.lib.mountInfo(), file.fd, (*C.char)(unsafe.Pointer(&p[0])), C.int64_t(len(p)), C.int64_t(off))
+	if int32(ret) < 0 {
+		return 0, errors.New("cannot read[" + file.path + "] " + fmt.Sprintf("%v", ret))
+	}
+	if int(ret) < len(p) {
+		return int(ret), io.EOF
+	}
+	return int(ret), nil
+}
+
+func (file *cephfsFile) WriteAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	ret := C.ceph_write(file.lib.mountInfo(), file.fd, (*C.char)(unsafe.Pointer(&p[0])), C.int64_t(len(p)), C.int64_t(off))
+	if int32(ret) < 0 {
+		return 0, errors.New("cannot write[" + file.path + "] " + fmt.Sprintf("%v", ret))
+	}
+	if int(ret) < len(p) {
+		return int(ret), io.ErrShortWrite
+	}
+	return int(ret), nil
+}
+
+func (file *cephfsFile) Close() error {
+	ret := C.ceph_close(file.lib.mountInfo(), file.fd)
+	if int32(ret) < 0 {
+		return errors.New("cannot close[" + file.path + "] " + fmt.Sprintf("%v", ret))
+	}
+	return nil
+}
@@ -1,7 +1,96 @@
 package ceph
 
-import "testing"
+import (
+	"io"
+	"testing"
+)
 
 func TestNewLibCephfs(t *testing.T) {
+	fs, err := NewLibCephfs(newConnectedFake(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Ceph_stat("/"); err == nil {
+		t.Fatal("expected error before mount")
+	}
+	if err := fs.Ceph_mount("nofs", ""); err == nil {
+		t.Fatal("expected error mounting unknown filesystem")
+	}
+	if err := fs.Ceph_mount("", "/"); err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Ceph_unmount()
 
+	if err := fs.Ceph_mkdirs("/a/b/c", CEPHFS_DEFAULT_DIR_MODE); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Ceph_mkdirs("/a/b", CEPHFS_DEFAULT_DIR_MODE); err == nil {
+		t.Fatal("expected EEXIST")
+	}
+	file, err := fs.Ceph_open("/a/b/hello.txt", CEPHFS_O_WRONLY|CEPHFS_O_CREAT|CEPHFS_O_EXCL, CEPHFS_DEFAULT_FILE_MODE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteAt([]byte("hello cephfs"), 0)
+	if _, err := file.ReadAt(make([]byte, 1), 0); err == nil {
+		t.Fatal("expected EBADF reading a write only file")
+	}
+	file.Close()
+	if _, err := fs.Ceph_open("/a/b/hello.txt", CEPHFS_O_WRONLY|CEPHFS_O_CREAT|CEPHFS_O_EXCL, 0644); err == nil {
+		t.Fatal("expected EEXIST with O_EXCL")
+	}
+
+	entries, err := fs.Ceph_listdir("/a/b")
+	if err != nil || len(entries) != 2 || entries[0].Name != "c" || !entries[0].IsDir() || entries[1].Size != 12 || entries[1].Mode != 0644 {
+		t.Fatalf("listdir %+v %v", entries, err)
+	}
+	if stat, err := fs.Ceph_stat("/a"); err != nil || stat.Size != 12 || stat.Nlink != 3 {
+		t.Fatalf("stat of directory %+v %v", stat, err)
+	}
+	if err := fs.Ceph_rmdir("/a/b"); err == nil {
+		t.Fatal("expected ENOTEMPTY")
+	}
+	if err := fs.Ceph_unlink("/a/b/c"); err == nil {
+		t.Fatal("expected EISDIR unlinking a directory")
+	}
+	if err := fs.Ceph_rename("/a", "/a/b/c/d"); err == nil {
+		t.Fatal("expected EINVAL moving a directory into itself")
+	}
+	if err := fs.Ceph_rename("/a/b/hello.txt", "/a/hi.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Ceph_truncate("/a/hi.txt", 5); err != nil {
+		t.Fatal(err)
+	}
+
+	// 以子目录挂载时路径相对于子目录
+	sub, _ := NewLibCephfs(fs.Rados_clone())
+	if err := sub.Ceph_mount("cephfs", "/a"); err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Ceph_unmount()
+	file, err = sub.Ceph_open("/hi.txt", CEPHFS_O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := make([]byte, 10)
+	if n, err := file.ReadAt(p, 0); err != io.EOF || string(p[:n]) != "hello" {
+		t.Fatalf("read %q %v", p[:n], err)
+	}
+	file.Close()
+	if err := sub.Ceph_rmdir("/"); err == nil {
+		t.Fatal("expected error removing the mount root")
+	}
+}
+
+func TestCleanCephfsPath(t *testing.T) {
+	cases := map[string]string{"/": "/", "/a/../b/": "/b", "//x//y": "/x/y", "/..": "/"}
+	for in, want := range cases {
+		if got, err := CleanCephfsPath(in); err != nil || got != want {
+			t.Fatalf("%s: %s %v", in, got, err)
+		}
+	}
+	if _, err := CleanCephfsPath("relative"); err == nil {
+		t.Fatal("expected error on relative path")
+	}
 }
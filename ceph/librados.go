@@ -1,3 +1,6 @@
+//go:build rados
+// +build rados
+
 package ceph
 
 // 基础库
@@ -7,84 +10,22 @@ package ceph
 #include <stdio.h>
 #include <stdlib.h>
 #include <string.h>
+#include <errno.h>
 #include <rados/librados.h>
 #include <rados/rados_types.h>
+#include "radosInconsistent.h"
+#include "radosOmapHeader.h"
 */
 import "C"
 
 import (
 	"bytes"
-	"encoding/binary"
 	"errors"
 	"fmt"
+	"time"
 	"unsafe"
 )
 
-type LibRados interface {
-	// setup and teardown
-	Rados_create2(flags uint64) error
-	Rados_create() error
-	//Rados_ping_monitor(monId string, out *bytes.Buffer) error
-	Rados_connect() error
-	Rados_shutdown()
-
-	// configure
-	Rados_conf_read_file(path string) error
-
-	Rados_write_full(object_name string, value []byte) error
-	Rados_write(key string, value []byte, offset uint) error
-	Rados_Read(key string, size uint, offset uint64) (out bytes.Buffer, err error)
-
-	Rados_setxattr(object_name string, attr_name string, value []byte) error
-	Rados_getxattr(object_name string, attr_name string, size uint) (interface{}, error)
-	Rados_rmxattr(object_name string, attr_name string) error
-
-	// 异步IO
-	Rados_aio_create_completion() error
-	Rados_aio_write(key string, value []byte, offset uint64) error
-	Rados_aio_read() (interface{}, error)
-	Rados_aio_write_full() error
-	Rados_aio_append() error
-	Rados_aio_release()
-	Rados_aio_wait_for_complete() // in memory
-	Rados_aio_wait_for_safe()     // on disk
-	Rados_aio_flush() error
-	Rados_aio_flush_async() error
-	Rados_aio_cancel() error
-	Rados_aio_is_complete() error
-	Rados_aio_is_safe() error
-
-	// Mon/OSD/PG commands
-	Rados_mon_command(cmd string, params []byte) (out []byte, err error)
-	//Rados_mgr_command(cmd string, params []byte) (out []byte, err error)
-	Rados_buffer_free()
-	Rados_osd_command(osdId int, cmd string, params []byte) (out []byte, err error)
-	Rados_pg_command(pgstr string, cmd string, params []byte) (out []byte, err error)
-	Rados_monitor_log() error
-	Rados_monitor_log2() error
-
-	// Pools
-	Rados_pool_list() (out []byte, err error)
-	Rados_pool_delete(pool_name string) error
-	Rados_ioctx_create(pool_name string) error
-	Rados_ioctx_destroy()
-
-	// Snapshots
-	Rados_ioctx_snap_create(snapname string) error
-	Rados_ioctx_snap_remove(snapname string) error
-	Rados_ioctx_snap_rollback(snapname string, key string) error
-	Rados_rollback(snapname string, key string) error
-	Rados_ioctx_snap_set_read(snap C.rados_snap_t) error
-	Rados_ioctx_snap_list(snaps *C.rados_snap_t) (out []byte, err error)
-
-	// Functions
-	Rados_cluster_stat() error
-	Rados_version() (major int, minor int, extra int)
-	Rados_stat()
-	Rados_lock_shared() error
-	Raods_unlock() error
-}
-
 type libRados struct {
 	cluster C.rados_t // 集群句柄
 
@@ -99,9 +40,17 @@ type libRados struct {
 
 	io C.rados_ioctx_t // 同步IO上下文
 
-	comp C.rados_completion_t // 异步IO
-
 	Stat C.struct_rados_cluster_stat_t //
+
+	clone bool // 由Rados_clone创建，不持有集群句柄
+
+	cmount unsafe.Pointer // 文件系统挂载，由Ceph_mount创建
+}
+
+func init() {
+	RegisterBackend(BACKEND_RADOS, func(cluster_name string, user_name string) LibRados {
+		return NewLibRados(cluster_name, user_name)
+	})
 }
 
 func NewLibRados(cluster_name string, user_name string) *libRados {
@@ -137,6 +86,19 @@ func (lib *libRados) Rados_conf_read_file(path string) error {
 	return nil
 }
 
+// 设置配置项，覆盖配置文件中的值
+func (lib *libRados) Rados_conf_set(option string, value string) error {
+	coption := C.CString(option)
+	defer C.free(unsafe.Pointer(coption))
+	cvalue := C.CString(value)
+	defer C.free(unsafe.Pointer(cvalue))
+	err := C.rados_conf_set(lib.cluster, coption, cvalue)
+	if int32(err) < 0 {
+		return errors.New("cannot set config option[" + option + "] " + fmt.Sprintf("%v", err))
+	}
+	return nil
+}
+
 // 连接
 func (lib *libRados) Rados_connect() error {
 	err := C.rados_connect(lib.cluster)
@@ -147,11 +109,19 @@ func (lib *libRados) Rados_connect() error {
 	return nil
 }
 
+// 数据的首地址，空数据返回nil
+func dataPtr(value []byte) *C.char {
+	if len(value) == 0 {
+		return nil
+	}
+	return (*C.char)(unsafe.Pointer(&value[0]))
+}
+
 // 写入数据
 func (lib *libRados) Rados_write(key string, value []byte, offset uint) error {
-	buf := new(bytes.Buffer)
-	_ = binary.Write(buf, binary.LittleEndian, value)
-	err := C.rados_write(lib.io, (*C.char)(C.CString(key)), (*C.char)(unsafe.Pointer(&buf)), (C.uint64_t)(len(buf.Bytes())), (C.size_t)(offset))
+	ckey := C.CString(key)
+	defer C.free(unsafe.Pointer(ckey))
+	err := C.rados_write(lib.io, ckey, dataPtr(value), (C.size_t)(len(value)), (C.uint64_t)(offset))
 	if int32(err) < 0 {
 		return errors.New("cannot write object to pool[" + string(lib.pool_name) + "] " + fmt.Sprintf("%v", err))
 	}
@@ -160,19 +130,133 @@ func (lib *libRados) Rados_write(key string, value []byte, offset uint) error {
 }
 
 func (lib *libRados) Rados_Read(key string, size uint, offset uint64) (out bytes.Buffer, err error) {
-	err1 := C.rados_read(lib.io, (*C.char)(C.CString(key)), (*C.char)(unsafe.Pointer(&out)), (C.uint64_t)(size), (C.size_t)(offset))
-	if int32(err1) < 0 {
-		return out, errors.New("cannot read object to pool[" + string(lib.pool_name) + "] " + fmt.Sprintf("%v", err1))
+	ckey := C.CString(key)
+	defer C.free(unsafe.Pointer(ckey))
+	buf := make([]byte, size)
+	ret := C.rados_read(lib.io, ckey, dataPtr(buf), (C.size_t)(size), (C.uint64_t)(offset))
+	if int32(ret) < 0 {
+		return out, errors.New("cannot read object to pool[" + string(lib.pool_name) + "] " + fmt.Sprintf("%v", ret))
 	}
-
+	// 返回值为实际读取的字节数
+	out.Write(buf[:int(ret)])
 	return out, nil
 }
 
+func (lib *libRados) Rados_append(object_name string, value []byte) error {
+	cname := C.CString(object_name)
+	defer C.free(unsafe.Pointer(cname))
+	err := C.rados_append(lib.io, cname, dataPtr(value), (C.size_t)(len(value)))
+	if int32(err) < 0 {
+		return errors.New("cannot append object[" + object_name + "] " + fmt.Sprintf("%v", err))
+	}
+	return nil
+}
+
+func (lib *libRados) Rados_stat(object_name string) (stat ObjectStat, err error) {
+	cname := C.CString(object_name)
+	defer C.free(unsafe.Pointer(cname))
+	var size C.uint64_t
+	var mtime C.time_t
+	ret := C.rados_stat(lib.io, cname, &size, &mtime)
+	if int32(ret) < 0 {
+		return stat, errors.New("cannot stat object[" + object_name + "] " + fmt.Sprintf("%v", ret))
+	}
+	stat.Size = uint64(size)
+	stat.Mtime = time.Unix(int64(mtime), 0)
+	return stat, nil
+}
+
+func (lib *libRados) Rados_remove(object_name string) error {
+	cname := C.CString(object_name)
+	defer C.free(unsafe.Pointer(cname))
+	err := C.rados_remove(lib.io, cname)
+	if int32(err) < 0 {
+		return errors.New("cannot remove object[" + object_name + "] " + fmt.Sprintf("%v", err))
+	}
+	return nil
+}
+
+// 设置命名空间，ALL_NAMESPACES仅用于列出对象
+func (lib *libRados) Rados_ioctx_set_namespace(nspace string) {
+	cns := C.CString(nspace)
+	defer C.free(unsafe.Pointer(cns))
+	C.rados_ioctx_set_namespace(lib.io, cns)
+}
+
+// 按pg哈希顺序列出对象，游标记录pg哈希位置以及该pg中已列出的对象数，
+// 对象增删后分页可能出现重复或遗漏
+func (lib *libRados) Rados_nobjects_list(cursor string, max int) (page ObjectListPage, err error) {
+	pos, skip, err := parseListCursor(cursor)
+	if err != nil {
+		return page, err
+	}
+	var ctx C.rados_list_ctx_t
+	ret := C.rados_nobjects_list_open(lib.io, &ctx)
+	if int32(ret) < 0 {
+		return page, errors.New("cannot list objects " + fmt.Sprintf("%v", ret))
+	}
+	defer C.rados_nobjects_list_close(ctx)
+
+	max = listLimit(max)
+	if cursor != "" {
+		pos = uint32(C.rados_nobjects_list_seek(ctx, C.uint32_t(pos)))
+	}
+	current, count := pos, 0
+	page.Objects = []ObjectEntry{}
+	for {
+		var entry, key, nspace *C.char
+		ret := C.rados_nobjects_list_next(ctx, &entry, &key, &nspace)
+		if int32(ret) == -C.ENOENT {
+			page.Next = ""
+			break
+		}
+		if int32(ret) < 0 {
+			return page, errors.New("cannot list objects " + fmt.Sprintf("%v", ret))
+		}
+		p := uint32(C.rados_nobjects_list_get_pg_hash_position(ctx))
+		if p != current {
+			current, count = p, 0
+		}
+		count++
+		// 跳过上一页已列出的对象
+		if cursor != "" && current == pos && count <= skip {
+			continue
+		}
+		if len(page.Objects) == max {
+			break
+		}
+		object := ObjectEntry{Name: C.GoString(entry)}
+		if nspace != nil {
+			object.Namespace = C.GoString(nspace)
+		}
+		if key != nil {
+			object.Locator = C.GoString(key)
+		}
+		page.Objects = append(page.Objects, object)
+		page.Next = formatListCursor(current, count)
+	}
+	return page, nil
+}
+
 // 关闭集群句柄
 func (lib *libRados) Rados_shutdown() {
+	if lib.clone {
+		return
+	}
 	C.rados_shutdown(lib.cluster)
 }
 
+// 共享集群句柄，io上下文独立
+func (lib *libRados) Rados_clone() LibRados {
+	return &libRados{
+		cluster:      lib.cluster,
+		cluster_name: lib.cluster_name,
+		user_name:    lib.user_name,
+		config:       lib.config,
+		clone:        true,
+	}
+}
+
 // 创建io上下文
 func (lib *libRados) Rados_ioctx_create(pool_name string) error {
 	lib.pool_name = pool_name
@@ -185,12 +269,10 @@ func (lib *libRados) Rados_ioctx_create(pool_name string) error {
 }
 
 func (lib *libRados) Rados_write_full(object_name string, value []byte) error {
-	buf := new(bytes.Buffer)
-	_ = binary.Write(buf, binary.LittleEndian, value)
-	err := C.rados_write_full(lib.io, (*C.char)(C.CString(object_name)), (*C.char)(unsafe.Pointer(&buf)), (C.ulong)(len(buf.Bytes())))
+	cname := C.CString(object_name)
+	defer C.free(unsafe.Pointer(cname))
+	err := C.rados_write_full(lib.io, cname, dataPtr(value), (C.size_t)(len(value)))
 	if int32(err) < 0 {
-		lib.Rados_ioctx_destroy()
-		lib.Rados_shutdown()
 		return errors.New("cannot write pool[" + string(object_name) + "] " + fmt.Sprintf("%v", err))
 	}
 	return nil
@@ -203,22 +285,61 @@ func (lib *libRados) Rados_ioctx_destroy() {
 
 // 设置属性值
 func (lib *libRados) Rados_setxattr(object_name string, attr_name string, value []byte) error {
-	buf := new(bytes.Buffer)
-	_ = binary.Write(buf, binary.LittleEndian, value)
-	err := C.rados_setxattr(lib.io, (*C.char)(C.CString(object_name)), (*C.char)(C.CString(attr_name)), (*C.char)(unsafe.Pointer(&buf)), (C.ulong)(len(buf.Bytes())))
+	cname := C.CString(object_name)
+	defer C.free(unsafe.Pointer(cname))
+	cattr := C.CString(attr_name)
+	defer C.free(unsafe.Pointer(cattr))
+	err := C.rados_setxattr(lib.io, cname, cattr, dataPtr(value), (C.size_t)(len(value)))
 	if int32(err) < 0 {
 		return errors.New("cannot set extended attribute on object[" + string(object_name) + "] " + fmt.Sprintf("%v", err))
 	}
 	return nil
 }
 
-func (lib *libRados) Rados_getxattr(object_name string, attr_name string, size uint) (interface{}, error) {
-	buf := new(bytes.Buffer)
-	err := C.rados_getxattr(lib.io, (*C.char)(C.CString(object_name)), (*C.char)(C.CString(attr_name)), (*C.char)(unsafe.Pointer(&buf)), (C.size_t)(size))
-	if int32(err) < 0 {
-		return nil, errors.New("cannot get extended attribute on object[" + string(object_name) + "] " + fmt.Sprintf("%v", err))
+// 缓冲区不足时加倍重试
+func (lib *libRados) Rados_getxattr(object_name string, attr_name string) (value []byte, err error) {
+	cname := C.CString(object_name)
+	defer C.free(unsafe.Pointer(cname))
+	cattr := C.CString(attr_name)
+	defer C.free(unsafe.Pointer(cattr))
+	for size := 4096; ; size *= 2 {
+		buf := make([]byte, size)
+		ret := C.rados_getxattr(lib.io, cname, cattr, dataPtr(buf), (C.size_t)(size))
+		if int32(ret) == -C.ERANGE && size < OBJECT_STREAM_CHUNK {
+			continue
+		}
+		if int32(ret) < 0 {
+			return nil, errors.New("cannot get extended attribute on object[" + string(object_name) + "] " + fmt.Sprintf("%v", ret))
+		}
+		return buf[:int(ret)], nil
 	}
-	return buf, nil
+}
+
+func (lib *libRados) Rados_getxattrs(object_name string) (attrs []XattrEntry, err error) {
+	cname := C.CString(object_name)
+	defer C.free(unsafe.Pointer(cname))
+	var iter C.rados_xattrs_iter_t
+	ret := C.rados_getxattrs(lib.io, cname, &iter)
+	if int32(ret) < 0 {
+		return nil, errors.New("cannot get extended attributes on object[" + object_name + "] " + fmt.Sprintf("%v", ret))
+	}
+	defer C.rados_getxattrs_end(iter)
+
+	values := map[string][]byte{}
+	for {
+		var name, val *C.char
+		var length C.size_t
+		ret := C.rados_getxattrs_next(iter, &name, &val, &length)
+		if int32(ret) < 0 {
+			return nil, errors.New("cannot get extended attributes on object[" + object_name + "] " + fmt.Sprintf("%v", ret))
+		}
+		// 遍历结束时name为NULL
+		if name == nil {
+			break
+		}
+		values[C.GoString(name)] = C.GoBytes(unsafe.Pointer(val), C.int(length))
+	}
+	return sortXattrs(values), nil
 }
 
 func (lib *libRados) Rados_rmxattr(object_name string, attr_name string) error {
@@ -229,182 +350,307 @@ func (lib *libRados) Rados_rmxattr(object_name string, attr_name string) error {
 	return nil
 }
 
-func (lib *libRados) Rados_aio_create_completion() error {
-	err := C.rados_aio_create_completion(nil, nil, nil, &lib.comp)
-	if int32(err) < 0 {
-		lib.Rados_ioctx_destroy()
-		lib.Rados_shutdown()
-		return errors.New("cannot create aio completion " + fmt.Sprintf("%v", err))
+// C字符串数组，使用完毕需调用free
+func cStringArray(strs []string) (array **C.char, free func()) {
+	if len(strs) == 0 {
+		return nil, func() {}
+	}
+	ptrs := C.malloc(C.size_t(len(strs)) * C.size_t(unsafe.Sizeof(uintptr(0))))
+	items := (*[1 << 28]*C.char)(ptrs)[:len(strs):len(strs)]
+	for i, str := range strs {
+		items[i] = C.CString(str)
+	}
+	return (**C.char)(ptrs), func() {
+		for _, item := range items {
+			C.free(unsafe.Pointer(item))
+		}
+		C.free(ptrs)
 	}
-	return nil
 }
 
-func (lib *libRados) Rados_aio_is_safe() error {
-	err := C.rados_aio_is_safe(lib.comp)
-	if int32(err) < 0 {
-		return errors.New("asynchronous operation is not safe. " + fmt.Sprintf("%v", err))
+// 执行omap写操作
+func (lib *libRados) omapWrite(object_name string, op func(C.rados_write_op_t)) error {
+	cname := C.CString(object_name)
+	defer C.free(unsafe.Pointer(cname))
+	wop := C.rados_create_write_op()
+	defer C.rados_release_write_op(wop)
+	op(wop)
+	ret := C.rados_write_op_operate(wop, lib.io, cname, nil, C.LIBRADOS_OPERATION_NOFLAG)
+	if int32(ret) < 0 {
+		return errors.New(fmt.Sprintf("%v", ret))
 	}
 	return nil
 }
 
-func (lib *libRados) Rados_aio_write(key string, value []byte, offset uint64) error {
-	buf := new(bytes.Buffer)
-	_ = binary.Write(buf, binary.LittleEndian, value)
-	err := C.rados_aio_write(lib.io, (*C.char)(C.CString(key)), lib.comp, (*C.char)(unsafe.Pointer(&buf)), (C.size_t)(len(buf.Bytes())), (C.uint64_t)(offset))
-	if int32(err) < 0 {
-		lib.Rados_aio_release()
-		lib.Rados_ioctx_destroy()
-		lib.Rados_shutdown()
-		return errors.New("cannot not schedule aio write " + fmt.Sprintf("%v", err))
+func (lib *libRados) Rados_omap_get_vals(object_name string, start_after string, prefix string, max int) (page OmapPage, err error) {
+	cname := C.CString(object_name)
+	defer C.free(unsafe.Pointer(cname))
+	cstart := C.CString(start_after)
+	defer C.free(unsafe.Pointer(cstart))
+	cprefix := C.CString(prefix)
+	defer C.free(unsafe.Pointer(cprefix))
+
+	rop := C.rados_create_read_op()
+	defer C.rados_release_read_op(rop)
+	var iter C.rados_omap_iter_t
+	var more C.uchar
+	var rval C.int
+	C.rados_read_op_omap_get_vals2(rop, cstart, cprefix, C.uint64_t(listLimit(max)), &iter, &more, &rval)
+	ret := C.rados_read_op_operate(rop, lib.io, cname, C.LIBRADOS_OPERATION_NOFLAG)
+	if int32(ret) < 0 {
+		return page, errors.New("cannot get omap values on object[" + object_name + "] " + fmt.Sprintf("%v", ret))
+	}
+	defer C.rados_omap_get_end(iter)
+	if int32(rval) < 0 {
+		return page, errors.New("cannot get omap values on object[" + object_name + "] " + fmt.Sprintf("%v", rval))
 	}
 
-	return nil
+	page.Vals = []OmapEntry{}
+	for {
+		var key, val *C.char
+		var length C.size_t
+		ret := C.rados_omap_get_next(iter, &key, &val, &length)
+		if int32(ret) < 0 {
+			return page, errors.New("cannot get omap values on object[" + object_name + "] " + fmt.Sprintf("%v", ret))
+		}
+		if key == nil {
+			break
+		}
+		page.Vals = append(page.Vals, OmapEntry{Key: C.GoString(key), Value: C.GoBytes(unsafe.Pointer(val), C.int(length))})
+	}
+	page.More = more != 0
+	return page, nil
 }
 
-func (lib *libRados) Rados_aio_read() (interface{}, error) {
-
-	return nil, nil
+func (lib *libRados) Rados_omap_set(object_name string, vals []OmapEntry) error {
+	keys := make([]string, len(vals))
+	for i, val := range vals {
+		keys[i] = val.Key
+	}
+	ckeys, freeKeys := cStringArray(keys)
+	defer freeKeys()
+	// 数据需复制到C内存中
+	cvals := make([]unsafe.Pointer, len(vals))
+	lens := make([]C.size_t, len(vals))
+	for i, val := range vals {
+		cvals[i] = C.CBytes(val.Value)
+		lens[i] = C.size_t(len(val.Value))
+	}
+	defer func() {
+		for _, v := range cvals {
+			C.free(v)
+		}
+	}()
+	var cvalArray **C.char
+	var cvalMem unsafe.Pointer
+	if len(vals) > 0 {
+		cvalMem = C.malloc(C.size_t(len(vals)) * C.size_t(unsafe.Sizeof(uintptr(0))))
+		defer C.free(cvalMem)
+		items := (*[1 << 28]*C.char)(cvalMem)[:len(vals):len(vals)]
+		for i, v := range cvals {
+			items[i] = (*C.char)(v)
+		}
+		cvalArray = (**C.char)(cvalMem)
+	}
+	var clens *C.size_t
+	if len(lens) > 0 {
+		clens = &lens[0]
+	}
+	err := lib.omapWrite(object_name, func(wop C.rados_write_op_t) {
+		C.rados_write_op_omap_set(wop, ckeys, cvalArray, clens, C.size_t(len(vals)))
+	})
+	if err != nil {
+		return errors.New("cannot set omap values on object[" + object_name + "] " + err.Error())
+	}
+	return nil
 }
 
-func (lib *libRados) Rados_aio_write_full() error {
-
+func (lib *libRados) Rados_omap_rm_keys(object_name string, keys []string) error {
+	ckeys, freeKeys := cStringArray(keys)
+	defer freeKeys()
+	err := lib.omapWrite(object_name, func(wop C.rados_write_op_t) {
+		C.rados_write_op_omap_rm_keys(wop, ckeys, C.size_t(len(keys)))
+	})
+	if err != nil {
+		return errors.New("cannot remove omap keys on object[" + object_name + "] " + err.Error())
+	}
 	return nil
 }
 
-func (lib *libRados) Rados_aio_append() error {
-
+func (lib *libRados) Rados_omap_clear(object_name string) error {
+	err := lib.omapWrite(object_name, func(wop C.rados_write_op_t) {
+		C.rados_write_op_omap_clear(wop)
+	})
+	if err != nil {
+		return errors.New("cannot clear omap on object[" + object_name + "] " + err.Error())
+	}
 	return nil
 }
 
-func (lib *libRados) Rados_aio_release() {
-	C.rados_aio_release(lib.comp)
-}
+// librados的C接口没有omap header的读写操作，见radosOmapHeader.cc
+func (lib *libRados) Rados_omap_get_header(object_name string) (header []byte, err error) {
+	cname := C.CString(object_name)
+	defer C.free(unsafe.Pointer(cname))
 
-func (lib *libRados) Rados_aio_wait_for_complete() {
-	C.rados_aio_wait_for_complete(lib.comp)
+	var out *C.char
+	var outlen C.size_t
+	ret := C.rados_omap_get_header_buf(lib.io, cname, &out, &outlen)
+	if ret < 0 {
+		return nil, errors.New("cannot get omap header on object[" + object_name + "] " + fmt.Sprintf("%v", ret))
+	}
+	defer C.free(unsafe.Pointer(out))
+	return C.GoBytes(unsafe.Pointer(out), C.int(outlen)), nil
 }
 
-func (lib *libRados) Rados_aio_wait_for_safe() {
-	C.rados_aio_wait_for_safe(lib.comp)
-}
+func (lib *libRados) Rados_omap_set_header(object_name string, header []byte) error {
+	cname := C.CString(object_name)
+	defer C.free(unsafe.Pointer(cname))
 
-func (lib *libRados) Rados_aio_flush() error {
-	err := C.rados_aio_flush(lib.io)
-	if int32(err) < 0 {
-		return errors.New("flush to disk error " + fmt.Sprintf("%v", err))
+	ret := C.rados_omap_set_header_buf(lib.io, cname, dataPtr(header), C.size_t(len(header)))
+	if ret < 0 {
+		return errors.New("cannot set omap header on object[" + object_name + "] " + fmt.Sprintf("%v", ret))
 	}
 	return nil
 }
 
-func (lib *libRados) Rados_aio_flush_async() error {
-	err := C.rados_aio_flush_async(lib.io, lib.comp)
-	if int32(err) < 0 {
-		return errors.New("cannot not schedule flush to disk " + fmt.Sprintf("%v", err))
+// 复制命令输出并释放librados分配的缓冲区
+func (lib *libRados) bufferFree(outbuf *C.char, outbuflen C.size_t, outsbuf *C.char, outslen C.size_t) (out []byte, outs string) {
+	if outbuf != nil {
+		out = C.GoBytes(unsafe.Pointer(outbuf), C.int(outbuflen))
+		C.rados_buffer_free(outbuf)
 	}
-	return nil
+	if outsbuf != nil {
+		outs = C.GoStringN(outsbuf, C.int(outslen))
+		C.rados_buffer_free(outsbuf)
+	}
+	return
 }
 
-func (lib *libRados) Rados_aio_cancel() error {
-	err := C.rados_aio_cancel(lib.io, lib.comp)
-	if int32(err) < 0 {
-		return errors.New("cannot not cancel async operation " + fmt.Sprintf("%v", err))
+// 命令参数转换为c类型，返回的释放函数需在命令执行后调用
+func commandArgs(cmd string, params []byte) (ccmd *C.char, inbuf *C.char, free func()) {
+	ccmd = C.CString(cmd)
+	if len(params) > 0 {
+		inbuf = (*C.char)(C.CBytes(params))
 	}
-	return nil
+	free = func() {
+		C.free(unsafe.Pointer(ccmd))
+		if inbuf != nil {
+			C.free(unsafe.Pointer(inbuf))
+		}
+	}
+	return
 }
 
-func (lib *libRados) Rados_aio_is_complete() error {
-	err := C.rados_aio_is_complete(lib.comp)
-	if int32(err) < 0 {
-		return errors.New("not complete")
+// cmd为json格式命令，见NewCommand
+func (lib *libRados) Rados_mon_command(cmd string, params []byte) (out []byte, outs string, err error) {
+	ccmd, inbuf, free := commandArgs(cmd, params)
+	defer free()
+
+	var outbuf, outsbuf *C.char
+	var outbuflen, outslen C.size_t
+	ret := C.rados_mon_command(lib.cluster,
+		&ccmd,
+		1,
+		inbuf,
+		(C.size_t)(len(params)),
+		&outbuf,
+		&outbuflen,
+		&outsbuf,
+		&outslen)
+	out, outs = lib.bufferFree(outbuf, outbuflen, outsbuf, outslen)
+	if int32(ret) < 0 {
+		return out, outs, commandError("mon", cmd, ret, outs)
 	}
 
-	return nil
+	return out, outs, nil
 }
 
-func (lib *libRados) Rados_mon_command(cmd string, params []byte) (out []byte, err error) {
-	var outs (**C.char)
-	var outlen (*C.size_t)
+func (lib *libRados) Rados_mgr_command(cmd string, params []byte) (out []byte, outs string, err error) {
+	ccmd, inbuf, free := commandArgs(cmd, params)
+	defer free()
 
-	err1 := C.rados_mon_command(lib.cluster,
-		(**C.char)(unsafe.Pointer(&cmd)),
-		(C.size_t)(len([]byte(cmd))),
-		(*C.char)(unsafe.Pointer(&params)),
+	var outbuf, outsbuf *C.char
+	var outbuflen, outslen C.size_t
+	ret := C.rados_mgr_command(lib.cluster,
+		&ccmd,
+		1,
+		inbuf,
 		(C.size_t)(len(params)),
-		(**C.char)(unsafe.Pointer(&out)),
-		(*C.size_t)(unsafe.Pointer(uintptr(len(out)))),
-		outs,
-		outlen)
-	if int32(err1) < 0 {
-		return out, errors.New("mon command execute fail " + fmt.Sprintf("%v", err1))
+		&outbuf,
+		&outbuflen,
+		&outsbuf,
+		&outslen)
+	out, outs = lib.bufferFree(outbuf, outbuflen, outsbuf, outslen)
+	if int32(ret) < 0 {
+		return out, outs, commandError("mgr", cmd, ret, outs)
 	}
 
-	return out, nil
+	return out, outs, nil
 }
 
-//func (lib *libRados) Rados_mgr_command(cmd string, params []byte) (out []byte, err error) {
-//	var outs (**C.char)
-//	var outlen (*C.size_t)
-//
-//	err1 := C.rados_mgr_command(lib.cluster,
-//		(**C.char)(unsafe.Pointer(&cmd)),
-//		(C.size_t)(len([]byte(cmd))),
-//		(*C.char)(unsafe.Pointer(&params)),
-//		(C.size_t)(len(params)),
-//		(**C.char)(unsafe.Pointer(&out)),
-//		(*C.size_t)(unsafe.Pointer(uintptr(len(out)))),
-//		outs,
-//		outlen)
-//	if int32(err1) < 0 {
-//		return out, errors.New("mgr command execute fail " + fmt.Sprintf("%v", err1))
-//	}
-//
-//	return out, nil
-//}
+func (lib *libRados) Rados_osd_command(osdId int, cmd string, params []byte) (out []byte, outs string, err error) {
+	ccmd, inbuf, free := commandArgs(cmd, params)
+	defer free()
 
-func (lib *libRados) Rados_buffer_free() {
+	var outbuf, outsbuf *C.char
+	var outbuflen, outslen C.size_t
+	ret := C.rados_osd_command(lib.cluster,
+		(C.int)(osdId),
+		&ccmd,
+		1,
+		inbuf,
+		(C.size_t)(len(params)),
+		&outbuf,
+		&outbuflen,
+		&outsbuf,
+		&outslen)
+	out, outs = lib.bufferFree(outbuf, outbuflen, outsbuf, outslen)
+	if int32(ret) < 0 {
+		return out, outs, commandError("osd", cmd, ret, outs)
+	}
 
+	return out, outs, nil
 }
 
-func (lib *libRados) Rados_osd_command(osdId int, cmd string, params []byte) (out []byte, err error) {
-	var outs (**C.char)
-	var outlen (*C.size_t)
-
-	err1 := C.rados_osd_command(lib.cluster,
-		(C.int)(osdId),
-		(**C.char)(unsafe.Pointer(&cmd)),
-		(C.size_t)(len([]byte(cmd))),
-		(*C.char)(unsafe.Pointer(&params)),
+func (lib *libRados) Rados_pg_command(pgstr string, cmd string, params []byte) (out []byte, outs string, err error) {
+	ccmd, inbuf, free := commandArgs(cmd, params)
+	defer free()
+	cpg := C.CString(pgstr)
+	defer C.free(unsafe.Pointer(cpg))
+
+	var outbuf, outsbuf *C.char
+	var outbuflen, outslen C.size_t
+	ret := C.rados_pg_command(lib.cluster,
+		cpg,
+		&ccmd,
+		1,
+		inbuf,
 		(C.size_t)(len(params)),
-		(**C.char)(unsafe.Pointer(&out)),
-		(*C.size_t)(unsafe.Pointer(uintptr(len(out)))),
-		outs,
-		outlen)
-	if int32(err1) < 0 {
-		return out, errors.New("osd command execute fail " + fmt.Sprintf("%v", err1))
+		&outbuf,
+		&outbuflen,
+		&outsbuf,
+		&outslen)
+	out, outs = lib.bufferFree(outbuf, outbuflen, outsbuf, outslen)
+	if int32(ret) < 0 {
+		return out, outs, commandError("pg", cmd, ret, outs)
 	}
 
-	return out, nil
+	return out, outs, nil
 }
 
-func (lib *libRados) Rados_pg_command(pgstr string, cmd string, params []byte) (out []byte, err error) {
-	var outs (**C.char)
-	var outlen (*C.size_t)
+// 不一致对象只能通过librados的C++接口获取，见radosInconsistent.cc
+func (lib *libRados) Rados_pg_inconsistent_objects(pgstr string) (objects []InconsistentObject, err error) {
+	cpg := C.CString(pgstr)
+	defer C.free(unsafe.Pointer(cpg))
 
-	err1 := C.rados_pg_command(lib.cluster,
-		(*C.char)(unsafe.Pointer(&pgstr)),
-		(**C.char)(unsafe.Pointer(&cmd)),
-		(C.size_t)(len([]byte(cmd))),
-		(*C.char)(unsafe.Pointer(&params)),
-		(C.size_t)(len(params)),
-		(**C.char)(unsafe.Pointer(&out)),
-		(*C.size_t)(unsafe.Pointer(uintptr(len(out)))),
-		outs,
-		outlen)
-	if int32(err1) < 0 {
-		return out, errors.New("pg command execute fail " + fmt.Sprintf("%v", err1))
+	var out *C.char
+	var outlen C.size_t
+	ret := C.rados_pg_inconsistent_objects_json(lib.cluster, cpg, &out, &outlen)
+	if ret < 0 {
+		return nil, errors.New("cannot list inconsistent objects of pg[" + pgstr + "] " + fmt.Sprintf("%v", ret))
 	}
-
-	return out, nil
+	defer C.free(unsafe.Pointer(out))
+	return decodeInconsistentObjects(pgstr, C.GoBytes(unsafe.Pointer(out), C.int(outlen)))
 }
 
 func (lib *libRados) Rados_monitor_log() error {
@@ -416,45 +662,232 @@ func (lib *libRados) Rados_monitor_log2() error {
 	return nil
 }
 
-func (lib *libRados) Rados_pool_list() (out []byte, err error) {
+// 使用独立的io上下文读取存储池统计，不影响当前io上下文
+func (lib *libRados) Rados_pool_stat(pool_name string) (stat PoolStat, err error) {
+	if err := checkPoolName(pool_name); err != nil {
+		return stat, err
+	}
+	cname := C.CString(pool_name)
+	defer C.free(unsafe.Pointer(cname))
+	var io C.rados_ioctx_t
+	ret := C.rados_ioctx_create(lib.cluster, cname, &io)
+	if int32(ret) < 0 {
+		return stat, errors.New("cannot open rados pool[" + pool_name + "] " + fmt.Sprintf("%v", ret))
+	}
+	defer C.rados_ioctx_destroy(io)
 
-	return
+	var cstat C.struct_rados_pool_stat_t
+	ret = C.rados_ioctx_pool_stat(io, &cstat)
+	if int32(ret) < 0 {
+		return stat, errors.New("cannot stat pool[" + pool_name + "] " + fmt.Sprintf("%v", ret))
+	}
+	stat = PoolStat{
+		NumBytes:                   uint64(cstat.num_bytes),
+		NumKb:                      uint64(cstat.num_kb),
+		NumObjects:                 uint64(cstat.num_objects),
+		NumObjectClones:            uint64(cstat.num_object_clones),
+		NumObjectCopies:            uint64(cstat.num_object_copies),
+		NumObjectsMissingOnPrimary: uint64(cstat.num_objects_missing_on_primary),
+		NumObjectsUnfound:          uint64(cstat.num_objects_unfound),
+		NumObjectsDegraded:         uint64(cstat.num_objects_degraded),
+		NumRd:                      uint64(cstat.num_rd),
+		NumRdKb:                    uint64(cstat.num_rd_kb),
+		NumWr:                      uint64(cstat.num_wr),
+		NumWrKb:                    uint64(cstat.num_wr_kb),
+	}
+	return stat, nil
+}
+
+func (lib *libRados) Rados_pool_list() (pools []Pool, err error) {
+	out, _, err := lib.Rados_mon_command(NewCommand("osd dump").String(), nil)
+	if err != nil {
+		return nil, errors.New("cannot list pools " + err.Error())
+	}
+	return parseOsdDumpPools(out)
+}
+
+func (lib *libRados) Rados_pool_create(pool_name string, opts PoolCreateOptions) error {
+	if err := checkPoolName(pool_name); err != nil {
+		return err
+	}
+	if err := opts.check(); err != nil {
+		return err
+	}
+	cmd := NewCommand("osd pool create").
+		Set("pool", pool_name).
+		Set("pg_num", opts.PgNum).
+		Set("pgp_num", opts.PgNum).
+		Set("pool_type", POOL_TYPE_REPLICATED)
+	if opts.CrushRule != "" {
+		cmd.Set("rule", opts.CrushRule)
+	}
+	if _, _, err := lib.Rados_mon_command(cmd.String(), nil); err != nil {
+		return errors.New("cannot create pool[" + pool_name + "] " + err.Error())
+	}
+	if opts.Size > 0 {
+		cmd := NewCommand("osd pool set").
+			Set("pool", pool_name).
+			Set("var", "size").
+			Set("val", fmt.Sprintf("%d", opts.Size))
+		_, _, err := lib.Rados_mon_command(cmd.String(), nil)
+		if err != nil {
+			return errors.New("cannot set size of pool[" + pool_name + "] " + err.Error())
+		}
+	}
+	return nil
 }
 
-func (lib *libRados) Rados_pool_delete(pool_name string) error {
+func (lib *libRados) Rados_pool_delete(pool_name string, confirm string) error {
+	if err := checkPoolDelete(pool_name, confirm); err != nil {
+		return err
+	}
+	cname := C.CString(pool_name)
+	defer C.free(unsafe.Pointer(cname))
+	err := C.rados_pool_delete(lib.cluster, cname)
+	if int32(err) < 0 {
+		return errors.New("cannot delete pool[" + pool_name + "] " + fmt.Sprintf("%v", err))
+	}
+	return nil
+}
+
+func (lib *libRados) Rados_pool_get_quota(pool_name string) (quota PoolQuota, err error) {
+	if err := checkPoolName(pool_name); err != nil {
+		return quota, err
+	}
+	out, _, err := lib.Rados_mon_command(NewCommand("osd pool get-quota").Set("pool", pool_name).String(), nil)
+	if err != nil {
+		return quota, errors.New("cannot get quota of pool[" + pool_name + "] " + err.Error())
+	}
+	return parsePoolQuota(out)
+}
+
+func (lib *libRados) Rados_pool_set_quota(pool_name string, quota PoolQuota) error {
+	if err := checkPoolName(pool_name); err != nil {
+		return err
+	}
+	fields := map[string]uint64{
+		"max_objects": quota.MaxObjects,
+		"max_bytes":   quota.MaxBytes,
+	}
+	for field, val := range fields {
+		cmd := NewCommand("osd pool set-quota").
+			Set("pool", pool_name).
+			Set("field", field).
+			Set("val", fmt.Sprintf("%d", val))
+		_, _, err := lib.Rados_mon_command(cmd.String(), nil)
+		if err != nil {
+			return errors.New("cannot set " + field + " quota of pool[" + pool_name + "] " + err.Error())
+		}
+	}
 	return nil
 }
 
 func (lib *libRados) Rados_ioctx_snap_create(snapname string) error {
+	csnap := C.CString(snapname)
+	defer C.free(unsafe.Pointer(csnap))
+	err := C.rados_ioctx_snap_create(lib.io, csnap)
+	if int32(err) < 0 {
+		return errors.New("cannot create snapshot[" + snapname + "] " + fmt.Sprintf("%v", err))
+	}
 	return nil
 }
 
 func (lib *libRados) Rados_ioctx_snap_remove(snapname string) error {
+	csnap := C.CString(snapname)
+	defer C.free(unsafe.Pointer(csnap))
+	err := C.rados_ioctx_snap_remove(lib.io, csnap)
+	if int32(err) < 0 {
+		return errors.New("cannot remove snapshot[" + snapname + "] " + fmt.Sprintf("%v", err))
+	}
 	return nil
 }
 
+// 将对象回滚到快照
 func (lib *libRados) Rados_ioctx_snap_rollback(snapname string, key string) error {
+	csnap := C.CString(snapname)
+	defer C.free(unsafe.Pointer(csnap))
+	ckey := C.CString(key)
+	defer C.free(unsafe.Pointer(ckey))
+	err := C.rados_ioctx_snap_rollback(lib.io, ckey, csnap)
+	if int32(err) < 0 {
+		return errors.New("cannot rollback object[" + key + "] " + fmt.Sprintf("%v", err))
+	}
 	return nil
 }
 
 func (lib *libRados) Rados_rollback(snapname string, key string) error {
-	return nil
+	return lib.Rados_ioctx_snap_rollback(snapname, key)
 }
 
-func (lib *libRados) Rados_ioctx_snap_set_read(snap C.rados_snap_t) error {
+// 之后的读操作读取快照数据，SNAP_HEAD表示读取最新数据
+func (lib *libRados) Rados_ioctx_snap_set_read(snap uint64) error {
+	C.rados_ioctx_snap_set_read(lib.io, C.rados_snap_t(snap))
+	lib.snapshot = C.rados_snap_t(snap)
 	return nil
 }
 
-func (lib *libRados) Rados_ioctx_snap_list(snaps *C.rados_snap_t) (out []byte, err error) {
-	return
+func (lib *libRados) Rados_ioctx_snap_lookup(snapname string) (uint64, error) {
+	csnap := C.CString(snapname)
+	defer C.free(unsafe.Pointer(csnap))
+	var id C.rados_snap_t
+	err := C.rados_ioctx_snap_lookup(lib.io, csnap, &id)
+	if int32(err) < 0 {
+		return 0, errors.New("cannot lookup snapshot[" + snapname + "] " + fmt.Sprintf("%v", err))
+	}
+	return uint64(id), nil
 }
 
-func (lib *libRados) Rados_cluster_stat() error {
-	err := C.rados_cluster_stat(lib.cluster, &lib.Stat)
-	if int32(err) < 0 {
-		return errors.New("read cluster stat error " + fmt.Sprintf("%v", err))
+func (lib *libRados) Rados_ioctx_snap_list() (snaps []PoolSnap, err error) {
+	// 缓冲区不足时返回-ERANGE，扩大后重试
+	maxlen := 16
+	var ids []C.rados_snap_t
+	for {
+		ids = make([]C.rados_snap_t, maxlen)
+		ret := C.rados_ioctx_snap_list(lib.io, &ids[0], C.int(maxlen))
+		if int32(ret) == -C.ERANGE {
+			maxlen *= 2
+			continue
+		}
+		if int32(ret) < 0 {
+			return nil, errors.New("cannot list snapshots " + fmt.Sprintf("%v", ret))
+		}
+		ids = ids[:int(ret)]
+		break
 	}
-	return nil
+
+	snaps = []PoolSnap{}
+	name := make([]byte, 512)
+	for _, id := range ids {
+		ret := C.rados_ioctx_snap_get_name(lib.io, id, (*C.char)(unsafe.Pointer(&name[0])), C.int(len(name)))
+		if int32(ret) < 0 {
+			return nil, errors.New("cannot get snapshot name " + fmt.Sprintf("%v", ret))
+		}
+		var stamp C.time_t
+		ret = C.rados_ioctx_snap_get_stamp(lib.io, id, &stamp)
+		if int32(ret) < 0 {
+			return nil, errors.New("cannot get snapshot stamp " + fmt.Sprintf("%v", ret))
+		}
+		snaps = append(snaps, PoolSnap{
+			Id:    uint64(id),
+			Name:  C.GoString((*C.char)(unsafe.Pointer(&name[0]))),
+			Stamp: time.Unix(int64(stamp), 0),
+		})
+	}
+	return snaps, nil
+}
+
+func (lib *libRados) Rados_cluster_stat() (stat ClusterStat, err error) {
+	ret := C.rados_cluster_stat(lib.cluster, &lib.Stat)
+	if int32(ret) < 0 {
+		return stat, errors.New("read cluster stat error " + fmt.Sprintf("%v", ret))
+	}
+	stat = ClusterStat{
+		Kb:         uint64(lib.Stat.kb),
+		KbUsed:     uint64(lib.Stat.kb_used),
+		KbAvail:    uint64(lib.Stat.kb_avail),
+		NumObjects: uint64(lib.Stat.num_objects),
+	}
+	return stat, nil
 }
 
 func (lib *libRados) Rados_version() (major int, minor int, extra int) {
@@ -462,14 +895,170 @@ func (lib *libRados) Rados_version() (major int, minor int, extra int) {
 	return
 }
 
-func (lib *libRados) Rados_stat() {
+// 加锁的公共参数，duration为0时传NULL表示不过期
+func lockArgs(object_name string, lock_name string, opts LockOptions) (oid *C.char, name *C.char, cookie *C.char, desc *C.char, duration *C.struct_timeval, flags C.uint8_t, free func()) {
+	oid = C.CString(object_name)
+	name = C.CString(lock_name)
+	cookie = C.CString(opts.Cookie)
+	desc = C.CString(opts.Description)
+	if opts.Duration > 0 {
+		duration = (*C.struct_timeval)(C.malloc(C.size_t(unsafe.Sizeof(C.struct_timeval{}))))
+		duration.tv_sec = C.time_t(opts.Duration / time.Second)
+		duration.tv_usec = C.suseconds_t((opts.Duration % time.Second) / time.Microsecond)
+	}
+	if opts.Renew {
+		flags = C.LIBRADOS_LOCK_FLAG_RENEW
+	}
+	free = func() {
+		C.free(unsafe.Pointer(oid))
+		C.free(unsafe.Pointer(name))
+		C.free(unsafe.Pointer(cookie))
+		C.free(unsafe.Pointer(desc))
+		if duration != nil {
+			C.free(unsafe.Pointer(duration))
+		}
+	}
+	return
+}
 
+func (lib *libRados) Rados_lock_exclusive(object_name string, lock_name string, opts LockOptions) error {
+	if err := checkLockName(lock_name); err != nil {
+		return err
+	}
+	oid, name, cookie, desc, duration, flags, free := lockArgs(object_name, lock_name, opts)
+	defer free()
+	ret := C.rados_lock_exclusive(lib.io, oid, name, cookie, desc, duration, flags)
+	if int32(ret) < 0 {
+		return errors.New("cannot lock object[" + object_name + "] exclusive[" + lock_name + "] " + fmt.Sprintf("%v", ret))
+	}
+	return nil
+}
+
+func (lib *libRados) Rados_lock_shared(object_name string, lock_name string, opts LockOptions) error {
+	if err := checkLockName(lock_name); err != nil {
+		return err
+	}
+	oid, name, cookie, desc, duration, flags, free := lockArgs(object_name, lock_name, opts)
+	defer free()
+	ctag := C.CString(opts.Tag)
+	defer C.free(unsafe.Pointer(ctag))
+	ret := C.rados_lock_shared(lib.io, oid, name, cookie, ctag, desc, duration, flags)
+	if int32(ret) < 0 {
+		return errors.New("cannot lock object[" + object_name + "] shared[" + lock_name + "] " + fmt.Sprintf("%v", ret))
+	}
+	return nil
 }
 
-func (lib *libRados) Rados_lock_shared() error {
+func (lib *libRados) Rados_unlock(object_name string, lock_name string, cookie string) error {
+	oid := C.CString(object_name)
+	defer C.free(unsafe.Pointer(oid))
+	name := C.CString(lock_name)
+	defer C.free(unsafe.Pointer(name))
+	ccookie := C.CString(cookie)
+	defer C.free(unsafe.Pointer(ccookie))
+	ret := C.rados_unlock(lib.io, oid, name, ccookie)
+	if int32(ret) < 0 {
+		return errors.New("cannot unlock object[" + object_name + "] lock[" + lock_name + "] " + fmt.Sprintf("%v", ret))
+	}
 	return nil
 }
 
-func (lib *libRados) Raods_unlock() error {
+// C接口没有列出锁名称的函数，调用cls_lock的list_locks方法
+func (lib *libRados) Rados_list_locks(object_name string) (names []string, err error) {
+	oid := C.CString(object_name)
+	defer C.free(unsafe.Pointer(oid))
+	cls := C.CString("lock")
+	defer C.free(unsafe.Pointer(cls))
+	method := C.CString("list_locks")
+	defer C.free(unsafe.Pointer(method))
+	for size := 4096; ; size *= 2 {
+		buf := make([]byte, size)
+		ret := C.rados_exec(lib.io, oid, cls, method, nil, 0, dataPtr(buf), C.size_t(size))
+		if int32(ret) == -C.ERANGE && size < OBJECT_STREAM_CHUNK {
+			continue
+		}
+		if int32(ret) < 0 {
+			return nil, errors.New("cannot list locks on object[" + object_name + "] " + fmt.Sprintf("%v", ret))
+		}
+		return decodeLockList(buf[:int(ret)])
+	}
+}
+
+// 以\0分隔的字符串
+func splitCStrings(buf []byte, count int) []string {
+	items := make([]string, 0, count)
+	for len(items) < count && len(buf) > 0 {
+		end := bytes.IndexByte(buf, 0)
+		if end < 0 {
+			end = len(buf)
+		}
+		items = append(items, string(buf[:end]))
+		if end == len(buf) {
+			break
+		}
+		buf = buf[end+1:]
+	}
+	for len(items) < count {
+		items = append(items, "")
+	}
+	return items
+}
+
+// 缓冲区不足时返回-ERANGE并更新为所需长度
+func (lib *libRados) Rados_list_lockers(object_name string, lock_name string) (info LockInfo, err error) {
+	oid := C.CString(object_name)
+	defer C.free(unsafe.Pointer(oid))
+	name := C.CString(lock_name)
+	defer C.free(unsafe.Pointer(name))
+
+	tagLen, clientsLen, cookiesLen, addrsLen := C.size_t(256), C.size_t(1024), C.size_t(1024), C.size_t(1024)
+	for {
+		tag := make([]byte, tagLen)
+		clients := make([]byte, clientsLen)
+		cookies := make([]byte, cookiesLen)
+		addrs := make([]byte, addrsLen)
+		var exclusive C.int
+		ret := C.rados_list_lockers(lib.io, oid, name, &exclusive,
+			dataPtr(tag), &tagLen, dataPtr(clients), &clientsLen,
+			dataPtr(cookies), &cookiesLen, dataPtr(addrs), &addrsLen)
+		if int32(ret) == -C.ERANGE {
+			continue
+		}
+		if int32(ret) < 0 {
+			return info, errors.New("cannot list lockers on object[" + object_name + "] lock[" + lock_name + "] " + fmt.Sprintf("%v", ret))
+		}
+		count := int(ret)
+		info = LockInfo{
+			Name:    lock_name,
+			Type:    LOCK_SHARED,
+			Tag:     splitCStrings(tag[:tagLen], 1)[0],
+			Lockers: []Locker{},
+		}
+		if exclusive != 0 {
+			info.Type = LOCK_EXCLUSIVE
+		}
+		c := splitCStrings(clients[:clientsLen], count)
+		k := splitCStrings(cookies[:cookiesLen], count)
+		a := splitCStrings(addrs[:addrsLen], count)
+		for i := 0; i < count; i++ {
+			info.Lockers = append(info.Lockers, Locker{Client: c[i], Cookie: k[i], Address: a[i]})
+		}
+		return info, nil
+	}
+}
+
+func (lib *libRados) Rados_break_lock(object_name string, lock_name string, client string, cookie string) error {
+	oid := C.CString(object_name)
+	defer C.free(unsafe.Pointer(oid))
+	name := C.CString(lock_name)
+	defer C.free(unsafe.Pointer(name))
+	cclient := C.CString(client)
+	defer C.free(unsafe.Pointer(cclient))
+	ccookie := C.CString(cookie)
+	defer C.free(unsafe.Pointer(ccookie))
+	ret := C.rados_break_lock(lib.io, oid, name, cclient, ccookie)
+	if int32(ret) < 0 {
+		return errors.New("cannot break lock[" + lock_name + "] of " + client + " on object[" + object_name + "] " + fmt.Sprintf("%v", ret))
+	}
 	return nil
 }
@@ -0,0 +1,130 @@
+//go:build rados
+// +build rados
+
+package ceph
+
+// 异步IO，每个操作使用独立的completion，回调通过cgo.Handle找到对应的AioFuture
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+#include <rados/librados.h>
+
+extern void goAioComplete(rados_completion_t c, void *arg);
+extern void goAioSafe(rados_completion_t c, void *arg);
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"runtime/cgo"
+	"unsafe"
+)
+
+type radosAio struct {
+	future *AioFuture
+	comp   C.rados_completion_t
+	arg    unsafe.Pointer // 保存handle的C内存，作为回调参数
+	buf    unsafe.Pointer // 读取使用的C内存
+	handle cgo.Handle
+}
+
+func aioFromArg(arg unsafe.Pointer) *radosAio {
+	return cgo.Handle(*(*C.uintptr_t)(arg)).Value().(*radosAio)
+}
+
+//export goAioComplete
+func goAioComplete(c C.rados_completion_t, arg unsafe.Pointer) {
+	aio := aioFromArg(arg)
+	ret := int(C.rados_aio_get_return_value(c))
+	var data []byte
+	if aio.buf != nil && ret > 0 {
+		data = C.GoBytes(aio.buf, C.int(ret))
+	}
+	aio.future.setComplete(ret, data)
+}
+
+//export goAioSafe
+func goAioSafe(c C.rados_completion_t, arg unsafe.Pointer) {
+	aioFromArg(arg).future.setSafe()
+}
+
+func (aio *radosAio) free() {
+	if aio.comp != nil {
+		C.rados_aio_release(aio.comp)
+	}
+	if aio.buf != nil {
+		C.free(aio.buf)
+	}
+	C.free(aio.arg)
+	aio.handle.Delete()
+}
+
+// 创建completion并提交操作，size大于0时分配读取缓冲区
+func (lib *libRados) aio(op string, object_name string, size uint, submit func(comp C.rados_completion_t, oid *C.char, buf *C.char) C.int) (*AioFuture, error) {
+	aio := &radosAio{}
+	aio.handle = cgo.NewHandle(aio)
+	aio.arg = C.malloc(C.size_t(unsafe.Sizeof(C.uintptr_t(0))))
+	*(*C.uintptr_t)(aio.arg) = C.uintptr_t(aio.handle)
+	if size > 0 {
+		aio.buf = C.malloc(C.size_t(size))
+	}
+	aio.future = newAioFuture(op, object_name, aio.free)
+
+	ret := C.rados_aio_create_completion(aio.arg, (C.rados_callback_t)(C.goAioComplete), (C.rados_callback_t)(C.goAioSafe), &aio.comp)
+	if int32(ret) < 0 {
+		aio.comp = nil
+		aio.free()
+		return nil, errors.New("cannot create aio completion " + fmt.Sprintf("%v", ret))
+	}
+	oid := C.CString(object_name)
+	defer C.free(unsafe.Pointer(oid))
+	// 提交失败时不会有回调
+	ret = submit(aio.comp, oid, (*C.char)(aio.buf))
+	if int32(ret) < 0 {
+		aio.free()
+		return nil, errors.New("cannot schedule aio " + op + " object[" + object_name + "] " + fmt.Sprintf("%v", ret))
+	}
+	return aio.future, nil
+}
+
+// 写入的数据在提交时已被librados复制
+func (lib *libRados) Rados_aio_write(object_name string, value []byte, offset uint64) (*AioFuture, error) {
+	return lib.aio("write", object_name, 0, func(comp C.rados_completion_t, oid *C.char, buf *C.char) C.int {
+		return C.rados_aio_write(lib.io, oid, comp, dataPtr(value), C.size_t(len(value)), C.uint64_t(offset))
+	})
+}
+
+func (lib *libRados) Rados_aio_write_full(object_name string, value []byte) (*AioFuture, error) {
+	return lib.aio("write_full", object_name, 0, func(comp C.rados_completion_t, oid *C.char, buf *C.char) C.int {
+		return C.rados_aio_write_full(lib.io, oid, comp, dataPtr(value), C.size_t(len(value)))
+	})
+}
+
+func (lib *libRados) Rados_aio_append(object_name string, value []byte) (*AioFuture, error) {
+	return lib.aio("append", object_name, 0, func(comp C.rados_completion_t, oid *C.char, buf *C.char) C.int {
+		return C.rados_aio_append(lib.io, oid, comp, dataPtr(value), C.size_t(len(value)))
+	})
+}
+
+// 读取的数据在完成回调中复制，可通过AioFuture.Data获取
+func (lib *libRados) Rados_aio_read(object_name string, size uint, offset uint64) (*AioFuture, error) {
+	return lib.aio("read", object_name, size, func(comp C.rados_completion_t, oid *C.char, buf *C.char) C.int {
+		return C.rados_aio_read(lib.io, oid, comp, buf, C.size_t(size), C.uint64_t(offset))
+	})
+}
+
+func (lib *libRados) Rados_aio_remove(object_name string) (*AioFuture, error) {
+	return lib.aio("remove", object_name, 0, func(comp C.rados_completion_t, oid *C.char, buf *C.char) C.int {
+		return C.rados_aio_remove(lib.io, oid, comp)
+	})
+}
+
+func (lib *libRados) Rados_aio_flush() error {
+	err := C.rados_aio_flush(lib.io)
+	if int32(err) < 0 {
+		return errors.New("flush to disk error " + fmt.Sprintf("%v", err))
+	}
+	return nil
+}
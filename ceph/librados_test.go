@@ -1,3 +1,6 @@
+//go:build rados
+// +build rados
+
 package ceph
 
 import "testing"
@@ -26,11 +29,11 @@ func TestNewLibRados(t *testing.T) {
 	}
 	t.Log("create io context")
 
-	err = librados.Rados_cluster_stat()
+	stat, err := librados.Rados_cluster_stat()
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
-	t.Logf("%v", librados.Stat)
+	t.Logf("%v", stat)
 
 	major, minor, extra := librados.Rados_version()
 	t.Logf("major %d minor %d extra %d", major, minor, extra)
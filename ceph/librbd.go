@@ -1,13 +1,246 @@
 package ceph
 
+// 块设备
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// 镜像特性，与RBD_FEATURE_*一致
+const (
+	RBD_FEATURE_LAYERING       uint64 = 1 << 0
+	RBD_FEATURE_STRIPINGV2     uint64 = 1 << 1
+	RBD_FEATURE_EXCLUSIVE_LOCK uint64 = 1 << 2
+	RBD_FEATURE_OBJECT_MAP     uint64 = 1 << 3
+	RBD_FEATURE_FAST_DIFF      uint64 = 1 << 4
+	RBD_FEATURE_DEEP_FLATTEN   uint64 = 1 << 5
+	RBD_FEATURE_JOURNALING     uint64 = 1 << 6
+	RBD_FEATURE_DATA_POOL      uint64 = 1 << 7
+
+	// 与rbd_default_features的默认值一致
+	RBD_DEFAULT_FEATURES = RBD_FEATURE_LAYERING | RBD_FEATURE_EXCLUSIVE_LOCK | RBD_FEATURE_OBJECT_MAP | RBD_FEATURE_FAST_DIFF | RBD_FEATURE_DEEP_FLATTEN
+)
+
+const (
+	RBD_DEFAULT_ORDER = 22 // 对象大小4MiB
+	RBD_MIN_ORDER     = 12
+	RBD_MAX_ORDER     = 25
+)
+
+var rbdFeatures = []struct {
+	bit  uint64
+	name string
+}{
+	{RBD_FEATURE_LAYERING, "layering"},
+	{RBD_FEATURE_STRIPINGV2, "striping"},
+	{RBD_FEATURE_EXCLUSIVE_LOCK, "exclusive-lock"},
+	{RBD_FEATURE_OBJECT_MAP, "object-map"},
+	{RBD_FEATURE_FAST_DIFF, "fast-diff"},
+	{RBD_FEATURE_DEEP_FLATTEN, "deep-flatten"},
+	{RBD_FEATURE_JOURNALING, "journaling"},
+	{RBD_FEATURE_DATA_POOL, "data-pool"},
+}
+
+// 特性名称，与rbd info的显示一致
+func RbdFeatureNames(features uint64) []string {
+	names := []string{}
+	for _, f := range rbdFeatures {
+		if features&f.bit != 0 {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+// 解析以逗号分隔的特性名称
+func ParseRbdFeatures(names string) (uint64, error) {
+	var features uint64
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, f := range rbdFeatures {
+			if f.name == name {
+				features |= f.bit
+				found = true
+			}
+		}
+		if !found {
+			return 0, errors.New("unknown rbd feature " + name)
+		}
+	}
+	return features, nil
+}
+
+// 0值表示使用默认值
+type RbdCreateOptions struct {
+	Order       int
+	Features    uint64
+	StripeUnit  uint64
+	StripeCount uint64
+	DataPool    string // 数据存储池，如纠删码存储池
+}
+
+// 克隆镜像的父镜像快照
+type RbdParent struct {
+	Pool      string `json:"pool"`
+	Namespace string `json:"namespace"`
+	Image     string `json:"image"`
+	Snap      string `json:"snap"`
+}
+
+type RbdImageInfo struct {
+	Name            string     `json:"name"`
+	Id              string     `json:"id"`
+	Size            uint64     `json:"size"`
+	ObjectSize      uint64     `json:"object_size"`
+	NumObjs         uint64     `json:"num_objs"`
+	Order           int        `json:"order"`
+	Features        uint64     `json:"features"`
+	FeatureNames    []string   `json:"feature_names"`
+	StripeUnit      uint64     `json:"stripe_unit"`
+	StripeCount     uint64     `json:"stripe_count"`
+	BlockNamePrefix string     `json:"block_name_prefix"`
+	CreateTime      time.Time  `json:"create_time"`
+	Parent          *RbdParent `json:"parent"`
+}
+
+// 镜像位置，用于克隆目标和子镜像列表
+type RbdImageSpec struct {
+	Pool      string `json:"pool"`
+	Namespace string `json:"namespace"`
+	Image     string `json:"image"`
+	Trash     bool   `json:"trash"` // 已移入回收站的子镜像
+}
+
+type RbdSnap struct {
+	Id        uint64    `json:"id"`
+	Name      string    `json:"name"`
+	Size      uint64    `json:"size"`
+	Protected bool      `json:"protected"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type RbdMetadata struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// 块设备操作，作用于当前io上下文的存储池和命名空间
 type LibRBD interface {
 	LibRados
+
+	Rbd_list() (names []string, err error)
+	Rbd_create(image_name string, size uint64, opts RbdCreateOptions) error
+	Rbd_remove(image_name string) error
+	Rbd_rename(src_name string, dst_name string) error
+	Rbd_resize(image_name string, size uint64, allow_shrink bool) error
+	Rbd_stat(image_name string) (info RbdImageInfo, err error)
+
+	// 镜像元数据，如conf_*覆盖客户端配置
+	Rbd_metadata_list(image_name string) (metadata []RbdMetadata, err error)
+	Rbd_metadata_get(image_name string, key string) (value string, err error)
+	Rbd_metadata_set(image_name string, key string, value string) error
+	Rbd_metadata_remove(image_name string, key string) error
+
+	// 快照，有克隆的快照需先保护，保护的快照有子镜像时不能取消保护
+	Rbd_snap_list(image_name string) (snaps []RbdSnap, err error)
+	Rbd_snap_create(image_name string, snap_name string) error
+	Rbd_snap_remove(image_name string, snap_name string) error
+	Rbd_snap_rollback(image_name string, snap_name string) error
+	Rbd_snap_protect(image_name string, snap_name string) error
+	Rbd_snap_unprotect(image_name string, snap_name string) error
+
+	// 克隆到dst，dst可以在其它存储池，opts.Order为0时与父镜像一致
+	Rbd_clone(image_name string, snap_name string, dst RbdImageSpec, opts RbdCreateOptions) error
+	Rbd_list_children(image_name string, snap_name string) (children []RbdImageSpec, err error)
+	// 复制父镜像的数据并解除与父镜像的关联
+	Rbd_flatten(image_name string) error
+
+	// 打开镜像读写数据，snap_name不为空时只读
+	Rbd_open(image_name string, snap_name string, read_only bool) (RbdImage, error)
+}
+
+// 打开的镜像，使用后需Close
+type RbdImage interface {
+	io.ReaderAt
+	io.WriterAt
+	Size() (uint64, error)
+	Resize(size uint64) error
+	// 释放区域，读取时为0
+	Discard(offset uint64, length uint64) error
+	// 与from_snap相比有变化的区域，from_snap为空时为所有已写入的区域，exists为false表示区域已被清零
+	DiffIterate(from_snap string, offset uint64, length uint64, cb func(offset uint64, length uint64, exists bool) error) error
+	Close() error
+}
+
+// 后端需同时实现LibRBD
+func NewLibRBD(rados LibRados) (LibRBD, error) {
+	rbd, ok := rados.(LibRBD)
+	if !ok {
+		return nil, errors.New("backend does not support rbd")
+	}
+	return rbd, nil
+}
+
+func checkImageName(image_name string) error {
+	if image_name == "" {
+		return errors.New("image name is empty")
+	}
+	if strings.ContainsAny(image_name, "/@") {
+		return errors.New("image name[" + image_name + "] cannot contain / or @")
+	}
+	return nil
 }
 
-type libRBD struct {
-	libRados
+func checkSnapName(snap_name string) error {
+	if snap_name == "" {
+		return errors.New("snapshot name is empty")
+	}
+	if strings.ContainsAny(snap_name, "/@") {
+		return errors.New("snapshot name[" + snap_name + "] cannot contain / or @")
+	}
+	return nil
 }
 
-func NewLibRBD() *libRBD {
-	return &libRBD{}
+// 检查创建参数并填充默认值
+func rbdCreateOptions(image_name string, size uint64, opts RbdCreateOptions) (RbdCreateOptions, error) {
+	if err := checkImageName(image_name); err != nil {
+		return opts, err
+	}
+	if opts.Order == 0 {
+		opts.Order = RBD_DEFAULT_ORDER
+	}
+	if opts.Order < RBD_MIN_ORDER || opts.Order > RBD_MAX_ORDER {
+		return opts, errors.New("order must be between 12 and 25")
+	}
+	if opts.Features == 0 {
+		opts.Features = RBD_DEFAULT_FEATURES
+	}
+	if opts.StripeUnit > 0 || opts.StripeCount > 1 {
+		objectSize := uint64(1) << uint(opts.Order)
+		if opts.StripeUnit == 0 || opts.StripeCount == 0 || objectSize%opts.StripeUnit != 0 {
+			return opts, errors.New("stripe unit must divide the object size and stripe count must be positive")
+		}
+		opts.Features |= RBD_FEATURE_STRIPINGV2
+	}
+	if opts.DataPool != "" {
+		opts.Features |= RBD_FEATURE_DATA_POOL
+	}
+	// 特性之间的依赖
+	if opts.Features&RBD_FEATURE_OBJECT_MAP != 0 && opts.Features&RBD_FEATURE_EXCLUSIVE_LOCK == 0 {
+		return opts, errors.New("object-map requires exclusive-lock")
+	}
+	if opts.Features&RBD_FEATURE_FAST_DIFF != 0 && opts.Features&RBD_FEATURE_OBJECT_MAP == 0 {
+		return opts, errors.New("fast-diff requires object-map")
+	}
+	if opts.Features&RBD_FEATURE_JOURNALING != 0 && opts.Features&RBD_FEATURE_EXCLUSIVE_LOCK == 0 {
+		return opts, errors.New("journaling requires exclusive-lock")
+	}
+	return opts, nil
 }
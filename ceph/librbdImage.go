@@ -0,0 +1,139 @@
+//go:build rados
+// +build rados
+
+package ceph
+
+// 打开的镜像，读写数据和比较快照差异
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+#include <errno.h>
+#include <rbd/librbd.h>
+
+extern int goRbdDiffCallback(uint64_t offset, size_t length, int exists, void *arg);
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime/cgo"
+	"unsafe"
+)
+
+type rbdImage struct {
+	name  string
+	image C.rbd_image_t
+}
+
+func (lib *libRados) Rbd_open(image_name string, snap_name string, read_only bool) (RbdImage, error) {
+	image, err := lib.rbdOpen(image_name, snap_name, read_only || snap_name != "")
+	if err != nil {
+		return nil, err
+	}
+	return &rbdImage{name: image_name, image: image}, nil
+}
+
+func (i *rbdImage) Size() (uint64, error) {
+	var size C.uint64_t
+	ret := C.rbd_get_size(i.image, &size)
+	if int32(ret) < 0 {
+		return 0, errors.New("cannot get size of rbd image[" + i.name + "] " + fmt.Sprintf("%v", ret))
+	}
+	return uint64(size), nil
+}
+
+func (i *rbdImage) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	ret := C.rbd_read(i.image, C.uint64_t(off), C.size_t(len(p)), (*C.char)(unsafe.Pointer(&p[0])))
+	if int64(ret) < 0 {
+		return 0, errors.New("cannot read rbd image[" + i.name + "] " + fmt.Sprintf("%v", ret))
+	}
+	// 读到镜像末尾时返回的长度小于len(p)
+	if int(ret) < len(p) {
+		return int(ret), io.EOF
+	}
+	return int(ret), nil
+}
+
+func (i *rbdImage) WriteAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	ret := C.rbd_write(i.image, C.uint64_t(off), C.size_t(len(p)), (*C.char)(unsafe.Pointer(&p[0])))
+	if int64(ret) < 0 {
+		return 0, errors.New("cannot write rbd image[" + i.name + "] " + fmt.Sprintf("%v", ret))
+	}
+	if int(ret) < len(p) {
+		return int(ret), io.ErrShortWrite
+	}
+	return int(ret), nil
+}
+
+func (i *rbdImage) Discard(offset uint64, length uint64) error {
+	ret := C.rbd_discard(i.image, C.uint64_t(offset), C.uint64_t(length))
+	if int32(ret) < 0 {
+		return errors.New("cannot discard rbd image[" + i.name + "] " + fmt.Sprintf("%v", ret))
+	}
+	return nil
+}
+
+func (i *rbdImage) Resize(size uint64) error {
+	ret := C.rbd_resize2(i.image, C.uint64_t(size), C.bool(true), nil, nil)
+	if int32(ret) < 0 {
+		return errors.New("cannot resize rbd image[" + i.name + "] " + fmt.Sprintf("%v", ret))
+	}
+	return nil
+}
+
+type rbdDiff struct {
+	cb  func(offset uint64, length uint64, exists bool) error
+	err error // 回调返回的错误
+}
+
+//export goRbdDiffCallback
+func goRbdDiffCallback(offset C.uint64_t, length C.size_t, exists C.int, arg unsafe.Pointer) C.int {
+	diff := cgo.Handle(*(*C.uintptr_t)(arg)).Value().(*rbdDiff)
+	if err := diff.cb(uint64(offset), uint64(length), exists != 0); err != nil {
+		diff.err = err
+		return -C.EINTR
+	}
+	return 0
+}
+
+// 包含父镜像的数据，克隆镜像的差异与完整镜像一致
+func (i *rbdImage) DiffIterate(from_snap string, offset uint64, length uint64, cb func(offset uint64, length uint64, exists bool) error) error {
+	var cfrom *C.char
+	if from_snap != "" {
+		cfrom = C.CString(from_snap)
+		defer C.free(unsafe.Pointer(cfrom))
+	}
+	diff := &rbdDiff{cb: cb}
+	handle := cgo.NewHandle(diff)
+	defer handle.Delete()
+	arg := C.malloc(C.size_t(unsafe.Sizeof(C.uintptr_t(0))))
+	defer C.free(arg)
+	*(*C.uintptr_t)(arg) = C.uintptr_t(handle)
+
+	ret := C.rbd_diff_iterate2(i.image, cfrom, C.uint64_t(offset), C.uint64_t(length), 1, 0,
+		(*[0]byte)(C.goRbdDiffCallback), arg)
+	if diff.err != nil {
+		return diff.err
+	}
+	if int32(ret) < 0 {
+		return errors.New("cannot diff rbd image[" + i.name + "] " + fmt.Sprintf("%v", ret))
+	}
+	return nil
+}
+
+func (i *rbdImage) Close() error {
+	ret := C.rbd_close(i.image)
+	if int32(ret) < 0 {
+		return errors.New("cannot close rbd image[" + i.name + "] " + fmt.Sprintf("%v", ret))
+	}
+	return nil
+}
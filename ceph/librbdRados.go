@@ -0,0 +1,483 @@
+//go:build rados
+// +build rados
+
+package ceph
+
+// librbd块设备，使用libRados的io上下文
+
+/*
+#cgo LDFLAGS: -lrbd
+#include <stdlib.h>
+#include <errno.h>
+#include <rbd/librbd.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+var _ LibRBD = (*libRados)(nil)
+
+// 打开镜像，snap_name为空时打开最新数据，使用完毕需调用rbd_close
+func (lib *libRados) rbdOpen(image_name string, snap_name string, read_only bool) (C.rbd_image_t, error) {
+	cname := C.CString(image_name)
+	defer C.free(unsafe.Pointer(cname))
+	var csnap *C.char
+	if snap_name != "" {
+		csnap = C.CString(snap_name)
+		defer C.free(unsafe.Pointer(csnap))
+	}
+	var image C.rbd_image_t
+	var ret C.int
+	if read_only {
+		ret = C.rbd_open_read_only(lib.io, cname, &image, csnap)
+	} else {
+		ret = C.rbd_open(lib.io, cname, &image, csnap)
+	}
+	if int32(ret) < 0 {
+		return nil, errors.New("cannot open rbd image[" + image_name + "] " + fmt.Sprintf("%v", ret))
+	}
+	return image, nil
+}
+
+func (lib *libRados) Rbd_list() (names []string, err error) {
+	size := C.size_t(64)
+	for {
+		specs := make([]C.rbd_image_spec_t, size)
+		ret := C.rbd_list2(lib.io, &specs[0], &size)
+		if int32(ret) == -C.ERANGE {
+			continue
+		}
+		if int32(ret) < 0 {
+			return nil, errors.New("cannot list rbd images " + fmt.Sprintf("%v", ret))
+		}
+		names = make([]string, 0, int(size))
+		for i := 0; i < int(size); i++ {
+			names = append(names, C.GoString(specs[i].name))
+		}
+		if size > 0 {
+			C.rbd_image_spec_list_cleanup(&specs[0], size)
+		}
+		sort.Strings(names)
+		return names, nil
+	}
+}
+
+// 镜像创建参数，order为0时不设置，克隆时与父镜像一致
+func rbdImageOptions(opts RbdCreateOptions) (copts C.rbd_image_options_t, free func()) {
+	C.rbd_image_options_create(&copts)
+	frees := []unsafe.Pointer{}
+	if opts.Order > 0 {
+		C.rbd_image_options_set_uint64(copts, C.RBD_IMAGE_OPTION_ORDER, C.uint64_t(opts.Order))
+	}
+	C.rbd_image_options_set_uint64(copts, C.RBD_IMAGE_OPTION_FEATURES, C.uint64_t(opts.Features))
+	if opts.StripeUnit > 0 {
+		C.rbd_image_options_set_uint64(copts, C.RBD_IMAGE_OPTION_STRIPE_UNIT, C.uint64_t(opts.StripeUnit))
+		C.rbd_image_options_set_uint64(copts, C.RBD_IMAGE_OPTION_STRIPE_COUNT, C.uint64_t(opts.StripeCount))
+	}
+	if opts.DataPool != "" {
+		cpool := C.CString(opts.DataPool)
+		frees = append(frees, unsafe.Pointer(cpool))
+		C.rbd_image_options_set_string(copts, C.RBD_IMAGE_OPTION_DATA_POOL, cpool)
+	}
+	return copts, func() {
+		C.rbd_image_options_destroy(copts)
+		for _, p := range frees {
+			C.free(p)
+		}
+	}
+}
+
+func (lib *libRados) Rbd_create(image_name string, size uint64, opts RbdCreateOptions) error {
+	opts, err := rbdCreateOptions(image_name, size, opts)
+	if err != nil {
+		return errors.New("cannot create rbd image[" + image_name + "] " + err.Error())
+	}
+	copts, free := rbdImageOptions(opts)
+	defer free()
+	cname := C.CString(image_name)
+	defer C.free(unsafe.Pointer(cname))
+	ret := C.rbd_create4(lib.io, cname, C.uint64_t(size), copts)
+	if int32(ret) < 0 {
+		return errors.New("cannot create rbd image[" + image_name + "] " + fmt.Sprintf("%v", ret))
+	}
+	return nil
+}
+
+func (lib *libRados) Rbd_remove(image_name string) error {
+	cname := C.CString(image_name)
+	defer C.free(unsafe.Pointer(cname))
+	ret := C.rbd_remove(lib.io, cname)
+	if int32(ret) < 0 {
+		return errors.New("cannot remove rbd image[" + image_name + "] " + fmt.Sprintf("%v", ret))
+	}
+	return nil
+}
+
+func (lib *libRados) Rbd_rename(src_name string, dst_name string) error {
+	if err := checkImageName(dst_name); err != nil {
+		return errors.New("cannot rename rbd image[" + src_name + "] " + err.Error())
+	}
+	csrc := C.CString(src_name)
+	defer C.free(unsafe.Pointer(csrc))
+	cdst := C.CString(dst_name)
+	defer C.free(unsafe.Pointer(cdst))
+	ret := C.rbd_rename(lib.io, csrc, cdst)
+	if int32(ret) < 0 {
+		return errors.New("cannot rename rbd image[" + src_name + "] to " + dst_name + " " + fmt.Sprintf("%v", ret))
+	}
+	return nil
+}
+
+func (lib *libRados) Rbd_resize(image_name string, size uint64, allow_shrink bool) error {
+	image, err := lib.rbdOpen(image_name, "", false)
+	if err != nil {
+		return err
+	}
+	defer C.rbd_close(image)
+	ret := C.rbd_resize2(image, C.uint64_t(size), C.bool(allow_shrink), nil, nil)
+	if int32(ret) < 0 {
+		return errors.New("cannot resize rbd image[" + image_name + "] " + fmt.Sprintf("%v", ret))
+	}
+	return nil
+}
+
+func (lib *libRados) Rbd_stat(image_name string) (info RbdImageInfo, err error) {
+	image, err := lib.rbdOpen(image_name, "", true)
+	if err != nil {
+		return info, err
+	}
+	defer C.rbd_close(image)
+
+	var cinfo C.rbd_image_info_t
+	ret := C.rbd_stat(image, &cinfo, C.size_t(unsafe.Sizeof(cinfo)))
+	if int32(ret) < 0 {
+		return info, errors.New("cannot stat rbd image[" + image_name + "] " + fmt.Sprintf("%v", ret))
+	}
+	var features, stripeUnit, stripeCount C.uint64_t
+	C.rbd_get_features(image, &features)
+	C.rbd_get_stripe_unit(image, &stripeUnit)
+	C.rbd_get_stripe_count(image, &stripeCount)
+	info = RbdImageInfo{
+		Name:            image_name,
+		Size:            uint64(cinfo.size),
+		ObjectSize:      uint64(cinfo.obj_size),
+		NumObjs:         uint64(cinfo.num_objs),
+		Order:           int(cinfo.order),
+		Features:        uint64(features),
+		FeatureNames:    RbdFeatureNames(uint64(features)),
+		StripeUnit:      uint64(stripeUnit),
+		StripeCount:     uint64(stripeCount),
+		BlockNamePrefix: C.GoString(&cinfo.block_name_prefix[0]),
+	}
+	id := make([]byte, 64)
+	if int32(C.rbd_get_id(image, dataPtr(id), C.size_t(len(id)))) == 0 {
+		info.Id = C.GoString(dataPtr(id))
+	}
+	var ts C.struct_timespec
+	if int32(C.rbd_get_create_timestamp(image, &ts)) == 0 {
+		info.CreateTime = time.Unix(int64(ts.tv_sec), int64(ts.tv_nsec))
+	}
+
+	// 没有父镜像时返回ENOENT
+	var parentImage C.rbd_linked_image_spec_t
+	var parentSnap C.rbd_snap_spec_t
+	ret = C.rbd_get_parent(image, &parentImage, &parentSnap)
+	if int32(ret) == 0 {
+		info.Parent = &RbdParent{
+			Pool:      C.GoString(parentImage.pool_name),
+			Namespace: C.GoString(parentImage.pool_namespace),
+			Image:     C.GoString(parentImage.image_name),
+			Snap:      C.GoString(parentSnap.name),
+		}
+		C.rbd_linked_image_spec_cleanup(&parentImage)
+		C.rbd_snap_spec_cleanup(&parentSnap)
+	} else if int32(ret) != -C.ENOENT {
+		return info, errors.New("cannot get parent of rbd image[" + image_name + "] " + fmt.Sprintf("%v", ret))
+	}
+	return info, nil
+}
+
+// 以\0分隔的字符串列表
+func splitNulList(buf []byte) []string {
+	list := strings.Split(strings.TrimRight(string(buf), "\x00"), "\x00")
+	if len(list) == 1 && list[0] == "" {
+		return []string{}
+	}
+	return list
+}
+
+// 每页读取的元数据数量，librbd不指定数量时最多返回64个
+const RBD_METADATA_PAGE = 64
+
+func (lib *libRados) Rbd_metadata_list(image_name string) (metadata []RbdMetadata, err error) {
+	image, err := lib.rbdOpen(image_name, "", true)
+	if err != nil {
+		return nil, err
+	}
+	defer C.rbd_close(image)
+
+	metadata = []RbdMetadata{}
+	keysLen, valsLen := C.size_t(4096), C.size_t(4096)
+	start := ""
+	for {
+		keys := make([]byte, keysLen)
+		vals := make([]byte, valsLen)
+		// 从start之后读取一页，缓冲区不足时返回ERANGE并更新所需长度
+		cstart := C.CString(start)
+		ret := C.rbd_metadata_list(image, cstart, RBD_METADATA_PAGE, dataPtr(keys), &keysLen, dataPtr(vals), &valsLen)
+		C.free(unsafe.Pointer(cstart))
+		if int32(ret) == -C.ERANGE {
+			continue
+		}
+		if int32(ret) < 0 {
+			return nil, errors.New("cannot list metadata of rbd image[" + image_name + "] " + fmt.Sprintf("%v", ret))
+		}
+		keyList := splitNulList(keys[:keysLen])
+		valList := splitCStrings(vals[:valsLen], len(keyList))
+		for i, key := range keyList {
+			metadata = append(metadata, RbdMetadata{Key: key, Value: valList[i]})
+		}
+		if len(keyList) < RBD_METADATA_PAGE {
+			return metadata, nil
+		}
+		start = keyList[len(keyList)-1]
+	}
+}
+
+func (lib *libRados) Rbd_metadata_get(image_name string, key string) (value string, err error) {
+	image, err := lib.rbdOpen(image_name, "", true)
+	if err != nil {
+		return "", err
+	}
+	defer C.rbd_close(image)
+
+	ckey := C.CString(key)
+	defer C.free(unsafe.Pointer(ckey))
+	size := C.size_t(4096)
+	for {
+		buf := make([]byte, size)
+		ret := C.rbd_metadata_get(image, ckey, dataPtr(buf), &size)
+		if int32(ret) == -C.ERANGE {
+			continue
+		}
+		if int32(ret) < 0 {
+			return "", errors.New("cannot get metadata[" + key + "] of rbd image[" + image_name + "] " + fmt.Sprintf("%v", ret))
+		}
+		return C.GoString(dataPtr(buf)), nil
+	}
+}
+
+func (lib *libRados) Rbd_metadata_set(image_name string, key string, value string) error {
+	image, err := lib.rbdOpen(image_name, "", false)
+	if err != nil {
+		return err
+	}
+	defer C.rbd_close(image)
+
+	ckey := C.CString(key)
+	defer C.free(unsafe.Pointer(ckey))
+	cvalue := C.CString(value)
+	defer C.free(unsafe.Pointer(cvalue))
+	ret := C.rbd_metadata_set(image, ckey, cvalue)
+	if int32(ret) < 0 {
+		return errors.New("cannot set metadata[" + key + "] of rbd image[" + image_name + "] " + fmt.Sprintf("%v", ret))
+	}
+	return nil
+}
+
+func (lib *libRados) Rbd_metadata_remove(image_name string, key string) error {
+	image, err := lib.rbdOpen(image_name, "", false)
+	if err != nil {
+		return err
+	}
+	defer C.rbd_close(image)
+
+	ckey := C.CString(key)
+	defer C.free(unsafe.Pointer(ckey))
+	ret := C.rbd_metadata_remove(image, ckey)
+	if int32(ret) < 0 {
+		return errors.New("cannot remove metadata[" + key + "] of rbd image[" + image_name + "] " + fmt.Sprintf("%v", ret))
+	}
+	return nil
+}
+
+func (lib *libRados) Rbd_snap_list(image_name string) (snaps []RbdSnap, err error) {
+	image, err := lib.rbdOpen(image_name, "", true)
+	if err != nil {
+		return nil, err
+	}
+	defer C.rbd_close(image)
+
+	max := C.int(16)
+	for {
+		infos := make([]C.rbd_snap_info_t, max)
+		ret := C.rbd_snap_list(image, &infos[0], &max)
+		if int32(ret) == -C.ERANGE {
+			continue
+		}
+		if int32(ret) < 0 {
+			return nil, errors.New("cannot list snapshots of rbd image[" + image_name + "] " + fmt.Sprintf("%v", ret))
+		}
+		snaps = make([]RbdSnap, 0, int(ret))
+		for i := 0; i < int(ret); i++ {
+			snap := RbdSnap{
+				Id:   uint64(infos[i].id),
+				Name: C.GoString(infos[i].name),
+				Size: uint64(infos[i].size),
+			}
+			cname := C.CString(snap.Name)
+			var protected C.int
+			if int32(C.rbd_snap_is_protected(image, cname, &protected)) == 0 {
+				snap.Protected = protected != 0
+			}
+			C.free(unsafe.Pointer(cname))
+			var ts C.struct_timespec
+			if int32(C.rbd_snap_get_timestamp(image, infos[i].id, &ts)) == 0 {
+				snap.Timestamp = time.Unix(int64(ts.tv_sec), int64(ts.tv_nsec))
+			}
+			snaps = append(snaps, snap)
+		}
+		C.rbd_snap_list_end(&infos[0])
+		return snaps, nil
+	}
+}
+
+// 打开镜像执行快照操作
+func (lib *libRados) rbdSnapOp(action string, image_name string, snap_name string, op func(C.rbd_image_t, *C.char) C.int) error {
+	image, err := lib.rbdOpen(image_name, "", false)
+	if err != nil {
+		return err
+	}
+	defer C.rbd_close(image)
+
+	csnap := C.CString(snap_name)
+	defer C.free(unsafe.Pointer(csnap))
+	ret := op(image, csnap)
+	if int32(ret) < 0 {
+		return errors.New("cannot " + action + " snapshot[" + snap_name + "] of rbd image[" + image_name + "] " + fmt.Sprintf("%v", ret))
+	}
+	return nil
+}
+
+func (lib *libRados) Rbd_snap_create(image_name string, snap_name string) error {
+	if err := checkSnapName(snap_name); err != nil {
+		return errors.New("cannot create snapshot of rbd image[" + image_name + "] " + err.Error())
+	}
+	return lib.rbdSnapOp("create", image_name, snap_name, func(image C.rbd_image_t, csnap *C.char) C.int {
+		return C.rbd_snap_create(image, csnap)
+	})
+}
+
+func (lib *libRados) Rbd_snap_remove(image_name string, snap_name string) error {
+	return lib.rbdSnapOp("remove", image_name, snap_name, func(image C.rbd_image_t, csnap *C.char) C.int {
+		return C.rbd_snap_remove(image, csnap)
+	})
+}
+
+func (lib *libRados) Rbd_snap_rollback(image_name string, snap_name string) error {
+	return lib.rbdSnapOp("rollback to", image_name, snap_name, func(image C.rbd_image_t, csnap *C.char) C.int {
+		return C.rbd_snap_rollback(image, csnap)
+	})
+}
+
+func (lib *libRados) Rbd_snap_protect(image_name string, snap_name string) error {
+	return lib.rbdSnapOp("protect", image_name, snap_name, func(image C.rbd_image_t, csnap *C.char) C.int {
+		return C.rbd_snap_protect(image, csnap)
+	})
+}
+
+// 快照有子镜像时librbd返回EBUSY
+func (lib *libRados) Rbd_snap_unprotect(image_name string, snap_name string) error {
+	return lib.rbdSnapOp("unprotect", image_name, snap_name, func(image C.rbd_image_t, csnap *C.char) C.int {
+		return C.rbd_snap_unprotect(image, csnap)
+	})
+}
+
+func (lib *libRados) Rbd_clone(image_name string, snap_name string, dst RbdImageSpec, opts RbdCreateOptions) error {
+	prefix := "cannot clone rbd image[" + image_name + "@" + snap_name + "] to " + dst.Pool + "/" + dst.Image + " "
+	order := opts.Order
+	opts, err := rbdCreateOptions(dst.Image, 0, opts)
+	if err != nil {
+		return errors.New(prefix + err.Error())
+	}
+	opts.Order = order
+
+	cpool := C.CString(dst.Pool)
+	defer C.free(unsafe.Pointer(cpool))
+	var cio C.rados_ioctx_t
+	ret := C.rados_ioctx_create(lib.cluster, cpool, &cio)
+	if int32(ret) < 0 {
+		return errors.New(prefix + fmt.Sprintf("%v", ret))
+	}
+	defer C.rados_ioctx_destroy(cio)
+	cns := C.CString(dst.Namespace)
+	defer C.free(unsafe.Pointer(cns))
+	C.rados_ioctx_set_namespace(cio, cns)
+
+	copts, free := rbdImageOptions(opts)
+	defer free()
+	cname := C.CString(image_name)
+	defer C.free(unsafe.Pointer(cname))
+	csnap := C.CString(snap_name)
+	defer C.free(unsafe.Pointer(csnap))
+	cdst := C.CString(dst.Image)
+	defer C.free(unsafe.Pointer(cdst))
+	ret = C.rbd_clone3(lib.io, cname, csnap, cio, cdst, copts)
+	if int32(ret) < 0 {
+		return errors.New(prefix + fmt.Sprintf("%v", ret))
+	}
+	return nil
+}
+
+func (lib *libRados) Rbd_list_children(image_name string, snap_name string) (children []RbdImageSpec, err error) {
+	image, err := lib.rbdOpen(image_name, snap_name, true)
+	if err != nil {
+		return nil, err
+	}
+	defer C.rbd_close(image)
+
+	size := C.size_t(16)
+	for {
+		specs := make([]C.rbd_linked_image_spec_t, size)
+		ret := C.rbd_list_children3(image, &specs[0], &size)
+		if int32(ret) == -C.ERANGE {
+			continue
+		}
+		if int32(ret) < 0 {
+			return nil, errors.New("cannot list children of rbd image[" + image_name + "@" + snap_name + "] " + fmt.Sprintf("%v", ret))
+		}
+		children = make([]RbdImageSpec, 0, int(size))
+		for i := 0; i < int(size); i++ {
+			children = append(children, RbdImageSpec{
+				Pool:      C.GoString(specs[i].pool_name),
+				Namespace: C.GoString(specs[i].pool_namespace),
+				Image:     C.GoString(specs[i].image_name),
+				Trash:     bool(specs[i].trash),
+			})
+		}
+		if size > 0 {
+			C.rbd_linked_image_spec_list_cleanup(&specs[0], size)
+		}
+		return children, nil
+	}
+}
+
+func (lib *libRados) Rbd_flatten(image_name string) error {
+	image, err := lib.rbdOpen(image_name, "", false)
+	if err != nil {
+		return err
+	}
+	defer C.rbd_close(image)
+	ret := C.rbd_flatten(image)
+	if int32(ret) < 0 {
+		return errors.New("cannot flatten rbd image[" + image_name + "] " + fmt.Sprintf("%v", ret))
+	}
+	return nil
+}
@@ -2,6 +2,222 @@ package ceph
 
 import "testing"
 
+func TestParseRbdFeatures(t *testing.T) {
+	features, err := ParseRbdFeatures("layering, exclusive-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if features != RBD_FEATURE_LAYERING|RBD_FEATURE_EXCLUSIVE_LOCK {
+		t.Fatalf("features %d", features)
+	}
+	names := RbdFeatureNames(RBD_DEFAULT_FEATURES)
+	if len(names) != 5 || names[0] != "layering" || names[4] != "deep-flatten" {
+		t.Fatalf("names %v", names)
+	}
+	if _, err := ParseRbdFeatures("layering,bogus"); err == nil {
+		t.Fatal("expected error for an unknown feature")
+	}
+}
+
+func TestRbdCreateOptions(t *testing.T) {
+	opts, err := rbdCreateOptions("img", 1<<30, RbdCreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Order != RBD_DEFAULT_ORDER || opts.Features != RBD_DEFAULT_FEATURES {
+		t.Fatalf("defaults %+v", opts)
+	}
+	opts, err = rbdCreateOptions("img", 1<<30, RbdCreateOptions{Features: RBD_FEATURE_LAYERING, StripeUnit: 1 << 16, StripeCount: 4, DataPool: "ec"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Features != RBD_FEATURE_LAYERING|RBD_FEATURE_STRIPINGV2|RBD_FEATURE_DATA_POOL {
+		t.Fatalf("features %d", opts.Features)
+	}
+	invalid := []RbdCreateOptions{
+		{Order: 30},
+		{Features: RBD_FEATURE_OBJECT_MAP},
+		{Features: RBD_FEATURE_LAYERING | RBD_FEATURE_EXCLUSIVE_LOCK | RBD_FEATURE_FAST_DIFF},
+		{StripeUnit: 3 << 10, StripeCount: 2},
+	}
+	for _, o := range invalid {
+		if _, err := rbdCreateOptions("img", 1<<30, o); err == nil {
+			t.Fatalf("expected %+v to be invalid", o)
+		}
+	}
+	if _, err := rbdCreateOptions("a/b", 1<<30, RbdCreateOptions{}); err == nil {
+		t.Fatal("expected error for an image name with /")
+	}
+}
+
 func TestNewLibRBD(t *testing.T) {
+	fake := newConnectedFake(t)
+	rbd, err := NewLibRBD(fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rbd.Rados_ioctx_create("rbd"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rbd.Rbd_create("vm1", 10<<30, RbdCreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rbd.Rbd_create("vm1", 1<<30, RbdCreateOptions{}); err == nil {
+		t.Fatal("expected EEXIST creating twice")
+	}
+	if err := rbd.Rbd_create("vm0", 1<<30, RbdCreateOptions{Order: 20, Features: RBD_FEATURE_LAYERING}); err != nil {
+		t.Fatal(err)
+	}
+	names, err := rbd.Rbd_list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "vm0" {
+		t.Fatalf("images %v", names)
+	}
+
+	info, err := rbd.Rbd_stat("vm0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != 1<<30 || info.ObjectSize != 1<<20 || info.NumObjs != 1024 || info.Parent != nil || info.BlockNamePrefix == "" {
+		t.Fatalf("info %+v", info)
+	}
+
+	if err := rbd.Rbd_resize("vm1", 1<<30, false); err == nil {
+		t.Fatal("expected error shrinking without allow_shrink")
+	}
+	if err := rbd.Rbd_resize("vm1", 1<<30, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := rbd.Rbd_rename("vm1", "vm0"); err == nil {
+		t.Fatal("expected EEXIST renaming onto an existing image")
+	}
+	if err := rbd.Rbd_rename("vm1", "vm2"); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := rbd.Rbd_stat("vm2"); info.Size != 1<<30 {
+		t.Fatalf("renamed %+v", info)
+	}
+
+	if err := rbd.Rbd_metadata_set("vm2", "conf_rbd_cache", "false"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rbd.Rbd_metadata_set("vm2", "owner", "ops"); err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := rbd.Rbd_metadata_list("vm2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metadata) != 2 || metadata[0].Key != "conf_rbd_cache" {
+		t.Fatalf("metadata %+v", metadata)
+	}
+	if value, err := rbd.Rbd_metadata_get("vm2", "owner"); err != nil || value != "ops" {
+		t.Fatalf("get %q %v", value, err)
+	}
+	if err := rbd.Rbd_metadata_remove("vm2", "owner"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rbd.Rbd_metadata_get("vm2", "owner"); err == nil {
+		t.Fatal("expected removed metadata to be missing")
+	}
+
+	if err := rbd.Rbd_remove("vm2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rbd.Rbd_remove("vm2"); err == nil {
+		t.Fatal("expected ENOENT removing twice")
+	}
+}
+
+func TestFakeRados_rbdClone(t *testing.T) {
+	rbd := newConnectedFake(t)
+	if err := rbd.Rados_ioctx_create("rbd"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rbd.Rbd_create("base", 1<<30, RbdCreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rbd.Rbd_snap_create("base", "gold"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rbd.Rbd_snap_create("base", "gold"); err == nil {
+		t.Fatal("expected EEXIST creating a snapshot twice")
+	}
+	dst := RbdImageSpec{Pool: "data", Namespace: "vms", Image: "vm1"}
+	if err := rbd.Rbd_clone("base", "gold", dst, RbdCreateOptions{}); err == nil {
+		t.Fatal("expected error cloning an unprotected snapshot")
+	}
+	if err := rbd.Rbd_snap_protect("base", "gold"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rbd.Rbd_clone("base", "gold", dst, RbdCreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	children, err := rbd.Rbd_list_children("base", "gold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 1 || children[0] != dst {
+		t.Fatalf("children %+v", children)
+	}
+	if err := rbd.Rbd_snap_unprotect("base", "gold"); err == nil {
+		t.Fatal("expected EBUSY unprotecting a snapshot with children")
+	}
+	if err := rbd.Rbd_snap_remove("base", "gold"); err == nil {
+		t.Fatal("expected EBUSY removing a protected snapshot")
+	}
+
+	// 父镜像改名后子镜像仍能找到父镜像
+	if err := rbd.Rbd_rename("base", "golden"); err != nil {
+		t.Fatal(err)
+	}
+	child := rbd.Rados_clone().(*fakeRados)
+	if err := child.Rados_ioctx_create("data"); err != nil {
+		t.Fatal(err)
+	}
+	child.Rados_ioctx_set_namespace("vms")
+	info, err := child.Rbd_stat("vm1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Parent == nil || *info.Parent != (RbdParent{Pool: "rbd", Image: "golden", Snap: "gold"}) || info.Order != RBD_DEFAULT_ORDER {
+		t.Fatalf("parent %+v", info.Parent)
+	}
+	if err := child.Rbd_flatten("vm1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := child.Rbd_flatten("vm1"); err == nil {
+		t.Fatal("expected error flattening an image without parent")
+	}
+	if err := rbd.Rbd_snap_unprotect("golden", "gold"); err != nil {
+		t.Fatal(err)
+	}
 
+	if err := rbd.Rbd_resize("golden", 2<<30, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := rbd.Rbd_snap_rollback("golden", "gold"); err != nil {
+		t.Fatal(err)
+	}
+	snaps, err := rbd.Rbd_snap_list("golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 1 || snaps[0].Size != 1<<30 || snaps[0].Protected {
+		t.Fatalf("snaps %+v", snaps)
+	}
+	if info, _ := rbd.Rbd_stat("golden"); info.Size != 1<<30 {
+		t.Fatalf("rollback %+v", info)
+	}
+	if err := rbd.Rbd_remove("golden"); err == nil {
+		t.Fatal("expected ENOTEMPTY removing an image with snapshots")
+	}
+	if err := rbd.Rbd_snap_remove("golden", "gold"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rbd.Rbd_remove("golden"); err != nil {
+		t.Fatal(err)
+	}
 }
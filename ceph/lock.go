@@ -0,0 +1,75 @@
+package ceph
+
+// 对象的建议锁(cls_lock)
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+const (
+	LOCK_EXCLUSIVE = "exclusive"
+	LOCK_SHARED    = "shared"
+)
+
+type LockOptions struct {
+	Cookie      string // 同一客户端的不同持有者以cookie区分
+	Tag         string // 共享锁的标签，持有者的标签必须一致
+	Description string
+	Duration    time.Duration // 0表示不过期
+	Renew       bool          // 已持有时续期，否则返回EEXIST
+}
+
+type Locker struct {
+	Client  string `json:"client"` // 如client.4123
+	Cookie  string `json:"cookie"`
+	Address string `json:"address"`
+}
+
+type LockInfo struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Tag     string   `json:"tag"`
+	Lockers []Locker `json:"lockers"`
+}
+
+func checkLockName(lock_name string) error {
+	if lock_name == "" {
+		return errors.New("lock name is empty")
+	}
+	return nil
+}
+
+// 解码cls_lock_list_locks_reply，结构为ENCODE_START头(版本、兼容版本、长度)后接list<string>
+func decodeLockList(buf []byte) ([]string, error) {
+	invalid := errors.New("cannot decode lock list")
+	if len(buf) < 6 {
+		return nil, invalid
+	}
+	length := binary.LittleEndian.Uint32(buf[2:6])
+	buf = buf[6:]
+	if uint64(length) > uint64(len(buf)) {
+		return nil, invalid
+	}
+	buf = buf[:length]
+	if len(buf) < 4 {
+		return nil, invalid
+	}
+	count := binary.LittleEndian.Uint32(buf)
+	buf = buf[4:]
+	names := []string{}
+	for i := uint32(0); i < count; i++ {
+		if len(buf) < 4 {
+			return nil, invalid
+		}
+		size := binary.LittleEndian.Uint32(buf)
+		buf = buf[4:]
+		if uint64(size) > uint64(len(buf)) {
+			return nil, invalid
+		}
+		names = append(names, string(buf[:size]))
+		buf = buf[size:]
+	}
+	return names, nil
+}
@@ -0,0 +1,87 @@
+package ceph
+
+// 强制解锁的审计记录，保存在mon的config-key中，每条记录一个键，多个面板实例共享
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	LOCK_AUDIT_PREFIX = "ceph-panel/lock-audit/"
+	LOCK_AUDIT_MAX    = 1000 // 保留的记录数
+)
+
+type LockAudit struct {
+	Time      time.Time `json:"time"`
+	Cluster   string    `json:"cluster"`
+	Pool      string    `json:"pool"`
+	Namespace string    `json:"namespace"`
+	Object    string    `json:"object"`
+	Lock      string    `json:"lock"`
+	Client    string    `json:"client"`
+	Cookie    string    `json:"cookie"`
+	Reason    string    `json:"reason"`
+	Operator  string    `json:"operator"`
+	IP        string    `json:"ip"`
+	Error     string    `json:"error"`
+}
+
+// 键按记录时间排序
+func lockAuditKey(audit LockAudit) string {
+	return LOCK_AUDIT_PREFIX + fmt.Sprintf("%020d", audit.Time.UnixNano())
+}
+
+// 所有审计记录，按时间倒序
+func (c *Commander) LockAudits() ([]LockAudit, error) {
+	values := map[string]string{}
+	if _, err := c.Mon(NewCommand("config-key dump").Set("key", LOCK_AUDIT_PREFIX), &values); err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	audits := []LockAudit{}
+	for i := len(keys) - 1; i >= 0; i-- {
+		audit := LockAudit{}
+		if err := json.Unmarshal([]byte(values[keys[i]]), &audit); err != nil {
+			return nil, errors.New("cannot decode lock audit[" + keys[i] + "]: " + err.Error())
+		}
+		audits = append(audits, audit)
+	}
+	return audits, nil
+}
+
+// 保存一条记录，超过保留数量时删除最早的记录
+func (c *Commander) AddLockAudit(audit LockAudit) error {
+	data, err := json.Marshal(audit)
+	if err != nil {
+		return err
+	}
+	if _, err := c.Mon(NewCommand("config-key set").Set("key", lockAuditKey(audit)).Set("val", string(data)), nil); err != nil {
+		return err
+	}
+	all := []string{}
+	if _, err := c.Mon(NewCommand("config-key ls"), &all); err != nil {
+		return err
+	}
+	keys := []string{}
+	for _, key := range all {
+		if strings.HasPrefix(key, LOCK_AUDIT_PREFIX) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for i := 0; i < len(keys)-LOCK_AUDIT_MAX; i++ {
+		if _, err := c.Mon(NewCommand("config-key rm").Set("key", keys[i]), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package ceph
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDecodeLockList(t *testing.T) {
+	// struct_v=1 compat=1 len=21, 2个字符串"rbd_lock"和"a"
+	buf := []byte{1, 1, 21, 0, 0, 0, 2, 0, 0, 0, 8, 0, 0, 0, 'r', 'b', 'd', '_', 'l', 'o', 'c', 'k', 1, 0, 0, 0, 'a'}
+	names, err := decodeLockList(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "rbd_lock" || names[1] != "a" {
+		t.Fatalf("names %v", names)
+	}
+	if _, err := decodeLockList(buf[:12]); err == nil {
+		t.Fatal("expected error for a truncated reply")
+	}
+}
+
+func TestFakeRados_lock(t *testing.T) {
+	rados := newConnectedFake(t)
+	if err := rados.Rados_ioctx_create("rbd"); err != nil {
+		t.Fatal(err)
+	}
+	// 同一集群的另一个客户端
+	other := NewFakeRados("ceph", "client.admin")
+	other.cluster = rados.cluster
+	other.Rados_create2(0)
+	other.Rados_connect()
+	if err := other.Rados_ioctx_create("rbd"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rados.Rados_lock_exclusive("img", "", LockOptions{}); err == nil {
+		t.Fatal("expected error for an empty lock name")
+	}
+	if err := rados.Rados_lock_exclusive("img", "rbd_lock", LockOptions{Cookie: "c1", Description: "mapped"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rados.Rados_lock_exclusive("img", "rbd_lock", LockOptions{Cookie: "c1"}); err == nil {
+		t.Fatal("expected EEXIST locking twice")
+	}
+	if err := rados.Rados_lock_exclusive("img", "rbd_lock", LockOptions{Cookie: "c1", Renew: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Rados_lock_shared("img", "rbd_lock", LockOptions{Cookie: "c2"}); err == nil {
+		t.Fatal("expected EBUSY on an exclusive lock")
+	}
+
+	names, err := rados.Rados_list_locks("img")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "rbd_lock" {
+		t.Fatalf("locks %v", names)
+	}
+	info, err := other.Rados_list_lockers("img", "rbd_lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Type != LOCK_EXCLUSIVE || len(info.Lockers) != 1 || info.Lockers[0].Client != rados.client || info.Lockers[0].Cookie != "c1" {
+		t.Fatalf("lockers %+v", info)
+	}
+
+	// 其它客户端不能解锁，只能强制解除
+	if err := other.Rados_unlock("img", "rbd_lock", "c1"); err == nil {
+		t.Fatal("expected ENOENT unlocking another client's lock")
+	}
+	if err := other.Rados_break_lock("img", "rbd_lock", rados.client, "c1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 共享锁的标签必须一致
+	if err := rados.Rados_lock_shared("img", "shared", LockOptions{Cookie: "c1", Tag: "t"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Rados_lock_shared("img", "shared", LockOptions{Cookie: "c2", Tag: "x"}); err == nil {
+		t.Fatal("expected EBUSY for a different tag")
+	}
+	if err := other.Rados_lock_shared("img", "shared", LockOptions{Cookie: "c2", Tag: "t", Duration: time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	info, _ = rados.Rados_list_lockers("img", "shared")
+	if info.Type != LOCK_SHARED || info.Tag != "t" || len(info.Lockers) != 1 {
+		t.Fatalf("expected the expired locker to be gone %+v", info)
+	}
+	if err := rados.Rados_unlock("img", "shared", "c1"); err != nil {
+		t.Fatal(err)
+	}
+	names, _ = rados.Rados_list_locks("img")
+	if len(names) != 0 {
+		t.Fatalf("locks %v", names)
+	}
+}
+
+func TestCommander_LockAudit(t *testing.T) {
+	c := NewCommander(newConnectedFake(t))
+	start := time.Unix(1700000000, 0)
+	for i := 0; i < LOCK_AUDIT_MAX+2; i++ {
+		if err := c.AddLockAudit(LockAudit{Time: start.Add(time.Duration(i) * time.Second), Object: "img", Reason: "stale"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 超出保留数量的最早记录被删除，按时间倒序返回
+	audits, err := c.LockAudits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(audits) != LOCK_AUDIT_MAX || !audits[0].Time.Equal(start.Add((LOCK_AUDIT_MAX+1)*time.Second)) {
+		t.Fatalf("audits %d %v", len(audits), audits[0].Time)
+	}
+	if last := audits[len(audits)-1]; !last.Time.Equal(start.Add(2 * time.Second)) {
+		t.Fatalf("oldest audit %v", last.Time)
+	}
+}
@@ -0,0 +1,250 @@
+package ceph
+
+// 维护窗口，升级等操作前设置一组标志，结束或到期后清除
+// 窗口保存在mon的config-key中，多个面板实例共享
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	MAINTENANCE_KEY              = "ceph-panel/maintenance"
+	MAINTENANCE_DEFAULT_DURATION = 2 * time.Hour
+	MAINTENANCE_MAX_DURATION     = 7 * 24 * time.Hour
+	MAINTENANCE_REMIND_INTERVAL  = 30 * time.Minute // 到期后的提醒间隔
+
+	MAINTENANCE_REMIND = "remind" // 到期后保留标志并定时提醒
+	MAINTENANCE_EXPIRE = "expire" // 到期后自动清除标志并结束窗口
+)
+
+// 维护时默认设置的标志，避免osd重启时触发数据迁移
+var MAINTENANCE_FLAGS = []string{"noout", "norebalance"}
+
+type Maintenance struct {
+	Reason   string              `json:"reason"`
+	User     string              `json:"user"` // 开始维护的用户
+	Flags    []string            `json:"flags"`
+	Targets  []string            `json:"targets"`   // 为空时设置集群标志，否则设置在这些osd或crush节点上
+	Preset   map[string][]string `json:"preset"`    // 开始前已设置的标志，结束时保留，集群标志的键为空字符串
+	OnExpire string              `json:"on_expire"` // remind或expire
+	Start    time.Time           `json:"start"`
+	Expire   time.Time           `json:"expire"`
+	Reminded time.Time           `json:"reminded"` // 最近一次到期提醒的时间
+}
+
+func (m *Maintenance) Overdue(now time.Time) bool {
+	return !now.Before(m.Expire)
+}
+
+// 当前的维护窗口，没有时返回nil
+func (c *Commander) Maintenance() (*Maintenance, error) {
+	values := map[string]string{}
+	if _, err := c.Mon(NewCommand("config-key dump").Set("key", MAINTENANCE_KEY), &values); err != nil {
+		return nil, err
+	}
+	value, ok := values[MAINTENANCE_KEY]
+	if !ok {
+		return nil, nil
+	}
+	m := &Maintenance{}
+	if err := json.Unmarshal([]byte(value), m); err != nil {
+		return nil, errors.New("cannot decode maintenance window: " + err.Error())
+	}
+	return m, nil
+}
+
+func (c *Commander) saveMaintenance(m *Maintenance) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = c.Mon(NewCommand("config-key set").Set("key", MAINTENANCE_KEY).Set("val", string(data)), nil)
+	return err
+}
+
+func maintenanceDuration(duration time.Duration) (time.Duration, error) {
+	if duration == 0 {
+		return MAINTENANCE_DEFAULT_DURATION, nil
+	}
+	if duration < 0 || duration > MAINTENANCE_MAX_DURATION {
+		return 0, errors.New("invalid maintenance duration " + duration.String() + ", must be in range 0~" + MAINTENANCE_MAX_DURATION.String())
+	}
+	return duration, nil
+}
+
+// 各目标上需要设置或清除的标志，不包括已预先设置的
+func (m *Maintenance) pending(target string) []string {
+	flags := []string{}
+	for _, flag := range m.Flags {
+		if !hasFlag(m.Preset[target], flag) {
+			flags = append(flags, flag)
+		}
+	}
+	return flags
+}
+
+func (c *Commander) setMaintenanceFlags(m *Maintenance) error {
+	if len(m.Targets) == 0 {
+		set := []string{}
+		for _, flag := range m.pending("") {
+			if _, err := c.OsdSetFlag(flag); err != nil {
+				// 回滚已设置的标志
+				for _, f := range set {
+					c.OsdUnsetFlag(f)
+				}
+				return err
+			}
+			set = append(set, flag)
+		}
+		return nil
+	}
+	// set-group会先检查所有目标，一次设置
+	_, err := c.OsdSetGroupFlags(m.Flags, m.Targets)
+	return err
+}
+
+// 清除窗口设置的标志，出错时继续清除其他标志并返回第一个错误
+func (c *Commander) unsetMaintenanceFlags(m *Maintenance) error {
+	var first error
+	if len(m.Targets) == 0 {
+		for _, flag := range m.pending("") {
+			if _, err := c.OsdUnsetFlag(flag); err != nil && first == nil {
+				first = err
+			}
+		}
+		return first
+	}
+	for _, target := range m.Targets {
+		flags := m.pending(target)
+		if len(flags) == 0 {
+			continue
+		}
+		if _, err := c.OsdUnsetGroupFlags(flags, []string{target}); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// 开始维护窗口，flags为空时使用MAINTENANCE_FLAGS，duration为0时使用默认时长
+func (c *Commander) MaintenanceStart(m Maintenance, duration time.Duration) (*Maintenance, error) {
+	current, err := c.Maintenance()
+	if err != nil {
+		return nil, err
+	}
+	if current != nil {
+		return nil, errors.New("maintenance window is already started by [" + current.User + "] at " + current.Start.Format(time.RFC3339))
+	}
+	if len(m.Flags) == 0 {
+		m.Flags = MAINTENANCE_FLAGS
+	}
+	valid := OSD_FLAGS
+	if len(m.Targets) > 0 {
+		valid = OSD_GROUP_FLAGS
+	}
+	if err := checkOsdFlags(m.Flags, valid); err != nil {
+		return nil, err
+	}
+	if duration, err = maintenanceDuration(duration); err != nil {
+		return nil, err
+	}
+	if m.OnExpire == "" {
+		m.OnExpire = MAINTENANCE_REMIND
+	}
+	if m.OnExpire != MAINTENANCE_REMIND && m.OnExpire != MAINTENANCE_EXPIRE {
+		return nil, errors.New("invalid maintenance on_expire [" + m.OnExpire + "], must be remind or expire")
+	}
+
+	flags, err := c.OsdFlags()
+	if err != nil {
+		return nil, err
+	}
+	m.Preset = map[string][]string{}
+	if len(m.Targets) == 0 {
+		m.Preset[""] = flags.Cluster
+	}
+	for _, target := range m.Targets {
+		if strings.HasPrefix(target, "osd.") {
+			m.Preset[target] = flags.Osds[target]
+		} else {
+			m.Preset[target] = flags.Nodes[target]
+		}
+	}
+	m.Start = time.Now()
+	m.Expire = m.Start.Add(duration)
+	m.Reminded = time.Time{}
+
+	if err := c.setMaintenanceFlags(&m); err != nil {
+		return nil, err
+	}
+	if err := c.saveMaintenance(&m); err != nil {
+		c.unsetMaintenanceFlags(&m)
+		return nil, err
+	}
+	return &m, nil
+}
+
+// 结束维护窗口并清除设置的标志
+func (c *Commander) MaintenanceEnd() (*Maintenance, error) {
+	m, err := c.Maintenance()
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, errors.New("maintenance window is not started")
+	}
+	if err := c.unsetMaintenanceFlags(m); err != nil {
+		return nil, err
+	}
+	if _, err := c.Mon(NewCommand("config-key rm").Set("key", MAINTENANCE_KEY), nil); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// 从当前时间或到期时间(较晚者)起延长duration
+func (c *Commander) MaintenanceExtend(duration time.Duration) (*Maintenance, error) {
+	m, err := c.Maintenance()
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, errors.New("maintenance window is not started")
+	}
+	if duration, err = maintenanceDuration(duration); err != nil {
+		return nil, err
+	}
+	from := time.Now()
+	if m.Expire.After(from) {
+		from = m.Expire
+	}
+	m.Expire = from.Add(duration)
+	m.Reminded = time.Time{}
+	if err := c.saveMaintenance(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// 检查维护窗口是否到期，notify为true时需要通知：
+// on_expire为expire时已清除标志并结束窗口，为remind时每隔MAINTENANCE_REMIND_INTERVAL提醒一次
+func (c *Commander) MaintenanceCheck(now time.Time) (m *Maintenance, notify bool, err error) {
+	m, err = c.Maintenance()
+	if err != nil || m == nil || !m.Overdue(now) {
+		return m, false, err
+	}
+	if m.OnExpire == MAINTENANCE_EXPIRE {
+		if _, err := c.MaintenanceEnd(); err != nil {
+			return m, false, err
+		}
+		return m, true, nil
+	}
+	if now.Sub(m.Reminded) < MAINTENANCE_REMIND_INTERVAL {
+		return m, false, nil
+	}
+	m.Reminded = now
+	return m, true, c.saveMaintenance(m)
+}
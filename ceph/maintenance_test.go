@@ -0,0 +1,164 @@
+package ceph
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommander_OsdFlags(t *testing.T) {
+	rados := newConnectedFake(t)
+	commander := NewCommander(rados)
+
+	if _, err := commander.OsdSetFlag("noout"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := commander.OsdSetFlag("sortbitwise"); err == nil {
+		t.Fatal("expected error for a flag not in OSD_FLAGS")
+	}
+	if _, err := commander.OsdSetGroupFlags([]string{"noin", "noout"}, []string{"osd.1", "node3"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := commander.OsdSetGroupFlags([]string{"noout"}, []string{"node9"}); err == nil {
+		t.Fatal("expected error for a missing crush node")
+	}
+	flags, err := commander.OsdFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(flags.Cluster, []string{"noout"}) || !reflect.DeepEqual(flags.Osds["osd.1"], []string{"noin", "noout"}) ||
+		!reflect.DeepEqual(flags.Nodes["node3"], []string{"noin", "noout"}) {
+		t.Fatalf("flags %+v", flags)
+	}
+	health, _ := commander.HealthDetail()
+	if len(health.Checks) != 2 || health.Status != "HEALTH_WARN" {
+		t.Fatalf("health %+v", health)
+	}
+
+	commander.OsdUnsetFlag("noout")
+	commander.OsdUnsetGroupFlags([]string{"noin", "noout"}, []string{"osd.1", "node3"})
+	flags, _ = commander.OsdFlags()
+	if len(flags.Cluster) != 0 || len(flags.Osds) != 0 || len(flags.Nodes) != 0 {
+		t.Fatalf("flags after unset %+v", flags)
+	}
+}
+
+// osd set pause在osd dump中记录为pauserd,pausewr
+func TestCommander_OsdFlags_pause(t *testing.T) {
+	rados := newConnectedFake(t)
+	commander := NewCommander(rados)
+
+	if _, err := commander.OsdSetFlag("pause"); err != nil {
+		t.Fatal(err)
+	}
+	dump := struct {
+		Flags string `json:"flags"`
+	}{}
+	if _, err := commander.Mon(NewCommand("osd dump"), &dump); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dump.Flags, "pauserd,pausewr") {
+		t.Fatalf("osd dump flags %s", dump.Flags)
+	}
+	flags, err := commander.OsdFlags()
+	if err != nil || !reflect.DeepEqual(flags.Cluster, []string{"pause"}) {
+		t.Fatalf("flags %+v %v", flags, err)
+	}
+
+	// 开始前已暂停读写，结束维护后保持暂停
+	m, err := commander.MaintenanceStart(Maintenance{User: "admin", Flags: []string{"pause", "noout"}}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m.Preset[""], []string{"pause"}) {
+		t.Fatalf("preset %+v", m.Preset)
+	}
+	if _, err := commander.MaintenanceEnd(); err != nil {
+		t.Fatal(err)
+	}
+	flags, _ = commander.OsdFlags()
+	if !reflect.DeepEqual(flags.Cluster, []string{"pause"}) {
+		t.Fatalf("flags after end %+v", flags)
+	}
+	commander.OsdUnsetFlag("pause")
+	if flags, _ = commander.OsdFlags(); len(flags.Cluster) != 0 {
+		t.Fatalf("flags after unset %+v", flags)
+	}
+}
+
+func TestCommander_Maintenance(t *testing.T) {
+	rados := newConnectedFake(t)
+	commander := NewCommander(rados)
+
+	if m, err := commander.Maintenance(); err != nil || m != nil {
+		t.Fatalf("maintenance %+v %v", m, err)
+	}
+	// 开始前已设置的标志在结束时保留
+	commander.OsdSetFlag("noout")
+	m, err := commander.MaintenanceStart(Maintenance{User: "admin", Reason: "upgrade"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m.Flags, MAINTENANCE_FLAGS) || m.OnExpire != MAINTENANCE_REMIND || m.Expire.Sub(m.Start) != time.Hour {
+		t.Fatalf("maintenance %+v", m)
+	}
+	if _, err := commander.MaintenanceStart(Maintenance{User: "other"}, 0); err == nil || !strings.Contains(err.Error(), "admin") {
+		t.Fatalf("start twice %v", err)
+	}
+	flags, _ := commander.OsdFlags()
+	if !reflect.DeepEqual(flags.Cluster, []string{"noout", "norebalance"}) {
+		t.Fatalf("flags %+v", flags)
+	}
+
+	// 到期后每隔MAINTENANCE_REMIND_INTERVAL提醒一次，标志保留
+	if _, notify, _ := commander.MaintenanceCheck(time.Now()); notify {
+		t.Fatal("notify before expire")
+	}
+	now := m.Expire.Add(time.Minute)
+	if _, notify, err := commander.MaintenanceCheck(now); !notify || err != nil {
+		t.Fatalf("remind %v", err)
+	}
+	if _, notify, _ := commander.MaintenanceCheck(now.Add(time.Minute)); notify {
+		t.Fatal("remind again within interval")
+	}
+	if _, notify, _ := commander.MaintenanceCheck(now.Add(MAINTENANCE_REMIND_INTERVAL)); !notify {
+		t.Fatal("remind after interval")
+	}
+	if m, err = commander.MaintenanceExtend(time.Hour); err != nil || !m.Reminded.IsZero() || !m.Expire.After(time.Now()) {
+		t.Fatalf("extend %+v %v", m, err)
+	}
+
+	if _, err := commander.MaintenanceEnd(); err != nil {
+		t.Fatal(err)
+	}
+	flags, _ = commander.OsdFlags()
+	if !reflect.DeepEqual(flags.Cluster, []string{"noout"}) {
+		t.Fatalf("flags after end %+v", flags)
+	}
+	if _, err := commander.MaintenanceEnd(); err == nil {
+		t.Fatal("expected error for ending twice")
+	}
+
+	// expire到期后自动清除osd上的标志
+	m, err = commander.MaintenanceStart(Maintenance{User: "admin", Flags: []string{"noout"}, Targets: []string{"osd.2"}, OnExpire: MAINTENANCE_EXPIRE}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := commander.MaintenanceStart(Maintenance{Flags: []string{"norebalance"}, Targets: []string{"osd.0"}}, 0); err == nil {
+		t.Fatal("expected error for starting a second window")
+	}
+	if _, notify, err := commander.MaintenanceCheck(m.Expire); !notify || err != nil {
+		t.Fatalf("expire %v", err)
+	}
+	flags, _ = commander.OsdFlags()
+	if len(flags.Osds) != 0 {
+		t.Fatalf("flags after expire %+v", flags)
+	}
+	if m, _ := commander.Maintenance(); m != nil {
+		t.Fatalf("maintenance after expire %+v", m)
+	}
+	if _, err := commander.MaintenanceStart(Maintenance{Flags: []string{"norebalance"}, Targets: []string{"osd.0"}}, 0); err == nil {
+		t.Fatal("expected error for a cluster flag on osd")
+	}
+}
@@ -0,0 +1,361 @@
+package ceph
+
+// 多集群连接管理
+
+import (
+	"ceph-panel-go/middleware"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CLUSTER_HEALTH_CHECK = 30 * time.Second // 默认健康检查间隔
+	CLUSTER_STALE_DELAY  = time.Minute      // 重连后旧连接延迟关闭，等待正在使用的请求结束
+)
+
+type ClusterConfig struct {
+	Name        string
+	Backend     string
+	ClusterName string
+	UserName    string
+	ConfPath    string
+	Keyring     string
+	MonHost     string
+	Rgw         RgwConfig // Endpoint为空时不启用对象存储网关
+}
+
+// 连接状态
+type ClusterConnStatus struct {
+	Name      string    `json:"name"`
+	Backend   string    `json:"backend"`
+	Default   bool      `json:"default"`
+	Connected bool      `json:"connected"`
+	Healthy   bool      `json:"healthy"`
+	Error     string    `json:"error"`
+	LastCheck time.Time `json:"last_check"`
+}
+
+type managedCluster struct {
+	lock      sync.Mutex
+	config    ClusterConfig
+	rados     LibRados
+	rgw       RadosGW
+	mounts    map[string]Libcephfs // 按文件系统名缓存的挂载，与rados连接一同失效
+	healthy   bool
+	err       error
+	lastCheck time.Time
+}
+
+type ClusterManager struct {
+	clusters    map[string]*managedCluster
+	defaultName string
+	stop        chan struct{}
+	stopOnce    sync.Once
+}
+
+var Clusters *ClusterManager // 全局连接管理器，由RadosDriver.Init创建
+
+// defaultName为空时使用第一个集群
+func NewClusterManager(configs []ClusterConfig, defaultName string) (*ClusterManager, error) {
+	if len(configs) == 0 {
+		return nil, errors.New("no ceph cluster is configured")
+	}
+	m := &ClusterManager{
+		clusters:    map[string]*managedCluster{},
+		defaultName: defaultName,
+		stop:        make(chan struct{}),
+	}
+	for _, config := range configs {
+		if config.Name == "" {
+			return nil, errors.New("ceph cluster name is empty")
+		}
+		if _, ok := m.clusters[config.Name]; ok {
+			return nil, errors.New("ceph cluster[" + config.Name + "] is duplicated")
+		}
+		m.clusters[config.Name] = &managedCluster{config: config}
+	}
+	if m.defaultName == "" {
+		m.defaultName = configs[0].Name
+	}
+	if _, ok := m.clusters[m.defaultName]; !ok {
+		return nil, errors.New("default ceph cluster[" + m.defaultName + "] is not configured")
+	}
+	return m, nil
+}
+
+func (m *ClusterManager) Default() string {
+	return m.defaultName
+}
+
+func (m *ClusterManager) Names() []string {
+	names := []string{}
+	for name := range m.clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (m *ClusterManager) cluster(name string) (*managedCluster, error) {
+	if name == "" {
+		name = m.defaultName
+	}
+	c, ok := m.clusters[name]
+	if !ok {
+		return nil, errors.New("ceph cluster[" + name + "] is not configured")
+	}
+	return c, nil
+}
+
+// 返回已连接的句柄，未连接时建立连接，name为空时返回默认集群
+func (m *ClusterManager) Get(name string) (LibRados, error) {
+	c, err := m.cluster(name)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.connect()
+}
+
+// 调用方需持有c.lock
+func (c *managedCluster) connect() (LibRados, error) {
+	if c.rados != nil {
+		return c.rados, nil
+	}
+	rados, err := connectCluster(c.config)
+	c.lastCheck = time.Now()
+	c.err = err
+	c.healthy = err == nil
+	if err != nil {
+		return nil, err
+	}
+	c.rados = rados
+	return rados, nil
+}
+
+// 返回集群中文件系统的挂载，未挂载时挂载后缓存供所有请求共用，fs_name为空时为默认文件系统
+func (m *ClusterManager) Mount(name string, fs_name string) (Libcephfs, error) {
+	c, err := m.cluster(name)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if fs, ok := c.mounts[fs_name]; ok {
+		return fs, nil
+	}
+	rados, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	fs, err := NewLibCephfs(rados.Rados_clone())
+	if err != nil {
+		return nil, err
+	}
+	// 挂载失败时Ceph_mount已释放挂载句柄，每次请求都会重试，需释放克隆的句柄
+	if err := fs.Ceph_mount(fs_name, "/"); err != nil {
+		fs.Rados_shutdown()
+		return nil, err
+	}
+	if c.mounts == nil {
+		c.mounts = map[string]Libcephfs{}
+	}
+	c.mounts[fs_name] = fs
+	return fs, nil
+}
+
+// 卸载缓存的挂载，调用方需持有c.lock
+func (c *managedCluster) unmount() []Libcephfs {
+	mounts := []Libcephfs{}
+	for _, fs := range c.mounts {
+		mounts = append(mounts, fs)
+	}
+	c.mounts = nil
+	return mounts
+}
+
+// 返回集群的对象存储网关客户端，name为空时返回默认集群
+func (m *ClusterManager) RadosGW(name string) (RadosGW, error) {
+	c, err := m.cluster(name)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.rgw != nil {
+		return c.rgw, nil
+	}
+	if c.config.Rgw.Endpoint == "" {
+		return nil, errors.New("rgw of ceph cluster[" + c.config.Name + "] is not configured")
+	}
+	gw, err := NewRadosGW(c.config.Rgw)
+	if err != nil {
+		return nil, err
+	}
+	c.rgw = gw
+	return gw, nil
+}
+
+func connectCluster(config ClusterConfig) (LibRados, error) {
+	rados, err := NewBackend(config.Backend, config.ClusterName, config.UserName)
+	if err != nil {
+		return nil, err
+	}
+	if err := rados.Rados_create2(0); err != nil {
+		return nil, err
+	}
+	if config.ConfPath != "" {
+		if err := rados.Rados_conf_read_file(config.ConfPath); err != nil {
+			rados.Rados_shutdown()
+			return nil, err
+		}
+	}
+	// 覆盖配置文件中的设置
+	options := [][2]string{{"keyring", config.Keyring}, {"mon_host", config.MonHost}}
+	for _, option := range options {
+		if option[1] == "" {
+			continue
+		}
+		if err := rados.Rados_conf_set(option[0], option[1]); err != nil {
+			rados.Rados_shutdown()
+			return nil, err
+		}
+	}
+	if err := rados.Rados_connect(); err != nil {
+		rados.Rados_shutdown()
+		return nil, err
+	}
+	return rados, nil
+}
+
+// 检查已连接的集群，失败时断开，下次Get时重新连接
+func (m *ClusterManager) Check(name string) error {
+	c, err := m.cluster(name)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	rados := c.rados
+	c.lock.Unlock()
+	if rados == nil {
+		return nil
+	}
+	_, err = rados.Rados_cluster_stat()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.lastCheck = time.Now()
+	c.healthy = err == nil
+	c.err = err
+	if err != nil && c.rados == rados {
+		c.rados = nil
+		mounts := c.unmount()
+		// 其它请求可能还在使用旧连接的克隆句柄和挂载
+		time.AfterFunc(CLUSTER_STALE_DELAY, func() {
+			for _, fs := range mounts {
+				fs.Ceph_unmount()
+				fs.Rados_shutdown()
+			}
+			rados.Rados_shutdown()
+		})
+	}
+	return err
+}
+
+// 定时检查所有已连接的集群，直到Close
+func (m *ClusterManager) HealthCheck(interval time.Duration) {
+	if interval <= 0 {
+		interval = CLUSTER_HEALTH_CHECK
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, name := range m.Names() {
+				if m.Check(name) == nil {
+					m.notifyMaintenance(name)
+				}
+			}
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// 检查已连接集群的维护窗口，未连接时返回nil
+func (m *ClusterManager) CheckMaintenance(name string) (*Maintenance, bool, error) {
+	c, err := m.cluster(name)
+	if err != nil {
+		return nil, false, err
+	}
+	c.lock.Lock()
+	rados := c.rados
+	c.lock.Unlock()
+	if rados == nil {
+		return nil, false, nil
+	}
+	return NewCommander(rados).MaintenanceCheck(time.Now())
+}
+
+// 维护窗口到期时记录日志提醒
+func (m *ClusterManager) notifyMaintenance(name string) {
+	window, notify, err := m.CheckMaintenance(name)
+	if err != nil {
+		middleware.Logger.Logger.Warning("check maintenance of ceph cluster[" + name + "] fail: " + err.Error())
+		return
+	}
+	if !notify {
+		return
+	}
+	message := "maintenance window of ceph cluster[" + name + "] started by [" + window.User + "] expired at " +
+		window.Expire.Format(time.RFC3339) + ", flags " + strings.Join(window.Flags, ",")
+	if window.OnExpire == MAINTENANCE_EXPIRE {
+		middleware.Logger.Logger.Warning(message + " are unset")
+	} else {
+		middleware.Logger.Logger.Warning(message + " are still set")
+	}
+}
+
+func (m *ClusterManager) Status() []ClusterConnStatus {
+	result := []ClusterConnStatus{}
+	for _, name := range m.Names() {
+		c := m.clusters[name]
+		c.lock.Lock()
+		status := ClusterConnStatus{
+			Name:      name,
+			Backend:   c.config.Backend,
+			Default:   name == m.defaultName,
+			Connected: c.rados != nil,
+			Healthy:   c.healthy,
+			LastCheck: c.lastCheck,
+		}
+		if c.err != nil {
+			status.Error = c.err.Error()
+		}
+		c.lock.Unlock()
+		result = append(result, status)
+	}
+	return result
+}
+
+// 停止健康检查并断开所有连接
+func (m *ClusterManager) Close() {
+	m.stopOnce.Do(func() { close(m.stop) })
+	for _, c := range m.clusters {
+		c.lock.Lock()
+		for _, fs := range c.unmount() {
+			fs.Ceph_unmount()
+			fs.Rados_shutdown()
+		}
+		if c.rados != nil {
+			c.rados.Rados_shutdown()
+			c.rados = nil
+		}
+		c.lock.Unlock()
+	}
+}
@@ -0,0 +1,144 @@
+package ceph
+
+import "testing"
+
+func TestNewClusterManager(t *testing.T) {
+	if _, err := NewClusterManager(nil, ""); err == nil {
+		t.Fatal("expected error without clusters")
+	}
+	configs := []ClusterConfig{
+		{Name: "prod", Backend: BACKEND_FAKE, ClusterName: "ceph", UserName: "client.admin", Keyring: "/etc/ceph/keyring"},
+		{Name: "backup", Backend: BACKEND_FAKE, ClusterName: "backup", UserName: "client.admin"},
+		{Name: "broken", Backend: "unknown"},
+	}
+	if _, err := NewClusterManager(configs, "missing"); err == nil {
+		t.Fatal("expected error for a missing default cluster")
+	}
+	m, err := NewClusterManager(configs, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if m.Default() != "prod" {
+		t.Fatalf("default %s", m.Default())
+	}
+
+	// 第一次获取时连接，之后返回同一个句柄
+	rados, err := m.Get("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rados.(*fakeRados).conf["keyring"] != "/etc/ceph/keyring" {
+		t.Fatalf("conf %+v", rados.(*fakeRados).conf)
+	}
+	again, _ := m.Get("prod")
+	if again != rados {
+		t.Fatal("expected the cached handle")
+	}
+	if _, err := m.Get("broken"); err == nil {
+		t.Fatal("expected error connecting the broken cluster")
+	}
+	if _, err := m.Get("other"); err == nil {
+		t.Fatal("expected error for an unknown cluster")
+	}
+
+	// 健康检查失败后断开，下次获取时重新连接
+	if err := m.Check("prod"); err != nil {
+		t.Fatal(err)
+	}
+	rados.(*fakeRados).connected = false
+	if err := m.Check("prod"); err == nil {
+		t.Fatal("expected health check to fail")
+	}
+	status := m.Status()
+	if len(status) != 3 || status[2].Name != "prod" || status[2].Connected || status[2].Healthy || !status[2].Default {
+		t.Fatalf("status %+v", status)
+	}
+	reconnected, err := m.Get("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reconnected == rados {
+		t.Fatal("expected a new handle after reconnecting")
+	}
+	if status := m.Status(); !status[2].Connected || !status[2].Healthy {
+		t.Fatalf("status %+v", status)
+	}
+}
+
+func TestClusterManager_RadosGW(t *testing.T) {
+	configs := []ClusterConfig{
+		{Name: "prod", Backend: BACKEND_FAKE, Rgw: RgwConfig{Endpoint: "http://127.0.0.1:7480", AccessKey: "a", SecretKey: "s"}},
+		{Name: "backup", Backend: BACKEND_FAKE},
+		{Name: "broken", Backend: BACKEND_FAKE, Rgw: RgwConfig{Endpoint: "127.0.0.1:7480"}},
+	}
+	m, err := NewClusterManager(configs, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	gw, err := m.RadosGW("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := m.RadosGW("prod"); again != gw {
+		t.Fatal("expected the cached rgw client")
+	}
+	if _, err := m.RadosGW("backup"); err == nil {
+		t.Fatal("expected error without rgw endpoint")
+	}
+	if _, err := m.RadosGW("broken"); err == nil {
+		t.Fatal("expected error with invalid rgw endpoint")
+	}
+}
+
+func TestClusterManager_Mount(t *testing.T) {
+	m, err := NewClusterManager([]ClusterConfig{{Name: "prod", Backend: BACKEND_FAKE}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	// 同一文件系统共用一个挂载
+	fs, err := m.Mount("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := m.Mount("prod", ""); again != fs {
+		t.Fatal("expected the cached mount")
+	}
+	if err := fs.Ceph_mkdir("/a", CEPHFS_DEFAULT_DIR_MODE); err != nil {
+		t.Fatal(err)
+	}
+	// 挂载失败时释放克隆的句柄
+	cluster := fs.(*fakeRados).cluster
+	clones := cluster.clones
+	for i := 0; i < 3; i++ {
+		if _, err := m.Mount("prod", "nofs"); err == nil {
+			t.Fatal("expected error mounting an unknown filesystem")
+		}
+	}
+	if cluster.clones != clones {
+		t.Fatalf("leaked %d handles", cluster.clones-clones)
+	}
+
+	// 连接失效后挂载一同失效，重新获取时在新连接上挂载
+	rados, _ := m.Get("prod")
+	rados.(*fakeRados).connected = false
+	m.Check("prod")
+	remounted, err := m.Mount("prod", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remounted == fs {
+		t.Fatal("expected a new mount after reconnecting")
+	}
+	m.Close()
+	if _, err := remounted.Ceph_stat("/"); err == nil {
+		t.Fatal("expected the mount to be released on close")
+	}
+	// 只剩旧连接上的挂载，在CLUSTER_STALE_DELAY后释放
+	if cluster.clones != 1 {
+		t.Fatalf("%d handles left after close", cluster.clones)
+	}
+}
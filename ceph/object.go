@@ -0,0 +1,96 @@
+package ceph
+
+// 对象
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	OBJECT_LIST_DEFAULT = 100  // 默认每页对象数
+	OBJECT_LIST_MAX     = 1000 // 每页对象数上限
+
+	ALL_NAMESPACES = "\001" // 列出所有命名空间，与LIBRADOS_ALL_NSPACES一致
+)
+
+type ObjectEntry struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Locator   string `json:"locator,omitempty"`
+}
+
+// 分页列出的对象，Next为下一页的游标，为空表示已列出全部对象
+type ObjectListPage struct {
+	Objects []ObjectEntry `json:"objects"`
+	Next    string        `json:"next"`
+}
+
+type ObjectStat struct {
+	Size  uint64    `json:"size"`
+	Mtime time.Time `json:"mtime"`
+}
+
+// 扩展属性
+type XattrEntry struct {
+	Name  string `json:"name"`
+	Value []byte `json:"value"`
+}
+
+type OmapEntry struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// 按key排序分页读取的omap，More表示之后还有数据，以最后一个key作为start_after继续读取
+type OmapPage struct {
+	Vals []OmapEntry `json:"vals"`
+	More bool        `json:"more"`
+}
+
+// 按名称排序
+func sortXattrs(attrs map[string][]byte) []XattrEntry {
+	entries := []XattrEntry{}
+	for name, value := range attrs {
+		entries = append(entries, XattrEntry{Name: name, Value: value})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+func listLimit(max int) int {
+	if max <= 0 {
+		return OBJECT_LIST_DEFAULT
+	}
+	if max > OBJECT_LIST_MAX {
+		return OBJECT_LIST_MAX
+	}
+	return max
+}
+
+// librados分页游标，格式为"pg哈希位置:该pg中已列出的对象数"
+func parseListCursor(cursor string) (pos uint32, skip int, err error) {
+	if cursor == "" {
+		return 0, 0, nil
+	}
+	parts := strings.SplitN(cursor, ":", 2)
+	if len(parts) != 2 {
+		return 0, 0, errors.New("invalid list cursor[" + cursor + "]")
+	}
+	p, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return 0, 0, errors.New("invalid list cursor[" + cursor + "]")
+	}
+	s, err := strconv.Atoi(parts[1])
+	if err != nil || s < 0 {
+		return 0, 0, errors.New("invalid list cursor[" + cursor + "]")
+	}
+	return uint32(p), s, nil
+}
+
+func formatListCursor(pos uint32, skip int) string {
+	return strconv.FormatUint(uint64(pos), 10) + ":" + strconv.Itoa(skip)
+}
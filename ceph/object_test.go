@@ -0,0 +1,155 @@
+package ceph
+
+import "testing"
+
+func TestParseListCursor(t *testing.T) {
+	pos, skip, err := parseListCursor(formatListCursor(7, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos != 7 || skip != 3 {
+		t.Fatalf("cursor %d:%d", pos, skip)
+	}
+	if _, _, err := parseListCursor(""); err != nil {
+		t.Fatal(err)
+	}
+	for _, cursor := range []string{"7", "a:1", "7:-1", "4294967296:0"} {
+		if _, _, err := parseListCursor(cursor); err == nil {
+			t.Fatalf("expected cursor[%s] to be invalid", cursor)
+		}
+	}
+}
+
+func TestFakeRados_objects(t *testing.T) {
+	rados := newConnectedFake(t)
+	if err := rados.Rados_ioctx_create("data"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if err := rados.Rados_write_full(name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rados.Rados_ioctx_set_namespace("ns1")
+	if err := rados.Rados_write_full("a", []byte("ns1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := rados.Rados_append("a", []byte("-more")); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := rados.Rados_stat("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Size != 8 || stat.Mtime.IsZero() {
+		t.Fatalf("stat %+v", stat)
+	}
+	if _, err := rados.Rados_stat("b"); err == nil {
+		t.Fatal("expected b to be missing in ns1")
+	}
+
+	// 默认命名空间分页
+	rados.Rados_ioctx_set_namespace("")
+	page, err := rados.Rados_nobjects_list("", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Objects) != 2 || page.Objects[0].Name != "a" || page.Next == "" {
+		t.Fatalf("page %+v", page)
+	}
+	page, err = rados.Rados_nobjects_list(page.Next, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Objects) != 1 || page.Objects[0].Name != "c" || page.Next != "" {
+		t.Fatalf("page %+v", page)
+	}
+
+	rados.Rados_ioctx_set_namespace(ALL_NAMESPACES)
+	page, err = rados.Rados_nobjects_list("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Objects) != 4 {
+		t.Fatalf("all namespaces %+v", page)
+	}
+
+	rados.Rados_ioctx_set_namespace("")
+	if err := rados.Rados_remove("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rados.Rados_remove("b"); err == nil {
+		t.Fatal("expected removing a missing object to fail")
+	}
+	out, err := rados.Rados_Read("a", 16, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "a" {
+		t.Fatalf("read %q", out.String())
+	}
+}
+
+func TestFakeRados_omap(t *testing.T) {
+	rados := newConnectedFake(t)
+	if err := rados.Rados_ioctx_create("data"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rados.Rados_setxattr("dir", "user.b", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := rados.Rados_setxattr("dir", "user.a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	attrs, err := rados.Rados_getxattrs("dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attrs) != 2 || attrs[0].Name != "user.a" || string(attrs[1].Value) != "2" {
+		t.Fatalf("xattrs %+v", attrs)
+	}
+
+	vals := []OmapEntry{{"k1", []byte("v1")}, {"k2", []byte("v2")}, {"k3", []byte("v3")}, {"x1", []byte("x")}}
+	if err := rados.Rados_omap_set("dir", vals); err != nil {
+		t.Fatal(err)
+	}
+	page, err := rados.Rados_omap_get_vals("dir", "", "k", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Vals) != 2 || !page.More || page.Vals[1].Key != "k2" {
+		t.Fatalf("page %+v", page)
+	}
+	page, err = rados.Rados_omap_get_vals("dir", "k2", "k", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Vals) != 1 || page.More || string(page.Vals[0].Value) != "v3" {
+		t.Fatalf("page %+v", page)
+	}
+
+	if err := rados.Rados_omap_rm_keys("dir", []string{"k1", "x1"}); err != nil {
+		t.Fatal(err)
+	}
+	page, _ = rados.Rados_omap_get_vals("dir", "", "", 0)
+	if len(page.Vals) != 2 {
+		t.Fatalf("after rm_keys %+v", page)
+	}
+	if err := rados.Rados_omap_set_header("dir", []byte("hdr")); err != nil {
+		t.Fatal(err)
+	}
+	header, err := rados.Rados_omap_get_header("dir")
+	if err != nil || string(header) != "hdr" {
+		t.Fatalf("header %q %v", header, err)
+	}
+	if err := rados.Rados_omap_clear("dir"); err != nil {
+		t.Fatal(err)
+	}
+	page, _ = rados.Rados_omap_get_vals("dir", "", "", 0)
+	if len(page.Vals) != 0 {
+		t.Fatalf("after clear %+v", page)
+	}
+	if err := rados.Rados_omap_clear("missing"); err == nil {
+		t.Fatal("expected clearing a missing object to fail")
+	}
+}
@@ -0,0 +1,197 @@
+package ceph
+
+// osd列表及状态操作
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+)
+
+type OsdDfNode struct {
+	Id          int     `json:"id"`
+	Name        string  `json:"name"`
+	Type        string  `json:"type"`
+	DeviceClass string  `json:"device_class"`
+	CrushWeight float64 `json:"crush_weight"`
+	Reweight    float64 `json:"reweight"`
+	Kb          uint64  `json:"kb"`
+	KbUsed      uint64  `json:"kb_used"`
+	KbAvail     uint64  `json:"kb_avail"`
+	Utilization float64 `json:"utilization"` // 百分比
+	Var         float64 `json:"var"`         // 与平均使用率的比值
+	Pgs         int     `json:"pgs"`
+	Status      string  `json:"status"`
+}
+
+type OsdDfSummary struct {
+	TotalKb            uint64  `json:"total_kb"`
+	TotalKbUsed        uint64  `json:"total_kb_used"`
+	TotalKbAvail       uint64  `json:"total_kb_avail"`
+	AverageUtilization float64 `json:"average_utilization"`
+	MinVar             float64 `json:"min_var"`
+	MaxVar             float64 `json:"max_var"`
+	Dev                float64 `json:"dev"`
+}
+
+// ceph osd df
+type OsdDf struct {
+	Nodes   []OsdDfNode  `json:"nodes"`
+	Stray   []OsdDfNode  `json:"stray"`
+	Summary OsdDfSummary `json:"summary"`
+}
+
+func (c *Commander) OsdDf() (*OsdDf, error) {
+	df := &OsdDf{}
+	if _, err := c.Mon(NewCommand("osd df"), df); err != nil {
+		return nil, err
+	}
+	return df, nil
+}
+
+// 汇总osd tree及osd df的osd信息
+type OsdInfo struct {
+	Id          int     `json:"id"`
+	Name        string  `json:"name"`
+	Host        string  `json:"host"` // 所在的host节点，不在crush树中时为空
+	DeviceClass string  `json:"device_class"`
+	CrushWeight float64 `json:"crush_weight"`
+	Reweight    float64 `json:"reweight"` // out时为0
+	Up          bool    `json:"up"`
+	In          bool    `json:"in"`
+	TotalBytes  uint64  `json:"total_bytes"`
+	UsedBytes   uint64  `json:"used_bytes"`
+	AvailBytes  uint64  `json:"avail_bytes"`
+	Utilization float64 `json:"utilization"` // 百分比
+	Var         float64 `json:"var"`
+	Pgs         int     `json:"pgs"`
+}
+
+// 按id排序的osd列表，包括不在crush树中的osd
+func (c *Commander) OsdList() ([]OsdInfo, error) {
+	tree, err := c.OsdTree()
+	if err != nil {
+		return nil, err
+	}
+	df, err := c.OsdDf()
+	if err != nil {
+		return nil, err
+	}
+	nodes := map[int]OsdTreeNode{}
+	parent := map[int]int{}
+	for _, node := range tree.Nodes {
+		nodes[node.Id] = node
+		for _, child := range node.Children {
+			parent[child] = node.Id
+		}
+	}
+	usage := map[int]OsdDfNode{}
+	for _, node := range append(df.Nodes, df.Stray...) {
+		usage[node.Id] = node
+	}
+
+	list := []OsdInfo{}
+	for _, node := range append(tree.Nodes, tree.Stray...) {
+		if node.Type != "osd" {
+			continue
+		}
+		info := OsdInfo{
+			Id:          node.Id,
+			Name:        node.Name,
+			DeviceClass: node.DeviceClass,
+			CrushWeight: node.CrushWeight,
+			Reweight:    node.Reweight,
+			Up:          node.Status == "up",
+			In:          node.Reweight > 0,
+		}
+		// 向上查找host，osd可能在chassis等其他类型的bucket下
+		for id, ok := parent[node.Id]; ok; id, ok = parent[id] {
+			if nodes[id].Type == "host" {
+				info.Host = nodes[id].Name
+				break
+			}
+		}
+		if u, ok := usage[node.Id]; ok {
+			info.TotalBytes = u.Kb * 1024
+			info.UsedBytes = u.KbUsed * 1024
+			info.AvailBytes = u.KbAvail * 1024
+			info.Utilization = u.Utilization
+			info.Var = u.Var
+			info.Pgs = u.Pgs
+		}
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Id < list[j].Id })
+	return list, nil
+}
+
+func osdIds(ids []int) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, errors.New("osd id is empty")
+	}
+	result := []string{}
+	for _, id := range ids {
+		if id < 0 {
+			return nil, errors.New("invalid osd id " + strconv.Itoa(id))
+		}
+		result = append(result, strconv.Itoa(id))
+	}
+	return result, nil
+}
+
+// 状态命令，返回命令的状态信息
+func (c *Commander) osdState(prefix string, ids []int) (string, error) {
+	args, err := osdIds(ids)
+	if err != nil {
+		return "", err
+	}
+	return c.Mon(NewCommand(prefix).Set("ids", args), nil)
+}
+
+// 标记为out，数据会迁移到其他osd
+func (c *Commander) OsdOut(ids []int) (string, error) {
+	return c.osdState("osd out", ids)
+}
+
+func (c *Commander) OsdIn(ids []int) (string, error) {
+	return c.osdState("osd in", ids)
+}
+
+// 标记为down，osd进程仍在运行时会重新标记为up
+func (c *Commander) OsdDown(ids []int) (string, error) {
+	return c.osdState("osd down", ids)
+}
+
+// weight范围为0~1，与crush权重不同，用于临时调整数据分布
+func (c *Commander) OsdReweight(id int, weight float64) (string, error) {
+	if id < 0 {
+		return "", errors.New("invalid osd id " + strconv.Itoa(id))
+	}
+	if weight < 0 || weight > 1 {
+		return "", errors.New("invalid reweight " + strconv.FormatFloat(weight, 'f', -1, 64) + ", must be in range 0~1")
+	}
+	return c.Mon(NewCommand("osd reweight").Set("id", id).Set("weight", weight), nil)
+}
+
+// 已有设备类型的osd需要先删除原类型才能设置
+func (c *Commander) OsdSetDeviceClass(class string, ids []int) (string, error) {
+	if class == "" {
+		return "", errors.New("device class is empty")
+	}
+	args, err := osdIds(ids)
+	if err != nil {
+		return "", err
+	}
+	if _, err := c.Mon(NewCommand("osd crush rm-device-class").Set("ids", args), nil); err != nil {
+		return "", err
+	}
+	return c.Mon(NewCommand("osd crush set-device-class").Set("class", class).Set("ids", args), nil)
+}
+
+// 标记为永久丢失，osd必须是down，其上未恢复的数据将丢失
+func (c *Commander) OsdLost(id int) (string, error) {
+	if id < 0 {
+		return "", errors.New("invalid osd id " + strconv.Itoa(id))
+	}
+	return c.Mon(NewCommand("osd lost").Set("id", id).Set("yes_i_really_mean_it", true), nil)
+}
@@ -0,0 +1,124 @@
+package ceph
+
+// 集群标志及osd/crush节点标志
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// 可通过osd set/unset设置的集群标志
+	OSD_FLAGS = []string{"pause", "noup", "nodown", "noout", "noin", "nobackfill", "norebalance",
+		"norecover", "noscrub", "nodeep-scrub", "notieragent", "nosnaptrim"}
+	// 可通过osd set-group设置在osd或crush节点上的标志
+	OSD_GROUP_FLAGS = []string{"noup", "nodown", "noin", "noout"}
+	// osd set pause在osd dump中显示为这两个标志
+	OSD_PAUSE_FLAGS = []string{"pauserd", "pausewr"}
+)
+
+type OsdFlags struct {
+	Cluster []string            `json:"cluster"` // 只包括OSD_FLAGS中的标志
+	Osds    map[string][]string `json:"osds"`    // osd.0 -> [noout]
+	Nodes   map[string][]string `json:"nodes"`   // crush节点名称，如host
+}
+
+func hasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+func checkOsdFlags(flags []string, valid []string) error {
+	if len(flags) == 0 {
+		return errors.New("osd flag is empty")
+	}
+	for _, flag := range flags {
+		if !hasFlag(valid, flag) {
+			return errors.New("invalid osd flag [" + flag + "], must be one of " + strings.Join(valid, ","))
+		}
+	}
+	return nil
+}
+
+func (c *Commander) OsdFlags() (*OsdFlags, error) {
+	dump := struct {
+		Flags          string              `json:"flags"`
+		CrushNodeFlags map[string][]string `json:"crush_node_flags"`
+		Osds           []struct {
+			Osd   int      `json:"osd"`
+			State []string `json:"state"`
+		} `json:"osds"`
+	}{}
+	if _, err := c.Mon(NewCommand("osd dump"), &dump); err != nil {
+		return nil, err
+	}
+	flags := &OsdFlags{
+		Cluster: []string{},
+		Osds:    map[string][]string{},
+		Nodes:   map[string][]string{},
+	}
+	for _, flag := range strings.Split(dump.Flags, ",") {
+		if hasFlag(OSD_PAUSE_FLAGS, flag) {
+			flag = "pause"
+		}
+		if hasFlag(OSD_FLAGS, flag) && !hasFlag(flags.Cluster, flag) {
+			flags.Cluster = append(flags.Cluster, flag)
+		}
+	}
+	sort.Strings(flags.Cluster)
+	// osd状态中除exists、up等状态外的标志
+	for _, osd := range dump.Osds {
+		for _, state := range osd.State {
+			if hasFlag(OSD_GROUP_FLAGS, state) {
+				name := "osd." + strconv.Itoa(osd.Osd)
+				flags.Osds[name] = append(flags.Osds[name], state)
+			}
+		}
+	}
+	for node, list := range dump.CrushNodeFlags {
+		if len(list) > 0 {
+			flags.Nodes[node] = list
+		}
+	}
+	return flags, nil
+}
+
+// 设置集群标志，如noout，pause会停止所有读写
+func (c *Commander) OsdSetFlag(flag string) (string, error) {
+	if err := checkOsdFlags([]string{flag}, OSD_FLAGS); err != nil {
+		return "", err
+	}
+	return c.Mon(NewCommand("osd set").Set("key", flag), nil)
+}
+
+func (c *Commander) OsdUnsetFlag(flag string) (string, error) {
+	if err := checkOsdFlags([]string{flag}, OSD_FLAGS); err != nil {
+		return "", err
+	}
+	return c.Mon(NewCommand("osd unset").Set("key", flag), nil)
+}
+
+// who为osd名称(osd.0)或crush节点名称(host)
+func (c *Commander) osdGroupFlags(prefix string, flags []string, who []string) (string, error) {
+	if err := checkOsdFlags(flags, OSD_GROUP_FLAGS); err != nil {
+		return "", err
+	}
+	if len(who) == 0 {
+		return "", errors.New("osd or crush node is empty")
+	}
+	return c.Mon(NewCommand(prefix).Set("flags", strings.Join(flags, ",")).Set("who", who), nil)
+}
+
+func (c *Commander) OsdSetGroupFlags(flags []string, who []string) (string, error) {
+	return c.osdGroupFlags("osd set-group", flags, who)
+}
+
+func (c *Commander) OsdUnsetGroupFlags(flags []string, who []string) (string, error) {
+	return c.osdGroupFlags("osd unset-group", flags, who)
+}
@@ -0,0 +1,95 @@
+package ceph
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommander_OsdList(t *testing.T) {
+	rados := newConnectedFake(t)
+	commander := NewCommander(rados)
+
+	list, err := commander.OsdList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("osd list %+v", list)
+	}
+	pgs := 0
+	for i, osd := range list {
+		if osd.Id != i || osd.Host != "node"+string(rune('1'+i)) || osd.DeviceClass != "hdd" || !osd.Up || !osd.In ||
+			osd.TotalBytes != fakeOsdBytes || osd.Reweight != 1 {
+			t.Fatalf("osd %+v", osd)
+		}
+		pgs += osd.Pgs
+	}
+	if pgs != 3*POOL_DEFAULT_PG_NUM*3 {
+		t.Fatalf("pgs %d", pgs)
+	}
+
+	if _, err := commander.OsdOut([]int{1}); err != nil {
+		t.Fatal(err)
+	}
+	list, _ = commander.OsdList()
+	if list[1].In || list[1].Reweight != 0 || list[1].UsedBytes != 0 || list[1].Pgs != 0 {
+		t.Fatalf("osd out %+v", list[1])
+	}
+	if _, err := commander.OsdIn([]int{1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := commander.OsdReweight(1, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	list, _ = commander.OsdList()
+	if !list[1].In || list[1].Reweight != 0.5 || list[1].Pgs >= list[0].Pgs {
+		t.Fatalf("osd reweight %+v", list)
+	}
+	if _, err := commander.OsdReweight(1, 1.5); err == nil {
+		t.Fatal("expected error for reweight out of range")
+	}
+	if _, err := commander.OsdOut([]int{9}); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("out missing osd %v", err)
+	}
+	if _, err := commander.OsdOut(nil); err == nil {
+		t.Fatal("expected error for empty ids")
+	}
+}
+
+func TestCommander_OsdDeviceClass(t *testing.T) {
+	rados := newConnectedFake(t)
+	commander := NewCommander(rados)
+
+	if _, err := commander.OsdSetDeviceClass("ssd", []int{0, 2}); err != nil {
+		t.Fatal(err)
+	}
+	list, _ := commander.OsdList()
+	if list[0].DeviceClass != "ssd" || list[1].DeviceClass != "hdd" || list[2].DeviceClass != "ssd" {
+		t.Fatalf("device class %+v", list)
+	}
+	// 直接设置已有类型的osd会失败
+	if _, err := commander.Mon(NewCommand("osd crush set-device-class").Set("class", "nvme").Set("ids", []string{"1"}), nil); err == nil || !strings.Contains(err.Error(), "rm-device-class") {
+		t.Fatalf("set class without rm %v", err)
+	}
+}
+
+func TestCommander_OsdLost(t *testing.T) {
+	rados := newConnectedFake(t)
+	commander := NewCommander(rados)
+
+	if _, err := commander.OsdLost(0); err == nil || !strings.Contains(err.Error(), "is not down") {
+		t.Fatalf("lost up osd %v", err)
+	}
+	if _, err := commander.Mon(NewCommand("osd lost").Set("id", 0), nil); err == nil || !strings.Contains(err.Error(), "yes-i-really-mean-it") {
+		t.Fatalf("lost without confirm %v", err)
+	}
+	if _, err := commander.OsdDown([]int{0}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := commander.OsdLost(0); err != nil {
+		t.Fatal(err)
+	}
+	if !rados.cluster.osds[0].lost {
+		t.Fatal("osd.0 not marked lost")
+	}
+}
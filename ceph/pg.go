@@ -0,0 +1,268 @@
+package ceph
+
+// pg列表、查询及scrub/repair操作
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// pg dump_stuck支持的类型
+var PG_STUCK_TYPES = []string{"inactive", "unclean", "stale", "undersized", "degraded"}
+
+var pgIdPattern = regexp.MustCompile(`^[0-9]+\.[0-9a-f]+$`)
+
+type PgStatSum struct {
+	NumBytes            int64 `json:"num_bytes"`
+	NumObjects          int64 `json:"num_objects"`
+	NumObjectsDegraded  int64 `json:"num_objects_degraded"`
+	NumObjectsMisplaced int64 `json:"num_objects_misplaced"`
+	NumObjectsUnfound   int64 `json:"num_objects_unfound"`
+	NumScrubErrors      int64 `json:"num_scrub_errors"`
+}
+
+// pg ls及pg dump_stuck输出中的pg，dump_stuck不包括统计信息
+type PgInfo struct {
+	PgId               string    `json:"pgid"`
+	State              string    `json:"state"`
+	Up                 []int     `json:"up"`
+	Acting             []int     `json:"acting"`
+	UpPrimary          int       `json:"up_primary"`
+	ActingPrimary      int       `json:"acting_primary"`
+	LastScrubStamp     string    `json:"last_scrub_stamp,omitempty"`
+	LastDeepScrubStamp string    `json:"last_deep_scrub_stamp,omitempty"`
+	StatSum            PgStatSum `json:"stat_sum"`
+}
+
+// 状态中是否包括state，如active+clean+inconsistent包括inconsistent
+func (p *PgInfo) HasState(state string) bool {
+	return hasFlag(strings.Split(p.State, "+"), state)
+}
+
+// 新版本输出为{"pg_stats": [...]}或{"stuck_pg_stats": [...]}，旧版本为数组
+type pgList []PgInfo
+
+func (l *pgList) UnmarshalJSON(data []byte) error {
+	list := []PgInfo{}
+	if len(data) > 0 && data[0] == '[' {
+		if err := json.Unmarshal(data, &list); err != nil {
+			return err
+		}
+	} else {
+		raw := struct {
+			PgStats      []PgInfo `json:"pg_stats"`
+			StuckPgStats []PgInfo `json:"stuck_pg_stats"`
+		}{}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+		list = append(raw.PgStats, raw.StuckPgStats...)
+	}
+	*l = list
+	return nil
+}
+
+type PgFilter struct {
+	Pool   string   // 存储池名称
+	Osd    int      // up或acting中包括该osd，小于0表示不过滤
+	States []string // 包括任一状态，如inconsistent
+	Stuck  string   // PG_STUCK_TYPES之一，不为空时只返回卡住的pg
+}
+
+func checkPgId(pgid string) error {
+	if !pgIdPattern.MatchString(pgid) {
+		return errors.New("invalid pg id [" + pgid + "]")
+	}
+	return nil
+}
+
+func hasOsd(osds []int, osd int) bool {
+	for _, id := range osds {
+		if id == osd {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Commander) PgList(filter PgFilter) ([]PgInfo, error) {
+	if filter.Stuck != "" {
+		return c.pgStuck(filter)
+	}
+	var cmd Command
+	if filter.Pool != "" {
+		cmd = NewCommand("pg ls-by-pool").Set("poolstr", filter.Pool)
+	} else if filter.Osd >= 0 {
+		cmd = NewCommand("pg ls-by-osd").Set("osd", "osd."+strconv.Itoa(filter.Osd))
+	} else {
+		cmd = NewCommand("pg ls")
+	}
+	if len(filter.States) > 0 {
+		cmd.Set("states", filter.States)
+	}
+	list := pgList{}
+	if _, err := c.Mon(cmd, &list); err != nil {
+		return nil, err
+	}
+	return filterPgs(list, filter), nil
+}
+
+// 没有卡住的pg时输出为空
+func (c *Commander) pgStuck(filter PgFilter) ([]PgInfo, error) {
+	if !hasFlag(PG_STUCK_TYPES, filter.Stuck) {
+		return nil, errors.New("invalid pg stuck type [" + filter.Stuck + "], must be one of " + strings.Join(PG_STUCK_TYPES, ","))
+	}
+	cmd := NewCommand("pg dump_stuck").Set("stuckops", []string{filter.Stuck})
+	out, _, err := c.rados.Rados_mon_command(cmd.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	list := pgList{}
+	if len(bytes.TrimSpace(out)) > 0 {
+		if err := decodeCommandOutput(cmd, out, &list); err != nil {
+			return nil, err
+		}
+	}
+	pools := []Pool{}
+	if filter.Pool != "" {
+		if pools, err = c.rados.Rados_pool_list(); err != nil {
+			return nil, err
+		}
+	}
+	// dump_stuck不支持按存储池过滤，按pgid的存储池id过滤
+	result := []PgInfo{}
+	for _, pg := range filterPgs(list, PgFilter{Osd: filter.Osd, States: filter.States}) {
+		if filter.Pool != "" {
+			match := false
+			for _, pool := range pools {
+				if pool.Name == filter.Pool && strings.HasPrefix(pg.PgId, strconv.FormatInt(pool.Id, 10)+".") {
+					match = true
+				}
+			}
+			if !match {
+				continue
+			}
+		}
+		result = append(result, pg)
+	}
+	return result, nil
+}
+
+// 命令已按存储池或osd之一过滤，这里过滤其他条件
+func filterPgs(list []PgInfo, filter PgFilter) []PgInfo {
+	result := []PgInfo{}
+	for _, pg := range list {
+		if filter.Osd >= 0 && !hasOsd(pg.Up, filter.Osd) && !hasOsd(pg.Acting, filter.Osd) {
+			continue
+		}
+		if len(filter.States) > 0 {
+			match := false
+			for _, state := range filter.States {
+				match = match || pg.HasState(state)
+			}
+			if !match {
+				continue
+			}
+		}
+		result = append(result, pg)
+	}
+	return result
+}
+
+// pg query的输出较复杂且随版本变化，不定义结构
+func (c *Commander) PgQuery(pgid string) (map[string]interface{}, error) {
+	if err := checkPgId(pgid); err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{}
+	if _, err := c.Pg(pgid, NewCommand("query").Set("pgid", pgid), &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 逐个发送，先检查所有pgid，返回各pg的状态信息
+func (c *Commander) pgScrub(prefix string, pgids []string) ([]string, error) {
+	if len(pgids) == 0 {
+		return nil, errors.New("pg id is empty")
+	}
+	for _, pgid := range pgids {
+		if err := checkPgId(pgid); err != nil {
+			return nil, err
+		}
+	}
+	result := []string{}
+	for _, pgid := range pgids {
+		outs, err := c.Mon(NewCommand(prefix).Set("pgid", pgid), nil)
+		if err != nil {
+			return result, err
+		}
+		result = append(result, outs)
+	}
+	return result, nil
+}
+
+func (c *Commander) PgScrub(pgids []string) ([]string, error) {
+	return c.pgScrub("pg scrub", pgids)
+}
+
+func (c *Commander) PgDeepScrub(pgids []string) ([]string, error) {
+	return c.pgScrub("pg deep-scrub", pgids)
+}
+
+// 用主副本修复不一致的对象，需要先deep-scrub发现不一致
+func (c *Commander) PgRepair(pgids []string) ([]string, error) {
+	return c.pgScrub("pg repair", pgids)
+}
+
+type InconsistentShard struct {
+	Osd     int      `json:"osd"`
+	Shard   int      `json:"shard,omitempty"` // 纠删码存储池的分片序号
+	Primary bool     `json:"primary"`
+	Errors  []string `json:"errors"`
+	Size    uint64   `json:"size"`
+}
+
+// snap为head、snapdir或快照id
+type InconsistentObjectId struct {
+	Name      string      `json:"name"`
+	Namespace string      `json:"nspace"`
+	Locator   string      `json:"locator"`
+	Snap      interface{} `json:"snap"`
+	Version   uint64      `json:"version"`
+}
+
+// rados list-inconsistent-obj的输出
+type InconsistentObject struct {
+	Object           InconsistentObjectId `json:"object"`
+	Errors           []string             `json:"errors"`
+	UnionShardErrors []string             `json:"union_shard_errors"`
+	Shards           []InconsistentShard  `json:"shards"`
+}
+
+// 解析rados list-inconsistent-obj --format=json的输出
+func decodeInconsistentObjects(pgid string, data []byte) ([]InconsistentObject, error) {
+	info := struct {
+		Epoch         uint32               `json:"epoch"`
+		Inconsistents []InconsistentObject `json:"inconsistents"`
+	}{}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, errors.New("cannot decode inconsistent objects of pg[" + pgid + "] " + err.Error())
+	}
+	if info.Inconsistents == nil {
+		info.Inconsistents = []InconsistentObject{}
+	}
+	return info.Inconsistents, nil
+}
+
+// 最近一次deep-scrub发现的不一致对象
+func (c *Commander) PgInconsistentObjects(pgid string) ([]InconsistentObject, error) {
+	if err := checkPgId(pgid); err != nil {
+		return nil, err
+	}
+	return c.rados.Rados_pg_inconsistent_objects(pgid)
+}
@@ -0,0 +1,186 @@
+package ceph
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommander_PgList(t *testing.T) {
+	rados := newConnectedFake(t)
+	commander := NewCommander(rados)
+
+	pgs, err := commander.PgList(PgFilter{Osd: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pgs) != 3*POOL_DEFAULT_PG_NUM {
+		t.Fatalf("pgs %d", len(pgs))
+	}
+	for _, pg := range pgs {
+		if pg.State != "active+clean" || len(pg.Up) != 3 || pg.UpPrimary != pg.Up[0] || len(pg.Acting) != 3 {
+			t.Fatalf("pg %+v", pg)
+		}
+	}
+
+	if err := rados.Rados_ioctx_create("rbd"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		if err := rados.Rados_write_full(name, []byte("data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pgs, err = commander.PgList(PgFilter{Pool: "rbd", Osd: -1})
+	if err != nil || len(pgs) != POOL_DEFAULT_PG_NUM {
+		t.Fatalf("pool pgs %d %v", len(pgs), err)
+	}
+	var objects, bytes int64
+	for _, pg := range pgs {
+		if !strings.HasPrefix(pg.PgId, "3.") {
+			t.Fatalf("pool pg %+v", pg)
+		}
+		objects += pg.StatSum.NumObjects
+		bytes += pg.StatSum.NumBytes
+	}
+	if objects != 4 || bytes != 16 {
+		t.Fatalf("objects %d bytes %d", objects, bytes)
+	}
+	if _, err := commander.PgList(PgFilter{Pool: "missing", Osd: -1}); err == nil {
+		t.Fatal("expected error for missing pool")
+	}
+
+	// osd down后pg降级
+	if _, err := commander.OsdDown([]int{2}); err != nil {
+		t.Fatal(err)
+	}
+	pgs, err = commander.PgList(PgFilter{Osd: 1, States: []string{"degraded"}})
+	if err != nil || len(pgs) != 3*POOL_DEFAULT_PG_NUM {
+		t.Fatalf("degraded pgs %d %v", len(pgs), err)
+	}
+	if pgs[0].State != "active+undersized+degraded" || hasOsd(pgs[0].Up, 2) {
+		t.Fatalf("degraded pg %+v", pgs[0])
+	}
+	pgs, err = commander.PgList(PgFilter{Osd: 2})
+	if err != nil || len(pgs) != 0 {
+		t.Fatalf("pgs on down osd %d %v", len(pgs), err)
+	}
+	pgs, err = commander.PgList(PgFilter{Pool: "rbd", Osd: -1, Stuck: "undersized"})
+	if err != nil || len(pgs) != POOL_DEFAULT_PG_NUM {
+		t.Fatalf("stuck pgs %d %v", len(pgs), err)
+	}
+	pgs, err = commander.PgList(PgFilter{Osd: -1, Stuck: "inactive"})
+	if err != nil || len(pgs) != 0 {
+		t.Fatalf("inactive pgs %d %v", len(pgs), err)
+	}
+	if _, err := commander.PgList(PgFilter{Osd: -1, Stuck: "bogus"}); err == nil {
+		t.Fatal("expected error for invalid stuck type")
+	}
+}
+
+func TestCommander_PgQuery(t *testing.T) {
+	rados := newConnectedFake(t)
+	commander := NewCommander(rados)
+
+	result, err := commander.PgQuery("1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result["state"] != "active+clean" || len(result["up"].([]interface{})) != 3 {
+		t.Fatalf("query %+v", result)
+	}
+	if _, err := commander.PgQuery("1.ff"); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("query missing pg %v", err)
+	}
+	if _, err := commander.PgQuery("1"); err == nil {
+		t.Fatal("expected error for invalid pg id")
+	}
+}
+
+func TestCommander_PgRepair(t *testing.T) {
+	rados := newConnectedFake(t)
+	commander := NewCommander(rados)
+
+	objects, err := commander.PgInconsistentObjects("1.0")
+	if err != nil || len(objects) != 0 {
+		t.Fatalf("inconsistent objects %+v %v", objects, err)
+	}
+	rados.cluster.pgs["1.0"] = &fakePg{inconsistent: []InconsistentObject{{
+		Object:           InconsistentObjectId{Name: "a", Snap: "head", Version: 1},
+		Errors:           []string{},
+		UnionShardErrors: []string{"data_digest_mismatch_info"},
+		Shards:           []InconsistentShard{{Osd: 0, Primary: true, Errors: []string{"data_digest_mismatch_info"}, Size: 4}},
+	}}}
+	pgs, err := commander.PgList(PgFilter{Osd: -1, States: []string{"inconsistent"}})
+	if err != nil || len(pgs) != 1 || pgs[0].PgId != "1.0" || pgs[0].State != "active+clean+inconsistent" || pgs[0].StatSum.NumScrubErrors != 1 {
+		t.Fatalf("inconsistent pgs %+v %v", pgs, err)
+	}
+	objects, err = commander.PgInconsistentObjects("1.0")
+	if err != nil || len(objects) != 1 || objects[0].Object.Name != "a" || objects[0].Shards[0].Osd != 0 {
+		t.Fatalf("inconsistent objects %+v %v", objects, err)
+	}
+	if _, err := commander.PgInconsistentObjects("9.0"); err == nil {
+		t.Fatal("expected error for missing pg")
+	}
+
+	before := pgs[0].LastDeepScrubStamp
+	outs, err := commander.PgDeepScrub([]string{"1.0", "1.1"})
+	if err != nil || len(outs) != 2 || !strings.Contains(outs[0], "deep-scrub") {
+		t.Fatalf("deep-scrub %v %v", outs, err)
+	}
+	pgs, _ = commander.PgList(PgFilter{Osd: -1, States: []string{"inconsistent"}})
+	if len(pgs) != 1 || pgs[0].LastDeepScrubStamp == before {
+		t.Fatalf("after deep-scrub %+v", pgs)
+	}
+	if _, err := commander.PgRepair([]string{"1.0"}); err != nil {
+		t.Fatal(err)
+	}
+	pgs, _ = commander.PgList(PgFilter{Osd: -1, States: []string{"inconsistent"}})
+	if len(pgs) != 0 {
+		t.Fatalf("after repair %+v", pgs)
+	}
+	if _, err := commander.PgScrub([]string{"1.0", "bad"}); err == nil {
+		t.Fatal("expected error for invalid pg id")
+	}
+	if _, err := commander.PgScrub([]string{"9.0"}); err == nil || !strings.Contains(err.Error(), "dne") {
+		t.Fatalf("scrub missing pg %v", err)
+	}
+	if _, err := commander.PgScrub(nil); err == nil {
+		t.Fatal("expected error for empty pg ids")
+	}
+}
+
+// ceph文档中rados list-inconsistent-obj的输出
+func TestDecodeInconsistentObjects(t *testing.T) {
+	data := `{
+	"epoch": 14,
+	"inconsistents": [{
+		"object": {"name": "foo", "nspace": "", "locator": "", "snap": "head", "version": 1},
+		"errors": ["data_digest_mismatch", "size_mismatch"],
+		"union_shard_errors": ["data_digest_mismatch_info", "size_mismatch_info"],
+		"selected_object_info": "0:602f83fe:::foo:head(16'1 client.4110.0:1 dirty|data_digest|omap_digest s 968 uv 1 dd e978e67f od ffffffff alloc_hint [0 0 0])",
+		"shards": [
+			{"osd": 0, "primary": false, "errors": [], "size": 968, "omap_digest": "0xffffffff", "data_digest": "0xe978e67f"},
+			{"osd": 1, "primary": true, "errors": [], "size": 968, "omap_digest": "0xffffffff", "data_digest": "0xe978e67f"},
+			{"osd": 2, "primary": false, "errors": ["data_digest_mismatch_info", "size_mismatch_info"], "size": 0, "omap_digest": "0xffffffff", "data_digest": "0xffffffff"}
+		]
+	}]
+}`
+	objects, err := decodeInconsistentObjects("1.0", []byte(data))
+	if err != nil || len(objects) != 1 {
+		t.Fatalf("objects %+v %v", objects, err)
+	}
+	o := objects[0]
+	if o.Object.Name != "foo" || o.Object.Snap != "head" || o.Object.Version != 1 || len(o.Errors) != 2 || len(o.UnionShardErrors) != 2 {
+		t.Fatalf("object %+v", o)
+	}
+	if len(o.Shards) != 3 || !o.Shards[1].Primary || o.Shards[2].Osd != 2 || len(o.Shards[2].Errors) != 2 || o.Shards[0].Size != 968 {
+		t.Fatalf("shards %+v", o.Shards)
+	}
+
+	if objects, err := decodeInconsistentObjects("1.0", []byte(`{"epoch": 14, "inconsistents": []}`)); err != nil || objects == nil || len(objects) != 0 {
+		t.Fatalf("empty %+v %v", objects, err)
+	}
+	if _, err := decodeInconsistentObjects("1.0", []byte(`[]`)); err == nil {
+		t.Fatal("expected error for invalid output")
+	}
+}
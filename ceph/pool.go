@@ -0,0 +1,170 @@
+package ceph
+
+// 存储池
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	POOL_DEFAULT_PG_NUM = 32
+	POOL_MAX_SIZE       = 10
+
+	POOL_TYPE_REPLICATED = "replicated"
+	POOL_TYPE_ERASURE    = "erasure"
+)
+
+type Pool struct {
+	Id              int64    `json:"id"`
+	Name            string   `json:"name"`
+	Type            string   `json:"type"`
+	Size            int      `json:"size"`
+	MinSize         int      `json:"min_size"`
+	PgNum           int      `json:"pg_num"`
+	PgpNum          int      `json:"pgp_num"`
+	CrushRule       int      `json:"crush_rule"`
+	QuotaMaxBytes   uint64   `json:"quota_max_bytes"`
+	QuotaMaxObjects uint64   `json:"quota_max_objects"`
+	Applications    []string `json:"applications"`
+}
+
+// 0表示不限制
+type PoolQuota struct {
+	MaxObjects uint64 `json:"max_objects"`
+	MaxBytes   uint64 `json:"max_bytes"`
+}
+
+type PoolStat struct {
+	NumBytes                   uint64 `json:"num_bytes"`
+	NumKb                      uint64 `json:"num_kb"`
+	NumObjects                 uint64 `json:"num_objects"`
+	NumObjectClones            uint64 `json:"num_object_clones"`
+	NumObjectCopies            uint64 `json:"num_object_copies"`
+	NumObjectsMissingOnPrimary uint64 `json:"num_objects_missing_on_primary"`
+	NumObjectsUnfound          uint64 `json:"num_objects_unfound"`
+	NumObjectsDegraded         uint64 `json:"num_objects_degraded"`
+	NumRd                      uint64 `json:"num_rd"`
+	NumRdKb                    uint64 `json:"num_rd_kb"`
+	NumWr                      uint64 `json:"num_wr"`
+	NumWrKb                    uint64 `json:"num_wr_kb"`
+}
+
+// 存储池快照
+type PoolSnap struct {
+	Id    uint64    `json:"id"`
+	Name  string    `json:"name"`
+	Stamp time.Time `json:"stamp"`
+}
+
+type PoolCreateOptions struct {
+	PgNum     int    // pg数量，0表示POOL_DEFAULT_PG_NUM
+	Size      int    // 副本数，0表示使用集群默认值
+	CrushRule string // crush规则名称，空表示使用默认规则
+}
+
+func checkPoolName(pool_name string) error {
+	if pool_name == "" {
+		return errors.New("pool name is empty")
+	}
+	return nil
+}
+
+// 删除存储池需要再次输入存储池名称确认
+func checkPoolDelete(pool_name string, confirm string) error {
+	if err := checkPoolName(pool_name); err != nil {
+		return err
+	}
+	if confirm != pool_name {
+		return errors.New("delete pool[" + pool_name + "] is not confirmed, repeat the pool name to confirm")
+	}
+	return nil
+}
+
+func (opts *PoolCreateOptions) check() error {
+	if opts.PgNum < 0 {
+		return errors.New("pg_num must not be negative")
+	}
+	if opts.PgNum == 0 {
+		opts.PgNum = POOL_DEFAULT_PG_NUM
+	}
+	if opts.Size < 0 || opts.Size > POOL_MAX_SIZE {
+		return errors.New("pool size must be between 1 and " + strconv.Itoa(POOL_MAX_SIZE) + ", or 0 for the cluster default")
+	}
+	return nil
+}
+
+// osd dump输出中的存储池
+type osdDumpPool struct {
+	Pool                int64                  `json:"pool"`
+	PoolName            string                 `json:"pool_name"`
+	Type                int                    `json:"type"`
+	Size                int                    `json:"size"`
+	MinSize             int                    `json:"min_size"`
+	CrushRule           int                    `json:"crush_rule"`
+	PgNum               int                    `json:"pg_num"`
+	PgPlacementNum      int                    `json:"pg_placement_num"`
+	QuotaMaxBytes       uint64                 `json:"quota_max_bytes"`
+	QuotaMaxObjects     uint64                 `json:"quota_max_objects"`
+	ApplicationMetadata map[string]interface{} `json:"application_metadata"`
+}
+
+// 与pg_pool_t::TYPE_*一致
+func poolTypeName(t int) string {
+	switch t {
+	case 1:
+		return POOL_TYPE_REPLICATED
+	case 3:
+		return POOL_TYPE_ERASURE
+	default:
+		return "unknown"
+	}
+}
+
+func parseOsdDumpPools(out []byte) ([]Pool, error) {
+	dump := struct {
+		Pools []osdDumpPool `json:"pools"`
+	}{}
+	if err := json.Unmarshal(out, &dump); err != nil {
+		return nil, errors.New("cannot decode osd dump: " + err.Error())
+	}
+	pools := []Pool{}
+	for _, p := range dump.Pools {
+		pool := Pool{
+			Id:              p.Pool,
+			Name:            p.PoolName,
+			Type:            poolTypeName(p.Type),
+			Size:            p.Size,
+			MinSize:         p.MinSize,
+			PgNum:           p.PgNum,
+			PgpNum:          p.PgPlacementNum,
+			CrushRule:       p.CrushRule,
+			QuotaMaxBytes:   p.QuotaMaxBytes,
+			QuotaMaxObjects: p.QuotaMaxObjects,
+			Applications:    []string{},
+		}
+		for app := range p.ApplicationMetadata {
+			pool.Applications = append(pool.Applications, app)
+		}
+		sort.Strings(pool.Applications)
+		pools = append(pools, pool)
+	}
+	return pools, nil
+}
+
+func parsePoolQuota(out []byte) (PoolQuota, error) {
+	quota := PoolQuota{}
+	data := struct {
+		QuotaMaxObjects uint64 `json:"quota_max_objects"`
+		QuotaMaxBytes   uint64 `json:"quota_max_bytes"`
+	}{}
+	if err := json.Unmarshal(out, &data); err != nil {
+		return quota, errors.New("cannot decode pool quota: " + err.Error())
+	}
+	quota.MaxObjects = data.QuotaMaxObjects
+	quota.MaxBytes = data.QuotaMaxBytes
+	return quota, nil
+}
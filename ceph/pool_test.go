@@ -0,0 +1,58 @@
+package ceph
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseOsdDumpPools(t *testing.T) {
+	out := []byte(`{"epoch": 42, "pools": [
+		{"pool": 1, "pool_name": "rbd", "type": 1, "size": 3, "min_size": 2, "crush_rule": 0,
+		 "pg_num": 64, "pg_placement_num": 64, "quota_max_bytes": 1024, "quota_max_objects": 0,
+		 "application_metadata": {"rbd": {}}},
+		{"pool": 2, "pool_name": "ec", "type": 3, "size": 6, "min_size": 5, "crush_rule": 1,
+		 "pg_num": 32, "pg_placement_num": 32, "quota_max_bytes": 0, "quota_max_objects": 0,
+		 "application_metadata": {}}
+	]}`)
+	pools, err := parseOsdDumpPools(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pools) != 2 {
+		t.Fatalf("pools %+v", pools)
+	}
+	if pools[0].Name != "rbd" || pools[0].Type != POOL_TYPE_REPLICATED || pools[0].QuotaMaxBytes != 1024 || pools[0].Applications[0] != "rbd" {
+		t.Fatalf("pool %+v", pools[0])
+	}
+	if pools[1].Type != POOL_TYPE_ERASURE || pools[1].PgpNum != 32 {
+		t.Fatalf("pool %+v", pools[1])
+	}
+}
+
+func TestCheckPoolDelete(t *testing.T) {
+	if err := checkPoolDelete("rbd", ""); err == nil {
+		t.Fatal("expected missing confirmation to fail")
+	}
+	if err := checkPoolDelete("rbd", "rbd"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPoolCreateOptions_check(t *testing.T) {
+	// 0表示使用集群默认的副本数
+	for _, size := range []int{0, 1, POOL_MAX_SIZE} {
+		opts := PoolCreateOptions{Size: size}
+		if err := opts.check(); err != nil || opts.Size != size || opts.PgNum != POOL_DEFAULT_PG_NUM {
+			t.Fatalf("size %d %+v %v", size, opts, err)
+		}
+	}
+	for _, size := range []int{-1, POOL_MAX_SIZE + 1} {
+		opts := PoolCreateOptions{Size: size}
+		if err := opts.check(); err == nil || !strings.Contains(err.Error(), "0 for the cluster default") {
+			t.Fatalf("size %d %v", size, err)
+		}
+	}
+	if err := (&PoolCreateOptions{PgNum: -1}).check(); err == nil {
+		t.Fatal("expected negative pg_num to fail")
+	}
+}
@@ -1,14 +1,505 @@
 package ceph
 
+// 对象存储网关，通过rgw的HTTP admin ops接口管理用户和存储桶
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RGW_ADMIN_PATH     = "/admin"
+	RGW_DEFAULT_REGION = "us-east-1"
+	RGW_TIMEOUT        = 30 * time.Second
+
+	RGW_QUOTA_USER   = "user"
+	RGW_QUOTA_BUCKET = "bucket"
+)
+
+type RgwConfig struct {
+	Endpoint  string // 如http://127.0.0.1:7480
+	AccessKey string // 需有users、buckets、usage、metadata权限
+	SecretKey string
+	AdminPath string // 默认/admin
+	Signature string // v2或v4，默认v4
+	Region    string // v4签名使用，默认us-east-1
+	Timeout   time.Duration
+}
+
+// rgw返回的错误，Code如NoSuchUser、NoSuchBucket
+type RgwError struct {
+	Op     string
+	Status int
+	Code   string
+}
+
+func (e *RgwError) Error() string {
+	return "cannot " + e.Op + " " + e.Code + " " + fmt.Sprintf("%v", e.Status)
+}
+
+// 错误码为code的RgwError
+func IsRgwError(err error, code string) bool {
+	e, ok := err.(*RgwError)
+	return ok && e.Code == code
+}
+
+type RgwKey struct {
+	User      string `json:"user"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+}
+
+type RgwCap struct {
+	Type string `json:"type"`
+	Perm string `json:"perm"`
+}
+
+// 配额，max_size和max_objects为-1时不限制
+type RgwQuota struct {
+	Enabled    bool  `json:"enabled"`
+	CheckOnRaw bool  `json:"check_on_raw"`
+	MaxSize    int64 `json:"max_size"`
+	MaxSizeKb  int64 `json:"max_size_kb"`
+	MaxObjects int64 `json:"max_objects"`
+}
+
+type RgwUserStats struct {
+	Size       uint64 `json:"size"`
+	SizeActual uint64 `json:"size_actual"`
+	NumObjects uint64 `json:"num_objects"`
+}
+
+type RgwUser struct {
+	UserId      string        `json:"user_id"`
+	DisplayName string        `json:"display_name"`
+	Email       string        `json:"email"`
+	Suspended   int           `json:"suspended"`
+	MaxBuckets  int           `json:"max_buckets"`
+	Keys        []RgwKey      `json:"keys"`
+	Caps        []RgwCap      `json:"caps"`
+	BucketQuota RgwQuota      `json:"bucket_quota"`
+	UserQuota   RgwQuota      `json:"user_quota"`
+	Stats       *RgwUserStats `json:"stats,omitempty"`
+}
+
+// 创建或修改用户，修改时为空的字段保持不变
+type RgwUserOptions struct {
+	Uid         string
+	DisplayName string
+	Email       string
+	MaxBuckets  *int
+	AccessKey   string // 创建时与SecretKey都为空则自动生成
+	SecretKey   string
+}
+
+func (o RgwUserOptions) params() url.Values {
+	params := url.Values{"uid": {o.Uid}}
+	if o.DisplayName != "" {
+		params.Set("display-name", o.DisplayName)
+	}
+	if o.Email != "" {
+		params.Set("email", o.Email)
+	}
+	if o.MaxBuckets != nil {
+		params.Set("max-buckets", strconv.Itoa(*o.MaxBuckets))
+	}
+	return params
+}
+
+type RgwBucketUsage struct {
+	Size       uint64 `json:"size"`
+	SizeActual uint64 `json:"size_actual"`
+	SizeKb     uint64 `json:"size_kb"`
+	NumObjects uint64 `json:"num_objects"`
+}
+
+type RgwBucket struct {
+	Bucket        string                    `json:"bucket"`
+	Id            string                    `json:"id"`
+	Marker        string                    `json:"marker"`
+	Owner         string                    `json:"owner"`
+	NumShards     int                       `json:"num_shards"`
+	Zonegroup     string                    `json:"zonegroup"`
+	PlacementRule string                    `json:"placement_rule"`
+	Mtime         string                    `json:"mtime"`
+	Usage         map[string]RgwBucketUsage `json:"usage"` // 如rgw.main
+	BucketQuota   RgwQuota                  `json:"bucket_quota"`
+}
+
+type RgwUsageCategory struct {
+	Category      string `json:"category"`
+	BytesSent     uint64 `json:"bytes_sent"`
+	BytesReceived uint64 `json:"bytes_received"`
+	Ops           uint64 `json:"ops"`
+	SuccessfulOps uint64 `json:"successful_ops"`
+}
+
+type RgwUsageBucket struct {
+	Bucket     string             `json:"bucket"`
+	Time       string             `json:"time"`
+	Epoch      int64              `json:"epoch"`
+	Owner      string             `json:"owner"`
+	Categories []RgwUsageCategory `json:"categories"`
+}
+
+type RgwUsageEntry struct {
+	User    string           `json:"user"`
+	Buckets []RgwUsageBucket `json:"buckets"`
+}
+
+type RgwUsageSummary struct {
+	User       string             `json:"user"`
+	Categories []RgwUsageCategory `json:"categories"`
+	Total      RgwUsageCategory   `json:"total"`
+}
+
+type RgwUsage struct {
+	Entries []RgwUsageEntry   `json:"entries"`
+	Summary []RgwUsageSummary `json:"summary"`
+}
+
+// 使用量查询条件，为空时不限制
+type RgwUsageOptions struct {
+	Uid         string
+	Bucket      string
+	Start       time.Time
+	End         time.Time
+	ShowEntries bool // 按存储桶和小时的明细
+}
+
 // 对象存储网关
 type RadosGW interface {
-	LibRados
+	UserList() ([]string, error)
+	// 包括使用量统计
+	UserInfo(uid string) (*RgwUser, error)
+	UserCreate(opts RgwUserOptions) (*RgwUser, error)
+	UserModify(opts RgwUserOptions) (*RgwUser, error)
+	UserSuspend(uid string, suspended bool) error
+	// purge_data为true时同时删除用户的存储桶和对象
+	UserRemove(uid string, purge_data bool) error
+
+	// access_key和secret_key都为空时自动生成，返回用户的所有密钥
+	KeyCreate(uid string, access_key string, secret_key string) ([]RgwKey, error)
+	KeyRemove(uid string, access_key string) error
+
+	// quota_type为RGW_QUOTA_USER或RGW_QUOTA_BUCKET
+	QuotaGet(uid string, quota_type string) (RgwQuota, error)
+	QuotaSet(uid string, quota_type string, quota RgwQuota) error
+
+	Usage(opts RgwUsageOptions) (*RgwUsage, error)
+
+	// uid为空时返回所有存储桶
+	BucketList(uid string) ([]string, error)
+	BucketInfo(bucket string) (*RgwBucket, error)
+	// 将存储桶转给uid
+	BucketLink(bucket string, bucket_id string, uid string) error
+	BucketUnlink(bucket string, uid string) error
+	// purge_objects为false时只能删除空的存储桶
+	BucketRemove(bucket string, purge_objects bool) error
+
+	// S3接口，见libRGW.go
+	ListBuckets() ([]S3Bucket, error)
+	ListObjects(bucket string, opts S3ListOptions) (*S3ObjectList, error)
+	HeadObject(bucket string, key string) (*S3ObjectInfo, error)
+	GetObject(bucket string, key string, offset int64, length int64) (io.ReadCloser, *S3ObjectInfo, error)
+	PutObject(bucket string, key string, body io.Reader, size int64, content_type string) (etag string, err error)
+	DeleteObject(bucket string, key string) error
+	CreateMultipartUpload(bucket string, key string, content_type string) (upload_id string, err error)
+	UploadPart(bucket string, key string, upload_id string, part_number int, body io.Reader, size int64) (etag string, err error)
+	CompleteMultipartUpload(bucket string, key string, upload_id string, parts []S3Part) (etag string, err error)
+	AbortMultipartUpload(bucket string, key string, upload_id string) error
+	ListMultipartUploads(bucket string) ([]S3Upload, error)
+	UploadObject(bucket string, key string, body io.Reader, size int64, content_type string, part_size int64) (etag string, err error)
+	PresignObject(method string, bucket string, key string, expires time.Duration) (string, error)
 }
 
 type radosGW struct {
-	libRados
+	config RgwConfig
+	client *http.Client // 管理接口及xml请求，限制整个请求的时长
+	stream *http.Client // 对象数据的读写，耗时取决于数据大小，只限制连接及等待响应头的时长
+	now    func() time.Time
+}
+
+func NewRadosGW(config RgwConfig) (RadosGW, error) {
+	return newRadosGW(config)
+}
+
+func newRadosGW(config RgwConfig) (*radosGW, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, errors.New("invalid rgw endpoint[" + config.Endpoint + "]")
+	}
+	if config.AccessKey == "" || config.SecretKey == "" {
+		return nil, errors.New("rgw access key or secret key is empty")
+	}
+	config.Endpoint = strings.TrimRight(config.Endpoint, "/")
+	if config.AdminPath == "" {
+		config.AdminPath = RGW_ADMIN_PATH
+	}
+	if config.Signature == "" {
+		config.Signature = RGW_SIGNATURE_V4
+	}
+	if config.Signature != RGW_SIGNATURE_V2 && config.Signature != RGW_SIGNATURE_V4 {
+		return nil, errors.New("invalid rgw signature version[" + config.Signature + "]")
+	}
+	if config.Region == "" {
+		config.Region = RGW_DEFAULT_REGION
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = RGW_TIMEOUT
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: config.Timeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.ResponseHeaderTimeout = config.Timeout
+	return &radosGW{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout, Transport: transport},
+		stream: &http.Client{Transport: transport},
+		now:    time.Now,
+	}, nil
+}
+
+// 签名并通过client发送请求，body可为nil，payload_hash为空时不签名请求体
+func (gw *radosGW) do(client *http.Client, method string, path string, query url.Values, header http.Header, body io.Reader, length int64, payload_hash string) (*http.Response, error) {
+	u := gw.config.Endpoint + rgwEscape(path, true)
+	if len(query) > 0 {
+		u += "?" + rgwCanonicalQuery(query)
+	}
+	r, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		r.Header[key] = values
+	}
+	if body != nil {
+		r.ContentLength = length
+	}
+	if gw.config.Signature == RGW_SIGNATURE_V2 {
+		SignRgwV2(r, gw.config.AccessKey, gw.config.SecretKey, gw.now())
+	} else {
+		SignRgwV4(r, gw.config.AccessKey, gw.config.SecretKey, gw.config.Region, payload_hash, gw.now())
+	}
+	return client.Do(r)
+}
+
+// rgw的错误响应
+func rgwResponseError(op string, resp *http.Response) error {
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	e := &RgwError{Op: op, Status: resp.StatusCode, Code: http.StatusText(resp.StatusCode)}
+	result := struct {
+		Code string `json:"Code"`
+	}{}
+	if json.Unmarshal(data, &result) == nil && result.Code != "" {
+		e.Code = result.Code
+	} else if code := xmlErrorCode(data); code != "" {
+		e.Code = code
+	}
+	return e
+}
+
+// S3接口的错误为xml格式
+func xmlErrorCode(data []byte) string {
+	start := bytes.Index(data, []byte("<Code>"))
+	end := bytes.Index(data, []byte("</Code>"))
+	if start < 0 || end < start {
+		return ""
+	}
+	return string(data[start+len("<Code>") : end])
+}
+
+// admin ops请求，结果为json
+func (gw *radosGW) admin(op string, method string, resource string, params url.Values, body interface{}, result interface{}) error {
+	params.Set("format", "json")
+	var reader io.Reader
+	payload := []byte{}
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = data
+		reader = bytes.NewReader(data)
+	}
+	resp, err := gw.do(gw.client, method, gw.config.AdminPath+resource, params, nil, reader, int64(len(payload)), sha256Hex(payload))
+	if err != nil {
+		return errors.New("cannot " + op + " " + err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return rgwResponseError(op, resp)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return errors.New("cannot " + op + " decode response " + err.Error())
+	}
+	return nil
+}
+
+func (gw *radosGW) UserList() ([]string, error) {
+	users := []string{}
+	err := gw.admin("list rgw users", http.MethodGet, "/metadata/user", url.Values{}, nil, &users)
+	return users, err
+}
+
+func (gw *radosGW) UserInfo(uid string) (*RgwUser, error) {
+	user := &RgwUser{}
+	params := url.Values{"uid": {uid}, "stats": {"true"}}
+	if err := gw.admin("get rgw user["+uid+"]", http.MethodGet, "/user", params, nil, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (gw *radosGW) UserCreate(opts RgwUserOptions) (*RgwUser, error) {
+	if opts.Uid == "" || opts.DisplayName == "" {
+		return nil, errors.New("cannot create rgw user uid or display name is empty")
+	}
+	params := opts.params()
+	params.Set("key-type", "s3")
+	if opts.AccessKey == "" && opts.SecretKey == "" {
+		params.Set("generate-key", "true")
+	} else {
+		params.Set("access-key", opts.AccessKey)
+		params.Set("secret-key", opts.SecretKey)
+	}
+	user := &RgwUser{}
+	if err := gw.admin("create rgw user["+opts.Uid+"]", http.MethodPut, "/user", params, nil, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (gw *radosGW) UserModify(opts RgwUserOptions) (*RgwUser, error) {
+	user := &RgwUser{}
+	if err := gw.admin("modify rgw user["+opts.Uid+"]", http.MethodPost, "/user", opts.params(), nil, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (gw *radosGW) UserSuspend(uid string, suspended bool) error {
+	params := url.Values{"uid": {uid}, "suspended": {strconv.FormatBool(suspended)}}
+	return gw.admin("suspend rgw user["+uid+"]", http.MethodPost, "/user", params, nil, nil)
+}
+
+func (gw *radosGW) UserRemove(uid string, purge_data bool) error {
+	params := url.Values{"uid": {uid}, "purge-data": {strconv.FormatBool(purge_data)}}
+	return gw.admin("remove rgw user["+uid+"]", http.MethodDelete, "/user", params, nil, nil)
+}
+
+func (gw *radosGW) KeyCreate(uid string, access_key string, secret_key string) ([]RgwKey, error) {
+	params := url.Values{"key": {""}, "uid": {uid}, "key-type": {"s3"}}
+	if access_key == "" && secret_key == "" {
+		params.Set("generate-key", "true")
+	} else {
+		params.Set("access-key", access_key)
+		params.Set("secret-key", secret_key)
+	}
+	keys := []RgwKey{}
+	err := gw.admin("create rgw key of user["+uid+"]", http.MethodPut, "/user", params, nil, &keys)
+	return keys, err
+}
+
+func (gw *radosGW) KeyRemove(uid string, access_key string) error {
+	params := url.Values{"key": {""}, "uid": {uid}, "key-type": {"s3"}, "access-key": {access_key}}
+	return gw.admin("remove rgw key["+access_key+"]", http.MethodDelete, "/user", params, nil, nil)
+}
+
+func checkQuotaType(quota_type string) error {
+	if quota_type != RGW_QUOTA_USER && quota_type != RGW_QUOTA_BUCKET {
+		return errors.New("invalid quota type[" + quota_type + "]")
+	}
+	return nil
+}
+
+func (gw *radosGW) QuotaGet(uid string, quota_type string) (RgwQuota, error) {
+	quota := RgwQuota{}
+	if err := checkQuotaType(quota_type); err != nil {
+		return quota, err
+	}
+	params := url.Values{"quota": {""}, "uid": {uid}, "quota-type": {quota_type}}
+	err := gw.admin("get rgw "+quota_type+" quota of user["+uid+"]", http.MethodGet, "/user", params, nil, &quota)
+	return quota, err
+}
+
+func (gw *radosGW) QuotaSet(uid string, quota_type string, quota RgwQuota) error {
+	if err := checkQuotaType(quota_type); err != nil {
+		return err
+	}
+	params := url.Values{"quota": {""}, "uid": {uid}, "quota-type": {quota_type}}
+	return gw.admin("set rgw "+quota_type+" quota of user["+uid+"]", http.MethodPut, "/user", params, quota, nil)
+}
+
+func (gw *radosGW) Usage(opts RgwUsageOptions) (*RgwUsage, error) {
+	params := url.Values{
+		"show-entries": {strconv.FormatBool(opts.ShowEntries)},
+		"show-summary": {"true"},
+	}
+	if opts.Uid != "" {
+		params.Set("uid", opts.Uid)
+	}
+	if opts.Bucket != "" {
+		params.Set("bucket", opts.Bucket)
+	}
+	if !opts.Start.IsZero() {
+		params.Set("start", opts.Start.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if !opts.End.IsZero() {
+		params.Set("end", opts.End.UTC().Format("2006-01-02 15:04:05"))
+	}
+	usage := &RgwUsage{}
+	if err := gw.admin("get rgw usage", http.MethodGet, "/usage", params, nil, usage); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+func (gw *radosGW) BucketList(uid string) ([]string, error) {
+	params := url.Values{}
+	if uid != "" {
+		params.Set("uid", uid)
+	}
+	buckets := []string{}
+	err := gw.admin("list rgw buckets", http.MethodGet, "/bucket", params, nil, &buckets)
+	return buckets, err
+}
+
+func (gw *radosGW) BucketInfo(bucket string) (*RgwBucket, error) {
+	info := &RgwBucket{}
+	params := url.Values{"bucket": {bucket}, "stats": {"true"}}
+	if err := gw.admin("get rgw bucket["+bucket+"]", http.MethodGet, "/bucket", params, nil, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (gw *radosGW) BucketLink(bucket string, bucket_id string, uid string) error {
+	params := url.Values{"bucket": {bucket}, "uid": {uid}}
+	if bucket_id != "" {
+		params.Set("bucket-id", bucket_id)
+	}
+	return gw.admin("link rgw bucket["+bucket+"] to user["+uid+"]", http.MethodPut, "/bucket", params, nil, nil)
+}
+
+func (gw *radosGW) BucketUnlink(bucket string, uid string) error {
+	params := url.Values{"bucket": {bucket}, "uid": {uid}}
+	return gw.admin("unlink rgw bucket["+bucket+"] from user["+uid+"]", http.MethodPost, "/bucket", params, nil, nil)
 }
 
-func NewRadosGW() *radosGW {
-	return &radosGW{}
+func (gw *radosGW) BucketRemove(bucket string, purge_objects bool) error {
+	params := url.Values{"bucket": {bucket}, "purge-objects": {strconv.FormatBool(purge_objects)}}
+	return gw.admin("remove rgw bucket["+bucket+"]", http.MethodDelete, "/bucket", params, nil, nil)
 }
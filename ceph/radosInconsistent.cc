@@ -0,0 +1,239 @@
+//go:build rados
+// +build rados
+
+// 通过librados的C++接口获取pg中的不一致对象，输出格式与rados list-inconsistent-obj一致
+
+#include <cerrno>
+#include <cstdio>
+#include <cstdlib>
+#include <cstring>
+#include <new>
+#include <string>
+#include <vector>
+#include <rados/librados.hpp>
+#include "radosInconsistent.h"
+
+namespace {
+
+// 每次获取的对象数，与rados命令一致
+const unsigned MAX_ITEMS = 32;
+
+// 对象的snap，与ceph的CEPH_NOSNAP、CEPH_SNAPDIR一致
+const uint64_t SNAP_HEAD = (uint64_t)-2;
+const uint64_t SNAP_DIR = (uint64_t)-1;
+
+void json_string(std::string &out, const std::string &s)
+{
+	out += '"';
+	for (unsigned char c : s) {
+		switch (c) {
+		case '"':
+			out += "\\\"";
+			break;
+		case '\\':
+			out += "\\\\";
+			break;
+		default:
+			if (c < 0x20) {
+				char buf[8];
+				snprintf(buf, sizeof(buf), "\\u%04x", c);
+				out += buf;
+			} else {
+				out += c;
+			}
+		}
+	}
+	out += '"';
+}
+
+void json_errors(std::string &out, const char *key, const std::vector<const char *> &errors)
+{
+	out += '"';
+	out += key;
+	out += "\":[";
+	for (size_t i = 0; i < errors.size(); i++) {
+		if (i > 0)
+			out += ',';
+		json_string(out, errors[i]);
+	}
+	out += ']';
+}
+
+// 分片的错误，与rados.cc的dump_errors一致
+std::vector<const char *> shard_errors(const librados::err_t &err)
+{
+	std::vector<const char *> errors;
+	if (err.has_shard_missing())
+		errors.push_back("missing");
+	if (err.has_stat_error())
+		errors.push_back("stat_error");
+	if (err.has_read_error())
+		errors.push_back("read_error");
+	if (err.has_data_digest_mismatch_info())
+		errors.push_back("data_digest_mismatch_info");
+	if (err.has_omap_digest_mismatch_info())
+		errors.push_back("omap_digest_mismatch_info");
+	if (err.has_size_mismatch_info())
+		errors.push_back("size_mismatch_info");
+	if (err.has_ec_hash_error())
+		errors.push_back("ec_hash_error");
+	if (err.has_ec_size_error())
+		errors.push_back("ec_size_error");
+	if (err.has_info_missing())
+		errors.push_back("info_missing");
+	if (err.has_info_corrupted())
+		errors.push_back("info_corrupted");
+	if (err.has_obj_size_info_mismatch())
+		errors.push_back("obj_size_info_mismatch");
+	if (err.has_snapset_missing())
+		errors.push_back("snapset_missing");
+	if (err.has_snapset_corrupted())
+		errors.push_back("snapset_corrupted");
+	if (err.has_hinfo_missing())
+		errors.push_back("hinfo_missing");
+	if (err.has_hinfo_corrupted())
+		errors.push_back("hinfo_corrupted");
+	return errors;
+}
+
+// 对象的错误，与rados.cc的dump_object_errors一致
+std::vector<const char *> object_errors(const librados::obj_err_t &err)
+{
+	std::vector<const char *> errors;
+	if (err.has_object_info_inconsistency())
+		errors.push_back("object_info_inconsistency");
+	if (err.has_data_digest_mismatch())
+		errors.push_back("data_digest_mismatch");
+	if (err.has_omap_digest_mismatch())
+		errors.push_back("omap_digest_mismatch");
+	if (err.has_size_mismatch())
+		errors.push_back("size_mismatch");
+	if (err.has_attr_value_mismatch())
+		errors.push_back("attr_value_mismatch");
+	if (err.has_attr_name_mismatch())
+		errors.push_back("attr_name_mismatch");
+	if (err.has_snapset_inconsistency())
+		errors.push_back("snapset_inconsistency");
+	if (err.has_hinfo_inconsistency())
+		errors.push_back("hinfo_inconsistency");
+	if (err.has_size_too_large())
+		errors.push_back("size_too_large");
+	return errors;
+}
+
+void json_object_id(std::string &out, const librados::object_id_t &object, uint64_t version)
+{
+	out += "{\"name\":";
+	json_string(out, object.name);
+	out += ",\"nspace\":";
+	json_string(out, object.nspace);
+	out += ",\"locator\":";
+	json_string(out, object.locator);
+	out += ",\"snap\":";
+	if (object.snap == SNAP_HEAD)
+		out += "\"head\"";
+	else if (object.snap == SNAP_DIR)
+		out += "\"snapdir\"";
+	else
+		out += std::to_string(object.snap);
+	out += ",\"version\":";
+	out += std::to_string(version);
+	out += '}';
+}
+
+void json_inconsistent(std::string &out, const librados::inconsistent_obj_t &inc)
+{
+	out += "{\"object\":";
+	json_object_id(out, inc.object, inc.version);
+	out += ',';
+	json_errors(out, "errors", object_errors(inc));
+	out += ',';
+	json_errors(out, "union_shard_errors", shard_errors(inc.union_shards));
+	out += ",\"shards\":[";
+	bool first = true;
+	for (auto &shard : inc.shards) {
+		if (!first)
+			out += ',';
+		first = false;
+		out += "{\"osd\":";
+		out += std::to_string(shard.first.osd);
+		out += ",\"primary\":";
+		out += shard.second.primary ? "true" : "false";
+		// 副本存储池的分片序号为-1
+		if (shard.first.shard >= 0) {
+			out += ",\"shard\":";
+			out += std::to_string(shard.first.shard);
+		}
+		out += ',';
+		json_errors(out, "errors", shard_errors(shard.second));
+		if (!shard.second.has_shard_missing() && !shard.second.has_stat_error()) {
+			out += ",\"size\":";
+			out += std::to_string(shard.second.size);
+		}
+		out += '}';
+	}
+	out += "]}";
+}
+
+int inconsistent_objects(rados_t cluster, const char *pgstr, std::string &out)
+{
+	librados::Rados rados;
+	librados::Rados::from_rados_t(cluster, rados);
+	librados::PlacementGroup pg;
+	if (!pg.parse(pgstr))
+		return -EINVAL;
+
+	uint32_t interval = 0;
+	bool opened = false;
+	bool first = true;
+	for (librados::object_id_t start;;) {
+		std::vector<librados::inconsistent_obj_t> items;
+		librados::AioCompletion *c = librados::Rados::aio_create_completion();
+		int ret = rados.get_inconsistent_objects(pg, start, MAX_ITEMS, c, &items, &interval);
+		if (ret >= 0) {
+			c->wait_for_complete();
+			ret = c->get_return_value();
+		}
+		c->release();
+		// -ENOENT为pg没有scrub记录，-EAGAIN为获取期间pg的interval发生变化
+		if (ret < 0)
+			return ret;
+		if (!opened) {
+			opened = true;
+			out += "{\"epoch\":";
+			out += std::to_string(interval);
+			out += ",\"inconsistents\":[";
+		}
+		for (auto &inc : items) {
+			if (!first)
+				out += ',';
+			first = false;
+			json_inconsistent(out, inc);
+		}
+		if (items.size() < MAX_ITEMS)
+			break;
+		start = items.back().object;
+	}
+	out += "]}";
+	return 0;
+}
+
+}
+
+extern "C" int rados_pg_inconsistent_objects_json(rados_t cluster, const char *pgstr, char **out, size_t *outlen)
+{
+	std::string json;
+	try {
+		int ret = inconsistent_objects(cluster, pgstr, json);
+		if (ret < 0)
+			return ret;
+	} catch (const std::bad_alloc &) {
+		return -ENOMEM;
+	}
+	*out = (char *)malloc(json.size());
+	if (*out == NULL)
+		return -ENOMEM;
+	memcpy(*out, json.data(), json.size());
+	*outlen = json.size();
+	return 0;
+}
@@ -0,0 +1,20 @@
+#ifndef CEPH_PANEL_RADOS_INCONSISTENT_H
+#define CEPH_PANEL_RADOS_INCONSISTENT_H
+
+// librados的C接口不能获取不一致对象，由radosInconsistent.cc通过C++接口实现
+
+#include <stddef.h>
+#include <rados/librados.h>
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+// 返回与rados list-inconsistent-obj --format=json一致的输出，*out需由调用方free
+int rados_pg_inconsistent_objects_json(rados_t cluster, const char *pgstr, char **out, size_t *outlen);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif
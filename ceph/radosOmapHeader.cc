@@ -0,0 +1,53 @@
+//go:build rados
+// +build rados
+
+// 通过librados的C++接口读写对象的omap header，IoCtx与C接口共用同一个上下文，包括命名空间及定位键
+
+#include <cerrno>
+#include <cstdlib>
+#include <cstring>
+#include <new>
+#include <rados/librados.hpp>
+#include "radosOmapHeader.h"
+
+extern "C" int rados_omap_get_header_buf(rados_ioctx_t io, const char *oid, char **out, size_t *outlen)
+{
+	try {
+		librados::IoCtx ioctx;
+		librados::IoCtx::from_rados_ioctx_t(io, ioctx);
+		librados::ObjectReadOperation op;
+		librados::bufferlist bl;
+		int rval = 0;
+		op.omap_get_header(&bl, &rval);
+		int ret = ioctx.operate(oid, &op, NULL);
+		if (ret < 0)
+			return ret;
+		if (rval < 0)
+			return rval;
+		// 空header也返回可释放的指针
+		*out = (char *)malloc(bl.length() > 0 ? bl.length() : 1);
+		if (*out == NULL)
+			return -ENOMEM;
+		if (bl.length() > 0)
+			memcpy(*out, bl.c_str(), bl.length());
+		*outlen = bl.length();
+		return 0;
+	} catch (const std::bad_alloc &) {
+		return -ENOMEM;
+	}
+}
+
+extern "C" int rados_omap_set_header_buf(rados_ioctx_t io, const char *oid, const char *buf, size_t len)
+{
+	try {
+		librados::IoCtx ioctx;
+		librados::IoCtx::from_rados_ioctx_t(io, ioctx);
+		librados::ObjectWriteOperation op;
+		librados::bufferlist bl;
+		bl.append(buf, len);
+		op.omap_set_header(bl);
+		return ioctx.operate(oid, &op);
+	} catch (const std::bad_alloc &) {
+		return -ENOMEM;
+	}
+}
@@ -0,0 +1,21 @@
+#ifndef CEPH_PANEL_RADOS_OMAP_HEADER_H
+#define CEPH_PANEL_RADOS_OMAP_HEADER_H
+
+// librados的C接口没有omap header的读写操作，由radosOmapHeader.cc通过C++接口实现
+
+#include <stddef.h>
+#include <rados/librados.h>
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+// *out需由调用方free
+int rados_omap_get_header_buf(rados_ioctx_t io, const char *oid, char **out, size_t *outlen);
+int rados_omap_set_header_buf(rados_ioctx_t io, const char *oid, const char *buf, size_t len);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif
@@ -0,0 +1,486 @@
+package ceph
+
+// 镜像的导出导入，差异格式与rbd export-diff/import-diff一致
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	RBD_DIFF_V1 = 1
+	RBD_DIFF_V2 = 2
+
+	RBD_DIFF_MAX_EXTENT = 64 << 20 // 读取时单个数据段的上限
+	rbdDiffMaxName      = 4096
+)
+
+var rbdDiffBanners = map[int]string{
+	RBD_DIFF_V1: "rbd diff v1\n",
+	RBD_DIFF_V2: "rbd diff v2\n",
+}
+
+// 记录类型
+const (
+	RBD_DIFF_FROM_SNAP byte = 'f'
+	RBD_DIFF_TO_SNAP   byte = 't'
+	RBD_DIFF_SIZE      byte = 's'
+	RBD_DIFF_WRITE     byte = 'w'
+	RBD_DIFF_ZERO      byte = 'z'
+	RBD_DIFF_END       byte = 'e'
+)
+
+type RbdDiffRecord struct {
+	Tag    byte
+	Snap   string // f、t
+	Size   uint64 // s
+	Offset uint64 // w、z
+	Length uint64 // w、z
+	Data   []byte // w
+}
+
+// 导出或导入的统计
+type RbdDiffStat struct {
+	FromSnap string `json:"from_snap"`
+	ToSnap   string `json:"to_snap"`
+	Size     uint64 `json:"size"`
+	Written  uint64 `json:"written"` // 数据段的字节数
+	Zeroed   uint64 `json:"zeroed"`  // 清零段的字节数
+	Extents  int    `json:"extents"`
+}
+
+// v2的每条记录在类型后带有8字节的记录长度，e除外
+type RbdDiffWriter struct {
+	w       io.Writer
+	version int
+}
+
+// 写入格式头
+func NewRbdDiffWriter(w io.Writer, version int) (*RbdDiffWriter, error) {
+	banner, ok := rbdDiffBanners[version]
+	if !ok {
+		return nil, errors.New("unsupported rbd diff version " + fmt.Sprintf("%v", version))
+	}
+	if _, err := io.WriteString(w, banner); err != nil {
+		return nil, err
+	}
+	return &RbdDiffWriter{w: w, version: version}, nil
+}
+
+// 写入记录头，payload为记录头之后的字节数
+func (d *RbdDiffWriter) record(tag byte, fields []byte, payload uint64) error {
+	head := []byte{tag}
+	if d.version == RBD_DIFF_V2 {
+		head = binary.LittleEndian.AppendUint64(head, uint64(len(fields))+payload)
+	}
+	_, err := d.w.Write(append(head, fields...))
+	return err
+}
+
+func (d *RbdDiffWriter) snap(tag byte, name string) error {
+	fields := binary.LittleEndian.AppendUint32(nil, uint32(len(name)))
+	return d.record(tag, append(fields, name...), 0)
+}
+
+func (d *RbdDiffWriter) FromSnap(name string) error {
+	return d.snap(RBD_DIFF_FROM_SNAP, name)
+}
+
+func (d *RbdDiffWriter) ToSnap(name string) error {
+	return d.snap(RBD_DIFF_TO_SNAP, name)
+}
+
+func (d *RbdDiffWriter) Size(size uint64) error {
+	return d.record(RBD_DIFF_SIZE, binary.LittleEndian.AppendUint64(nil, size), 0)
+}
+
+func (d *RbdDiffWriter) Write(offset uint64, data []byte) error {
+	fields := binary.LittleEndian.AppendUint64(nil, offset)
+	fields = binary.LittleEndian.AppendUint64(fields, uint64(len(data)))
+	if err := d.record(RBD_DIFF_WRITE, fields, uint64(len(data))); err != nil {
+		return err
+	}
+	_, err := d.w.Write(data)
+	return err
+}
+
+func (d *RbdDiffWriter) Zero(offset uint64, length uint64) error {
+	fields := binary.LittleEndian.AppendUint64(nil, offset)
+	fields = binary.LittleEndian.AppendUint64(fields, length)
+	return d.record(RBD_DIFF_ZERO, fields, 0)
+}
+
+func (d *RbdDiffWriter) End() error {
+	_, err := d.w.Write([]byte{RBD_DIFF_END})
+	return err
+}
+
+type RbdDiffReader struct {
+	r       io.Reader
+	Version int
+	ended   bool
+}
+
+// 读取并检查格式头
+func NewRbdDiffReader(r io.Reader) (*RbdDiffReader, error) {
+	banner := make([]byte, len(rbdDiffBanners[RBD_DIFF_V1]))
+	if _, err := io.ReadFull(r, banner); err != nil {
+		return nil, errors.New("cannot read rbd diff header " + err.Error())
+	}
+	for version, b := range rbdDiffBanners {
+		if string(banner) == b {
+			return &RbdDiffReader{r: r, Version: version}, nil
+		}
+	}
+	return nil, errors.New("invalid rbd diff header " + fmt.Sprintf("%q", banner))
+}
+
+func (d *RbdDiffReader) uint64() (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(d.r, buf[:]); err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// 下一条记录，e之后返回io.EOF，v2中跳过未知类型的记录
+func (d *RbdDiffReader) Next() (RbdDiffRecord, error) {
+	for {
+		if d.ended {
+			return RbdDiffRecord{}, io.EOF
+		}
+		var tag [1]byte
+		if _, err := io.ReadFull(d.r, tag[:]); err != nil {
+			// 缺少结束记录
+			return RbdDiffRecord{}, unexpectedEOF(err)
+		}
+		rec := RbdDiffRecord{Tag: tag[0]}
+		if rec.Tag == RBD_DIFF_END {
+			d.ended = true
+			return rec, nil
+		}
+		var length uint64
+		if d.Version == RBD_DIFF_V2 {
+			var err error
+			if length, err = d.uint64(); err != nil {
+				return rec, err
+			}
+		}
+		switch rec.Tag {
+		case RBD_DIFF_FROM_SNAP, RBD_DIFF_TO_SNAP:
+			var buf [4]byte
+			if _, err := io.ReadFull(d.r, buf[:]); err != nil {
+				return rec, unexpectedEOF(err)
+			}
+			n := binary.LittleEndian.Uint32(buf[:])
+			if n > rbdDiffMaxName {
+				return rec, errors.New("rbd diff snapshot name too long " + fmt.Sprintf("%v", n))
+			}
+			name := make([]byte, n)
+			if _, err := io.ReadFull(d.r, name); err != nil {
+				return rec, unexpectedEOF(err)
+			}
+			rec.Snap = string(name)
+			return rec, d.checkLength(rec, length, 4+uint64(n))
+		case RBD_DIFF_SIZE:
+			size, err := d.uint64()
+			if err != nil {
+				return rec, err
+			}
+			rec.Size = size
+			return rec, d.checkLength(rec, length, 8)
+		case RBD_DIFF_WRITE, RBD_DIFF_ZERO:
+			var err error
+			if rec.Offset, err = d.uint64(); err != nil {
+				return rec, err
+			}
+			if rec.Length, err = d.uint64(); err != nil {
+				return rec, err
+			}
+			if rec.Tag == RBD_DIFF_ZERO {
+				return rec, d.checkLength(rec, length, 16)
+			}
+			if rec.Length > RBD_DIFF_MAX_EXTENT {
+				return rec, errors.New("rbd diff extent too large " + fmt.Sprintf("%v", rec.Length))
+			}
+			if err := d.checkLength(rec, length, 16+rec.Length); err != nil {
+				return rec, err
+			}
+			rec.Data = make([]byte, rec.Length)
+			if _, err := io.ReadFull(d.r, rec.Data); err != nil {
+				return rec, unexpectedEOF(err)
+			}
+			return rec, nil
+		}
+		if d.Version != RBD_DIFF_V2 {
+			return rec, errors.New("unknown rbd diff record " + fmt.Sprintf("%q", rec.Tag))
+		}
+		if _, err := io.CopyN(io.Discard, d.r, int64(length)); err != nil {
+			return rec, unexpectedEOF(err)
+		}
+	}
+}
+
+func (d *RbdDiffReader) checkLength(rec RbdDiffRecord, length uint64, expected uint64) error {
+	if d.Version == RBD_DIFF_V2 && length != expected {
+		return errors.New("invalid length of rbd diff record " + fmt.Sprintf("%q %v", rec.Tag, length))
+	}
+	return nil
+}
+
+// 导出snap_name相对from_snap的差异，from_snap为空时导出全部数据，snap_name为空时导出最新数据
+func ExportRbdDiff(rbd LibRBD, image_name string, from_snap string, snap_name string, version int, w io.Writer, progress func(done uint64, total uint64)) (RbdDiffStat, error) {
+	stat := RbdDiffStat{FromSnap: from_snap, ToSnap: snap_name}
+	image, err := rbd.Rbd_open(image_name, snap_name, true)
+	if err != nil {
+		return stat, err
+	}
+	defer image.Close()
+	if stat.Size, err = image.Size(); err != nil {
+		return stat, err
+	}
+	d, err := NewRbdDiffWriter(w, version)
+	if err != nil {
+		return stat, err
+	}
+	if from_snap != "" {
+		if err := d.FromSnap(from_snap); err != nil {
+			return stat, err
+		}
+	}
+	if snap_name != "" {
+		if err := d.ToSnap(snap_name); err != nil {
+			return stat, err
+		}
+	}
+	if err := d.Size(stat.Size); err != nil {
+		return stat, err
+	}
+	buf := make([]byte, OBJECT_STREAM_CHUNK)
+	err = image.DiffIterate(from_snap, 0, stat.Size, func(offset uint64, length uint64, exists bool) error {
+		stat.Extents++
+		if !exists {
+			stat.Zeroed += length
+			if err := d.Zero(offset, length); err != nil {
+				return err
+			}
+		}
+		// 数据段按块读取写入
+		for done := uint64(0); exists && done < length; {
+			n := length - done
+			if n > uint64(len(buf)) {
+				n = uint64(len(buf))
+			}
+			if _, err := image.ReadAt(buf[:n], int64(offset+done)); err != nil && err != io.EOF {
+				return err
+			}
+			if err := d.Write(offset+done, buf[:n]); err != nil {
+				return err
+			}
+			done += n
+			stat.Written += n
+		}
+		if progress != nil {
+			progress(offset+length, stat.Size)
+		}
+		return nil
+	})
+	if err != nil {
+		return stat, err
+	}
+	return stat, d.End()
+}
+
+// 统计读取的字节数
+type countReader struct {
+	r        io.Reader
+	n        uint64
+	progress func(read uint64)
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += uint64(n)
+	if n > 0 && c.progress != nil {
+		c.progress(c.n)
+	}
+	return n, err
+}
+
+// 将差异应用到已存在的镜像，镜像需有from_snap且没有to_snap，完成后创建to_snap
+func ImportRbdDiff(rbd LibRBD, image_name string, r io.Reader, progress func(read uint64)) (RbdDiffStat, error) {
+	stat := RbdDiffStat{}
+	d, err := NewRbdDiffReader(&countReader{r: r, progress: progress})
+	if err != nil {
+		return stat, err
+	}
+	snaps, err := rbd.Rbd_snap_list(image_name)
+	if err != nil {
+		return stat, err
+	}
+	hasSnap := func(name string) bool {
+		for _, snap := range snaps {
+			if snap.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+	image, err := rbd.Rbd_open(image_name, "", false)
+	if err != nil {
+		return stat, err
+	}
+	closed := false
+	defer func() {
+		if !closed {
+			image.Close()
+		}
+	}()
+	for {
+		rec, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return stat, err
+		}
+		switch rec.Tag {
+		case RBD_DIFF_FROM_SNAP:
+			if !hasSnap(rec.Snap) {
+				return stat, errors.New("start snapshot[" + rec.Snap + "] does not exist in rbd image[" + image_name + "]")
+			}
+			stat.FromSnap = rec.Snap
+		case RBD_DIFF_TO_SNAP:
+			if hasSnap(rec.Snap) {
+				return stat, errors.New("end snapshot[" + rec.Snap + "] already exists in rbd image[" + image_name + "]")
+			}
+			stat.ToSnap = rec.Snap
+		case RBD_DIFF_SIZE:
+			stat.Size = rec.Size
+			if err := image.Resize(rec.Size); err != nil {
+				return stat, err
+			}
+		case RBD_DIFF_WRITE:
+			stat.Extents++
+			stat.Written += rec.Length
+			if _, err := image.WriteAt(rec.Data, int64(rec.Offset)); err != nil {
+				return stat, err
+			}
+		case RBD_DIFF_ZERO:
+			stat.Extents++
+			stat.Zeroed += rec.Length
+			if err := image.Discard(rec.Offset, rec.Length); err != nil {
+				return stat, err
+			}
+		}
+	}
+	// 先关闭镜像再创建快照，保证写入的数据已落盘
+	closed = true
+	if err := image.Close(); err != nil {
+		return stat, err
+	}
+	if stat.ToSnap != "" {
+		if err := rbd.Rbd_snap_create(image_name, stat.ToSnap); err != nil {
+			return stat, err
+		}
+	}
+	return stat, nil
+}
+
+// 导出镜像的全部数据
+func ExportRbdRaw(rbd LibRBD, image_name string, snap_name string, w io.Writer, progress func(done uint64, total uint64)) (uint64, error) {
+	image, err := rbd.Rbd_open(image_name, snap_name, true)
+	if err != nil {
+		return 0, err
+	}
+	defer image.Close()
+	size, err := image.Size()
+	if err != nil {
+		return 0, err
+	}
+	buf := make([]byte, OBJECT_STREAM_CHUNK)
+	var done uint64
+	for done < size {
+		n := size - done
+		if n > uint64(len(buf)) {
+			n = uint64(len(buf))
+		}
+		if _, err := image.ReadAt(buf[:n], int64(done)); err != nil && err != io.EOF {
+			return done, err
+		}
+		if _, err := w.Write(buf[:n]); err != nil {
+			return done, err
+		}
+		done += n
+		if progress != nil {
+			progress(done, size)
+		}
+	}
+	return done, nil
+}
+
+// 以原始数据创建镜像，全0的块不写入以保持稀疏，失败时删除创建的镜像
+func ImportRbdRaw(rbd LibRBD, image_name string, size uint64, opts RbdCreateOptions, r io.Reader, progress func(read uint64)) (uint64, error) {
+	if err := rbd.Rbd_create(image_name, size, opts); err != nil {
+		return 0, err
+	}
+	done, err := importRbdRaw(rbd, image_name, size, r, progress)
+	if err != nil {
+		rbd.Rbd_remove(image_name)
+	}
+	return done, err
+}
+
+func importRbdRaw(rbd LibRBD, image_name string, size uint64, r io.Reader, progress func(read uint64)) (uint64, error) {
+	image, err := rbd.Rbd_open(image_name, "", false)
+	if err != nil {
+		return 0, err
+	}
+	closed := false
+	defer func() {
+		if !closed {
+			image.Close()
+		}
+	}()
+	buf := make([]byte, OBJECT_STREAM_CHUNK)
+	zero := make([]byte, OBJECT_STREAM_CHUNK)
+	var done uint64
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if done+uint64(n) > size {
+				return done, errors.New("data exceeds the size of rbd image[" + image_name + "] " + fmt.Sprintf("%v", size))
+			}
+			if !bytes.Equal(buf[:n], zero[:n]) {
+				if _, err := image.WriteAt(buf[:n], int64(done)); err != nil {
+					return done, err
+				}
+			}
+			done += uint64(n)
+			if progress != nil {
+				progress(done)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return done, err
+		}
+	}
+	if done < size {
+		return done, errors.New("rbd image[" + image_name + "] is truncated, read " + fmt.Sprintf("%v of %v", done, size))
+	}
+	closed = true
+	return done, image.Close()
+}
@@ -0,0 +1,191 @@
+package ceph
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRbdDiffReader(t *testing.T) {
+	for _, version := range []int{RBD_DIFF_V1, RBD_DIFF_V2} {
+		var buf bytes.Buffer
+		d, err := NewRbdDiffWriter(&buf, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.FromSnap("s1")
+		d.ToSnap("s2")
+		d.Size(1 << 20)
+		d.Write(4096, []byte("hello"))
+		d.Zero(8192, 4096)
+		d.End()
+
+		r, err := NewRbdDiffReader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		records := []RbdDiffRecord{}
+		for {
+			rec, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("v%d %v", version, err)
+			}
+			records = append(records, rec)
+		}
+		if r.Version != version || len(records) != 6 || records[0].Snap != "s1" || records[1].Snap != "s2" || records[2].Size != 1<<20 ||
+			records[3].Offset != 4096 || string(records[3].Data) != "hello" || records[4].Length != 4096 || records[5].Tag != RBD_DIFF_END {
+			t.Fatalf("v%d records %+v", version, records)
+		}
+		// 缺少结束记录
+		r, _ = NewRbdDiffReader(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+		var last error
+		for last == nil {
+			_, last = r.Next()
+		}
+		if last != io.ErrUnexpectedEOF {
+			t.Fatalf("v%d truncated stream %v", version, last)
+		}
+	}
+
+	// v2跳过未知记录，v1报错
+	v2 := "rbd diff v2\nx\x03\x00\x00\x00\x00\x00\x00\x00abce"
+	r, _ := NewRbdDiffReader(strings.NewReader(v2))
+	if rec, err := r.Next(); err != nil || rec.Tag != RBD_DIFF_END {
+		t.Fatalf("v2 unknown record %+v %v", rec, err)
+	}
+	r, _ = NewRbdDiffReader(strings.NewReader("rbd diff v1\nxe"))
+	if _, err := r.Next(); err == nil {
+		t.Fatal("expected error on unknown v1 record")
+	}
+	if _, err := NewRbdDiffReader(strings.NewReader("rbd diff v3\n")); err == nil {
+		t.Fatal("expected error on unknown version")
+	}
+}
+
+func TestFakeRados_rbdImage(t *testing.T) {
+	rbd := newConnectedFake(t)
+	if err := rbd.Rados_ioctx_create("rbd"); err != nil {
+		t.Fatal(err)
+	}
+	// 对象大小4KiB
+	if err := rbd.Rbd_create("base", 64<<10, RbdCreateOptions{Order: 12}); err != nil {
+		t.Fatal(err)
+	}
+	image, err := rbd.Rbd_open("base", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := image.WriteAt([]byte("parent"), 4093); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := image.WriteAt([]byte("x"), 64<<10); err == nil {
+		t.Fatal("expected error writing beyond the end")
+	}
+	image.Close()
+	rbd.Rbd_snap_create("base", "gold")
+	rbd.Rbd_snap_protect("base", "gold")
+	if err := rbd.Rbd_clone("base", "gold", RbdImageSpec{Pool: "rbd", Image: "vm"}, RbdCreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 克隆镜像读取父镜像的数据，写入后父镜像不变
+	vm, err := rbd.Rbd_open("vm", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	p := make([]byte, 6)
+	if _, err := vm.ReadAt(p, 4093); err != nil || string(p) != "parent" {
+		t.Fatalf("read %q %v", p, err)
+	}
+	vm.WriteAt([]byte("C"), 4093)
+	if err := vm.Discard(4096, 4096); err != nil {
+		t.Fatal(err)
+	}
+	vm.ReadAt(p, 4093)
+	if string(p) != "Car\x00\x00\x00" {
+		t.Fatalf("read after write %q", p)
+	}
+	gold, err := rbd.Rbd_open("base", "gold", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gold.ReadAt(p, 4093)
+	if string(p) != "parent" {
+		t.Fatalf("parent changed %q", p)
+	}
+	if _, err := gold.WriteAt([]byte("x"), 0); err == nil {
+		t.Fatal("expected error writing a snapshot")
+	}
+	gold.Close()
+
+	// 清零的对象与全0相同，只有第一个对象有数据
+	extents := 0
+	err = vm.DiffIterate("", 0, 64<<10, func(offset uint64, length uint64, exists bool) error {
+		extents++
+		if offset != 0 || !exists {
+			t.Fatalf("diff %d %d %v", offset, length, exists)
+		}
+		return nil
+	})
+	if err != nil || extents != 1 {
+		t.Fatalf("diff extents %d %v", extents, err)
+	}
+
+	// 导出差异导入到另一个镜像后内容一致
+	rbd.Rbd_snap_create("vm", "s1")
+	vm.WriteAt([]byte("later"), 40000)
+	vm.Resize(128 << 10)
+	rbd.Rbd_snap_create("vm", "s2")
+	for _, version := range []int{RBD_DIFF_V1, RBD_DIFF_V2} {
+		var full, diff bytes.Buffer
+		if _, err := ExportRbdDiff(rbd, "vm", "", "s1", version, &full, nil); err != nil {
+			t.Fatal(err)
+		}
+		stat, err := ExportRbdDiff(rbd, "vm", "s1", "s2", version, &diff, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stat.Size != 128<<10 || stat.Extents != 1 {
+			t.Fatalf("diff stat %+v", stat)
+		}
+		rbd.Rbd_create("copy", 0, RbdCreateOptions{Order: 12})
+		if _, err := ImportRbdDiff(rbd, "copy", &diff, nil); err == nil {
+			t.Fatal("expected error importing without the start snapshot")
+		}
+		if _, err := ImportRbdDiff(rbd, "copy", &full, nil); err != nil {
+			t.Fatal(err)
+		}
+		diff.Reset()
+		ExportRbdDiff(rbd, "vm", "s1", "s2", version, &diff, nil)
+		if _, err := ImportRbdDiff(rbd, "copy", &diff, nil); err != nil {
+			t.Fatal(err)
+		}
+		var a, b bytes.Buffer
+		ExportRbdRaw(rbd, "vm", "s2", &a, nil)
+		ExportRbdRaw(rbd, "copy", "s2", &b, nil)
+		if a.Len() != 128<<10 || !bytes.Equal(a.Bytes(), b.Bytes()) {
+			t.Fatalf("v%d copy differs", version)
+		}
+		rbd.Rbd_snap_remove("copy", "s1")
+		rbd.Rbd_snap_remove("copy", "s2")
+		if err := rbd.Rbd_remove("copy"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 原始数据导入，长度不足时报错
+	if _, err := ImportRbdRaw(rbd, "raw", 8192, RbdCreateOptions{Order: 12}, strings.NewReader("data"), nil); err == nil {
+		t.Fatal("expected error on truncated raw import")
+	}
+	if _, err := rbd.Rbd_stat("raw"); err == nil {
+		t.Fatal("expected truncated image to be removed")
+	}
+	if n, err := ImportRbdRaw(rbd, "raw2", 4, RbdCreateOptions{Order: 12}, strings.NewReader("data"), nil); err != nil || n != 4 {
+		t.Fatalf("raw import %d %v", n, err)
+	}
+}
@@ -0,0 +1,304 @@
+package ceph
+
+// 对象存储网关请求的AWS v2/v4签名
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RGW_SIGNATURE_V2 = "v2"
+	RGW_SIGNATURE_V4 = "v4"
+
+	rgwV4Algorithm   = "AWS4-HMAC-SHA256"
+	rgwV4TimeFormat  = "20060102T150405Z"
+	rgwV4DateFormat  = "20060102"
+	rgwV4Service     = "s3"
+	rgwUnsignedBody  = "UNSIGNED-PAYLOAD"
+	rgwEmptyBodyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// v2签名中需要签名的子资源
+var rgwV2SubResources = map[string]bool{
+	"acl": true, "cors": true, "delete": true, "lifecycle": true, "location": true,
+	"logging": true, "notification": true, "partNumber": true, "policy": true,
+	"requestPayment": true, "tagging": true, "torrent": true, "uploadId": true,
+	"uploads": true, "versionId": true, "versioning": true, "versions": true, "website": true,
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// RFC3986编码，path为true时保留/
+func rgwEscape(s string, path bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (path && c == '/') {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{c})))
+	}
+	return b.String()
+}
+
+// 按名称排序并编码的查询字符串
+func rgwCanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := []string{}
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, rgwEscape(key, false)+"="+rgwEscape(value, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func rgwHost(r *http.Request) string {
+	if r.Host != "" {
+		return r.Host
+	}
+	return r.URL.Host
+}
+
+// v2签名的字符串，date为Date头或预签名URL的Expires
+func rgwStringToSignV2(r *http.Request, date string) string {
+	amz := []string{}
+	for key, values := range r.Header {
+		key = strings.ToLower(key)
+		if strings.HasPrefix(key, "x-amz-") {
+			amz = append(amz, key+":"+strings.Join(values, ","))
+		}
+	}
+	sort.Strings(amz)
+	resource := r.URL.EscapedPath()
+	subs := []string{}
+	for key, values := range r.URL.Query() {
+		if !rgwV2SubResources[key] {
+			continue
+		}
+		if values[0] == "" {
+			subs = append(subs, key)
+		} else {
+			subs = append(subs, key+"="+values[0])
+		}
+	}
+	sort.Strings(subs)
+	if len(subs) > 0 {
+		resource += "?" + strings.Join(subs, "&")
+	}
+	lines := []string{r.Method, r.Header.Get("Content-MD5"), r.Header.Get("Content-Type"), date}
+	lines = append(lines, amz...)
+	return strings.Join(append(lines, resource), "\n")
+}
+
+func rgwSignatureV2(secret_key string, r *http.Request, date string) string {
+	h := hmac.New(sha1.New, []byte(secret_key))
+	h.Write([]byte(rgwStringToSignV2(r, date)))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// 以Authorization头进行v2签名
+func SignRgwV2(r *http.Request, access_key string, secret_key string, now time.Time) {
+	r.Header.Set("Date", now.UTC().Format(http.TimeFormat))
+	r.Header.Set("Authorization", "AWS "+access_key+":"+rgwSignatureV2(secret_key, r, r.Header.Get("Date")))
+}
+
+// v2预签名，签名放在查询参数中，expires为过期时间
+func PresignRgwV2(r *http.Request, access_key string, secret_key string, expires time.Time) {
+	query := r.URL.Query()
+	query.Del("Signature")
+	r.URL.RawQuery = rgwCanonicalQuery(query)
+	date := strconv.FormatInt(expires.Unix(), 10)
+	query.Set("AWSAccessKeyId", access_key)
+	query.Set("Expires", date)
+	query.Set("Signature", rgwSignatureV2(secret_key, r, date))
+	r.URL.RawQuery = rgwCanonicalQuery(query)
+}
+
+// v4签名的规范请求，headers为参与签名的小写头名称
+func rgwCanonicalRequestV4(r *http.Request, query url.Values, headers []string, payload_hash string) string {
+	lines := []string{
+		r.Method,
+		rgwEscape(r.URL.Path, true),
+		rgwCanonicalQuery(query),
+	}
+	for _, name := range headers {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = rgwHost(r)
+		}
+		lines = append(lines, name+":"+strings.Join(strings.Fields(value), " "))
+	}
+	lines = append(lines, "", strings.Join(headers, ";"), payload_hash)
+	return strings.Join(lines, "\n")
+}
+
+func rgwScopeV4(now time.Time, region string) string {
+	return now.UTC().Format(rgwV4DateFormat) + "/" + region + "/" + rgwV4Service + "/aws4_request"
+}
+
+func rgwSignatureV4(secret_key string, region string, now time.Time, canonical string) string {
+	key := hmacSha256([]byte("AWS4"+secret_key), now.UTC().Format(rgwV4DateFormat))
+	key = hmacSha256(key, region)
+	key = hmacSha256(key, rgwV4Service)
+	key = hmacSha256(key, "aws4_request")
+	toSign := strings.Join([]string{
+		rgwV4Algorithm,
+		now.UTC().Format(rgwV4TimeFormat),
+		rgwScopeV4(now, region),
+		sha256Hex([]byte(canonical)),
+	}, "\n")
+	return hex.EncodeToString(hmacSha256(key, toSign))
+}
+
+// 以Authorization头进行v4签名，payload_hash为请求体的sha256，为空时不签名请求体
+func SignRgwV4(r *http.Request, access_key string, secret_key string, region string, payload_hash string, now time.Time) {
+	if payload_hash == "" {
+		payload_hash = rgwUnsignedBody
+	}
+	r.Header.Set("X-Amz-Date", now.UTC().Format(rgwV4TimeFormat))
+	r.Header.Set("X-Amz-Content-Sha256", payload_hash)
+	headers := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if r.Header.Get("Content-Md5") != "" {
+		headers = []string{"content-md5", "host", "x-amz-content-sha256", "x-amz-date"}
+	}
+	signature := rgwSignatureV4(secret_key, region, now, rgwCanonicalRequestV4(r, r.URL.Query(), headers, payload_hash))
+	r.Header.Set("Authorization", rgwV4Algorithm+" Credential="+access_key+"/"+rgwScopeV4(now, region)+
+		", SignedHeaders="+strings.Join(headers, ";")+", Signature="+signature)
+}
+
+// v4预签名，只签名host头，请求体不签名，expires为有效时长
+func PresignRgwV4(r *http.Request, access_key string, secret_key string, region string, now time.Time, expires time.Duration) {
+	query := r.URL.Query()
+	query.Del("X-Amz-Signature")
+	query.Set("X-Amz-Algorithm", rgwV4Algorithm)
+	query.Set("X-Amz-Credential", access_key+"/"+rgwScopeV4(now, region))
+	query.Set("X-Amz-Date", now.UTC().Format(rgwV4TimeFormat))
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(expires/time.Second), 10))
+	query.Set("X-Amz-SignedHeaders", "host")
+	signature := rgwSignatureV4(secret_key, region, now, rgwCanonicalRequestV4(r, query, []string{"host"}, rgwUnsignedBody))
+	query.Set("X-Amz-Signature", signature)
+	r.URL.RawQuery = rgwCanonicalQuery(query)
+}
+
+// 校验请求的签名，支持Authorization头和预签名URL，secret按access key返回密钥，不存在时返回空
+func VerifyRgwSignature(r *http.Request, body []byte, region string, secret func(access_key string) string) (access_key string, err error) {
+	auth := r.Header.Get("Authorization")
+	query := r.URL.Query()
+	switch {
+	case auth == "" && query.Get("X-Amz-Algorithm") == rgwV4Algorithm:
+		return verifyRgwPresignV4(r, region, secret)
+	case auth == "" && query.Get("AWSAccessKeyId") != "":
+		access_key = query.Get("AWSAccessKeyId")
+		expires, err := strconv.ParseInt(query.Get("Expires"), 10, 64)
+		if err != nil {
+			return access_key, errors.New("AccessDenied: invalid expires")
+		}
+		if time.Now().Unix() > expires {
+			return access_key, errors.New("AccessDenied: request has expired")
+		}
+		key := secret(access_key)
+		if key == "" {
+			return access_key, errors.New("InvalidAccessKeyId")
+		}
+		if !hmac.Equal([]byte(query.Get("Signature")), []byte(rgwSignatureV2(key, r, query.Get("Expires")))) {
+			return access_key, errors.New("SignatureDoesNotMatch")
+		}
+		return access_key, nil
+	case strings.HasPrefix(auth, "AWS "):
+		i := strings.LastIndex(auth, ":")
+		if i < 4 {
+			return "", errors.New("invalid authorization header")
+		}
+		access_key = auth[4:i]
+		key := secret(access_key)
+		if key == "" {
+			return access_key, errors.New("InvalidAccessKeyId")
+		}
+		if !hmac.Equal([]byte(auth[i+1:]), []byte(rgwSignatureV2(key, r, r.Header.Get("Date")))) {
+			return access_key, errors.New("SignatureDoesNotMatch")
+		}
+		return access_key, nil
+	case strings.HasPrefix(auth, rgwV4Algorithm+" "):
+		fields := map[string]string{}
+		for _, field := range strings.Split(auth[len(rgwV4Algorithm)+1:], ",") {
+			kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+			if len(kv) == 2 {
+				fields[kv[0]] = kv[1]
+			}
+		}
+		scope := strings.SplitN(fields["Credential"], "/", 2)
+		if len(scope) != 2 || fields["SignedHeaders"] == "" {
+			return "", errors.New("invalid authorization header")
+		}
+		now, err := time.Parse(rgwV4TimeFormat, r.Header.Get("X-Amz-Date"))
+		if err != nil {
+			return scope[0], errors.New("invalid x-amz-date")
+		}
+		payload := r.Header.Get("X-Amz-Content-Sha256")
+		if payload != rgwUnsignedBody && payload != sha256Hex(body) {
+			return scope[0], errors.New("XAmzContentSHA256Mismatch")
+		}
+		return scope[0], verifyRgwV4(r, query, scope[0], region, now, strings.Split(fields["SignedHeaders"], ";"), payload, fields["Signature"], secret)
+	}
+	return "", errors.New("AccessDenied: missing authorization")
+}
+
+func verifyRgwPresignV4(r *http.Request, region string, secret func(string) string) (string, error) {
+	query := r.URL.Query()
+	scope := strings.SplitN(query.Get("X-Amz-Credential"), "/", 2)
+	if len(scope) != 2 || query.Get("X-Amz-SignedHeaders") == "" {
+		return "", errors.New("AccessDenied: invalid presigned url")
+	}
+	now, err := time.Parse(rgwV4TimeFormat, query.Get("X-Amz-Date"))
+	if err != nil {
+		return scope[0], errors.New("AccessDenied: invalid x-amz-date")
+	}
+	expires, err := strconv.ParseInt(query.Get("X-Amz-Expires"), 10, 64)
+	if err != nil || time.Now().After(now.Add(time.Duration(expires)*time.Second)) {
+		return scope[0], errors.New("AccessDenied: request has expired")
+	}
+	signature := query.Get("X-Amz-Signature")
+	query.Del("X-Amz-Signature")
+	return scope[0], verifyRgwV4(r, query, scope[0], region, now, strings.Split(query.Get("X-Amz-SignedHeaders"), ";"), rgwUnsignedBody, signature, secret)
+}
+
+func verifyRgwV4(r *http.Request, query url.Values, access_key string, region string, now time.Time, headers []string, payload_hash string, signature string, secret func(string) string) error {
+	key := secret(access_key)
+	if key == "" {
+		return errors.New("InvalidAccessKeyId")
+	}
+	expected := rgwSignatureV4(key, region, now, rgwCanonicalRequestV4(r, query, headers, payload_hash))
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return errors.New("SignatureDoesNotMatch")
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package ceph
+
+// 对象的流式读写，避免将大对象整个读入内存
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+)
+
+const OBJECT_STREAM_CHUNK = 4 << 20 // 每次读写的块大小
+
+// 从offset开始按块读取对象的length字节
+type ObjectReader struct {
+	rados  LibRados
+	object string
+	offset uint64
+	end    uint64
+	chunk  uint64
+}
+
+func NewObjectReader(rados LibRados, object_name string, offset uint64, length uint64) *ObjectReader {
+	return &ObjectReader{
+		rados:  rados,
+		object: object_name,
+		offset: offset,
+		end:    offset + length,
+		chunk:  OBJECT_STREAM_CHUNK,
+	}
+}
+
+func (r *ObjectReader) Read(p []byte) (int, error) {
+	if r.offset >= r.end {
+		return 0, io.EOF
+	}
+	size := uint64(len(p))
+	if size > r.end-r.offset {
+		size = r.end - r.offset
+	}
+	if size > r.chunk {
+		size = r.chunk
+	}
+	out, err := r.rados.Rados_Read(r.object, uint(size), r.offset)
+	if err != nil {
+		return 0, err
+	}
+	// 读取过程中对象被截断
+	if out.Len() == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(p, out.Bytes())
+	r.offset += uint64(n)
+	return n, nil
+}
+
+// 将数据按固定大小的块依次写入对象，并计算sha256
+type ObjectWriter struct {
+	rados    LibRados
+	object   string
+	chunk    int
+	buf      []byte
+	offset   uint64
+	hash     hash.Hash
+	closed   bool
+	Progress func(written uint64) // 每写入一块后回调
+}
+
+// 从对象起始位置写入，对象原有内容需由调用方先行截断
+func NewObjectWriter(rados LibRados, object_name string, chunk int) *ObjectWriter {
+	if chunk <= 0 {
+		chunk = OBJECT_STREAM_CHUNK
+	}
+	return &ObjectWriter{
+		rados:  rados,
+		object: object_name,
+		chunk:  chunk,
+		buf:    make([]byte, 0, chunk),
+		hash:   sha256.New(),
+	}
+}
+
+func (w *ObjectWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("object writer[" + w.object + "] is closed")
+	}
+	n := len(p)
+	for len(p) > 0 {
+		size := w.chunk - len(w.buf)
+		if size > len(p) {
+			size = len(p)
+		}
+		w.buf = append(w.buf, p[:size]...)
+		p = p[size:]
+		if len(w.buf) == w.chunk {
+			if err := w.flush(); err != nil {
+				// 未写入的块不计入
+				if consumed := n - len(p) - len(w.buf); consumed > 0 {
+					return consumed, err
+				}
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (w *ObjectWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	if err := w.rados.Rados_write(w.object, w.buf, uint(w.offset)); err != nil {
+		return err
+	}
+	w.hash.Write(w.buf)
+	w.offset += uint64(len(w.buf))
+	w.buf = w.buf[:0]
+	if w.Progress != nil {
+		w.Progress(w.offset)
+	}
+	return nil
+}
+
+// 写入剩余数据
+func (w *ObjectWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.flush()
+}
+
+// 已写入对象的字节数
+func (w *ObjectWriter) Written() uint64 {
+	return w.offset
+}
+
+// 已写入数据的sha256，十六进制
+func (w *ObjectWriter) Sum() string {
+	return hex.EncodeToString(w.hash.Sum(nil))
+}
+
+// 读取对象前size字节计算sha256
+func ObjectChecksum(rados LibRados, object_name string, size uint64) (string, error) {
+	h := sha256.New()
+	if _, err := io.CopyBuffer(h, NewObjectReader(rados, object_name, 0, size), make([]byte, OBJECT_STREAM_CHUNK)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// 单次写入的上限，与osd_max_write_size的默认值一致
+var objectMaxWrite uint64 = 90 << 20
+
+// 将src的前size字节分块复制到dst，首块以write_full写入以替换dst原有的内容
+func objectCopyChunks(rados LibRados, src string, dst string, size uint64) error {
+	if size == 0 {
+		return rados.Rados_write_full(dst, nil)
+	}
+	for offset := uint64(0); offset < size; {
+		length := size - offset
+		if length > OBJECT_STREAM_CHUNK {
+			length = OBJECT_STREAM_CHUNK
+		}
+		out, err := rados.Rados_Read(src, uint(length), offset)
+		if err != nil {
+			return err
+		}
+		if uint64(out.Len()) != length {
+			return errors.New("cannot copy object[" + src + "] to [" + dst + "], source is truncated")
+		}
+		if offset == 0 {
+			err = rados.Rados_write_full(dst, out.Bytes())
+		} else {
+			err = rados.Rados_write(dst, out.Bytes(), uint(offset))
+		}
+		if err != nil {
+			return err
+		}
+		offset += length
+	}
+	return nil
+}
+
+// 将src的前size字节复制到dst以替换dst原有的内容，失败时dst保持不变
+func ObjectCopy(rados LibRados, src string, dst string, size uint64) error {
+	// 读取全部数据后一次写入
+	if size <= objectMaxWrite {
+		data := bytes.NewBuffer(make([]byte, 0, size))
+		if _, err := io.CopyBuffer(data, NewObjectReader(rados, src, 0, size), make([]byte, OBJECT_STREAM_CHUNK)); err != nil {
+			return err
+		}
+		if uint64(data.Len()) != size {
+			return errors.New("cannot copy object[" + src + "] to [" + dst + "], source is truncated")
+		}
+		return rados.Rados_write_full(dst, data.Bytes())
+	}
+
+	// 超过单次写入上限时只能分块写入，先备份dst，失败时恢复，dst原来不存在时删除
+	stat, err := rados.Rados_stat(dst)
+	existed := err == nil
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	backup := dst + ".backup." + hex.EncodeToString(b)
+	if existed {
+		defer rados.Rados_remove(backup)
+		if err := objectCopyChunks(rados, dst, backup, stat.Size); err != nil {
+			return err
+		}
+	}
+	if err := objectCopyChunks(rados, src, dst, size); err != nil {
+		if !existed {
+			rados.Rados_remove(dst)
+		} else if rerr := objectCopyChunks(rados, backup, dst, stat.Size); rerr != nil {
+			return errors.New(err.Error() + ", and cannot restore object[" + dst + "] from [" + backup + "] " + rerr.Error())
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package ceph
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestObjectWriter(t *testing.T) {
+	rados := newConnectedFake(t)
+	if err := rados.Rados_ioctx_create("data"); err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("0123456789"), 10)
+	progress := []uint64{}
+	writer := NewObjectWriter(rados, "big", 32)
+	writer.Progress = func(written uint64) {
+		progress = append(progress, written)
+	}
+	if _, err := io.Copy(writer, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// 100字节按32字节分块写入4次
+	if len(progress) != 4 || progress[3] != 100 || writer.Written() != 100 {
+		t.Fatalf("progress %v", progress)
+	}
+	sum := sha256.Sum256(data)
+	if writer.Sum() != hex.EncodeToString(sum[:]) {
+		t.Fatalf("sum %s", writer.Sum())
+	}
+	stored, err := ObjectChecksum(rados, "big", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored != writer.Sum() {
+		t.Fatalf("stored %s", stored)
+	}
+
+	out, err := io.ReadAll(NewObjectReader(rados, "big", 95, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "56789" {
+		t.Fatalf("read %q", out)
+	}
+	if _, err := io.ReadAll(NewObjectReader(rados, "big", 90, 20)); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected unexpected EOF reading past the end, got %v", err)
+	}
+}
+
+func TestObjectCopy(t *testing.T) {
+	rados := newConnectedFake(t)
+	if err := rados.Rados_ioctx_create("data"); err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("ceph"), OBJECT_STREAM_CHUNK/2)
+	rados.Rados_write_full("src", data)
+	rados.Rados_write_full("dst", bytes.Repeat([]byte("x"), len(data)+10))
+
+	// 跨多个块复制，目标原有的多余数据被截断
+	if err := ObjectCopy(rados, "src", "dst", uint64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	stat, _ := rados.Rados_stat("dst")
+	want, _ := ObjectChecksum(rados, "src", uint64(len(data)))
+	got, _ := ObjectChecksum(rados, "dst", uint64(len(data)))
+	if stat.Size != uint64(len(data)) || got != want {
+		t.Fatalf("copy %d %s", stat.Size, got)
+	}
+	if err := ObjectCopy(rados, "src", "dst", 0); err != nil {
+		t.Fatal(err)
+	}
+	if stat, _ := rados.Rados_stat("dst"); stat.Size != 0 {
+		t.Fatalf("copy empty %d", stat.Size)
+	}
+	if err := ObjectCopy(rados, "src", "dst", uint64(len(data))+1); err == nil {
+		t.Fatal("expected copying past the end of source to fail")
+	}
+}
+
+// 读取第二块或第一次分块写入时失败
+type failingCopyRados struct {
+	LibRados
+	reads     int
+	failRead  bool
+	failWrite bool
+}
+
+func (r *failingCopyRados) Rados_Read(key string, size uint, offset uint64) (bytes.Buffer, error) {
+	if key == "src" {
+		r.reads++
+		if r.failRead && r.reads == 2 {
+			return bytes.Buffer{}, errors.New("cannot read object[src] -5")
+		}
+	}
+	return r.LibRados.Rados_Read(key, size, offset)
+}
+
+func (r *failingCopyRados) Rados_write(key string, value []byte, offset uint) error {
+	if key == "dst" && r.failWrite {
+		r.failWrite = false
+		return errors.New("cannot write object[dst] -5")
+	}
+	return r.LibRados.Rados_write(key, value, offset)
+}
+
+// 复制中途失败时目标保持原有的内容
+func TestObjectCopy_failure(t *testing.T) {
+	rados := newConnectedFake(t)
+	if err := rados.Rados_ioctx_create("data"); err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("ceph"), OBJECT_STREAM_CHUNK/2+3)
+	old := bytes.Repeat([]byte("x"), OBJECT_STREAM_CHUNK+10)
+	rados.Rados_write_full("src", data)
+	check := func(name string, want []byte) {
+		t.Helper()
+		stat, err := rados.Rados_stat("dst")
+		if want == nil {
+			if err == nil {
+				t.Fatalf("%s: dst exists", name)
+			}
+			return
+		}
+		got, _ := ObjectChecksum(rados, "dst", stat.Size)
+		if err != nil || stat.Size != uint64(len(want)) || got != sha256Hex(want) {
+			t.Fatalf("%s: dst %d %v", name, stat.Size, err)
+		}
+	}
+	noBackup := func(name string) {
+		t.Helper()
+		page, _ := rados.Rados_nobjects_list("", 100)
+		for _, o := range page.Objects {
+			if strings.HasPrefix(o.Name, "dst.backup.") {
+				t.Fatalf("%s: backup %s left", name, o.Name)
+			}
+		}
+	}
+
+	// 不超过单次写入上限时一次写入
+	rados.Rados_write_full("dst", old)
+	if err := ObjectCopy(&failingCopyRados{LibRados: rados, failRead: true}, "src", "dst", uint64(len(data))); err == nil {
+		t.Fatal("expected read failure")
+	}
+	check("read failure", old)
+
+	// 超过上限时分块写入，失败后恢复
+	max := objectMaxWrite
+	objectMaxWrite = OBJECT_STREAM_CHUNK
+	defer func() { objectMaxWrite = max }()
+	if err := ObjectCopy(&failingCopyRados{LibRados: rados, failRead: true}, "src", "dst", uint64(len(data))); err == nil {
+		t.Fatal("expected chunked read failure")
+	}
+	check("chunked read failure", old)
+	noBackup("chunked read failure")
+	if err := ObjectCopy(&failingCopyRados{LibRados: rados, failWrite: true}, "src", "dst", uint64(len(data))); err == nil {
+		t.Fatal("expected chunked write failure")
+	}
+	check("chunked write failure", old)
+	noBackup("chunked write failure")
+	rados.Rados_remove("dst")
+	if err := ObjectCopy(&failingCopyRados{LibRados: rados, failWrite: true}, "src", "dst", uint64(len(data))); err == nil {
+		t.Fatal("expected chunked write failure")
+	}
+	check("new object", nil)
+	if err := ObjectCopy(rados, "src", "dst", uint64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	check("chunked copy", data)
+	noBackup("chunked copy")
+}
@@ -67,6 +67,40 @@ type ConfigData struct {
 		Port    int
 		Timeout int
 	}
+	Ceph struct {
+		Backend     string // rados, fake
+		ClusterName string `toml:"clusterName" yaml:"clusterName"`
+		UserName    string `toml:"userName" yaml:"userName"`
+		ConfPath    string `toml:"confPath" yaml:"confPath"`
+		Keyring     string
+		MonHost     string `toml:"monHost" yaml:"monHost"`
+		Rgw         CephRgw
+
+		// 多集群配置，为空时以上述配置作为唯一的集群
+		Default     string        // 默认集群名称，为空时使用第一个集群
+		HealthCheck int           `toml:"healthCheck" yaml:"healthCheck"` // 健康检查间隔，秒
+		Clusters    []CephCluster `toml:"clusters" yaml:"clusters"`
+	}
+}
+
+type CephCluster struct {
+	Name        string // 集群选择参数使用的名称
+	Backend     string
+	ClusterName string `toml:"clusterName" yaml:"clusterName"`
+	UserName    string `toml:"userName" yaml:"userName"`
+	ConfPath    string `toml:"confPath" yaml:"confPath"`
+	Keyring     string
+	MonHost     string `toml:"monHost" yaml:"monHost"`
+	Rgw         CephRgw
+}
+
+// 对象存储网关，S3浏览需要system用户的密钥才能访问所有存储桶
+type CephRgw struct {
+	Endpoint  string // 为空时不启用
+	AccessKey string `toml:"accessKey" yaml:"accessKey"`
+	SecretKey string `toml:"secretKey" yaml:"secretKey"`
+	Signature string // v2, v4
+	Region    string
 }
 
 // load config file
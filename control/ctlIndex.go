@@ -1,6 +1,7 @@
 package control
 
 import (
+	"ceph-panel-go/ceph"
 	"ceph-panel-go/config"
 	"ceph-panel-go/template"
 	"net/http"
@@ -24,5 +25,18 @@ func NewCtlIndex(config config.IConfig, w http.ResponseWriter, r *http.Request)
 }
 
 func (this *CtlIndex) Index() {
+	// 集群概况，获取失败时页面展示错误信息
+	if ceph.Clusters == nil {
+		this.TplEngine.Assign("ClusterError", "集群未连接")
+	} else if rados, err := ceph.Clusters.Get(this.R.FormValue("cluster")); err != nil {
+		this.TplEngine.Assign("ClusterError", err.Error())
+	} else if summary, err := ceph.NewCommander(rados).Summary(); err != nil {
+		this.TplEngine.Assign("ClusterError", err.Error())
+	} else {
+		this.TplEngine.Assign("Cluster", summary)
+	}
+	if ceph.Clusters != nil {
+		this.TplEngine.Assign("Clusters", ceph.Clusters.Status())
+	}
 	this.Display("index")
 }
@@ -1,5 +1,7 @@
 module ceph-panel-go
 
+go 1.22
+
 require (
 	github.com/BurntSushi/toml v0.3.1
 	github.com/bitly/go-simplejson v0.5.0
@@ -9,6 +11,10 @@ require (
 	github.com/op/go-logging v0.0.0-20160315200505-970db520ece7
 	github.com/pangudashu/memcache v0.0.0-20180711113639-048492410779
 	golang.org/x/net v0.0.0-20190213061140-3a22650c66bd
-	golang.org/x/text v0.3.0 // indirect
 	gopkg.in/yaml.v2 v2.2.2
 )
+
+require (
+	golang.org/x/text v0.3.0 // indirect
+	gopkg.in/check.v1 v0.0.0-20161208181325-20d25e280405 // indirect
+)
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"ceph-panel-go/ceph"
 	"ceph-panel-go/config"
 	"ceph-panel-go/db"
 	"ceph-panel-go/exception"
@@ -50,6 +51,7 @@ func init() {
 	db.NewMysql(Config).Init()
 	db.NewMemcache(Config).Init()
 	db.NewRedis(Config).Init()
+	ceph.NewRados(Config).Init()
 
 }
 
@@ -1,10 +1,24 @@
 package middleware
 
 import (
+	"context"
 	"log"
 	"net/http"
 )
 
+type userKey struct{}
+
+// 将鉴权通过的用户保存到请求中
+func WithUser(r *http.Request, user string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userKey{}, user))
+}
+
+// 请求的鉴权用户，未开启鉴权时为空
+func User(r *http.Request) string {
+	user, _ := r.Context().Value(userKey{}).(string)
+	return user
+}
+
 type Authentication struct {
 	tokenUsers map[string]string
 }
@@ -32,7 +46,7 @@ func (amw *Authentication) Middleware(next http.Handler) http.Handler {
 			// We found the token in our map
 			log.Printf("Authenticated user %s\n", user)
 			// Pass down the request to the next middleware (or final handler)
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, WithUser(r, user))
 		} else {
 			// Write an error and stop the handler chain
 			http.Error(w, "Forbidden", http.StatusForbidden)
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthentication_user(t *testing.T) {
+	amw := NewAuthentication()
+	amw.Populate()
+	user := ""
+	handler := amw.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user = User(r)
+	}))
+
+	r := httptest.NewRequest("GET", "/api/lock/audit", nil)
+	r.Header.Set("X-Session-Token", "aaaaaaaa")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if user != "userA" {
+		t.Fatalf("user %q", user)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/lock/audit", nil))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("without token %d", w.Code)
+	}
+}
@@ -9,7 +9,12 @@ import (
 func SafeHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
-			if e, ok := recover().(error); ok {
+			e := recover()
+			// 响应已开始发送时由http.Server中断连接，不能按正常响应结束
+			if e == http.ErrAbortHandler {
+				panic(e)
+			}
+			if e, ok := e.(error); ok {
 				http.Error(w, e.Error(), http.StatusInternalServerError)
 				// 输出自定义页面
 				Logger.Logger.Warningf("[Warning]: panic in %+v - %+v", r.RequestURI, e)
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 分块传输中途中断时连接被断开，客户端不能收到完整的响应
+func TestSafeHandler_abort(t *testing.T) {
+	Logger = NewLogger()
+	server := httptest.NewServer(SafeHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("ceph", 1024)))
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	})))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err == nil {
+		t.Fatalf("stream completed %d %q", len(body), body[len(body)-32:])
+	}
+}
@@ -12,6 +12,21 @@ func RegisterApi(r *Router) {
 	// api的路由特殊处理
 	r.Router.HandleFunc("/api/user/{action:[a-z]+}", I_UserHandler(r.Config))
 	r.Router.HandleFunc("/api/login/{action:[a-z]+}", I_LoginHandler(r.Config))
+	r.Router.HandleFunc("/api/pool/{action:[a-z-]+}", I_PoolHandler(r.Config))
+	r.Router.HandleFunc("/api/snapshot/{action:[a-z]+}", I_SnapshotHandler(r.Config))
+	r.Router.HandleFunc("/api/cluster/{action:[a-z]+}", I_ClusterHandler(r.Config))
+	r.Router.HandleFunc("/api/object/{action:[a-z-]+}", I_ObjectHandler(r.Config))
+	r.Router.HandleFunc("/api/lock/{action:[a-z]+}", I_LockHandler(r.Config))
+	r.Router.HandleFunc("/api/rbd/{action:[a-z-]+}", I_RbdHandler(r.Config))
+	r.Router.HandleFunc("/api/fs/{action:[a-z-]+}", I_FsHandler(r.Config))
+	r.Router.HandleFunc("/api/subvolume/{action:[a-z-]+}", I_SubvolumeHandler(r.Config))
+	r.Router.HandleFunc("/api/s3/{action:[a-z-]+}", I_S3Handler(r.Config))
+	r.Router.HandleFunc("/api/osd/{action:[a-z-]+}", I_OsdHandler(r.Config))
+	r.Router.HandleFunc("/api/flag/{action:[a-z]+}", I_FlagHandler(r.Config))
+	r.Router.HandleFunc("/api/maintenance/{action:[a-z]+}", I_MaintenanceHandler(r.Config))
+	r.Router.HandleFunc("/api/crush/{action:[a-z-]+}", I_CrushHandler(r.Config))
+	r.Router.HandleFunc("/api/pg/{action:[a-z-]+}", I_PgHandler(r.Config))
+	r.Router.HandleFunc("/api/daemon/{action:[a-z-]+}", I_DaemonHandler(r.Config))
 
 }
 
@@ -36,3 +51,321 @@ func I_LoginHandler(c config.IConfig) (f func(http.ResponseWriter, *http.Request
 
 	return handler
 }
+
+func I_PoolHandler(c config.IConfig) (f func(http.ResponseWriter, *http.Request)) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		action := mux.Vars(r)["action"]
+		i := api.NewIPool(c, w, r)
+
+		i.Register("index", i.List).
+			Register("list", i.List).
+			Register("detail", i.Detail).
+			Register("create", i.Create).
+			Register("delete", i.Delete).
+			Register("set-quota", i.SetQuota).
+			Register("stats", i.Stats).
+			Run(action)
+	}
+
+	return handler
+}
+
+func I_SnapshotHandler(c config.IConfig) (f func(http.ResponseWriter, *http.Request)) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		action := mux.Vars(r)["action"]
+		i := api.NewISnapshot(c, w, r)
+
+		i.Register("index", i.List).
+			Register("list", i.List).
+			Register("create", i.Create).
+			Register("remove", i.Remove).
+			Register("rollback", i.Rollback).
+			Register("read", i.Read).
+			Run(action)
+	}
+
+	return handler
+}
+
+func I_ClusterHandler(c config.IConfig) (f func(http.ResponseWriter, *http.Request)) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		action := mux.Vars(r)["action"]
+		i := api.NewICluster(c, w, r)
+
+		i.Register("index", i.Status).
+			Register("status", i.Status).
+			Register("list", i.List).
+			Run(action)
+	}
+
+	return handler
+}
+
+func I_ObjectHandler(c config.IConfig) (f func(http.ResponseWriter, *http.Request)) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		action := mux.Vars(r)["action"]
+		i := api.NewIObject(c, w, r)
+
+		i.Register("index", i.List).
+			Register("list", i.List).
+			Register("stat", i.Stat).
+			Register("read", i.Read).
+			Register("write", i.Write).
+			Register("append", i.Append).
+			Register("remove", i.Remove).
+			Register("download", i.Download).
+			Register("upload", i.Upload).
+			Register("progress", i.Progress).
+			Register("xattrs", i.Xattrs).
+			Register("get-xattr", i.GetXattr).
+			Register("set-xattr", i.SetXattr).
+			Register("rm-xattr", i.RmXattr).
+			Register("omap", i.Omap).
+			Register("set-omap", i.SetOmap).
+			Register("rm-omap", i.RmOmap).
+			Register("clear-omap", i.ClearOmap).
+			Register("omap-header", i.OmapHeader).
+			Register("set-omap-header", i.SetOmapHeader).
+			Run(action)
+	}
+
+	return handler
+}
+
+func I_LockHandler(c config.IConfig) (f func(http.ResponseWriter, *http.Request)) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		action := mux.Vars(r)["action"]
+		i := api.NewILock(c, w, r)
+
+		i.Register("index", i.List).
+			Register("list", i.List).
+			Register("lock", i.Lock).
+			Register("unlock", i.Unlock).
+			Register("break", i.Break).
+			Register("audit", i.Audit).
+			Run(action)
+	}
+
+	return handler
+}
+
+func I_RbdHandler(c config.IConfig) (f func(http.ResponseWriter, *http.Request)) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		action := mux.Vars(r)["action"]
+		i := api.NewIRbd(c, w, r)
+
+		i.Register("index", i.List).
+			Register("list", i.List).
+			Register("info", i.Info).
+			Register("create", i.Create).
+			Register("resize", i.Resize).
+			Register("remove", i.Remove).
+			Register("rename", i.Rename).
+			Register("metadata", i.Metadata).
+			Register("set-metadata", i.SetMetadata).
+			Register("rm-metadata", i.RmMetadata).
+			Register("snaps", i.Snaps).
+			Register("snap-create", i.SnapCreate).
+			Register("snap-remove", i.SnapRemove).
+			Register("snap-rollback", i.SnapRollback).
+			Register("protect", i.Protect).
+			Register("unprotect", i.Unprotect).
+			Register("clone", i.Clone).
+			Register("children", i.Children).
+			Register("flatten", i.Flatten).
+			Register("tree", i.Tree).
+			Register("export", i.Export).
+			Register("import", i.Import).
+			Register("import-diff", i.ImportDiff).
+			Register("transfer", i.Transfer).
+			Run(action)
+	}
+
+	return handler
+}
+
+func I_FsHandler(c config.IConfig) (f func(http.ResponseWriter, *http.Request)) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		action := mux.Vars(r)["action"]
+		i := api.NewIFs(c, w, r)
+
+		i.Register("index", i.List).
+			Register("list", i.List).
+			Register("ls", i.Ls).
+			Register("stat", i.Stat).
+			Register("mkdir", i.Mkdir).
+			Register("rmdir", i.Rmdir).
+			Register("unlink", i.Unlink).
+			Register("rename", i.Rename).
+			Register("chmod", i.Chmod).
+			Register("download", i.Download).
+			Register("upload", i.Upload).
+			Register("quota", i.Quota).
+			Register("set-quota", i.SetQuota).
+			Register("layout", i.Layout).
+			Register("set-layout", i.SetLayout).
+			Register("rm-layout", i.RmLayout).
+			Register("snaps", i.Snaps).
+			Register("snap-create", i.SnapCreate).
+			Register("snap-remove", i.SnapRemove).
+			Run(action)
+	}
+
+	return handler
+}
+
+func I_SubvolumeHandler(c config.IConfig) (f func(http.ResponseWriter, *http.Request)) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		action := mux.Vars(r)["action"]
+		i := api.NewISubvolume(c, w, r)
+
+		i.Register("index", i.List).
+			Register("list", i.List).
+			Register("info", i.Info).
+			Register("path", i.Path).
+			Register("create", i.Create).
+			Register("remove", i.Remove).
+			Register("resize", i.Resize).
+			Register("groups", i.Groups).
+			Register("group-info", i.GroupInfo).
+			Register("group-create", i.GroupCreate).
+			Register("group-remove", i.GroupRemove).
+			Register("group-resize", i.GroupResize).
+			Register("snaps", i.Snaps).
+			Register("snap-create", i.SnapCreate).
+			Register("snap-remove", i.SnapRemove).
+			Register("clone", i.Clone).
+			Register("clones", i.Clones).
+			Register("clone-status", i.CloneStatus).
+			Run(action)
+	}
+
+	return handler
+}
+
+func I_S3Handler(c config.IConfig) (f func(http.ResponseWriter, *http.Request)) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		action := mux.Vars(r)["action"]
+		i := api.NewIS3(c, w, r)
+
+		i.Register("index", i.Buckets).
+			Register("buckets", i.Buckets).
+			Register("list", i.List).
+			Register("head", i.Head).
+			Register("download", i.Download).
+			Register("upload", i.Upload).
+			Register("delete", i.Delete).
+			Register("presign", i.Presign).
+			Register("uploads", i.Uploads).
+			Register("upload-abort", i.UploadAbort).
+			Run(action)
+	}
+
+	return handler
+}
+
+func I_OsdHandler(c config.IConfig) (f func(http.ResponseWriter, *http.Request)) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		action := mux.Vars(r)["action"]
+		i := api.NewIOsd(c, w, r)
+
+		i.Register("index", i.List).
+			Register("list", i.List).
+			Register("tree", i.Tree).
+			Register("out", i.Out).
+			Register("in", i.In).
+			Register("down", i.Down).
+			Register("reweight", i.Reweight).
+			Register("set-class", i.SetClass).
+			Register("lost", i.Lost).
+			Run(action)
+	}
+
+	return handler
+}
+
+func I_FlagHandler(c config.IConfig) (f func(http.ResponseWriter, *http.Request)) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		action := mux.Vars(r)["action"]
+		i := api.NewIFlag(c, w, r)
+
+		i.Register("index", i.List).
+			Register("list", i.List).
+			Register("set", i.Set).
+			Register("unset", i.Unset).
+			Run(action)
+	}
+
+	return handler
+}
+
+func I_MaintenanceHandler(c config.IConfig) (f func(http.ResponseWriter, *http.Request)) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		action := mux.Vars(r)["action"]
+		i := api.NewIMaintenance(c, w, r)
+
+		i.Register("index", i.Status).
+			Register("status", i.Status).
+			Register("start", i.Start).
+			Register("end", i.End).
+			Register("extend", i.Extend).
+			Run(action)
+	}
+
+	return handler
+}
+
+func I_CrushHandler(c config.IConfig) (f func(http.ResponseWriter, *http.Request)) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		action := mux.Vars(r)["action"]
+		i := api.NewICrush(c, w, r)
+
+		i.Register("index", i.Tree).
+			Register("map", i.Map).
+			Register("tree", i.Tree).
+			Register("rules", i.Rules).
+			Register("classes", i.Classes).
+			Register("rule-create", i.RuleCreate).
+			Register("rule-remove", i.RuleRemove).
+			Register("move", i.Move).
+			Register("reweight", i.Reweight).
+			Run(action)
+	}
+
+	return handler
+}
+
+func I_PgHandler(c config.IConfig) (f func(http.ResponseWriter, *http.Request)) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		action := mux.Vars(r)["action"]
+		i := api.NewIPg(c, w, r)
+
+		i.Register("index", i.List).
+			Register("list", i.List).
+			Register("query", i.Query).
+			Register("scrub", i.Scrub).
+			Register("deep-scrub", i.DeepScrub).
+			Register("repair", i.Repair).
+			Register("inconsistent", i.Inconsistent).
+			Run(action)
+	}
+
+	return handler
+}
+
+func I_DaemonHandler(c config.IConfig) (f func(http.ResponseWriter, *http.Request)) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		action := mux.Vars(r)["action"]
+		i := api.NewIDaemon(c, w, r)
+
+		i.Register("index", i.Status).
+			Register("status", i.Status).
+			Register("mons", i.Mons).
+			Register("mgrs", i.Mgrs).
+			Register("module-enable", i.ModuleEnable).
+			Register("module-disable", i.ModuleDisable).
+			Run(action)
+	}
+
+	return handler
+}